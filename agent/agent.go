@@ -1228,6 +1228,20 @@ func newConsulConfig(runtimeCfg *config.RuntimeConfig, logger hclog.Logger) (*co
 	if runtimeCfg.ConnectEnabled {
 		cfg.ConnectEnabled = true
 		cfg.ConnectMeshGatewayWANFederationEnabled = runtimeCfg.ConnectMeshGatewayWANFederationEnabled
+		cfg.ConnectCAAuditFilePath = runtimeCfg.ConnectCAAuditFilePath
+		cfg.ConnectCAAuditURL = runtimeCfg.ConnectCAAuditURL
+		cfg.ConnectCAAuditSyslogFacility = runtimeCfg.ConnectCAAuditSyslogFacility
+		cfg.ConnectCAAuditSyslogTag = runtimeCfg.ConnectCAAuditSyslogTag
+		cfg.ConnectLeafExpiringSoonHorizon = runtimeCfg.ConnectLeafExpiringSoonHorizon
+		cfg.ConnectCASecondaryRotationDebounce = runtimeCfg.ConnectCASecondaryRotationDebounce
+		cfg.ConnectCAMaxCSRSize = runtimeCfg.ConnectCAMaxCSRSize
+		cfg.ConnectCAMaxChainSize = runtimeCfg.ConnectCAMaxChainSize
+		cfg.ConnectCAWarmup = runtimeCfg.ConnectCAWarmup
+		cfg.ConnectCAWarmupTimeout = runtimeCfg.ConnectCAWarmupTimeout
+		cfg.ConnectCARejectReusedSerialNumbers = runtimeCfg.ConnectCARejectReusedSerialNumbers
+		cfg.ConnectDormantIdentityWindow = runtimeCfg.ConnectDormantIdentityWindow
+		cfg.ConnectCARejectCALeaves = runtimeCfg.ConnectCARejectCALeaves
+		cfg.ConnectCARootsChainValidation = consul.RootsChainValidation(runtimeCfg.ConnectCARootsChainValidation)
 
 		ca, err := runtimeCfg.ConnectCAConfiguration()
 		if err != nil {
@@ -3,6 +3,7 @@ package agent
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -1563,6 +1564,91 @@ func (s *HTTPHandlers) AgentConnectCARoots(resp http.ResponseWriter, req *http.R
 	return *reply, nil
 }
 
+// AgentConnectCAMetrics renders the health of the Connect CA, as seen by this
+// server, in the Prometheus exposition format. The metrics are computed on
+// each request rather than read from the telemetry sink, so they don't depend
+// on the telemetry configuration.
+func (s *HTTPHandlers) AgentConnectCAMetrics(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	// Fetch the ACL token, if any, and enforce agent policy.
+	var token string
+	s.parseToken(req, &token)
+	authz, err := s.agent.delegate.ResolveTokenAndDefaultMeta(token, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Authorize using the agent's own enterprise meta, not the token.
+	var authzContext acl.AuthorizerContext
+	s.agent.AgentEnterpriseMeta().FillAuthzContext(&authzContext)
+	if authz.AgentRead(s.agent.config.NodeName, &authzContext) != acl.Allow {
+		return nil, acl.ErrPermissionDenied
+	}
+
+	srv, ok := s.agent.delegate.(*consul.Server)
+	if !ok {
+		return nil, NotFoundError{Reason: "Connect CA metrics are only available on servers"}
+	}
+	health, err := srv.ConnectCAHealth()
+	if err != nil {
+		return nil, err
+	}
+
+	registry := prometheus.NewRegistry()
+	gauge := func(name, help string, value float64, labels prometheus.Labels) {
+		g := prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   "consul",
+			Subsystem:   "connect_ca",
+			Name:        name,
+			Help:        help,
+			ConstLabels: labels,
+		})
+		g.Set(value)
+		registry.MustRegister(g)
+	}
+	timestamp := func(t time.Time) float64 {
+		if t.IsZero() {
+			return math.NaN()
+		}
+		return float64(t.Unix())
+	}
+	boolValue := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	gauge("root_expiry_timestamp_seconds", "Unix time at which the active root certificate expires.",
+		timestamp(health.RootNotAfter), prometheus.Labels{"root_id": health.RootID})
+	gauge("signing_cert_expiry_timestamp_seconds", "Unix time at which the certificate signing leaf certificates expires.",
+		timestamp(health.SigningCertNotAfter), nil)
+	gauge("state", "Set to 1 for the current state of the CA manager.",
+		1, prometheus.Labels{"state": health.State})
+	gauge("provider_healthy", "Whether the CA provider signs with the active root. Always 0 on servers other than the leader.",
+		boolValue(health.ProviderHealthy), prometheus.Labels{"provider": health.Provider})
+	if health.KeyLocation != "" {
+		gauge("provider_key_location", "Set to 1 for where the CA provider holds the keys of the CA.",
+			1, prometheus.Labels{"provider": health.Provider, "location": health.KeyLocation})
+	}
+	gauge("leaves_active", "Number of unexpired leaf certificates signed by this server as the leader.",
+		float64(health.LeavesActive), nil)
+	gauge("leaves_expiring_soon", "Number of unexpired leaf certificates signed by this server as the leader that expire soon.",
+		float64(health.LeavesExpiringSoon), nil)
+	gauge("identities_dormant", "Number of identities this server signed leaf certificates for as the leader, but none recently.",
+		float64(health.IdentitiesDormant), nil)
+	if health.ProviderUsageReported {
+		gauge("provider_issued", "Number of certificates the CA provider issued in its current billing period.",
+			float64(health.ProviderIssued), prometheus.Labels{"provider": health.Provider})
+		if health.ProviderQuota > 0 {
+			gauge("provider_quota_remaining", "Number of certificates the CA provider can still issue in its current billing period.",
+				float64(health.ProviderQuota-health.ProviderIssued), prometheus.Labels{"provider": health.Provider})
+		}
+	}
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(resp, req)
+	return nil, nil
+}
+
 // AgentConnectCALeafCert returns the certificate bundle for a service
 // instance. This endpoint ignores all "Cache-Control" attributes.
 // This supports blocking queries to update the returned bundle.
@@ -5707,6 +5707,54 @@ func TestAgentConnectCARoots_empty(t *testing.T) {
 	require.Contains(t, resp.Body.String(), "Connect must be enabled")
 }
 
+func TestAgentConnectCAMetrics(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+
+	a := NewTestAgent(t, "")
+	defer a.Shutdown()
+	testrpc.WaitForActiveCARoot(t, a.RPC, "dc1", nil)
+
+	var roots structs.IndexedCARoots
+	require.NoError(t, a.RPC("ConnectCA.Roots", &structs.DCSpecificRequest{Datacenter: "dc1"}, &roots))
+	active := roots.Active()
+	require.NotNil(t, active)
+
+	req, _ := http.NewRequest("GET", "/v1/agent/connect/ca/metrics", nil)
+	resp := httptest.NewRecorder()
+	a.srv.h.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	body := resp.Body.String()
+
+	for _, name := range []string{
+		"consul_connect_ca_root_expiry_timestamp_seconds",
+		"consul_connect_ca_signing_cert_expiry_timestamp_seconds",
+		`consul_connect_ca_state{state="INITIALIZED"} 1`,
+		`consul_connect_ca_provider_healthy{provider="consul"} 1`,
+		`consul_connect_ca_provider_key_location{location="consul-state",provider="consul"} 1`,
+		"consul_connect_ca_leaves_active",
+		"consul_connect_ca_leaves_expiring_soon",
+		"consul_connect_ca_identities_dormant",
+	} {
+		require.Contains(t, body, name)
+	}
+
+	prefix := fmt.Sprintf("consul_connect_ca_root_expiry_timestamp_seconds{root_id=%q} ", active.ID)
+	var rootExpiry string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			rootExpiry = strings.TrimPrefix(line, prefix)
+		}
+	}
+	require.NotEmpty(t, rootExpiry, "no root expiry metric in:\n%s", body)
+	value, err := strconv.ParseFloat(rootExpiry, 64)
+	require.NoError(t, err)
+	require.Equal(t, float64(active.NotAfter.Unix()), value)
+}
+
 func TestAgentConnectCARoots_list(t *testing.T) {
 	if testing.Short() {
 		t.Skip("too slow for testing.Short")
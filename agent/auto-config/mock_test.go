@@ -317,7 +317,7 @@ func (m *mockedConfig) expectInitialTLS(t *testing.T, agentName, datacenter, tok
 	leafRes := cache.FetchResult{
 		Value: &copy,
 		Index: copy.RaftIndex.ModifyIndex,
-		State: cachetype.ConnectCALeafSuccess(ca.SigningKeyID),
+		State: cachetype.ConnectCALeafSuccess(ca.SigningKeyID, ""),
 	}
 
 	// we should prepopulate the cache with the agents cert
@@ -86,7 +86,7 @@ func (ac *AutoConfig) setInitialTLSCertificates(certs *structs.SignedResponse) e
 }
 
 func (ac *AutoConfig) populateCertificateCache(certs *structs.SignedResponse) error {
-	cert, err := connect.ParseCert(certs.IssuedCert.CertPEM)
+	authorityKeyID, issuerAuthorityKeyID, err := connect.LeafAuthorityKeyIDs(certs.IssuedCert.CertPEM)
 	if err != nil {
 		return fmt.Errorf("Failed to parse certificate: %w", err)
 	}
@@ -105,7 +105,7 @@ func (ac *AutoConfig) populateCertificateCache(certs *structs.SignedResponse) er
 	certRes := cache.FetchResult{
 		Value: &certs.IssuedCert,
 		Index: certs.IssuedCert.RaftIndex.ModifyIndex,
-		State: cachetype.ConnectCALeafSuccess(connect.EncodeSigningKeyID(cert.AuthorityKeyId)),
+		State: cachetype.ConnectCALeafSuccess(authorityKeyID, issuerAuthorityKeyID),
 	}
 	if err := ac.acConfig.Cache.Prepopulate(cachetype.ConnectCALeafName, certRes, leafReq.Datacenter, leafReq.Token, leafReq.Key()); err != nil {
 		return err
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -105,6 +106,12 @@ type fetchState struct {
 	// we have to check if the root changed.
 	authorityKeyID string
 
+	// issuerAuthorityKeyID is the ID of the CA key that signed the intermediate
+	// which issued the current cert, if that intermediate was returned with the
+	// cert. Leaves signed by a delegated sub-intermediate are issued one level
+	// below the active root's signing key, so this is what identifies them.
+	issuerAuthorityKeyID string
+
 	// forceExpireAfter is used to coordinate renewing certs after a CA rotation
 	// in a staggered way so that we don't overwhelm the servers.
 	forceExpireAfter time.Time
@@ -122,9 +129,10 @@ type fetchState struct {
 	consecutiveRateLimitErrs int
 }
 
-func ConnectCALeafSuccess(authorityKeyID string) interface{} {
+func ConnectCALeafSuccess(authorityKeyID, issuerAuthorityKeyID string) interface{} {
 	return fetchState{
 		authorityKeyID:           authorityKeyID,
+		issuerAuthorityKeyID:     issuerAuthorityKeyID,
 		forceExpireAfter:         time.Time{},
 		consecutiveRateLimitErrs: 0,
 		activeRootRotationStart:  time.Time{},
@@ -391,7 +399,7 @@ func (c *ConnectCALeaf) Fetch(opts cache.FetchOptions, req cache.Request) (cache
 		if err != nil {
 			return lastResultWithNewState(), err
 		}
-		if activeRootHasKey(roots, state.authorityKeyID) {
+		if activeRootHasKey(roots, state) {
 			return lastResultWithNewState(), nil
 		}
 
@@ -452,7 +460,7 @@ func (c *ConnectCALeaf) Fetch(opts cache.FetchOptions, req cache.Request) (cache
 			// rootsWatcher didn't know about the CA we were signed by. We also rely
 			// on this on every request to do the initial check that the current roots
 			// are the same ones the current cert was signed by.
-			if activeRootHasKey(roots, state.authorityKeyID) {
+			if activeRootHasKey(roots, state) {
 				// Current active CA is the same one that signed our current cert so
 				// keep waiting for a change.
 				continue
@@ -483,10 +491,13 @@ func (c *ConnectCALeaf) Fetch(opts cache.FetchOptions, req cache.Request) (cache
 	}
 }
 
-func activeRootHasKey(roots *structs.IndexedCARoots, currentSigningKeyID string) bool {
+func activeRootHasKey(roots *structs.IndexedCARoots, state fetchState) bool {
 	for _, ca := range roots.Roots {
 		if ca.Active {
-			return ca.SigningKeyID == currentSigningKeyID
+			if ca.SigningKeyID == state.authorityKeyID {
+				return true
+			}
+			return state.issuerAuthorityKeyID != "" && ca.SigningKeyID == state.issuerAuthorityKeyID
 		}
 	}
 	// Shouldn't be possible since at least one root should be active.
@@ -592,7 +603,7 @@ func (c *ConnectCALeaf) generateNewLeaf(req *ConnectCALeafRequest,
 		CSR:          csr,
 	}
 	if err := c.RPC.RPC("ConnectCA.Sign", &args, &reply); err != nil {
-		if err.Error() == consul.ErrRateLimited.Error() {
+		if isRetryableSignError(err) {
 			if result.Value == nil {
 				// This was a first fetch - we have no good value in cache. In this case
 				// we just return the error to the caller rather than rely on surprising
@@ -603,7 +614,7 @@ func (c *ConnectCALeaf) generateNewLeaf(req *ConnectCALeafRequest,
 			}
 
 			if state.activeRootRotationStart.IsZero() {
-				// We hit a rate limit error by chance - for example a cert expired
+				// We hit a rate limit or not ready error by chance - for example a cert expired
 				// before the root rotation was observed (not triggered by rotation) but
 				// while server is working through high load from a recent rotation.
 				// Just pretend there is a rotation and the retry logic here will start
@@ -642,12 +653,11 @@ func (c *ConnectCALeaf) generateNewLeaf(req *ConnectCALeafRequest,
 	state.consecutiveRateLimitErrs = 0
 	state.activeRootRotationStart = time.Time{}
 
-	cert, err := connect.ParseCert(reply.CertPEM)
+	// Set the CA key ID so we can easily tell when a active root has changed.
+	state.authorityKeyID, state.issuerAuthorityKeyID, err = connect.LeafAuthorityKeyIDs(reply.CertPEM)
 	if err != nil {
 		return result, err
 	}
-	// Set the CA key ID so we can easily tell when a active root has changed.
-	state.authorityKeyID = connect.EncodeSigningKeyID(cert.AuthorityKeyId)
 
 	result.Value = &reply
 	// Store value not pointer so we don't accidentally mutate the cache entry
@@ -712,3 +722,14 @@ func (r *ConnectCALeafRequest) CacheInfo() cache.RequestInfo {
 		MustRevalidate: r.MustRevalidate,
 	}
 }
+
+// isRetryableSignError returns whether err is the error of a ConnectCA.Sign
+// request that will likely succeed once retried later, because the servers
+// are rate limiting signing, the CA provider didn't sign in time or the CA is
+// not ready yet. Errors lose their type over RPC so only their message can be
+// compared, and ErrCANotReady is wrapped with the reason.
+func isRetryableSignError(err error) bool {
+	return err.Error() == consul.ErrRateLimited.Error() ||
+		err.Error() == consul.ErrSignTimeout.Error() ||
+		strings.Contains(err.Error(), consul.ErrCANotReady.Error())
+}
@@ -3,6 +3,7 @@ package cachetype
 import (
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
@@ -145,6 +146,47 @@ func TestCalculateSoftExpire(t *testing.T) {
 
 // Test that after an initial signing, new CA roots (new ID) will
 // trigger a blocking query to execute.
+func TestActiveRootHasKey(t *testing.T) {
+	roots := &structs.IndexedCARoots{
+		Roots: []*structs.CARoot{
+			{SigningKeyID: "old"},
+			{SigningKeyID: "active", Active: true},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		state fetchState
+		want  bool
+	}{
+		{
+			name:  "signed by active key",
+			state: fetchState{authorityKeyID: "active"},
+			want:  true,
+		},
+		{
+			name:  "signed by sub-intermediate of active key",
+			state: fetchState{authorityKeyID: "sub", issuerAuthorityKeyID: "active"},
+			want:  true,
+		},
+		{
+			name:  "signed by old key",
+			state: fetchState{authorityKeyID: "old"},
+			want:  false,
+		},
+		{
+			name:  "signed by sub-intermediate of old key",
+			state: fetchState{authorityKeyID: "sub", issuerAuthorityKeyID: "old"},
+			want:  false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, activeRootHasKey(roots, tc.state))
+		})
+	}
+}
+
 func TestConnectCALeaf_changingRoots(t *testing.T) {
 	if testing.Short() {
 		t.Skip("too slow for testing.Short")
@@ -695,6 +737,126 @@ func TestConnectCALeaf_CSRRateLimiting(t *testing.T) {
 	}
 }
 
+// Tests that a sign request refused because the CA is not ready yet is retried
+// with the same backoff as a rate limited one.
+func TestConnectCALeaf_CANotReady(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+
+	rpc := TestRPC(t)
+	defer rpc.AssertExpectations(t)
+
+	typ, rootsCh := testCALeafType(t, rpc)
+	defer close(rootsCh)
+
+	typ.TestOverrideCAChangeInitialDelay = 100 * time.Millisecond
+
+	caRoot := connect.TestCA(t, nil)
+	caRoot.Active = true
+	rootsCh <- structs.IndexedCARoots{
+		ActiveRootID: caRoot.ID,
+		TrustDomain:  "fake-trust-domain.consul",
+		Roots: []*structs.CARoot{
+			caRoot,
+		},
+		QueryMeta: structs.QueryMeta{Index: 1},
+	}
+
+	var resp *structs.IssuedCert
+	var idx, notReadyRPCs uint64
+
+	genCert := func(args mock.Arguments) {
+		reply := args.Get(2).(*structs.IssuedCert)
+		leaf, _ := connect.TestLeaf(t, "web", caRoot)
+		reply.CertPEM = leaf
+		reply.ValidAfter = time.Now().Add(-1 * time.Hour)
+		reply.ValidBefore = time.Now().Add(11 * time.Hour)
+		reply.CreateIndex = atomic.AddUint64(&idx, 1)
+		reply.ModifyIndex = reply.CreateIndex
+		resp = reply
+	}
+	incNotReady := func(args mock.Arguments) {
+		atomic.AddUint64(&notReadyRPCs, 1)
+	}
+
+	// The error is wrapped with the reason, and only its message crosses the
+	// RPC boundary.
+	errNotReady := errors.New(fmt.Errorf("%w: CA state is INITIALIZING", consul.ErrCANotReady).Error())
+	rpc.On("RPC", "ConnectCA.Sign", mock.Anything, mock.Anything).
+		Return(errNotReady).Once().Run(incNotReady)
+	rpc.On("RPC", "ConnectCA.Sign", mock.Anything, mock.Anything).
+		Return(nil).Run(genCert).Once()
+	rpc.On("RPC", "ConnectCA.Sign", mock.Anything, mock.Anything).
+		Return(errNotReady).Once().Run(incNotReady)
+	rpc.On("RPC", "ConnectCA.Sign", mock.Anything, mock.Anything).
+		Return(nil).Run(genCert)
+
+	opts := cache.FetchOptions{MinIndex: 0, Timeout: 10 * time.Minute}
+	req := &ConnectCALeafRequest{Datacenter: "dc1", Service: "web"}
+
+	// Without a cached certificate the error is returned.
+	fetchCh := TestFetchCh(t, typ, opts, req)
+	select {
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("shouldn't block waiting for fetch")
+	case result := <-fetchCh:
+		v, ok := result.(error)
+		require.True(t, ok, "expected an error, got %v", result)
+		require.Equal(t, errNotReady.Error(), v.Error())
+	}
+
+	fetchCh = TestFetchCh(t, typ, opts, req)
+	select {
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("shouldn't block waiting for fetch")
+	case result := <-fetchCh:
+		v := mustFetchResult(t, result)
+		require.Equal(t, resp, v.Value)
+		require.Equal(t, uint64(1), v.Index)
+		opts.LastResult = &v
+		opts.MinIndex = 1
+	}
+
+	caRoot2 := connect.TestCA(t, nil)
+	caRoot2.Active = true
+	caRoot.Active = false
+	rootsCh <- structs.IndexedCARoots{
+		ActiveRootID: caRoot2.ID,
+		TrustDomain:  "fake-trust-domain.consul",
+		Roots: []*structs.CARoot{
+			caRoot2,
+			caRoot,
+		},
+		QueryMeta: structs.QueryMeta{Index: atomic.AddUint64(&idx, 1)},
+	}
+
+	// With a cached certificate it's kept while the new one is retried.
+	fetchCh = TestFetchCh(t, typ, opts, req)
+	select {
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("shouldn't block too long waiting for fetch")
+	case result := <-fetchCh:
+		require.Equal(t, uint64(2), atomic.LoadUint64(&notReadyRPCs))
+		v := mustFetchResult(t, result)
+		require.Equal(t, resp, v.Value)
+		require.Equal(t, uint64(1), v.Index)
+		opts.LastResult = &v
+	}
+
+	fetchCh = TestFetchCh(t, typ, opts, req)
+	select {
+	case <-time.After(300 * time.Millisecond):
+		t.Fatal("shouldn't block too long waiting for fetch")
+	case result := <-fetchCh:
+		v := mustFetchResult(t, result)
+		require.Equal(t, resp, v.Value)
+		require.Equal(t, uint64(3), v.Index)
+	}
+}
+
 // This test runs multiple concurrent callers watching different leaf certs and
 // tries to ensure that the background root watch activity behaves correctly.
 func TestConnectCALeaf_watchRootsDedupingMultipleCallers(t *testing.T) {
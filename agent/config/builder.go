@@ -701,9 +701,14 @@ func (b *builder) build() (rt RuntimeConfig, err error) {
 		// nolint: staticcheck // CA config should be changed to use HookTranslateKeys
 		lib.TranslateKeys(connectCAConfig, map[string]string{
 			// Consul CA config
-			"private_key":           "PrivateKey",
-			"root_cert":             "RootCert",
-			"intermediate_cert_ttl": "IntermediateCertTTL",
+			"private_key":             "PrivateKey",
+			"root_cert":               "RootCert",
+			"intermediate_cert_ttl":   "IntermediateCertTTL",
+			"csr_extension_policy":    "CSRExtensionPolicy",
+			"csr_extension_allowlist": "CSRExtensionAllowlist",
+			"tpm_attestation_roots":   "TPMAttestationRoots",
+			"crl_signer_enabled":      "CRLSignerEnabled",
+			"crl_signer_cert_ttl":     "CRLSignerCertTTL",
 
 			// Vault CA config
 			"address":               "Address",
@@ -716,18 +721,90 @@ func (b *builder) build() (rt RuntimeConfig, err error) {
 			"key_file":              "KeyFile",
 			"tls_server_name":       "TLSServerName",
 			"tls_skip_verify":       "TLSSkipVerify",
+			"ssh_pki_path":          "SSHPKIPath",
+			"ssh_allowed_domains":   "SSHAllowedDomains",
+
+			"ssh_allow_user_certificates": "SSHAllowUserCertificates",
+			"ssh_allowed_users":           "SSHAllowedUsers",
 
 			// AWS CA config
-			"existing_arn":   "ExistingARN",
-			"delete_on_exit": "DeleteOnExit",
+			"existing_arn":             "ExistingARN",
+			"delete_on_exit":           "DeleteOnExit",
+			"monthly_issuance_quota":   "MonthlyIssuanceQuota",
+			"assume_role_arn":          "AssumeRoleARN",
+			"assume_role_external_id":  "AssumeRoleExternalID",
+			"assume_role_session_name": "AssumeRoleSessionName",
 
 			// Common CA config
-			"leaf_cert_ttl":      "LeafCertTTL",
-			"csr_max_per_second": "CSRMaxPerSecond",
-			"csr_max_concurrent": "CSRMaxConcurrent",
-			"private_key_type":   "PrivateKeyType",
-			"private_key_bits":   "PrivateKeyBits",
-			"root_cert_ttl":      "RootCertTTL",
+			"leaf_cert_ttl":          "LeafCertTTL",
+			"csr_max_per_second":     "CSRMaxPerSecond",
+			"csr_max_concurrent":     "CSRMaxConcurrent",
+			"private_key_type":       "PrivateKeyType",
+			"private_key_bits":       "PrivateKeyBits",
+			"root_cert_ttl":          "RootCertTTL",
+			"require_attestation":    "RequireAttestation",
+			"root_signing_fallback":  "RootSigningFallback",
+			"trust_domain":           "TrustDomain",
+			"previous_trust_domain":  "PreviousTrustDomain",
+			"max_active_roots":       "MaxActiveRoots",
+			"root_generation_quorum": "RootGenerationQuorum",
+			"initialization_timeout": "InitializationTimeout",
+
+			"bootstrap_cert_ttl":           "BootstrapCertTTL",
+			"bootstrap_csr_max_per_second": "BootstrapCSRMaxPerSecond",
+			"additional_trust_anchors":     "AdditionalTrustAnchors",
+			"federation_collision_policy":  "FederationCollisionPolicy",
+
+			"force_renew_on_leaf_ttl_decrease": "ForceRenewOnLeafTTLDecrease",
+			"intermediate_grace_period":        "IntermediateGracePeriod",
+			"min_intermediate_remaining":       "MinIntermediateRemaining",
+			"leaf_renewal_overlap":             "LeafRenewalOverlap",
+			"intermediate_sign_max_concurrent": "IntermediateSignMaxConcurrent",
+			"acknowledge_key_downgrade":        "AcknowledgeKeyDowngrade",
+			"allow_single_tier":                "AllowSingleTier",
+			"include_issuing_chain":            "IncludeIssuingChain",
+
+			"cert_templates":        "CertTemplates",
+			"cert_template_rules":   "CertTemplateRules",
+			"default_cert_template": "DefaultCertTemplate",
+			"ext_key_usage":         "ExtKeyUsage",
+			"policy_oids":           "PolicyOIDs",
+			"key_usage":             "KeyUsage",
+			"identity_type":         "IdentityType",
+			"pattern":               "Pattern",
+			"template":              "Template",
+
+			"max_service_leaf_cert_ttl": "MaxServiceLeafCertTTL",
+
+			"csr_max_per_second_per_identity": "CSRMaxPerSecondPerIdentity",
+			"csr_burst_per_identity":          "CSRBurstPerIdentity",
+
+			"federated_trust_domains": "FederatedTrustDomains",
+
+			"jwt_signing":             "JWTSigning",
+			"jwks_url":                "JWKSURL",
+			"jwks_ca_cert":            "JWKSCACert",
+			"jwt_validation_pub_keys": "JWTValidationPubKeys",
+			"oidc_discovery_url":      "OIDCDiscoveryURL",
+			"oidc_discovery_ca_cert":  "OIDCDiscoveryCACert",
+			"bound_issuer":            "BoundIssuer",
+			"bound_audiences":         "BoundAudiences",
+			"jwt_supported_algs":      "JWTSupportedAlgs",
+			"expiration_leeway":       "ExpirationLeeway",
+			"not_before_leeway":       "NotBeforeLeeway",
+			"clock_skew_leeway":       "ClockSkewLeeway",
+			"service_claim":           "ServiceClaim",
+			"allowed_services":        "AllowedServices",
+
+			"audit_sink":  "AuditSink",
+			"buffer_size": "BufferSize",
+
+			"intermediate_cert_subject": "IntermediateCertSubject",
+			"organizational_unit":       "OrganizationalUnit",
+			"street_address":            "StreetAddress",
+			"postal_code":               "PostalCode",
+
+			"intermediate_csr_signature_algorithm": "IntermediateCSRSignatureAlgorithm",
 		})
 	}
 
@@ -979,6 +1056,20 @@ func (b *builder) build() (rt RuntimeConfig, err error) {
 		ConnectCAProvider:                      connectCAProvider,
 		ConnectCAConfig:                        connectCAConfig,
 		ConnectMeshGatewayWANFederationEnabled: connectMeshGatewayWANFederationEnabled,
+		ConnectCAAuditFilePath:                 stringVal(c.Connect.CAAuditFilePath),
+		ConnectCAAuditURL:                      stringVal(c.Connect.CAAuditURL),
+		ConnectCAAuditSyslogFacility:           stringVal(c.Connect.CAAuditSyslogFacility),
+		ConnectCAAuditSyslogTag:                stringVal(c.Connect.CAAuditSyslogTag),
+		ConnectLeafExpiringSoonHorizon:         b.durationVal("connect.leaf_expiring_soon_horizon", c.Connect.LeafExpiringSoonHorizon),
+		ConnectCASecondaryRotationDebounce:     b.durationVal("connect.ca_secondary_rotation_debounce", c.Connect.CASecondaryRotationDebounce),
+		ConnectCAMaxCSRSize:                    intVal(c.Connect.CAMaxCSRSize),
+		ConnectCAMaxChainSize:                  intVal(c.Connect.CAMaxChainSize),
+		ConnectCAWarmup:                        boolVal(c.Connect.CAWarmup),
+		ConnectCAWarmupTimeout:                 b.durationVal("connect.ca_warmup_timeout", c.Connect.CAWarmupTimeout),
+		ConnectCARejectReusedSerialNumbers:     boolVal(c.Connect.CARejectReusedSerialNumbers),
+		ConnectDormantIdentityWindow:           b.durationVal("connect.dormant_identity_window", c.Connect.DormantIdentityWindow),
+		ConnectCARejectCALeaves:                boolVal(c.Connect.CARejectCALeaves),
+		ConnectCARootsChainValidation:          stringVal(c.Connect.CARootsChainValidation),
 		ConnectSidecarMinPort:                  sidecarMinPort,
 		ConnectSidecarMaxPort:                  sidecarMaxPort,
 		ConnectTestCALeafRootChangeSpread:      b.durationVal("connect.test_ca_leaf_root_change_spread", c.Connect.TestCALeafRootChangeSpread),
@@ -1342,6 +1433,29 @@ func (b *builder) validate(rt RuntimeConfig) error {
 			return fmt.Errorf("'retry_join_wan' is incompatible with 'connect.enable_mesh_gateway_wan_federation = true'")
 		}
 	}
+	if rt.ConnectLeafExpiringSoonHorizon < 0 {
+		return fmt.Errorf("connect.leaf_expiring_soon_horizon cannot be %s. Must be greater than or equal to zero", rt.ConnectLeafExpiringSoonHorizon)
+	}
+	if rt.ConnectCASecondaryRotationDebounce < 0 {
+		return fmt.Errorf("connect.ca_secondary_rotation_debounce cannot be %s. Must be greater than or equal to zero", rt.ConnectCASecondaryRotationDebounce)
+	}
+	if rt.ConnectCAMaxCSRSize < 0 {
+		return fmt.Errorf("connect.ca_max_csr_size cannot be %d. Must be greater than or equal to zero", rt.ConnectCAMaxCSRSize)
+	}
+	if rt.ConnectCAMaxChainSize < 0 {
+		return fmt.Errorf("connect.ca_max_chain_size cannot be %d. Must be greater than or equal to zero", rt.ConnectCAMaxChainSize)
+	}
+	if rt.ConnectCAWarmupTimeout <= 0 {
+		return fmt.Errorf("connect.ca_warmup_timeout cannot be %s. Must be greater than zero", rt.ConnectCAWarmupTimeout)
+	}
+	if rt.ConnectDormantIdentityWindow < 0 {
+		return fmt.Errorf("connect.dormant_identity_window cannot be %s. Must be greater than or equal to zero", rt.ConnectDormantIdentityWindow)
+	}
+	switch consul.RootsChainValidation(rt.ConnectCARootsChainValidation) {
+	case consul.RootsChainValidationOff, consul.RootsChainValidationFlag, consul.RootsChainValidationOmit:
+	default:
+		return fmt.Errorf("connect.ca_roots_chain_validation: invalid value %q. Must be one of \"off\", \"flag\" or \"omit\"", rt.ConnectCARootsChainValidation)
+	}
 	if len(rt.PrimaryGateways) > 0 {
 		if !rt.ServerMode {
 			return fmt.Errorf("'primary_gateways' requires 'server = true'")
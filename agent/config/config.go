@@ -613,6 +613,50 @@ type Connect struct {
 	CAConfig                        map[string]interface{} `mapstructure:"ca_config"`
 	MeshGatewayWANFederationEnabled *bool                  `mapstructure:"enable_mesh_gateway_wan_federation"`
 
+	// CAAudit* are the destinations of the CA audit sink. They are only set
+	// in the configuration of the servers, not in the CA configuration, so
+	// that the operators able to change the latter can't pick them.
+	CAAuditFilePath       *string `mapstructure:"ca_audit_file_path"`
+	CAAuditURL            *string `mapstructure:"ca_audit_url"`
+	CAAuditSyslogFacility *string `mapstructure:"ca_audit_syslog_facility"`
+	CAAuditSyslogTag      *string `mapstructure:"ca_audit_syslog_tag"`
+
+	// LeafExpiringSoonHorizon is how close to its expiry a leaf certificate
+	// counts towards the connect.ca.leaves.expiring_soon metric of servers.
+	LeafExpiringSoonHorizon *string `mapstructure:"leaf_expiring_soon_horizon"`
+
+	// CASecondaryRotationDebounce is how long the servers of a secondary
+	// datacenter wait after the primary changed its active root before
+	// renewing their intermediate.
+	CASecondaryRotationDebounce *string `mapstructure:"ca_secondary_rotation_debounce"`
+
+	// CAMaxCSRSize and CAMaxChainSize limit the size, in bytes, of the
+	// CSRs and of the PEM bundles the CA accepts to parse.
+	CAMaxCSRSize   *int `mapstructure:"ca_max_csr_size"`
+	CAMaxChainSize *int `mapstructure:"ca_max_chain_size"`
+
+	// CAWarmup makes a new leader check the CA provider still signs with
+	// the active root before signing, within CAWarmupTimeout.
+	CAWarmup        *bool   `mapstructure:"ca_warmup"`
+	CAWarmupTimeout *string `mapstructure:"ca_warmup_timeout"`
+
+	// CARejectReusedSerialNumbers makes the leader refuse leaf certificates
+	// reusing the serial number of another one that is still valid.
+	CARejectReusedSerialNumbers *bool `mapstructure:"ca_reject_reused_serial_numbers"`
+
+	// DormantIdentityWindow is how long after its last leaf certificate
+	// was signed an identity counts towards the connect.ca.identities.dormant
+	// metric of servers.
+	DormantIdentityWindow *string `mapstructure:"dormant_identity_window"`
+
+	// CARejectCALeaves makes the leader refuse leaf certificates the CA
+	// provider signed that could sign other certificates.
+	CARejectCALeaves *bool `mapstructure:"ca_reject_ca_leaves"`
+
+	// CARootsChainValidation is how the roots whose intermediates don't
+	// chain up to their root cert are served to clients.
+	CARootsChainValidation *string `mapstructure:"ca_roots_chain_validation"`
+
 	// TestCALeafRootChangeSpread controls how long after a CA roots change before new leaft certs will be generated.
 	// This is only tuned in tests, generally set to 1ns to make tests deterministic with when to expect updated leaf
 	// certs by. This configuration is not exposed to users (not documented, and agent/config/default.go will override it)
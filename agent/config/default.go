@@ -81,6 +81,15 @@ func DefaultSource() Source {
 			probe_timeout = "` + serfWAN.ProbeTimeout.String() + `"
 			suspicion_mult = ` + strconv.Itoa(serfWAN.SuspicionMult) + `
 		}
+		connect = {
+			leaf_expiring_soon_horizon = "` + cfg.ConnectLeafExpiringSoonHorizon.String() + `"
+			ca_max_csr_size = ` + strconv.Itoa(cfg.ConnectCAMaxCSRSize) + `
+			ca_max_chain_size = ` + strconv.Itoa(cfg.ConnectCAMaxChainSize) + `
+			ca_warmup_timeout = "` + cfg.ConnectCAWarmupTimeout.String() + `"
+			dormant_identity_window = "` + cfg.ConnectDormantIdentityWindow.String() + `"
+			ca_reject_ca_leaves = ` + strconv.FormatBool(cfg.ConnectCARejectCALeaves) + `
+			ca_roots_chain_validation = "` + string(cfg.ConnectCARootsChainValidation) + `"
+		}
 		dns_config = {
 			allow_stale = true
 			a_record_limit = 0
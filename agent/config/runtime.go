@@ -514,6 +514,87 @@ type RuntimeConfig struct {
 	// datacenters should exclusively traverse mesh gateways.
 	ConnectMeshGatewayWANFederationEnabled bool
 
+	// ConnectCAAuditFilePath is the file the "file" CA audit sink appends
+	// the records of the signed leaf certificates to.
+	//
+	// hcl: connect { ca_audit_file_path = string }
+	ConnectCAAuditFilePath string
+
+	// ConnectCAAuditURL is the HTTP or HTTPS endpoint the "http" CA audit
+	// sink POSTs the records of the signed leaf certificates to.
+	//
+	// hcl: connect { ca_audit_url = string }
+	ConnectCAAuditURL string
+
+	// ConnectCAAuditSyslogFacility and ConnectCAAuditSyslogTag are those of
+	// the records sent by the "syslog" CA audit sink.
+	//
+	// hcl: connect { ca_audit_syslog_facility = string ca_audit_syslog_tag = string }
+	ConnectCAAuditSyslogFacility string
+	ConnectCAAuditSyslogTag      string
+
+	// ConnectLeafExpiringSoonHorizon is how close to its expiry a leaf
+	// certificate counts towards the connect.ca.leaves.expiring_soon metric.
+	//
+	// hcl: connect { leaf_expiring_soon_horizon = duration }
+	ConnectLeafExpiringSoonHorizon time.Duration
+
+	// ConnectCASecondaryRotationDebounce is how long a secondary datacenter
+	// waits after seeing the primary change its active root before renewing
+	// its intermediate, so that a rotation done in several steps only causes
+	// one renewal. Zero renews right away.
+	//
+	// hcl: connect { ca_secondary_rotation_debounce = duration }
+	ConnectCASecondaryRotationDebounce time.Duration
+
+	// ConnectCAMaxCSRSize is the largest PEM-encoded CSR, in bytes, the CA
+	// accepts to sign. ConnectCAMaxChainSize is the largest PEM bundle, in
+	// bytes, the CA accepts from the CA provider or the primary datacenter.
+	// Zero disables the limit.
+	//
+	// hcl: connect { ca_max_csr_size = int ca_max_chain_size = int }
+	ConnectCAMaxCSRSize   int
+	ConnectCAMaxChainSize int
+
+	// ConnectCAWarmup makes a new leader check, once the CA is initialized,
+	// that the CA provider still signs with the active root. The CA refuses
+	// to sign when it fails. ConnectCAWarmupTimeout bounds how long these
+	// checks, and the warming of the CA provider, may take.
+	//
+	// hcl: connect { ca_warmup = (true|false) ca_warmup_timeout = duration }
+	ConnectCAWarmup        bool
+	ConnectCAWarmupTimeout time.Duration
+
+	// ConnectCARejectReusedSerialNumbers makes the leader refuse to hand out
+	// a leaf certificate with the serial number of another one that is still
+	// valid. Only the leaves signed since the server became the leader are
+	// known.
+	//
+	// hcl: connect { ca_reject_reused_serial_numbers = (true|false) }
+	ConnectCARejectReusedSerialNumbers bool
+
+	// ConnectDormantIdentityWindow is how long after its last leaf
+	// certificate was signed an identity counts towards the
+	// connect.ca.identities.dormant metric.
+	//
+	// hcl: connect { dormant_identity_window = duration }
+	ConnectDormantIdentityWindow time.Duration
+
+	// ConnectCARejectCALeaves makes the leader refuse to hand out a leaf
+	// certificate that is a CA certificate or whose key usage includes
+	// certificate signing, whatever the CSR asked for.
+	//
+	// hcl: connect { ca_reject_ca_leaves = (true|false) }
+	ConnectCARejectCALeaves bool
+
+	// ConnectCARootsChainValidation is how roots whose intermediates don't
+	// all chain up to their root cert, as can happen transiently during a
+	// rotation, are served to clients: "off", "flag" or "omit". See
+	// consul.RootsChainValidation.
+	//
+	// hcl: connect { ca_roots_chain_validation = string }
+	ConnectCARootsChainValidation string
+
 	// ConnectTestCALeafRootChangeSpread is used to control how long the CA leaf
 	// cache with spread CSRs over when a root change occurs. For now we don't
 	// expose this in public config intentionally but could later with a rename.
@@ -3496,6 +3496,185 @@ func TestLoad_IntegrationWithFlags(t *testing.T) {
 		},
 	})
 
+	run(t, testCase{
+		desc: "connect.leaf_expiring_soon_horizon",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json: []string{`{ "connect": { "leaf_expiring_soon_horizon": "6h" } }`},
+		hcl:  []string{`connect { leaf_expiring_soon_horizon = "6h" }`},
+		expected: func(rt *RuntimeConfig) {
+			rt.DataDir = dataDir
+			rt.ConnectLeafExpiringSoonHorizon = 6 * time.Hour
+		},
+	})
+	run(t, testCase{
+		desc: "connect.leaf_expiring_soon_horizon invalid",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json:        []string{`{ "connect": { "leaf_expiring_soon_horizon": "-1h" } }`},
+		hcl:         []string{`connect { leaf_expiring_soon_horizon = "-1h" }`},
+		expectedErr: "connect.leaf_expiring_soon_horizon cannot be -1h0m0s. Must be greater than or equal to zero",
+	})
+
+	run(t, testCase{
+		desc: "connect.ca_secondary_rotation_debounce",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json: []string{`{ "connect": { "ca_secondary_rotation_debounce": "30s" } }`},
+		hcl:  []string{`connect { ca_secondary_rotation_debounce = "30s" }`},
+		expected: func(rt *RuntimeConfig) {
+			rt.DataDir = dataDir
+			rt.ConnectCASecondaryRotationDebounce = 30 * time.Second
+		},
+	})
+	run(t, testCase{
+		desc: "connect.ca_secondary_rotation_debounce invalid",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json:        []string{`{ "connect": { "ca_secondary_rotation_debounce": "-1s" } }`},
+		hcl:         []string{`connect { ca_secondary_rotation_debounce = "-1s" }`},
+		expectedErr: "connect.ca_secondary_rotation_debounce cannot be -1s. Must be greater than or equal to zero",
+	})
+
+	run(t, testCase{
+		desc: "connect.ca_max_csr_size and connect.ca_max_chain_size",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json: []string{`{ "connect": { "ca_max_csr_size": 1024, "ca_max_chain_size": 0 } }`},
+		hcl:  []string{`connect { ca_max_csr_size = 1024 ca_max_chain_size = 0 }`},
+		expected: func(rt *RuntimeConfig) {
+			rt.DataDir = dataDir
+			rt.ConnectCAMaxCSRSize = 1024
+			rt.ConnectCAMaxChainSize = 0
+		},
+	})
+	run(t, testCase{
+		desc: "connect.ca_max_csr_size invalid",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json:        []string{`{ "connect": { "ca_max_csr_size": -1 } }`},
+		hcl:         []string{`connect { ca_max_csr_size = -1 }`},
+		expectedErr: "connect.ca_max_csr_size cannot be -1. Must be greater than or equal to zero",
+	})
+	run(t, testCase{
+		desc: "connect.ca_max_chain_size invalid",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json:        []string{`{ "connect": { "ca_max_chain_size": -1 } }`},
+		hcl:         []string{`connect { ca_max_chain_size = -1 }`},
+		expectedErr: "connect.ca_max_chain_size cannot be -1. Must be greater than or equal to zero",
+	})
+
+	run(t, testCase{
+		desc: "connect.ca_warmup and connect.ca_warmup_timeout",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json: []string{`{ "connect": { "ca_warmup": true, "ca_warmup_timeout": "5s" } }`},
+		hcl:  []string{`connect { ca_warmup = true ca_warmup_timeout = "5s" }`},
+		expected: func(rt *RuntimeConfig) {
+			rt.DataDir = dataDir
+			rt.ConnectCAWarmup = true
+			rt.ConnectCAWarmupTimeout = 5 * time.Second
+		},
+	})
+	run(t, testCase{
+		desc: "connect.ca_warmup_timeout invalid",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json:        []string{`{ "connect": { "ca_warmup_timeout": "0s" } }`},
+		hcl:         []string{`connect { ca_warmup_timeout = "0s" }`},
+		expectedErr: "connect.ca_warmup_timeout cannot be 0s. Must be greater than zero",
+	})
+
+	run(t, testCase{
+		desc: "connect.ca_reject_reused_serial_numbers",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json: []string{`{ "connect": { "ca_reject_reused_serial_numbers": true } }`},
+		hcl:  []string{`connect { ca_reject_reused_serial_numbers = true }`},
+		expected: func(rt *RuntimeConfig) {
+			rt.DataDir = dataDir
+			rt.ConnectCARejectReusedSerialNumbers = true
+		},
+	})
+
+	run(t, testCase{
+		desc: "connect.dormant_identity_window",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json: []string{`{ "connect": { "dormant_identity_window": "48h" } }`},
+		hcl:  []string{`connect { dormant_identity_window = "48h" }`},
+		expected: func(rt *RuntimeConfig) {
+			rt.DataDir = dataDir
+			rt.ConnectDormantIdentityWindow = 48 * time.Hour
+		},
+	})
+	run(t, testCase{
+		desc: "connect.dormant_identity_window invalid",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json:        []string{`{ "connect": { "dormant_identity_window": "-1h" } }`},
+		hcl:         []string{`connect { dormant_identity_window = "-1h" }`},
+		expectedErr: "connect.dormant_identity_window cannot be -1h0m0s. Must be greater than or equal to zero",
+	})
+
+	run(t, testCase{
+		desc: "connect.ca_reject_ca_leaves default",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		expected: func(rt *RuntimeConfig) {
+			rt.DataDir = dataDir
+			rt.ConnectCARejectCALeaves = true
+		},
+	})
+	run(t, testCase{
+		desc: "connect.ca_reject_ca_leaves disabled",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json: []string{`{ "connect": { "ca_reject_ca_leaves": false } }`},
+		hcl:  []string{`connect { ca_reject_ca_leaves = false }`},
+		expected: func(rt *RuntimeConfig) {
+			rt.DataDir = dataDir
+			rt.ConnectCARejectCALeaves = false
+		},
+	})
+
+	run(t, testCase{
+		desc: "connect.ca_roots_chain_validation",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json: []string{`{ "connect": { "ca_roots_chain_validation": "off" } }`},
+		hcl:  []string{`connect { ca_roots_chain_validation = "off" }`},
+		expected: func(rt *RuntimeConfig) {
+			rt.DataDir = dataDir
+			rt.ConnectCARootsChainValidation = "off"
+		},
+	})
+	run(t, testCase{
+		desc: "connect.ca_roots_chain_validation invalid",
+		args: []string{
+			`-data-dir=` + dataDir,
+		},
+		json:        []string{`{ "connect": { "ca_roots_chain_validation": "drop" } }`},
+		hcl:         []string{`connect { ca_roots_chain_validation = "drop" }`},
+		expectedErr: `connect.ca_roots_chain_validation: invalid value "drop". Must be one of "off", "flag" or "omit"`,
+	})
+
 	// ------------------------------------------------------------
 	// ConfigEntry Handling
 	//
@@ -5536,8 +5715,23 @@ func TestLoad_FullConfig(t *testing.T) {
 			"RootCertTTL":         "96360h",
 			"CSRMaxPerSecond":     float64(100),
 			"CSRMaxConcurrent":    float64(2),
+			"LeafRenewalOverlap":  "10m",
 		},
 		ConnectMeshGatewayWANFederationEnabled: false,
+		ConnectCAAuditFilePath:                 "/var/log/consul/ca-audit.log",
+		ConnectCAAuditURL:                      "https://siem.example.com/consul",
+		ConnectCAAuditSyslogFacility:           "LOCAL3",
+		ConnectCAAuditSyslogTag:                "8KuYgEw4",
+		ConnectCARootsChainValidation:          "omit",
+		ConnectCARejectCALeaves:                false,
+		ConnectDormantIdentityWindow:           72 * time.Hour,
+		ConnectCARejectReusedSerialNumbers:     true,
+		ConnectCAWarmup:                        true,
+		ConnectCAWarmupTimeout:                 12 * time.Second,
+		ConnectCAMaxCSRSize:                    16384,
+		ConnectCAMaxChainSize:                  262144,
+		ConnectCASecondaryRotationDebounce:     45 * time.Second,
+		ConnectLeafExpiringSoonHorizon:         12 * time.Hour,
 		DNSAddrs:                               []net.Addr{tcpAddr("93.95.95.81:7001"), udpAddr("93.95.95.81:7001")},
 		DNSARecordLimit:                        29907,
 		DNSAllowStale:                          true,
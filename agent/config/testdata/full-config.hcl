@@ -207,7 +207,22 @@ connect {
         # assert against the same thing
         csr_max_per_second = 100.0
         csr_max_concurrent = 2.0
+        leaf_renewal_overlap = "10m"
     }
+    ca_audit_file_path = "/var/log/consul/ca-audit.log"
+    ca_audit_url = "https://siem.example.com/consul"
+    ca_audit_syslog_facility = "LOCAL3"
+    ca_audit_syslog_tag = "8KuYgEw4"
+    leaf_expiring_soon_horizon = "12h"
+    ca_secondary_rotation_debounce = "45s"
+    ca_max_csr_size = 16384
+    ca_max_chain_size = 262144
+    ca_warmup = true
+    ca_warmup_timeout = "12s"
+    ca_reject_reused_serial_numbers = true
+    dormant_identity_window = "72h"
+    ca_reject_ca_leaves = false
+    ca_roots_chain_validation = "omit"
     enable_mesh_gateway_wan_federation = false
     enabled = true
 }
@@ -2,13 +2,23 @@ package ca
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/consul/agent/connect"
+	"github.com/hashicorp/consul/agent/structs"
 )
 
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
 func validateSetIntermediate(intermediatePEM, rootPEM string, spiffeID *connect.SpiffeIDSigning) error {
 	// Get the key from the incoming intermediate cert so we can compare it
 	// to the currently stored key.
@@ -93,14 +103,167 @@ func validateSignIntermediate(csr *x509.CertificateRequest, spiffeID *connect.Sp
 	return nil
 }
 
+// csrExtensionsForPolicy checks the extensions requested by a leaf CSR against
+// the given structs.CSRExtensionPolicy and returns the requested extensions
+// which should be copied into the leaf certificate.
+func csrExtensionsForPolicy(csr *x509.CertificateRequest, policy string, allowlist []asn1.ObjectIdentifier) ([]pkix.Extension, error) {
+	switch policy {
+	case structs.CSRExtensionPolicyReject:
+		for _, ext := range csr.Extensions {
+			if !ext.Id.Equal(oidExtensionSubjectAltName) {
+				return nil, fmt.Errorf("CSR requests unexpected extension %s", ext.Id)
+			}
+			if len(csr.DNSNames) > 0 || len(csr.IPAddresses) > 0 || len(csr.EmailAddresses) > 0 {
+				return nil, fmt.Errorf("CSR requests subject alternative names other than a SPIFFE ID")
+			}
+		}
+		return nil, nil
+
+	case structs.CSRExtensionPolicyPassthroughAllowlisted:
+		var extensions []pkix.Extension
+		for _, ext := range csr.Extensions {
+			for _, oid := range allowlist {
+				if ext.Id.Equal(oid) {
+					extensions = append(extensions, ext)
+					break
+				}
+			}
+		}
+		return extensions, nil
+
+	default:
+		return nil, nil
+	}
+}
+
+// mergeExtensions returns extensions followed by extra, leaving out the
+// extensions which have the OID of one in extra.
+func mergeExtensions(extensions, extra []pkix.Extension) []pkix.Extension {
+	if len(extra) == 0 {
+		return extensions
+	}
+	var merged []pkix.Extension
+	for _, ext := range extensions {
+		overridden := false
+		for _, e := range extra {
+			if ext.Id.Equal(e.Id) {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			merged = append(merged, ext)
+		}
+	}
+	return append(merged, extra...)
+}
+
+// signLeafCert creates a leaf certificate for the CSR signed by caCert with
+// signer, valid between notBefore and notAfter, and returns it PEM-encoded.
+// The extensions in extraExtensions are added to the certificate as is. A nil
+// extKeyUsage allows both client and server authentication, and a zero
+// keyUsage the usages of mTLS along with data encipherment and key agreement.
+// A nil authorityKeyID is derived from the key of signer.
+func signLeafCert(
+	csr *x509.CertificateRequest,
+	caCert *x509.Certificate,
+	signer crypto.Signer,
+	serial *big.Int,
+	notBefore, notAfter time.Time,
+	extraExtensions []pkix.Extension,
+	extKeyUsage []x509.ExtKeyUsage,
+	keyUsage x509.KeyUsage,
+	authorityKeyID []byte,
+	policies []asn1.ObjectIdentifier,
+) (string, error) {
+	if extKeyUsage == nil {
+		extKeyUsage = []x509.ExtKeyUsage{
+			x509.ExtKeyUsageClientAuth,
+			x509.ExtKeyUsageServerAuth,
+		}
+	}
+	if keyUsage == 0 {
+		keyUsage = x509.KeyUsageDataEncipherment |
+			x509.KeyUsageKeyAgreement |
+			x509.KeyUsageDigitalSignature |
+			x509.KeyUsageKeyEncipherment
+	}
+
+	// Create the keyId for the cert from the signing private key, unless the
+	// signing cert was chosen by its subject key ID.
+	keyId := authorityKeyID
+	if keyId == nil {
+		var err error
+		if keyId, err = connect.KeyId(signer.Public()); err != nil {
+			return "", err
+		}
+	}
+
+	// Create the subjectKeyId for the cert from the csr public key.
+	subjectKeyID, err := connect.KeyId(csr.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serial,
+		URIs:         csr.URIs,
+		Signature:    csr.Signature,
+		// We use the correct signature algorithm for the CA key we are signing with
+		// regardless of the algorithm used to sign the CSR signature above since
+		// the leaf might use a different key type.
+		SignatureAlgorithm:    connect.SigAlgoForKey(signer),
+		PublicKeyAlgorithm:    csr.PublicKeyAlgorithm,
+		PublicKey:             csr.PublicKey,
+		BasicConstraintsValid: true,
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           extKeyUsage,
+		NotAfter:              notAfter,
+		NotBefore:             notBefore,
+		AuthorityKeyId:        keyId,
+		SubjectKeyId:          subjectKeyID,
+		DNSNames:              csr.DNSNames,
+		IPAddresses:           csr.IPAddresses,
+		ExtraExtensions:       extraExtensions,
+		PolicyIdentifiers:     policies,
+	}
+
+	// Create the certificate, PEM encode it and return that value.
+	var buf bytes.Buffer
+	bs, err := x509.CreateCertificate(
+		rand.Reader, &template, caCert, csr.PublicKey, signer)
+	if err != nil {
+		return "", fmt.Errorf("error generating certificate: %s", err)
+	}
+	err = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: bs})
+	if err != nil {
+		return "", fmt.Errorf("error encoding certificate: %s", err)
+	}
+
+	return EnsureTrailingNewline(buf.String()), nil
+}
+
+// clampLeafNotAfter returns notAfter adjusted so that a leaf certificate
+// expires CertificateTimeDriftBuffer before the certificate used to sign it,
+// so that it doesn't outlive it on servers whose clock is ahead. The returned
+// bool reports whether the value had to be clamped.
+func clampLeafNotAfter(notAfter time.Time, signingCert *x509.Certificate) (time.Time, bool) {
+	limit := signingCert.NotAfter.Add(-CertificateTimeDriftBuffer)
+	if notAfter.After(limit) {
+		return limit, true
+	}
+	return notAfter, false
+}
+
 // EnsureTrailingNewline this is used to fix a case where the provider do not return a new line after
-// the certificate as per the specification see GH-8178 for more context
+// the certificate as per the specification see GH-8178 for more context. It
+// also collapses multiple trailing newlines into one so that PEM blocks can be
+// safely concatenated. Every PEM-returning Provider method passes its result
+// through this.
 func EnsureTrailingNewline(cert string) string {
+	cert = strings.TrimRight(cert, "\r\n")
 	if cert == "" {
 		return cert
 	}
-	if strings.HasSuffix(cert, "\n") {
-		return cert
-	}
-	return fmt.Sprintf("%s\n", cert)
+	return cert + "\n"
 }
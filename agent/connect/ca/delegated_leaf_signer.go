@@ -0,0 +1,217 @@
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/hashicorp/consul/agent/connect"
+)
+
+// errSubIntermediateNotAllowed is returned by delegatedLeafSigner.Sign when the
+// upstream intermediate has a path length constraint of zero, which makes it
+// impossible to chain a sub-intermediate below it.
+var errSubIntermediateNotAllowed = errors.New("active intermediate does not allow a sub-intermediate CA")
+
+// maxDelegatedSerialNumber bounds the random serial numbers of leaves signed by
+// a delegatedLeafSigner. Unlike the built-in provider there is no replicated
+// counter to draw from, so serials are random 128 bit integers instead.
+var maxDelegatedSerialNumber = new(big.Int).Lsh(big.NewInt(1), 128)
+
+// delegatedSubIntermediateTTLFactor is how many leaf lifetimes a
+// sub-intermediate is requested for. The sub-intermediate is renewed once it
+// can no longer fit a whole leaf, so this also sets how often the upstream CA
+// is called.
+const delegatedSubIntermediateTTLFactor = 3
+
+// delegatedLeafSigner signs leaf certificates locally with a sub-intermediate
+// CA whose private key never leaves this server. The sub-intermediate is
+// signed once by an upstream CA, so only establishing or renewing it requires a
+// round trip to the upstream CA while each leaf is signed in memory.
+type delegatedLeafSigner struct {
+	logger      hclog.Logger
+	clusterID   string
+	isPrimary   bool
+	spiffeID    *connect.SpiffeIDSigning
+	leafCertTTL time.Duration
+	keyType     string
+	keyBits     int
+
+	// activeIntermediate returns the PEM-encoded upstream certificate that
+	// signs the sub-intermediate.
+	activeIntermediate func() (string, error)
+
+	// signIntermediate asks the upstream CA to sign the PEM-encoded
+	// sub-intermediate CSR for ttl and returns the PEM-encoded certificate,
+	// giving up once ctx is done.
+	signIntermediate func(ctx context.Context, csrPEM string, ttl time.Duration) (string, error)
+
+	lock     sync.Mutex
+	signer   crypto.Signer
+	cert     *x509.Certificate
+	certPEM  string
+	parent   *x509.Certificate
+	disabled error
+}
+
+// Sign signs the CSR with the sub-intermediate, establishing or renewing the
+// sub-intermediate first if needed. The returned PEM contains the leaf followed
+// by the sub-intermediate so that the chain can be built up to the upstream
+// intermediate.
+func (d *delegatedLeafSigner) Sign(ctx context.Context, csr *x509.CertificateRequest) (string, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := time.Now()
+	if err := d.ensureEstablished(ctx, now); err != nil {
+		return "", err
+	}
+
+	serial, err := rand.Int(rand.Reader, maxDelegatedSerialNumber)
+	if err != nil {
+		return "", fmt.Errorf("error generating serial number: %v", err)
+	}
+
+	// Sign the certificate valid from CertificateTimeDriftBuffer in the past,
+	// like the built-in provider does, to account for clock drift across the
+	// cluster.
+	effectiveNow := now.Add(-1 * CertificateTimeDriftBuffer)
+	notAfter, _ := clampLeafNotAfter(effectiveNow.Add(d.leafCertTTL), d.cert)
+
+	leafPEM, err := signLeafCert(csr, d.cert, d.signer, serial, effectiveNow, notAfter, nil, nil, 0, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	return leafPEM + d.certPEM, nil
+}
+
+// Warm establishes the sub-intermediate ahead of the first Sign.
+func (d *delegatedLeafSigner) Warm(ctx context.Context) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.ensureEstablished(ctx, time.Now())
+}
+
+// ensureEstablished establishes or renews the sub-intermediate if needed. It
+// must be called while holding lock.
+func (d *delegatedLeafSigner) ensureEstablished(ctx context.Context, now time.Time) error {
+	if d.disabled != nil {
+		return d.disabled
+	}
+	if !d.needsRenewal(now) {
+		return nil
+	}
+	err := d.establish(ctx, now)
+	if errors.Is(err, errSubIntermediateNotAllowed) {
+		d.logger.Warn("delegated leaf signing is not possible, leaf certificates will be signed by the CA provider",
+			"error", err,
+		)
+		d.disabled = err
+	}
+	return err
+}
+
+// Reset drops the current sub-intermediate so that the next Sign establishes a
+// new one. It must be called whenever the upstream intermediate changes.
+func (d *delegatedLeafSigner) Reset() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.signer = nil
+	d.cert = nil
+	d.certPEM = ""
+	d.parent = nil
+	d.disabled = nil
+}
+
+// needsRenewal reports whether a new sub-intermediate is needed. It is renewed
+// once it can no longer fit a whole leaf lifetime, unless the upstream
+// intermediate expires first in which case renewing would not help.
+func (d *delegatedLeafSigner) needsRenewal(now time.Time) bool {
+	if d.cert == nil || !now.Before(d.cert.NotAfter) {
+		return true
+	}
+	return now.Add(d.leafCertTTL).After(d.cert.NotAfter) && d.parent.NotAfter.After(d.cert.NotAfter)
+}
+
+func (d *delegatedLeafSigner) establish(ctx context.Context, now time.Time) error {
+	parentPEM, err := d.activeIntermediate()
+	if err != nil {
+		return err
+	}
+	if parentPEM == "" {
+		return fmt.Errorf("no active intermediate to sign the sub-intermediate CA")
+	}
+	parent, err := connect.ParseCert(parentPEM)
+	if err != nil {
+		return fmt.Errorf("error parsing active intermediate cert: %v", err)
+	}
+	if parent.MaxPathLen == 0 && parent.MaxPathLenZero {
+		return errSubIntermediateNotAllowed
+	}
+
+	signer, _, err := connect.GeneratePrivateKeyWithConfig(d.keyType, d.keyBits)
+	if err != nil {
+		return err
+	}
+	uid, err := connect.CompactUID()
+	if err != nil {
+		return err
+	}
+	subject := pkix.Name{CommonName: connect.CACN("delegated", uid, d.clusterID, d.isPrimary)}
+	csrPEM, err := connect.CreateCACSR(d.spiffeID, signer, subject)
+	if err != nil {
+		return err
+	}
+
+	ttl := delegatedSubIntermediateTTLFactor * d.leafCertTTL
+	if remaining := parent.NotAfter.Sub(now).Truncate(time.Second); remaining < ttl {
+		ttl = remaining
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("active intermediate expired at %s", parent.NotAfter)
+	}
+
+	certPEM, err := d.signIntermediate(ctx, csrPEM, ttl)
+	if err != nil {
+		return fmt.Errorf("error signing sub-intermediate CA: %w", err)
+	}
+	cert, err := connect.ParseCert(certPEM)
+	if err != nil {
+		return fmt.Errorf("error parsing sub-intermediate cert: %v", err)
+	}
+
+	// Make sure the upstream CA signed the key we generated.
+	certKeyID, err := connect.KeyId(cert.PublicKey)
+	if err != nil {
+		return err
+	}
+	signerKeyID, err := connect.KeyId(signer.Public())
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(certKeyID, signerKeyID) {
+		return fmt.Errorf("sub-intermediate cert does not match the generated private key")
+	}
+
+	d.signer = signer
+	d.cert = cert
+	d.certPEM = EnsureTrailingNewline(certPEM)
+	d.parent = parent
+
+	d.logger.Info("established sub-intermediate CA for delegated leaf signing",
+		"serial_number", connect.EncodeSerialNumber(cert.SerialNumber),
+		"not_after", cert.NotAfter,
+	)
+	return nil
+}
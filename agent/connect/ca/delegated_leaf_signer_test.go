@@ -0,0 +1,161 @@
+package ca
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/consul/agent/connect"
+)
+
+// testDelegatedLeafSigner returns a delegatedLeafSigner whose upstream CA is a
+// primary Consul provider, along with the root PEM and counters of the calls
+// made to the upstream CA.
+func testDelegatedLeafSigner(t *testing.T) (*delegatedLeafSigner, string, *int, *int) {
+	t.Helper()
+
+	conf := testConsulCAConfig()
+	delegate := newMockDelegate(t, conf)
+	provider := TestConsulProvider(t, delegate)
+	require.NoError(t, provider.Configure(testProviderConfig(conf)))
+	root, err := provider.GenerateRoot()
+	require.NoError(t, err)
+
+	var activeCalls, signCalls int
+	signer := &delegatedLeafSigner{
+		logger:      hclog.New(nil),
+		clusterID:   conf.ClusterID,
+		isPrimary:   true,
+		spiffeID:    connect.SpiffeIDSigningForCluster(conf.ClusterID),
+		leafCertTTL: time.Hour,
+		keyType:     connect.DefaultPrivateKeyType,
+		keyBits:     connect.DefaultPrivateKeyBits,
+		activeIntermediate: func() (string, error) {
+			activeCalls++
+			return provider.ActiveIntermediate()
+		},
+		signIntermediate: func(ctx context.Context, csrPEM string, _ time.Duration) (string, error) {
+			signCalls++
+			csr, err := connect.ParseCSR(csrPEM)
+			if err != nil {
+				return "", err
+			}
+			return provider.SignIntermediate(ctx, csr)
+		},
+	}
+	return signer, root.PEM, &activeCalls, &signCalls
+}
+
+func TestDelegatedLeafSigner_Sign(t *testing.T) {
+	signer, rootPEM, activeCalls, signCalls := testDelegatedLeafSigner(t)
+
+	var subIntermediate string
+	for i := 0; i < 3; i++ {
+		spiffeService := connect.TestSpiffeIDService(t, "foo")
+		csr, _ := connect.TestCSR(t, spiffeService)
+		parsed, err := connect.ParseCSR(csr)
+		require.NoError(t, err)
+
+		chain, err := signer.Sign(context.Background(), parsed)
+		require.NoError(t, err)
+		requireTrailingNewline(t, chain)
+
+		leaf, _, err := connect.ParseLeafCerts(chain)
+		require.NoError(t, err)
+		require.Equal(t, spiffeService.URI(), leaf.URIs[0])
+
+		// The sub-intermediate is reused across leaves.
+		if subIntermediate == "" {
+			subIntermediate = signer.certPEM
+		}
+		require.Equal(t, subIntermediate, signer.certPEM)
+		require.Equal(t, chain[len(chain)-len(subIntermediate):], subIntermediate)
+
+		leafOnly := chain[:len(chain)-len(subIntermediate)]
+		require.NoError(t, connect.ValidateLeaf(rootPEM, leafOnly, []string{subIntermediate}))
+		require.False(t, leaf.NotAfter.After(signer.cert.NotAfter))
+	}
+
+	// Only establishing the sub-intermediate calls the upstream CA.
+	require.Equal(t, 1, *activeCalls)
+	require.Equal(t, 1, *signCalls)
+
+	authorityKeyID, issuerKeyID, err := connect.LeafAuthorityKeyIDs(func() string {
+		csr, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "bar"))
+		parsed, err := connect.ParseCSR(csr)
+		require.NoError(t, err)
+		chain, err := signer.Sign(context.Background(), parsed)
+		require.NoError(t, err)
+		return chain
+	}())
+	require.NoError(t, err)
+	require.Equal(t, connect.EncodeSigningKeyID(signer.cert.SubjectKeyId), authorityKeyID)
+	require.Equal(t, connect.EncodeSigningKeyID(signer.parent.SubjectKeyId), issuerKeyID)
+
+	t.Run("reset establishes a new sub-intermediate", func(t *testing.T) {
+		signer.Reset()
+
+		csr, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "foo"))
+		parsed, err := connect.ParseCSR(csr)
+		require.NoError(t, err)
+		_, err = signer.Sign(context.Background(), parsed)
+		require.NoError(t, err)
+
+		require.NotEqual(t, subIntermediate, signer.certPEM)
+		require.Equal(t, 2, *activeCalls)
+		require.Equal(t, 2, *signCalls)
+	})
+}
+
+func TestDelegatedLeafSigner_Warm(t *testing.T) {
+	signer, _, _, signCalls := testDelegatedLeafSigner(t)
+
+	require.NoError(t, signer.Warm(context.Background()))
+	require.Equal(t, 1, *signCalls)
+	require.NotNil(t, signer.cert)
+
+	// The first leaf is signed with the sub-intermediate established by Warm.
+	csr, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "foo"))
+	parsed, err := connect.ParseCSR(csr)
+	require.NoError(t, err)
+	_, err = signer.Sign(context.Background(), parsed)
+	require.NoError(t, err)
+	require.Equal(t, 1, *signCalls)
+}
+
+func TestDelegatedLeafSigner_Sign_PathLenZero(t *testing.T) {
+	signer, _, activeCalls, signCalls := testDelegatedLeafSigner(t)
+
+	// An intermediate signed with a path length constraint of 0 cannot sign a
+	// sub-intermediate.
+	pathLenZero, err := signer.signIntermediate(context.Background(), func() string {
+		key, _, err := connect.GeneratePrivateKey()
+		require.NoError(t, err)
+		csr, err := connect.CreateCACSR(signer.spiffeID, key, pkix.Name{})
+		require.NoError(t, err)
+		return csr
+	}(), time.Hour)
+	require.NoError(t, err)
+	signer.activeIntermediate = func() (string, error) {
+		*activeCalls++
+		return pathLenZero, nil
+	}
+
+	csr, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "foo"))
+	parsed, err := connect.ParseCSR(csr)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = signer.Sign(context.Background(), parsed)
+		require.ErrorIs(t, err, errSubIntermediateNotAllowed)
+	}
+
+	// The result is remembered so the upstream CA is only checked once, and
+	// the only sub-intermediate signed is the one above.
+	require.Equal(t, 1, *activeCalls)
+	require.Equal(t, 1, *signCalls)
+}
@@ -3,6 +3,7 @@
 package ca
 
 import (
+	context "context"
 	x509 "crypto/x509"
 
 	mock "github.com/stretchr/testify/mock"
@@ -62,20 +63,20 @@ func (_m *MockProvider) Configure(cfg ProviderConfig) error {
 	return r0
 }
 
-// CrossSignCA provides a mock function with given fields: _a0
-func (_m *MockProvider) CrossSignCA(_a0 *x509.Certificate) (string, error) {
-	ret := _m.Called(_a0)
+// CrossSignCA provides a mock function with given fields: _a0, _a1
+func (_m *MockProvider) CrossSignCA(_a0 context.Context, _a1 *x509.Certificate) (string, error) {
+	ret := _m.Called(_a0, _a1)
 
 	var r0 string
-	if rf, ok := ret.Get(0).(func(*x509.Certificate) string); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, *x509.Certificate) string); ok {
+		r0 = rf(_a0, _a1)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*x509.Certificate) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func(context.Context, *x509.Certificate) error); ok {
+		r1 = rf(_a0, _a1)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -146,6 +147,27 @@ func (_m *MockProvider) GenerateRoot() (RootResult, error) {
 	return r0, r1
 }
 
+// KeyStorageLocation provides a mock function with given fields:
+func (_m *MockProvider) KeyStorageLocation() (KeyLocation, error) {
+	ret := _m.Called()
+
+	var r0 KeyLocation
+	if rf, ok := ret.Get(0).(func() KeyLocation); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(KeyLocation)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // SetIntermediate provides a mock function with given fields: intermediatePEM, rootPEM
 func (_m *MockProvider) SetIntermediate(intermediatePEM string, rootPEM string) error {
 	ret := _m.Called(intermediatePEM, rootPEM)
@@ -160,20 +182,20 @@ func (_m *MockProvider) SetIntermediate(intermediatePEM string, rootPEM string)
 	return r0
 }
 
-// Sign provides a mock function with given fields: _a0
-func (_m *MockProvider) Sign(_a0 *x509.CertificateRequest) (string, error) {
-	ret := _m.Called(_a0)
+// Sign provides a mock function with given fields: _a0, _a1
+func (_m *MockProvider) Sign(_a0 context.Context, _a1 *x509.CertificateRequest) (string, error) {
+	ret := _m.Called(_a0, _a1)
 
 	var r0 string
-	if rf, ok := ret.Get(0).(func(*x509.CertificateRequest) string); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, *x509.CertificateRequest) string); ok {
+		r0 = rf(_a0, _a1)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*x509.CertificateRequest) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func(context.Context, *x509.CertificateRequest) error); ok {
+		r1 = rf(_a0, _a1)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -181,20 +203,20 @@ func (_m *MockProvider) Sign(_a0 *x509.CertificateRequest) (string, error) {
 	return r0, r1
 }
 
-// SignIntermediate provides a mock function with given fields: _a0
-func (_m *MockProvider) SignIntermediate(_a0 *x509.CertificateRequest) (string, error) {
-	ret := _m.Called(_a0)
+// SignIntermediate provides a mock function with given fields: _a0, _a1
+func (_m *MockProvider) SignIntermediate(_a0 context.Context, _a1 *x509.CertificateRequest) (string, error) {
+	ret := _m.Called(_a0, _a1)
 
 	var r0 string
-	if rf, ok := ret.Get(0).(func(*x509.CertificateRequest) string); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, *x509.CertificateRequest) string); ok {
+		r0 = rf(_a0, _a1)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(*x509.CertificateRequest) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func(context.Context, *x509.CertificateRequest) error); ok {
+		r1 = rf(_a0, _a1)
 	} else {
 		r1 = ret.Error(1)
 	}
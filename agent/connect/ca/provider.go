@@ -1,8 +1,16 @@
 package ca
 
 import (
+	"context"
+	"crypto"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"errors"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
 )
 
 //go:generate mockery -name Provider -inpkg
@@ -52,6 +60,23 @@ type ProviderConfig struct {
 	State map[string]string
 }
 
+// KeyLocation is where a provider holds the private keys of the CA.
+type KeyLocation string
+
+const (
+	// KeyLocationConsulState is for keys stored in the Consul state, which
+	// are recovered by restoring a snapshot of it.
+	KeyLocationConsulState KeyLocation = "consul-state"
+
+	// KeyLocationExternal is for keys stored by an external system, such as
+	// Vault, which must be backed up on its own.
+	KeyLocationExternal KeyLocation = "external"
+
+	// KeyLocationHSM is for keys generated in a hardware security module,
+	// which can't be exported or backed up.
+	KeyLocationHSM KeyLocation = "hsm"
+)
+
 // Provider is the interface for Consul to interact with
 // an external CA that provides leaf certificate signing for
 // given SpiffeIDServices.
@@ -97,8 +122,9 @@ type Provider interface {
 	// intemediate and any cross-signed intermediates managed by Consul. Note that
 	// providers should return ErrRateLimited if they are unable to complete the
 	// operation due to upstream rate limiting so that clients can intelligently
-	// backoff.
-	Sign(*x509.CertificateRequest) (string, error)
+	// backoff. Providers calling a remote CA must give up and return the error
+	// of ctx once it is done.
+	Sign(context.Context, *x509.CertificateRequest) (string, error)
 
 	// Cleanup performs any necessary cleanup that should happen when the provider
 	// is shut down permanently, such as removing a temporary PKI backend in Vault
@@ -110,6 +136,10 @@ type Provider interface {
 	// changing then the provider should not remove that path from Vault.
 	Cleanup(providerTypeChange bool, otherConfig map[string]interface{}) error
 
+	// KeyStorageLocation returns where the private keys of the CA are held,
+	// which tells operators what must be backed up to recover the CA.
+	KeyStorageLocation() (KeyLocation, error)
+
 	// TODO: when CAManager has separate types for primary/secondary invert this
 	// relationship so that PrimaryProvider/SecondaryProvider embed Provider
 
@@ -144,8 +174,9 @@ type PrimaryProvider interface {
 	// length constraint of 0 to ensure that the certificate cannot be used to
 	// generate further CA certs. Note that providers should return ErrRateLimited
 	// if they are unable to complete the operation due to upstream rate limiting
-	// so that clients can intelligently backoff.
-	SignIntermediate(*x509.CertificateRequest) (string, error)
+	// so that clients can intelligently backoff. Like Sign, it must give up
+	// once ctx is done.
+	SignIntermediate(context.Context, *x509.CertificateRequest) (string, error)
 
 	// CrossSignCA must accept a CA certificate from another CA provider and cross
 	// sign it exactly as it is such that it forms a chain back the the
@@ -160,8 +191,8 @@ type PrimaryProvider interface {
 	// provided `SupportsCrossSigning` also returns false. Note that
 	// providers should return ErrRateLimited if they are unable to complete the
 	// operation due to upstream rate limiting so that clients can intelligently
-	// backoff.
-	CrossSignCA(*x509.Certificate) (string, error)
+	// backoff. Like Sign, it must give up once ctx is done.
+	CrossSignCA(context.Context, *x509.Certificate) (string, error)
 
 	// SupportsCrossSigning should indicate whether the CA provider supports
 	// cross-signing an external root to provide a seamless rotation. If the CA
@@ -200,6 +231,54 @@ type RootResult struct {
 	// If there is only a single certificate in the bundle then it will be used
 	// as both the primary CA and the trusted CA.
 	PEM string
+
+	// ExternalRootCert is the PEM encoded certificate of a CA outside of Consul
+	// that the primary CA chains up to, for providers that can only act as an
+	// issuing CA. When set it is published as the trusted CA and PEM must only
+	// contain the primary CA. Providers using it must implement
+	// PrimaryUsesIntermediate, since the primary CA isn't the trusted CA.
+	ExternalRootCert string
+
+	// IntermediateCerts are the PEM encoded certificates between
+	// ExternalRootCert and the primary CA, starting with the one signed by
+	// ExternalRootCert. It is only used along with ExternalRootCert.
+	IntermediateCerts []string
+}
+
+// AsyncIntermediateGenerator is an optional interface for primary providers
+// whose intermediate is signed by a CA that doesn't return the certificate
+// right away, such as an ACME server, but gives a handle to poll for it
+// instead. Consul uses it in place of PrimaryProvider.GenerateIntermediate.
+type AsyncIntermediateGenerator interface {
+	// SubmitIntermediate generates a CSR for a new intermediate, submits it
+	// for signing and returns a handle to poll for the signed certificate.
+	SubmitIntermediate() (handle string, err error)
+
+	// PollIntermediate returns whether the intermediate submitted with handle
+	// is signed yet. Once done, cert is the PEM-encoded intermediate, which
+	// the provider uses to sign leaf certificates from then on.
+	PollIntermediate(handle string) (cert string, done bool, err error)
+}
+
+// VersionedProvider is an optional interface for providers to declare the
+// version of the configuration and state they expect. Consul records the
+// version of the provider that last wrote the CA configuration and state, and
+// refuses to configure a provider of an older version with it, since an older
+// provider may not understand, or may even damage, the state of a newer one,
+// such as after a downgrade. The version is only to be incremented by changes
+// older versions can't handle. Providers that don't implement it have version
+// 0.
+type VersionedProvider interface {
+	ProviderVersion() int
+}
+
+// ConnectionTester is an optional interface for providers backed by an
+// external CA, to check that a candidate configuration lets them reach and use
+// it before it is applied. It is used to validate a configuration in place of
+// Configure, so it must not change anything in the external CA, such as
+// creating or tuning mounts.
+type ConnectionTester interface {
+	TestConnection(cfg ProviderConfig) error
 }
 
 // NeedsStop is an optional interface that allows a CA to define a function
@@ -209,3 +288,218 @@ type RootResult struct {
 type NeedsStop interface {
 	Stop()
 }
+
+// Warmer is an optional interface for providers that pay a setup cost, such
+// as connecting and authenticating to their backing CA, on the first leaf
+// certificate they sign. Consul calls Warm once the provider is initialized
+// so that the first signing request after a leader election doesn't pay it.
+// Providers that don't implement it, like the built-in one, need no warming.
+type Warmer interface {
+	// Warm does the setup needed to sign leaf certificates quickly. It
+	// should give up once ctx is done. Failing to warm doesn't prevent the
+	// provider from being used, signing is then expected to do the setup.
+	Warm(ctx context.Context) error
+}
+
+// SigningKeyVerifier is an optional interface for providers that can check
+// that they hold the private key of their active intermediate without issuing
+// a certificate. It lets the leader check that a provider can sign before
+// accepting signing requests, without adding a leaf to the records of the CA.
+type SigningKeyVerifier interface {
+	// VerifySigningKey returns an error if the private key the provider
+	// signs leaf certificates with doesn't match its active intermediate.
+	VerifySigningKey(ctx context.Context) error
+}
+
+// CSRValidator is an optional interface for providers that reject some leaf
+// CSRs when signing them. ValidateCSR must return the error Sign would return
+// for the CSR because of its content, without signing it.
+type CSRValidator interface {
+	ValidateCSR(csr *x509.CertificateRequest) error
+}
+
+// RootReplacer is an optional interface for primary providers that can
+// replace their root with a new one backed by a newly generated key, without a
+// configuration change. It is used for emergency root rotations, when the key
+// of the active root must stop being used at once.
+type RootReplacer interface {
+	// ReplaceRoot discards the current root and its key and returns a new
+	// root. Once it returns, the provider signs with the new root only.
+	ReplaceRoot() (RootResult, error)
+}
+
+// TTLLimiter is an optional interface for providers whose backing CA caps the
+// lifetime of the certificates it issues. The CA configuration is validated
+// against these limits so that certificates aren't silently issued for less
+// than the configured TTLs.
+type TTLLimiter interface {
+	// TTLLimits returns the maximum TTL of intermediate and leaf certificates
+	// the provider can issue. A zero duration means there is no limit.
+	TTLLimits() (maxIntermediate, maxLeaf time.Duration, err error)
+}
+
+// UsageReporter is an optional interface for providers whose backing CA
+// bills per issued certificate or caps how many it issues, such as AWS PCA.
+// Consul reports the usage as metrics so that operators see a quota coming.
+type UsageReporter interface {
+	// Usage returns the number of certificates issued in the current billing
+	// period and the quota for the period, zero if there is none. It returns
+	// ErrUsageNotSupported when the provider can't report its usage.
+	Usage() (issued int64, quota int64, err error)
+}
+
+// ErrUsageNotSupported is returned by UsageReporter.Usage, and for providers
+// not implementing UsageReporter, when the provider has no usage to report.
+var ErrUsageNotSupported = errors.New("CA provider does not report its usage")
+
+// AttestationVerifier is an optional interface for providers that can verify
+// an attestation that the key of a leaf CSR is held by hardware, such as a
+// TPM. Leaf CSRs sent with an attestation are only signed by providers
+// implementing it.
+type AttestationVerifier interface {
+	// VerifyAttestation returns an error unless attestation proves that the
+	// private key of csr is held by trusted hardware.
+	VerifyAttestation(csr *x509.CertificateRequest, attestation []byte) error
+}
+
+// RootLeafSigner is an optional interface for providers that use an
+// intermediate to sign leaf certificates but can also sign them with the root.
+// It is only used as a last resort, when the CA configuration sets
+// RootSigningFallback and the intermediate expired because it could not be
+// renewed.
+type RootLeafSigner interface {
+	// SignLeafWithRoot signs a leaf certificate for csr with the root
+	// certificate and returns it PEM-encoded. It applies params as far as
+	// the provider can and gives up once ctx is done. The certificate must
+	// be no longer-lived nor less restricted than one Sign would issue, and
+	// must not outlive the root.
+	SignLeafWithRoot(ctx context.Context, csr *x509.CertificateRequest, params LeafSignParams) (string, error)
+}
+
+// TemplateSigner is an optional interface for providers that can sign a leaf
+// certificate for a public key without a CSR made with its private key. This
+// lets clients that can't build CSRs send only their public key.
+type TemplateSigner interface {
+	// SignTemplate is like ParamsSigner.SignWithParams but the template was
+	// built by Consul rather than parsed from a CSR. Only its PublicKey,
+	// PublicKeyAlgorithm and URIs are set, and it has no Raw encoding or
+	// signature to pass on to an external CA.
+	SignTemplate(template *x509.CertificateRequest, params LeafSignParams) (string, error)
+}
+
+// LeafSignParams are the parameters of a leaf certificate chosen by Consul
+// rather than by the CSR, for providers implementing ParamsSigner.
+type LeafSignParams struct {
+	// Extensions are added to the certificate, such as the location it was
+	// issued in, in place of any extension with the same OID requested by
+	// the CSR.
+	Extensions []pkix.Extension
+
+	// LatestNotBefore, when set, is the latest time the certificate may be
+	// valid from, so that it overlaps with the previous certificate of the
+	// same identity.
+	LatestNotBefore time.Time
+
+	// TTL, when set, replaces the configured LeafCertTTL.
+	TTL time.Duration
+
+	// MaxTTL, when set, caps the validity of the certificate below the
+	// configured LeafCertTTL, or TTL when set.
+	MaxTTL time.Duration
+
+	// ExtKeyUsage, when set, replaces the extended key usages of the
+	// certificate, which are otherwise client and server authentication.
+	ExtKeyUsage []x509.ExtKeyUsage
+
+	// PolicyIdentifiers are the certificate policies of the certificate.
+	PolicyIdentifiers []asn1.ObjectIdentifier
+
+	// KeyUsage, when set, replaces the key usages of the certificate.
+	KeyUsage x509.KeyUsage
+
+	// AuthorityKeyID, when set, is the subject key ID of the certificate
+	// Consul selected to sign the leaf certificate, which becomes its
+	// authority key ID so that verifiers build the path through it even when
+	// several certificates share the signing key. Providers refuse to sign
+	// with any other certificate, as does Consul with the leaf certificates
+	// of providers that don't implement ParamsSigner.
+	AuthorityKeyID []byte
+}
+
+// ParamsSigner is an optional interface for providers that can sign leaf
+// certificates with parameters chosen by Consul.
+type ParamsSigner interface {
+	// SignWithParams is like Sign but applies params.
+	SignWithParams(csr *x509.CertificateRequest, params LeafSignParams) (string, error)
+}
+
+// OptionsSigner is an optional interface for providers that accept options
+// specific to their backing CA when signing leaf certificates, such as the
+// certificate template to issue with. Consul passes the options through
+// without interpreting them.
+type OptionsSigner interface {
+	// SignOptions returns the keys of the options SignWithOptions accepts.
+	// Requests with any other option are refused before reaching the
+	// provider.
+	SignOptions() []string
+
+	// SignWithOptions is like Sign but applies options, whose keys are all
+	// among SignOptions.
+	SignWithOptions(ctx context.Context, csr *x509.CertificateRequest, options map[string]string) (string, error)
+}
+
+// RevocationSigner is an optional interface for providers that can sign CRLs
+// and OCSP responses for the leaf certificates they issued.
+type RevocationSigner interface {
+	// SignCRL returns a PEM-encoded CRL listing revoked.
+	SignCRL(revoked []pkix.RevokedCertificate, thisUpdate, nextUpdate time.Time) (string, error)
+
+	// SignOCSPResponse returns a DER-encoded OCSP response with the
+	// SerialNumber, Status, RevokedAt, RevocationReason, ThisUpdate and
+	// NextUpdate of template.
+	SignOCSPResponse(template ocsp.Response) ([]byte, error)
+}
+
+// ProviderDeps holds optional dependencies of the providers. The zero value
+// keeps the defaults of each provider.
+type ProviderDeps struct {
+	// HTTPClient returns the HTTP client a provider uses for its calls to the
+	// backing CA. It is called every time a provider is configured, so that
+	// providers can modify the client they get. It allows setting up proxies,
+	// custom root CAs or timeouts. When set, the TLS settings in the
+	// configuration of the provider are ignored and the client is expected to
+	// handle TLS itself.
+	HTTPClient func() *http.Client
+
+	// Clock returns the current time used for the validity of the
+	// certificates the built-in provider issues. It defaults to time.Now and
+	// is only meant for tests which need deterministic certificates.
+	Clock func() time.Time
+
+	// SerialNumber returns the serial number of the next certificate the
+	// built-in provider issues, in place of its replicated counter. It is
+	// only meant for tests which need deterministic certificates.
+	SerialNumber func() (uint64, error)
+
+	// PrivateKey returns a private key of the given type and size, and its
+	// PEM encoding, for the CAs the built-in provider creates. It defaults to
+	// connect.GeneratePrivateKeyWithConfig and is only meant for tests which
+	// can't afford generating keys every time, see TestFastKeys.
+	PrivateKey func(keyType string, keyBits int) (crypto.Signer, string, error)
+}
+
+// SSHSigner is an optional interface for providers that can also act as an
+// SSH certificate authority.
+type SSHSigner interface {
+	// SignSSH signs the SSH public key, in authorized_keys format, into a
+	// certificate of the given type (structs.SSHCertTypeHost or
+	// structs.SSHCertTypeUser) valid for the principals. A zero ttl uses the
+	// default of the provider. It returns the certificate in authorized_keys
+	// format, or ErrSSHNotEnabled when the provider isn't configured to sign
+	// SSH certificates.
+	SignSSH(certType, publicKey string, principals []string, ttl time.Duration) (string, error)
+}
+
+// ErrSSHNotEnabled is returned by SSHSigner.SignSSH when the provider isn't
+// configured to sign SSH certificates.
+var ErrSSHNotEnabled = errors.New("the CA provider is not configured to sign SSH certificates")
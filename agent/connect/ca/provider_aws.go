@@ -2,22 +2,27 @@ package ca
 
 import (
 	"bytes"
+	"context"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/acmpca"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
 
 	"github.com/hashicorp/go-hclog"
-	"github.com/mitchellh/mapstructure"
 
 	"github.com/hashicorp/consul/agent/connect"
 	"github.com/hashicorp/consul/agent/structs"
+	"github.com/hashicorp/consul/lib/stringslice"
 )
 
 const (
@@ -49,10 +54,24 @@ const (
 	// CA we created if any.
 	AWSStateCAARNKey = "CA_ARN"
 
+	// AWSProviderVersion is the version of the configuration and state the
+	// aws provider expects, see VersionedProvider.
+	AWSProviderVersion = 1
+
 	// day is a more readable shorthand for a duration of 24 hours. Note time
 	// package doesn't provide time.Day due to ambiguity around DST and leap
 	// seconds where a day may not actually be 24 hours.
 	day = 24 * time.Hour
+
+	// AWSSignOptionTemplateARN is the sign option overriding the template
+	// leaf certificates are issued with, to add extensions through a custom
+	// template.
+	AWSSignOptionTemplateARN = "TemplateArn"
+
+	// AWSSignOptionIdempotencyToken is the sign option setting the
+	// idempotency token of the PCA IssueCertificate request, so that retries
+	// of the same request don't issue several certificates.
+	AWSSignOptionIdempotencyToken = "IdempotencyToken"
 )
 
 // AWSProvider implements Provider for AWS ACM PCA
@@ -63,6 +82,7 @@ type AWSProvider struct {
 	config          *structs.AWSCAProviderConfig
 	session         *session.Session
 	client          *acmpca.ACMPCA
+	cloudwatch      *cloudwatch.CloudWatch
 	isPrimary       bool
 	datacenter      string
 	clusterID       string
@@ -72,11 +92,18 @@ type AWSProvider struct {
 	rootPEM         string
 	intermediatePEM string
 	logger          hclog.Logger
+	deps            ProviderDeps
 }
 
 // NewAWSProvider returns a new AWSProvider
 func NewAWSProvider(logger hclog.Logger) *AWSProvider {
-	return &AWSProvider{logger: logger}
+	return NewAWSProviderWithDeps(logger, ProviderDeps{})
+}
+
+// NewAWSProviderWithDeps returns a new AWSProvider that uses the given
+// dependencies.
+func NewAWSProviderWithDeps(logger hclog.Logger, deps ProviderDeps) *AWSProvider {
+	return &AWSProvider{logger: logger, deps: deps}
 }
 
 // Configure implements Provider
@@ -93,12 +120,31 @@ func (a *AWSProvider) Configure(cfg ProviderConfig) error {
 	// another place or sending them via API call and persisting them in state
 	// store in a new place on disk. One of the existing standard solutions seems
 	// better in all cases.
-	awsSession, err := session.NewSessionWithOptions(session.Options{
+	opts := session.Options{
 		SharedConfigState: session.SharedConfigEnable,
-	})
+	}
+	if a.deps.HTTPClient != nil {
+		opts.Config.HTTPClient = a.deps.HTTPClient()
+	}
+	if config.Region != "" {
+		opts.Config.Region = aws.String(config.Region)
+	}
+	awsSession, err := session.NewSessionWithOptions(opts)
 	if err != nil {
 		return err
 	}
+	if config.AssumeRoleARN != "" {
+		// The role is assumed with the credentials found as above.
+		creds := stscreds.NewCredentials(awsSession, config.AssumeRoleARN, func(p *stscreds.AssumeRoleProvider) {
+			if config.AssumeRoleExternalID != "" {
+				p.ExternalID = aws.String(config.AssumeRoleExternalID)
+			}
+			if config.AssumeRoleSessionName != "" {
+				p.RoleSessionName = config.AssumeRoleSessionName
+			}
+		})
+		awsSession = awsSession.Copy(&aws.Config{Credentials: creds})
+	}
 
 	a.config = config
 	a.session = awsSession
@@ -106,6 +152,7 @@ func (a *AWSProvider) Configure(cfg ProviderConfig) error {
 	a.clusterID = cfg.ClusterID
 	a.datacenter = cfg.Datacenter
 	a.client = acmpca.New(awsSession)
+	a.cloudwatch = cloudwatch.New(awsSession)
 	a.stopCh = make(chan struct{})
 
 	// Load the ARN from config or previous state.
@@ -167,7 +214,7 @@ func (a *AWSProvider) ensureCA() error {
 		}
 		output, err := a.client.DescribeCertificateAuthority(input)
 		if err != nil {
-			return err
+			return awsThrottleError(err)
 		}
 		// Allow it to be active or pending a certificate (leadership might have
 		// changed during a secondary initialization for example).
@@ -215,7 +262,7 @@ func (a *AWSProvider) ensureCA() error {
 	}
 
 	// Self-sign it as a root
-	certPEM, err := a.signCSR(csrPEM, RootTemplateARN, a.config.RootCertTTL)
+	certPEM, err := a.signCSR(context.Background(), csrPEM, RootTemplateARN, a.config.RootCertTTL, nil)
 	if err != nil {
 		return err
 	}
@@ -229,7 +276,7 @@ func (a *AWSProvider) ensureCA() error {
 	a.logger.Debug("uploading certificate for ARN", "arn", a.arn)
 	_, err = a.client.ImportCertificateAuthorityCertificate(&input)
 	if err != nil {
-		return err
+		return awsThrottleError(err)
 	}
 
 	a.rootPEM = certPEM
@@ -305,7 +352,7 @@ func (a *AWSProvider) createPCA() error {
 	createOutput, err := a.client.CreateCertificateAuthority(&createInput)
 	if err != nil {
 		a.logger.Error("failed to create new PCA", "common_name", commonName, "error", err)
-		return err
+		return awsThrottleError(err)
 	}
 
 	// wait for PCA to be created
@@ -313,12 +360,13 @@ func (a *AWSProvider) createPCA() error {
 	describeInput := acmpca.DescribeCertificateAuthorityInput{
 		CertificateAuthorityArn: aws.String(newARN),
 	}
-	_, err = a.pollLoop("Private CA", AWSCreateTimeout, func() (bool, string, error) {
+	_, err = a.pollLoop(context.Background(), "Private CA", AWSCreateTimeout, func() (bool, string, error) {
 		describeOutput, err := a.client.DescribeCertificateAuthority(&describeInput)
+		if awsPending(err) || request.IsErrorThrottle(err) {
+			return false, "", nil
+		}
 		if err != nil {
-			if err.(awserr.Error).Code() != acmpca.ErrCodeRequestInProgressException {
-				return true, "", fmt.Errorf("error waiting for PCA to be created: %s", err)
-			}
+			return true, "", fmt.Errorf("error waiting for PCA to be created: %s", err)
 		}
 		if *describeOutput.CertificateAuthority.Status == acmpca.CertificateAuthorityStatusPendingCertificate {
 			a.logger.Debug("new PCA is ready to accept a certificate", "pca", newARN)
@@ -341,7 +389,7 @@ func (a *AWSProvider) getCACSR() (string, error) {
 	a.logger.Debug("retrieving CSR for PCA", "pca", a.arn)
 	output, err := a.client.GetCertificateAuthorityCsr(input)
 	if err != nil {
-		return "", err
+		return "", awsThrottleError(err)
 	}
 
 	csrPEM := output.Csr
@@ -349,7 +397,7 @@ func (a *AWSProvider) getCACSR() (string, error) {
 		// Probably shouldn't be able to happen but being defensive.
 		return "", fmt.Errorf("invalid response from AWS PCA: CSR is nil")
 	}
-	return *csrPEM, nil
+	return EnsureTrailingNewline(*csrPEM), nil
 }
 
 func (a *AWSProvider) loadCACerts() error {
@@ -358,7 +406,7 @@ func (a *AWSProvider) loadCACerts() error {
 	}
 	output, err := a.client.GetCertificateAuthorityCertificate(input)
 	if err != nil {
-		return err
+		return awsThrottleError(err)
 	}
 
 	if a.isPrimary {
@@ -376,14 +424,14 @@ func (a *AWSProvider) loadCACerts() error {
 	return nil
 }
 
-func (a *AWSProvider) signCSRRaw(csr *x509.CertificateRequest, templateARN string, ttl time.Duration) (string, error) {
+func (a *AWSProvider) signCSRRaw(ctx context.Context, csr *x509.CertificateRequest, templateARN string, ttl time.Duration, options map[string]string) (string, error) {
 	// PEM encode the CSR
 	var pemBuf bytes.Buffer
 	if err := pem.Encode(&pemBuf, &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw}); err != nil {
 		return "", err
 	}
 
-	return a.signCSR(pemBuf.String(), templateARN, ttl)
+	return a.signCSR(ctx, pemBuf.String(), templateARN, ttl, options)
 }
 
 // pollWait returns how long to wait for the next poll of an async operation. We
@@ -408,7 +456,9 @@ func pollWait(attemptsMade int) time.Duration {
 	return waits[attemptsMade]
 }
 
-func (a *AWSProvider) pollLoop(desc string, timeout time.Duration, f func() (bool, string, error)) (string, error) {
+// pollLoop calls f until it is done, waiting longer between each call, and
+// gives up after timeout or once ctx is done.
+func (a *AWSProvider) pollLoop(ctx context.Context, desc string, timeout time.Duration, f func() (bool, string, error)) (string, error) {
 	attemptsMade := 0
 	start := time.Now()
 	wait := pollWait(attemptsMade)
@@ -426,6 +476,8 @@ func (a *AWSProvider) pollLoop(desc string, timeout time.Duration, f func() (boo
 			// Provider discarded
 			a.logger.Warn(fmt.Sprintf("provider instance terminated while waiting for %s.", desc))
 			return "", fmt.Errorf("provider terminated")
+		case <-ctx.Done():
+			return "", ctx.Err()
 		case <-time.After(wait):
 			// Continue looping...
 		}
@@ -443,7 +495,7 @@ func (a *AWSProvider) pollLoop(desc string, timeout time.Duration, f func() (boo
 	}
 }
 
-func (a *AWSProvider) signCSR(csrPEM string, templateARN string, ttl time.Duration) (string, error) {
+func (a *AWSProvider) signCSR(ctx context.Context, csrPEM string, templateARN string, ttl time.Duration, options map[string]string) (string, error) {
 	_, signAlg, err := keyTypeToAlgos(a.config.PrivateKeyType, a.config.PrivateKeyBits)
 	if err != nil {
 		return "", err
@@ -459,33 +511,35 @@ func (a *AWSProvider) signCSR(csrPEM string, templateARN string, ttl time.Durati
 			Type:  aws.String(acmpca.ValidityPeriodTypeDays),
 		},
 	}
-
-	issueOutput, err := a.client.IssueCertificate(&issueInput)
-	// ErrCodeLimitExceededException is used for both hard and soft limits in AWS
-	// SDK :(. In this specific context though (issuing a certificate) there is no
-	// hard limit on number of certs so a limit exceeded here is a rate limit.
-	if aerr, ok := err.(awserr.Error); ok && err != nil {
-		if aerr.Code() == acmpca.ErrCodeLimitExceededException {
-			return "", ErrRateLimited
-		}
+	if err := applyAWSSignOptions(&issueInput, options, a.config.AllowedTemplateARNs); err != nil {
+		return "", err
 	}
+
+	certARN, err := a.issueCertificate(ctx, &issueInput)
 	if err != nil {
-		return "", fmt.Errorf("error issuing certificate from PCA: %s", err)
+		return "", err
 	}
 
 	// wait for certificate to be created
 	certInput := acmpca.GetCertificateInput{
 		CertificateAuthorityArn: aws.String(a.arn),
-		CertificateArn:          issueOutput.CertificateArn,
+		CertificateArn:          aws.String(certARN),
 	}
-	return a.pollLoop(fmt.Sprintf("certificate %s", *issueOutput.CertificateArn),
+	return a.pollLoop(ctx, fmt.Sprintf("certificate %s", certARN),
 		AWSSignTimeout,
 		func() (bool, string, error) {
-			certOutput, err := a.client.GetCertificate(&certInput)
+			certOutput, err := a.client.GetCertificateWithContext(ctx, &certInput)
+			if err != nil && ctx.Err() != nil {
+				return true, "", ctx.Err()
+			}
+			// The certificate may not be found at first, as PCA is eventually
+			// consistent, and throttled reads are retried with the next poll.
+			if awsPending(err) || awsErrorCode(err) == acmpca.ErrCodeResourceNotFoundException ||
+				request.IsErrorThrottle(err) {
+				return false, "", nil
+			}
 			if err != nil {
-				if err.(awserr.Error).Code() != acmpca.ErrCodeRequestInProgressException {
-					return true, "", fmt.Errorf("error retrieving certificate from PCA: %s", err)
-				}
+				return true, "", fmt.Errorf("error retrieving certificate from PCA: %s", err)
 			}
 
 			if certOutput.Certificate != nil {
@@ -496,6 +550,39 @@ func (a *AWSProvider) signCSR(csrPEM string, templateARN string, ttl time.Durati
 		})
 }
 
+// issueCertificate submits the certificate request to PCA and returns the ARN
+// of the certificate. A PCA which was just created or given its certificate
+// may not accept requests yet, as PCA is eventually consistent, so they are
+// retried until AWSSignTimeout. It returns ErrRateLimited when PCA throttles
+// the request. It gives up once ctx is done.
+func (a *AWSProvider) issueCertificate(ctx context.Context, input *acmpca.IssueCertificateInput) (string, error) {
+	issue := func() (bool, string, error) {
+		output, err := a.client.IssueCertificateWithContext(ctx, input)
+		if err != nil && ctx.Err() != nil {
+			return true, "", ctx.Err()
+		}
+		// ErrCodeLimitExceededException is used for both hard and soft limits in AWS
+		// SDK :(. In this specific context though (issuing a certificate) there is no
+		// hard limit on number of certs so a limit exceeded here is a rate limit.
+		if awsErrorCode(err) == acmpca.ErrCodeLimitExceededException || request.IsErrorThrottle(err) {
+			return true, "", ErrRateLimited
+		}
+		if awsErrorCode(err) == acmpca.ErrCodeInvalidStateException {
+			return false, "", nil
+		}
+		if err != nil {
+			return true, "", fmt.Errorf("error issuing certificate from PCA: %s", err)
+		}
+		return true, aws.StringValue(output.CertificateArn), nil
+	}
+
+	// Only poll once the first attempt found the PCA not ready.
+	if done, arn, err := issue(); done {
+		return arn, err
+	}
+	return a.pollLoop(ctx, fmt.Sprintf("PCA %s to issue certificates", a.arn), AWSSignTimeout, issue)
+}
+
 // GenerateIntermediateCSR implements Provider
 func (a *AWSProvider) GenerateIntermediateCSR() (string, error) {
 	if a.isPrimary {
@@ -528,7 +615,7 @@ func (a *AWSProvider) SetIntermediate(intermediatePEM string, rootPEM string) er
 	a.logger.Debug("uploading certificate for PCA", "pca", a.arn)
 	_, err = a.client.ImportCertificateAuthorityCertificate(&input)
 	if err != nil {
-		return err
+		return awsThrottleError(err)
 	}
 
 	// We successfully initialized, keep track of the root and intermediate certs.
@@ -581,7 +668,7 @@ func (a *AWSProvider) GenerateIntermediate() (string, error) {
 }
 
 // Sign implements Provider
-func (a *AWSProvider) Sign(csr *x509.CertificateRequest) (string, error) {
+func (a *AWSProvider) Sign(ctx context.Context, csr *x509.CertificateRequest) (string, error) {
 	connect.HackSANExtensionForCSR(csr)
 
 	if a.rootPEM == "" {
@@ -592,22 +679,72 @@ func (a *AWSProvider) Sign(csr *x509.CertificateRequest) (string, error) {
 		"requester", csr.Subject.CommonName,
 	)
 
-	return a.signCSRRaw(csr, LeafTemplateARN, a.config.LeafCertTTL)
+	return a.signCSRRaw(ctx, csr, LeafTemplateARN, a.config.LeafCertTTL, nil)
+}
+
+// SignOptions implements OptionsSigner
+func (a *AWSProvider) SignOptions() []string {
+	return []string{AWSSignOptionTemplateARN, AWSSignOptionIdempotencyToken}
+}
+
+// SignWithOptions implements OptionsSigner
+func (a *AWSProvider) SignWithOptions(ctx context.Context, csr *x509.CertificateRequest, options map[string]string) (string, error) {
+	connect.HackSANExtensionForCSR(csr)
+
+	if a.rootPEM == "" {
+		return "", fmt.Errorf("AWS CA provider not fully Initialized")
+	}
+
+	a.logger.Debug("signing csr for requester with options",
+		"requester", csr.Subject.CommonName,
+	)
+
+	return a.signCSRRaw(ctx, csr, LeafTemplateARN, a.config.LeafCertTTL, options)
+}
+
+// isAWSCATemplateARN returns whether the template of templateARN issues CA
+// certificates, such as RootCACertificate/V1 or
+// SubordinateCACertificate_PathLen0/V1.
+func isAWSCATemplateARN(templateARN string) bool {
+	return strings.Contains(templateARN, "CACertificate")
+}
+
+// applyAWSSignOptions sets the fields of input for the sign options of a
+// request, refusing options that aren't among SignOptions and templates that
+// aren't among allowedTemplates.
+func applyAWSSignOptions(input *acmpca.IssueCertificateInput, options map[string]string, allowedTemplates []string) error {
+	for key, value := range options {
+		switch key {
+		case AWSSignOptionTemplateARN:
+			if !strings.HasPrefix(value, "arn:") {
+				return fmt.Errorf("sign option %s must be an ARN, got %q", key, value)
+			}
+			if isAWSCATemplateARN(value) || !stringslice.Contains(allowedTemplates, value) {
+				return fmt.Errorf("sign option %s %q isn't among the AllowedTemplateARNs of the CA configuration", key, value)
+			}
+			input.TemplateArn = aws.String(value)
+		case AWSSignOptionIdempotencyToken:
+			input.IdempotencyToken = aws.String(value)
+		default:
+			return fmt.Errorf("unknown sign option %q for the AWS CA provider", key)
+		}
+	}
+	return nil
 }
 
 // SignIntermediate implements Provider
-func (a *AWSProvider) SignIntermediate(csr *x509.CertificateRequest) (string, error) {
+func (a *AWSProvider) SignIntermediate(ctx context.Context, csr *x509.CertificateRequest) (string, error) {
 	err := validateSignIntermediate(csr, connect.SpiffeIDSigningForCluster(a.clusterID))
 	if err != nil {
 		return "", err
 	}
 
 	// Sign it!
-	return a.signCSRRaw(csr, IntermediateTemplateARN, AWSIntermediateTTL)
+	return a.signCSRRaw(ctx, csr, IntermediateTemplateARN, AWSIntermediateTTL, nil)
 }
 
 // CrossSignCA implements Provider
-func (a *AWSProvider) CrossSignCA(newCA *x509.Certificate) (string, error) {
+func (a *AWSProvider) CrossSignCA(_ context.Context, newCA *x509.Certificate) (string, error) {
 	return "", fmt.Errorf("not implemented in AWS PCA provider")
 }
 
@@ -683,38 +820,78 @@ func (a *AWSProvider) Cleanup(providerTypeChange bool, otherConfig map[string]in
 	return nil
 }
 
-// SupportsCrossSigning implements Provider
+// KeyStorageLocation implements Provider. ACM Private CA generates the keys of
+// its CAs in HSMs they can't be exported from.
+func (a *AWSProvider) KeyStorageLocation() (KeyLocation, error) {
+	return KeyLocationHSM, nil
+}
+
+// ProviderVersion implements VersionedProvider.
+func (a *AWSProvider) ProviderVersion() int {
+	return AWSProviderVersion
+}
+
+// SupportsCrossSigning implements Provider. PCA only signs certificate
+// requests, which can't be made for the key of another CA without it, so it
+// can't cross-sign.
 func (a *AWSProvider) SupportsCrossSigning() (bool, error) {
 	return false, nil
 }
 
+// Usage implements UsageReporter. The number of certificates issued since the
+// start of the month is the sum of the Success metric PCA publishes to
+// CloudWatch for the CA, and the quota is the configured
+// MonthlyIssuanceQuota. Usage is only reported once a quota is configured, so
+// that CloudWatch isn't queried by servers without the permission to.
+func (a *AWSProvider) Usage() (int64, int64, error) {
+	if a.config.MonthlyIssuanceQuota == 0 {
+		return 0, 0, ErrUsageNotSupported
+	}
+	if a.arn == "" {
+		return 0, 0, fmt.Errorf("AWS CA provider has no PCA yet")
+	}
+
+	now := time.Now().UTC()
+	input := &cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/ACMPrivateCA"),
+		MetricName: aws.String("Success"),
+		Dimensions: []*cloudwatch.Dimension{{
+			Name:  aws.String("PrivateCAArn"),
+			Value: aws.String(a.arn),
+		}},
+		StartTime:  aws.Time(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)),
+		EndTime:    aws.Time(now),
+		Period:     aws.Int64(int64((24 * time.Hour).Seconds())),
+		Statistics: []*string{aws.String(cloudwatch.StatisticSum)},
+	}
+	output, err := a.cloudwatch.GetMetricStatistics(input)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error getting PCA usage from CloudWatch: %w", err)
+	}
+
+	var issued int64
+	for _, dp := range output.Datapoints {
+		issued += int64(aws.Float64Value(dp.Sum))
+	}
+	return issued, a.config.MonthlyIssuanceQuota, nil
+}
+
 // ParseAWSCAConfig parses and validates AWS CA Provider configuration.
 func ParseAWSCAConfig(raw map[string]interface{}) (*structs.AWSCAProviderConfig, error) {
 	config := structs.AWSCAProviderConfig{
 		CommonCAProviderConfig: defaultCommonConfig(),
 	}
 
-	decodeConf := &mapstructure.DecoderConfig{
-		DecodeHook:       structs.ParseDurationFunc(),
-		Result:           &config,
-		WeaklyTypedInput: true,
-	}
-
-	decoder, err := mapstructure.NewDecoder(decodeConf)
-	if err != nil {
+	if err := decodeConfigStrict(raw, &config, structs.ParseDurationFunc()); err != nil {
 		return nil, err
 	}
 
-	if err := decoder.Decode(raw); err != nil {
-		return nil, fmt.Errorf("error decoding config: %s", err)
-	}
-
 	if err := config.CommonCAProviderConfig.Validate(); err != nil {
 		return nil, err
 	}
 
 	// Extra keytype validation since PCA is more limited than other providers
-	_, _, err = keyTypeToAlgos(config.PrivateKeyType, config.PrivateKeyBits)
+	_, _, err := keyTypeToAlgos(config.PrivateKeyType, config.PrivateKeyBits)
 	if err != nil {
 		return nil, err
 	}
@@ -724,5 +901,47 @@ func ParseAWSCAConfig(raw map[string]interface{}) (*structs.AWSCAProviderConfig,
 			" for less than 24 hours, LeafTTL of %s configured", config.LeafCertTTL)
 	}
 
+	if config.MonthlyIssuanceQuota < 0 {
+		return nil, fmt.Errorf("MonthlyIssuanceQuota must not be negative")
+	}
+
+	for _, templateARN := range config.AllowedTemplateARNs {
+		if !strings.HasPrefix(templateARN, "arn:") {
+			return nil, fmt.Errorf("AllowedTemplateARNs must only hold ARNs, got %q", templateARN)
+		}
+		if isAWSCATemplateARN(templateARN) {
+			return nil, fmt.Errorf("AllowedTemplateARNs must not hold templates issuing CA certificates, got %q", templateARN)
+		}
+	}
+
+	if config.AssumeRoleARN == "" && (config.AssumeRoleExternalID != "" || config.AssumeRoleSessionName != "") {
+		return nil, fmt.Errorf("AssumeRoleExternalID and AssumeRoleSessionName require AssumeRoleARN")
+	}
+
 	return &config, nil
 }
+
+// awsErrorCode returns the code of the AWS error err, or an empty string if
+// it isn't one.
+func awsErrorCode(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code()
+	}
+	return ""
+}
+
+// awsPending returns whether err is PCA still processing a previous request
+// for the resource.
+func awsPending(err error) bool {
+	return awsErrorCode(err) == acmpca.ErrCodeRequestInProgressException
+}
+
+// awsThrottleError returns an error wrapping ErrRateLimited when err is AWS
+// throttling the request, so that callers back off rather than give up, and
+// err otherwise. The AWS SDK already retried the request by then.
+func awsThrottleError(err error) error {
+	if request.IsErrorThrottle(err) {
+		return fmt.Errorf("%w: %v", ErrRateLimited, err)
+	}
+	return err
+}
@@ -1,13 +1,19 @@
 package ca
 
 import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/acmpca"
 	"github.com/stretchr/testify/require"
 
@@ -38,6 +44,9 @@ func TestAWSBootstrapAndSignPrimary(t *testing.T) {
 	for _, tc := range KeyTestCases {
 		tc := tc
 		t.Run(tc.Desc, func(t *testing.T) {
+			if tc.KeyType == "ed25519" {
+				t.Skip("AWS PCA doesn't support Ed25519 keys")
+			}
 			cfg := map[string]interface{}{
 				"PrivateKeyType": tc.KeyType,
 				"PrivateKeyBits": tc.KeyBits,
@@ -101,7 +110,7 @@ func testSignAndValidate(t *testing.T, p Provider, rootPEM string, intermediateP
 	csr, err := connect.ParseCSR(csrPEM)
 	require.NoError(t, err)
 
-	leafPEM, err := p.Sign(csr)
+	leafPEM, err := p.Sign(context.Background(), csr)
 	require.NoError(t, err)
 
 	err = connect.ValidateLeaf(rootPEM, leafPEM, intermediatePEMs)
@@ -285,7 +294,7 @@ func TestAWSNoCrossSigning(t *testing.T) {
 
 	caCert, err := connect.ParseCert(ca.RootCert)
 	require.NoError(t, err)
-	_, err = p1.CrossSignCA(caCert)
+	_, err = p1.CrossSignCA(context.Background(), caCert)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "not implemented")
 }
@@ -454,3 +463,380 @@ func testProviderConfigSecondary(t *testing.T, cfg map[string]interface{}) Provi
 	c.Datacenter = "dc2"
 	return c
 }
+
+// setTestAWSEnv configures the AWS SDK, through the environment, with fake
+// credentials and no instance metadata. Tests calling it can't be parallel.
+func setTestAWSEnv(t *testing.T) {
+	for k, v := range map[string]string{
+		"AWS_ACCESS_KEY_ID":         "AKIAEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY":     "secret",
+		"AWS_REGION":                "us-east-1",
+		"AWS_EC2_METADATA_DISABLED": "true",
+		"AWS_CA_BUNDLE":             "",
+	} {
+		old, ok := os.LookupEnv(k)
+		require.NoError(t, os.Setenv(k, v))
+		k := k
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(k, old)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+func TestAWSProvider_Configure_HTTPClient(t *testing.T) {
+	// Note not parallel since the AWS SDK is configured through the
+	// environment.
+	setTestAWSEnv(t)
+
+	transport := &recordingTransport{
+		status: http.StatusBadRequest,
+		body:   `{"__type": "ResourceNotFoundException", "message": "not found"}`,
+	}
+	provider := NewAWSProviderWithDeps(testutil.Logger(t), ProviderDeps{
+		HTTPClient: func() *http.Client {
+			return &http.Client{Transport: transport}
+		},
+	})
+	err := provider.Configure(ProviderConfig{
+		ClusterID:  connect.TestClusterID,
+		Datacenter: "dc1",
+		IsPrimary:  true,
+		RawConfig: map[string]interface{}{
+			"ExistingARN": "arn:aws:acm-pca:us-east-1:123456789012:certificate-authority/test",
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = provider.GenerateRoot()
+	require.Error(t, err)
+
+	// The CA was looked up through the injected client.
+	requests := transport.Requests()
+	require.Len(t, requests, 1)
+	require.Equal(t, "acm-pca.us-east-1.amazonaws.com", requests[0].URL.Host)
+	require.Equal(t, "ACMPrivateCA.DescribeCertificateAuthority", requests[0].Header.Get("X-Amz-Target"))
+}
+
+func TestAWSProvider_Usage(t *testing.T) {
+	// Note not parallel since the AWS SDK is configured through the
+	// environment.
+	setTestAWSEnv(t)
+
+	transport := &recordingTransport{
+		status: http.StatusOK,
+		body: `<GetMetricStatisticsResponse xmlns="http://monitoring.amazonaws.com/doc/2010-08-01/">
+  <GetMetricStatisticsResult>
+    <Label>Success</Label>
+    <Datapoints>
+      <member><Sum>30.0</Sum><Unit>Count</Unit></member>
+      <member><Sum>12.0</Sum><Unit>Count</Unit></member>
+    </Datapoints>
+  </GetMetricStatisticsResult>
+</GetMetricStatisticsResponse>`,
+	}
+	provider := NewAWSProviderWithDeps(testutil.Logger(t), ProviderDeps{
+		HTTPClient: func() *http.Client {
+			return &http.Client{Transport: transport}
+		},
+	})
+	arn := "arn:aws:acm-pca:us-east-1:123456789012:certificate-authority/test"
+	require.NoError(t, provider.Configure(ProviderConfig{
+		ClusterID:  connect.TestClusterID,
+		Datacenter: "dc1",
+		IsPrimary:  true,
+		RawConfig: map[string]interface{}{
+			"ExistingARN":          arn,
+			"MonthlyIssuanceQuota": 1000,
+		},
+	}))
+
+	issued, quota, err := provider.Usage()
+	require.NoError(t, err)
+	require.Equal(t, int64(42), issued)
+	require.Equal(t, int64(1000), quota)
+
+	// The PCA's issuance metric was queried from CloudWatch, which is only
+	// done when a quota is configured.
+	requests := transport.Requests()
+	require.Len(t, requests, 1)
+	require.Equal(t, "monitoring.us-east-1.amazonaws.com", requests[0].URL.Host)
+	require.NoError(t, requests[0].ParseForm())
+	require.Equal(t, "GetMetricStatistics", requests[0].PostForm.Get("Action"))
+	require.Equal(t, "AWS/ACMPrivateCA", requests[0].PostForm.Get("Namespace"))
+	require.Equal(t, arn, requests[0].PostForm.Get("Dimensions.member.1.Value"))
+
+	require.NoError(t, provider.Configure(ProviderConfig{
+		ClusterID:  connect.TestClusterID,
+		Datacenter: "dc1",
+		IsPrimary:  true,
+		RawConfig:  map[string]interface{}{"ExistingARN": arn},
+	}))
+	_, _, err = provider.Usage()
+	require.ErrorIs(t, err, ErrUsageNotSupported)
+	require.Len(t, transport.Requests(), 1)
+}
+
+func TestAWSProvider_applyAWSSignOptions(t *testing.T) {
+	newInput := func() *acmpca.IssueCertificateInput {
+		return &acmpca.IssueCertificateInput{TemplateArn: aws.String(LeafTemplateARN)}
+	}
+	templateARN := "arn:aws:acm-pca:::template/EndEntityClientAuthCertificate/V1"
+	allowed := []string{templateARN}
+
+	input := newInput()
+	require.NoError(t, applyAWSSignOptions(input, nil, allowed))
+	require.Equal(t, LeafTemplateARN, aws.StringValue(input.TemplateArn))
+
+	input = newInput()
+	require.NoError(t, applyAWSSignOptions(input, map[string]string{
+		AWSSignOptionTemplateARN:      templateARN,
+		AWSSignOptionIdempotencyToken: "web-1",
+	}, allowed))
+	require.Equal(t, templateARN, aws.StringValue(input.TemplateArn))
+	require.Equal(t, "web-1", aws.StringValue(input.IdempotencyToken))
+
+	err := applyAWSSignOptions(newInput(), map[string]string{AWSSignOptionTemplateARN: "client-auth"}, allowed)
+	require.EqualError(t, err, `sign option TemplateArn must be an ARN, got "client-auth"`)
+
+	// Templates that aren't allowed are refused, CA ones even when allowed.
+	err = applyAWSSignOptions(newInput(), map[string]string{AWSSignOptionTemplateARN: templateARN}, nil)
+	require.EqualError(t, err, `sign option TemplateArn "`+templateARN+`" isn't among the AllowedTemplateARNs of the CA configuration`)
+	for _, caTemplateARN := range []string{IntermediateTemplateARN, RootTemplateARN} {
+		err = applyAWSSignOptions(newInput(), map[string]string{AWSSignOptionTemplateARN: caTemplateARN}, []string{caTemplateARN})
+		require.EqualError(t, err, `sign option TemplateArn "`+caTemplateARN+`" isn't among the AllowedTemplateARNs of the CA configuration`)
+	}
+
+	err = applyAWSSignOptions(newInput(), map[string]string{"Label": "blue"}, allowed)
+	require.EqualError(t, err, `unknown sign option "Label" for the AWS CA provider`)
+
+	// Every option SignOptions allows is applied.
+	for _, key := range (&AWSProvider{}).SignOptions() {
+		require.NoError(t, applyAWSSignOptions(newInput(), map[string]string{key: templateARN}, allowed))
+	}
+}
+
+func TestParseAWSCAConfig_AllowedTemplateARNs(t *testing.T) {
+	_, err := ParseAWSCAConfig(map[string]interface{}{
+		"AllowedTemplateARNs": []string{"arn:aws:acm-pca:::template/EndEntityClientAuthCertificate/V1"},
+	})
+	require.NoError(t, err)
+
+	_, err = ParseAWSCAConfig(map[string]interface{}{
+		"AllowedTemplateARNs": []string{IntermediateTemplateARN},
+	})
+	require.EqualError(t, err, `AllowedTemplateARNs must not hold templates issuing CA certificates, got "`+IntermediateTemplateARN+`"`)
+
+	_, err = ParseAWSCAConfig(map[string]interface{}{
+		"AllowedTemplateARNs": []string{"client-auth"},
+	})
+	require.EqualError(t, err, `AllowedTemplateARNs must only hold ARNs, got "client-auth"`)
+}
+
+// pcaResponse is a response of the fake PCA API of pcaTransport.
+type pcaResponse struct {
+	status int
+	body   string
+}
+
+// pcaTransport answers the requests of each PCA operation, by X-Amz-Target,
+// with its responses in turn, and records the operations requested.
+type pcaTransport struct {
+	lock       sync.Mutex
+	responses  map[string][]pcaResponse
+	operations []string
+}
+
+func (p *pcaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	op := strings.TrimPrefix(req.Header.Get("X-Amz-Target"), "ACMPrivateCA.")
+
+	p.lock.Lock()
+	p.operations = append(p.operations, op)
+	resp := pcaResponse{status: http.StatusBadRequest, body: `{"__type": "InvalidRequestException"}`}
+	if queue := p.responses[op]; len(queue) > 0 {
+		resp, p.responses[op] = queue[0], queue[1:]
+	}
+	p.lock.Unlock()
+
+	return &http.Response{
+		StatusCode: resp.status,
+		Header:     http.Header{"Content-Type": []string{"application/x-amz-json-1.1"}},
+		Body:       ioutil.NopCloser(strings.NewReader(resp.body)),
+		Request:    req,
+	}, nil
+}
+
+func (p *pcaTransport) Operations() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]string(nil), p.operations...)
+}
+
+func TestAWSProvider_Sign_EventualConsistency(t *testing.T) {
+	// Note not parallel since the AWS SDK is configured through the
+	// environment.
+	setTestAWSEnv(t)
+
+	leafPEM := "-----BEGIN CERTIFICATE-----\nleaf\n-----END CERTIFICATE-----\n"
+	certBody, err := json.Marshal(map[string]string{"Certificate": leafPEM})
+	require.NoError(t, err)
+	pending := func(code string) pcaResponse {
+		return pcaResponse{status: http.StatusBadRequest, body: `{"__type": "` + code + `", "message": "not yet"}`}
+	}
+	transport := &pcaTransport{responses: map[string][]pcaResponse{
+		// The PCA doesn't accept requests yet, then the certificate isn't
+		// found and then still being issued.
+		"IssueCertificate": {
+			pending(acmpca.ErrCodeInvalidStateException),
+			{status: http.StatusOK, body: `{"CertificateArn": "arn:aws:acm-pca:us-east-1:123456789012:certificate-authority/test/certificate/1"}`},
+		},
+		"GetCertificate": {
+			pending(acmpca.ErrCodeResourceNotFoundException),
+			pending(acmpca.ErrCodeRequestInProgressException),
+			{status: http.StatusOK, body: string(certBody)},
+		},
+	}}
+	provider := NewAWSProviderWithDeps(testutil.Logger(t), ProviderDeps{
+		HTTPClient: func() *http.Client {
+			return &http.Client{Transport: transport}
+		},
+	})
+	require.NoError(t, provider.Configure(ProviderConfig{
+		ClusterID:  connect.TestClusterID,
+		Datacenter: "dc1",
+		IsPrimary:  true,
+		RawConfig: map[string]interface{}{
+			"ExistingARN": "arn:aws:acm-pca:us-east-1:123456789012:certificate-authority/test",
+		},
+	}))
+	provider.rootPEM = "root"
+
+	spiffeID := connect.TestSpiffeIDService(t, "web")
+	csrPEM, _ := connect.TestCSR(t, spiffeID)
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+
+	pem, err := provider.Sign(context.Background(), csr)
+	require.NoError(t, err)
+	require.Equal(t, leafPEM, pem)
+	require.Equal(t, []string{
+		"IssueCertificate", "IssueCertificate",
+		"GetCertificate", "GetCertificate", "GetCertificate",
+	}, transport.Operations())
+}
+
+func TestAWSProvider_Sign_ContextCanceled(t *testing.T) {
+	// Note not parallel since the AWS SDK is configured through the
+	// environment.
+	setTestAWSEnv(t)
+
+	// The certificate is issued but never ready.
+	inProgress := make([]pcaResponse, 20)
+	for i := range inProgress {
+		inProgress[i] = pcaResponse{
+			status: http.StatusBadRequest,
+			body:   `{"__type": "` + acmpca.ErrCodeRequestInProgressException + `", "message": "not yet"}`,
+		}
+	}
+	transport := &pcaTransport{responses: map[string][]pcaResponse{
+		"IssueCertificate": {
+			{status: http.StatusOK, body: `{"CertificateArn": "arn:aws:acm-pca:us-east-1:123456789012:certificate-authority/test/certificate/1"}`},
+		},
+		"GetCertificate": inProgress,
+	}}
+	provider := NewAWSProviderWithDeps(testutil.Logger(t), ProviderDeps{
+		HTTPClient: func() *http.Client {
+			return &http.Client{Transport: transport}
+		},
+	})
+	require.NoError(t, provider.Configure(ProviderConfig{
+		ClusterID:  connect.TestClusterID,
+		Datacenter: "dc1",
+		IsPrimary:  true,
+		RawConfig: map[string]interface{}{
+			"ExistingARN": "arn:aws:acm-pca:us-east-1:123456789012:certificate-authority/test",
+		},
+	}))
+	provider.rootPEM = "root"
+
+	csrPEM, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "web"))
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+
+	// Cancel while waiting for the certificate.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(500*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = provider.Sign(ctx, csr)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, int64(time.Since(start)), int64(AWSSignTimeout))
+	require.Contains(t, transport.Operations(), "GetCertificate")
+}
+
+func TestAWSProvider_Configure_RegionAndAssumeRole(t *testing.T) {
+	// Note not parallel since the AWS SDK is configured through the
+	// environment.
+	setTestAWSEnv(t)
+
+	configure := func(t *testing.T, raw map[string]interface{}) []*http.Request {
+		transport := &recordingTransport{
+			status: http.StatusForbidden,
+			body:   `{"__type": "AccessDeniedException", "message": "denied"}`,
+		}
+		provider := NewAWSProviderWithDeps(testutil.Logger(t), ProviderDeps{
+			HTTPClient: func() *http.Client {
+				return &http.Client{Transport: transport}
+			},
+		})
+		raw["ExistingARN"] = "arn:aws:acm-pca:eu-west-1:123456789012:certificate-authority/test"
+		require.NoError(t, provider.Configure(ProviderConfig{
+			ClusterID:  connect.TestClusterID,
+			Datacenter: "dc1",
+			IsPrimary:  true,
+			RawConfig:  raw,
+		}))
+		_, err := provider.GenerateRoot()
+		require.Error(t, err)
+		requests := transport.Requests()
+		require.NotEmpty(t, requests)
+		return requests
+	}
+
+	t.Run("region", func(t *testing.T) {
+		requests := configure(t, map[string]interface{}{"Region": "eu-west-1"})
+		require.Equal(t, "acm-pca.eu-west-1.amazonaws.com", requests[0].URL.Host)
+	})
+
+	t.Run("assume role", func(t *testing.T) {
+		requests := configure(t, map[string]interface{}{
+			"AssumeRoleARN":         "arn:aws:iam::123456789012:role/consul-ca",
+			"AssumeRoleExternalID":  "consul",
+			"AssumeRoleSessionName": "consul-dc1",
+		})
+		// The role is assumed before calling PCA.
+		require.Equal(t, "sts.amazonaws.com", requests[0].URL.Host)
+		require.NoError(t, requests[0].ParseForm())
+		require.Equal(t, "AssumeRole", requests[0].PostForm.Get("Action"))
+		require.Equal(t, "arn:aws:iam::123456789012:role/consul-ca", requests[0].PostForm.Get("RoleArn"))
+		require.Equal(t, "consul", requests[0].PostForm.Get("ExternalId"))
+		require.Equal(t, "consul-dc1", requests[0].PostForm.Get("RoleSessionName"))
+	})
+
+	_, err := ParseAWSCAConfig(map[string]interface{}{"AssumeRoleExternalID": "consul"})
+	require.EqualError(t, err, "AssumeRoleExternalID and AssumeRoleSessionName require AssumeRoleARN")
+}
+
+func TestAWSProvider_awsThrottleError(t *testing.T) {
+	throttled := awsThrottleError(awserr.New("ThrottlingException", "Rate exceeded", nil))
+	require.ErrorIs(t, throttled, ErrRateLimited)
+	require.Contains(t, throttled.Error(), "Rate exceeded")
+
+	denied := awserr.New("AccessDeniedException", "denied", nil)
+	require.Equal(t, denied, awsThrottleError(denied))
+	require.NoError(t, awsThrottleError(nil))
+}
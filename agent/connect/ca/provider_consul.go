@@ -2,6 +2,8 @@ package ca
 
 import (
 	"bytes"
+	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
@@ -15,11 +17,16 @@ import (
 	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"golang.org/x/crypto/ocsp"
 
 	"github.com/hashicorp/consul/agent/connect"
 	"github.com/hashicorp/consul/agent/structs"
 )
 
+// ConsulProviderVersion is the version of the configuration and state the
+// consul provider expects, see VersionedProvider.
+const ConsulProviderVersion = 1
+
 var (
 	// NotBefore will be CertificateTimeDriftBuffer in the past to account for
 	// time drift between different servers.
@@ -37,6 +44,7 @@ type ConsulProvider struct {
 	isPrimary bool
 	spiffeID  *connect.SpiffeIDSigning
 	logger    hclog.Logger
+	deps      ProviderDeps
 
 	// testState is only used to test Consul leader's handling of providers that
 	// need to persist state. Consul provider actually manages it's state directly
@@ -51,7 +59,13 @@ type ConsulProvider struct {
 
 // NewConsulProvider returns a new ConsulProvider that is ready to be used.
 func NewConsulProvider(delegate ConsulProviderStateDelegate, logger hclog.Logger) *ConsulProvider {
-	return &ConsulProvider{Delegate: delegate, logger: logger}
+	return NewConsulProviderWithDeps(delegate, logger, ProviderDeps{})
+}
+
+// NewConsulProviderWithDeps is like NewConsulProvider but uses the clock,
+// serial number and private key sources in deps when they are set.
+func NewConsulProviderWithDeps(delegate ConsulProviderStateDelegate, logger hclog.Logger, deps ProviderDeps) *ConsulProvider {
+	return &ConsulProvider{Delegate: delegate, logger: logger, deps: deps}
 }
 
 type ConsulProviderStateDelegate interface {
@@ -160,13 +174,13 @@ func (c *ConsulProvider) GenerateRoot() (RootResult, error) {
 		return RootResult{}, fmt.Errorf("provider is not the root certificate authority")
 	}
 	if providerState.RootCert != "" {
-		return RootResult{PEM: providerState.RootCert}, nil
+		return RootResult{PEM: EnsureTrailingNewline(providerState.RootCert)}, nil
 	}
 
 	// Generate a private key if needed
 	newState := *providerState
 	if c.config.PrivateKey == "" {
-		_, pk, err := connect.GeneratePrivateKeyWithConfig(c.config.PrivateKeyType, c.config.PrivateKeyBits)
+		_, pk, err := c.generatePrivateKey()
 		if err != nil {
 			return RootResult{}, err
 		}
@@ -200,7 +214,57 @@ func (c *ConsulProvider) GenerateRoot() (RootResult, error) {
 		return RootResult{}, err
 	}
 
-	return RootResult{PEM: newState.RootCert}, nil
+	return RootResult{PEM: EnsureTrailingNewline(newState.RootCert)}, nil
+}
+
+// TTLLimits implements TTLLimiter. The built-in CA can issue certificates for
+// any TTL.
+func (c *ConsulProvider) TTLLimits() (time.Duration, time.Duration, error) {
+	return 0, 0, nil
+}
+
+// ReplaceRoot implements RootReplacer. It generates a new private key and
+// root certificate and replaces the ones in the provider state with them.
+// Roots configured with PrivateKey or RootCert can't be replaced this way.
+func (c *ConsulProvider) ReplaceRoot() (RootResult, error) {
+	providerState, err := c.getState()
+	if err != nil {
+		return RootResult{}, err
+	}
+
+	if !c.isPrimary {
+		return RootResult{}, fmt.Errorf("provider is not the root certificate authority")
+	}
+	if c.config.PrivateKey != "" || c.config.RootCert != "" {
+		return RootResult{}, fmt.Errorf("cannot replace a root that was configured with a private key or root certificate")
+	}
+
+	_, pk, err := c.generatePrivateKey()
+	if err != nil {
+		return RootResult{}, err
+	}
+	nextSerial, err := c.incrementAndGetNextSerialNumber()
+	if err != nil {
+		return RootResult{}, fmt.Errorf("error computing next serial number: %v", err)
+	}
+	ca, err := c.generateCA(pk, nextSerial, c.config.RootCertTTL)
+	if err != nil {
+		return RootResult{}, fmt.Errorf("error generating CA: %v", err)
+	}
+
+	newState := *providerState
+	newState.PrivateKey = pk
+	newState.RootCert = ca
+	newState.IntermediateCert = ""
+	args := &structs.CARequest{
+		Op:            structs.CAOpSetProviderState,
+		ProviderState: &newState,
+	}
+	if _, err := c.Delegate.ApplyCARequest(args); err != nil {
+		return RootResult{}, err
+	}
+
+	return RootResult{PEM: EnsureTrailingNewline(newState.RootCert)}, nil
 }
 
 // GenerateIntermediateCSR creates a private key and generates a CSR
@@ -217,12 +281,13 @@ func (c *ConsulProvider) GenerateIntermediateCSR() (string, error) {
 	}
 
 	// Create a new private key and CSR.
-	signer, pk, err := connect.GeneratePrivateKeyWithConfig(c.config.PrivateKeyType, c.config.PrivateKeyBits)
+	signer, pk, err := c.generatePrivateKey()
 	if err != nil {
 		return "", err
 	}
 
-	csr, err := connect.CreateCACSR(c.spiffeID, signer)
+	csr, err := connect.CreateCACSRWithSigAlgo(c.spiffeID, signer,
+		c.config.IntermediateCertSubject.ToPKIXName(), c.config.IntermediateCSRSigAlgo())
 	if err != nil {
 		return "", err
 	}
@@ -238,7 +303,7 @@ func (c *ConsulProvider) GenerateIntermediateCSR() (string, error) {
 		return "", err
 	}
 
-	return csr, nil
+	return EnsureTrailingNewline(csr), nil
 }
 
 // SetIntermediate validates that the given intermediate is for the right private key
@@ -282,9 +347,9 @@ func (c *ConsulProvider) ActiveIntermediate() (string, error) {
 	}
 
 	if c.isPrimary {
-		return providerState.RootCert, nil
+		return EnsureTrailingNewline(providerState.RootCert), nil
 	}
-	return providerState.IntermediateCert, nil
+	return EnsureTrailingNewline(providerState.IntermediateCert), nil
 }
 
 // We aren't maintaining separate root/intermediate CAs for the builtin
@@ -310,9 +375,54 @@ func (c *ConsulProvider) Cleanup(_ bool, _ map[string]interface{}) error {
 	return nil
 }
 
+// KeyStorageLocation implements Provider. The keys are stored with the
+// provider state in the Consul state.
+func (c *ConsulProvider) KeyStorageLocation() (KeyLocation, error) {
+	return KeyLocationConsulState, nil
+}
+
+// ProviderVersion implements VersionedProvider.
+func (c *ConsulProvider) ProviderVersion() int {
+	return ConsulProviderVersion
+}
+
+// ValidateCSR checks the extensions requested by the CSR against the CSR
+// extension policy, like Sign does.
+func (c *ConsulProvider) ValidateCSR(csr *x509.CertificateRequest) error {
+	_, err := csrExtensionsForPolicy(csr, c.config.CSRExtensionPolicy, c.config.CSRExtensionAllowlistOIDs())
+	return err
+}
+
+// VerifyAttestation verifies a JSON-encoded TPMAttestation that the key of
+// the CSR was generated in a TPM whose attestation key is signed by one of the
+// TPMAttestationRoots.
+func (c *ConsulProvider) VerifyAttestation(csr *x509.CertificateRequest, attestation []byte) error {
+	if c.config.TPMAttestationRoots == "" {
+		return fmt.Errorf("no TPMAttestationRoots are configured to verify attestations with")
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(c.config.TPMAttestationRoots))
+	return verifyTPMAttestation(roots, csr, attestation)
+}
+
 // Sign returns a new certificate valid for the given SpiffeIDService
-// using the current CA.
-func (c *ConsulProvider) Sign(csr *x509.CertificateRequest) (string, error) {
+// using the current CA. The CA is held by Consul, so ctx is only checked
+// before signing.
+func (c *ConsulProvider) Sign(ctx context.Context, csr *x509.CertificateRequest) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return c.SignWithParams(csr, LeafSignParams{})
+}
+
+// SignWithParams is like Sign but applies params.
+func (c *ConsulProvider) SignWithParams(csr *x509.CertificateRequest, params LeafSignParams) (string, error) {
+	extensions, err := csrExtensionsForPolicy(csr, c.config.CSRExtensionPolicy, c.config.CSRExtensionAllowlistOIDs())
+	if err != nil {
+		return "", err
+	}
+	extensions = mergeExtensions(extensions, params.Extensions)
+
 	connect.HackSANExtensionForCSR(csr)
 
 	// Lock during the signing so we don't use the same index twice
@@ -329,7 +439,6 @@ func (c *ConsulProvider) Sign(csr *x509.CertificateRequest) (string, error) {
 		return "", ErrNotInitialized
 	}
 
-	// Create the keyId for the cert from the signing private key.
 	signer, err := connect.ParseSigner(providerState.PrivateKey)
 	if err != nil {
 		return "", err
@@ -337,16 +446,6 @@ func (c *ConsulProvider) Sign(csr *x509.CertificateRequest) (string, error) {
 	if signer == nil {
 		return "", ErrNotInitialized
 	}
-	keyId, err := connect.KeyId(signer.Public())
-	if err != nil {
-		return "", err
-	}
-
-	// Create the subjectKeyId for the cert from the csr public key.
-	subjectKeyID, err := connect.KeyId(csr.PublicKey)
-	if err != nil {
-		return "", err
-	}
 
 	// Parse the CA cert
 	certPEM, err := c.ActiveIntermediate()
@@ -366,58 +465,269 @@ func (c *ConsulProvider) Sign(csr *x509.CertificateRequest) (string, error) {
 	// Cert template for generation
 	sn := &big.Int{}
 	sn.SetUint64(nextSerial)
-	// Sign the certificate valid from 1 minute in the past, this helps it be
-	// accepted right away even when nodes are not in close time sync across the
-	// cluster. A minute is more than enough for typical DC clock drift.
-	effectiveNow := time.Now().Add(-1 * time.Minute)
-	template := x509.Certificate{
-		SerialNumber: sn,
-		URIs:         csr.URIs,
-		Signature:    csr.Signature,
-		// We use the correct signature algorithm for the CA key we are signing with
-		// regardless of the algorithm used to sign the CSR signature above since
-		// the leaf might use a different key type.
-		SignatureAlgorithm:    connect.SigAlgoForKey(signer),
-		PublicKeyAlgorithm:    csr.PublicKeyAlgorithm,
-		PublicKey:             csr.PublicKey,
-		BasicConstraintsValid: true,
-		KeyUsage: x509.KeyUsageDataEncipherment |
-			x509.KeyUsageKeyAgreement |
-			x509.KeyUsageDigitalSignature |
-			x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage: []x509.ExtKeyUsage{
-			x509.ExtKeyUsageClientAuth,
-			x509.ExtKeyUsageServerAuth,
-		},
-		NotAfter:       effectiveNow.Add(c.config.LeafCertTTL),
-		NotBefore:      effectiveNow,
-		AuthorityKeyId: keyId,
-		SubjectKeyId:   subjectKeyID,
-		DNSNames:       csr.DNSNames,
-		IPAddresses:    csr.IPAddresses,
+	// Sign the certificate valid from CertificateTimeDriftBuffer in the past,
+	// this helps it be accepted right away even when nodes are not in close
+	// time sync across the cluster.
+	effectiveNow := c.now().Add(-1 * CertificateTimeDriftBuffer)
+	notBefore := effectiveNow
+	if !params.LatestNotBefore.IsZero() && params.LatestNotBefore.Before(notBefore) {
+		notBefore = params.LatestNotBefore
 	}
 
-	// Create the certificate, PEM encode it and return that value.
-	var buf bytes.Buffer
-	bs, err := x509.CreateCertificate(
-		rand.Reader, &template, caCert, csr.PublicKey, signer)
+	// Never issue a leaf that outlives the cert signing it, it would stop
+	// validating part way through its lifetime.
+	ttl := c.config.LeafCertTTL
+	if params.TTL > 0 {
+		ttl = params.TTL
+	}
+	if params.MaxTTL > 0 && params.MaxTTL < ttl {
+		ttl = params.MaxTTL
+	}
+	notAfter, clamped := clampLeafNotAfter(effectiveNow.Add(ttl), caCert)
+	if clamped {
+		c.logger.Warn("leaf certificate TTL clamped to the expiry of the signing certificate",
+			"leaf_cert_ttl", ttl,
+			"not_after", notAfter,
+		)
+	}
+
+	// Refuse to sign with another cert than the one chosen, the chain
+	// returned with the leaf would not lead verifiers to its issuer.
+	if len(params.AuthorityKeyID) > 0 && !bytes.Equal(params.AuthorityKeyID, caCert.SubjectKeyId) {
+		return "", fmt.Errorf("the leaf certificate must be signed by the certificate with key ID %s, but the provider signs with %s",
+			connect.EncodeSigningKeyID(params.AuthorityKeyID), connect.EncodeSigningKeyID(caCert.SubjectKeyId))
+	}
+
+	return signLeafCert(csr, caCert, signer, sn, notBefore, notAfter, extensions, params.ExtKeyUsage, params.KeyUsage, params.AuthorityKeyID, params.PolicyIdentifiers)
+}
+
+// VerifySigningKey checks that the private key in the provider state is the
+// key of the active intermediate, without issuing a certificate.
+func (c *ConsulProvider) VerifySigningKey(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	providerState, err := c.getState()
 	if err != nil {
-		return "", fmt.Errorf("error generating certificate: %s", err)
+		return err
 	}
-	err = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: bs})
+	if providerState.PrivateKey == "" {
+		return ErrNotInitialized
+	}
+
+	certPEM, err := c.ActiveIntermediate()
 	if err != nil {
-		return "", fmt.Errorf("error encoding certificate: %s", err)
+		return err
 	}
+	return validateIntermediateSignedByPrivateKey(certPEM, providerState.PrivateKey)
+}
 
-	// Set the response
+// SignTemplate signs a leaf certificate for the public key of the template.
+// SignWithParams only reads the fields of the CSR that a template has, so it
+// is used as is.
+func (c *ConsulProvider) SignTemplate(template *x509.CertificateRequest, params LeafSignParams) (string, error) {
+	return c.SignWithParams(template, params)
+}
+
+// SignCRL returns a CRL listing revoked, signed by the CRL signer when
+// CRLSignerEnabled is set and by the active signing cert otherwise.
+func (c *ConsulProvider) SignCRL(revoked []pkix.RevokedCertificate, thisUpdate, nextUpdate time.Time) (string, error) {
+	// Lock so that concurrent calls don't each mint a CRL signer.
+	c.Lock()
+	defer c.Unlock()
+
+	signerCert, _, signer, err := c.revocationSigner()
+	if err != nil {
+		return "", err
+	}
+
+	entries := make([]x509.RevocationListEntry, 0, len(revoked))
+	for _, r := range revoked {
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   r.SerialNumber,
+			RevocationTime: r.RevocationTime,
+			Extensions:     r.Extensions,
+		})
+	}
+	template := x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		// CRLs are only signed by the leader, one at a time, so the time
+		// they are issued at increases along with them.
+		Number:     big.NewInt(thisUpdate.UnixNano()),
+		ThisUpdate: thisUpdate,
+		NextUpdate: nextUpdate,
+	}
+	bs, err := x509.CreateRevocationList(rand.Reader, &template, signerCert, signer)
+	if err != nil {
+		return "", fmt.Errorf("error creating CRL: %s", err)
+	}
+
+	var buf bytes.Buffer
+	err = pem.Encode(&buf, &pem.Block{Type: "X509 CRL", Bytes: bs})
+	if err != nil {
+		return "", fmt.Errorf("error encoding CRL: %s", err)
+	}
 	return buf.String(), nil
 }
 
+// SignOCSPResponse returns an OCSP response for a leaf certificate issued by
+// the active signing cert. It is signed like SignCRL, and includes the CRL
+// signer cert when there is one so that clients can verify it.
+func (c *ConsulProvider) SignOCSPResponse(template ocsp.Response) ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	signerCert, issuer, signer, err := c.revocationSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	template.Certificate = nil
+	if signerCert != issuer {
+		template.Certificate = signerCert
+	}
+	resp, err := ocsp.CreateResponse(issuer, signerCert, template, signer)
+	if err != nil {
+		return nil, fmt.Errorf("error creating OCSP response: %s", err)
+	}
+	return resp, nil
+}
+
+// revocationSigner returns the cert and key to sign CRLs and OCSP responses
+// with, and the active signing cert which issued the leaf certificates they
+// are about. The CRL signer is minted if it is enabled and the current one
+// can't be used. It must be called with the lock held.
+func (c *ConsulProvider) revocationSigner() (*x509.Certificate, *x509.Certificate, crypto.Signer, error) {
+	providerState, err := c.getState()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if providerState.PrivateKey == "" {
+		return nil, nil, nil, ErrNotInitialized
+	}
+
+	signer, err := connect.ParseSigner(providerState.PrivateKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	certPEM, err := c.ActiveIntermediate()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	issuer, err := connect.ParseCert(certPEM)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error parsing CA cert: %s", err)
+	}
+
+	if !c.config.CRLSignerEnabled {
+		return issuer, issuer, signer, nil
+	}
+
+	// Keep using the CRL signer until it expires or the signing cert changes,
+	// after an intermediate renewal or a root rotation.
+	if providerState.CRLSignerCert != "" {
+		crlCert, err := connect.ParseCert(providerState.CRLSignerCert)
+		if err == nil && c.now().Before(crlCert.NotAfter) && crlCert.CheckSignatureFrom(issuer) == nil {
+			crlSigner, err := connect.ParseSigner(providerState.CRLSignerKey)
+			if err == nil {
+				return crlCert, issuer, crlSigner, nil
+			}
+		}
+	}
+
+	crlCert, crlSigner, err := c.generateCRLSigner(providerState, issuer, signer)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return crlCert, issuer, crlSigner, nil
+}
+
+// generateCRLSigner mints a new CRL signer under issuer and persists it in the
+// provider state. It has the Subject of issuer, so that the CRLs it signs have
+// the issuer name of the leaf certificates they cover and are direct CRLs, as
+// RFC 5280 allows for a CRL signed with another key of the issuing CA. The
+// authority key ID of the CRLs tells the two keys apart.
+func (c *ConsulProvider) generateCRLSigner(
+	providerState *structs.CAConsulProviderState,
+	issuer *x509.Certificate,
+	issuerSigner crypto.Signer,
+) (*x509.Certificate, crypto.Signer, error) {
+	signer, keyPEM, err := c.generatePrivateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	keyId, err := connect.KeyId(signer.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nextSerial, err := c.incrementAndGetNextSerialNumber()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error computing next serial number: %v", err)
+	}
+	sn := &big.Int{}
+	sn.SetUint64(nextSerial)
+
+	ttl := c.config.CRLSignerCertTTL
+	if ttl == 0 {
+		ttl = c.config.LeafCertTTL
+	}
+	effectiveNow := c.now().Add(-CertificateTimeDriftBuffer)
+	notAfter, _ := clampLeafNotAfter(effectiveNow.Add(ttl), issuer)
+
+	template := x509.Certificate{
+		SerialNumber:          sn,
+		Subject:               issuer.Subject,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		NotBefore:             effectiveNow,
+		NotAfter:              notAfter,
+		AuthorityKeyId:        issuer.SubjectKeyId,
+		SubjectKeyId:          keyId,
+	}
+	bs, err := x509.CreateCertificate(rand.Reader, &template, issuer, signer.Public(), issuerSigner)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating CRL signer certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(bs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: bs}); err != nil {
+		return nil, nil, fmt.Errorf("error encoding CRL signer certificate: %s", err)
+	}
+
+	newState := *providerState
+	newState.CRLSignerKey = keyPEM
+	newState.CRLSignerCert = buf.String()
+	args := &structs.CARequest{
+		Op:            structs.CAOpSetProviderState,
+		ProviderState: &newState,
+	}
+	if _, err := c.Delegate.ApplyCARequest(args); err != nil {
+		return nil, nil, err
+	}
+
+	c.logger.Info("minted a new CRL signer certificate", "not_after", notAfter)
+	return cert, signer, nil
+}
+
 // SignIntermediate will validate the CSR to ensure the trust domain in the
 // URI SAN matches the local one and that basic constraints for a CA certificate
 // are met. It should return a signed CA certificate with a path length constraint
 // of 0 to ensure that the certificate cannot be used to generate further CA certs.
-func (c *ConsulProvider) SignIntermediate(csr *x509.CertificateRequest) (string, error) {
+func (c *ConsulProvider) SignIntermediate(ctx context.Context, csr *x509.CertificateRequest) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
 	providerState, err := c.getState()
 	if err != nil {
 		return "", err
@@ -452,10 +762,10 @@ func (c *ConsulProvider) SignIntermediate(csr *x509.CertificateRequest) (string,
 	// Cert template for generation
 	sn := &big.Int{}
 	sn.SetUint64(nextSerial)
-	// Sign the certificate valid from 1 minute in the past, this helps it be
-	// accepted right away even when nodes are not in close time sync across the
-	// cluster. A minute is more than enough for typical DC clock drift.
-	effectiveNow := time.Now().Add(-1 * CertificateTimeDriftBuffer)
+	// Sign the certificate valid from CertificateTimeDriftBuffer in the past,
+	// this helps it be accepted right away even when nodes are not in close
+	// time sync across the cluster.
+	effectiveNow := c.now().Add(-1 * CertificateTimeDriftBuffer)
 	template := x509.Certificate{
 		SerialNumber:          sn,
 		DNSNames:              csr.DNSNames,
@@ -492,11 +802,15 @@ func (c *ConsulProvider) SignIntermediate(csr *x509.CertificateRequest) (string,
 	}
 
 	// Set the response
-	return buf.String(), nil
+	return EnsureTrailingNewline(buf.String()), nil
 }
 
 // CrossSignCA returns the given CA cert signed by the current active root.
-func (c *ConsulProvider) CrossSignCA(cert *x509.Certificate) (string, error) {
+func (c *ConsulProvider) CrossSignCA(ctx context.Context, cert *x509.Certificate) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
 	c.Lock()
 	defer c.Unlock()
 
@@ -538,10 +852,10 @@ func (c *ConsulProvider) CrossSignCA(cert *x509.Certificate) (string, error) {
 	template.SignatureAlgorithm = rootCA.SignatureAlgorithm
 	template.AuthorityKeyId = keyId
 
-	// Sign the certificate valid from 1 minute in the past, this helps it be
-	// accepted right away even when nodes are not in close time sync across the
-	// cluster. A minute is more than enough for typical DC clock drift.
-	effectiveNow := time.Now().Add(-1 * time.Minute)
+	// Sign the certificate valid from CertificateTimeDriftBuffer in the past,
+	// this helps it be accepted right away even when nodes are not in close
+	// time sync across the cluster.
+	effectiveNow := c.now().Add(-1 * CertificateTimeDriftBuffer)
 	template.NotBefore = effectiveNow
 	// This cross-signed cert is only needed during rotation, and only while old
 	// leaf certs are still in use. They expire within 3 days currently so 7 is
@@ -561,7 +875,7 @@ func (c *ConsulProvider) CrossSignCA(cert *x509.Certificate) (string, error) {
 		return "", fmt.Errorf("error encoding private key: %s", err)
 	}
 
-	return buf.String(), nil
+	return EnsureTrailingNewline(buf.String()), nil
 }
 
 // SupportsCrossSigning implements Provider
@@ -585,6 +899,10 @@ func (c *ConsulProvider) getState() (*structs.CAConsulProviderState, error) {
 }
 
 func (c *ConsulProvider) incrementAndGetNextSerialNumber() (uint64, error) {
+	if c.deps.SerialNumber != nil {
+		return c.deps.SerialNumber()
+	}
+
 	args := &structs.CARequest{
 		Op: structs.CAOpIncrementProviderSerialNumber,
 	}
@@ -597,6 +915,20 @@ func (c *ConsulProvider) incrementAndGetNextSerialNumber() (uint64, error) {
 	return raw.(uint64), nil
 }
 
+func (c *ConsulProvider) now() time.Time {
+	if c.deps.Clock != nil {
+		return c.deps.Clock()
+	}
+	return time.Now()
+}
+
+func (c *ConsulProvider) generatePrivateKey() (crypto.Signer, string, error) {
+	if c.deps.PrivateKey != nil {
+		return c.deps.PrivateKey(c.config.PrivateKeyType, c.config.PrivateKeyBits)
+	}
+	return connect.GeneratePrivateKeyWithConfig(c.config.PrivateKeyType, c.config.PrivateKeyBits)
+}
+
 // generateCA makes a new root CA using the current private key
 func (c *ConsulProvider) generateCA(privateKey string, sn uint64, rootCertTTL time.Duration) (string, error) {
 	privKey, err := connect.ParseSigner(privateKey)
@@ -628,8 +960,8 @@ func (c *ConsulProvider) generateCA(privateKey string, sn uint64, rootCertTTL ti
 			x509.KeyUsageCRLSign |
 			x509.KeyUsageDigitalSignature,
 		IsCA:           true,
-		NotAfter:       time.Now().Add(rootCertTTL),
-		NotBefore:      time.Now(),
+		NotAfter:       c.now().Add(rootCertTTL),
+		NotBefore:      c.now(),
 		AuthorityKeyId: keyId,
 		SubjectKeyId:   keyId,
 	}
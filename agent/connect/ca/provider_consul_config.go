@@ -2,6 +2,8 @@ package ca
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/consul/agent/connect"
@@ -55,3 +57,45 @@ func defaultCommonConfig() structs.CommonCAProviderConfig {
 		RootCertTTL:         10 * 24 * 365 * time.Hour,
 	}
 }
+
+// decodeConfigStrict decodes raw into result like the lenient decoding of
+// ParseConsulCAConfig, but returns an error naming any key of raw that
+// doesn't match a field of result. This catches typos in the configuration of
+// providers such as Vault, where an unknown key would otherwise leave the
+// intended field at its default and only surface as an error from the
+// backend, if at all.
+//
+// The Consul provider keeps decoding leniently: it is the default provider
+// and also reads keys that are not part of its typed configuration.
+func decodeConfigStrict(raw map[string]interface{}, result interface{}, hook mapstructure.DecodeHookFunc) error {
+	var md mapstructure.Metadata
+	decodeConf := &mapstructure.DecoderConfig{
+		DecodeHook:       hook,
+		Metadata:         &md,
+		Result:           result,
+		WeaklyTypedInput: true,
+	}
+
+	decoder, err := mapstructure.NewDecoder(decodeConf)
+	if err != nil {
+		return err
+	}
+
+	if err := decoder.Decode(raw); err != nil {
+		return fmt.Errorf("error decoding config: %s", err)
+	}
+
+	var unknown []string
+	for _, key := range md.Unused {
+		// cluster_id is read by the agent when bootstrapping the CA.
+		if key == "cluster_id" {
+			continue
+		}
+		unknown = append(unknown, key)
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("error decoding config: unknown keys: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
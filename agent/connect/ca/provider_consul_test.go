@@ -1,12 +1,25 @@
 package ca
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
 
 	"github.com/hashicorp/consul/agent/connect"
 	"github.com/hashicorp/consul/agent/consul/fsm"
@@ -140,6 +153,243 @@ func TestConsulCAProvider_Bootstrap_WithCert(t *testing.T) {
 	require.NotEqualf(t, defaultNotAfter.Year(), parsed.NotAfter.Year(), "parsed cert ttl expected to be different from default root cert ttl")
 }
 
+func TestConsulCAProvider_ReplaceRoot(t *testing.T) {
+	t.Parallel()
+
+	conf := testConsulCAConfig()
+	delegate := newMockDelegate(t, conf)
+
+	provider := TestConsulProvider(t, delegate)
+	require.NoError(t, provider.Configure(testProviderConfig(conf)))
+
+	oldRoot, err := provider.GenerateRoot()
+	require.NoError(t, err)
+
+	newRoot, err := provider.ReplaceRoot()
+	require.NoError(t, err)
+	require.NotEqual(t, oldRoot.PEM, newRoot.PEM)
+
+	oldCert, err := connect.ParseCert(oldRoot.PEM)
+	require.NoError(t, err)
+	newCert, err := connect.ParseCert(newRoot.PEM)
+	require.NoError(t, err)
+	require.NotEqual(t, oldCert.SubjectKeyId, newCert.SubjectKeyId)
+
+	// The provider keeps the new root from now on.
+	root, err := provider.GenerateRoot()
+	require.NoError(t, err)
+	require.Equal(t, newRoot.PEM, root.PEM)
+	inter, err := provider.ActiveIntermediate()
+	require.NoError(t, err)
+	require.Equal(t, newRoot.PEM, inter)
+
+	// A configured root can't be replaced.
+	rootCA := connect.TestCAWithTTL(t, nil, 5*time.Hour)
+	conf = testConsulCAConfig()
+	conf.Config = map[string]interface{}{
+		"PrivateKey": rootCA.SigningKey,
+		"RootCert":   rootCA.RootCert,
+	}
+	provider = TestConsulProvider(t, newMockDelegate(t, conf))
+	require.NoError(t, provider.Configure(testProviderConfig(conf)))
+	_, err = provider.GenerateRoot()
+	require.NoError(t, err)
+	_, err = provider.ReplaceRoot()
+	require.Error(t, err)
+}
+
+func TestConsulCAProvider_VerifyAttestation(t *testing.T) {
+	t.Parallel()
+
+	tpm := NewTestTPM(t)
+	conf := testConsulCAConfig()
+	conf.Config["TPMAttestationRoots"] = tpm.RootsPEM
+	delegate := newMockDelegate(t, conf)
+
+	provider := TestConsulProvider(t, delegate)
+	require.NoError(t, provider.Configure(testProviderConfig(conf)))
+
+	csrPEM, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "web"))
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+	attestation := tpm.Attest(t, csrPEM)
+
+	require.NoError(t, provider.VerifyAttestation(csr, attestation))
+
+	tamper := func(f func(att *TPMAttestation)) []byte {
+		var att TPMAttestation
+		require.NoError(t, json.Unmarshal(attestation, &att))
+		f(&att)
+		raw, err := json.Marshal(att)
+		require.NoError(t, err)
+		return raw
+	}
+
+	t.Run("tampered certify info", func(t *testing.T) {
+		raw := tamper(func(att *TPMAttestation) {
+			att.CertifyInfo[len(att.CertifyInfo)-1] ^= 0xff
+		})
+		err := provider.VerifyAttestation(csr, raw)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid attestation signature")
+	})
+
+	t.Run("tampered public area", func(t *testing.T) {
+		raw := tamper(func(att *TPMAttestation) {
+			att.PublicArea[len(att.PublicArea)-1] ^= 0xff
+		})
+		err := provider.VerifyAttestation(csr, raw)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "does not certify the given public area")
+	})
+
+	t.Run("other CSR", func(t *testing.T) {
+		otherPEM, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "web"))
+		other, err := connect.ParseCSR(otherPEM)
+		require.NoError(t, err)
+		err = provider.VerifyAttestation(other, attestation)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "attestation was not made for this CSR")
+	})
+
+	t.Run("untrusted attestation key", func(t *testing.T) {
+		raw := NewTestTPM(t).Attest(t, csrPEM)
+		err := provider.VerifyAttestation(csr, raw)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "attestation key certificate is not trusted")
+	})
+}
+
+func TestConsulCAProvider_Sign_Golden(t *testing.T) {
+	t.Parallel()
+
+	readTestData := func(name string) string {
+		bs, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		require.NoError(t, err)
+		return string(bs)
+	}
+
+	// The CA key is RSA since PKCS #1 v1.5 signatures are deterministic,
+	// unlike ECDSA ones.
+	conf := testConsulCAConfig()
+	conf.Config["PrivateKey"] = readTestData("golden-ca.key")
+	conf.Config["RootCert"] = readTestData("golden-ca.crt")
+	delegate := newMockDelegate(t, conf)
+
+	now := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	provider := NewConsulProviderWithDeps(delegate, hclog.NewNullLogger(), ProviderDeps{
+		Clock:        func() time.Time { return now },
+		SerialNumber: func() (uint64, error) { return 42, nil },
+	})
+	require.NoError(t, provider.Configure(testProviderConfig(conf)))
+	_, err := provider.GenerateRoot()
+	require.NoError(t, err)
+
+	sign := func() string {
+		csr, err := connect.ParseCSR(readTestData("golden-leaf.csr"))
+		require.NoError(t, err)
+		leafPEM, err := provider.Sign(context.Background(), csr)
+		require.NoError(t, err)
+		return leafPEM
+	}
+
+	leafPEM := sign()
+	require.Equal(t, golden(t, leafPEM, "golden-leaf.crt"), leafPEM)
+	require.Equal(t, leafPEM, sign())
+
+	leaf, err := connect.ParseCert(leafPEM)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), leaf.SerialNumber.Int64())
+	require.Equal(t, now.Add(-time.Minute), leaf.NotBefore)
+	require.Equal(t, now.Add(-time.Minute).Add(72*time.Hour), leaf.NotAfter)
+}
+
+func TestConsulCAProvider_FastKeys(t *testing.T) {
+	t.Parallel()
+
+	conf := testConsulCAConfig()
+	conf.Config["PrivateKeyType"] = "rsa"
+	conf.Config["PrivateKeyBits"] = 2048
+
+	generateRoot := func(t *testing.T) *x509.Certificate {
+		delegate := newMockDelegate(t, conf)
+		provider := NewConsulProviderWithDeps(delegate, hclog.NewNullLogger(), ProviderDeps{
+			PrivateKey: TestFastKeys(),
+		})
+		require.NoError(t, provider.Configure(testProviderConfig(conf)))
+		root, err := provider.GenerateRoot()
+		require.NoError(t, err)
+		cert, err := connect.ParseCert(root.PEM)
+		require.NoError(t, err)
+		return cert
+	}
+
+	// The second provider reuses the key generated for the first one.
+	first := generateRoot(t)
+	second := generateRoot(t)
+	require.Equal(t, x509.RSA, first.PublicKeyAlgorithm)
+	require.Equal(t, first.PublicKey, second.PublicKey)
+
+	// Consecutive keys of a source are distinct.
+	keys := TestFastKeys()
+	key1, _, err := keys("rsa", 2048)
+	require.NoError(t, err)
+	key2, _, err := keys("rsa", 2048)
+	require.NoError(t, err)
+	require.Equal(t, first.PublicKey, key1.Public())
+	require.NotEqual(t, key1.Public(), key2.Public())
+}
+
+func TestConsulCAProvider_PEMTrailingNewline(t *testing.T) {
+	t.Parallel()
+
+	rootCA := connect.TestCA(t, nil)
+	trimmed := strings.TrimRight(rootCA.RootCert, "\n")
+
+	cases := map[string]string{
+		"generated":        "",
+		"missing newline":  trimmed,
+		"extra newlines":   trimmed + "\n\n\n",
+		"windows newlines": trimmed + "\r\n",
+	}
+
+	for name, rootCert := range cases {
+		rootCert := rootCert
+		t.Run(name, func(t *testing.T) {
+			conf := testConsulCAConfig()
+			if rootCert != "" {
+				conf.Config["PrivateKey"] = rootCA.SigningKey
+				conf.Config["RootCert"] = rootCert
+			}
+			delegate := newMockDelegate(t, conf)
+			provider := TestConsulProvider(t, delegate)
+			require.NoError(t, provider.Configure(testProviderConfig(conf)))
+
+			root, err := provider.GenerateRoot()
+			require.NoError(t, err)
+			requireTrailingNewline(t, root.PEM)
+
+			inter, err := provider.ActiveIntermediate()
+			require.NoError(t, err)
+			requireTrailingNewline(t, inter)
+
+			spiffeService := &connect.SpiffeIDService{
+				Host:       connect.TestClusterID + ".consul",
+				Namespace:  "default",
+				Datacenter: "dc1",
+				Service:    "foo",
+			}
+			raw, _ := connect.TestCSR(t, spiffeService)
+			csr, err := connect.ParseCSR(raw)
+			require.NoError(t, err)
+
+			leaf, err := provider.Sign(context.Background(), csr)
+			require.NoError(t, err)
+			requireTrailingNewline(t, leaf)
+		})
+	}
+}
+
 func TestConsulCAProvider_SignLeaf(t *testing.T) {
 	if testing.Short() {
 		t.Skip("too slow for testing.Short")
@@ -158,8 +408,16 @@ func TestConsulCAProvider_SignLeaf(t *testing.T) {
 
 			provider := TestConsulProvider(t, delegate)
 			require.NoError(t, provider.Configure(testProviderConfig(conf)))
-			_, err := provider.GenerateRoot()
+			root, err := provider.GenerateRoot()
+			require.NoError(t, err)
+
+			// The root has a key of the configured type.
+			rootCert, err := connect.ParseCert(root.PEM)
+			require.NoError(t, err)
+			keyType, keyBits, err := connect.KeyInfoFromCert(rootCert)
 			require.NoError(t, err)
+			require.Equal(t, tc.KeyType, keyType)
+			require.Equal(t, tc.KeyBits, keyBits)
 
 			spiffeService := &connect.SpiffeIDService{
 				Host:       connect.TestClusterID + ".consul",
@@ -175,7 +433,7 @@ func TestConsulCAProvider_SignLeaf(t *testing.T) {
 				csr, err := connect.ParseCSR(raw)
 				require.NoError(t, err)
 
-				cert, err := provider.Sign(csr)
+				cert, err := provider.Sign(context.Background(), csr)
 				require.NoError(t, err)
 				requireTrailingNewline(t, cert)
 				parsed, err := connect.ParseCert(cert)
@@ -204,7 +462,7 @@ func TestConsulCAProvider_SignLeaf(t *testing.T) {
 				csr, err := connect.ParseCSR(raw)
 				require.NoError(t, err)
 
-				cert, err := provider.Sign(csr)
+				cert, err := provider.Sign(context.Background(), csr)
 				require.NoError(t, err)
 
 				parsed, err := connect.ParseCert(cert)
@@ -232,7 +490,7 @@ func TestConsulCAProvider_SignLeaf(t *testing.T) {
 				csr, err := connect.ParseCSR(raw)
 				require.NoError(t, err)
 
-				cert, err := provider.Sign(csr)
+				cert, err := provider.Sign(context.Background(), csr)
 				require.NoError(t, err)
 
 				parsed, err := connect.ParseCert(cert)
@@ -252,6 +510,389 @@ func TestConsulCAProvider_SignLeaf(t *testing.T) {
 	}
 }
 
+func TestConsulCAProvider_SignLeaf_ClampedToSigningCert(t *testing.T) {
+	t.Parallel()
+
+	// The root expires well before the configured leaf TTL.
+	rootCA := connect.TestCAWithTTL(t, nil, 2*time.Hour)
+	conf := testConsulCAConfig()
+	conf.Config = map[string]interface{}{
+		"PrivateKey":  rootCA.SigningKey,
+		"RootCert":    rootCA.RootCert,
+		"LeafCertTTL": "72h",
+	}
+	delegate := newMockDelegate(t, conf)
+
+	provider := TestConsulProvider(t, delegate)
+	require.NoError(t, provider.Configure(testProviderConfig(conf)))
+	_, err := provider.GenerateRoot()
+	require.NoError(t, err)
+
+	raw, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "foo"))
+	csr, err := connect.ParseCSR(raw)
+	require.NoError(t, err)
+
+	cert, err := provider.Sign(context.Background(), csr)
+	require.NoError(t, err)
+	parsed, err := connect.ParseCert(cert)
+	require.NoError(t, err)
+
+	root, err := connect.ParseCert(rootCA.RootCert)
+	require.NoError(t, err)
+	require.Equal(t, root.NotAfter.Add(-CertificateTimeDriftBuffer), parsed.NotAfter)
+}
+
+func TestConsulCAProvider_SignLeaf_TimeDriftBuffer(t *testing.T) {
+	// No parallel execution because we change CertificateTimeDriftBuffer.
+	origDriftBuffer := CertificateTimeDriftBuffer
+	t.Cleanup(func() { CertificateTimeDriftBuffer = origDriftBuffer })
+	CertificateTimeDriftBuffer = 5 * time.Minute
+
+	conf := testConsulCAConfig()
+	delegate := newMockDelegate(t, conf)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	provider := NewConsulProviderWithDeps(delegate, hclog.NewNullLogger(), ProviderDeps{
+		Clock:      func() time.Time { return now },
+		PrivateKey: TestFastKeys(),
+	})
+	require.NoError(t, provider.Configure(testProviderConfig(conf)))
+	_, err := provider.GenerateRoot()
+	require.NoError(t, err)
+
+	raw, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "foo"))
+	csr, err := connect.ParseCSR(raw)
+	require.NoError(t, err)
+
+	cert, err := provider.Sign(context.Background(), csr)
+	require.NoError(t, err)
+	parsed, err := connect.ParseCert(cert)
+	require.NoError(t, err)
+
+	// The leaf is backdated by the buffer, and its TTL counts from there.
+	require.Equal(t, now.Add(-5*time.Minute), parsed.NotBefore)
+	require.Equal(t, now.Add(-5*time.Minute).Add(72*time.Hour), parsed.NotAfter)
+}
+
+func TestConsulCAProvider_VerifySigningKey(t *testing.T) {
+	t.Parallel()
+
+	conf := testConsulCAConfig()
+	delegate := newMockDelegate(t, conf)
+	provider := TestConsulProvider(t, delegate)
+	require.NoError(t, provider.Configure(testProviderConfig(conf)))
+	_, err := provider.GenerateRoot()
+	require.NoError(t, err)
+
+	raw, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "foo"))
+	csr, err := connect.ParseCSR(raw)
+	require.NoError(t, err)
+	sign := func() *x509.Certificate {
+		t.Helper()
+		certPEM, err := provider.Sign(context.Background(), csr)
+		require.NoError(t, err)
+		cert, err := connect.ParseCert(certPEM)
+		require.NoError(t, err)
+		return cert
+	}
+
+	// Verifying doesn't issue a certificate, so it doesn't take a serial
+	// number.
+	before := sign()
+	require.NoError(t, provider.VerifySigningKey(context.Background()))
+	after := sign()
+	require.Equal(t, before.SerialNumber.Int64()+1, after.SerialNumber.Int64())
+
+	// A private key that doesn't belong to the active intermediate is
+	// reported.
+	_, providerState, err := delegate.state.CAProviderState(provider.id)
+	require.NoError(t, err)
+	_, otherKey, err := connect.GeneratePrivateKey()
+	require.NoError(t, err)
+	newState := *providerState
+	newState.PrivateKey = otherKey
+	_, err = delegate.ApplyCARequest(&structs.CARequest{
+		Op:            structs.CAOpSetProviderState,
+		ProviderState: &newState,
+	})
+	require.NoError(t, err)
+	err = provider.VerifySigningKey(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "intermediate cert is for a different private key")
+}
+
+func TestConsulCAProvider_SignLeaf_AuthorityKeyID(t *testing.T) {
+	t.Parallel()
+
+	conf := testConsulCAConfig()
+	delegate := newMockDelegate(t, conf)
+	provider := TestConsulProvider(t, delegate)
+	cfg := testProviderConfig(conf)
+	cfg.IsPrimary = false
+	cfg.Datacenter = "dc2"
+	require.NoError(t, provider.Configure(cfg))
+
+	csrPEM, err := provider.GenerateIntermediateCSR()
+	require.NoError(t, err)
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+
+	// Issue two intermediates for the key of the provider, as when one is
+	// cross-signed, which only differ by their subject key ID.
+	rootCA := connect.TestCA(t, nil)
+	rootCert, err := connect.ParseCert(rootCA.RootCert)
+	require.NoError(t, err)
+	rootSigner, err := connect.ParseSigner(rootCA.SigningKey)
+	require.NoError(t, err)
+	issue := func(serial int64, subjectKeyID []byte) (string, *x509.Certificate) {
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: "Test Intermediate"},
+			URIs:                  csr.URIs,
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+			NotBefore:             time.Now().Add(-time.Minute),
+			NotAfter:              time.Now().Add(24 * time.Hour),
+			SubjectKeyId:          subjectKeyID,
+		}
+		bs, err := x509.CreateCertificate(rand.Reader, template, rootCert, csr.PublicKey, rootSigner)
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(bs)
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: bs})), cert
+	}
+	keyID, err := connect.KeyId(csr.PublicKey)
+	require.NoError(t, err)
+	_, other := issue(2, keyID)
+	selectedPEM, selected := issue(3, []byte("selected-intermediate"))
+	require.NoError(t, provider.SetIntermediate(selectedPEM, rootCA.RootCert))
+
+	raw, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "foo"))
+	leafCSR, err := connect.ParseCSR(raw)
+	require.NoError(t, err)
+
+	leafPEM, err := provider.SignWithParams(leafCSR, LeafSignParams{AuthorityKeyID: selected.SubjectKeyId})
+	require.NoError(t, err)
+	leaf, err := connect.ParseCert(leafPEM)
+	require.NoError(t, err)
+	require.Equal(t, selected.SubjectKeyId, leaf.AuthorityKeyId)
+
+	// The path is built through the selected intermediate.
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(other)
+	intermediates.AddCert(selected)
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCert)
+	chains, err := leaf.Verify(x509.VerifyOptions{Intermediates: intermediates, Roots: roots})
+	require.NoError(t, err)
+	require.Equal(t, selected.Raw, chains[0][1].Raw)
+
+	// The provider refuses to sign for another intermediate than its own.
+	_, err = provider.SignWithParams(leafCSR, LeafSignParams{AuthorityKeyID: other.SubjectKeyId})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "must be signed by the certificate with key ID")
+}
+
+func TestConsulCAProvider_SignLeaf_CSRExtensionPolicy(t *testing.T) {
+	t.Parallel()
+
+	customOID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+
+	// testCSR returns a CSR for a service which also requests a DNS SAN, a
+	// CA basic constraint and a custom extension.
+	testCSR := func(t *testing.T) *x509.CertificateRequest {
+		signer, _, err := connect.GeneratePrivateKey()
+		require.NoError(t, err)
+
+		basicConstraints, err := asn1.Marshal(struct {
+			IsCA bool `asn1:"optional"`
+		}{IsCA: true})
+		require.NoError(t, err)
+
+		raw, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			URIs:     []*url.URL{connect.TestSpiffeIDService(t, "foo").URI()},
+			DNSNames: []string{"foo.example.com"},
+			ExtraExtensions: []pkix.Extension{
+				{Id: asn1.ObjectIdentifier{2, 5, 29, 19}, Critical: true, Value: basicConstraints},
+				{Id: customOID, Value: []byte{0x05, 0x00}},
+			},
+		}, signer)
+		require.NoError(t, err)
+
+		csr, err := x509.ParseCertificateRequest(raw)
+		require.NoError(t, err)
+		return csr
+	}
+
+	testProvider := func(t *testing.T, config map[string]interface{}) *ConsulProvider {
+		conf := testConsulCAConfig()
+		for k, v := range config {
+			conf.Config[k] = v
+		}
+		delegate := newMockDelegate(t, conf)
+
+		provider := TestConsulProvider(t, delegate)
+		require.NoError(t, provider.Configure(testProviderConfig(conf)))
+		_, err := provider.GenerateRoot()
+		require.NoError(t, err)
+		return provider
+	}
+
+	hasExtension := func(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(oid) {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.Run("ignore", func(t *testing.T) {
+		provider := testProvider(t, map[string]interface{}{
+			"CSRExtensionPolicy": structs.CSRExtensionPolicyIgnore,
+		})
+
+		cert, err := provider.Sign(context.Background(), testCSR(t))
+		require.NoError(t, err)
+		parsed, err := connect.ParseCert(cert)
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"foo.example.com"}, parsed.DNSNames)
+		require.False(t, parsed.IsCA)
+		require.False(t, hasExtension(parsed, customOID))
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		provider := testProvider(t, map[string]interface{}{
+			"CSRExtensionPolicy": structs.CSRExtensionPolicyReject,
+		})
+
+		_, err := provider.Sign(context.Background(), testCSR(t))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "CSR requests")
+
+		// A CSR with only a SPIFFE ID is still signed.
+		raw, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "foo"))
+		csr, err := connect.ParseCSR(raw)
+		require.NoError(t, err)
+		_, err = provider.Sign(context.Background(), csr)
+		require.NoError(t, err)
+	})
+
+	t.Run("passthrough-allowlisted", func(t *testing.T) {
+		provider := testProvider(t, map[string]interface{}{
+			"CSRExtensionPolicy":    structs.CSRExtensionPolicyPassthroughAllowlisted,
+			"CSRExtensionAllowlist": []string{customOID.String()},
+		})
+
+		cert, err := provider.Sign(context.Background(), testCSR(t))
+		require.NoError(t, err)
+		parsed, err := connect.ParseCert(cert)
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"foo.example.com"}, parsed.DNSNames)
+		require.False(t, parsed.IsCA)
+		require.True(t, hasExtension(parsed, customOID))
+	})
+}
+
+func TestConsulCAProvider_CRLSigner(t *testing.T) {
+	t.Parallel()
+
+	conf := testConsulCAConfig()
+	conf.Config["CRLSignerEnabled"] = true
+	delegate := newMockDelegate(t, conf)
+
+	provider := TestConsulProvider(t, delegate)
+	require.NoError(t, provider.Configure(testProviderConfig(conf)))
+	rootResult, err := provider.GenerateRoot()
+	require.NoError(t, err)
+	root, err := connect.ParseCert(rootResult.PEM)
+	require.NoError(t, err)
+
+	now := time.Now()
+	revoked := []pkix.RevokedCertificate{{SerialNumber: big.NewInt(42), RevocationTime: now}}
+	crlPEM, err := provider.SignCRL(revoked, now, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	providerState, err := delegate.ProviderState(provider.id)
+	require.NoError(t, err)
+	signerPEM := providerState.CRLSignerCert
+	signer, err := connect.ParseCert(signerPEM)
+	require.NoError(t, err)
+	require.NotEqual(t, root.Raw, signer.Raw)
+	require.False(t, signer.IsCA)
+	require.NotZero(t, signer.KeyUsage&x509.KeyUsageCRLSign)
+
+	// The signer chains to the active root.
+	pool := x509.NewCertPool()
+	pool.AddCert(root)
+	_, err = signer.Verify(x509.VerifyOptions{
+		Roots:     pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	})
+	require.NoError(t, err)
+
+	// The CRL is signed by the signer rather than the root, and has the
+	// issuer name of the leaf certificates it covers.
+	block, _ := pem.Decode([]byte(crlPEM))
+	require.NotNil(t, block)
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	require.NoError(t, err)
+	// RevocationList.CheckSignatureFrom only accepts CA certificates, the
+	// signer isn't one.
+	require.NoError(t, signer.CheckSignature(crl.SignatureAlgorithm, crl.RawTBSRevocationList, crl.Signature))
+	require.Error(t, crl.CheckSignatureFrom(root))
+	require.Equal(t, root.RawSubject, crl.RawIssuer)
+	require.Equal(t, signer.SubjectKeyId, crl.AuthorityKeyId)
+	require.Len(t, crl.RevokedCertificateEntries, 1)
+	require.Equal(t, big.NewInt(42), crl.RevokedCertificateEntries[0].SerialNumber)
+
+	// OCSP responses are signed by the same signer, which is reused.
+	raw, err := provider.SignOCSPResponse(ocsp.Response{
+		Status:       ocsp.Revoked,
+		SerialNumber: big.NewInt(42),
+		RevokedAt:    now,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	resp, err := ocsp.ParseResponse(raw, root)
+	require.NoError(t, err)
+	require.Equal(t, ocsp.Revoked, resp.Status)
+	require.Equal(t, signer.Raw, resp.Certificate.Raw)
+
+	providerState, err = delegate.ProviderState(provider.id)
+	require.NoError(t, err)
+	require.Equal(t, signerPEM, providerState.CRLSignerCert)
+
+	t.Run("disabled", func(t *testing.T) {
+		conf := testConsulCAConfig()
+		delegate := newMockDelegate(t, conf)
+
+		provider := TestConsulProvider(t, delegate)
+		require.NoError(t, provider.Configure(testProviderConfig(conf)))
+		rootResult, err := provider.GenerateRoot()
+		require.NoError(t, err)
+		root, err := connect.ParseCert(rootResult.PEM)
+		require.NoError(t, err)
+
+		crlPEM, err := provider.SignCRL(nil, now, now.Add(time.Hour))
+		require.NoError(t, err)
+		block, _ := pem.Decode([]byte(crlPEM))
+		require.NotNil(t, block)
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		require.NoError(t, err)
+		require.NoError(t, crl.CheckSignatureFrom(root))
+		require.Equal(t, root.RawSubject, crl.RawIssuer)
+
+		providerState, err := delegate.ProviderState(provider.id)
+		require.NoError(t, err)
+		require.Empty(t, providerState.CRLSignerCert)
+	})
+}
+
 func TestConsulCAProvider_CrossSignCA(t *testing.T) {
 	if testing.Short() {
 		t.Skip("too slow for testing.Short")
@@ -309,7 +950,7 @@ func testCrossSignProviders(t *testing.T, provider1, provider2 Provider) {
 	requireNotEncoded(t, newIntermediate.AuthorityKeyId)
 
 	// Have provider1 cross sign our new root cert.
-	xcPEM, err := provider1.CrossSignCA(newRoot)
+	xcPEM, err := provider1.CrossSignCA(context.Background(), newRoot)
 	require.NoError(t, err)
 	xc, err := connect.ParseCert(xcPEM)
 	require.NoError(t, err)
@@ -349,7 +990,7 @@ func testCrossSignProviders(t *testing.T, provider1, provider2 Provider) {
 	leafCsr, err := connect.ParseCSR(raw)
 	require.NoError(t, err)
 
-	leafPEM, err := provider2.Sign(leafCsr)
+	leafPEM, err := provider2.Sign(context.Background(), leafCsr)
 	require.NoError(t, err)
 
 	cert, err := connect.ParseCert(leafPEM)
@@ -414,6 +1055,85 @@ func TestConsulProvider_SignIntermediate(t *testing.T) {
 
 }
 
+func TestConsulProvider_GenerateIntermediateCSR_Subject(t *testing.T) {
+	conf1 := testConsulCAConfig()
+	delegate1 := newMockDelegate(t, conf1)
+	provider1 := TestConsulProvider(t, delegate1)
+	require.NoError(t, provider1.Configure(testProviderConfig(conf1)))
+	_, err := provider1.GenerateRoot()
+	require.NoError(t, err)
+
+	conf2 := testConsulCAConfig()
+	conf2.CreateIndex = 10
+	conf2.Config["IntermediateCertSubject"] = map[string]interface{}{
+		"Country":            "US",
+		"Organization":       []string{"Example, Inc."},
+		"OrganizationalUnit": []string{"Platform", "Service Mesh"},
+	}
+	delegate2 := newMockDelegate(t, conf2)
+	provider2 := TestConsulProvider(t, delegate2)
+	cfg := testProviderConfig(conf2)
+	cfg.IsPrimary = false
+	cfg.Datacenter = "dc2"
+	require.NoError(t, provider2.Configure(cfg))
+
+	csrPEM, err := provider2.GenerateIntermediateCSR()
+	require.NoError(t, err)
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"US"}, csr.Subject.Country)
+	require.Equal(t, []string{"Example, Inc."}, csr.Subject.Organization)
+	require.Equal(t, []string{"Platform", "Service Mesh"}, csr.Subject.OrganizationalUnit)
+	require.Len(t, csr.URIs, 1)
+
+	// The intermediate signed from the CSR keeps the configured subject.
+	intermediatePEM, err := provider1.SignIntermediate(context.Background(), csr)
+	require.NoError(t, err)
+	intermediate, err := connect.ParseCert(intermediatePEM)
+	require.NoError(t, err)
+	require.Equal(t, csr.Subject.Organization, intermediate.Subject.Organization)
+	require.Equal(t, csr.Subject.OrganizationalUnit, intermediate.Subject.OrganizationalUnit)
+}
+
+func TestConsulProvider_GenerateIntermediateCSR_SignatureAlgorithm(t *testing.T) {
+	tests := []struct {
+		keyType  string
+		keyBits  int
+		algo     string
+		expected x509.SignatureAlgorithm
+	}{
+		{"ec", 256, "", x509.ECDSAWithSHA256},
+		{"ec", 384, "ECDSAWithSHA512", x509.ECDSAWithSHA512},
+		{"rsa", 2048, "", x509.SHA256WithRSA},
+		{"rsa", 2048, "SHA384WithRSA", x509.SHA384WithRSA},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("%s-%d-%s", tc.keyType, tc.keyBits, tc.algo), func(t *testing.T) {
+			conf := testConsulCAConfig()
+			conf.Config["PrivateKeyType"] = tc.keyType
+			conf.Config["PrivateKeyBits"] = tc.keyBits
+			if tc.algo != "" {
+				conf.Config["IntermediateCSRSignatureAlgorithm"] = tc.algo
+			}
+			delegate := newMockDelegate(t, conf)
+			provider := TestConsulProvider(t, delegate)
+			cfg := testProviderConfig(conf)
+			cfg.IsPrimary = false
+			cfg.Datacenter = "dc2"
+			require.NoError(t, provider.Configure(cfg))
+
+			csrPEM, err := provider.GenerateIntermediateCSR()
+			require.NoError(t, err)
+			csr, err := connect.ParseCSR(csrPEM)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, csr.SignatureAlgorithm)
+			require.NoError(t, csr.CheckSignature())
+		})
+	}
+}
+
 func testSignIntermediateCrossDC(t *testing.T, provider1, provider2 Provider) {
 
 	// Get the intermediate CSR from provider2.
@@ -423,7 +1143,7 @@ func testSignIntermediateCrossDC(t *testing.T, provider1, provider2 Provider) {
 	require.NoError(t, err)
 
 	// Sign the CSR with provider1.
-	intermediatePEM, err := provider1.SignIntermediate(csr)
+	intermediatePEM, err := provider1.SignIntermediate(context.Background(), csr)
 	require.NoError(t, err)
 	root, err := provider1.GenerateRoot()
 	require.NoError(t, err)
@@ -444,7 +1164,7 @@ func testSignIntermediateCrossDC(t *testing.T, provider1, provider2 Provider) {
 	leafCsr, err := connect.ParseCSR(raw)
 	require.NoError(t, err)
 
-	leafPEM, err := provider2.Sign(leafCsr)
+	leafPEM, err := provider2.Sign(context.Background(), leafCsr)
 	require.NoError(t, err)
 
 	cert, err := connect.ParseCert(leafPEM)
@@ -198,3 +198,26 @@ func TestStructs_CAConfiguration_MsgpackEncodeDecode(t *testing.T) {
 		})
 	}
 }
+
+func TestProvider_KeyStorageLocation(t *testing.T) {
+	conf := testConsulCAConfig()
+	delegate := newMockDelegate(t, conf)
+	consulProvider := TestConsulProvider(t, delegate)
+	require.NoError(t, consulProvider.Configure(testProviderConfig(conf)))
+
+	cases := map[string]struct {
+		provider Provider
+		expected KeyLocation
+	}{
+		"consul": {provider: consulProvider, expected: KeyLocationConsulState},
+		"vault":  {provider: &VaultProvider{}, expected: KeyLocationExternal},
+		"aws":    {provider: &AWSProvider{}, expected: KeyLocationHSM},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			location, err := tc.provider.KeyStorageLocation()
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, location)
+		})
+	}
+}
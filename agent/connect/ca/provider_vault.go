@@ -5,14 +5,17 @@ import (
 	"context"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-version"
 	vaultapi "github.com/hashicorp/vault/api"
 	"github.com/mitchellh/mapstructure"
 
@@ -45,6 +48,10 @@ const (
 	defaultK8SServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
 )
 
+// VaultProviderVersion is the version of the configuration and state the vault
+// provider expects, see VersionedProvider.
+const VaultProviderVersion = 1
+
 var ErrBackendNotMounted = fmt.Errorf("backend not mounted")
 var ErrBackendNotInitialized = fmt.Errorf("backend not initialized")
 
@@ -59,12 +66,44 @@ type VaultProvider struct {
 	spiffeID                     *connect.SpiffeIDSigning
 	setupIntermediatePKIPathDone bool
 	logger                       hclog.Logger
+	deps                         ProviderDeps
+
+	// leafSigner signs leaf certificates locally when DelegatedLeafSigning is
+	// enabled. It is nil otherwise.
+	leafSigner *delegatedLeafSigner
+
+	// intermediateLock guards intermediate, the parsed active intermediate
+	// that leaf certificates are clamped to. It is kept so that signing a leaf
+	// doesn't take another round trip to Vault, and dropped whenever the
+	// intermediate changes.
+	intermediateLock sync.Mutex
+	intermediate     *x509.Certificate
+
+	// setupSSHPKIPathLock serializes the setup of the SSH secrets engine and
+	// guards setupSSHPKIPathDone, since SSH certificates are signed
+	// concurrently.
+	setupSSHPKIPathLock sync.Mutex
+	setupSSHPKIPathDone bool
+
+	// rootLeafSigningLock guards rootLeafSigningRoot, the parsed root that
+	// leaf certificates signed with the root are clamped to. It is set once
+	// the leaf cert role was written on the root PKI backend, see
+	// setupRootLeafSigning.
+	rootLeafSigningLock sync.Mutex
+	rootLeafSigningRoot *x509.Certificate
 }
 
 func NewVaultProvider(logger hclog.Logger) *VaultProvider {
+	return NewVaultProviderWithDeps(logger, ProviderDeps{})
+}
+
+// NewVaultProviderWithDeps returns a new VaultProvider that uses the given
+// dependencies.
+func NewVaultProviderWithDeps(logger hclog.Logger, deps ProviderDeps) *VaultProvider {
 	return &VaultProvider{
 		shutdown: func() {},
 		logger:   logger,
+		deps:     deps,
 	}
 }
 
@@ -86,40 +125,42 @@ func (v *VaultProvider) Configure(cfg ProviderConfig) error {
 		return err
 	}
 
-	clientConf := &vaultapi.Config{
-		Address: config.Address,
-	}
-	err = clientConf.ConfigureTLS(vaultTLSConfig(config))
+	client, err := v.vaultClient(config)
 	if err != nil {
 		return err
 	}
-	client, err := vaultapi.NewClient(clientConf)
-	if err != nil {
+	if err := checkVaultKeyType(client, config.PrivateKeyType); err != nil {
 		return err
 	}
-
-	if config.AuthMethod != nil {
-		loginResp, err := vaultLogin(client, config.AuthMethod)
-		if err != nil {
-			return err
-		}
-		config.Token = loginResp.Auth.ClientToken
-	}
-	client.SetToken(config.Token)
-
-	// We don't want to set the namespace if it's empty to prevent potential
-	// unknown behavior (what does Vault do with an empty namespace). The Vault
-	// client also makes sure the inputs are not empty strings so let's do the
-	// same.
-	if config.Namespace != "" {
-		client.SetNamespace(config.Namespace)
-	}
 	v.config = config
 	v.client = client
 	v.isPrimary = cfg.IsPrimary
+	// Set the SSH secrets engine up again so that the signing role follows
+	// the new configuration.
+	v.setupSSHPKIPathLock.Lock()
+	v.setupSSHPKIPathDone = false
+	v.setupSSHPKIPathLock.Unlock()
+	v.rootLeafSigningLock.Lock()
+	v.rootLeafSigningRoot = nil
+	v.rootLeafSigningLock.Unlock()
 	v.clusterID = cfg.ClusterID
 	v.spiffeID = connect.SpiffeIDSigningForCluster(v.clusterID)
 
+	v.leafSigner = nil
+	if config.DelegatedLeafSigning {
+		v.leafSigner = &delegatedLeafSigner{
+			logger:             v.logger,
+			clusterID:          v.clusterID,
+			isPrimary:          v.isPrimary,
+			spiffeID:           v.spiffeID,
+			leafCertTTL:        config.LeafCertTTL,
+			keyType:            config.PrivateKeyType,
+			keyBits:            config.PrivateKeyBits,
+			activeIntermediate: v.ActiveIntermediate,
+			signIntermediate:   v.signSubIntermediate,
+		}
+	}
+
 	// Look up the token to see if we can auto-renew its lease.
 	secret, err := client.Auth().Token().LookupSelf()
 	if err != nil {
@@ -160,6 +201,119 @@ func (v *VaultProvider) Configure(cfg ProviderConfig) error {
 	return nil
 }
 
+// vaultClient returns a client for the Vault server of config. When config
+// has an AuthMethod, the client is logged in with it and config.Token is set
+// to the token it got.
+func (v *VaultProvider) vaultClient(config *structs.VaultCAProviderConfig) (*vaultapi.Client, error) {
+	clientConf := &vaultapi.Config{
+		Address: config.Address,
+	}
+	if v.deps.HTTPClient != nil {
+		clientConf.HttpClient = v.deps.HTTPClient()
+	} else {
+		if err := clientConf.ConfigureTLS(vaultTLSConfig(config)); err != nil {
+			return nil, err
+		}
+	}
+	client, err := vaultapi.NewClient(clientConf)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.AuthMethod != nil {
+		loginResp, err := vaultLogin(client, config.AuthMethod)
+		if err != nil {
+			return nil, err
+		}
+		config.Token = loginResp.Auth.ClientToken
+	}
+	client.SetToken(config.Token)
+
+	// We don't want to set the namespace if it's empty to prevent potential
+	// unknown behavior (what does Vault do with an empty namespace). The Vault
+	// client also makes sure the inputs are not empty strings so let's do the
+	// same.
+	if config.Namespace != "" {
+		client.SetNamespace(config.Namespace)
+	}
+	return client, nil
+}
+
+// TestConnection checks that Vault can be used with the configuration of cfg
+// without changing anything in it: the token is looked up, and the PKI mounts
+// which already exist must be PKI mounts whose configuration it can read.
+// Mounts which don't exist yet are created by Configure. Logging in with an
+// AuthMethod issues a token, the only write to Vault.
+func (v *VaultProvider) TestConnection(cfg ProviderConfig) error {
+	config, err := ParseVaultCAConfig(cfg.RawConfig)
+	if err != nil {
+		return err
+	}
+
+	client, err := v.vaultClient(config)
+	if err != nil {
+		return fmt.Errorf("error connecting to Vault: %w", err)
+	}
+	secret, err := client.Auth().Token().LookupSelf()
+	if err != nil {
+		return fmt.Errorf("error looking up the Vault provider token: %w", err)
+	} else if secret == nil {
+		return fmt.Errorf("could not look up Vault provider token: not found")
+	}
+	if err := checkVaultKeyType(client, config.PrivateKeyType); err != nil {
+		return err
+	}
+
+	mounts, err := client.Sys().ListMounts()
+	if err != nil {
+		return fmt.Errorf("error listing the Vault mounts: %w", err)
+	}
+	paths := []string{config.IntermediatePKIPath}
+	// Secondary datacenters don't use the root PKI mount.
+	if cfg.IsPrimary {
+		paths = append([]string{config.RootPKIPath}, paths...)
+	}
+	for _, path := range paths {
+		mount, ok := mounts[path]
+		if !ok {
+			continue
+		}
+		if mount.Type != "pki" {
+			return fmt.Errorf("mount %q is a %s mount, not a pki mount", path, mount.Type)
+		}
+		if _, err := client.Sys().MountConfig(path); err != nil {
+			return fmt.Errorf("error reading the configuration of mount %q: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// vaultMinEd25519Version is the first Vault version whose PKI secrets engine
+// supports Ed25519 keys.
+var vaultMinEd25519Version = version.Must(version.NewVersion("1.9.0"))
+
+// checkVaultKeyType returns an error if the PKI secrets engine of the Vault
+// server of client doesn't support keys of keyType. The PKI secrets engine is
+// built into Vault, so its version is that of the server.
+func checkVaultKeyType(client *vaultapi.Client, keyType string) error {
+	if keyType != "ed25519" {
+		return nil
+	}
+	health, err := client.Sys().Health()
+	if err != nil {
+		return fmt.Errorf("error reading the Vault server version: %w", err)
+	}
+	serverVersion, err := version.NewVersion(health.Version)
+	if err != nil {
+		return fmt.Errorf("error parsing the Vault server version %q: %w", health.Version, err)
+	}
+	if serverVersion.LessThan(vaultMinEd25519Version) {
+		return fmt.Errorf("PrivateKeyType %q requires Vault %s or later, whose PKI secrets engine supports Ed25519 keys, "+
+			"but the Vault server version is %s", keyType, vaultMinEd25519Version, serverVersion)
+	}
+	return nil
+}
+
 func (v *VaultProvider) ValidateConfigUpdate(prevRaw, nextRaw map[string]interface{}) error {
 	prev, err := ParseVaultCAConfig(prevRaw)
 	if err != nil {
@@ -311,7 +465,45 @@ func (v *VaultProvider) GenerateRoot() (RootResult, error) {
 		rootChain = rootPEM
 	}
 
-	return RootResult{PEM: rootChain}, nil
+	return RootResult{PEM: EnsureTrailingNewline(rootChain)}, nil
+}
+
+// TTLLimits implements TTLLimiter. Vault caps the TTL of the certificates a
+// PKI backend issues to the max lease TTL of its mount, so intermediates are
+// limited by the root PKI mount and leaves by the intermediate PKI mount.
+// Mounts that don't exist yet are created by Consul with the configured TTLs,
+// so they don't limit anything.
+func (v *VaultProvider) TTLLimits() (time.Duration, time.Duration, error) {
+	mounts, err := v.client.Sys().ListMounts()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	mountMaxTTL := func(path string) (time.Duration, error) {
+		if _, ok := mounts[path]; !ok {
+			return 0, nil
+		}
+		// Read the tuned configuration rather than the one listed with the
+		// mounts, as it resolves the system default when the mount has none.
+		cfg, err := v.client.Sys().MountConfig(path)
+		if err != nil {
+			return 0, fmt.Errorf("error reading the configuration of mount %q: %w", path, err)
+		}
+		return time.Duration(cfg.MaxLeaseTTL) * time.Second, nil
+	}
+
+	var maxIntermediate time.Duration
+	// Secondary intermediates are signed by the primary datacenter.
+	if v.isPrimary {
+		if maxIntermediate, err = mountMaxTTL(v.config.RootPKIPath); err != nil {
+			return 0, 0, err
+		}
+	}
+	maxLeaf, err := mountMaxTTL(v.config.IntermediatePKIPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	return maxIntermediate, maxLeaf, nil
 }
 
 // GenerateIntermediateCSR creates a private key and generates a CSR
@@ -323,7 +515,11 @@ func (v *VaultProvider) GenerateIntermediateCSR() (string, error) {
 			"cannot generate an intermediate CSR")
 	}
 
-	return v.generateIntermediateCSR()
+	csr, err := v.generateIntermediateCSR()
+	if err != nil {
+		return "", err
+	}
+	return EnsureTrailingNewline(csr), nil
 }
 
 func (v *VaultProvider) setupIntermediatePKIPath() error {
@@ -357,14 +553,7 @@ func (v *VaultProvider) setupIntermediatePKIPath() error {
 		return err
 	}
 	if role == nil {
-		_, err := v.client.Logical().Write(rolePath, map[string]interface{}{
-			"allow_any_name":   true,
-			"allowed_uri_sans": "spiffe://*",
-			"key_type":         "any",
-			"max_ttl":          v.config.LeafCertTTL.String(),
-			"no_store":         true,
-			"require_cn":       false,
-		})
+		_, err := v.client.Logical().Write(rolePath, leafCertRoleData(v.config))
 		if err != nil {
 			return err
 		}
@@ -373,6 +562,19 @@ func (v *VaultProvider) setupIntermediatePKIPath() error {
 	return nil
 }
 
+// leafCertRoleData is the VaultCALeafCertRole role leaf certificates are
+// signed with.
+func leafCertRoleData(config *structs.VaultCAProviderConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"allow_any_name":   true,
+		"allowed_uri_sans": "spiffe://*",
+		"key_type":         "any",
+		"max_ttl":          config.LeafCertTTL.String(),
+		"no_store":         true,
+		"require_cn":       false,
+	}
+}
+
 func (v *VaultProvider) generateIntermediateCSR() (string, error) {
 	err := v.setupIntermediatePKIPath()
 	if err != nil {
@@ -384,12 +586,25 @@ func (v *VaultProvider) generateIntermediateCSR() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	data, err := v.client.Logical().Write(v.config.IntermediatePKIPath+"intermediate/generate/internal", map[string]interface{}{
+	params := map[string]interface{}{
 		"common_name": connect.CACN("vault", uid, v.clusterID, v.isPrimary),
 		"key_type":    v.config.PrivateKeyType,
 		"key_bits":    v.config.PrivateKeyBits,
 		"uri_sans":    v.spiffeID.URI().String(),
-	})
+	}
+	if subject := v.config.IntermediateCertSubject; subject != nil {
+		params["country"] = subject.Country
+		params["organization"] = subject.Organization
+		params["ou"] = subject.OrganizationalUnit
+		params["locality"] = subject.Locality
+		params["province"] = subject.Province
+		params["street_address"] = subject.StreetAddress
+		params["postal_code"] = subject.PostalCode
+	}
+	if bits := v.config.IntermediateCSRSignatureBits(); bits != 0 {
+		params["signature_bits"] = bits
+	}
+	data, err := v.client.Logical().Write(v.config.IntermediatePKIPath+"intermediate/generate/internal", params)
 	if err != nil {
 		return "", err
 	}
@@ -422,6 +637,7 @@ func (v *VaultProvider) SetIntermediate(intermediatePEM, rootPEM string) error {
 	if err != nil {
 		return err
 	}
+	v.intermediateChanged()
 
 	return nil
 }
@@ -529,14 +745,44 @@ func (v *VaultProvider) GenerateIntermediate() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	v.intermediateChanged()
 
 	return v.ActiveIntermediate()
 }
 
+// Warm has Vault sign the sub-intermediate used for DelegatedLeafSigning, so
+// that the first leaf doesn't wait for it.
+func (v *VaultProvider) Warm(ctx context.Context) error {
+	if v.leafSigner == nil {
+		return nil
+	}
+	err := v.leafSigner.Warm(ctx)
+	if errors.Is(err, errSubIntermediateNotAllowed) {
+		// Leaves are signed by Vault, there is nothing to warm.
+		return nil
+	}
+	return err
+}
+
 // Sign calls the configured role in the intermediate PKI backend to issue
 // a new leaf certificate based on the provided CSR, with the issuing
 // intermediate CA cert attached.
-func (v *VaultProvider) Sign(csr *x509.CertificateRequest) (string, error) {
+//
+// When DelegatedLeafSigning is enabled the leaf is instead signed locally by a
+// sub-intermediate of the active intermediate, and the sub-intermediate is
+// returned after the leaf. If the active intermediate cannot sign a
+// sub-intermediate, leaves are signed by Vault as usual.
+func (v *VaultProvider) Sign(ctx context.Context, csr *x509.CertificateRequest) (string, error) {
+	if v.leafSigner != nil {
+		pem, err := v.leafSigner.Sign(ctx, csr)
+		if err == nil {
+			return pem, nil
+		}
+		if !errors.Is(err, errSubIntermediateNotAllowed) {
+			return "", err
+		}
+	}
+
 	connect.HackSANExtensionForCSR(csr)
 
 	var pemBuf bytes.Buffer
@@ -544,13 +790,18 @@ func (v *VaultProvider) Sign(csr *x509.CertificateRequest) (string, error) {
 		return "", err
 	}
 
+	ttl, err := v.leafCertTTL()
+	if err != nil {
+		return "", err
+	}
+
 	// Use the leaf cert role to sign a new cert for this CSR.
-	response, err := v.client.Logical().Write(v.config.IntermediatePKIPath+"sign/"+VaultCALeafCertRole, map[string]interface{}{
+	response, err := v.writeWithContext(ctx, v.config.IntermediatePKIPath+"sign/"+VaultCALeafCertRole, map[string]interface{}{
 		"csr": pemBuf.String(),
-		"ttl": v.config.LeafCertTTL.String(),
+		"ttl": ttl.String(),
 	})
 	if err != nil {
-		return "", fmt.Errorf("error issuing cert: %v", err)
+		return "", fmt.Errorf("error issuing cert: %w", err)
 	}
 	if response == nil || response.Data["certificate"] == "" || response.Data["issuing_ca"] == "" {
 		return "", fmt.Errorf("certificate info returned from Vault was blank")
@@ -563,9 +814,206 @@ func (v *VaultProvider) Sign(csr *x509.CertificateRequest) (string, error) {
 	return EnsureTrailingNewline(cert), nil
 }
 
+// SignLeafWithRoot signs a leaf certificate for the CSR with the root PKI
+// backend. It is only used when the intermediate expired because it could not
+// be renewed. It signs with the same role as Sign, which is written on the
+// root PKI backend the first time, so that the leaf certificate is no less
+// restricted than those Sign issues. Its TTL is the one Sign would request,
+// only ever shortened by the TTL and MaxTTL of params, and clamped to the
+// root. Vault doesn't take the other params, as with Sign.
+func (v *VaultProvider) SignLeafWithRoot(ctx context.Context, csr *x509.CertificateRequest, params LeafSignParams) (string, error) {
+	root, err := v.setupRootLeafSigning()
+	if err != nil {
+		return "", err
+	}
+
+	connect.HackSANExtensionForCSR(csr)
+
+	var pemBuf bytes.Buffer
+	if err := pem.Encode(&pemBuf, &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw}); err != nil {
+		return "", err
+	}
+
+	ttl := v.config.LeafCertTTL
+	if params.TTL > 0 && params.TTL < ttl {
+		ttl = params.TTL
+	}
+	if params.MaxTTL > 0 && params.MaxTTL < ttl {
+		ttl = params.MaxTTL
+	}
+	ttl, err = v.clampLeafTTL(ttl, root)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := v.writeWithContext(ctx, v.config.RootPKIPath+"sign/"+VaultCALeafCertRole, map[string]interface{}{
+		"csr": pemBuf.String(),
+		"ttl": ttl.String(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error issuing cert with the root: %w", err)
+	}
+	if response == nil || response.Data["certificate"] == "" {
+		return "", fmt.Errorf("certificate info returned from Vault was blank")
+	}
+
+	cert, ok := response.Data["certificate"].(string)
+	if !ok {
+		return "", fmt.Errorf("certificate was not a string")
+	}
+	return EnsureTrailingNewline(cert), nil
+}
+
+// setupRootLeafSigning writes the role Sign uses on the root PKI backend and
+// returns the parsed root, the first time a leaf certificate is signed with
+// the root since the provider was configured.
+func (v *VaultProvider) setupRootLeafSigning() (*x509.Certificate, error) {
+	v.rootLeafSigningLock.Lock()
+	defer v.rootLeafSigningLock.Unlock()
+
+	if v.rootLeafSigningRoot != nil {
+		return v.rootLeafSigningRoot, nil
+	}
+
+	rootPEM, err := v.getCA(v.config.RootPKIPath)
+	if err != nil {
+		return nil, err
+	}
+	root, err := connect.ParseCert(rootPEM)
+	if err != nil {
+		return nil, err
+	}
+	_, err = v.client.Logical().Write(v.config.RootPKIPath+"roles/"+VaultCALeafCertRole, leafCertRoleData(v.config))
+	if err != nil {
+		return nil, fmt.Errorf("error writing the leaf cert role on the root PKI path: %w", err)
+	}
+	v.rootLeafSigningRoot = root
+	return root, nil
+}
+
+// leafCertTTL returns the TTL to request for a new leaf certificate. It is the
+// configured LeafCertTTL unless that would outlive the active intermediate, in
+// which case it is shortened to end with the intermediate.
+func (v *VaultProvider) leafCertTTL() (time.Duration, error) {
+	intermediate, err := v.activeIntermediateCert()
+	if err != nil {
+		return 0, err
+	}
+	if intermediate == nil {
+		return v.config.LeafCertTTL, nil
+	}
+	return v.clampLeafTTL(v.config.LeafCertTTL, intermediate)
+}
+
+// clampLeafTTL returns ttl, shortened if a leaf certificate valid for it from
+// now would outlive signingCert, see clampLeafNotAfter.
+func (v *VaultProvider) clampLeafTTL(ttl time.Duration, signingCert *x509.Certificate) (time.Duration, error) {
+	now := time.Now()
+	notAfter, clamped := clampLeafNotAfter(now.Add(ttl), signingCert)
+	if !clamped {
+		return ttl, nil
+	}
+	clampedTTL := notAfter.Sub(now).Truncate(time.Second)
+	if clampedTTL <= 0 {
+		return 0, fmt.Errorf("signing cert expires at %s", signingCert.NotAfter)
+	}
+	v.logger.Warn("leaf certificate TTL clamped to the expiry of the signing certificate",
+		"leaf_cert_ttl", ttl,
+		"ttl", clampedTTL,
+	)
+	return clampedTTL, nil
+}
+
+// activeIntermediateCert returns the parsed active intermediate, only asking
+// Vault for it when it isn't cached yet. It returns nil when there is no
+// intermediate.
+func (v *VaultProvider) activeIntermediateCert() (*x509.Certificate, error) {
+	v.intermediateLock.Lock()
+	defer v.intermediateLock.Unlock()
+
+	if v.intermediate != nil {
+		return v.intermediate, nil
+	}
+
+	intermediatePEM, err := v.ActiveIntermediate()
+	if err != nil {
+		return nil, err
+	}
+	if intermediatePEM == "" {
+		return nil, nil
+	}
+	intermediate, err := connect.ParseCert(intermediatePEM)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing active intermediate cert: %v", err)
+	}
+	v.intermediate = intermediate
+	return intermediate, nil
+}
+
+// signSubIntermediate signs the sub-intermediate used for delegated leaf
+// signing with the intermediate PKI backend. The path length constraint of 0
+// prevents the sub-intermediate from issuing further CA certificates.
+func (v *VaultProvider) signSubIntermediate(ctx context.Context, csrPEM string, ttl time.Duration) (string, error) {
+	response, err := v.writeWithContext(ctx, v.config.IntermediatePKIPath+"root/sign-intermediate", map[string]interface{}{
+		"csr":             csrPEM,
+		"use_csr_values":  true,
+		"format":          "pem",
+		"max_path_length": 0,
+		"ttl":             ttl.String(),
+	})
+	if err != nil {
+		return "", err
+	}
+	if response == nil || response.Data["certificate"] == "" {
+		return "", fmt.Errorf("got empty value when signing sub-intermediate certificate")
+	}
+
+	cert, ok := response.Data["certificate"].(string)
+	if !ok {
+		return "", fmt.Errorf("certificate was not a string")
+	}
+	return EnsureTrailingNewline(cert), nil
+}
+
+// writeWithContext is like v.client.Logical().Write but gives up once ctx is
+// done, which this version of the Vault client only supports for raw
+// requests. The error of ctx is returned as is so that callers can tell it
+// from an error of Vault.
+func (v *VaultProvider) writeWithContext(ctx context.Context, path string, data map[string]interface{}) (*vaultapi.Secret, error) {
+	r := v.client.NewRequest("PUT", "/v1/"+path)
+	if err := r.SetJSONBody(data); err != nil {
+		return nil, err
+	}
+
+	resp, err := v.client.RawRequestWithContext(ctx, r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	return vaultapi.ParseSecret(resp.Body)
+}
+
+// intermediateChanged discards the cached active intermediate and the
+// sub-intermediate used for delegated leaf signing so that a new one is signed
+// by the new active intermediate.
+func (v *VaultProvider) intermediateChanged() {
+	v.intermediateLock.Lock()
+	v.intermediate = nil
+	v.intermediateLock.Unlock()
+
+	if v.leafSigner != nil {
+		v.leafSigner.Reset()
+	}
+}
+
 // SignIntermediate returns a signed CA certificate with a path length constraint
 // of 0 to ensure that the certificate cannot be used to generate further CA certs.
-func (v *VaultProvider) SignIntermediate(csr *x509.CertificateRequest) (string, error) {
+func (v *VaultProvider) SignIntermediate(ctx context.Context, csr *x509.CertificateRequest) (string, error) {
 	err := validateSignIntermediate(csr, v.spiffeID)
 	if err != nil {
 		return "", err
@@ -578,7 +1026,7 @@ func (v *VaultProvider) SignIntermediate(csr *x509.CertificateRequest) (string,
 	}
 
 	// Sign the CSR with the root backend.
-	data, err := v.client.Logical().Write(v.config.RootPKIPath+"root/sign-intermediate", map[string]interface{}{
+	data, err := v.writeWithContext(ctx, v.config.RootPKIPath+"root/sign-intermediate", map[string]interface{}{
 		"csr":             pemBuf.String(),
 		"use_csr_values":  true,
 		"format":          "pem_bundle",
@@ -602,7 +1050,7 @@ func (v *VaultProvider) SignIntermediate(csr *x509.CertificateRequest) (string,
 
 // CrossSignCA takes a CA certificate and cross-signs it to form a trust chain
 // back to our active root.
-func (v *VaultProvider) CrossSignCA(cert *x509.Certificate) (string, error) {
+func (v *VaultProvider) CrossSignCA(ctx context.Context, cert *x509.Certificate) (string, error) {
 	rootPEM, err := v.getCA(v.config.RootPKIPath)
 	if err != nil {
 		return "", err
@@ -622,11 +1070,11 @@ func (v *VaultProvider) CrossSignCA(cert *x509.Certificate) (string, error) {
 	}
 
 	// Have the root PKI backend sign this cert.
-	response, err := v.client.Logical().Write(v.config.RootPKIPath+"root/sign-self-issued", map[string]interface{}{
+	response, err := v.writeWithContext(ctx, v.config.RootPKIPath+"root/sign-self-issued", map[string]interface{}{
 		"certificate": pemBuf.String(),
 	})
 	if err != nil {
-		return "", fmt.Errorf("error having Vault cross-sign cert: %v", err)
+		return "", fmt.Errorf("error having Vault cross-sign cert: %w", err)
 	}
 	if response == nil || response.Data["certificate"] == "" {
 		return "", fmt.Errorf("certificate info returned from Vault was blank")
@@ -675,6 +1123,17 @@ func (v *VaultProvider) Cleanup(providerTypeChange bool, otherConfig map[string]
 	}
 }
 
+// KeyStorageLocation implements Provider. The keys are generated by and never
+// leave the Vault PKI backends.
+func (v *VaultProvider) KeyStorageLocation() (KeyLocation, error) {
+	return KeyLocationExternal, nil
+}
+
+// ProviderVersion implements VersionedProvider.
+func (v *VaultProvider) ProviderVersion() int {
+	return VaultProviderVersion
+}
+
 // Stop shuts down the token renew goroutine.
 func (v *VaultProvider) Stop() {
 	v.shutdown()
@@ -687,24 +1146,14 @@ func ParseVaultCAConfig(raw map[string]interface{}) (*structs.VaultCAProviderCon
 		CommonCAProviderConfig: defaultCommonConfig(),
 	}
 
-	decodeConf := &mapstructure.DecoderConfig{
-		DecodeHook: mapstructure.ComposeDecodeHookFunc(
-			structs.ParseDurationFunc(),
-			decode.HookTranslateKeys,
-		),
-		Result:           &config,
-		WeaklyTypedInput: true,
-	}
-
-	decoder, err := mapstructure.NewDecoder(decodeConf)
-	if err != nil {
+	hook := mapstructure.ComposeDecodeHookFunc(
+		structs.ParseDurationFunc(),
+		decode.HookTranslateKeys,
+	)
+	if err := decodeConfigStrict(raw, &config, hook); err != nil {
 		return nil, err
 	}
 
-	if err := decoder.Decode(raw); err != nil {
-		return nil, fmt.Errorf("error decoding config: %s", err)
-	}
-
 	if config.Token == "" && config.AuthMethod == nil {
 		return nil, fmt.Errorf("must provide a Vault token or configure a Vault auth method")
 	}
@@ -726,6 +1175,15 @@ func ParseVaultCAConfig(raw map[string]interface{}) (*structs.VaultCAProviderCon
 	if !strings.HasSuffix(config.IntermediatePKIPath, "/") {
 		config.IntermediatePKIPath += "/"
 	}
+	if config.SSHPKIPath != "" && !strings.HasSuffix(config.SSHPKIPath, "/") {
+		config.SSHPKIPath += "/"
+	}
+	if config.SSHAllowUserCertificates && len(config.SSHAllowedUsers) == 0 {
+		return nil, fmt.Errorf("SSHAllowedUsers must be set to allow user SSH certificates")
+	}
+	if !config.SSHAllowUserCertificates && len(config.SSHAllowedUsers) > 0 {
+		return nil, fmt.Errorf("SSHAllowedUsers requires SSHAllowUserCertificates to be set")
+	}
 
 	if err := config.CommonCAProviderConfig.Validate(); err != nil {
 		return nil, err
@@ -0,0 +1,104 @@
+package ca
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+
+	"github.com/hashicorp/consul/agent/structs"
+)
+
+// VaultCASSHRole is the role Consul signs SSH certificates with in the SSH
+// secrets engine at SSHPKIPath.
+const VaultCASSHRole = "consul-ssh"
+
+// SignSSH implements SSHSigner by signing the public key with the SSH secrets
+// engine at SSHPKIPath, mounting and configuring it first if needed.
+func (v *VaultProvider) SignSSH(certType, publicKey string, principals []string, ttl time.Duration) (string, error) {
+	if v.config.SSHPKIPath == "" {
+		return "", ErrSSHNotEnabled
+	}
+	if certType == structs.SSHCertTypeUser && !v.config.SSHAllowUserCertificates {
+		return "", fmt.Errorf("signing user SSH certificates is not allowed, see SSHAllowUserCertificates")
+	}
+	if err := v.setupSSHPKIPath(); err != nil {
+		return "", fmt.Errorf("error setting up the SSH secrets engine: %v", err)
+	}
+
+	req := map[string]interface{}{
+		"public_key":       publicKey,
+		"valid_principals": strings.Join(principals, ","),
+		"cert_type":        certType,
+	}
+	if ttl > 0 {
+		req["ttl"] = ttl.String()
+	}
+	response, err := v.client.Logical().Write(v.config.SSHPKIPath+"sign/"+VaultCASSHRole, req)
+	if err != nil {
+		return "", fmt.Errorf("error signing SSH certificate: %v", err)
+	}
+	if response == nil || response.Data["signed_key"] == "" {
+		return "", fmt.Errorf("SSH certificate returned from Vault was blank")
+	}
+
+	cert, ok := response.Data["signed_key"].(string)
+	if !ok {
+		return "", fmt.Errorf("SSH certificate was not a string")
+	}
+	return EnsureTrailingNewline(cert), nil
+}
+
+// setupSSHPKIPath mounts the SSH secrets engine with a new signing key if it
+// isn't mounted yet, and writes the role to sign SSH certificates with from
+// the configuration. An SSH secrets engine that is already mounted must have
+// a signing key configured. The role only allows host certificates for the
+// SSHAllowedDomains, and user certificates for the SSHAllowedUsers when
+// SSHAllowUserCertificates is set.
+func (v *VaultProvider) setupSSHPKIPath() error {
+	v.setupSSHPKIPathLock.Lock()
+	defer v.setupSSHPKIPathLock.Unlock()
+
+	if v.setupSSHPKIPathDone {
+		return nil
+	}
+	mounts, err := v.client.Sys().ListMounts()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := mounts[v.config.SSHPKIPath]; !ok {
+		err := v.client.Sys().Mount(v.config.SSHPKIPath, &vaultapi.MountInput{
+			Type:        "ssh",
+			Description: "SSH CA backend for Consul",
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = v.client.Logical().Write(v.config.SSHPKIPath+"config/ca", map[string]interface{}{
+			"generate_signing_key": true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// The role is written every time rather than only when it is missing, so
+	// that it follows changes to the configuration.
+	_, err = v.client.Logical().Write(v.config.SSHPKIPath+"roles/"+VaultCASSHRole, map[string]interface{}{
+		"key_type":                "ca",
+		"allow_host_certificates": true,
+		"allowed_domains":         strings.Join(v.config.SSHAllowedDomains, ","),
+		"allow_bare_domains":      true,
+		"allow_subdomains":        true,
+		"allow_user_certificates": v.config.SSHAllowUserCertificates,
+		"allowed_users":           strings.Join(v.config.SSHAllowedUsers, ","),
+	})
+	if err != nil {
+		return err
+	}
+	v.setupSSHPKIPathDone = true
+	return nil
+}
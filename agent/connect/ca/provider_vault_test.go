@@ -1,10 +1,21 @@
 package ca
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -12,6 +23,7 @@ import (
 	vaultapi "github.com/hashicorp/vault/api"
 	vaultconst "github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
 
 	"github.com/hashicorp/consul/agent/connect"
 	"github.com/hashicorp/consul/agent/structs"
@@ -40,6 +52,14 @@ func TestVaultCAProvider_ParseVaultCAConfig(t *testing.T) {
 			rawConfig: map[string]interface{}{"Token": "test", "RootPKIPath": "test"},
 			expError:  "must provide a valid path for the intermediate PKI backend",
 		},
+		"user SSH certificates without allowed users": {
+			rawConfig: map[string]interface{}{"Token": "test", "RootPKIPath": "test", "IntermediatePKIPath": "test", "SSHAllowUserCertificates": true},
+			expError:  "SSHAllowedUsers must be set to allow user SSH certificates",
+		},
+		"allowed users without user SSH certificates": {
+			rawConfig: map[string]interface{}{"Token": "test", "RootPKIPath": "test", "IntermediatePKIPath": "test", "SSHAllowedUsers": []string{"deploy"}},
+			expError:  "SSHAllowedUsers requires SSHAllowUserCertificates to be set",
+		},
 		"adds a slash to RootPKIPath and IntermediatePKIPath": {
 			rawConfig: map[string]interface{}{"Token": "test", "RootPKIPath": "test", "IntermediatePKIPath": "test"},
 			expConfig: &structs.VaultCAProviderConfig{
@@ -49,6 +69,27 @@ func TestVaultCAProvider_ParseVaultCAConfig(t *testing.T) {
 				IntermediatePKIPath:    "test/",
 			},
 		},
+		"unknown key": {
+			rawConfig: map[string]interface{}{"Token": "test", "Adress": "https://vault:8200", "RootPKIPath": "test", "IntermediatePKIPath": "test"},
+			expError:  "error decoding config: unknown keys: Adress",
+		},
+		"wrong type": {
+			rawConfig: map[string]interface{}{"Token": "test", "TLSSkipVerify": "sometimes", "RootPKIPath": "test", "IntermediatePKIPath": "test"},
+			expError:  "error decoding config: 1 error(s) decoding:\n\n* cannot parse 'TLSSkipVerify' as bool: strconv.ParseBool: parsing \"sometimes\": invalid syntax",
+		},
+		"unknown auth method key": {
+			rawConfig: map[string]interface{}{"AuthMethod": map[string]interface{}{"Type": "approle", "Paramz": map[string]interface{}{}}, "RootPKIPath": "test", "IntermediatePKIPath": "test"},
+			expError:  "error decoding config: unknown keys: AuthMethod.Paramz",
+		},
+		"allows cluster_id": {
+			rawConfig: map[string]interface{}{"Token": "test", "RootPKIPath": "test", "IntermediatePKIPath": "test", "cluster_id": "0f4fc2ff-7a7c-4bb4-9a0a-1e0fe6ea1fd6"},
+			expConfig: &structs.VaultCAProviderConfig{
+				CommonCAProviderConfig: defaultCommonConfig(),
+				Token:                  "test",
+				RootPKIPath:            "test/",
+				IntermediatePKIPath:    "test/",
+			},
+		},
 	}
 
 	for name, c := range cases {
@@ -164,6 +205,552 @@ func TestVaultCAProvider_Configure(t *testing.T) {
 	return
 }
 
+// recordingTransport is an http.RoundTripper that records the requests it
+// gets and answers them with a fixed response.
+type recordingTransport struct {
+	status int
+	body   string
+
+	lock     sync.Mutex
+	requests []*http.Request
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.lock.Lock()
+	r.requests = append(r.requests, req)
+	r.lock.Unlock()
+
+	return &http.Response{
+		StatusCode: r.status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(r.body)),
+		Request:    req,
+	}, nil
+}
+
+func (r *recordingTransport) Requests() []*http.Request {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]*http.Request(nil), r.requests...)
+}
+
+func TestVaultCAProvider_Configure_HTTPClient(t *testing.T) {
+	transport := &recordingTransport{
+		status: http.StatusOK,
+		body:   `{"data": {"renewable": false, "ttl": 0}}`,
+	}
+	provider := NewVaultProviderWithDeps(hclog.New(nil), ProviderDeps{
+		HTTPClient: func() *http.Client {
+			return &http.Client{Transport: transport}
+		},
+	})
+	t.Cleanup(provider.Stop)
+
+	err := provider.Configure(ProviderConfig{
+		ClusterID:  connect.TestClusterID,
+		Datacenter: "dc1",
+		IsPrimary:  true,
+		RawConfig: map[string]interface{}{
+			"Address":             "https://vault.example.com:8200",
+			"Token":               "the-token",
+			"RootPKIPath":         "pki-root/",
+			"IntermediatePKIPath": "pki-intermediate/",
+		},
+	})
+	require.NoError(t, err)
+
+	// The token was looked up through the injected client.
+	requests := transport.Requests()
+	require.Len(t, requests, 1)
+	require.Equal(t, "vault.example.com:8200", requests[0].URL.Host)
+	require.Equal(t, "/v1/auth/token/lookup-self", requests[0].URL.Path)
+	require.Equal(t, "the-token", requests[0].Header.Get("X-Vault-Token"))
+}
+
+func TestVaultCAProvider_Configure_Ed25519VaultVersion(t *testing.T) {
+	configure := func(t *testing.T, vaultVersion string) ([]*http.Request, error) {
+		transport := &recordingTransport{
+			status: http.StatusOK,
+			body:   fmt.Sprintf(`{"version": %q, "data": {"renewable": false, "ttl": 0}}`, vaultVersion),
+		}
+		provider := NewVaultProviderWithDeps(hclog.New(nil), ProviderDeps{
+			HTTPClient: func() *http.Client {
+				return &http.Client{Transport: transport}
+			},
+		})
+		t.Cleanup(provider.Stop)
+
+		err := provider.Configure(ProviderConfig{
+			ClusterID:  connect.TestClusterID,
+			Datacenter: "dc1",
+			IsPrimary:  true,
+			RawConfig: map[string]interface{}{
+				"Address":             "https://vault.example.com:8200",
+				"Token":               "the-token",
+				"RootPKIPath":         "pki-root/",
+				"IntermediatePKIPath": "pki-intermediate/",
+				"PrivateKeyType":      "ed25519",
+				"PrivateKeyBits":      256,
+			},
+		})
+		return transport.Requests(), err
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		requests, err := configure(t, "1.8.4")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `PrivateKeyType "ed25519" requires Vault 1.9.0 or later`)
+		require.Contains(t, err.Error(), "version is 1.8.4")
+		require.Len(t, requests, 1)
+		require.Equal(t, "/v1/sys/health", requests[0].URL.Path)
+	})
+
+	t.Run("supported", func(t *testing.T) {
+		requests, err := configure(t, "1.9.2")
+		require.NoError(t, err)
+		require.Len(t, requests, 2)
+		require.Equal(t, "/v1/sys/health", requests[0].URL.Path)
+		require.Equal(t, "/v1/auth/token/lookup-self", requests[1].URL.Path)
+	})
+}
+
+// blockingSignTransport is a recordingTransport that holds requests to sign an
+// intermediate until they are canceled, closing started once one arrived.
+type blockingSignTransport struct {
+	recordingTransport
+	started chan struct{}
+}
+
+func (b *blockingSignTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/root/sign-intermediate") {
+		return b.recordingTransport.RoundTrip(req)
+	}
+	close(b.started)
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestVaultCAProvider_SignIntermediate_ContextCanceled(t *testing.T) {
+	transport := &blockingSignTransport{
+		recordingTransport: recordingTransport{
+			status: http.StatusOK,
+			body:   `{"data": {"renewable": false, "ttl": 0}}`,
+		},
+		started: make(chan struct{}),
+	}
+	provider := NewVaultProviderWithDeps(hclog.New(nil), ProviderDeps{
+		HTTPClient: func() *http.Client {
+			return &http.Client{Transport: transport}
+		},
+	})
+	t.Cleanup(provider.Stop)
+
+	require.NoError(t, provider.Configure(ProviderConfig{
+		ClusterID:  connect.TestClusterID,
+		Datacenter: "dc1",
+		IsPrimary:  true,
+		RawConfig: map[string]interface{}{
+			"Address":             "https://vault.example.com:8200",
+			"Token":               "the-token",
+			"RootPKIPath":         "pki-root/",
+			"IntermediatePKIPath": "pki-intermediate/",
+		},
+	}))
+
+	key, _, err := connect.GeneratePrivateKey()
+	require.NoError(t, err)
+	csrPEM, err := connect.CreateCACSR(connect.SpiffeIDSigningForCluster(connect.TestClusterID), key, pkix.Name{})
+	require.NoError(t, err)
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+
+	// Cancel once Vault was asked to sign.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-transport.started
+		cancel()
+	}()
+
+	_, err = provider.SignIntermediate(ctx, csr)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestVaultCAProvider_TestConnection(t *testing.T) {
+	SkipIfVaultNotPresent(t)
+
+	testVault := NewTestVaultServer(t)
+	mountsBefore, err := testVault.Client().Sys().ListMounts()
+	require.NoError(t, err)
+
+	testConnection := func(token string) error {
+		provider := NewVaultProvider(hclog.New(nil))
+		return provider.TestConnection(ProviderConfig{
+			ClusterID:  connect.TestClusterID,
+			Datacenter: "dc1",
+			IsPrimary:  true,
+			RawConfig: map[string]interface{}{
+				"Address":             testVault.Addr,
+				"Token":               token,
+				"RootPKIPath":         "pki-root/",
+				"IntermediatePKIPath": "pki-intermediate/",
+			},
+		})
+	}
+
+	require.NoError(t, testConnection(testVault.RootToken))
+	require.Error(t, testConnection("not-a-token"))
+
+	// The checks didn't create the mounts, which Configure would.
+	mountsAfter, err := testVault.Client().Sys().ListMounts()
+	require.NoError(t, err)
+	require.Equal(t, len(mountsBefore), len(mountsAfter))
+	require.NotContains(t, mountsAfter, "pki-root/")
+	require.NotContains(t, mountsAfter, "pki-intermediate/")
+}
+
+func TestVaultCAProvider_TestConnection_ReadOnly(t *testing.T) {
+	transport := &recordingTransport{
+		status: http.StatusOK,
+		body:   `{"data": {}}`,
+	}
+	provider := NewVaultProviderWithDeps(hclog.New(nil), ProviderDeps{
+		HTTPClient: func() *http.Client {
+			return &http.Client{Transport: transport}
+		},
+	})
+
+	err := provider.TestConnection(ProviderConfig{
+		ClusterID:  connect.TestClusterID,
+		Datacenter: "dc1",
+		IsPrimary:  true,
+		RawConfig: map[string]interface{}{
+			"Address":             "https://vault.example.com:8200",
+			"Token":               "the-token",
+			"RootPKIPath":         "pki-root/",
+			"IntermediatePKIPath": "pki-intermediate/",
+		},
+	})
+	require.NoError(t, err)
+
+	// Only reads were sent to Vault.
+	var paths []string
+	for _, req := range transport.Requests() {
+		require.Equal(t, http.MethodGet, req.Method, req.URL.Path)
+		paths = append(paths, req.URL.Path)
+	}
+	require.Equal(t, []string{"/v1/auth/token/lookup-self", "/v1/sys/mounts"}, paths)
+}
+
+func TestVaultCAProvider_SignSSH(t *testing.T) {
+	SkipIfVaultNotPresent(t)
+
+	testVault := NewTestVaultServer(t)
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	publicKey := string(ssh.MarshalAuthorizedKey(sshPub))
+
+	t.Run("disabled", func(t *testing.T) {
+		provider, err := createVaultProvider(t, true, testVault.Addr, testVault.RootToken, nil)
+		require.NoError(t, err)
+
+		_, err = provider.SignSSH(structs.SSHCertTypeHost, publicKey, []string{"node1.node.consul"}, time.Hour)
+		require.Equal(t, ErrSSHNotEnabled, err)
+	})
+
+	t.Run("host certificate", func(t *testing.T) {
+		provider, err := createVaultProvider(t, true, testVault.Addr, testVault.RootToken, map[string]interface{}{
+			"SSHPKIPath":        "ssh",
+			"SSHAllowedDomains": []string{"consul"},
+		})
+		require.NoError(t, err)
+
+		signed, err := provider.SignSSH(structs.SSHCertTypeHost, publicKey, []string{"node1.node.consul"}, time.Hour)
+		require.NoError(t, err)
+
+		parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(signed))
+		require.NoError(t, err)
+		cert, ok := parsed.(*ssh.Certificate)
+		require.True(t, ok, "expected an SSH certificate, got %T", parsed)
+		require.Equal(t, uint32(ssh.HostCert), cert.CertType)
+		require.Equal(t, []string{"node1.node.consul"}, cert.ValidPrincipals)
+		require.Equal(t, sshPub.Marshal(), cert.Key.Marshal())
+
+		// The certificate was signed by the CA key of the SSH secrets engine.
+		caPub, err := testVault.Client().Logical().Read("ssh/config/ca")
+		require.NoError(t, err)
+		caKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(caPub.Data["public_key"].(string)))
+		require.NoError(t, err)
+		require.Equal(t, caKey.Marshal(), cert.SignatureKey.Marshal())
+		require.WithinDuration(t, time.Now().Add(time.Hour), time.Unix(int64(cert.ValidBefore), 0), 5*time.Minute)
+	})
+}
+
+func TestVaultCAProvider_SignSSH_Concurrent(t *testing.T) {
+	var (
+		lock   sync.Mutex
+		mounts int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/sys/mounts":
+			fmt.Fprint(w, `{"data": {}}`)
+		case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/v1/sys/mounts/ssh"):
+			lock.Lock()
+			mounts++
+			lock.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/ssh/roles/"+VaultCASSHRole:
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/v1/ssh/sign/"+VaultCASSHRole:
+			fmt.Fprint(w, `{"data": {"signed_key": "the-cert"}}`)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := vaultapi.NewClient(&vaultapi.Config{Address: srv.URL})
+	require.NoError(t, err)
+	provider := NewVaultProvider(hclog.New(nil))
+	provider.config = &structs.VaultCAProviderConfig{SSHPKIPath: "ssh/"}
+	provider.client = client
+
+	// The SSH secrets engine is set up once even when the first certificates
+	// are signed concurrently.
+	var wg sync.WaitGroup
+	errCh := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := provider.SignSSH(structs.SSHCertTypeHost, "the-key", []string{"node1.node.consul"}, time.Hour)
+			errCh <- err
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1, mounts)
+}
+
+func TestVaultCAProvider_SignSSH_Role(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		roles []map[string]interface{}
+		signs int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch {
+		case r.URL.Path == "/v1/auth/token/lookup-self":
+			fmt.Fprint(w, `{"data": {"renewable": false, "ttl": 0}}`)
+		case r.URL.Path == "/v1/sys/mounts":
+			fmt.Fprint(w, `{"data": {"ssh/": {"type": "ssh"}}}`)
+		case r.URL.Path == "/v1/ssh/roles/"+VaultCASSHRole:
+			// The role already exists, which doesn't keep Consul from
+			// writing it.
+			if r.Method == http.MethodGet {
+				fmt.Fprint(w, `{"data": {"allow_user_certificates": true, "allowed_users": "*"}}`)
+				return
+			}
+			var role map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&role))
+			roles = append(roles, role)
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/v1/ssh/sign/"+VaultCASSHRole:
+			signs++
+			fmt.Fprint(w, `{"data": {"signed_key": "the-cert"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	provider := NewVaultProvider(hclog.New(nil))
+	t.Cleanup(provider.Stop)
+	configure := func(t *testing.T, ssh map[string]interface{}) {
+		t.Helper()
+		raw := map[string]interface{}{
+			"Address":             srv.URL,
+			"Token":               "the-token",
+			"RootPKIPath":         "pki-root/",
+			"IntermediatePKIPath": "pki-intermediate/",
+			"SSHPKIPath":          "ssh",
+		}
+		for k, v := range ssh {
+			raw[k] = v
+		}
+		require.NoError(t, provider.Configure(ProviderConfig{
+			ClusterID:  connect.TestClusterID,
+			Datacenter: "dc1",
+			IsPrimary:  true,
+			RawConfig:  raw,
+		}))
+	}
+	lastRole := func(t *testing.T) map[string]interface{} {
+		t.Helper()
+		lock.Lock()
+		defer lock.Unlock()
+		require.NotEmpty(t, roles)
+		return roles[len(roles)-1]
+	}
+
+	// By default the role only allows host certificates, and user
+	// certificates are refused before reaching Vault.
+	configure(t, map[string]interface{}{"SSHAllowedDomains": []string{"consul"}})
+	_, err := provider.SignSSH(structs.SSHCertTypeHost, "the-key", []string{"node1.node.consul"}, time.Hour)
+	require.NoError(t, err)
+	role := lastRole(t)
+	require.Equal(t, true, role["allow_host_certificates"])
+	require.Equal(t, "consul", role["allowed_domains"])
+	require.Equal(t, false, role["allow_user_certificates"])
+	require.Equal(t, "", role["allowed_users"])
+
+	_, err = provider.SignSSH(structs.SSHCertTypeUser, "the-key", []string{"root"}, time.Hour)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SSHAllowUserCertificates")
+	lock.Lock()
+	require.Equal(t, 1, signs)
+	lock.Unlock()
+
+	// A configuration change is applied to the existing role.
+	configure(t, map[string]interface{}{
+		"SSHAllowedDomains":        []string{"example.com"},
+		"SSHAllowUserCertificates": true,
+		"SSHAllowedUsers":          []string{"deploy", "ops"},
+	})
+	_, err = provider.SignSSH(structs.SSHCertTypeUser, "the-key", []string{"deploy"}, time.Hour)
+	require.NoError(t, err)
+	role = lastRole(t)
+	require.Equal(t, "example.com", role["allowed_domains"])
+	require.Equal(t, true, role["allow_user_certificates"])
+	require.Equal(t, "deploy,ops", role["allowed_users"])
+	lock.Lock()
+	require.Len(t, roles, 2)
+	lock.Unlock()
+}
+
+func TestVaultCAProvider_SignLeafWithRoot(t *testing.T) {
+	// The root expires before LeafCertTTL is up.
+	signer, _, err := connect.GeneratePrivateKey()
+	require.NoError(t, err)
+	now := time.Now()
+	rootDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(2 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "root"}}, signer.Public(), signer)
+	require.NoError(t, err)
+	rootPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER}))
+
+	var (
+		lock  sync.Mutex
+		roles int
+		ttls  []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch path.Clean(r.URL.Path) {
+		case "/v1/auth/token/lookup-self":
+			fmt.Fprint(w, `{"data": {"renewable": false, "ttl": 0}}`)
+		case "/v1/pki-root/ca/pem":
+			fmt.Fprint(w, rootPEM)
+		case "/v1/pki-root/roles/" + VaultCALeafCertRole:
+			var role map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&role))
+			require.Equal(t, "spiffe://*", role["allowed_uri_sans"])
+			require.Equal(t, "72h0m0s", role["max_ttl"])
+			roles++
+			w.WriteHeader(http.StatusNoContent)
+		case "/v1/pki-root/sign/" + VaultCALeafCertRole:
+			var req map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			ttls = append(ttls, req["ttl"].(string))
+			fmt.Fprint(w, `{"data": {"certificate": "the-cert"}}`)
+		default:
+			// Notably sign-verbatim, which would skip the role.
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	provider := NewVaultProvider(hclog.New(nil))
+	t.Cleanup(provider.Stop)
+	configure := func(t *testing.T) {
+		t.Helper()
+		require.NoError(t, provider.Configure(ProviderConfig{
+			ClusterID:  connect.TestClusterID,
+			Datacenter: "dc1",
+			IsPrimary:  true,
+			RawConfig: map[string]interface{}{
+				"Address":             srv.URL,
+				"Token":               "the-token",
+				"RootPKIPath":         "pki-root/",
+				"IntermediatePKIPath": "pki-intermediate/",
+				"LeafCertTTL":         "72h",
+			},
+		}))
+	}
+	signLeaf := func(t *testing.T, params LeafSignParams) time.Duration {
+		t.Helper()
+		csrPEM, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "web"))
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		cert, err := provider.SignLeafWithRoot(context.Background(), csr, params)
+		require.NoError(t, err)
+		require.Equal(t, "the-cert\n", cert)
+		lock.Lock()
+		defer lock.Unlock()
+		ttl, err := time.ParseDuration(ttls[len(ttls)-1])
+		require.NoError(t, err)
+		return ttl
+	}
+	configure(t)
+
+	// The TTL is clamped to the root like it is to the intermediate.
+	ttl := signLeaf(t, LeafSignParams{})
+	require.LessOrEqual(t, ttl, 2*time.Hour-CertificateTimeDriftBuffer)
+	require.Greater(t, ttl, time.Hour)
+
+	// The params can only shorten it.
+	require.Equal(t, 30*time.Minute, signLeaf(t, LeafSignParams{TTL: 30 * time.Minute}))
+	require.Equal(t, 20*time.Minute, signLeaf(t, LeafSignParams{TTL: time.Hour, MaxTTL: 20 * time.Minute}))
+	ttl = signLeaf(t, LeafSignParams{TTL: 96 * time.Hour})
+	require.LessOrEqual(t, ttl, 2*time.Hour-CertificateTimeDriftBuffer)
+
+	// The role is written once per configuration.
+	lock.Lock()
+	require.Equal(t, 1, roles)
+	lock.Unlock()
+	configure(t)
+	signLeaf(t, LeafSignParams{})
+	lock.Lock()
+	require.Equal(t, 2, roles)
+	lock.Unlock()
+
+	// Signing gives up with the context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	csrPEM, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "web"))
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+	_, err = provider.SignLeafWithRoot(ctx, csr, LeafSignParams{})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
 func TestVaultCAProvider_SecondaryActiveIntermediate(t *testing.T) {
 
 	SkipIfVaultNotPresent(t)
@@ -300,6 +887,8 @@ func assertCorrectKeyType(t *testing.T, want, certPEM string) {
 		require.Equal(t, x509.ECDSA, cert.PublicKeyAlgorithm)
 	case "rsa":
 		require.Equal(t, x509.RSA, cert.PublicKeyAlgorithm)
+	case "ed25519":
+		require.Equal(t, x509.Ed25519, cert.PublicKeyAlgorithm)
 	default:
 		t.Fatal("test doesn't support key type")
 	}
@@ -343,7 +932,7 @@ func TestVaultCAProvider_SignLeaf(t *testing.T) {
 				csr, err := connect.ParseCSR(raw)
 				require.NoError(t, err)
 
-				cert, err := provider.Sign(csr)
+				cert, err := provider.Sign(context.Background(), csr)
 				require.NoError(t, err)
 
 				parsed, err := connect.ParseCert(cert)
@@ -370,7 +959,7 @@ func TestVaultCAProvider_SignLeaf(t *testing.T) {
 				csr, err := connect.ParseCSR(raw)
 				require.NoError(t, err)
 
-				cert, err := provider.Sign(csr)
+				cert, err := provider.Sign(context.Background(), csr)
 				require.NoError(t, err)
 
 				parsed, err := connect.ParseCert(cert)
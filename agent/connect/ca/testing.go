@@ -1,11 +1,13 @@
 package ca
 
 import (
+	"crypto"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
 
 	"github.com/hashicorp/go-hclog"
@@ -19,7 +21,7 @@ import (
 
 // KeyTestCases is a list of the important CA key types that we should test
 // against when signing. For now leaf keys are always EC P256 but CA can be EC
-// (any NIST curve) or RSA (2048, 4096). Providers must be able to complete all
+// (any NIST curve), RSA (2048, 4096) or Ed25519. Providers must be able to complete all
 // signing operations with both types that includes:
 //   - Sign must be able to sign EC P256 leaf with all these types of CA key
 //   - CrossSignCA must be able to sign all these types of new CA key with all
@@ -41,6 +43,11 @@ var KeyTestCases = []struct {
 		KeyType: "rsa",
 		KeyBits: 2048,
 	},
+	{
+		Desc:    "Ed25519",
+		KeyType: "ed25519",
+		KeyBits: 256,
+	},
 }
 
 // CASigningKeyTypes is a struct with params for tests that sign one CA CSR with
@@ -73,6 +80,50 @@ func CASigningKeyTypeCases() []CASigningKeyTypes {
 	return cases
 }
 
+// fastKeyPoolSize is the number of keys of each type and size TestFastKeys
+// hands out in turn.
+const fastKeyPoolSize = 4
+
+type fastKey struct {
+	signer crypto.Signer
+	pem    string
+}
+
+var (
+	fastKeysLock sync.Mutex
+	fastKeys     = map[string][]fastKey{}
+)
+
+// TestFastKeys returns a private key source for ProviderDeps.PrivateKey, or
+// for tests which need CA keys themselves, that doesn't generate a new key
+// every time. Keys come from a pool of fastKeyPoolSize keys per type and size
+// shared by the whole test binary, so large RSA keys are only generated once.
+// Each source hands out the keys of the pool in turn: consecutive keys are
+// distinct, but tests mustn't expect keys to be unique beyond that.
+func TestFastKeys() func(keyType string, keyBits int) (crypto.Signer, string, error) {
+	var lock sync.Mutex
+	next := map[string]int{}
+	return func(keyType string, keyBits int) (crypto.Signer, string, error) {
+		id := fmt.Sprintf("%s-%d", strings.ToLower(keyType), keyBits)
+		lock.Lock()
+		i := next[id]
+		next[id] = (i + 1) % fastKeyPoolSize
+		lock.Unlock()
+
+		fastKeysLock.Lock()
+		defer fastKeysLock.Unlock()
+		for len(fastKeys[id]) <= i {
+			signer, pem, err := connect.GeneratePrivateKeyWithConfig(keyType, keyBits)
+			if err != nil {
+				return nil, "", err
+			}
+			fastKeys[id] = append(fastKeys[id], fastKey{signer: signer, pem: pem})
+		}
+		k := fastKeys[id][i]
+		return k.signer, k.pem, nil
+	}
+}
+
 // TestConsulProvider creates a new ConsulProvider, taking care to stub out it's
 // Logger so that logging calls don't panic. If logging output is important
 func TestConsulProvider(t testing.T, d ConsulProviderStateDelegate) *ConsulProvider {
@@ -229,4 +280,7 @@ func requireTrailingNewline(t testing.T, leafPEM string) {
 	if '\n' != rune(leafPEM[len(leafPEM)-1]) {
 		t.Fatalf("cert do not end with a new line")
 	}
+	if strings.HasSuffix(leafPEM, "\n\n") {
+		t.Fatalf("cert ends with more than one new line")
+	}
 }
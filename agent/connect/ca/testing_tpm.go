@@ -0,0 +1,142 @@
+package ca
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/mitchellh/go-testing-interface"
+
+	"github.com/hashicorp/consul/agent/connect"
+)
+
+// TestTPM simulates a TPM 2.0 whose attestation key is signed by a test CA,
+// to make TPM attestations of leaf keys in tests.
+type TestTPM struct {
+	// RootsPEM is the PEM-encoded certificate of the CA which signed the
+	// attestation key, to use as the TPMAttestationRoots of the provider.
+	RootsPEM string
+
+	akCertPEM string
+	ak        *ecdsa.PrivateKey
+}
+
+// NewTestTPM returns a TestTPM with a new attestation key and CA.
+func NewTestTPM(t testing.T) *TestTPM {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %s", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test TPM Manufacturer CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatalf("error creating CA certificate: %s", err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("error parsing CA certificate: %s", err)
+	}
+
+	ak, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %s", err)
+	}
+	akTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test TPM Attestation Key"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	akDER, err := x509.CreateCertificate(rand.Reader, akTemplate, caCert, ak.Public(), caKey)
+	if err != nil {
+		t.Fatalf("error creating attestation key certificate: %s", err)
+	}
+
+	return &TestTPM{
+		RootsPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})),
+		akCertPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: akDER})),
+		ak:        ak,
+	}
+}
+
+// Attest returns a JSON-encoded TPMAttestation that the EC P-256 key of the
+// PEM-encoded CSR was generated in the TPM.
+func (tpm *TestTPM) Attest(t testing.T, csrPEM string) []byte {
+	csr, err := connect.ParseCSR(csrPEM)
+	if err != nil {
+		t.Fatalf("error parsing CSR: %s", err)
+	}
+	key, ok := csr.PublicKey.(*ecdsa.PublicKey)
+	if !ok || key.Curve != elliptic.P256() {
+		t.Fatalf("CSR key is not an EC P-256 key")
+	}
+
+	// TPMT_PUBLIC of an ECDSA signing key generated in the TPM.
+	var public bytes.Buffer
+	tpmWrite(&public, uint16(tpmAlgECC), uint16(tpmAlgSHA256))
+	tpmWrite(&public, uint32(tpmObjectFixedTPM|tpmObjectSensitiveDataOrigin|0x00040050))
+	tpmWriteSized(&public, nil)
+	tpmWrite(&public, uint16(tpmAlgNull), uint16(0x0018), uint16(tpmAlgSHA256))
+	tpmWrite(&public, uint16(tpmECCNistP256), uint16(tpmAlgNull))
+	tpmWriteSized(&public, key.X.FillBytes(make([]byte, 32)))
+	tpmWriteSized(&public, key.Y.FillBytes(make([]byte, 32)))
+
+	publicHash := sha256.Sum256(public.Bytes())
+	name := append([]byte{0x00, tpmAlgSHA256}, publicHash[:]...)
+	tbsHash := sha256.Sum256(csr.RawTBSCertificateRequest)
+
+	// TPMS_ATTEST of TPM2_Certify.
+	var info bytes.Buffer
+	tpmWrite(&info, uint32(tpmGeneratedValue), uint16(tpmSTAttestCertify))
+	tpmWriteSized(&info, []byte{0x00, tpmAlgSHA256})
+	tpmWriteSized(&info, tbsHash[:])
+	info.Write(make([]byte, 17+8))
+	tpmWriteSized(&info, name)
+	tpmWriteSized(&info, name)
+
+	digest := sha256.Sum256(info.Bytes())
+	sig, err := ecdsa.SignASN1(rand.Reader, tpm.ak, digest[:])
+	if err != nil {
+		t.Fatalf("error signing attestation: %s", err)
+	}
+
+	raw, err := json.Marshal(TPMAttestation{
+		AKCert:      tpm.akCertPEM,
+		CertifyInfo: info.Bytes(),
+		Signature:   sig,
+		PublicArea:  public.Bytes(),
+	})
+	if err != nil {
+		t.Fatalf("error encoding attestation: %s", err)
+	}
+	return raw
+}
+
+func tpmWrite(buf *bytes.Buffer, values ...interface{}) {
+	for _, v := range values {
+		binary.Write(buf, binary.BigEndian, v)
+	}
+}
+
+func tpmWriteSized(buf *bytes.Buffer, b []byte) {
+	tpmWrite(buf, uint16(len(b)))
+	buf.Write(b)
+}
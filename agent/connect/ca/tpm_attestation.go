@@ -0,0 +1,276 @@
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/hashicorp/consul/agent/connect"
+)
+
+// TPM 2.0 constants used when verifying attestations. See part 2 of the TPM
+// 2.0 Library specification, "Structures".
+const (
+	tpmGeneratedValue  = 0xff544347
+	tpmSTAttestCertify = 0x8017
+
+	tpmAlgRSA    = 0x0001
+	tpmAlgSHA256 = 0x000B
+	tpmAlgSHA384 = 0x000C
+	tpmAlgSHA512 = 0x000D
+	tpmAlgNull   = 0x0010
+	tpmAlgECDAA  = 0x001A
+	tpmAlgECC    = 0x0023
+
+	tpmECCNistP256 = 0x0003
+	tpmECCNistP384 = 0x0004
+	tpmECCNistP521 = 0x0005
+
+	// tpmObjectFixedTPM and tpmObjectSensitiveDataOrigin are the attributes
+	// of a key which was generated by the TPM and can't be exported from it.
+	tpmObjectFixedTPM            = 0x00000002
+	tpmObjectSensitiveDataOrigin = 0x00000020
+)
+
+// TPMAttestation is the attestation the built-in provider verifies that the
+// key of a leaf CSR was generated in a TPM 2.0. It is sent JSON-encoded as the
+// Attestation of a CASignRequest.
+//
+// The attestation is made by an attestation key (AK) of the TPM whose
+// certificate must chain to one of the TPMAttestationRoots of the provider.
+// The AK certifies the key with TPM2_Certify, using the SHA-256 hash of the
+// TBSCertificateRequest of the CSR as the qualifying data so that the
+// attestation can't be replayed for another CSR.
+type TPMAttestation struct {
+	// AKCert is the PEM-encoded certificate of the attestation key.
+	AKCert string
+
+	// CertifyInfo is the TPMS_ATTEST structure returned by TPM2_Certify.
+	CertifyInfo []byte
+
+	// Signature is the signature of CertifyInfo by the attestation key, with
+	// SHA-256. It is ASN.1 encoded for ECDSA keys and PKCS #1 v1.5 for RSA
+	// keys.
+	Signature []byte
+
+	// PublicArea is the TPMT_PUBLIC structure of the certified key.
+	PublicArea []byte
+}
+
+// verifyTPMAttestation verifies that the JSON-encoded TPMAttestation proves
+// that the key of csr was generated in a TPM whose attestation key is signed
+// by roots.
+func verifyTPMAttestation(roots *x509.CertPool, csr *x509.CertificateRequest, raw []byte) error {
+	var att TPMAttestation
+	if err := json.Unmarshal(raw, &att); err != nil {
+		return fmt.Errorf("error decoding TPM attestation: %v", err)
+	}
+
+	akCert, err := connect.ParseCert(att.AKCert)
+	if err != nil {
+		return fmt.Errorf("error parsing attestation key certificate: %v", err)
+	}
+	_, err = akCert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("attestation key certificate is not trusted: %v", err)
+	}
+
+	var sigAlgo x509.SignatureAlgorithm
+	switch akCert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		sigAlgo = x509.ECDSAWithSHA256
+	case *rsa.PublicKey:
+		sigAlgo = x509.SHA256WithRSA
+	default:
+		return fmt.Errorf("unsupported attestation key type %T", akCert.PublicKey)
+	}
+	if err := akCert.CheckSignature(sigAlgo, att.CertifyInfo, att.Signature); err != nil {
+		return fmt.Errorf("invalid attestation signature: %v", err)
+	}
+
+	extraData, certifiedName, err := parseTPMCertifyInfo(att.CertifyInfo)
+	if err != nil {
+		return err
+	}
+	tbsHash := sha256.Sum256(csr.RawTBSCertificateRequest)
+	if !bytes.Equal(extraData, tbsHash[:]) {
+		return fmt.Errorf("attestation was not made for this CSR")
+	}
+
+	pub, nameAlg, attributes, err := parseTPMPublic(att.PublicArea)
+	if err != nil {
+		return err
+	}
+	hash, err := tpmHash(nameAlg)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(att.PublicArea)
+	name := make([]byte, 2, 2+hash.Size())
+	binary.BigEndian.PutUint16(name, nameAlg)
+	name = h.Sum(name)
+	if !bytes.Equal(certifiedName, name) {
+		return fmt.Errorf("attestation does not certify the given public area")
+	}
+
+	const generatedInTPM = tpmObjectFixedTPM | tpmObjectSensitiveDataOrigin
+	if attributes&generatedInTPM != generatedInTPM {
+		return fmt.Errorf("attested key was not generated in the TPM")
+	}
+
+	csrKey, ok := csr.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !csrKey.Equal(pub) {
+		return fmt.Errorf("attested key does not match the CSR public key")
+	}
+	return nil
+}
+
+// parseTPMCertifyInfo parses a TPMS_ATTEST structure made by TPM2_Certify and
+// returns its qualifying data and the name of the certified object.
+func parseTPMCertifyInfo(b []byte) (extraData, name []byte, err error) {
+	r := &tpmReader{buf: b}
+	magic := r.uint32()
+	typ := r.uint16()
+	r.sized() // qualifiedSigner
+	extraData = r.sized()
+	r.next(17) // clockInfo
+	r.next(8)  // firmwareVersion
+	name = r.sized()
+	r.sized() // qualifiedName
+	if r.err != nil {
+		return nil, nil, fmt.Errorf("error parsing TPM attestation info: %v", r.err)
+	}
+	if magic != tpmGeneratedValue {
+		return nil, nil, fmt.Errorf("TPM attestation info was not generated by a TPM")
+	}
+	if typ != tpmSTAttestCertify {
+		return nil, nil, fmt.Errorf("TPM attestation info is of type 0x%04x, not a certification", typ)
+	}
+	return extraData, name, nil
+}
+
+// parseTPMPublic parses a TPMT_PUBLIC structure holding an RSA or ECC key and
+// returns the key along with its name algorithm and object attributes.
+func parseTPMPublic(b []byte) (crypto.PublicKey, uint16, uint32, error) {
+	r := &tpmReader{buf: b}
+	typ := r.uint16()
+	nameAlg := r.uint16()
+	attributes := r.uint32()
+	r.sized() // authPolicy
+
+	// The symmetric algorithm is only set for storage keys, which can't be
+	// used for certificates but are parsed for completeness.
+	if r.uint16() != tpmAlgNull {
+		r.next(4) // keyBits and mode
+	}
+	switch scheme := r.uint16(); scheme {
+	case tpmAlgNull:
+	case tpmAlgECDAA:
+		r.next(4) // hashAlg and count
+	default:
+		r.next(2) // hashAlg
+	}
+
+	var pub crypto.PublicKey
+	switch typ {
+	case tpmAlgRSA:
+		r.next(2) // keyBits
+		exponent := int(r.uint32())
+		modulus := r.sized()
+		if exponent == 0 {
+			exponent = 65537
+		}
+		pub = &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: exponent}
+	case tpmAlgECC:
+		curveID := r.uint16()
+		if r.uint16() != tpmAlgNull {
+			r.next(2) // KDF hashAlg
+		}
+		x := r.sized()
+		y := r.sized()
+		var curve elliptic.Curve
+		switch curveID {
+		case tpmECCNistP256:
+			curve = elliptic.P256()
+		case tpmECCNistP384:
+			curve = elliptic.P384()
+		case tpmECCNistP521:
+			curve = elliptic.P521()
+		default:
+			return nil, 0, 0, fmt.Errorf("unsupported TPM ECC curve 0x%04x", curveID)
+		}
+		pub = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	default:
+		return nil, 0, 0, fmt.Errorf("unsupported TPM key type 0x%04x", typ)
+	}
+	if r.err != nil {
+		return nil, 0, 0, fmt.Errorf("error parsing TPM public area: %v", r.err)
+	}
+	return pub, nameAlg, attributes, nil
+}
+
+func tpmHash(alg uint16) (crypto.Hash, error) {
+	switch alg {
+	case tpmAlgSHA256:
+		return crypto.SHA256, nil
+	case tpmAlgSHA384:
+		return crypto.SHA384, nil
+	case tpmAlgSHA512:
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported TPM name algorithm 0x%04x", alg)
+}
+
+var errTPMShortBuffer = errors.New("unexpected end of data")
+
+// tpmReader reads the big-endian fields of TPM structures, recording the
+// first error so that a structure can be read in full before checking it.
+type tpmReader struct {
+	buf []byte
+	err error
+}
+
+func (r *tpmReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf) < n {
+		r.err = errTPMShortBuffer
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *tpmReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *tpmReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// sized reads a TPM2B structure, a buffer prefixed with its 16 bit size.
+func (r *tpmReader) sized() []byte {
+	return r.next(int(r.uint16()))
+}
@@ -3,6 +3,7 @@ package connect
 import (
 	"bytes"
 	"crypto"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -18,8 +19,11 @@ import (
 // ECDSAWithSHA256 on the basis that it will fail anyway and we've already type
 // checked keys by the time we call this in general.
 func SigAlgoForKey(key crypto.Signer) x509.SignatureAlgorithm {
-	if _, ok := key.(*rsa.PrivateKey); ok {
+	switch key.(type) {
+	case *rsa.PrivateKey:
 		return x509.SHA256WithRSA
+	case ed25519.PrivateKey:
+		return x509.PureEd25519
 	}
 	// We default to ECDSA but don't bother detecting invalid key types as we do
 	// that in lots of other places and it will fail anyway if we try to sign with
@@ -35,6 +39,8 @@ func SigAlgoForKeyType(keyType string) x509.SignatureAlgorithm {
 	switch keyType {
 	case "rsa":
 		return x509.SHA256WithRSA
+	case "ed25519":
+		return x509.PureEd25519
 	case "ec":
 		fallthrough
 	default:
@@ -53,7 +59,43 @@ func CreateCSR(uri CertURI, privateKey crypto.Signer,
 		DNSNames:           dnsNames,
 		IPAddresses:        ipAddresses,
 	}
-	HackSANExtensionForCSR(template)
+	return createCSR(template, privateKey)
+}
+
+// CreateCACSR returns a CA CSR to sign the given service along with the PEM-encoded
+// private key for this certificate. The subject is embedded in the CSR as is,
+// an empty pkix.Name leaves the subject empty.
+func CreateCACSR(uri CertURI, privateKey crypto.Signer, subject pkix.Name) (string, error) {
+	return CreateCACSRWithSigAlgo(uri, privateKey, subject, x509.UnknownSignatureAlgorithm)
+}
+
+// CreateCACSRWithSigAlgo is like CreateCACSR but signs the CSR with the given
+// algorithm. x509.UnknownSignatureAlgorithm uses the default for the key.
+func CreateCACSRWithSigAlgo(uri CertURI, privateKey crypto.Signer, subject pkix.Name, sigAlgo x509.SignatureAlgorithm) (string, error) {
+	if sigAlgo == x509.UnknownSignatureAlgorithm {
+		sigAlgo = SigAlgoForKey(privateKey)
+	}
+
+	ext, err := CreateCAExtension()
+	if err != nil {
+		return "", err
+	}
+
+	template := &x509.CertificateRequest{
+		Subject:            subject,
+		URIs:               []*url.URL{uri.URI()},
+		SignatureAlgorithm: sigAlgo,
+		ExtraExtensions:    []pkix.Extension{ext},
+	}
+	return createCSR(template, privateKey)
+}
+
+func createCSR(template *x509.CertificateRequest, privateKey crypto.Signer) (string, error) {
+	// The SAN extension only needs to be critical when the subject is empty,
+	// otherwise the standard library encoding is fine.
+	if len(template.Subject.ToRDNSequence()) == 0 {
+		HackSANExtensionForCSR(template)
+	}
 
 	// Create the CSR itself
 	var csrBuf bytes.Buffer
@@ -70,17 +112,6 @@ func CreateCSR(uri CertURI, privateKey crypto.Signer,
 	return csrBuf.String(), nil
 }
 
-// CreateCSR returns a CA CSR to sign the given service along with the PEM-encoded
-// private key for this certificate.
-func CreateCACSR(uri CertURI, privateKey crypto.Signer) (string, error) {
-	ext, err := CreateCAExtension()
-	if err != nil {
-		return "", err
-	}
-
-	return CreateCSR(uri, privateKey, nil, nil, ext)
-}
-
 // CreateCAExtension creates a pkix.Extension for the x509 Basic Constraints
 // IsCA field ()
 func CreateCAExtension() (pkix.Extension, error) {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -81,6 +82,28 @@ func generateECDSAKey(keyBits int) (crypto.Signer, string, error) {
 	return pk, pemBlock, nil
 }
 
+// generateEd25519Key generates an Ed25519 key, PEM-encoded in PKCS #8 as
+// there is no other standard encoding for it. Ed25519 keys have a fixed
+// length, so there are no key bits to choose.
+func generateEd25519Key() (crypto.Signer, string, error) {
+	_, pk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating Ed25519 private key: %s", err)
+	}
+
+	bs, err := x509.MarshalPKCS8PrivateKey(pk)
+	if err != nil {
+		return nil, "", fmt.Errorf("error marshaling Ed25519 private key: %s", err)
+	}
+
+	pemBlock, err := pemEncode(bs, "PRIVATE KEY")
+	if err != nil {
+		return nil, "", err
+	}
+
+	return pk, pemBlock, nil
+}
+
 // GeneratePrivateKey generates a new Private key
 func GeneratePrivateKeyWithConfig(keyType string, keyBits int) (crypto.Signer, string, error) {
 	switch strings.ToLower(keyType) {
@@ -88,6 +111,8 @@ func GeneratePrivateKeyWithConfig(keyType string, keyBits int) (crypto.Signer, s
 		return generateRSAKey(keyBits)
 	case "ec":
 		return generateECDSAKey(keyBits)
+	case "ed25519":
+		return generateEd25519Key()
 	default:
 		return nil, "", fmt.Errorf("unknown private key type requested: %s", keyType)
 	}
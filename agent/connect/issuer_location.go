@@ -0,0 +1,49 @@
+package connect
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+)
+
+// OIDExtensionIssuerLocation is the OID of the non-critical extension Consul
+// adds to the leaf certificates it issues to record where they were issued.
+var OIDExtensionIssuerLocation = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 52435, 1, 1}
+
+// IssuerLocation is the value of the OIDExtensionIssuerLocation extension: the
+// datacenter of the server that issued the certificate and the admin
+// partition of the identity it was issued for.
+type IssuerLocation struct {
+	Datacenter string `asn1:"utf8"`
+	Partition  string `asn1:"utf8"`
+}
+
+// Extension returns the DER-encoded extension to add to a certificate.
+func (l IssuerLocation) Extension() (pkix.Extension, error) {
+	value, err := asn1.Marshal(l)
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("error encoding issuer location: %w", err)
+	}
+	return pkix.Extension{Id: OIDExtensionIssuerLocation, Value: value}, nil
+}
+
+// ParseIssuerLocation returns the issuer location recorded in cert, or nil if
+// it has no OIDExtensionIssuerLocation extension.
+func ParseIssuerLocation(cert *x509.Certificate) (*IssuerLocation, error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(OIDExtensionIssuerLocation) {
+			continue
+		}
+		var l IssuerLocation
+		rest, err := asn1.Unmarshal(ext.Value, &l)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding issuer location: %w", err)
+		}
+		if len(rest) > 0 {
+			return nil, fmt.Errorf("error decoding issuer location: trailing data")
+		}
+		return &l, nil
+	}
+	return nil, nil
+}
@@ -1,8 +1,10 @@
 package connect
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
@@ -56,6 +58,31 @@ func ParseLeafCerts(pemValue string) (*x509.Certificate, *x509.CertPool, error)
 	return leaf, intermediates, nil
 }
 
+// LeafAuthorityKeyIDs returns the encoded authority key ID of the leaf
+// certificate at the start of a PEM bundle. If the bundle also contains the
+// intermediate that issued the leaf, the authority key ID of that intermediate
+// is returned too, otherwise issuerKeyID is empty. This lets callers recognize
+// a leaf signed by a sub-intermediate of the CA they know about.
+func LeafAuthorityKeyIDs(pemValue string) (authorityKeyID, issuerKeyID string, err error) {
+	certs, err := parseCerts(pemValue)
+	if err != nil {
+		return "", "", err
+	}
+
+	leaf := certs[0]
+	authorityKeyID = EncodeSigningKeyID(leaf.AuthorityKeyId)
+	for _, cert := range certs[1:] {
+		if len(leaf.AuthorityKeyId) == 0 || !bytes.Equal(cert.SubjectKeyId, leaf.AuthorityKeyId) {
+			continue
+		}
+		if len(cert.AuthorityKeyId) > 0 && !bytes.Equal(cert.AuthorityKeyId, cert.SubjectKeyId) {
+			issuerKeyID = EncodeSigningKeyID(cert.AuthorityKeyId)
+		}
+		break
+	}
+	return authorityKeyID, issuerKeyID, nil
+}
+
 // CertSubjects can be used in debugging to return the subject of each
 // certificate in the PEM bundle. Each subject is separated by a newline.
 func CertSubjects(pem string) string {
@@ -111,6 +138,13 @@ func CalculateCertFingerprint(cert []byte) string {
 	return HexString(hash[:])
 }
 
+// CalculateCertFingerprintSHA256 calculates the SHA-256 fingerprint from the
+// cert bytes.
+func CalculateCertFingerprintSHA256(cert []byte) string {
+	hash := sha256.Sum256(cert)
+	return HexString(hash[:])
+}
+
 // ParseSigner parses a crypto.Signer from a PEM-encoded key. The private key
 // is expected to be the first block in the PEM value.
 func ParseSigner(pemValue string) (crypto.Signer, error) {
@@ -161,11 +195,13 @@ func ParseCSR(pemValue string) (*x509.CertificateRequest, error) {
 }
 
 // KeyId returns a x509 KeyId from the given signing key. The key must be
-// an *ecdsa.PublicKey currently, but may support more types in the future.
+// an *ecdsa.PublicKey, *rsa.PublicKey or ed25519.PublicKey currently, but may
+// support more types in the future.
 func KeyId(raw interface{}) ([]byte, error) {
 	switch raw.(type) {
 	case *ecdsa.PublicKey:
 	case *rsa.PublicKey:
+	case ed25519.PublicKey:
 	default:
 		return nil, fmt.Errorf("invalid key type: %T", raw)
 	}
@@ -219,6 +255,8 @@ func KeyInfoFromCert(cert *x509.Certificate) (keyType string, keyBits int, err e
 		return "ec", k.Curve.Params().BitSize, nil
 	case *rsa.PublicKey:
 		return "rsa", k.N.BitLen(), nil
+	case ed25519.PublicKey:
+		return "ed25519", 8 * len(k), nil
 	default:
 		return "", 0, fmt.Errorf("unsupported key type")
 	}
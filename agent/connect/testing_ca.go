@@ -297,10 +297,18 @@ func TestLeafWithNamespace(t testing.T, service, namespace string, root *structs
 // TestCSR returns a CSR to sign the given service along with the PEM-encoded
 // private key for this certificate.
 func TestCSR(t testing.T, uri CertURI) (string, string) {
+	return TestCSRWithURIs(t, uri)
+}
+
+// TestCSRWithURIs returns a CSR with a URI SAN for each of the given
+// identities along with the PEM-encoded private key for this certificate.
+func TestCSRWithURIs(t testing.T, uris ...CertURI) (string, string) {
 	template := &x509.CertificateRequest{
-		URIs:               []*url.URL{uri.URI()},
 		SignatureAlgorithm: x509.ECDSAWithSHA256,
 	}
+	for _, uri := range uris {
+		template.URIs = append(template.URIs, uri.URI())
+	}
 
 	HackSANExtensionForCSR(template)
 
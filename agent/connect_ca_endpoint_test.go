@@ -15,6 +15,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/hashicorp/consul/agent/connect"
+	"github.com/hashicorp/consul/agent/connect/ca"
 	"github.com/hashicorp/consul/agent/structs"
 )
 
@@ -94,8 +95,9 @@ func TestConnectCAConfig(t *testing.T) {
 			}`,
 			wantErr: false,
 			wantCfg: structs.CAConfiguration{
-				Provider:  "consul",
-				ClusterID: connect.TestClusterID,
+				Provider:        "consul",
+				ClusterID:       connect.TestClusterID,
+				ProviderVersion: ca.ConsulProviderVersion,
 				Config: map[string]interface{}{
 					"LeafCertTTL":         "72h",
 					"IntermediateCertTTL": "288h",
@@ -114,8 +116,9 @@ func TestConnectCAConfig(t *testing.T) {
 			}`,
 			wantErr: false,
 			wantCfg: structs.CAConfiguration{
-				Provider:  "consul",
-				ClusterID: connect.TestClusterID,
+				Provider:        "consul",
+				ClusterID:       connect.TestClusterID,
+				ProviderVersion: ca.ConsulProviderVersion,
 				Config: map[string]interface{}{
 					"LeafCertTTL":         "72h",
 					"IntermediateCertTTL": "288h",
@@ -135,8 +138,9 @@ func TestConnectCAConfig(t *testing.T) {
 			}`,
 			wantErr: false,
 			wantCfg: structs.CAConfiguration{
-				Provider:  "consul",
-				ClusterID: connect.TestClusterID,
+				Provider:        "consul",
+				ClusterID:       connect.TestClusterID,
+				ProviderVersion: ca.ConsulProviderVersion,
 				Config: map[string]interface{}{
 					"LeafCertTTL":         "72h",
 					"IntermediateCertTTL": "288h",
@@ -162,8 +166,9 @@ func TestConnectCAConfig(t *testing.T) {
 			}`,
 			wantErr: false,
 			wantCfg: structs.CAConfiguration{
-				Provider:  "consul",
-				ClusterID: connect.TestClusterID,
+				Provider:        "consul",
+				ClusterID:       connect.TestClusterID,
+				ProviderVersion: ca.ConsulProviderVersion,
 				Config: map[string]interface{}{
 					"LeafCertTTL":         "72h",
 					"IntermediateCertTTL": "288h",
@@ -198,8 +203,9 @@ func TestConnectCAConfig(t *testing.T) {
 			}`,
 			wantErr: false,
 			wantCfg: structs.CAConfiguration{
-				Provider:  "consul",
-				ClusterID: connect.TestClusterID,
+				Provider:        "consul",
+				ClusterID:       connect.TestClusterID,
+				ProviderVersion: ca.ConsulProviderVersion,
 				Config: map[string]interface{}{
 					"LeafCertTTL":         "72h",
 					"IntermediateCertTTL": "288h",
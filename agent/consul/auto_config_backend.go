@@ -20,8 +20,14 @@ func (b autoConfigBackend) ForwardRPC(method string, info structs.RPCInfo, reply
 	return b.Server.ForwardRPC(method, info, reply)
 }
 
+// SignCertificate signs the certificate of the agent, see
+// CAManager.SignAutoConfigCertificate.
 func (b autoConfigBackend) SignCertificate(csr *x509.CertificateRequest, id connect.CertURI) (*structs.IssuedCert, error) {
-	return b.Server.caManager.SignCertificate(csr, id)
+	agentID, ok := id.(*connect.SpiffeIDAgent)
+	if !ok {
+		return nil, fmt.Errorf("auto-config can only sign agent certificates, got %s", id.URI())
+	}
+	return b.Server.caManager.SignAutoConfigCertificate(csr, agentID)
 }
 
 // GetCARoots returns the CA roots.
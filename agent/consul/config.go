@@ -381,6 +381,82 @@ type Config struct {
 	// bootstrapping.
 	CAConfig *structs.CAConfiguration
 
+	// ConnectLeafExpiringSoonHorizon is how close to its expiry a leaf
+	// certificate counts towards the connect.ca.leaves.expiring_soon metric.
+	ConnectLeafExpiringSoonHorizon time.Duration
+
+	// ConnectDormantIdentityWindow is how long after its last leaf
+	// certificate was signed an identity counts towards the
+	// connect.ca.identities.dormant metric.
+	ConnectDormantIdentityWindow time.Duration
+
+	// ConnectCASignTimeout bounds how long a ConnectCA.Sign RPC waits for the
+	// CA provider to sign a leaf certificate. The msgpack RPC carries no
+	// deadline of its own, so this stands in for it.
+	ConnectCASignTimeout time.Duration
+
+	// ConnectCASecondaryRotationDebounce is how long a secondary datacenter
+	// waits after seeing the primary change its active root before renewing
+	// its intermediate, so that a rotation done in several steps only causes
+	// one renewal. Zero renews right away.
+	ConnectCASecondaryRotationDebounce time.Duration
+
+	// ConnectCAMaxCSRSize is the largest PEM-encoded CSR, in bytes, the CA
+	// accepts to sign. Larger ones are rejected with ErrInputTooLarge before
+	// being parsed. Zero disables the limit.
+	ConnectCAMaxCSRSize int
+
+	// ConnectCAMaxChainSize is the largest PEM bundle, in bytes, the CA
+	// accepts from the CA provider or the primary datacenter, such as a
+	// signed leaf and its intermediates or a new intermediate. Larger ones
+	// are rejected with ErrInputTooLarge before being parsed. Zero disables
+	// the limit.
+	ConnectCAMaxChainSize int
+
+	// ConnectCAWarmup makes a new leader check, once the CA is initialized,
+	// that the CA provider still signs with the active root on top of the
+	// throwaway signing always done, all within ConnectCAWarmupTimeout. The
+	// CA stays uninitialized, refusing to sign, when it fails.
+	ConnectCAWarmup bool
+
+	// ConnectCAWarmupTimeout bounds how long the ConnectCAWarmup checks may
+	// take, as well as warming CA providers implementing ca.Warmer.
+	ConnectCAWarmupTimeout time.Duration
+
+	// ConnectCARejectReusedSerialNumbers makes the leader refuse to hand out
+	// a leaf certificate with the serial number of another one that is still
+	// valid, whichever root they were signed under, as revocation identifies
+	// certificates by serial number. Only the leaves signed since this server
+	// became the leader are known.
+	ConnectCARejectReusedSerialNumbers bool
+
+	// ConnectCAAuditFilePath is the file the "file" CA audit sink appends the
+	// records of the signed leaf certificates to. The CA configuration only
+	// picks the type of the sink, its destination is set here so that it
+	// can't be changed through the CA configuration.
+	ConnectCAAuditFilePath string
+
+	// ConnectCAAuditURL is the HTTP or HTTPS endpoint the "http" CA audit
+	// sink POSTs the records to.
+	ConnectCAAuditURL string
+
+	// ConnectCAAuditSyslogFacility and ConnectCAAuditSyslogTag are those of
+	// the records sent by the "syslog" CA audit sink. They default to LOCAL0
+	// and consul-ca.
+	ConnectCAAuditSyslogFacility string
+	ConnectCAAuditSyslogTag      string
+
+	// ConnectCARejectCALeaves makes the leader refuse to hand out a leaf
+	// certificate that is a CA certificate or whose key usage includes
+	// certificate signing, whatever the CSR asked for. It guards against CA
+	// providers that misbehave and is enabled by default.
+	ConnectCARejectCALeaves bool
+
+	// ConnectCARootsChainValidation is how roots whose IntermediateCerts
+	// don't all chain up to their root cert, as can happen transiently during
+	// a rotation, are served by ConnectCA.Roots. See RootsChainValidation.
+	ConnectCARootsChainValidation RootsChainValidation
+
 	// ConfigEntryBootstrap contains a list of ConfigEntries to ensure are created
 	// If entries of the same Kind/Name exist already these will not update them.
 	ConfigEntryBootstrap []structs.ConfigEntry
@@ -509,6 +585,15 @@ func DefaultConfig() *Config {
 		DefaultQueryTime:         300 * time.Second,
 		MaxQueryTime:             600 * time.Second,
 
+		ConnectLeafExpiringSoonHorizon: 24 * time.Hour,
+		ConnectDormantIdentityWindow:   7 * 24 * time.Hour,
+		ConnectCASignTimeout:           10 * time.Second,
+		ConnectCAMaxCSRSize:            64 * 1024,
+		ConnectCAMaxChainSize:          1024 * 1024,
+		ConnectCAWarmupTimeout:         30 * time.Second,
+		ConnectCARejectCALeaves:        true,
+		ConnectCARootsChainValidation:  RootsChainValidationFlag,
+
 		EnterpriseConfig: DefaultEnterpriseConfig(),
 	}
 
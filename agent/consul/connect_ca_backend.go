@@ -0,0 +1,35 @@
+package consul
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/hashicorp/consul/agent/rpc/connectca"
+	"github.com/hashicorp/consul/agent/structs"
+)
+
+type connectCABackend struct {
+	srv      *Server
+	connPool GRPCClientConner
+}
+
+var _ connectca.Backend = (*connectCABackend)(nil)
+
+func (s connectCABackend) Forward(info structs.RPCInfo, f func(*grpc.ClientConn) error) (handled bool, err error) {
+	return s.srv.ForwardGRPC(s.connPool, info, f)
+}
+
+func (s connectCABackend) CARoots() (*structs.IndexedCARoots, error) {
+	if !s.srv.config.ConnectEnabled {
+		return nil, ErrConnectNotEnabled
+	}
+	return s.srv.getCARoots(nil, s.srv.fsm.State())
+}
+
+func (s connectCABackend) SignCertificate(ctx context.Context, token string, csr string, attestation []byte) (*structs.IssuedCert, error) {
+	if !s.srv.config.ConnectEnabled {
+		return nil, ErrConnectNotEnabled
+	}
+	return s.srv.authorizeAndSignCSR(ctx, token, csr, nil, structs.CAChainOrderLeafFirst, attestation)
+}
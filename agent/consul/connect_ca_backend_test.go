@@ -0,0 +1,146 @@
+package consul
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/consul/agent/connect"
+	"github.com/hashicorp/consul/agent/connect/ca"
+	grpc "github.com/hashicorp/consul/agent/grpc"
+	"github.com/hashicorp/consul/proto/pbconnectca"
+	"github.com/hashicorp/consul/testrpc"
+)
+
+func TestConnectCABackend_IntegrationWithServer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+
+	tpm := ca.NewTestTPM(t)
+	_, server := testServerWithConfig(t, func(c *Config) {
+		c.Datacenter = "dc1"
+		c.PrimaryDatacenter = "dc1"
+		c.Bootstrap = true
+		c.CAConfig.Config["TPMAttestationRoots"] = tpm.RootsPEM
+	})
+	defer server.Shutdown()
+
+	client, builder := newClientWithGRPCResolver(t)
+
+	testrpc.WaitForLeader(t, server.RPC, "dc1")
+	joinLAN(t, client, server)
+	testrpc.WaitForTestAgent(t, client.RPC, "dc1")
+
+	pool := grpc.NewClientConnPool(grpc.ClientConnPoolConfig{
+		Servers:               builder,
+		DialingFromServer:     true,
+		DialingFromDatacenter: "dc1",
+	})
+	conn, err := pool.ClientConn("dc1")
+	require.NoError(t, err)
+
+	caClient := pbconnectca.NewConnectCAServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, active, err := server.fsm.State().CARootActive(nil)
+	require.NoError(t, err)
+	require.NotNil(t, active)
+
+	t.Run("roots", func(t *testing.T) {
+		roots, err := caClient.Roots(ctx, &pbconnectca.RootsRequest{Datacenter: "dc1"})
+		require.NoError(t, err)
+		require.Equal(t, active.ID, roots.ActiveRootID)
+		require.Len(t, roots.Roots, 1)
+		require.Equal(t, active.RootCert, roots.Roots[0].RootCert)
+		require.NotNil(t, roots.Roots[0].NotAfter)
+	})
+
+	t.Run("sign", func(t *testing.T) {
+		spiffeID := connect.TestSpiffeIDService(t, "web")
+		csr, _ := connect.TestCSR(t, spiffeID)
+
+		cert, err := caClient.Sign(ctx, &pbconnectca.SignRequest{Datacenter: "dc1", CSR: csr})
+		require.NoError(t, err)
+		require.Equal(t, "web", cert.Service)
+		require.Equal(t, spiffeID.URI().String(), cert.ServiceURI)
+		require.NotNil(t, cert.ValidBefore)
+
+		// Verify that the leaf is signed by the active root.
+		require.NoError(t, connect.ValidateLeaf(active.RootCert, cert.CertPEM, nil))
+	})
+
+	t.Run("sign with an attestation", func(t *testing.T) {
+		spiffeID := connect.TestSpiffeIDService(t, "web")
+		csr, _ := connect.TestCSR(t, spiffeID)
+		attestation := tpm.Attest(t, csr)
+
+		cert, err := caClient.Sign(ctx, &pbconnectca.SignRequest{Datacenter: "dc1", CSR: csr, Attestation: attestation})
+		require.NoError(t, err)
+		require.Equal(t, "web", cert.Service)
+
+		// The attestation of another CSR is rejected.
+		other, _ := connect.TestCSR(t, spiffeID)
+		_, err = caClient.Sign(ctx, &pbconnectca.SignRequest{Datacenter: "dc1", CSR: other, Attestation: attestation})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "key attestation rejected")
+	})
+
+	t.Run("sign rejects identities from another datacenter", func(t *testing.T) {
+		spiffeID := connect.TestSpiffeIDService(t, "web")
+		spiffeID.Datacenter = "dc2"
+		csr, _ := connect.TestCSR(t, spiffeID)
+
+		_, err := caClient.Sign(ctx, &pbconnectca.SignRequest{Datacenter: "dc1", CSR: csr})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "SPIFFE ID in CSR from a different datacenter")
+	})
+}
+
+// blockingSignProvider is a CA provider whose Sign blocks until release is
+// closed.
+type blockingSignProvider struct {
+	ca.Provider
+	release chan struct{}
+}
+
+func (p *blockingSignProvider) Sign(ctx context.Context, csr *x509.CertificateRequest) (string, error) {
+	<-p.release
+	return p.Provider.Sign(ctx, csr)
+}
+
+func TestConnectCABackend_SignCertificate_Timeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+
+	_, server := testServerWithConfig(t, func(c *Config) {
+		c.ConnectCASignTimeout = 50 * time.Millisecond
+	})
+	defer server.Shutdown()
+	testrpc.WaitForActiveCARoot(t, server.RPC, "dc1", nil)
+
+	provider, root := server.caManager.getCAProvider()
+	blocking := &blockingSignProvider{Provider: provider, release: make(chan struct{})}
+	defer close(blocking.release)
+	server.caManager.setCAProvider(blocking, root)
+
+	csr, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "web"))
+
+	// The context of a gRPC client without a deadline doesn't keep the
+	// request waiting past ConnectCASignTimeout.
+	backend := connectCABackend{srv: server}
+	start := time.Now()
+	_, err := backend.SignCertificate(context.Background(), "", csr, nil)
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+	require.ErrorIs(t, err, ErrSignTimeout)
+	require.Equal(t, ErrSignTimeout.Error(), err.Error())
+}
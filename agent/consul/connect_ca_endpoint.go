@@ -1,8 +1,13 @@
 package consul
 
 import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
@@ -28,6 +33,133 @@ var (
 	ErrRateLimited          = errors.New("Rate limit reached, try again later")
 	ErrNotPrimaryDatacenter = errors.New("not the primary datacenter")
 	ErrStateReadOnly        = errors.New("CA Provider State is read-only")
+	ErrCAProviderDiverged   = errors.New("CA provider is not signing with the active root")
+
+	// ErrCANotReady is wrapped by the errors of sign requests received while
+	// the CA is still being initialized, or while its intermediate has less
+	// than MinIntermediateRemaining left. The request can be retried once
+	// initialization or the renewal of the intermediate completes.
+	ErrCANotReady = errors.New("CA is not ready yet, try again later")
+
+	// ErrSignTimeout is matched by the errors of sign requests the CA
+	// provider didn't complete within ConnectCASignTimeout, or before the
+	// deadline of the caller. The request can be retried later.
+	ErrSignTimeout = errors.New("CA provider did not sign the certificate in time, try again later")
+
+	// ErrCAMaintenance is wrapped by the errors of sign requests received
+	// while the CA is in maintenance mode, see CAManager.SetMaintenanceMode.
+	// The request can be retried once maintenance mode is disabled.
+	ErrCAMaintenance = errors.New("CA is in maintenance mode, try again later")
+
+	// ErrProviderStateCorrupt is wrapped by the error of Initialize when a
+	// built-in CA provider state is missing its checksum or doesn't match it,
+	// for example after restoring a truncated snapshot. The CA isn't
+	// initialized with it.
+	ErrProviderStateCorrupt = errors.New("CA provider state is corrupt")
+
+	// ErrProviderVersionTooOld is wrapped by the error of Initialize and
+	// ConfigurationSet when the CA provider state was written by a newer
+	// version of the provider than the one of this server, such as after a
+	// downgrade. The CA isn't initialized with it, so the state isn't
+	// damaged.
+	ErrProviderVersionTooOld = errors.New("CA provider state was written by a newer version of the provider")
+
+	// ErrTrustDomainCollision is wrapped by the error of a CA configuration
+	// update refused by its FederationCollisionPolicy, because an additional
+	// trust anchor claims the trust domain of the cluster with a key none of
+	// its roots has.
+	ErrTrustDomainCollision = errors.New("additional trust anchor collides with the trust domain of the cluster")
+
+	// ErrIntermediateRenewalStalled is wrapped by the errors of failed
+	// intermediate renewals once the intermediate is close to expiring.
+	ErrIntermediateRenewalStalled = errors.New("intermediate renewal stalled")
+
+	// ErrPublicKeySigningNotSupported is returned when asked to sign a public
+	// key without a CSR and the CA provider can't.
+	ErrPublicKeySigningNotSupported = errors.New("the CA provider does not support signing public keys without a CSR")
+
+	// ErrPublicKeyAttestationRequired is returned when asked to sign a public
+	// key without a CSR while the CA configuration requires attestations,
+	// which can only be sent along with a CSR.
+	ErrPublicKeyAttestationRequired = errors.New("the CA configuration requires an attestation of the key, which can only be sent along with a CSR")
+
+	// ErrBootstrapSigningNotSupported is returned when asked to sign a
+	// bootstrap certificate and the CA provider can't restrict its TTL and
+	// extended key usages.
+	ErrBootstrapSigningNotSupported = errors.New("the CA provider does not support signing bootstrap certificates")
+
+	// ErrCSRSignatureInvalid is wrapped by the errors returned when the
+	// signature of a CSR doesn't verify with its public key, so the requester
+	// didn't prove it holds the private key.
+	ErrCSRSignatureInvalid = errors.New("CSR signature is invalid")
+
+	// ErrActiveIntermediateEmpty is wrapped by the errors returned when the
+	// CA provider has no active intermediate to sign with, most likely
+	// because the mount or key backing it hasn't been populated.
+	ErrActiveIntermediateEmpty = errors.New("the CA provider returned an empty active intermediate")
+
+	// ErrInputTooLarge is wrapped by the errors returned when a CSR or PEM
+	// bundle is over the configured size limit, before it is parsed.
+	ErrInputTooLarge = errors.New("input too large")
+
+	// ErrMaxActiveRootsExceeded is wrapped by the errors of root rotations
+	// refused because they would keep more roots than MaxActiveRoots.
+	ErrMaxActiveRootsExceeded = errors.New("the number of CA roots would exceed MaxActiveRoots")
+
+	// ErrKeyNotStronger is wrapped by the errors of key strength upgrades
+	// refused because the requested key isn't stronger than the active one.
+	ErrKeyNotStronger = errors.New("the requested key is not stronger than the key of the active CA root")
+
+	// ErrSigningKeyIDCollision is wrapped by the errors of root rotations
+	// refused because the new root reuses the key of another root.
+	ErrSigningKeyIDCollision = errors.New("the key ID of the new CA root collides with another root")
+
+	// ErrUnknownSignOption is wrapped by the errors of sign requests with a
+	// provider sign option that the CA provider doesn't accept.
+	ErrUnknownSignOption = errors.New("unknown CA provider sign option")
+
+	// ErrIntermediateNotSignedByRoot is wrapped by the errors returned when
+	// the intermediate signed by the primary datacenter doesn't chain to the
+	// root it advertises, so that the secondary doesn't install it.
+	ErrIntermediateNotSignedByRoot = errors.New("intermediate certificate does not chain to the primary root")
+
+	// ErrIntermediateHasRootKey is wrapped by the errors returned when an
+	// intermediate has the key of the root it is signed by, which would have
+	// the root key sign leaf certificates, unless AllowSingleTier is set in
+	// the CA configuration.
+	ErrIntermediateHasRootKey = errors.New("intermediate certificate has the key of the root")
+
+	// ErrRootGenerationQuorumNotMet is wrapped by the errors returned when
+	// the initial root isn't generated because fewer operators than
+	// RootGenerationQuorum approved it.
+	ErrRootGenerationQuorumNotMet = errors.New("CA root generation quorum not met")
+
+	// ErrCAInitializationFailed is wrapped by the errors returned when the
+	// CA could not be initialized within the InitializationTimeout of its
+	// configuration.
+	ErrCAInitializationFailed = errors.New("CA failed to initialize")
+
+	// ErrSerialNumberReused is wrapped by the errors returned when the CA
+	// provider signed a leaf certificate with the serial number of another
+	// leaf certificate that is still valid, under the same root or not.
+	ErrSerialNumberReused = errors.New("serial number of the leaf certificate was already issued")
+
+	// ErrLeafIsCA is wrapped by the errors returned when the CA provider
+	// signed a leaf certificate that is a CA certificate or may sign
+	// certificates.
+	ErrLeafIsCA = errors.New("CA provider signed a leaf certificate that can sign certificates")
+
+	// ErrLeafSignerMismatch is wrapped by the errors returned when the CA
+	// provider signed a leaf certificate with another certificate than the
+	// one with the SigningKeyID of the active root, so that the chain
+	// returned with it wouldn't lead verifiers to its issuer.
+	ErrLeafSignerMismatch = errors.New("CA provider signed the leaf certificate with an unexpected certificate")
+
+	// ErrCrossSigningUnsupported is wrapped by the errors returned when a CA
+	// configuration update would rotate to a root that the current provider
+	// can't cross-sign and that proxies don't trust yet, without
+	// ForceWithoutCrossSigning set.
+	ErrCrossSigningUnsupported = errors.New("The current CA Provider does not support cross-signing")
 )
 
 const (
@@ -37,6 +169,16 @@ const (
 	// signing one cert takes much less than this) but failing requests fast when
 	// a thundering herd comes along.
 	csrLimitWait = 500 * time.Millisecond
+
+	// intermediateSignLimitWait is the maximum time a secondary's request to
+	// sign its intermediate queues for a slot when IntermediateSignMaxConcurrent
+	// is set. Unlike leaf requests these are rare and slow, so they wait
+	// longer, but still give up well before the forwarded RPC times out.
+	intermediateSignLimitWait = 10 * time.Second
+
+	// maxAdditionalSpiffeIDs is the maximum number of SPIFFE IDs a sign request
+	// can ask for on top of the ones in its CSR.
+	maxAdditionalSpiffeIDs = 4
 )
 
 // ConnectCA manages the Connect CA.
@@ -101,13 +243,308 @@ func (s *ConnectCA) ConfigurationSet(
 		return acl.ErrPermissionDenied
 	}
 
-	return s.srv.caManager.UpdateConfiguration(args)
+	return s.srv.caManager.UpdateConfigurationAs(args, authz.AccessorID())
+}
+
+// ConfigurationValidate checks a candidate CA configuration without applying
+// it, see CAManager.ValidateConfiguration.
+func (s *ConnectCA) ConfigurationValidate(
+	args *structs.CARequest,
+	reply *interface{}) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	if done, err := s.srv.ForwardRPC("ConnectCA.ConfigurationValidate", args, reply); done {
+		return err
+	}
+
+	// This action requires operator write access.
+	authz, err := s.srv.ResolveToken(args.Token)
+	if err != nil {
+		return err
+	}
+	if authz.OperatorWrite(nil) != acl.Allow {
+		return acl.ErrPermissionDenied
+	}
+
+	if args.Config == nil {
+		return fmt.Errorf("missing CA configuration")
+	}
+	return s.srv.caManager.ValidateConfiguration(args.Config)
+}
+
+// ConfigHistory returns the history of the changes to the CA configuration,
+// with the values of secrets redacted.
+func (s *ConnectCA) ConfigHistory(
+	args *structs.DCSpecificRequest,
+	reply *structs.IndexedCAConfigHistory) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	if done, err := s.srv.ForwardRPC("ConnectCA.ConfigHistory", args, reply); done {
+		return err
+	}
+
+	// This action requires operator read access, secrets are redacted.
+	authz, err := s.srv.ResolveToken(args.Token)
+	if err != nil {
+		return err
+	}
+	if authz.OperatorRead(nil) != acl.Allow {
+		return acl.ErrPermissionDenied
+	}
+
+	return s.srv.blockingQuery(
+		&args.QueryOptions, &reply.QueryMeta,
+		func(ws memdb.WatchSet, state *state.Store) error {
+			index, entries, err := state.CAConfigHistory(ws)
+			if err != nil {
+				return err
+			}
+
+			reply.Index, reply.Entries = index, entries
+			return nil
+		},
+	)
+}
+
+// Refresh makes the leader configure the CA provider again from the stored
+// configuration and provider state, without rotating the active root.
+func (s *ConnectCA) Refresh(
+	args *structs.CARequest,
+	reply *interface{}) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	if done, err := s.srv.ForwardRPC("ConnectCA.Refresh", args, reply); done {
+		return err
+	}
+
+	// This action requires operator write access.
+	authz, err := s.srv.ResolveToken(args.Token)
+	if err != nil {
+		return err
+	}
+	if authz.OperatorWrite(nil) != acl.Allow {
+		return acl.ErrPermissionDenied
+	}
+
+	return s.srv.caManager.Refresh()
+}
+
+// UpdateProviderCredentials makes the leader replace the credentials the CA
+// provider uses, without rotating the active root. See
+// CAManager.UpdateProviderCredentials.
+func (s *ConnectCA) UpdateProviderCredentials(
+	args *structs.CAUpdateProviderCredentialsRequest,
+	reply *interface{}) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	if done, err := s.srv.ForwardRPC("ConnectCA.UpdateProviderCredentials", args, reply); done {
+		return err
+	}
+
+	// This action requires operator write access.
+	authz, err := s.srv.ResolveToken(args.Token)
+	if err != nil {
+		return err
+	}
+	if authz.OperatorWrite(nil) != acl.Allow {
+		return acl.ErrPermissionDenied
+	}
+
+	return s.srv.caManager.UpdateProviderCredentials(args.Credentials)
+}
+
+// SetMaintenanceMode enables or disables CA maintenance mode, during which
+// leaf certificates aren't signed. See CAManager.SetMaintenanceMode.
+func (s *ConnectCA) SetMaintenanceMode(
+	args *structs.CASetMaintenanceModeRequest,
+	reply *interface{}) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	if done, err := s.srv.ForwardRPC("ConnectCA.SetMaintenanceMode", args, reply); done {
+		return err
+	}
+
+	// This action requires operator write access.
+	authz, err := s.srv.ResolveToken(args.Token)
+	if err != nil {
+		return err
+	}
+	if authz.OperatorWrite(nil) != acl.Allow {
+		return acl.ErrPermissionDenied
+	}
+
+	return s.srv.caManager.SetMaintenanceMode(args.Enabled)
+}
+
+// EmergencyRotateRoot makes the leader replace the active root with a new one
+// that is not cross-signed, dropping every other root. See
+// CAManager.EmergencyRotateRoot.
+func (s *ConnectCA) EmergencyRotateRoot(
+	args *structs.CARequest,
+	reply *interface{}) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	if done, err := s.srv.ForwardRPC("ConnectCA.EmergencyRotateRoot", args, reply); done {
+		return err
+	}
+
+	// This action requires operator write access.
+	authz, err := s.srv.ResolveToken(args.Token)
+	if err != nil {
+		return err
+	}
+	if authz.OperatorWrite(nil) != acl.Allow {
+		return acl.ErrPermissionDenied
+	}
+
+	return s.srv.caManager.EmergencyRotateRoot(context.Background())
+}
+
+// UpgradeKeyStrength makes the leader rotate the active root to one with a
+// stronger key. See CAManager.UpgradeKeyStrength.
+func (s *ConnectCA) UpgradeKeyStrength(
+	args *structs.CAUpgradeKeyStrengthRequest,
+	reply *interface{}) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	if done, err := s.srv.ForwardRPC("ConnectCA.UpgradeKeyStrength", args, reply); done {
+		return err
+	}
+
+	// This action requires operator write access.
+	authz, err := s.srv.ResolveToken(args.Token)
+	if err != nil {
+		return err
+	}
+	if authz.OperatorWrite(nil) != acl.Allow {
+		return acl.ErrPermissionDenied
+	}
+
+	return s.srv.caManager.UpgradeKeyStrength(args.Key)
+}
+
+// PruneRoots makes the leader remove the roots that are no longer needed to
+// validate any unexpired leaf certificate. See CAManager.PruneRoots.
+func (s *ConnectCA) PruneRoots(
+	args *structs.CARequest,
+	reply *structs.CAPruneRootsResponse) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	if done, err := s.srv.ForwardRPC("ConnectCA.PruneRoots", args, reply); done {
+		return err
+	}
+
+	// This action requires operator write access.
+	authz, err := s.srv.ResolveToken(args.Token)
+	if err != nil {
+		return err
+	}
+	if authz.OperatorWrite(nil) != acl.Allow {
+		return acl.ErrPermissionDenied
+	}
+
+	pruned, err := s.srv.caManager.PruneRoots()
+	if err != nil {
+		return err
+	}
+	reply.PrunedRootIDs = pruned
+	return nil
+}
+
+// IdentityActivity returns when the leader last signed a leaf certificate for
+// each identity, to find services that stopped renewing their certificates.
+func (s *ConnectCA) IdentityActivity(
+	args *structs.DCSpecificRequest,
+	reply *structs.CAIdentityActivityResponse) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	// Only the leader knows what it signed, so this is never served stale.
+	args.AllowStale = false
+	if done, err := s.srv.ForwardRPC("ConnectCA.IdentityActivity", args, reply); done {
+		return err
+	}
+
+	// This action requires operator read access.
+	authz, err := s.srv.ResolveToken(args.Token)
+	if err != nil {
+		return err
+	}
+	if authz.OperatorRead(nil) != acl.Allow {
+		return acl.ErrPermissionDenied
+	}
+
+	reply.Identities = s.srv.caManager.IdentityActivity()
+	return nil
+}
+
+// ApproveRootGeneration records the approval of the operator making the
+// request to generate the initial CA root. See
+// CAManager.ApproveRootGeneration.
+func (s *ConnectCA) ApproveRootGeneration(
+	args *structs.CARequest,
+	reply *structs.CARootGenerationApprovalResponse) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	if done, err := s.srv.ForwardRPC("ConnectCA.ApproveRootGeneration", args, reply); done {
+		return err
+	}
+
+	// This action requires operator write access.
+	authz, err := s.srv.ResolveToken(args.Token)
+	if err != nil {
+		return err
+	}
+	if authz.OperatorWrite(nil) != acl.Allow {
+		return acl.ErrPermissionDenied
+	}
+
+	approvals, quorum, err := s.srv.caManager.ApproveRootGeneration(authz.Identity())
+	reply.Approvals = approvals
+	reply.Quorum = quorum
+	return err
 }
 
 // Roots returns the currently trusted root certificates.
 func (s *ConnectCA) Roots(
 	args *structs.DCSpecificRequest,
 	reply *structs.IndexedCARoots) error {
+	// Roots are only written through raft, so followers serve them from their
+	// replicated state rather than forwarding this very common read to the
+	// leader, unless a consistent read is required.
+	if !args.RequireConsistent {
+		args.AllowStale = true
+	}
+
 	// Forward if necessary
 	if done, err := s.srv.ForwardRPC("ConnectCA.Roots", args, reply); done {
 		return err
@@ -132,6 +569,109 @@ func (s *ConnectCA) Roots(
 	)
 }
 
+// RootsMinimal returns the trust domain and the active CA root only. It is
+// much smaller than the response of Roots, for clients on constrained links
+// which only need to trust the active root, and supports blocking queries
+// like Roots does.
+func (s *ConnectCA) RootsMinimal(
+	args *structs.DCSpecificRequest,
+	reply *structs.IndexedCARootsMinimal) error {
+	// Forward if necessary
+	if done, err := s.srv.ForwardRPC("ConnectCA.RootsMinimal", args, reply); done {
+		return err
+	}
+
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	return s.srv.blockingQuery(
+		&args.QueryOptions, &reply.QueryMeta,
+		func(ws memdb.WatchSet, state *state.Store) error {
+			roots, err := s.srv.getCARoots(ws, state)
+			if err != nil {
+				return err
+			}
+
+			reply.Index = roots.Index
+			reply.TrustDomain = roots.TrustDomain
+			reply.ActiveRootID = roots.ActiveRootID
+			reply.ActiveRootCert = ""
+			if active := roots.Active(); active != nil {
+				reply.ActiveRootCert = active.RootCert
+			}
+			return nil
+		},
+	)
+}
+
+// SigningInfo returns the IDs of the active CA root and of the key signing
+// leaf certificates. Clients can poll it with blocking queries to learn when
+// the signing material changed, and only then fetch the roots.
+func (s *ConnectCA) SigningInfo(
+	args *structs.DCSpecificRequest,
+	reply *structs.CASigningInfo) error {
+	// Forward if necessary
+	if done, err := s.srv.ForwardRPC("ConnectCA.SigningInfo", args, reply); done {
+		return err
+	}
+
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	return s.srv.blockingQuery(
+		&args.QueryOptions, &reply.QueryMeta,
+		func(ws memdb.WatchSet, state *state.Store) error {
+			index, active, err := state.CARootActive(ws)
+			if err != nil {
+				return err
+			}
+
+			reply.Index = index
+			reply.ActiveRootID = ""
+			reply.SigningKeyID = ""
+			if active != nil {
+				reply.ActiveRootID = active.ID
+				reply.SigningKeyID = active.SigningKeyID
+			}
+			return nil
+		},
+	)
+}
+
+// ListRoots returns every CA root that has been stored, including roots that
+// were rotated out and have since been pruned, along with the window during
+// which each one was the active root.
+func (s *ConnectCA) ListRoots(
+	args *structs.DCSpecificRequest,
+	reply *structs.IndexedCARootHistory) error {
+	// Forward if necessary
+	if done, err := s.srv.ForwardRPC("ConnectCA.ListRoots", args, reply); done {
+		return err
+	}
+
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	return s.srv.blockingQuery(
+		&args.QueryOptions, &reply.QueryMeta,
+		func(ws memdb.WatchSet, state *state.Store) error {
+			index, history, err := state.CARootHistory(ws)
+			if err != nil {
+				return err
+			}
+
+			reply.Index, reply.Roots = index, history
+			return nil
+		},
+	)
+}
+
 // Sign signs a certificate for a service.
 func (s *ConnectCA) Sign(
 	args *structs.CASignRequest,
@@ -145,59 +685,377 @@ func (s *ConnectCA) Sign(
 		return err
 	}
 
-	// Parse the CSR
-	csr, err := connect.ParseCSR(args.CSR)
+	if err := args.ChainOrder.Validate(); err != nil {
+		return err
+	}
+
+	ctx := WithProviderSignOptions(context.Background(), args.ProviderSignOptions)
+	cert, err := s.srv.authorizeAndSignCSR(ctx, args.Token, args.CSR, args.AdditionalSpiffeIDs, args.ChainOrder, args.Attestation)
+	if err != nil {
+		return err
+	}
+	*reply = *cert
+	return nil
+}
+
+// SignPublicKey signs a leaf certificate for a public key and SPIFFE ID, for
+// clients that can't build a CSR. The token must be allowed to act as the
+// SPIFFE ID, like for Sign.
+func (s *ConnectCA) SignPublicKey(
+	args *structs.CASignPublicKeyRequest,
+	reply *structs.IssuedCert) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	if done, err := s.srv.ForwardRPC("ConnectCA.SignPublicKey", args, reply); done {
+		return err
+	}
+
+	if err := args.ChainOrder.Validate(); err != nil {
+		return err
+	}
+
+	pub, err := parsePublicKey(args.PublicKey)
+	if err != nil {
+		return err
+	}
+	uri, err := url.Parse(args.SpiffeID)
+	if err != nil {
+		return fmt.Errorf("invalid SPIFFE ID %q: %w", args.SpiffeID, err)
+	}
+	spiffeID, err := connect.ParseCertURI(uri)
 	if err != nil {
 		return err
 	}
 
-	// Parse the SPIFFE ID
+	authz, err := s.srv.ResolveToken(args.Token)
+	if err != nil {
+		return err
+	}
+	if err := s.srv.authorizeSpiffeID(authz, spiffeID); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.srv.config.ConnectCASignTimeout)
+	defer cancel()
+
+	cert, err := s.srv.caManager.SignPublicKeyWithContext(ctx, pub, spiffeID, args.ChainOrder)
+	if err != nil {
+		return err
+	}
+	*reply = *cert
+	return nil
+}
+
+// SignBootstrap signs a short-lived certificate, only valid for client
+// authentication, for an agent joining the cluster before it gets its real
+// identity. The CSR must only have the SPIFFE ID of the agent, and the token
+// must have node write access to it, like the agent token used to join.
+func (s *ConnectCA) SignBootstrap(
+	args *structs.CASignBootstrapRequest,
+	reply *structs.IssuedCert) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	if done, err := s.srv.ForwardRPC("ConnectCA.SignBootstrap", args, reply); done {
+		return err
+	}
+
+	csr, spiffeID, err := s.srv.authorizeCSR(args.Token, args.CSR, nil)
+	if err != nil {
+		return err
+	}
+	agentID, ok := spiffeID.(*connect.SpiffeIDAgent)
+	if !ok || len(csr.URIs) != 1 {
+		return fmt.Errorf("bootstrap CSR must only contain an agent SPIFFE ID")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.srv.config.ConnectCASignTimeout)
+	defer cancel()
+
+	cert, err := s.srv.caManager.SignBootstrapCertificate(ctx, csr, agentID, args.Attestation)
+	if err != nil {
+		return err
+	}
+	*reply = *cert
+	return nil
+}
+
+// SignWithJWT signs a leaf certificate for a workload authenticating with a
+// JWT rather than an ACL token. The JWT is validated as configured by the
+// JWTSigning field of the CA configuration, and the CSR must only have the
+// SPIFFE ID of the service the JWT grants the identity of.
+func (s *ConnectCA) SignWithJWT(
+	args *structs.CASignWithJWTRequest,
+	reply *structs.IssuedCert) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	if done, err := s.srv.ForwardRPC("ConnectCA.SignWithJWT", args, reply); done {
+		return err
+	}
+
+	if err := args.ChainOrder.Validate(); err != nil {
+		return err
+	}
+	if err := checkInputSize("CSR", len(args.CSR), s.srv.config.ConnectCAMaxCSRSize); err != nil {
+		return err
+	}
+	csr, err := connect.ParseCSR(args.CSR)
+	if err != nil {
+		return err
+	}
+	if len(csr.URIs) != 1 {
+		return fmt.Errorf("CSR must only contain the SPIFFE ID of the service")
+	}
 	spiffeID, err := connect.ParseCertURI(csr.URIs[0])
 	if err != nil {
 		return err
 	}
+	serviceID, ok := spiffeID.(*connect.SpiffeIDService)
+	if !ok {
+		return fmt.Errorf("SPIFFE ID in CSR must be a service ID")
+	}
 
-	// Verify that the ACL token provided has permission to act as this service
+	ctx, cancel := context.WithTimeout(context.Background(), s.srv.config.ConnectCASignTimeout)
+	defer cancel()
+
+	service, err := s.srv.caManager.AuthorizeJWT(ctx, args.JWT)
+	if err != nil {
+		return err
+	}
+	if serviceID.Service != service ||
+		!structs.DefaultEnterpriseMetaInDefaultPartition().IsSame(serviceID.GetEnterpriseMeta()) {
+		return fmt.Errorf("%w: the JWT grants the identity of service %q, not %s",
+			acl.ErrPermissionDenied, service, serviceID.URI())
+	}
+	if serviceID.Datacenter != s.srv.config.Datacenter {
+		return fmt.Errorf("SPIFFE ID in CSR from a different datacenter: %s, "+
+			"we are %s", serviceID.Datacenter, s.srv.config.Datacenter)
+	}
+
+	cert, err := s.srv.caManager.SignCertificateWithContext(ctx, csr, serviceID, args.ChainOrder, args.Attestation)
+	if err != nil {
+		return err
+	}
+	*reply = *cert
+	return nil
+}
+
+// parsePublicKey parses a PEM-encoded PKIX public key.
+func parsePublicKey(pemValue string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemValue))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM-encoded data found")
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("first PEM-block should be PUBLIC KEY type")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// SignSSH signs an SSH certificate with the CA provider, when it is configured
+// to act as an SSH certificate authority. Since SSH certificates grant access
+// to hosts or authenticate them, it requires operator write access.
+func (s *ConnectCA) SignSSH(
+	args *structs.SSHSignRequest,
+	reply *structs.SSHSignResponse) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	if done, err := s.srv.ForwardRPC("ConnectCA.SignSSH", args, reply); done {
+		return err
+	}
+
+	// This action requires operator write access.
 	authz, err := s.srv.ResolveToken(args.Token)
 	if err != nil {
 		return err
 	}
+	if authz.OperatorWrite(nil) != acl.Allow {
+		return acl.ErrPermissionDenied
+	}
 
-	var authzContext acl.AuthorizerContext
-	var entMeta structs.EnterpriseMeta
+	if err := args.Validate(); err != nil {
+		return err
+	}
 
-	serviceID, isService := spiffeID.(*connect.SpiffeIDService)
-	agentID, isAgent := spiffeID.(*connect.SpiffeIDAgent)
-	if !isService && !isAgent {
-		return fmt.Errorf("SPIFFE ID in CSR must be a service or agent ID")
+	cert, err := s.srv.caManager.SignSSH(args.CertType, args.PublicKey, args.Principals, args.TTL)
+	if err != nil {
+		return err
 	}
+	reply.Certificate = cert
+	return nil
+}
 
-	if isService {
-		entMeta.Merge(serviceID.GetEnterpriseMeta())
-		entMeta.FillAuthzContext(&authzContext)
-		if authz.ServiceWrite(serviceID.Service, &authzContext) != acl.Allow {
+// DryRunSign runs every check Sign makes on a CSR, including authorization,
+// without signing it or counting it against the signing rate limits. The reply
+// holds the error Sign would have failed with when the CSR is rejected.
+func (s *ConnectCA) DryRunSign(
+	args *structs.CASignRequest,
+	reply *structs.CADryRunSignResponse) error {
+	// Exit early if Connect hasn't been enabled.
+	if !s.srv.config.ConnectEnabled {
+		return ErrConnectNotEnabled
+	}
+
+	if done, err := s.srv.ForwardRPC("ConnectCA.DryRunSign", args, reply); done {
+		return err
+	}
+
+	if err := args.ChainOrder.Validate(); err != nil {
+		return err
+	}
+
+	*reply = structs.CADryRunSignResponse{Accepted: true}
+	csr, spiffeID, err := s.srv.authorizeCSR(args.Token, args.CSR, args.AdditionalSpiffeIDs)
+	if err == nil {
+		err = s.srv.caManager.DryRunSign(csr, spiffeID, args.Attestation, args.ProviderSignOptions)
+	}
+	if err != nil {
+		reply.Accepted = false
+		reply.Reason = err.Error()
+	}
+	return nil
+}
+
+// authorizeAndSignCSR authorizes the CSR with authorizeCSR and signs it,
+// returning the chain in the given order. It is shared by the msgpack-RPC and
+// gRPC Sign endpoints so both enforce the same checks. Signing gives up once
+// ctx is done or after ConnectCASignTimeout, whichever comes first, since
+// callers may not set a deadline. The attestation of the CSR key, if any, is
+// verified by the provider.
+func (s *Server) authorizeAndSignCSR(ctx context.Context, token string, csrPEM string, additionalIDs []string, order structs.CAChainOrder, attestation []byte) (*structs.IssuedCert, error) {
+	csr, spiffeID, err := s.authorizeCSR(token, csrPEM, additionalIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.ConnectCASignTimeout)
+	defer cancel()
+	return s.caManager.SignCertificateWithContext(ctx, csr, spiffeID, order, attestation)
+}
+
+// authorizeCSR parses the PEM-encoded CSR, adds the additional SPIFFE IDs to
+// it and verifies that the token is allowed to act as every SPIFFE ID it then
+// contains. It returns the CSR along with its primary SPIFFE ID.
+func (s *Server) authorizeCSR(token string, csrPEM string, additionalIDs []string) (*x509.CertificateRequest, connect.CertURI, error) {
+	if err := checkInputSize("CSR", len(csrPEM), s.config.ConnectCAMaxCSRSize); err != nil {
+		return nil, nil, err
+	}
+
+	// Parse the CSR
+	csr, err := connect.ParseCSR(csrPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(csr.URIs) == 0 {
+		return nil, nil, fmt.Errorf("CSR does not contain a SPIFFE ID")
+	}
+
+	if len(additionalIDs) > maxAdditionalSpiffeIDs {
+		return nil, nil, fmt.Errorf("at most %d additional SPIFFE IDs can be requested, got %d",
+			maxAdditionalSpiffeIDs, len(additionalIDs))
+	}
+	for _, raw := range additionalIDs {
+		uri, err := url.Parse(raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid additional SPIFFE ID %q: %w", raw, err)
+		}
+		id, err := connect.ParseCertURI(uri)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := id.(*connect.SpiffeIDService); !ok {
+			return nil, nil, fmt.Errorf("additional SPIFFE ID %q must be a service ID", raw)
+		}
+		if !containsURI(csr.URIs, uri) {
+			csr.URIs = append(csr.URIs, uri)
+		}
+	}
+
+	// Verify that the ACL token provided has permission to act as this service
+	authz, err := s.ResolveToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Every URI SAN in the CSR ends up in the signed certificate, so the token
+	// must be authorized for each identity and not just the first one.
+	var spiffeID connect.CertURI
+	for _, uri := range csr.URIs {
+		id, err := connect.ParseCertURI(uri)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := s.authorizeSpiffeID(authz, id); err != nil {
+			return nil, nil, err
+		}
+		if spiffeID == nil {
+			spiffeID = id
+		}
+	}
+
+	return csr, spiffeID, nil
+}
+
+func containsURI(uris []*url.URL, uri *url.URL) bool {
+	for _, u := range uris {
+		if u.String() == uri.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeSpiffeID verifies that the given authorizer may request a
+// certificate for the exact identity encoded in a CSR URI SAN, including its
+// namespace and partition.
+func (s *Server) authorizeSpiffeID(authz acl.Authorizer, spiffeID connect.CertURI) error {
+	var authzContext acl.AuthorizerContext
+
+	switch id := spiffeID.(type) {
+	case *connect.SpiffeIDService:
+		id.GetEnterpriseMeta().FillAuthzContext(&authzContext)
+		if authz.ServiceWrite(id.Service, &authzContext) != acl.Allow {
 			return acl.ErrPermissionDenied
 		}
 
 		// Verify that the DC in the service URI matches us. We might relax this
-		// requirement later but being restrictive for now is safer.
-		if serviceID.Datacenter != s.srv.config.Datacenter {
+		// requirement later but being restrictive for now is safer. Services of
+		// federated trust domains are in the datacenters of their cluster.
+		if id.Datacenter != s.config.Datacenter && !s.inFederatedTrustDomain(id.Host) {
 			return fmt.Errorf("SPIFFE ID in CSR from a different datacenter: %s, "+
-				"we are %s", serviceID.Datacenter, s.srv.config.Datacenter)
+				"we are %s", id.Datacenter, s.config.Datacenter)
 		}
-	} else if isAgent {
-		agentID.GetEnterpriseMeta().FillAuthzContext(&authzContext)
-		if authz.NodeWrite(agentID.Agent, &authzContext) != acl.Allow {
+	case *connect.SpiffeIDAgent:
+		id.GetEnterpriseMeta().FillAuthzContext(&authzContext)
+		if authz.NodeWrite(id.Agent, &authzContext) != acl.Allow {
 			return acl.ErrPermissionDenied
 		}
+	default:
+		return fmt.Errorf("SPIFFE ID in CSR must be a service or agent ID")
 	}
+	return nil
+}
 
-	cert, err := s.srv.caManager.SignCertificate(csr, spiffeID)
-	if err != nil {
-		return err
+// inFederatedTrustDomain returns whether host is one of the
+// FederatedTrustDomains of the current CA configuration.
+func (s *Server) inFederatedTrustDomain(host string) bool {
+	_, config, err := s.fsm.State().CAConfig(nil)
+	if err != nil || config == nil {
+		return false
 	}
-	*reply = *cert
-	return nil
+	return inFederatedTrustDomain(config, host)
 }
 
 // SignIntermediate signs an intermediate certificate for a remote datacenter.
@@ -227,17 +1085,15 @@ func (s *ConnectCA) SignIntermediate(
 		return acl.ErrPermissionDenied
 	}
 
-	provider, _ := s.srv.caManager.getCAProvider()
-	if provider == nil {
-		return fmt.Errorf("internal error: CA provider is nil")
+	if err := checkInputSize("CSR", len(args.CSR), s.srv.config.ConnectCAMaxCSRSize); err != nil {
+		return err
 	}
-
 	csr, err := connect.ParseCSR(args.CSR)
 	if err != nil {
 		return err
 	}
 
-	cert, err := provider.SignIntermediate(csr)
+	cert, err := s.srv.caManager.SignIntermediate(csr)
 	if err != nil {
 		return err
 	}
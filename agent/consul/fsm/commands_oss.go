@@ -440,6 +440,26 @@ func ApplyConnectCAOperationFromRequest(state *state.Store, req *structs.CAReque
 		}
 
 		return sn
+	case structs.CAOpRecordSeenIdentity:
+		act, err := state.CARecordSeenIdentity(index, req.SeenIdentity)
+		if err != nil {
+			return err
+		}
+
+		return act
+	case structs.CAOpPruneSeenIdentities:
+		pruned, err := state.CAPruneSeenIdentities(index, req.SeenBefore)
+		if err != nil {
+			return err
+		}
+
+		return pruned
+	case structs.CAOpRecordConfigChange:
+		if err := state.CARecordConfigChange(index, req.ConfigChange); err != nil {
+			return err
+		}
+
+		return true
 	default:
 		return fmt.Errorf("Invalid CA operation '%s'", req.Op)
 	}
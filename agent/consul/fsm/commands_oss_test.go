@@ -1297,10 +1297,11 @@ func TestFSM_CABuiltinProvider(t *testing.T) {
 		assert.True(t, fsm.Apply(makeLog(buf)).(bool))
 	}
 
-	// Verify it's in the state store.
+	// Verify it's in the state store, along with its checksum.
 	{
 		_, state, err := fsm.state.CAProviderState("foo")
 		assert.Nil(t, err)
+		expected.Checksum = expected.ComputeChecksum()
 		assert.Equal(t, expected, state)
 	}
 }
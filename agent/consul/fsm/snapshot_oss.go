@@ -24,6 +24,9 @@ func init() {
 	registerRestorer(structs.ConnectCARequestType, restoreConnectCA)
 	registerRestorer(structs.ConnectCAProviderStateType, restoreConnectCAProviderState)
 	registerRestorer(structs.ConnectCAConfigType, restoreConnectCAConfig)
+	registerRestorer(structs.ConnectCARootHistoryType, restoreConnectCARootHistory)
+	registerRestorer(structs.ConnectCASeenIdentityType, restoreConnectCASeenIdentity)
+	registerRestorer(structs.ConnectCAConfigHistoryType, restoreConnectCAConfigHistory)
 	registerRestorer(structs.IndexRequestType, restoreIndex)
 	registerRestorer(structs.ACLTokenSetRequestType, restoreToken)
 	registerRestorer(structs.ACLPolicySetRequestType, restorePolicy)
@@ -74,6 +77,15 @@ func persistOSS(s *snapshot, sink raft.SnapshotSink, encoder *codec.Encoder) err
 	if err := s.persistConnectCAConfig(sink, encoder); err != nil {
 		return err
 	}
+	if err := s.persistConnectCARootHistory(sink, encoder); err != nil {
+		return err
+	}
+	if err := s.persistConnectCASeenIdentities(sink, encoder); err != nil {
+		return err
+	}
+	if err := s.persistConnectCAConfigHistory(sink, encoder); err != nil {
+		return err
+	}
 	if err := s.persistConfigEntries(sink, encoder); err != nil {
 		return err
 	}
@@ -393,6 +405,60 @@ func (s *snapshot) persistConnectCAConfig(sink raft.SnapshotSink,
 	return nil
 }
 
+func (s *snapshot) persistConnectCARootHistory(sink raft.SnapshotSink,
+	encoder *codec.Encoder) error {
+	history, err := s.state.CARootHistory()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range history {
+		if _, err := sink.Write([]byte{byte(structs.ConnectCARootHistoryType)}); err != nil {
+			return err
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *snapshot) persistConnectCASeenIdentities(sink raft.SnapshotSink,
+	encoder *codec.Encoder) error {
+	identities, err := s.state.CASeenIdentities()
+	if err != nil {
+		return err
+	}
+
+	for _, identity := range identities {
+		if _, err := sink.Write([]byte{byte(structs.ConnectCASeenIdentityType)}); err != nil {
+			return err
+		}
+		if err := encoder.Encode(identity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *snapshot) persistConnectCAConfigHistory(sink raft.SnapshotSink,
+	encoder *codec.Encoder) error {
+	history, err := s.state.CAConfigHistory()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range history {
+		if _, err := sink.Write([]byte{byte(structs.ConnectCAConfigHistoryType)}); err != nil {
+			return err
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *snapshot) persistConnectCAProviderState(sink raft.SnapshotSink,
 	encoder *codec.Encoder) error {
 	state, err := s.state.CAProviderState()
@@ -744,6 +810,39 @@ func restoreConnectCAConfig(header *SnapshotHeader, restore *state.Restore, deco
 	return nil
 }
 
+func restoreConnectCARootHistory(header *SnapshotHeader, restore *state.Restore, decoder *codec.Decoder) error {
+	var req structs.CARootHistoryEntry
+	if err := decoder.Decode(&req); err != nil {
+		return err
+	}
+	if err := restore.CARootHistoryEntry(&req); err != nil {
+		return err
+	}
+	return nil
+}
+
+func restoreConnectCASeenIdentity(header *SnapshotHeader, restore *state.Restore, decoder *codec.Decoder) error {
+	var req structs.CASeenIdentity
+	if err := decoder.Decode(&req); err != nil {
+		return err
+	}
+	if err := restore.CASeenIdentity(&req); err != nil {
+		return err
+	}
+	return nil
+}
+
+func restoreConnectCAConfigHistory(header *SnapshotHeader, restore *state.Restore, decoder *codec.Decoder) error {
+	var req structs.CAConfigHistoryEntry
+	if err := decoder.Decode(&req); err != nil {
+		return err
+	}
+	if err := restore.CAConfigHistoryEntry(&req); err != nil {
+		return err
+	}
+	return nil
+}
+
 func restoreIndex(header *SnapshotHeader, restore *state.Restore, decoder *codec.Decoder) error {
 	var req state.IndexEntry
 	if err := decoder.Decode(&req); err != nil {
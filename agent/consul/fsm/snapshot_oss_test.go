@@ -213,6 +213,20 @@ func TestFSM_SnapshotRestore_OSS(t *testing.T) {
 	require.NoError(t, err)
 	require.True(t, ok)
 
+	require.NoError(t, fsm.state.CARecordConfigChange(16, &structs.CAConfigHistoryEntry{
+		AccessorID: "accessor",
+		Provider:   "consul",
+		Changes:    []structs.CAConfigChange{{Key: "LeafCertTTL", Previous: `"72h"`, New: `"24h"`}},
+	}))
+
+	firstSeen := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	ok, err = fsm.state.CARecordSeenIdentity(16, &structs.CASeenIdentity{
+		ID:        "spiffe://11111111-2222-3333-4444-555555555555.consul/ns/default/dc/dc1/svc/web",
+		FirstSeen: firstSeen,
+	})
+	require.NoError(t, err)
+	require.True(t, ok)
+
 	// CA Config
 	caConfig := &structs.CAConfiguration{
 		ClusterID: "foo",
@@ -697,6 +711,26 @@ func TestFSM_SnapshotRestore_OSS(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, roots, 2)
 
+	// Verify CA root history is restored.
+	_, history, err := fsm2.state.CARootHistory(nil)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.Equal(t, structs.CARoots(roots).Active().ID, history[0].ID)
+	require.True(t, history[0].Active)
+
+	// Verify CA config history is restored.
+	_, configHistory, err := fsm2.state.CAConfigHistory(nil)
+	require.NoError(t, err)
+	require.Len(t, configHistory, 1)
+	require.Equal(t, "accessor", configHistory[0].AccessorID)
+	require.Equal(t, []structs.CAConfigChange{{Key: "LeafCertTTL", Previous: `"72h"`, New: `"24h"`}}, configHistory[0].Changes)
+
+	// Verify seen identities are restored.
+	_, seen, err := fsm2.state.CASeenIdentity(nil, "spiffe://11111111-2222-3333-4444-555555555555.consul/ns/default/dc/dc1/svc/web")
+	require.NoError(t, err)
+	require.NotNil(t, seen)
+	require.Equal(t, firstSeen, seen.FirstSeen)
+
 	// Verify provider state is restored.
 	_, provider, err := fsm2.state.CAProviderState("asdf")
 	require.NoError(t, err)
@@ -3,10 +3,12 @@ package consul
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"golang.org/x/time/rate"
 
+	"github.com/hashicorp/consul/agent/connect"
 	"github.com/hashicorp/consul/agent/structs"
 	"github.com/hashicorp/consul/logging"
 	"github.com/hashicorp/go-version"
@@ -105,7 +107,11 @@ func (s *Server) pruneCARoots() error {
 
 	var newRoots structs.CARoots
 	for _, r := range roots {
-		if !r.Active && !r.RotatedOutAt.IsZero() && time.Now().Sub(r.RotatedOutAt) > common.LeafCertTTL*2 {
+		// The roots of the trust domain being migrated away from are kept
+		// until it is retired, so that its leaf certificates keep validating.
+		previousTrustDomain := common.PreviousTrustDomain != "" && r.ExternalTrustDomain != "" &&
+			strings.EqualFold(connect.SpiffeIDSigningForCluster(r.ExternalTrustDomain).Host(), common.PreviousTrustDomain)
+		if !previousTrustDomain && !r.Active && !r.RotatedOutAt.IsZero() && time.Now().Sub(r.RotatedOutAt) > common.LeafCertTTL*2 {
 			s.loggers.Named(logging.Connect).Info("pruning old unused root CA", "id", r.ID)
 			continue
 		}
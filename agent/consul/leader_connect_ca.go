@@ -1,18 +1,29 @@
 package consul
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"net/url"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-hclog"
 	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/go-version"
 	"golang.org/x/time/rate"
 
 	"github.com/hashicorp/consul/lib/semaphore"
@@ -21,6 +32,7 @@ import (
 	"github.com/hashicorp/consul/agent/connect/ca"
 	"github.com/hashicorp/consul/agent/consul/state"
 	"github.com/hashicorp/consul/agent/structs"
+	"github.com/hashicorp/consul/lib"
 	"github.com/hashicorp/consul/lib/routine"
 )
 
@@ -34,6 +46,63 @@ const (
 	caStateReconfig          caState = "RECONFIGURING"
 )
 
+// caStates lists every caState, for the connect.ca.state gauge.
+var caStates = []caState{
+	caStateUninitialized,
+	caStateInitializing,
+	caStateInitialized,
+	caStateRenewIntermediate,
+	caStateReconfig,
+}
+
+// transient returns whether the CAManager is expected to leave the state
+// shortly, as opposed to the steady UNINITIALIZED and INITIALIZED states.
+func (s caState) transient() bool {
+	return s != caStateUninitialized && s != caStateInitialized
+}
+
+// emitCAStateMetrics sets the connect.ca.state gauge to 1 for current and to
+// 0 for the other states.
+func emitCAStateMetrics(current caState) {
+	for _, s := range caStates {
+		var value float32
+		if s == current {
+			value = 1
+		}
+		metrics.SetGaugeWithLabels(metricsKeyCAState, value, []metrics.Label{{Name: "state", Value: string(s)}})
+	}
+}
+
+// caStateMetricsInterval is how often the time the CAManager has spent in its
+// current state is emitted.
+var caStateMetricsInterval = 10 * time.Second
+
+// runStateMetrics periodically emits the time spent in the current state, so
+// that being stuck in a transient state can be alerted on before the state is
+// left.
+func (c *CAManager) runStateMetrics(ctx context.Context) {
+	ticker := time.NewTicker(caStateMetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.emitCAStateDurationMetric()
+		}
+	}
+}
+
+// emitCAStateDurationMetric sets the connect.ca.state.current_seconds gauge of
+// the current state to the time spent in it.
+func (c *CAManager) emitCAStateDurationMetric() {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	metrics.SetGaugeWithLabels(metricsKeyCAStateCurrentSeconds, float32(c.timeNow().Sub(c.stateSince).Seconds()),
+		[]metrics.Label{{Name: "state", Value: string(c.state)}})
+}
+
 // caServerDelegate is an interface for server operations for facilitating
 // easier testing.
 type caServerDelegate interface {
@@ -47,6 +116,68 @@ type caServerDelegate interface {
 	generateCASignRequest(csr string) *structs.CASignRequest
 
 	ServersSupportMultiDCConnectCA() error
+	ServersMeetMinimumVersion(minVersion *version.Version) bool
+}
+
+// CAPostSignHook is called by the CAManager with every leaf certificate it
+// signed, before returning it. It can record the certificate, for example
+// with an external inventory, or amend the response. Returning an error fails
+// the signing, so that no certificate is handed out without the hook having
+// seen it.
+type CAPostSignHook interface {
+	PostSign(issued *structs.IssuedCert, id connect.CertURI) error
+}
+
+// CAEventType is the type of a CAEvent.
+type CAEventType string
+
+const (
+	// CAEventProviderConfigured is emitted when a CA provider was configured,
+	// on initialization and when the CA configuration or the provider
+	// credentials change. The operation may still fail afterwards.
+	CAEventProviderConfigured CAEventType = "ProviderConfigured"
+
+	// CAEventRootGenerated is emitted when the primary datacenter stored a
+	// new root of its provider on initialization.
+	CAEventRootGenerated CAEventType = "RootGenerated"
+
+	// CAEventIntermediateRenewed is emitted when a new intermediate was
+	// obtained to sign leaf certificates with, generated in the primary
+	// datacenter or signed by it for a secondary.
+	CAEventIntermediateRenewed CAEventType = "IntermediateRenewed"
+
+	// CAEventRotationStarted is emitted when the primary datacenter starts
+	// rotating to a new root, and CAEventRotationCompleted once the new root
+	// is active.
+	CAEventRotationStarted   CAEventType = "RotationStarted"
+	CAEventRotationCompleted CAEventType = "RotationCompleted"
+
+	// CAEventNewIdentity is emitted when the first leaf certificate of a
+	// SPIFFE identity was signed, while the CA configuration has an
+	// AuditSink.
+	CAEventNewIdentity CAEventType = "NewIdentity"
+)
+
+// CAEvent is a milestone of the lifecycle of the CA, see CAEventObserver.
+type CAEvent struct {
+	Type CAEventType
+	Time time.Time
+
+	// Provider is the name of the CA provider.
+	Provider string
+
+	// RootID is the ID of the root the event is about, if any.
+	RootID string
+
+	// Identity is the SPIFFE ID the event is about, if any.
+	Identity string `json:",omitempty"`
+}
+
+// CAEventObserver is notified by the CAManager of the milestones of the
+// lifecycle of the CA, for example to drive external automation. OnEvent is
+// called by the operation emitting the event, so it must not block.
+type CAEventObserver interface {
+	OnEvent(event CAEvent)
 }
 
 // CAManager is a wrapper around CA operations such as updating roots, an intermediate
@@ -58,6 +189,15 @@ type CAManager struct {
 	logger     hclog.Logger
 	// rate limiter to use when signing leaf certificates
 	caLeafLimiter connectSignRateLimiter
+	// rate limiter to use when signing bootstrap certificates
+	caBootstrapLimiter connectSignRateLimiter
+	// identityLimiter limits the rate of signing the leaf certificates of
+	// each identity. It is reset along with the provider.
+	identityLimiter identitySignLimiter
+	// intermediateSignLimiter limits how many intermediates of secondary
+	// datacenters are signed concurrently if IntermediateSignMaxConcurrent is
+	// set. Like csrConcurrencyLimiter it is resized on every request.
+	intermediateSignLimiter semaphore.Dynamic
 
 	providerLock sync.RWMutex
 	// provider is the current CA provider in use for Connect. This is
@@ -72,12 +212,67 @@ type CAManager struct {
 	// stateLock protects the internal state used for administrative CA tasks.
 	stateLock    sync.Mutex
 	state        caState
+	stateSince   time.Time              // When state was entered, for the connect.ca.state.seconds metric.
 	primaryRoots structs.IndexedCARoots // The most recently seen state of the root CAs from the primary datacenter.
+	leaderCtx    context.Context        // The context of the current leadership term, set by Start and canceled when it ends.
 
 	leaderRoutineManager *routine.Manager
 	// providerShim is used to test CAManager with a fake provider.
 	providerShim ca.Provider
 
+	// postSignHook is called with every leaf certificate signed, if set.
+	postSignHook CAPostSignHook
+
+	// eventObserver is notified of the milestones of the CA lifecycle, if
+	// set.
+	eventObserver CAEventObserver
+
+	// reconcileCh is used to ask the reconcile routine to initialize the CA
+	// again after the provider was found to have diverged from the active root.
+	reconcileCh chan struct{}
+
+	// providerCheckLock protects the last provider and root that
+	// verifyProviderMatchesRoot found to agree, and when it did.
+	providerCheckLock   sync.Mutex
+	providerCheckedFor  ca.Provider
+	providerCheckedRoot *structs.CARoot
+	providerCheckedAt   time.Time
+
+	// providerStateStore persists provider state values larger than
+	// providerStateSizeThreshold bytes, when it supports storing them outside
+	// of raft. It is set from Deps.CAProviderStateStore.
+	providerStateStore         ProviderStateStore
+	providerStateSizeThreshold int
+
+	// providerDeps are the optional dependencies passed to the providers.
+	// Tests set the clock and serial number source of the built-in provider
+	// through it to issue deterministic certificates.
+	providerDeps ca.ProviderDeps
+
+	// leaves indexes the leaf certificates signed while this server is the
+	// leader, for the leaf inventory metrics.
+	leaves *leafInventory
+
+	// jwtAuth validates the JWTs of ConnectCA.SignWithJWT requests.
+	jwtAuth jwtSigningAuth
+
+	// usage is the usage last reported by a provider implementing
+	// ca.UsageReporter.
+	usage providerUsage
+
+	// audit buffers the records of the signed leaf certificates for the
+	// audit sink of the CA configuration.
+	audit *caAuditor
+
+	// serviceLeafTTLs caches the leaf certificate TTLs set by service-defaults
+	// config entries.
+	serviceLeafTTLs serviceLeafTTLCache
+
+	// gatedFeatures holds the names of the CA features disabled because some
+	// servers don't support them yet, see caFeatureEnabled.
+	gatedFeaturesLock sync.Mutex
+	gatedFeatures     map[string]bool
+
 	// shim time.Now for testing
 	timeNow func() time.Time
 }
@@ -128,6 +323,13 @@ func (c *caDelegateWithState) generateCASignRequest(csr string) *structs.CASignR
 	}
 }
 
+// ServersMeetMinimumVersion returns whether every server of the local
+// datacenter is at least at minVersion.
+func (c *caDelegateWithState) ServersMeetMinimumVersion(minVersion *version.Version) bool {
+	ok, _ := ServersInDCMeetMinimumVersion(c.Server, c.Server.config.Datacenter, minVersion)
+	return ok
+}
+
 func (c *caDelegateWithState) ServersSupportMultiDCConnectCA() error {
 	versionOk, primaryFound := ServersInDCMeetMinimumVersion(c.Server, c.Server.config.PrimaryDatacenter, minMultiDCConnectVersion)
 	if !primaryFound {
@@ -145,14 +347,24 @@ func (c *caDelegateWithState) ProviderState(id string) (*structs.CAConsulProvide
 }
 
 func NewCAManager(delegate caServerDelegate, leaderRoutineManager *routine.Manager, logger hclog.Logger, config *Config) *CAManager {
-	return &CAManager{
+	c := &CAManager{
 		delegate:             delegate,
 		logger:               logger,
 		serverConf:           config,
 		state:                caStateUninitialized,
+		stateSince:           time.Now(),
 		leaderRoutineManager: leaderRoutineManager,
 		timeNow:              time.Now,
+		reconcileCh:          make(chan struct{}, 1),
+		leaves:               newLeafInventory(),
+		audit:                newCAAuditor(config),
+
+		providerStateStore:         raftProviderStateStore{},
+		providerStateSizeThreshold: defaultProviderStateSizeThreshold,
 	}
+	emitCAStateMetrics(c.state)
+	c.emitCAStateDurationMetric()
+	return c
 }
 
 // setState attempts to update the CA state to the given state.
@@ -175,12 +387,37 @@ func (c *CAManager) setState(newState caState, validateState bool) (caState, err
 		(state == caStateUninitialized && newState == caStateInitializing) ||
 		(state == caStateUninitialized && newState == caStateReconfig) {
 		c.state = newState
+		if newState != state {
+			// Emitted while holding stateLock so that the metrics change in
+			// the same order as the state.
+			now := c.timeNow()
+			if state.transient() {
+				metrics.IncrCounterWithLabels(metricsKeyCAStateSeconds, float32(now.Sub(c.stateSince).Seconds()),
+					[]metrics.Label{{Name: "state", Value: string(state)}})
+			}
+			metrics.SetGaugeWithLabels(metricsKeyCAStateCurrentSeconds, 0,
+				[]metrics.Label{{Name: "state", Value: string(state)}})
+			metrics.SetGaugeWithLabels(metricsKeyCAStateCurrentSeconds, 0,
+				[]metrics.Label{{Name: "state", Value: string(newState)}})
+			c.stateSince = now
+			emitCAStateMetrics(newState)
+		}
 	} else {
 		return state, &caStateError{Current: state}
 	}
 	return state, nil
 }
 
+// keyStorageLocation returns where provider holds the keys of the CA, for
+// operators to know what to back up, or "unknown" if it can't tell.
+func keyStorageLocation(provider ca.Provider) string {
+	location, err := provider.KeyStorageLocation()
+	if err != nil {
+		return "unknown"
+	}
+	return string(location)
+}
+
 type caStateError struct {
 	Current caState
 }
@@ -189,6 +426,54 @@ func (e *caStateError) Error() string {
 	return fmt.Sprintf("CA is already in state %q", e.Current)
 }
 
+// SetMaintenanceMode enables or disables maintenance mode, during which sign
+// requests for leaf certificates fail with ErrCAMaintenance so that nothing
+// is sent to a CA provider backend undergoing maintenance. Roots are still
+// served from the state store, and the leaf certificates already issued keep
+// working. The intermediate is still renewed when due, as letting it expire
+// would break signing once maintenance is over. The mode is stored in the CA
+// configuration so that it survives a change of leader.
+func (c *CAManager) SetMaintenanceMode(enabled bool) error {
+	store := c.delegate.State()
+	for attempt := 0; ; attempt++ {
+		_, config, err := store.CAConfig(nil)
+		if err != nil {
+			return err
+		}
+		if config == nil {
+			return fmt.Errorf("CA is not configured")
+		}
+		if config.MaintenanceMode == enabled {
+			return nil
+		}
+
+		// The write is a check-and-set on the ModifyIndex of the configuration
+		// read above, so that a concurrent update isn't overwritten.
+		newConfig := *config
+		newConfig.MaintenanceMode = enabled
+		resp, err := c.delegate.ApplyCARequest(&structs.CARequest{
+			Op:     structs.CAOpSetConfig,
+			Config: &newConfig,
+		})
+		if err != nil && !errors.Is(err, state.ErrCAConfigModifyIndexMismatch) {
+			return err
+		}
+		if respOk, ok := resp.(bool); err == nil && (!ok || respOk) {
+			break
+		}
+		if attempt >= caConfigCASRetries {
+			return fmt.Errorf("could not atomically update the CA configuration")
+		}
+	}
+
+	if enabled {
+		c.logger.Warn("CA maintenance mode enabled, refusing to sign leaf certificates")
+	} else {
+		c.logger.Info("CA maintenance mode disabled, signing leaf certificates again")
+	}
+	return nil
+}
+
 // secondarySetPrimaryRoots updates the most recently seen roots from the primary.
 func (c *CAManager) secondarySetPrimaryRoots(newRoots structs.IndexedCARoots) {
 	// TODO: this could be a different lock, as long as its the same lock in secondaryGetPrimaryRoots
@@ -224,10 +509,16 @@ func (c *CAManager) initializeCAConfig() (*structs.CAConfiguration, error) {
 		config = c.serverConf.CAConfig
 
 		if c.serverConf.Datacenter == c.serverConf.PrimaryDatacenter && config.ClusterID == "" {
-			id, err := uuid.GenerateUUID()
+			commonCfg, err := config.GetCommonConfig()
 			if err != nil {
 				return nil, err
 			}
+			id := commonCfg.TrustDomainClusterID()
+			if id == "" {
+				if id, err = uuid.GenerateUUID(); err != nil {
+					return nil, err
+				}
+			}
 			config.ClusterID = id
 		}
 	} else if _, ok := config.Config["IntermediateCertTTL"]; !ok {
@@ -278,6 +569,33 @@ func newCARoot(pemValue, provider, clusterID string) (*structs.CARoot, error) {
 	}, nil
 }
 
+// newCARootFromResult returns a filled-in structs.CARoot for the result of
+// GenerateRoot. When the provider reports an external root, that root is the
+// trust anchor and the primary CA is added to the intermediates, after the
+// certificates chaining it up to the external root.
+func newCARootFromResult(result ca.RootResult, provider, clusterID string) (*structs.CARoot, error) {
+	if result.ExternalRootCert == "" {
+		return newCARoot(result.PEM, provider, clusterID)
+	}
+
+	rootCA, err := newCARoot(ca.EnsureTrailingNewline(result.ExternalRootCert), provider, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing external root cert: %w", err)
+	}
+	for _, inter := range result.IntermediateCerts {
+		rootCA.IntermediateCerts = append(rootCA.IntermediateCerts, ca.EnsureTrailingNewline(inter))
+	}
+	primaryPEM := ca.EnsureTrailingNewline(result.PEM)
+	if err := setLeafSigningCert(rootCA, primaryPEM); err != nil {
+		return nil, err
+	}
+
+	if err := verifyChainsToRoot(primaryPEM+strings.Join(rootCA.IntermediateCerts, ""), rootCA.RootCert); err != nil {
+		return nil, fmt.Errorf("primary CA does not chain to the external root: %w", err)
+	}
+	return rootCA, nil
+}
+
 // getCAProvider returns the currently active instance of the CA Provider,
 // as well as the active root.
 func (c *CAManager) getCAProvider() (ca.Provider, *structs.CARoot) {
@@ -305,22 +623,61 @@ func (c *CAManager) getCAProvider() (ca.Provider, *structs.CARoot) {
 // which means it must never take that lock itself or call anything that does.
 func (c *CAManager) setCAProvider(newProvider ca.Provider, root *structs.CARoot) {
 	c.providerLock.Lock()
+	changed := c.provider != newProvider
 	c.provider = newProvider
 	c.providerRoot = root
 	c.providerLock.Unlock()
+
+	// Identities start afresh with a reconfigured provider, which may have
+	// different limits.
+	if changed {
+		c.identityLimiter.reset()
+	}
+}
+
+// emitEvent notifies the event observer, if any, of an event of the given
+// type.
+func (c *CAManager) emitEvent(eventType CAEventType, provider, rootID string) {
+	if c.eventObserver == nil {
+		return
+	}
+	c.eventObserver.OnEvent(CAEvent{
+		Type:     eventType,
+		Time:     c.timeNow(),
+		Provider: provider,
+		RootID:   rootID,
+	})
+}
+
+// configuredProviderName returns the name of the CA provider of the stored CA
+// configuration, for events emitted where it isn't at hand.
+func (c *CAManager) configuredProviderName() string {
+	_, conf, err := c.delegate.State().CAConfig(nil)
+	if err != nil || conf == nil {
+		return ""
+	}
+	return conf.Provider
 }
 
 func (c *CAManager) Start(ctx context.Context) {
+	c.stateLock.Lock()
+	c.leaderCtx = ctx
+	c.stateLock.Unlock()
+
 	// Attempt to initialize the Connect CA now. This will
 	// happen during leader establishment and it would be great
 	// if the CA was ready to go once that process was finished.
+	started := time.Now()
 	if err := c.Initialize(); err != nil {
 		c.logger.Error("Failed to initialize Connect CA", "error", err)
 
 		// we failed to fully initialize the CA so we need to spawn a
-		// go routine to retry this process until it succeeds or we lose
-		// leadership and the go routine gets stopped.
-		c.leaderRoutineManager.Start(ctx, backgroundCAInitializationRoutineName, c.backgroundCAInitialization)
+		// go routine to retry this process until it succeeds, gives up after
+		// the InitializationTimeout, or we lose leadership and the go routine
+		// gets stopped.
+		c.leaderRoutineManager.Start(ctx, backgroundCAInitializationRoutineName, func(ctx context.Context) error {
+			return c.backgroundCAInitialization(ctx, started)
+		})
 	} else {
 		// We only start these if CA initialization was successful. If not the completion of the
 		// background CA initialization will start these routines.
@@ -332,6 +689,12 @@ func (c *CAManager) Stop() {
 	c.leaderRoutineManager.Stop(secondaryCARootWatchRoutineName)
 	c.leaderRoutineManager.Stop(intermediateCertRenewWatchRoutineName)
 	c.leaderRoutineManager.Stop(backgroundCAInitializationRoutineName)
+	c.leaderRoutineManager.Stop(caProviderReconcileRoutineName)
+	c.leaderRoutineManager.Stop(caLeafInventoryRoutineName)
+	c.leaderRoutineManager.Stop(caProviderUsageRoutineName)
+	c.leaderRoutineManager.Stop(caAuditDeliveryRoutineName)
+	c.leaderRoutineManager.Stop(caSeenIdentityPruningRoutineName)
+	c.leaderRoutineManager.Stop(caExpiryMetricRoutineName)
 
 	if provider, _ := c.getCAProvider(); provider != nil {
 		if needsStop, ok := provider.(ca.NeedsStop); ok {
@@ -342,6 +705,8 @@ func (c *CAManager) Stop() {
 	c.setState(caStateUninitialized, false)
 	c.primaryRoots = structs.IndexedCARoots{}
 	c.setCAProvider(nil, nil)
+	c.leaves.reset()
+	c.jwtAuth.stop()
 }
 
 func (c *CAManager) startPostInitializeRoutines(ctx context.Context) {
@@ -351,15 +716,81 @@ func (c *CAManager) startPostInitializeRoutines(ctx context.Context) {
 	}
 
 	c.leaderRoutineManager.Start(ctx, intermediateCertRenewWatchRoutineName, c.runRenewIntermediate)
+	c.leaderRoutineManager.Start(ctx, caProviderReconcileRoutineName, c.runProviderReconcile)
+	c.leaderRoutineManager.Start(ctx, caLeafInventoryRoutineName, c.runLeafInventoryMetrics)
+	c.leaderRoutineManager.Start(ctx, caProviderUsageRoutineName, c.runProviderUsageMetrics)
+	c.leaderRoutineManager.Start(ctx, caAuditDeliveryRoutineName, c.runAuditDelivery)
+	c.leaderRoutineManager.Start(ctx, caSeenIdentityPruningRoutineName, c.runSeenIdentityPruning)
+	c.leaderRoutineManager.Start(ctx, caExpiryMetricRoutineName, c.runCAExpiryMetrics)
 }
 
-func (c *CAManager) backgroundCAInitialization(ctx context.Context) error {
-	retryLoopBackoffAbortOnSuccess(ctx, c.Initialize, func(err error) {
-		c.logger.Error("Failed to initialize Connect CA",
-			"routine", backgroundCAInitializationRoutineName,
-			"error", err,
-		)
-	})
+// runProviderReconcile initializes the CA again, from what is in the state
+// store, whenever signing finds that the provider diverged from the active
+// root.
+func (c *CAManager) runProviderReconcile(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.reconcileCh:
+			retryLoopBackoffAbortOnSuccess(ctx, c.reinitialize, func(err error) {
+				c.logger.Error("Failed to reconcile the CA provider with the active root",
+					"routine", caProviderReconcileRoutineName,
+					"error", err,
+				)
+			})
+		}
+	}
+}
+
+// reinitialize drops the current provider and runs Initialize again.
+func (c *CAManager) reinitialize() error {
+	var errCaState *caStateError
+	_, err := c.setState(caStateUninitialized, true)
+	switch {
+	case errors.As(err, &errCaState) && errCaState.Current == caStateUninitialized:
+		// A previous attempt failed, try again.
+	case err != nil:
+		return err
+	}
+
+	if provider, _ := c.getCAProvider(); provider != nil {
+		if needsStop, ok := provider.(ca.NeedsStop); ok {
+			needsStop.Stop()
+		}
+	}
+	c.setCAProvider(nil, nil)
+
+	if err := c.Initialize(); err != nil {
+		return err
+	}
+	c.logger.Info("Reconciled the CA provider with the active root")
+	return nil
+}
+
+// backgroundCAInitialization retries initializing the CA after the attempt
+// started at started failed. When the CA configuration sets
+// InitializationTimeout it gives up once that much time passed since
+// started.
+func (c *CAManager) backgroundCAInitialization(ctx context.Context, started time.Time) error {
+	if timeout := c.initializationTimeout(); timeout > 0 {
+		err := c.retryInitialize(ctx, started.Add(timeout), timeout)
+		if errors.Is(err, ErrCAInitializationFailed) {
+			// The configuration asked not to retry past InitializationTimeout.
+			c.logger.Error("CA failed to initialize, giving up until the next leader election or configuration change",
+				"routine", backgroundCAInitializationRoutineName,
+				"error", err,
+			)
+			return nil
+		}
+	} else {
+		retryLoopBackoffAbortOnSuccess(ctx, c.Initialize, func(err error) {
+			c.logger.Error("Failed to initialize Connect CA",
+				"routine", backgroundCAInitializationRoutineName,
+				"error", err,
+			)
+		})
+	}
 
 	if err := ctx.Err(); err != nil {
 		return err
@@ -371,9 +802,83 @@ func (c *CAManager) backgroundCAInitialization(ctx context.Context) error {
 	return nil
 }
 
+// retryInitialize calls Initialize until it succeeds, ctx is done or the
+// deadline passed, in which case it returns an error wrapping
+// ErrCAInitializationFailed. Errors that operators have to act on, such as an
+// unmet RootGenerationQuorum, don't count against the deadline. An attempt
+// the provider rate limited is retried after the longest wait.
+func (c *CAManager) retryInitialize(ctx context.Context, deadline time.Time, timeout time.Duration) error {
+	wait := initializationRetryWait
+	for {
+		err := c.Initialize()
+		if err == nil {
+			return nil
+		}
+
+		var errCaState *caStateError
+		waitsForOperator := errors.As(err, &errCaState) || errors.Is(err, ErrRootGenerationQuorumNotMet) ||
+			errors.Is(err, ErrProviderStateCorrupt) || errors.Is(err, ErrProviderVersionTooOld)
+		remaining := time.Until(deadline)
+		if !waitsForOperator && remaining <= 0 {
+			return fmt.Errorf("%w within the InitializationTimeout of %s: %v", ErrCAInitializationFailed, timeout, err)
+		}
+		c.logger.Warn("Failed to initialize Connect CA, retrying",
+			"routine", backgroundCAInitializationRoutineName,
+			"error", err,
+			"remaining", remaining,
+		)
+		if errors.Is(err, ca.ErrRateLimited) {
+			// Back off as much as we would after failing repeatedly rather
+			// than add to the load of the provider.
+			wait = maxInitializationRetryWait
+		}
+		next := wait
+		if !waitsForOperator && next > remaining {
+			next = remaining
+		}
+
+		timer := time.NewTimer(next)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if wait *= 2; wait > maxInitializationRetryWait {
+			wait = maxInitializationRetryWait
+		}
+	}
+}
+
+// initializationRetryWait is how long retryInitialize first waits before
+// retrying a failed attempt, doubling every time up to
+// maxInitializationRetryWait.
+var (
+	initializationRetryWait    = 100 * time.Millisecond
+	maxInitializationRetryWait = 5 * time.Second
+)
+
+// initializationTimeout returns the InitializationTimeout of the stored CA
+// configuration, or of the server configuration before one is stored.
+func (c *CAManager) initializationTimeout() time.Duration {
+	_, config, err := c.delegate.State().CAConfig(nil)
+	if err != nil {
+		return 0
+	}
+	if config == nil {
+		config = c.serverConf.CAConfig
+	}
+	commonCfg, err := config.GetCommonConfig()
+	if err != nil {
+		return 0
+	}
+	return commonCfg.InitializationTimeout
+}
+
 // Initialize sets up the CA provider when gaining leadership, either bootstrapping
 // the CA if this is the primary DC or making a remote RPC for intermediate signing
-// if this is a secondary DC.
+// if this is a secondary DC. It makes a single attempt, failed attempts are
+// retried by backgroundCAInitialization.
 func (c *CAManager) Initialize() (reterr error) {
 	// Bail if connect isn't enabled.
 	if !c.serverConf.ConnectEnabled {
@@ -407,1101 +912,3853 @@ func (c *CAManager) Initialize() (reterr error) {
 	if err != nil {
 		return err
 	}
+	if err := c.verifyProviderStates(); err != nil {
+		return err
+	}
 	provider, err := c.newProvider(conf)
 	if err != nil {
 		return err
 	}
+	if err := c.checkProviderVersion(provider, conf); err != nil {
+		return err
+	}
 
 	c.setCAProvider(provider, nil)
 
 	if c.serverConf.PrimaryDatacenter == c.serverConf.Datacenter {
-		return c.primaryInitialize(provider, conf)
+		err = c.primaryInitialize(provider, conf)
+	} else {
+		err = c.secondaryInitialize(provider, conf)
 	}
-	return c.secondaryInitialize(provider, conf)
-}
-
-func (c *CAManager) secondaryInitialize(provider ca.Provider, conf *structs.CAConfiguration) error {
-	if err := c.delegate.ServersSupportMultiDCConnectCA(); err != nil {
-		return fmt.Errorf("initialization will be deferred: %w", err)
+	if err != nil {
+		return err
 	}
 
-	// Get the root CA to see if we need to refresh our intermediate.
-	args := structs.DCSpecificRequest{
-		Datacenter: c.serverConf.PrimaryDatacenter,
-	}
-	var roots structs.IndexedCARoots
-	if err := c.delegate.forwardDC("ConnectCA.Roots", c.serverConf.PrimaryDatacenter, &args, &roots); err != nil {
-		return fmt.Errorf("failed to get CA roots from primary DC: %w", err)
+	// Fail here with a clear error, rather than on every signing request,
+	// when the provider has nothing to sign with.
+	if _, err := activeIntermediate(provider); err != nil {
+		c.logger.Error("CA provider has no active intermediate, refusing to sign certificates", "error", err)
+		c.setCAProvider(nil, nil)
+		return err
 	}
-	c.secondarySetPrimaryRoots(roots)
 
-	// Configure the CA provider and initialize the intermediate certificate if necessary.
-	if err := c.secondaryInitializeProvider(provider, roots); err != nil {
-		return fmt.Errorf("error configuring provider: %v", err)
+	c.warmProvider(provider)
+
+	// Make sure the provider can actually sign with the state this server
+	// loaded before accepting any signing requests.
+	if c.serverConf.ConnectCAWarmup {
+		err = c.warmup()
+	} else {
+		err = c.verifyProviderSigning()
 	}
-	if err := c.secondaryInitializeIntermediateCA(provider, nil); err != nil {
+	if err != nil {
+		c.logger.Error("CA self-check failed, refusing to sign certificates", "error", err)
+		c.setCAProvider(nil, nil)
 		return err
 	}
-
-	c.logger.Info("initialized secondary datacenter CA with provider", "provider", conf.Provider)
 	return nil
 }
 
-// createProvider returns a connect CA provider from the given config.
-func (c *CAManager) newProvider(conf *structs.CAConfiguration) (ca.Provider, error) {
-	logger := c.logger.Named(conf.Provider)
-	switch conf.Provider {
-	case structs.ConsulCAProvider:
-		return ca.NewConsulProvider(c.delegate, logger), nil
-	case structs.VaultCAProvider:
-		return ca.NewVaultProvider(logger), nil
-	case structs.AWSCAProvider:
-		return ca.NewAWSProvider(logger), nil
-	default:
-		if c.providerShim != nil {
-			return c.providerShim, nil
-		}
-		return nil, fmt.Errorf("unknown CA provider %q", conf.Provider)
+// warmProvider lets providers implementing ca.Warmer do their setup before
+// the first signing request, giving up after ConnectCAWarmupTimeout. Signing
+// does the setup instead when it fails, so errors are only logged.
+func (c *CAManager) warmProvider(provider ca.Provider) {
+	warmer, ok := provider.(ca.Warmer)
+	if !ok {
+		return
 	}
-}
+	ctx, cancel := context.WithTimeout(context.Background(), c.serverConf.ConnectCAWarmupTimeout)
+	defer cancel()
 
-// primaryInitialize runs the initialization logic for a root CA. It should only
-// be called while the state lock is held by setting the state to non-ready.
-func (c *CAManager) primaryInitialize(provider ca.Provider, conf *structs.CAConfiguration) error {
-	pCfg := ca.ProviderConfig{
-		ClusterID:  conf.ClusterID,
-		Datacenter: c.serverConf.Datacenter,
-		IsPrimary:  true,
-		RawConfig:  conf.Config,
-		State:      conf.State,
-	}
-	if err := provider.Configure(pCfg); err != nil {
-		return fmt.Errorf("error configuring provider: %v", err)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- warmer.Warm(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
 	}
-	root, err := provider.GenerateRoot()
 	if err != nil {
-		return fmt.Errorf("error generating CA root certificate: %v", err)
+		c.logger.Warn("failed to warm the CA provider, the first signing request may be slow", "error", err)
 	}
+}
 
-	rootCA, err := newCARoot(root.PEM, conf.Provider, conf.ClusterID)
-	if err != nil {
+// warmup runs warmupChecks, giving up after ConnectCAWarmupTimeout. Providers
+// don't take a context, so checks that time out keep running in the
+// background, but they don't change any state.
+func (c *CAManager) warmup() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.serverConf.ConnectCAWarmupTimeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.warmupChecks()
+	}()
+
+	select {
+	case err := <-errCh:
 		return err
+	case <-ctx.Done():
+		return fmt.Errorf("CA self-check failed: warmup did not complete within %s: %w",
+			c.serverConf.ConnectCAWarmupTimeout, ctx.Err())
 	}
+}
 
-	// TODO: https://github.com/hashicorp/consul/issues/12386
-	interPEM, err := provider.GenerateIntermediate()
-	if err != nil {
-		return fmt.Errorf("error generating intermediate cert: %v", err)
-	}
-	intermediateCert, err := connect.ParseCert(interPEM)
-	if err != nil {
-		return fmt.Errorf("error getting intermediate cert: %v", err)
+// warmupChecks checks that the provider was set up for the active root, that
+// its active intermediate is the leaf signing cert of that root and that it
+// can sign leaf certificates chaining to it, see verifyProviderSigning. The
+// provider isn't asked for an intermediate CSR, since the built-in and Vault
+// providers replace their pending key when generating one, which would break
+// the intermediate in use.
+func (c *CAManager) warmupChecks() error {
+	provider, caRoot := c.getCAProvider()
+	if provider == nil || caRoot == nil {
+		return fmt.Errorf("CA self-check failed: CA is not initialized")
 	}
 
-	// If the provider has state to persist and it's changed or new then update
-	// CAConfig.
-	pState, err := provider.State()
+	_, activeRoot, err := c.delegate.State().CARootActive(nil)
 	if err != nil {
-		return fmt.Errorf("error getting provider state: %v", err)
+		return err
 	}
-	if !reflect.DeepEqual(conf.State, pState) {
-		// Update the CAConfig in raft to persist the provider state
-		conf.State = pState
-		req := structs.CARequest{
-			Op:     structs.CAOpSetConfig,
-			Config: conf,
-		}
-		if _, err = c.delegate.ApplyCARequest(&req); err != nil {
-			return fmt.Errorf("error persisting provider state: %v", err)
-		}
+	if activeRoot == nil || activeRoot.ID != caRoot.ID {
+		return fmt.Errorf("CA self-check failed: the provider was set up for root %s which is not the active root", caRoot.ID)
+	}
+	if err := c.verifyProviderMatchesRoot(provider, activeRoot); err != nil {
+		return fmt.Errorf("CA self-check failed: %w", err)
 	}
+	return c.verifyProviderSigning()
+}
 
-	var rootUpdateRequired bool
+// verifyProviderSigning checks that the active provider can sign leaf
+// certificates chaining up to the active root, without issuing one: a leaf
+// signed only for the check would take a serial number and be recorded like
+// any other, both by Consul and by providers backed by an external CA. The
+// provider's active intermediate must chain up to the active root and, for
+// providers implementing ca.SigningKeyVerifier, match the key they sign with.
+// A provider whose state doesn't match the stored roots, for example because it
+// didn't transfer cleanly to a new leader, would otherwise hand out
+// certificates that don't validate.
+func (c *CAManager) verifyProviderSigning() error {
+	provider, caRoot := c.getCAProvider()
+	if provider == nil || caRoot == nil {
+		return fmt.Errorf("CA self-check failed: CA is not initialized")
+	}
 
-	// Versions prior to 1.9.3, 1.8.8, and 1.7.12 incorrectly used the primary
-	// rootCA's subjectKeyID here instead of the intermediate. For
-	// provider=consul this didn't matter since there are no intermediates in
-	// the primaryDC, but for vault it does matter.
-	expectedSigningKeyID := connect.EncodeSigningKeyID(intermediateCert.SubjectKeyId)
-	if rootCA.SigningKeyID != expectedSigningKeyID {
-		c.logger.Info("Correcting stored CARoot values",
-			"previous-signing-key", rootCA.SigningKeyID, "updated-signing-key", expectedSigningKeyID)
-		rootCA.SigningKeyID = expectedSigningKeyID
-		rootUpdateRequired = true
+	if verifier, ok := provider.(ca.SigningKeyVerifier); ok {
+		if err := verifier.VerifySigningKey(context.Background()); err != nil {
+			return fmt.Errorf("CA self-check failed to verify the signing key: %w", err)
+		}
 	}
 
-	// Add the local leaf signing cert to the rootCA struct. This handles both
-	// upgrades of existing state, and new rootCA.
-	if c.getLeafSigningCertFromRoot(rootCA) != interPEM {
-		rootCA.IntermediateCerts = append(rootCA.IntermediateCerts, interPEM)
-		rootUpdateRequired = true
+	chain, err := activeIntermediate(provider)
+	if err != nil {
+		return fmt.Errorf("CA self-check failed: %w", err)
+	}
+	chain = ca.EnsureTrailingNewline(chain)
+	for _, intermediate := range caRoot.IntermediateCerts {
+		chain += ca.EnsureTrailingNewline(intermediate)
 	}
+	if err := verifyChainsToRoot(chain, caRoot.RootCert); err != nil {
+		return fmt.Errorf("CA self-check failed: %w", err)
+	}
+	return nil
+}
 
-	// Check if the CA root is already initialized and exit if it is,
-	// adding on any existing intermediate certs since they aren't directly
-	// tied to the provider.
-	// Every change to the CA after this initial bootstrapping should
-	// be done through the rotation process.
-	state := c.delegate.State()
-	_, activeRoot, err := state.CARootActive(nil)
+// verifyChainsToRoot checks that the first certificate in chainPEM was issued
+// by the root in rootPEM, either directly or through the other certificates in
+// chainPEM. Validity periods are deliberately not checked, an expired root or
+// intermediate is reported when signing instead.
+func verifyChainsToRoot(chainPEM, rootPEM string) error {
+	root, err := connect.ParseCert(rootPEM)
 	if err != nil {
-		return err
+		return fmt.Errorf("error parsing root cert: %w", err)
 	}
-	if activeRoot != nil && !rootUpdateRequired {
-		// This state shouldn't be possible to get into because we update the root and
-		// CA config in the same FSM operation.
-		if activeRoot.ID != rootCA.ID {
-			return fmt.Errorf("stored CA root %q is not the active root (%s)", rootCA.ID, activeRoot.ID)
-		}
 
-		// TODO: why doesn't this c.setCAProvider(provider, activeRoot) ?
-		rootCA.IntermediateCerts = activeRoot.IntermediateCerts
-		c.setCAProvider(provider, rootCA)
+	var certs []*x509.Certificate
+	rest := []byte(chainPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("error parsing signed cert: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("provider returned no certificate")
+	}
 
-		c.logger.Info("initialized primary datacenter CA from existing CARoot with provider", "provider", conf.Provider)
-		return nil
+	current := certs[0]
+	for range certs {
+		if current.CheckSignatureFrom(root) == nil {
+			return nil
+		}
+		var issuer *x509.Certificate
+		for _, candidate := range certs[1:] {
+			if candidate != current && current.CheckSignatureFrom(candidate) == nil {
+				issuer = candidate
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		current = issuer
 	}
+	return fmt.Errorf("signed cert does not chain to the active root %q", root.Subject.String())
+}
 
-	// Get the highest index
-	idx, _, err := state.CARoots(nil)
-	if err != nil {
-		return err
+func (c *CAManager) secondaryInitialize(provider ca.Provider, conf *structs.CAConfiguration) error {
+	// A secondary gets its roots and intermediate from the primary, so there
+	// is no point going further without knowing which datacenter that is.
+	if c.serverConf.PrimaryDatacenter == "" {
+		return fmt.Errorf("primary_datacenter is not set: datacenter %q needs it to get its CA roots and intermediate from the primary datacenter",
+			c.serverConf.Datacenter)
 	}
 
-	// Store the root cert in raft
-	_, err = c.delegate.ApplyCARequest(&structs.CARequest{
-		Op:    structs.CAOpSetRoots,
-		Index: idx,
-		Roots: []*structs.CARoot{rootCA},
-	})
-	if err != nil {
-		return fmt.Errorf("raft apply failed: %w", err)
+	if err := c.delegate.ServersSupportMultiDCConnectCA(); err != nil {
+		return fmt.Errorf("initialization will be deferred: %w", err)
 	}
 
-	c.setCAProvider(provider, rootCA)
+	// Get the root CA to see if we need to refresh our intermediate. This is
+	// the first request to the primary, so it also checks it is reachable.
+	args := structs.DCSpecificRequest{
+		Datacenter: c.serverConf.PrimaryDatacenter,
+	}
+	var roots structs.IndexedCARoots
+	if err := c.delegate.forwardDC("ConnectCA.Roots", c.serverConf.PrimaryDatacenter, &args, &roots); err != nil {
+		return fmt.Errorf("failed to get CA roots from primary DC %q, check that primary_datacenter is correct and reachable: %w",
+			c.serverConf.PrimaryDatacenter, err)
+	}
+	c.secondarySetPrimaryRoots(roots)
 
-	c.logger.Info("initialized primary datacenter CA with provider", "provider", conf.Provider)
+	// Configure the CA provider and initialize the intermediate certificate if necessary.
+	if err := c.secondaryInitializeProvider(provider, roots); err != nil {
+		return fmt.Errorf("error configuring provider: %v", err)
+	}
+	if err := c.secondaryInitializeIntermediateCA(provider, nil); err != nil {
+		return err
+	}
 
+	c.logger.Info("initialized secondary datacenter CA with provider",
+		"provider", conf.Provider,
+		"key_location", keyStorageLocation(provider),
+	)
 	return nil
 }
 
-// getLeafSigningCertFromRoot returns the PEM encoded certificate that should be used to
-// sign leaf certificates in the local datacenter. The SubjectKeyId of the
-// returned cert should always match the SigningKeyID of the CARoot.
-//
-// TODO: fix the data model so that we don't need this complicated lookup to
-// find the leaf signing cert. See github.com/hashicorp/consul/issues/11347.
-func (c *CAManager) getLeafSigningCertFromRoot(root *structs.CARoot) string {
-	if !c.isIntermediateUsedToSignLeaf() {
-		return root.RootCert
-	}
-	if len(root.IntermediateCerts) == 0 {
-		return ""
+// createProvider returns a connect CA provider from the given config.
+func (c *CAManager) newProvider(conf *structs.CAConfiguration) (ca.Provider, error) {
+	logger := c.logger.Named(conf.Provider)
+	switch conf.Provider {
+	case structs.ConsulCAProvider:
+		return ca.NewConsulProviderWithDeps(c.delegate, logger, c.providerDeps), nil
+	case structs.VaultCAProvider:
+		return ca.NewVaultProviderWithDeps(logger, c.providerDeps), nil
+	case structs.AWSCAProvider:
+		return ca.NewAWSProviderWithDeps(logger, c.providerDeps), nil
+	default:
+		if c.providerShim != nil {
+			return c.providerShim, nil
+		}
+		return nil, fmt.Errorf("unknown CA provider %q", conf.Provider)
 	}
-	return root.IntermediateCerts[len(root.IntermediateCerts)-1]
 }
 
-// secondaryInitializeIntermediateCA generates a Certificate Signing Request (CSR)
-// for the intermediate CA that is used to sign leaf certificates in the secondary.
-// The CSR is signed by the primary DC and then persisted in the state store.
-//
-// This method should only be called while the state lock is held by setting the
-// state to non-ready.
-func (c *CAManager) secondaryInitializeIntermediateCA(provider ca.Provider, config *structs.CAConfiguration) error {
-	activeIntermediate, err := provider.ActiveIntermediate()
+// Refresh configures a new instance of the provider from the CA configuration
+// and provider state in the state store, for example after the CA backing the
+// provider was fixed out of band. Secondary datacenters also fetch the roots of
+// the primary again. The active root is left as is, so Refresh fails if the
+// provider doesn't sign with it anymore, which needs a configuration update or
+// a new intermediate instead.
+func (c *CAManager) Refresh() error {
+	oldState, err := c.setState(caStateReconfig, true)
 	if err != nil {
 		return err
 	}
+	defer c.setState(oldState, false)
 
-	_, activeRoot, err := c.delegate.State().CARootActive(nil)
+	if oldState != caStateInitialized {
+		return fmt.Errorf("CA is not initialized")
+	}
+
+	_, conf, err := c.delegate.State().CAConfig(nil)
 	if err != nil {
 		return err
 	}
-	var currentSigningKeyID string
-	if activeRoot != nil {
-		currentSigningKeyID = activeRoot.SigningKeyID
+	if conf == nil {
+		return fmt.Errorf("CA is not configured")
 	}
 
-	var expectedSigningKeyID string
-	if activeIntermediate != "" {
-		intermediateCert, err := connect.ParseCert(activeIntermediate)
-		if err != nil {
-			return fmt.Errorf("error parsing active intermediate cert: %v", err)
-		}
-		expectedSigningKeyID = connect.EncodeSigningKeyID(intermediateCert.SubjectKeyId)
+	if err := c.replaceProvider(conf, nil); err != nil {
+		return err
 	}
+	c.logger.Info("refreshed CA provider", "provider", conf.Provider)
+	return nil
+}
 
-	newActiveRoot, err := c.secondaryGetActivePrimaryCARoot()
+// providerCredentialFields are the configuration fields of each provider that
+// UpdateProviderCredentials can change.
+var providerCredentialFields = map[string][]string{
+	structs.VaultCAProvider: {"Token", "AuthMethod"},
+}
+
+// UpdateProviderCredentials replaces the credentials the provider uses to
+// reach its backing CA, such as the Vault token after it was rotated out of
+// band, and configures the provider again in place. Unlike
+// UpdateConfiguration it never rotates the root, and only credential fields
+// can be changed. The provider is only swapped, and the new credentials only
+// persisted, once it's verified to work with them.
+func (c *CAManager) UpdateProviderCredentials(creds map[string]interface{}) error {
+	oldState, err := c.setState(caStateReconfig, true)
 	if err != nil {
 		return err
 	}
+	defer c.setState(oldState, false)
 
-	// Get a signed intermediate from the primary DC if the provider
-	// hasn't been initialized yet or if the primary's root has changed.
-	needsNewIntermediate := activeIntermediate == ""
-	if activeRoot != nil && newActiveRoot.ID != activeRoot.ID {
-		needsNewIntermediate = true
+	if oldState != caStateInitialized {
+		return fmt.Errorf("CA is not initialized")
 	}
 
-	// Also we take this opportunity to correct an incorrectly persisted SigningKeyID
-	// in secondary datacenters (see PR-6513).
-	if expectedSigningKeyID != "" && currentSigningKeyID != expectedSigningKeyID {
-		needsNewIntermediate = true
+	_, conf, err := c.delegate.State().CAConfig(nil)
+	if err != nil {
+		return err
+	}
+	if conf == nil {
+		return fmt.Errorf("CA is not configured")
 	}
 
-	if needsNewIntermediate {
-		if err := c.secondaryRequestNewSigningCert(provider, newActiveRoot); err != nil {
-			return err
+	fields, ok := providerCredentialFields[conf.Provider]
+	if !ok {
+		return fmt.Errorf("the %s CA provider has no credentials that can be updated", conf.Provider)
+	}
+	if len(creds) == 0 {
+		return fmt.Errorf("no credentials given")
+	}
+
+	newConf := *conf
+	newConf.Config = make(map[string]interface{}, len(conf.Config)+len(creds))
+	for k, v := range conf.Config {
+		newConf.Config[k] = v
+	}
+	for k, v := range creds {
+		field := ""
+		for _, f := range fields {
+			if strings.EqualFold(k, f) {
+				field = f
+				break
+			}
 		}
-	} else {
-		// Discard the primary's representation since our local one is
-		// sufficiently up to date.
-		newActiveRoot = activeRoot
+		if field == "" {
+			return fmt.Errorf("%q is not a credential of the %s CA provider", k, conf.Provider)
+		}
+		// Drop the field under any other spelling so it can't shadow the new
+		// value.
+		for existing := range newConf.Config {
+			if strings.EqualFold(existing, field) {
+				delete(newConf.Config, existing)
+			}
+		}
+		newConf.Config[field] = v
 	}
 
-	// Determine whether a root update is needed, and persist the roots/config accordingly.
-	var newRoot *structs.CARoot
-	if activeRoot == nil || needsNewIntermediate {
-		newRoot = newActiveRoot
+	persist := func() error {
+		resp, err := c.delegate.ApplyCARequest(&structs.CARequest{
+			Op:     structs.CAOpSetConfig,
+			Config: &newConf,
+		})
+		if err != nil {
+			return err
+		}
+		if respOk, ok := resp.(bool); ok && !respOk {
+			return fmt.Errorf("CA configuration changed while updating the provider credentials")
+		}
+		return nil
 	}
-	if err := c.persistNewRootAndConfig(provider, newRoot, config); err != nil {
+	if err := c.replaceProvider(&newConf, persist); err != nil {
 		return err
 	}
-
-	c.setCAProvider(provider, newActiveRoot)
+	c.logger.Info("updated CA provider credentials", "provider", conf.Provider)
 	return nil
 }
 
-// persistNewRootAndConfig should only be called while the state lock is held
-// by setting the state to non-ready.
-// If newActiveRoot is non-nil, it will be appended to the current roots list.
-// If config is non-nil, it will be used to overwrite the existing config.
-func (c *CAManager) persistNewRootAndConfig(provider ca.Provider, newActiveRoot *structs.CARoot, config *structs.CAConfiguration) error {
-	state := c.delegate.State()
-	idx, oldRoots, err := state.CARoots(nil)
-	if err != nil {
-		return err
+// replaceProvider configures a new instance of the provider from conf and
+// makes it the active provider once it's verified to sign with the active
+// root, calling beforeSwap first when it's not nil. Secondary datacenters also
+// fetch the roots of the primary again. It must be called while the state
+// lock is held by setting the state to non-ready.
+func (c *CAManager) replaceProvider(conf *structs.CAConfiguration, beforeSwap func() error) error {
+	oldProvider, _ := c.getCAProvider()
+	if oldProvider == nil {
+		return fmt.Errorf("CA is not initialized")
 	}
 
-	// Look up the existing CA config if a new one wasn't provided.
-	var newConf structs.CAConfiguration
-	_, storedConfig, err := state.CAConfig(nil)
+	_, activeRoot, err := c.delegate.State().CARootActive(nil)
 	if err != nil {
 		return err
 	}
-	if storedConfig == nil {
-		return fmt.Errorf("local CA not initialized yet")
-	}
-	// Exit early if the change is a no-op.
-	if newActiveRoot == nil && config != nil && config.Provider == storedConfig.Provider && reflect.DeepEqual(config.Config, storedConfig.Config) {
-		return nil
+	if activeRoot == nil {
+		return fmt.Errorf("no active root CA")
 	}
 
-	if config != nil {
-		newConf = *config
-	} else {
-		newConf = *storedConfig
+	provider, err := c.newProvider(conf)
+	if err != nil {
+		return err
+	}
+	stopProvider := func(p ca.Provider) {
+		if needsStop, ok := p.(ca.NeedsStop); ok && p != oldProvider {
+			needsStop.Stop()
+		}
 	}
 
-	// Update the trust domain for the config if there's a new root, or keep the old
-	// one if the root isn't being updated.
-	newConf.ModifyIndex = storedConfig.ModifyIndex
-	if newActiveRoot != nil {
-		newConf.ClusterID = newActiveRoot.ExternalTrustDomain
-	} else {
-		_, activeRoot, err := state.CARootActive(nil)
+	var primaryRoots structs.IndexedCARoots
+	if c.serverConf.PrimaryDatacenter == c.serverConf.Datacenter {
+		providerState, err := c.resolveProviderState(conf.State, conf.StateRefs)
 		if err != nil {
 			return err
 		}
-		newConf.ClusterID = activeRoot.ExternalTrustDomain
+		pCfg := ca.ProviderConfig{
+			ClusterID:  conf.ClusterID,
+			Datacenter: c.serverConf.Datacenter,
+			IsPrimary:  true,
+			RawConfig:  conf.Config,
+			State:      providerState,
+		}
+		if err := provider.Configure(pCfg); err != nil {
+			stopProvider(provider)
+			return fmt.Errorf("error configuring provider: %v", err)
+		}
+		c.emitEvent(CAEventProviderConfigured, conf.Provider, activeRoot.ID)
+	} else {
+		args := structs.DCSpecificRequest{
+			Datacenter: c.serverConf.PrimaryDatacenter,
+		}
+		if err := c.delegate.forwardDC("ConnectCA.Roots", c.serverConf.PrimaryDatacenter, &args, &primaryRoots); err != nil {
+			return fmt.Errorf("failed to get CA roots from primary DC: %w", err)
+		}
+		if err := c.secondaryInitializeProvider(provider, primaryRoots); err != nil {
+			stopProvider(provider)
+			return fmt.Errorf("error configuring provider: %v", err)
+		}
 	}
 
-	// Persist any state the provider needs us to
-	newConf.State, err = provider.State()
-	if err != nil {
-		return fmt.Errorf("error getting provider state: %v", err)
+	root := activeRoot.Clone()
+	if err := c.verifyProviderMatchesRoot(provider, root); err != nil {
+		stopProvider(provider)
+		return fmt.Errorf("reconfigured provider can't be used with the active root: %w", err)
 	}
 
-	// If there's a new active root, copy the root list and append it, updating
-	// the old root with the time it was rotated out.
-	var newRoots structs.CARoots
-	for _, r := range oldRoots {
-		newRoot := *r
-		if newRoot.Active && newActiveRoot != nil {
-			newRoot.Active = false
-			newRoot.RotatedOutAt = c.timeNow()
-		}
-		if newRoot.ExternalTrustDomain == "" {
-			newRoot.ExternalTrustDomain = newConf.ClusterID
+	if beforeSwap != nil {
+		if err := beforeSwap(); err != nil {
+			stopProvider(provider)
+			return err
 		}
-		newRoots = append(newRoots, &newRoot)
-	}
-	if newActiveRoot != nil {
-		newRoots = append(newRoots, newActiveRoot)
 	}
 
-	args := &structs.CARequest{
-		Op:     structs.CAOpSetRootsAndConfig,
-		Index:  idx,
-		Roots:  newRoots,
-		Config: &newConf,
+	if c.serverConf.PrimaryDatacenter != c.serverConf.Datacenter {
+		c.secondarySetPrimaryRoots(primaryRoots)
 	}
-	resp, err := c.delegate.ApplyCARequest(args)
+	c.setCAProvider(provider, root)
+	if needsStop, ok := oldProvider.(ca.NeedsStop); ok && oldProvider != provider {
+		needsStop.Stop()
+	}
+	return nil
+}
+
+// caProviderConfigsEqual reports whether two raw configurations for the given
+// provider are effectively the same once defaults are applied and values such
+// as durations are normalized, for example "72h" and "72h0m0s". Tools that
+// re-apply the same configuration shouldn't cause the CA to be reconfigured.
+func caProviderConfigsEqual(provider string, a, b map[string]interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+
+	parse := caProviderConfigParser(provider)
+	if parse == nil {
+		return false
+	}
+
+	// Leave invalid configurations for the provider to report.
+	parsedA, err := parse(a)
 	if err != nil {
-		return err
+		return false
 	}
-	if respOk, ok := resp.(bool); ok && !respOk {
-		return fmt.Errorf("could not atomically update roots and config")
+	parsedB, err := parse(b)
+	if err != nil {
+		return false
 	}
+	return reflect.DeepEqual(parsedA, parsedB)
+}
 
-	c.logger.Info("updated root certificates from primary datacenter")
+// caProviderConfigParser returns the function parsing and validating raw
+// configurations of the given provider, or nil for unknown providers.
+func caProviderConfigParser(provider string) func(map[string]interface{}) (interface{}, error) {
+	switch provider {
+	case structs.ConsulCAProvider:
+		return func(raw map[string]interface{}) (interface{}, error) { return ca.ParseConsulCAConfig(raw) }
+	case structs.VaultCAProvider:
+		return func(raw map[string]interface{}) (interface{}, error) { return ca.ParseVaultCAConfig(raw) }
+	case structs.AWSCAProvider:
+		return func(raw map[string]interface{}) (interface{}, error) { return ca.ParseAWSCAConfig(raw) }
+	}
 	return nil
 }
 
-func (c *CAManager) UpdateConfiguration(args *structs.CARequest) (reterr error) {
-	// Attempt to update the state first.
-	oldState, err := c.setState(caStateReconfig, true)
+// primaryInitialize runs the initialization logic for a root CA. It should only
+// be called while the state lock is held by setting the state to non-ready.
+func (c *CAManager) primaryInitialize(provider ca.Provider, conf *structs.CAConfiguration) error {
+	providerState, err := c.resolveProviderState(conf.State, conf.StateRefs)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		// Using named return values in deferred funcs isnt too common in our code
-		// but it is first class Go functionality. The error erturned from the
-		// main func will be available by its given name within deferred functions.
-		// See: https://blog.golang.org/defer-panic-and-recover
-		if reterr == nil {
-			c.setState(caStateInitialized, false)
-		} else {
-			c.setState(oldState, false)
-		}
-	}()
+	pCfg := ca.ProviderConfig{
+		ClusterID:  conf.ClusterID,
+		Datacenter: c.serverConf.Datacenter,
+		IsPrimary:  true,
+		RawConfig:  conf.Config,
+		State:      providerState,
+	}
+	if err := provider.Configure(pCfg); err != nil {
+		return fmt.Errorf("error configuring provider: %v", err)
+	}
+	c.emitEvent(CAEventProviderConfigured, conf.Provider, "")
+	// Don't block initialization on limits that were only introduced after the
+	// configuration was accepted, UpdateConfiguration rejects them.
+	if err := checkProviderTTLLimits(provider, conf); err != nil {
+		c.logger.Warn("CA configuration exceeds the limits of the provider", "error", err)
+	}
+	if err := c.checkRootGenerationQuorum(conf); err != nil {
+		return err
+	}
+	root, err := provider.GenerateRoot()
+	if err != nil {
+		return fmt.Errorf("error generating CA root certificate: %v", err)
+	}
 
-	// Attempt to initialize the config if we failed to do so in Initialize for some reason
-	prevConfig, err := c.initializeCAConfig()
+	rootCA, err := newCARootFromResult(root, conf.Provider, conf.ClusterID)
 	if err != nil {
 		return err
 	}
 
-	// Exit early if it's a no-op change
-	state := c.delegate.State()
-	_, config, err := state.CAConfig(nil)
+	// TODO: https://github.com/hashicorp/consul/issues/12386
+	interPEM, err := c.generateIntermediate(context.Background(), provider)
 	if err != nil {
-		return err
+		return fmt.Errorf("error generating intermediate cert: %v", err)
+	}
+	intermediateCert, err := connect.ParseCert(interPEM)
+	if err != nil {
+		return fmt.Errorf("error getting intermediate cert: %v", err)
 	}
 
-	// Don't allow state changes. Either it needs to be empty or the same to allow
-	// read-modify-write loops that don't touch the State field.
-	if len(args.Config.State) > 0 &&
-		!reflect.DeepEqual(args.Config.State, config.State) {
-		return ErrStateReadOnly
+	// If the provider has state to persist and it's changed or new then update
+	// CAConfig.
+	pState, err := provider.State()
+	if err != nil {
+		return fmt.Errorf("error getting provider state: %v", err)
+	}
+	// Also record that this version of the provider now owns the state.
+	if version := providerVersion(provider); !reflect.DeepEqual(providerState, pState) || conf.ProviderVersion != version {
+		// Update the CAConfig in raft to persist the provider state
+		conf.State, conf.StateRefs, err = c.externalizeProviderState(conf.Provider, rootCA.ID, pState)
+		if err != nil {
+			return err
+		}
+		conf.ProviderVersion = version
+		req := structs.CARequest{
+			Op:     structs.CAOpSetConfig,
+			Config: conf,
+		}
+		if _, err = c.delegate.ApplyCARequest(&req); err != nil {
+			return fmt.Errorf("error persisting provider state: %v", err)
+		}
 	}
 
-	// Don't allow users to change the ClusterID.
-	args.Config.ClusterID = config.ClusterID
-	if args.Config.Provider == config.Provider && reflect.DeepEqual(args.Config.Config, config.Config) {
-		return nil
+	var rootUpdateRequired bool
+
+	// Versions prior to 1.9.3, 1.8.8, and 1.7.12 incorrectly used the primary
+	// rootCA's subjectKeyID here instead of the intermediate. For
+	// provider=consul this didn't matter since there are no intermediates in
+	// the primaryDC, but for vault it does matter.
+	expectedSigningKeyID := connect.EncodeSigningKeyID(intermediateCert.SubjectKeyId)
+	if rootCA.SigningKeyID != expectedSigningKeyID {
+		c.logger.Info("Correcting stored CARoot values",
+			"previous-signing-key", rootCA.SigningKeyID, "updated-signing-key", expectedSigningKeyID)
+		rootCA.SigningKeyID = expectedSigningKeyID
+		rootUpdateRequired = true
 	}
 
-	// If the provider hasn't changed, we need to load the current Provider state
-	// so it can decide if it needs to change resources or not based on the config
-	// change.
-	if args.Config.Provider == config.Provider {
-		// Note this is a shallow copy since the State method doc requires the
-		// provider return a map that will not be further modified and should not
-		// modify the one we pass to Configure.
-		args.Config.State = config.State
+	// Add the local leaf signing cert to the rootCA struct. This handles both
+	// upgrades of existing state, and new rootCA. The provider isn't active
+	// yet, so look at this one rather than calling getLeafSigningCertFromRoot.
+	leafSigningCert := rootCA.RootCert
+	if primaryUsesIntermediate(provider) && len(rootCA.IntermediateCerts) > 0 {
+		leafSigningCert = rootCA.IntermediateCerts[len(rootCA.IntermediateCerts)-1]
+	}
+	if leafSigningCert != interPEM {
+		rootCA.IntermediateCerts = append(rootCA.IntermediateCerts, interPEM)
+		rootUpdateRequired = true
 	}
 
-	// Create a new instance of the provider described by the config
-	// and get the current active root CA. This acts as a good validation
-	// of the config and makes sure the provider is functioning correctly
-	// before we commit any changes to Raft.
-	newProvider, err := c.newProvider(args.Config)
+	state := c.delegate.State()
+	_, activeRoot, err := state.CARootActive(nil)
 	if err != nil {
-		return fmt.Errorf("could not initialize provider: %v", err)
+		return err
 	}
-	pCfg := ca.ProviderConfig{
-		ClusterID:  args.Config.ClusterID,
-		Datacenter: c.serverConf.Datacenter,
-		// This endpoint can be called in a secondary DC too so set this correctly.
-		IsPrimary: c.serverConf.Datacenter == c.serverConf.PrimaryDatacenter,
-		RawConfig: args.Config.Config,
-		State:     args.Config.State,
+
+	// Repair a stored root which lost the leaf signing cert matching its
+	// SigningKeyID, for example after a partial restore, since signing would
+	// fail for as long as it is active. The intermediates it already has are
+	// kept for the leaves they signed.
+	if activeRoot != nil && activeRoot.ID == rootCA.ID &&
+		!hasLeafSigningCert(activeRoot, primaryUsesIntermediate(provider), expectedSigningKeyID) {
+		c.logger.Warn("Repairing the active CA root, its leaf signing cert is missing",
+			"root_id", activeRoot.ID,
+			"signing_key_id", activeRoot.SigningKeyID,
+			"expected_signing_key_id", expectedSigningKeyID,
+		)
+		if primaryUsesIntermediate(provider) {
+			intermediates := make([]string, 0, len(activeRoot.IntermediateCerts)+1)
+			intermediates = append(intermediates, activeRoot.IntermediateCerts...)
+			rootCA.IntermediateCerts = append(intermediates, interPEM)
+		}
+		rootUpdateRequired = true
 	}
 
-	if args.Config.Provider == config.Provider {
-		if validator, ok := newProvider.(ValidateConfigUpdater); ok {
-			if err := validator.ValidateConfigUpdate(prevConfig.Config, args.Config.Config); err != nil {
-				return fmt.Errorf("new configuration is incompatible with previous configuration: %w", err)
-			}
+	// Check if the CA root is already initialized and exit if it is,
+	// adding on any existing intermediate certs since they aren't directly
+	// tied to the provider.
+	// Every change to the CA after this initial bootstrapping should
+	// be done through the rotation process.
+	if activeRoot != nil && !rootUpdateRequired {
+		// This state shouldn't be possible to get into because we update the root and
+		// CA config in the same FSM operation.
+		if activeRoot.ID != rootCA.ID {
+			return fmt.Errorf("stored CA root %q is not the active root (%s)", rootCA.ID, activeRoot.ID)
 		}
+
+		// TODO: why doesn't this c.setCAProvider(provider, activeRoot) ?
+		rootCA.IntermediateCerts = activeRoot.IntermediateCerts
+		rootCA.ActivatedAt = activeRoot.ActivatedAt
+		rootCA.RotationReason = activeRoot.RotationReason
+		c.setCAProvider(provider, rootCA)
+
+		c.logger.Info("initialized primary datacenter CA from existing CARoot with provider",
+			"provider", conf.Provider,
+			"key_location", keyStorageLocation(provider),
+		)
+		return nil
 	}
 
-	if err := newProvider.Configure(pCfg); err != nil {
-		return fmt.Errorf("error configuring provider: %v", err)
+	// Get the highest index
+	idx, _, err := state.CARoots(nil)
+	if err != nil {
+		return err
 	}
 
-	cleanupNewProvider := func() {
-		if err := newProvider.Cleanup(args.Config.Provider != config.Provider, args.Config.Config); err != nil {
-			c.logger.Warn("failed to clean up CA provider while handling startup failure", "provider", newProvider, "error", err)
-		}
+	rootCA.ActivatedAt = c.timeNow().Round(0)
+	if activeRoot != nil && activeRoot.ID == rootCA.ID {
+		rootCA.ActivatedAt = activeRoot.ActivatedAt
+		rootCA.RotationReason = activeRoot.RotationReason
+	} else if activeRoot != nil {
+		rootCA.RotationReason = structs.CARotationReasonRecovery
+		c.logger.Warn("replacing the active CA root with the root of the provider",
+			"old_root_id", activeRoot.ID,
+			"new_root_id", rootCA.ID,
+			"rotation_reason", rootCA.RotationReason,
+		)
 	}
 
-	// If this is a secondary, just check if the intermediate needs to be regenerated.
-	if c.serverConf.Datacenter != c.serverConf.PrimaryDatacenter {
-		if err := c.secondaryInitializeIntermediateCA(newProvider, args.Config); err != nil {
-			cleanupNewProvider()
-			return fmt.Errorf("Error updating secondary datacenter CA config: %v", err)
-		}
-		c.logger.Info("Secondary CA provider config updated")
-		return nil
+	// Store the root cert in raft
+	_, err = c.delegate.ApplyCARequest(&structs.CARequest{
+		Op:    structs.CAOpSetRoots,
+		Index: idx,
+		Roots: []*structs.CARoot{rootCA},
+	})
+	if err != nil {
+		return fmt.Errorf("raft apply failed: %w", err)
 	}
-	if err := c.primaryUpdateRootCA(newProvider, args, config); err != nil {
-		cleanupNewProvider()
-		return err
+
+	c.setCAProvider(provider, rootCA)
+	if activeRoot == nil || activeRoot.ID != rootCA.ID {
+		c.emitEvent(CAEventRootGenerated, conf.Provider, rootCA.ID)
 	}
+
+	c.logger.Info("initialized primary datacenter CA with provider",
+		"provider", conf.Provider,
+		"key_location", keyStorageLocation(provider),
+	)
+
 	return nil
 }
 
-// ValidateConfigUpdater is an optional interface that may be implemented
-// by a ca.Provider. If the provider implements this interface, the
-// ValidateConfigurationUpdate will be called when a user attempts to change the
-// CA configuration, and the provider type has not changed from the previous
-// configuration.
-type ValidateConfigUpdater interface {
-	// ValidateConfigUpdate should return an error if the next configuration is
-	// incompatible with the previous configuration.
-	//
-	// TODO: use better types after https://github.com/hashicorp/consul/issues/12238
-	ValidateConfigUpdate(previous, next map[string]interface{}) error
+// getLeafSigningCertFromRoot returns the PEM encoded certificate that should be used to
+// sign leaf certificates in the local datacenter. The SubjectKeyId of the
+// returned cert should always match the SigningKeyID of the CARoot.
+//
+// TODO: fix the data model so that we don't need this complicated lookup to
+// find the leaf signing cert. See github.com/hashicorp/consul/issues/11347.
+func (c *CAManager) getLeafSigningCertFromRoot(root *structs.CARoot) string {
+	if !c.isIntermediateUsedToSignLeaf() {
+		return root.RootCert
+	}
+	if len(root.IntermediateCerts) == 0 {
+		return ""
+	}
+	return root.IntermediateCerts[len(root.IntermediateCerts)-1]
 }
 
-func (c *CAManager) primaryUpdateRootCA(newProvider ca.Provider, args *structs.CARequest, config *structs.CAConfiguration) error {
-	providerRoot, err := newProvider.GenerateRoot()
-	if err != nil {
-		return fmt.Errorf("error generating CA root certificate: %v", err)
+// hasLeafSigningCert reports whether root holds the leaf signing cert that
+// getLeafSigningCertFromRoot looks for, with a key matching both the
+// SigningKeyID of root and signingKeyID. usesIntermediate is whether leaves
+// are signed by an intermediate rather than by the root itself.
+func hasLeafSigningCert(root *structs.CARoot, usesIntermediate bool, signingKeyID string) bool {
+	pem := root.RootCert
+	if usesIntermediate {
+		if len(root.IntermediateCerts) == 0 {
+			return false
+		}
+		pem = root.IntermediateCerts[len(root.IntermediateCerts)-1]
 	}
-
-	newRootPEM := providerRoot.PEM
-	newActiveRoot, err := newCARoot(newRootPEM, args.Config.Provider, args.Config.ClusterID)
+	cert, err := connect.ParseCert(pem)
 	if err != nil {
-		return err
+		return false
 	}
+	keyID := connect.EncodeSigningKeyID(cert.SubjectKeyId)
+	return keyID == root.SigningKeyID && keyID == signingKeyID
+}
 
-	// See if the provider needs to persist any state along with the config
-	pState, err := newProvider.State()
+// secondaryInitializeIntermediateCA generates a Certificate Signing Request (CSR)
+// for the intermediate CA that is used to sign leaf certificates in the secondary.
+// The CSR is signed by the primary DC and then persisted in the state store.
+//
+// This method should only be called while the state lock is held by setting the
+// state to non-ready.
+func (c *CAManager) secondaryInitializeIntermediateCA(provider ca.Provider, config *structs.CAConfiguration) error {
+	activeIntermediate, err := provider.ActiveIntermediate()
 	if err != nil {
-		return fmt.Errorf("error getting provider state: %v", err)
+		return err
 	}
-	args.Config.State = pState
 
-	state := c.delegate.State()
-	// Compare the new provider's root CA ID to the current one. If they
-	// match, just update the existing provider with the new config.
-	// If they don't match, begin the root rotation process.
-	_, root, err := state.CARootActive(nil)
+	_, activeRoot, err := c.delegate.State().CARootActive(nil)
 	if err != nil {
 		return err
 	}
+	var currentSigningKeyID string
+	if activeRoot != nil {
+		currentSigningKeyID = activeRoot.SigningKeyID
+	}
 
-	// If the root didn't change, just update the config and return.
-	if root != nil && root.ID == newActiveRoot.ID {
-		args.Op = structs.CAOpSetConfig
-		_, err := c.delegate.ApplyCARequest(args)
+	var expectedSigningKeyID string
+	if activeIntermediate != "" {
+		intermediateCert, err := connect.ParseCert(activeIntermediate)
 		if err != nil {
-			return err
+			return fmt.Errorf("error parsing active intermediate cert: %v", err)
 		}
+		expectedSigningKeyID = connect.EncodeSigningKeyID(intermediateCert.SubjectKeyId)
+	}
 
-		// If the config has been committed, update the local provider instance
-		c.setCAProvider(newProvider, newActiveRoot)
-		c.logger.Info("CA provider config updated")
+	newActiveRoot, err := c.secondaryGetActivePrimaryCARoot()
+	if err != nil {
+		return err
+	}
+
+	// Get a signed intermediate from the primary DC if the provider
+	// hasn't been initialized yet or if the primary's root has changed.
+	needsNewIntermediate := activeIntermediate == ""
+	if activeRoot != nil && newActiveRoot.ID != activeRoot.ID {
+		needsNewIntermediate = true
+	}
+
+	// Also we take this opportunity to correct an incorrectly persisted SigningKeyID
+	// in secondary datacenters (see PR-6513).
+	if expectedSigningKeyID != "" && currentSigningKeyID != expectedSigningKeyID {
+		needsNewIntermediate = true
+	}
+
+	// Repair a stored root which lost the leaf signing cert matching its
+	// SigningKeyID, for example after a partial restore, by having the
+	// primary sign a new intermediate since signing would fail otherwise.
+	var repair bool
+	if !needsNewIntermediate && activeRoot != nil && expectedSigningKeyID != "" &&
+		!hasLeafSigningCert(activeRoot, true, expectedSigningKeyID) {
+		c.logger.Warn("Repairing the active CA root, its leaf signing cert is missing",
+			"root_id", activeRoot.ID,
+			"signing_key_id", activeRoot.SigningKeyID,
+		)
+		needsNewIntermediate = true
+		repair = true
+	}
+
+	if needsNewIntermediate {
+		if err := c.secondaryRequestNewSigningCert(provider, newActiveRoot); err != nil {
+			return err
+		}
+	} else {
+		// Discard the primary's representation since our local one is
+		// sufficiently up to date.
+		newActiveRoot = activeRoot
+	}
+
+	// Determine whether a root update is needed, and persist the roots/config accordingly.
+	var newRoot *structs.CARoot
+	if activeRoot == nil || needsNewIntermediate {
+		newRoot = newActiveRoot
+	}
+	if err := c.persistNewRootAndConfig(provider, newRoot, config); err != nil {
+		return err
+	}
+	if repair {
+		c.logger.Info("Repaired the leaf signing cert of the active CA root",
+			"root_id", newActiveRoot.ID,
+			"signing_key_id", newActiveRoot.SigningKeyID,
+		)
+	}
+
+	c.setCAProvider(provider, newActiveRoot)
+	return nil
+}
+
+// persistNewRootAndConfig should only be called while the state lock is held
+// by setting the state to non-ready.
+// If newActiveRoot is non-nil, it will be appended to the current roots list.
+// If config is non-nil, it will be used to overwrite the existing config.
+func (c *CAManager) persistNewRootAndConfig(provider ca.Provider, newActiveRoot *structs.CARoot, config *structs.CAConfiguration) error {
+	state := c.delegate.State()
+	idx, oldRoots, err := state.CARoots(nil)
+	if err != nil {
+		return err
+	}
+
+	// Look up the existing CA config if a new one wasn't provided.
+	var newConf structs.CAConfiguration
+	_, storedConfig, err := state.CAConfig(nil)
+	if err != nil {
+		return err
+	}
+	if storedConfig == nil {
+		return fmt.Errorf("local CA not initialized yet")
+	}
+	// Exit early if the change is a no-op.
+	if newActiveRoot == nil && config != nil && config.Provider == storedConfig.Provider && reflect.DeepEqual(config.Config, storedConfig.Config) {
 		return nil
 	}
 
-	// get the old CA provider to be used for Cross Signing and to clean it up at the end
-	// of the functi8on.
-	oldProvider, _ := c.getCAProvider()
-	if oldProvider == nil {
-		return fmt.Errorf("internal error: CA provider is nil")
+	if config != nil {
+		newConf = *config
+	} else {
+		newConf = *storedConfig
 	}
 
-	// We only even think about cross signing if the current provider has a root cert
-	// In some cases such as having a bad CA configuration during startup the provider
-	// may not have been able to generate a cert. We then want to be able to prevent
-	// an attempt to cross sign the cert which will definitely fail.
-	if root != nil {
-		// If it's a config change that would trigger a rotation (different provider/root):
-		// 1. Get the root from the new provider.
-		// 2. Call CrossSignCA on the old provider to sign the new root with the old one to
-		// get a cross-signed certificate.
-		// 3. Take the active root for the new provider and append the intermediate from step 2
-		// to its list of intermediates.
-		// TODO: this cert is already parsed once in newCARoot, could we remove the second parse?
-		newRoot, err := connect.ParseCert(newRootPEM)
+	// Update the trust domain for the config if there's a new root, or keep the old
+	// one if the root isn't being updated.
+	newConf.ModifyIndex = storedConfig.ModifyIndex
+	var rootID string
+	if newActiveRoot != nil {
+		newConf.ClusterID = newActiveRoot.ExternalTrustDomain
+		rootID = newActiveRoot.ID
+	} else {
+		_, activeRoot, err := state.CARootActive(nil)
 		if err != nil {
 			return err
 		}
+		newConf.ClusterID = activeRoot.ExternalTrustDomain
+		rootID = activeRoot.ID
+	}
 
-		// At this point, we know the config change has triggered a root rotation,
-		// either by swapping the provider type or changing the provider's config
-		// to use a different root certificate.
+	// Persist any state the provider needs us to
+	pState, err := provider.State()
+	if err != nil {
+		return fmt.Errorf("error getting provider state: %v", err)
+	}
+	newConf.State, newConf.StateRefs, err = c.externalizeProviderState(newConf.Provider, rootID, pState)
+	if err != nil {
+		return err
+	}
+	newConf.ProviderVersion = providerVersion(provider)
 
-		// First up, check that the current provider actually supports
-		// cross-signing.
-		canXSign, err := oldProvider.SupportsCrossSigning()
-		if err != nil {
-			return fmt.Errorf("CA provider error: %s", err)
+	// If there's a new active root, copy the root list and append it, updating
+	// the old root with the time it was rotated out. The new root keeps its
+	// activation time if it was already the active root, which happens when
+	// only its intermediate was renewed.
+	now := c.timeNow()
+	if newActiveRoot != nil {
+		if active := oldRoots.Active(); active != nil && active.ID == newActiveRoot.ID {
+			newActiveRoot.ActivatedAt = active.ActivatedAt
+		} else {
+			// Drop the monotonic clock reading, which doesn't survive being
+			// stored in raft, so this root matches what other servers load.
+			newActiveRoot.ActivatedAt = now.Round(0)
 		}
-		if !canXSign && !args.Config.ForceWithoutCrossSigning {
-			return errors.New("The current CA Provider does not support cross-signing. " +
-				"You can try again with ForceWithoutCrossSigningSet but this may cause " +
-				"disruption - see documentation for more.")
+	}
+	var newRoots structs.CARoots
+	for _, r := range oldRoots {
+		newRoot := *r
+		if newRoot.Active && newActiveRoot != nil {
+			newRoot.Active = false
+			newRoot.RotatedOutAt = now
 		}
-		if args.Config.ForceWithoutCrossSigning {
-			c.logger.Warn("ForceWithoutCrossSigning set, CA reconfiguration skipping cross-signing")
+		if newRoot.ExternalTrustDomain == "" {
+			newRoot.ExternalTrustDomain = newConf.ClusterID
+		}
+		newRoots = append(newRoots, &newRoot)
+	}
+	if newActiveRoot != nil {
+		newRoots = append(newRoots, newActiveRoot)
+	}
+	if newActiveRoot != nil {
+		if err := c.checkKeyIDCollision(newActiveRoot, oldRoots); err != nil {
+			return err
+		}
+	}
+	if c.serverConf.Datacenter == c.serverConf.PrimaryDatacenter {
+		if err := checkMaxActiveRoots(&newConf, newRoots); err != nil {
+			return err
 		}
+	}
 
-		// If ForceWithoutCrossSigning wasn't set, attempt to have the old CA generate a
-		// cross-signed intermediate.
-		if canXSign && !args.Config.ForceWithoutCrossSigning {
-			// Have the old provider cross-sign the new root
-			xcCert, err := oldProvider.CrossSignCA(newRoot)
-			if err != nil {
-				return err
+	args := &structs.CARequest{
+		Op:     structs.CAOpSetRootsAndConfig,
+		Index:  idx,
+		Roots:  newRoots,
+		Config: &newConf,
+	}
+	resp, err := c.delegate.ApplyCARequest(args)
+	if err != nil {
+		return err
+	}
+	if respOk, ok := resp.(bool); ok && !respOk {
+		return fmt.Errorf("could not atomically update roots and config")
+	}
+	c.checkKeyDowngrade(oldRoots.Active(), newActiveRoot, &newConf)
+
+	c.logger.Info("updated root certificates from primary datacenter")
+	return nil
+}
+
+// ValidateConfiguration checks the candidate CA configuration conf without
+// applying it. Providers implementing ca.ConnectionTester also check that
+// they can reach their backing CA with it, without changing anything in it.
+// Other providers are only checked to accept the configuration.
+func (c *CAManager) ValidateConfiguration(conf *structs.CAConfiguration) error {
+	if parse := caProviderConfigParser(conf.Provider); parse != nil {
+		if _, err := parse(conf.Config); err != nil {
+			return err
+		}
+	}
+	provider, err := c.newProvider(conf)
+	if err != nil {
+		return fmt.Errorf("could not initialize provider: %v", err)
+	}
+	tester, ok := provider.(ca.ConnectionTester)
+	if !ok {
+		return nil
+	}
+
+	_, stored, err := c.delegate.State().CAConfig(nil)
+	if err != nil {
+		return err
+	}
+	clusterID := ""
+	if stored != nil {
+		clusterID = stored.ClusterID
+	}
+	return tester.TestConnection(ca.ProviderConfig{
+		ClusterID:  clusterID,
+		Datacenter: c.serverConf.Datacenter,
+		IsPrimary:  c.serverConf.Datacenter == c.serverConf.PrimaryDatacenter,
+		RawConfig:  conf.Config,
+	})
+}
+
+// UpdateConfiguration applies a new CA configuration, see
+// UpdateConfigurationAs.
+func (c *CAManager) UpdateConfiguration(args *structs.CARequest) error {
+	return c.UpdateConfigurationAs(args, "")
+}
+
+// UpdateConfigurationAs applies a new CA configuration requested with the ACL
+// token with the given accessor ID, and records the change in the CA
+// configuration history.
+func (c *CAManager) UpdateConfigurationAs(args *structs.CARequest, accessorID string) (reterr error) {
+	// Attempt to update the state first.
+	oldState, err := c.setState(caStateReconfig, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Using named return values in deferred funcs isnt too common in our code
+		// but it is first class Go functionality. The error erturned from the
+		// main func will be available by its given name within deferred functions.
+		// See: https://blog.golang.org/defer-panic-and-recover
+		if reterr == nil {
+			c.setState(caStateInitialized, false)
+		} else {
+			c.setState(oldState, false)
+		}
+	}()
+
+	// Attempt to initialize the config if we failed to do so in Initialize for some reason
+	prevConfig, err := c.initializeCAConfig()
+	if err != nil {
+		return err
+	}
+
+	// Exit early if it's a no-op change
+	state := c.delegate.State()
+	_, config, err := state.CAConfig(nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Record the change while the state is still locked, so that no
+		// other change is mixed in.
+		if reterr == nil && config != nil {
+			c.recordConfigChange(config, accessorID)
+		}
+	}()
+
+	// Don't allow state changes. Either it needs to be empty or the same to allow
+	// read-modify-write loops that don't touch the State field.
+	if len(args.Config.State) > 0 &&
+		!reflect.DeepEqual(args.Config.State, config.State) {
+		return ErrStateReadOnly
+	}
+
+	// Don't allow users to change the ClusterID, other than to migrate to a
+	// new trust domain.
+	clusterID, err := c.trustDomainMigrationClusterID(config, args.Config)
+	if err != nil {
+		return err
+	}
+	args.Config.ClusterID = clusterID
+	if len(args.Config.State) > 0 {
+		args.Config.StateRefs = config.StateRefs
+	} else {
+		args.Config.StateRefs = nil
+	}
+	args.Config.RootGenerationApprovals = config.RootGenerationApprovals
+	args.Config.MaintenanceMode = config.MaintenanceMode
+	args.Config.ForceRenewBefore = c.forceRenewBefore(config, args.Config)
+	args.Config.ProviderVersion = config.ProviderVersion
+
+	// Don't let a new configuration generate the initial root without the
+	// approvals required by the current one.
+	if c.serverConf.Datacenter == c.serverConf.PrimaryDatacenter {
+		if err := c.checkRootGenerationQuorum(config); err != nil {
+			return err
+		}
+	}
+	if err := c.checkTrustAnchorCollisions(args.Config); err != nil {
+		return err
+	}
+	if args.Config.Provider == config.Provider && caProviderConfigsEqual(config.Provider, args.Config.Config, config.Config) {
+		if reflect.DeepEqual(args.Config.Config, config.Config) {
+			return nil
+		}
+		// Nothing to reconfigure, but store the configuration as written so
+		// that reading it back returns it.
+		args.Config.State = config.State
+		args.Config.ModifyIndex = config.ModifyIndex
+		args.Op = structs.CAOpSetConfig
+		resp, err := c.delegate.ApplyCARequest(args)
+		if err != nil {
+			return err
+		}
+		if respOk, ok := resp.(bool); ok && !respOk {
+			return fmt.Errorf("CA configuration changed while it was being updated")
+		}
+		return nil
+	}
+
+	// If the provider hasn't changed, we need to load the current Provider state
+	// so it can decide if it needs to change resources or not based on the config
+	// change.
+	if args.Config.Provider == config.Provider {
+		// Note this is a shallow copy since the State method doc requires the
+		// provider return a map that will not be further modified and should not
+		// modify the one we pass to Configure.
+		args.Config.State = config.State
+	}
+
+	// Create a new instance of the provider described by the config
+	// and get the current active root CA. This acts as a good validation
+	// of the config and makes sure the provider is functioning correctly
+	// before we commit any changes to Raft.
+	newProvider, err := c.newProvider(args.Config)
+	if err != nil {
+		return fmt.Errorf("could not initialize provider: %v", err)
+	}
+	if args.Config.Provider == config.Provider {
+		if err := c.checkProviderVersion(newProvider, config); err != nil {
+			return err
+		}
+	}
+	providerState, err := c.resolveProviderState(args.Config.State, args.Config.StateRefs)
+	if err != nil {
+		return err
+	}
+	pCfg := ca.ProviderConfig{
+		ClusterID:  args.Config.ClusterID,
+		Datacenter: c.serverConf.Datacenter,
+		// This endpoint can be called in a secondary DC too so set this correctly.
+		IsPrimary: c.serverConf.Datacenter == c.serverConf.PrimaryDatacenter,
+		RawConfig: args.Config.Config,
+		State:     providerState,
+	}
+
+	if args.Config.Provider == config.Provider {
+		if validator, ok := newProvider.(ValidateConfigUpdater); ok {
+			if err := validator.ValidateConfigUpdate(prevConfig.Config, args.Config.Config); err != nil {
+				return fmt.Errorf("new configuration is incompatible with previous configuration: %w", err)
+			}
+		}
+	}
+
+	if err := newProvider.Configure(pCfg); err != nil {
+		return fmt.Errorf("error configuring provider: %v", err)
+	}
+	c.emitEvent(CAEventProviderConfigured, args.Config.Provider, "")
+	if err := checkProviderTTLLimits(newProvider, args.Config); err != nil {
+		return err
+	}
+	if commonCfg, err := args.Config.GetCommonConfig(); err != nil {
+		return err
+	} else if _, ok := newProvider.(ca.AttestationVerifier); commonCfg.RequireAttestation && !ok {
+		return fmt.Errorf("RequireAttestation is not supported by the %s CA provider", args.Config.Provider)
+	}
+
+	cleanupNewProvider := func() {
+		if err := newProvider.Cleanup(args.Config.Provider != config.Provider, args.Config.Config); err != nil {
+			c.logger.Warn("failed to clean up CA provider while handling startup failure", "provider", newProvider, "error", err)
+		}
+	}
+
+	// If this is a secondary, just check if the intermediate needs to be regenerated.
+	if c.serverConf.Datacenter != c.serverConf.PrimaryDatacenter {
+		if err := c.secondaryInitializeIntermediateCA(newProvider, args.Config); err != nil {
+			cleanupNewProvider()
+			return fmt.Errorf("Error updating secondary datacenter CA config: %v", err)
+		}
+		c.logger.Info("Secondary CA provider config updated")
+		return nil
+	}
+	if err := c.primaryUpdateRootCA(newProvider, args, config); err != nil {
+		cleanupNewProvider()
+		return err
+	}
+	return nil
+}
+
+// forceRenewBefore returns the ForceRenewBefore of the next CA configuration:
+// the current time if it sets ForceRenewOnLeafTTLDecrease and decreases
+// LeafCertTTL, the one of the current configuration otherwise.
+func (c *CAManager) forceRenewBefore(current, next *structs.CAConfiguration) *time.Time {
+	currentCommon, err := current.GetCommonConfig()
+	if err != nil {
+		return current.ForceRenewBefore
+	}
+	nextCommon, err := next.GetCommonConfig()
+	if err != nil {
+		return current.ForceRenewBefore
+	}
+	if nextCommon.ForceRenewOnLeafTTLDecrease && nextCommon.LeafCertTTL < currentCommon.LeafCertTTL {
+		c.logger.Info("LeafCertTTL decreased, asking clients to renew their leaf certificates",
+			"previous", currentCommon.LeafCertTTL,
+			"new", nextCommon.LeafCertTTL,
+		)
+		now := c.timeNow().Round(0).UTC()
+		return &now
+	}
+	return current.ForceRenewBefore
+}
+
+// trustDomainMigrationClusterID returns the cluster ID to use for the next CA
+// configuration. It is the current one unless next sets a new TrustDomain, which
+// is only allowed in the primary datacenter along with PreviousTrustDomain set
+// to the current trust domain so that it keeps being accepted during the
+// migration.
+func (c *CAManager) trustDomainMigrationClusterID(current, next *structs.CAConfiguration) (string, error) {
+	commonCfg, err := next.GetCommonConfig()
+	if err != nil {
+		return "", err
+	}
+	newClusterID := commonCfg.TrustDomainClusterID()
+	if newClusterID == "" || newClusterID == current.ClusterID {
+		return current.ClusterID, nil
+	}
+
+	currentTrustDomain := connect.SpiffeIDSigningForCluster(current.ClusterID).Host()
+	if c.serverConf.Datacenter != c.serverConf.PrimaryDatacenter {
+		return "", fmt.Errorf("the trust domain can only be changed in the primary datacenter, "+
+			"this datacenter uses %s", currentTrustDomain)
+	}
+	if !strings.EqualFold(commonCfg.PreviousTrustDomain, currentTrustDomain) {
+		return "", fmt.Errorf("changing the trust domain to %s requires PreviousTrustDomain to be set to "+
+			"the current trust domain %s", commonCfg.TrustDomain, currentTrustDomain)
+	}
+	return newClusterID, nil
+}
+
+// checkProviderTTLLimits returns an error when the TTLs in the CA
+// configuration exceed the limits of a provider implementing ca.TTLLimiter.
+func checkProviderTTLLimits(provider ca.Provider, conf *structs.CAConfiguration) error {
+	limiter, ok := provider.(ca.TTLLimiter)
+	if !ok {
+		return nil
+	}
+	commonCfg, err := conf.GetCommonConfig()
+	if err != nil {
+		return err
+	}
+	maxIntermediate, maxLeaf, err := limiter.TTLLimits()
+	if err != nil {
+		return fmt.Errorf("error getting the TTL limits of the CA provider: %w", err)
+	}
+	if maxIntermediate > 0 && commonCfg.IntermediateCertTTL > maxIntermediate {
+		return fmt.Errorf("IntermediateCertTTL %s exceeds the maximum of %s supported by the %s CA provider",
+			commonCfg.IntermediateCertTTL, maxIntermediate, conf.Provider)
+	}
+	if maxLeaf > 0 && commonCfg.LeafCertTTL > maxLeaf {
+		return fmt.Errorf("LeafCertTTL %s exceeds the maximum of %s supported by the %s CA provider",
+			commonCfg.LeafCertTTL, maxLeaf, conf.Provider)
+	}
+	if maxLeaf > 0 && commonCfg.MaxServiceLeafCertTTL > maxLeaf {
+		return fmt.Errorf("MaxServiceLeafCertTTL %s exceeds the maximum of %s supported by the %s CA provider",
+			commonCfg.MaxServiceLeafCertTTL, maxLeaf, conf.Provider)
+	}
+	return nil
+}
+
+// ValidateConfigUpdater is an optional interface that may be implemented
+// by a ca.Provider. If the provider implements this interface, the
+// ValidateConfigurationUpdate will be called when a user attempts to change the
+// CA configuration, and the provider type has not changed from the previous
+// configuration.
+type ValidateConfigUpdater interface {
+	// ValidateConfigUpdate should return an error if the next configuration is
+	// incompatible with the previous configuration.
+	//
+	// TODO: use better types after https://github.com/hashicorp/consul/issues/12238
+	ValidateConfigUpdate(previous, next map[string]interface{}) error
+}
+
+func (c *CAManager) primaryUpdateRootCA(newProvider ca.Provider, args *structs.CARequest, config *structs.CAConfiguration) error {
+	providerRoot, err := newProvider.GenerateRoot()
+	if err != nil {
+		return fmt.Errorf("error generating CA root certificate: %v", err)
+	}
+
+	newActiveRoot, err := newCARootFromResult(providerRoot, args.Config.Provider, args.Config.ClusterID)
+	if err != nil {
+		return err
+	}
+	newRootPEM := newActiveRoot.RootCert
+	if err := c.checkRootNotCollidingAnchor(newActiveRoot, config, args.Config); err != nil {
+		return err
+	}
+
+	// See if the provider needs to persist any state along with the config
+	pState, err := newProvider.State()
+	if err != nil {
+		return fmt.Errorf("error getting provider state: %v", err)
+	}
+	args.Config.State, args.Config.StateRefs, err = c.externalizeProviderState(args.Config.Provider, newActiveRoot.ID, pState)
+	if err != nil {
+		return err
+	}
+	args.Config.ProviderVersion = providerVersion(newProvider)
+
+	state := c.delegate.State()
+	// Compare the new provider's root CA ID to the current one. If they
+	// match, just update the existing provider with the new config.
+	// If they don't match, begin the root rotation process.
+	_, root, err := state.CARootActive(nil)
+	if err != nil {
+		return err
+	}
+
+	// If the root didn't change, just update the config and return.
+	if root != nil && root.ID == newActiveRoot.ID {
+		if args.Config.ClusterID != config.ClusterID {
+			return fmt.Errorf("changing the trust domain requires a new root but the %s CA provider "+
+				"returned the current one, change its root configuration too", args.Config.Provider)
+		}
+		args.Op = structs.CAOpSetConfig
+		_, err := c.delegate.ApplyCARequest(args)
+		if err != nil {
+			return err
+		}
+
+		// If the config has been committed, update the local provider instance
+		c.setCAProvider(newProvider, newActiveRoot)
+		c.logger.Info("CA provider config updated")
+		return nil
+	}
+
+	newActiveRoot.RotationReason = rotationReasonForUpdate(root, newActiveRoot, args.Config)
+
+	// Refuse the rotation before anything gets cross-signed if it would keep
+	// too many roots.
+	_, currentRoots, err := state.CARoots(nil)
+	if err != nil {
+		return err
+	}
+	if err := checkMaxActiveRoots(args.Config, append(structs.CARoots{newActiveRoot}, currentRoots...)); err != nil {
+		return err
+	}
+
+	// get the old CA provider to be used for Cross Signing and to clean it up at the end
+	// of the functi8on.
+	oldProvider, _ := c.getCAProvider()
+	if oldProvider == nil {
+		return fmt.Errorf("internal error: CA provider is nil")
+	}
+	c.emitEvent(CAEventRotationStarted, args.Config.Provider, newActiveRoot.ID)
+
+	// We only even think about cross signing if the current provider has a root cert
+	// In some cases such as having a bad CA configuration during startup the provider
+	// may not have been able to generate a cert. We then want to be able to prevent
+	// an attempt to cross sign the cert which will definitely fail.
+	if root != nil {
+		// If it's a config change that would trigger a rotation (different provider/root):
+		// 1. Get the root from the new provider.
+		// 2. Call CrossSignCA on the old provider to sign the new root with the old one to
+		// get a cross-signed certificate.
+		// 3. Take the active root for the new provider and append the intermediate from step 2
+		// to its list of intermediates.
+		// TODO: this cert is already parsed once in newCARoot, could we remove the second parse?
+		newRoot, err := connect.ParseCert(newRootPEM)
+		if err != nil {
+			return err
+		}
+
+		// At this point, we know the config change has triggered a root rotation,
+		// either by swapping the provider type or changing the provider's config
+		// to use a different root certificate.
+
+		// First up, check that the current provider actually supports
+		// cross-signing.
+		canXSign, err := oldProvider.SupportsCrossSigning()
+		if err != nil {
+			return fmt.Errorf("CA provider error: %s", err)
+		}
+		if !canXSign && !args.Config.ForceWithoutCrossSigning {
+			// Without a cross-signed intermediate, the leaf certificates the
+			// new root signs are only trusted by proxies once they fetch it,
+			// unless it is already published as a trust anchor.
+			if !isAdditionalTrustAnchor(config, newActiveRoot) {
+				return fmt.Errorf("%w: leaf certificates signed by the new root won't be trusted "+
+					"by proxies until they fetch it, breaking connections between services "+
+					"during the rollout. Publish the new root in AdditionalTrustAnchors first, "+
+					"or try again with ForceWithoutCrossSigning set to accept the disruption "+
+					"- see documentation for more.", ErrCrossSigningUnsupported)
+			}
+			c.logger.Info("The new root is already an additional trust anchor, rotating without cross-signing")
+		}
+		if args.Config.ForceWithoutCrossSigning {
+			c.logger.Warn("ForceWithoutCrossSigning set, CA reconfiguration skipping cross-signing")
+		}
+
+		// If ForceWithoutCrossSigning wasn't set, attempt to have the old CA generate a
+		// cross-signed intermediate.
+		if canXSign && !args.Config.ForceWithoutCrossSigning {
+			// Have the old provider cross-sign the new root
+			xcCert, err := oldProvider.CrossSignCA(context.Background(), newRoot)
+			if err != nil {
+				return err
+			}
+
+			// Add the cross signed cert to the new CA's intermediates (to be attached
+			// to leaf certs), ahead of any chaining the primary CA up to an
+			// external root.
+			newActiveRoot.IntermediateCerts = append([]string{xcCert}, newActiveRoot.IntermediateCerts...)
+		}
+	}
+
+	// TODO: https://github.com/hashicorp/consul/issues/12386
+	intermediate, err := c.generateIntermediate(context.Background(), newProvider)
+	if err != nil {
+		return err
+	}
+	if intermediate != providerRoot.PEM {
+		if err := setLeafSigningCert(newActiveRoot, intermediate); err != nil {
+			return err
+		}
+	}
+
+	// Update the roots and CA config in the state store at the same time
+	idx, roots, err := state.CARoots(nil)
+	if err != nil {
+		return err
+	}
+	if err := c.checkKeyIDCollision(newActiveRoot, roots); err != nil {
+		return err
+	}
+
+	now := c.timeNow()
+	var newRoots structs.CARoots
+	for _, r := range roots {
+		newRoot := *r
+		if newRoot.Active {
+			newRoot.Active = false
+			newRoot.RotatedOutAt = now
+		}
+		newRoots = append(newRoots, &newRoot)
+	}
+	// See persistNewRootAndConfig for why the monotonic reading is dropped.
+	newActiveRoot.ActivatedAt = now.Round(0)
+	newRoots = append(newRoots, newActiveRoot)
+
+	args.Op = structs.CAOpSetRootsAndConfig
+	args.Index = idx
+	args.Config.ModifyIndex = config.ModifyIndex
+	args.Roots = newRoots
+	resp, err := c.delegate.ApplyCARequest(args)
+	if err != nil {
+		return err
+	}
+	if respOk, ok := resp.(bool); ok && !respOk {
+		return fmt.Errorf("could not atomically update roots and config")
+	}
+	c.checkKeyDowngrade(roots.Active(), newActiveRoot, args.Config)
+
+	// If the config has been committed, update the local provider instance
+	// and call teardown on the old provider
+	c.setCAProvider(newProvider, newActiveRoot)
+
+	if err := oldProvider.Cleanup(args.Config.Provider != config.Provider, args.Config.Config); err != nil {
+		c.logger.Warn("failed to clean up old provider", "provider", config.Provider, "error", err)
+	}
+
+	c.emitEvent(CAEventRotationCompleted, args.Config.Provider, newActiveRoot.ID)
+	c.logger.Info("CA rotated to new root under provider",
+		"provider", args.Config.Provider,
+		"rotation_reason", newActiveRoot.RotationReason,
+	)
+
+	return nil
+}
+
+// isAdditionalTrustAnchor returns whether root is one of the
+// AdditionalTrustAnchors of config, which are already published with the
+// roots.
+func isAdditionalTrustAnchor(config *structs.CAConfiguration, root *structs.CARoot) bool {
+	commonCfg, err := config.GetCommonConfig()
+	if err != nil {
+		return false
+	}
+	for _, anchorPEM := range commonCfg.AdditionalTrustAnchors {
+		anchor, err := newTrustAnchor(anchorPEM)
+		if err == nil && anchor.ID == root.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// trustAnchorCollides returns whether the additional trust anchor anchorPEM
+// of config has a SPIFFE ID in the trust domain of the cluster but a key none
+// of roots has, as would the root of a federated cluster set up with the same
+// cluster ID.
+func trustAnchorCollides(config *structs.CAConfiguration, anchorPEM string, roots structs.CARoots) bool {
+	cert, err := connect.ParseCert(anchorPEM)
+	if err != nil {
+		return false
+	}
+	trustDomain := connect.SpiffeIDSigningForCluster(config.ClusterID).Host()
+	inTrustDomain := false
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" && (strings.EqualFold(uri.Host, trustDomain) || inPreviousTrustDomain(config, uri.Host)) {
+			inTrustDomain = true
+		}
+	}
+	if !inTrustDomain {
+		return false
+	}
+
+	keyID := connect.EncodeSigningKeyID(cert.SubjectKeyId)
+	for _, r := range roots {
+		for _, id := range caRootKeyIDs(r) {
+			if id == keyID {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkTrustAnchorCollisions refuses a CA configuration with the
+// FederationCollisionReject policy and an additional trust anchor colliding
+// with the trust domain of the cluster.
+func (c *CAManager) checkTrustAnchorCollisions(config *structs.CAConfiguration) error {
+	commonCfg, err := config.GetCommonConfig()
+	if err != nil {
+		return err
+	}
+	if commonCfg.FederationCollisionPolicy != structs.FederationCollisionReject {
+		return nil
+	}
+	_, roots, err := c.delegate.State().CARoots(nil)
+	if err != nil {
+		return err
+	}
+	for i, anchorPEM := range commonCfg.AdditionalTrustAnchors {
+		if trustAnchorCollides(config, anchorPEM, roots) {
+			return fmt.Errorf("%w: AdditionalTrustAnchors[%d] is in trust domain %s but its key is not "+
+				"one of the roots", ErrTrustDomainCollision, i, connect.SpiffeIDSigningForCluster(config.ClusterID).Host())
+		}
+	}
+	return nil
+}
+
+// checkRootNotCollidingAnchor refuses to make newRoot the active root when the
+// next configuration sets a FederationCollisionPolicy and newRoot is an
+// additional trust anchor, of the current or next configuration, colliding
+// with the trust domain of the cluster. Such anchors are only trusted to
+// verify certificates.
+func (c *CAManager) checkRootNotCollidingAnchor(newRoot *structs.CARoot, current, next *structs.CAConfiguration) error {
+	nextCommon, err := next.GetCommonConfig()
+	if err != nil {
+		return err
+	}
+	if nextCommon.FederationCollisionPolicy == "" {
+		return nil
+	}
+	_, roots, err := c.delegate.State().CARoots(nil)
+	if err != nil {
+		return err
+	}
+	for _, conf := range []*structs.CAConfiguration{current, next} {
+		commonCfg, err := conf.GetCommonConfig()
+		if err != nil {
+			continue
+		}
+		for _, anchorPEM := range commonCfg.AdditionalTrustAnchors {
+			anchor, err := newTrustAnchor(anchorPEM)
+			if err != nil || anchor.ID != newRoot.ID {
+				continue
+			}
+			if trustAnchorCollides(next, anchorPEM, roots) {
+				return fmt.Errorf("%w: the new root %s is an additional trust anchor in the trust domain of "+
+					"the cluster, which can't become the active root with FederationCollisionPolicy %q",
+					ErrTrustDomainCollision, newRoot.ID, nextCommon.FederationCollisionPolicy)
+			}
+		}
+	}
+	return nil
+}
+
+// rotationReasonForUpdate returns why a CA configuration update to newConf
+// replaces oldRoot, which may be nil, with newRoot.
+func rotationReasonForUpdate(oldRoot, newRoot *structs.CARoot, newConf *structs.CAConfiguration) structs.CARotationReason {
+	if newConf.Provider == structs.ConsulCAProvider {
+		if cfg, err := ca.ParseConsulCAConfig(newConf.Config); err == nil && cfg.RootCert != "" {
+			return structs.CARotationReasonImport
+		}
+	}
+	if oldRoot != nil && (oldRoot.PrivateKeyType != newRoot.PrivateKeyType || oldRoot.PrivateKeyBits != newRoot.PrivateKeyBits) {
+		return structs.CARotationReasonKeyTypeChange
+	}
+	return structs.CARotationReasonConfigChange
+}
+
+// EmergencyRotateRoot replaces the active root with a new one backed by a new
+// key, for when the key of the active root is known to be compromised. Unlike
+// a regular rotation the new root is not cross-signed by the old one and every
+// other root is dropped straight away, so leaf certificates signed before the
+// rotation stop being trusted and clients fail until they fetch the new root.
+// It can only be run in the primary datacenter, with a provider implementing
+// ca.RootReplacer.
+func (c *CAManager) EmergencyRotateRoot(ctx context.Context) error {
+	if c.serverConf.Datacenter != c.serverConf.PrimaryDatacenter {
+		return ErrNotPrimaryDatacenter
+	}
+
+	oldState, err := c.setState(caStateReconfig, true)
+	if err != nil {
+		return err
+	}
+	defer c.setState(oldState, false)
+
+	if oldState != caStateInitialized {
+		return fmt.Errorf("CA is not initialized")
+	}
+
+	provider, oldRoot := c.getCAProvider()
+	if provider == nil || oldRoot == nil {
+		return fmt.Errorf("internal error: CA provider is nil")
+	}
+	replacer, ok := provider.(ca.RootReplacer)
+	if !ok {
+		return fmt.Errorf("the CA provider does not support emergency root rotation")
+	}
+
+	state := c.delegate.State()
+	idx, _, err := state.CARoots(nil)
+	if err != nil {
+		return err
+	}
+	_, config, err := state.CAConfig(nil)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		return fmt.Errorf("CA is not configured")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.logger.Warn("EMERGENCY CA ROOT ROTATION: replacing the active root without cross-signing, "+
+		"certificates signed by it will stop being trusted",
+		"provider", config.Provider,
+		"old_root_id", oldRoot.ID,
+	)
+
+	providerRoot, err := replacer.ReplaceRoot()
+	if err != nil {
+		return fmt.Errorf("error replacing CA root certificate: %v", err)
+	}
+	newActiveRoot, err := newCARootFromResult(providerRoot, config.Provider, config.ClusterID)
+	if err != nil {
+		return err
+	}
+	c.emitEvent(CAEventRotationStarted, config.Provider, newActiveRoot.ID)
+	intermediate, err := c.generateIntermediate(ctx, provider)
+	if err != nil {
+		return err
+	}
+	if intermediate != providerRoot.PEM {
+		if err := setLeafSigningCert(newActiveRoot, intermediate); err != nil {
+			return err
+		}
+	}
+
+	newConfig := *config
+	pState, err := provider.State()
+	if err != nil {
+		return fmt.Errorf("error getting provider state: %v", err)
+	}
+	newConfig.State, newConfig.StateRefs, err = c.externalizeProviderState(config.Provider, newActiveRoot.ID, pState)
+	if err != nil {
+		return err
+	}
+	newConfig.ProviderVersion = providerVersion(provider)
+
+	// See persistNewRootAndConfig for why the monotonic reading is dropped.
+	newActiveRoot.ActivatedAt = c.timeNow().Round(0)
+	newActiveRoot.RotationReason = structs.CARotationReasonEmergency
+	args := &structs.CARequest{
+		Op:     structs.CAOpSetRootsAndConfig,
+		Index:  idx,
+		Roots:  structs.CARoots{newActiveRoot},
+		Config: &newConfig,
+	}
+	resp, err := c.delegate.ApplyCARequest(args)
+	if err != nil {
+		return err
+	}
+	if respOk, ok := resp.(bool); ok && !respOk {
+		return fmt.Errorf("could not atomically update roots and config")
+	}
+	c.checkKeyDowngrade(oldRoot, newActiveRoot, &newConfig)
+
+	c.setCAProvider(provider, newActiveRoot)
+	c.emitEvent(CAEventRotationCompleted, config.Provider, newActiveRoot.ID)
+
+	c.logger.Warn("EMERGENCY CA ROOT ROTATION complete, all previous roots were removed",
+		"provider", config.Provider,
+		"old_root_id", oldRoot.ID,
+		"new_root_id", newActiveRoot.ID,
+		"rotation_reason", newActiveRoot.RotationReason,
+	)
+	return nil
+}
+
+// UpgradeKeyStrength rotates the active root to a new one generated with the
+// target key, such as when the key of the active root uses a deprecated
+// algorithm or length. It goes through the same rotation as a configuration
+// change, so the previous root stays published and cross-signs the new one
+// while leaf certificates are reissued. The target must be a valid key for the
+// CA configuration and stronger than the key of the active root.
+func (c *CAManager) UpgradeKeyStrength(target structs.CAKeySpec) error {
+	if c.serverConf.Datacenter != c.serverConf.PrimaryDatacenter {
+		return ErrNotPrimaryDatacenter
+	}
+
+	state := c.delegate.State()
+	_, activeRoot, err := state.CARootActive(nil)
+	if err != nil {
+		return err
+	}
+	if activeRoot == nil {
+		return fmt.Errorf("CA is not initialized")
+	}
+	_, config, err := state.CAConfig(nil)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		return fmt.Errorf("CA is not configured")
+	}
+
+	current := structs.CAKeySpec{PrivateKeyType: activeRoot.PrivateKeyType, PrivateKeyBits: activeRoot.PrivateKeyBits}
+	if !keyWeaker(target.PrivateKeyType, target.PrivateKeyBits, current.PrivateKeyType, current.PrivateKeyBits) {
+		return fmt.Errorf("%w: %s is not stronger than %s", ErrKeyNotStronger, target, current)
+	}
+
+	newConfig := *config
+	newConfig.Config = make(map[string]interface{}, len(config.Config)+2)
+	for k, v := range config.Config {
+		newConfig.Config[k] = v
+	}
+	newConfig.Config["PrivateKeyType"] = target.PrivateKeyType
+	newConfig.Config["PrivateKeyBits"] = target.PrivateKeyBits
+	if parse := caProviderConfigParser(newConfig.Provider); parse != nil {
+		if _, err := parse(newConfig.Config); err != nil {
+			return fmt.Errorf("key %s is not compatible with the CA configuration: %w", target, err)
+		}
+	}
+
+	c.logger.Info("rotating the CA root to a stronger key",
+		"root_id", activeRoot.ID,
+		"previous_key", current.String(),
+		"new_key", target.String(),
+	)
+	if err := c.UpdateConfiguration(&structs.CARequest{Op: structs.CAOpSetConfig, Config: &newConfig}); err != nil {
+		return err
+	}
+
+	// Providers configured with their root, such as the built-in one with a
+	// PrivateKey, keep it whatever the requested key.
+	_, newRoot, err := state.CARootActive(nil)
+	if err != nil {
+		return err
+	}
+	if newRoot == nil || newRoot.ID == activeRoot.ID ||
+		newRoot.PrivateKeyType != target.PrivateKeyType || newRoot.PrivateKeyBits != target.PrivateKeyBits {
+		return fmt.Errorf("the CA provider did not rotate to a %s root, check that its configuration doesn't pin the root key", target)
+	}
+	return nil
+}
+
+// checkKeyDowngrade warns about and counts the keys of newRoot, and of the
+// intermediate it signs leaf certificates with, that are weaker than those of
+// oldRoot, unless conf acknowledges the downgrade. It is called once newRoot
+// is persisted, as a downgrade is reported but never refused.
+func (c *CAManager) checkKeyDowngrade(oldRoot, newRoot *structs.CARoot, conf *structs.CAConfiguration) {
+	if oldRoot == nil || newRoot == nil {
+		return
+	}
+	commonCfg, err := conf.GetCommonConfig()
+	if err != nil {
+		c.logger.Warn("failed to check the new CA keys for a downgrade", "error", err)
+		return
+	}
+
+	report := func(kind, oldType string, oldBits int, newType string, newBits int) {
+		if !keyWeaker(oldType, oldBits, newType, newBits) {
+			return
+		}
+		args := []interface{}{
+			"previous_key", fmt.Sprintf("%s-%d", oldType, oldBits),
+			"new_key", fmt.Sprintf("%s-%d", newType, newBits),
+			"root_id", newRoot.ID,
+		}
+		if commonCfg.AcknowledgeKeyDowngrade {
+			c.logger.Info("new CA "+kind+" has a weaker key than the previous one, as acknowledged in the CA configuration", args...)
+			return
+		}
+		c.logger.Warn("new CA "+kind+" has a weaker key than the previous one; set AcknowledgeKeyDowngrade in the CA configuration if this is intended", args...)
+		metrics.IncrCounterWithLabels(metricsKeyCAKeyDowngrade, 1, []metrics.Label{{Name: "kind", Value: kind}})
+	}
+
+	if oldRoot.ID != newRoot.ID {
+		report("root", oldRoot.PrivateKeyType, oldRoot.PrivateKeyBits, newRoot.PrivateKeyType, newRoot.PrivateKeyBits)
+	}
+	oldType, oldBits, oldOK := intermediateKeyInfo(oldRoot)
+	newType, newBits, newOK := intermediateKeyInfo(newRoot)
+	if oldOK && newOK && oldRoot.SigningKeyID != newRoot.SigningKeyID {
+		report("intermediate", oldType, oldBits, newType, newBits)
+	}
+}
+
+// intermediateKeyInfo returns the key type and bits of the intermediate root
+// signs leaf certificates with, and false when root signs them itself or the
+// intermediate can't be parsed.
+func intermediateKeyInfo(root *structs.CARoot) (string, int, bool) {
+	for _, p := range root.IntermediateCerts {
+		cert, err := connect.ParseCert(p)
+		if err != nil || connect.EncodeSigningKeyID(cert.SubjectKeyId) != root.SigningKeyID {
+			continue
+		}
+		keyType, keyBits, err := connect.KeyInfoFromCert(cert)
+		if err != nil {
+			return "", 0, false
+		}
+		return keyType, keyBits, true
+	}
+	return "", 0, false
+}
+
+// keyWeaker returns whether a key of newType and newBits is weaker than one of
+// oldType and oldBits: it has fewer bits when the types match, and a lower
+// security strength otherwise.
+func keyWeaker(oldType string, oldBits int, newType string, newBits int) bool {
+	if oldType == "" || newType == "" {
+		return false
+	}
+	if oldType == newType {
+		return newBits < oldBits
+	}
+	return keySecurityStrength(newType, newBits) < keySecurityStrength(oldType, oldBits)
+}
+
+// keySecurityStrength returns the security strength in bits of a key, as
+// estimated by NIST SP 800-57 Part 1.
+func keySecurityStrength(keyType string, keyBits int) int {
+	switch keyType {
+	case "ec":
+		return keyBits / 2
+	case "ed25519":
+		return 128
+	case "rsa":
+		switch {
+		case keyBits >= 15360:
+			return 256
+		case keyBits >= 7680:
+			return 192
+		case keyBits >= 3072:
+			return 128
+		case keyBits >= 2048:
+			return 112
+		default:
+			return 80
+		}
+	}
+	return 0
+}
+
+// checkRootGenerationQuorum returns an error wrapping
+// ErrRootGenerationQuorumNotMet when there is no active root yet and conf
+// requires more operator approvals to generate one than were recorded.
+func (c *CAManager) checkRootGenerationQuorum(conf *structs.CAConfiguration) error {
+	commonCfg, err := conf.GetCommonConfig()
+	if err != nil {
+		return err
+	}
+	quorum := commonCfg.RootGenerationQuorum
+	if quorum == 0 {
+		return nil
+	}
+
+	_, activeRoot, err := c.delegate.State().CARootActive(nil)
+	if err != nil {
+		return err
+	}
+	if activeRoot != nil {
+		return nil
+	}
+	if approvals := len(conf.RootGenerationApprovals); approvals < quorum {
+		return fmt.Errorf("%w: %d of %d operators approved generating the root",
+			ErrRootGenerationQuorumNotMet, approvals, quorum)
+	}
+	return nil
+}
+
+// caConfigCASRetries is how many times an update of a single field of the CA
+// configuration, such as recording an approval to generate the root, is
+// retried when the configuration was concurrently updated, for example by
+// another operator approving at the same time.
+var caConfigCASRetries = 5
+
+// ApproveRootGeneration records the approval of the operator holding the given
+// ACL identity to generate the initial root of the primary datacenter, when
+// RootGenerationQuorum is set. Approvals are keyed on the token, see
+// structs.RootGenerationApprover, so approving again with the same token has
+// no effect. Once the
+// quorum is met, the CA is initialized, which generates the root. It returns
+// the number of approvals recorded and the quorum.
+func (c *CAManager) ApproveRootGeneration(identity structs.ACLIdentity) (int, int, error) {
+	if c.serverConf.Datacenter != c.serverConf.PrimaryDatacenter {
+		return 0, 0, ErrNotPrimaryDatacenter
+	}
+	approver := structs.RootGenerationApprover(identity)
+	if approver == "" {
+		return 0, 0, fmt.Errorf("approving CA root generation requires an ACL token to identify the operator")
+	}
+
+	store := c.delegate.State()
+	var (
+		config *structs.CAConfiguration
+		quorum int
+	)
+	for attempt := 0; ; attempt++ {
+		_, activeRoot, err := store.CARootActive(nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		if activeRoot != nil {
+			return 0, 0, fmt.Errorf("the CA root was already generated")
+		}
+		_, config, err = store.CAConfig(nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		if config == nil {
+			return 0, 0, fmt.Errorf("CA is not configured")
+		}
+		commonCfg, err := config.GetCommonConfig()
+		if err != nil {
+			return 0, 0, err
+		}
+		quorum = commonCfg.RootGenerationQuorum
+		if quorum == 0 {
+			return 0, 0, fmt.Errorf("RootGenerationQuorum is not set, the CA root doesn't need approvals")
+		}
+		if config.HasRootGenerationApproval(approver) {
+			break
+		}
+
+		// The write is a check-and-set on the ModifyIndex of the configuration
+		// read above, so that concurrent approvals can't overwrite each other.
+		newConfig := *config
+		newConfig.RootGenerationApprovals = append(
+			append([]structs.CARootGenerationApproval(nil), config.RootGenerationApprovals...),
+			structs.CARootGenerationApproval{
+				Approver:   approver,
+				AccessorID: identity.ID(),
+				ApprovedAt: c.timeNow(),
+			},
+		)
+		resp, err := c.delegate.ApplyCARequest(&structs.CARequest{
+			Op:     structs.CAOpSetConfig,
+			Config: &newConfig,
+		})
+		if err != nil && !errors.Is(err, state.ErrCAConfigModifyIndexMismatch) {
+			return 0, 0, err
+		}
+		if respOk, ok := resp.(bool); err == nil && (!ok || respOk) {
+			config = &newConfig
+			c.logger.Info("recorded approval to generate the CA root",
+				"accessor_id", identity.ID(),
+				"approvals", len(config.RootGenerationApprovals),
+				"quorum", quorum,
+			)
+			break
+		}
+		if attempt >= caConfigCASRetries {
+			return 0, 0, fmt.Errorf("could not atomically update the CA configuration")
+		}
+	}
+
+	approvals := len(config.RootGenerationApprovals)
+	if approvals < quorum {
+		return approvals, quorum, nil
+	}
+
+	err := c.Initialize()
+	var errCaState *caStateError
+	if errors.As(err, &errCaState) && errCaState.Current == caStateInitializing {
+		// The background initialization is running and will see the
+		// approvals.
+		err = nil
+	}
+	return approvals, quorum, err
+}
+
+// PruneRoots removes the roots that are no longer needed to validate any
+// unexpired leaf certificate, and returns their IDs. A root is still needed
+// while it is active, until LeafCertTTL passed since it was rotated out, and
+// while it belongs to the PreviousTrustDomain of a trust domain migration.
+// Roots which expired are never needed. It can only be run in the primary
+// datacenter, secondaries get their roots from the primary.
+func (c *CAManager) PruneRoots() ([]string, error) {
+	if c.serverConf.Datacenter != c.serverConf.PrimaryDatacenter {
+		return nil, ErrNotPrimaryDatacenter
+	}
+
+	oldState, err := c.setState(caStateReconfig, true)
+	if err != nil {
+		return nil, err
+	}
+	defer c.setState(oldState, false)
+
+	state := c.delegate.State()
+	idx, roots, err := state.CARoots(nil)
+	if err != nil {
+		return nil, err
+	}
+	_, config, err := state.CAConfig(nil)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("CA is not configured")
+	}
+	commonCfg, err := config.GetCommonConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.timeNow()
+	var keep structs.CARoots
+	var pruned []string
+	for _, r := range roots {
+		if rootNeeded(r, commonCfg, now) {
+			newRoot := *r
+			keep = append(keep, &newRoot)
+			continue
+		}
+		pruned = append(pruned, r.ID)
+	}
+	if len(pruned) == 0 {
+		return nil, nil
+	}
+
+	resp, err := c.delegate.ApplyCARequest(&structs.CARequest{
+		Op:    structs.CAOpSetRoots,
+		Index: idx,
+		Roots: keep,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if respOk, ok := resp.(bool); ok && !respOk {
+		return nil, fmt.Errorf("could not atomically update roots")
+	}
+
+	c.logger.Info("pruned CA roots no longer needed to validate leaf certificates", "root_ids", pruned)
+	return pruned, nil
+}
+
+// rootNeeded returns whether the root may still be needed to validate a leaf
+// certificate at now. See PruneRoots.
+func rootNeeded(r *structs.CARoot, commonCfg *structs.CommonCAProviderConfig, now time.Time) bool {
+	if r.Active {
+		return true
+	}
+	if !r.NotAfter.IsZero() && now.After(r.NotAfter) {
+		return false
+	}
+	if commonCfg.PreviousTrustDomain != "" && r.ExternalTrustDomain != "" &&
+		strings.EqualFold(connect.SpiffeIDSigningForCluster(r.ExternalTrustDomain).Host(), commonCfg.PreviousTrustDomain) {
+		return true
+	}
+	// Roots rotated out before this was recorded can't be told apart from ones
+	// still signing leaf certificates in some way, so they are kept.
+	if r.RotatedOutAt.IsZero() {
+		return true
+	}
+	return !now.After(r.RotatedOutAt.Add(commonCfg.LeafCertTTL))
+}
+
+// checkMaxActiveRoots returns an error wrapping ErrMaxActiveRootsExceeded if
+// storing roots would keep more roots than the MaxActiveRoots of config.
+func checkMaxActiveRoots(config *structs.CAConfiguration, roots structs.CARoots) error {
+	commonCfg, err := config.GetCommonConfig()
+	if err != nil {
+		return err
+	}
+	if commonCfg.MaxActiveRoots == 0 {
+		return nil
+	}
+	ids := make(map[string]struct{}, len(roots))
+	for _, r := range roots {
+		ids[r.ID] = struct{}{}
+	}
+	if len(ids) > commonCfg.MaxActiveRoots {
+		return fmt.Errorf("%w: rotating would keep %d roots but at most %d are allowed, "+
+			"prune the roots that are no longer needed first", ErrMaxActiveRootsExceeded, len(ids), commonCfg.MaxActiveRoots)
+	}
+	return nil
+}
+
+// checkKeyIDCollision returns an error wrapping ErrSigningKeyIDCollision if
+// the root or leaf signing cert of newActiveRoot has the same SubjectKeyId as
+// the root or leaf signing cert of another root in roots. Certs are matched
+// to roots by key ID, for example in hasLeafSigningCert, so a collision could
+// make the wrong cert be picked, and it means that a key was reused.
+func (c *CAManager) checkKeyIDCollision(newActiveRoot *structs.CARoot, roots structs.CARoots) error {
+	newKeyIDs := caRootKeyIDs(newActiveRoot)
+	for _, r := range roots {
+		if r.ID == newActiveRoot.ID {
+			continue
+		}
+		for _, keyID := range caRootKeyIDs(r) {
+			for _, newKeyID := range newKeyIDs {
+				if keyID != newKeyID {
+					continue
+				}
+				c.logger.Error("refusing to install a CA root whose key ID collides with another root",
+					"root_id", newActiveRoot.ID,
+					"colliding_root_id", r.ID,
+					"key_id", keyID,
+				)
+				return fmt.Errorf("%w: key ID %s of root %s is already used by root %s, "+
+					"generate a new private key", ErrSigningKeyIDCollision, keyID, newActiveRoot.ID, r.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// caRootKeyIDs returns the encoded key IDs of the root cert and of the leaf
+// signing cert of root, which are the same when leaves are signed by the root.
+func caRootKeyIDs(root *structs.CARoot) []string {
+	var keyIDs []string
+	if root.SigningKeyID != "" {
+		keyIDs = append(keyIDs, root.SigningKeyID)
+	}
+	if cert, err := connect.ParseCert(root.RootCert); err == nil && len(cert.SubjectKeyId) > 0 {
+		if keyID := connect.EncodeSigningKeyID(cert.SubjectKeyId); keyID != root.SigningKeyID {
+			keyIDs = append(keyIDs, keyID)
+		}
+	}
+	return keyIDs
+}
+
+// primaryRenewIntermediate regenerates the intermediate cert in the primary datacenter.
+// This is only run for CAs that require an intermediary in the primary DC, such as Vault.
+// It should only be called while the state lock is held by setting the state to non-ready.
+func (c *CAManager) primaryRenewIntermediate(ctx context.Context, provider ca.Provider, newActiveRoot *structs.CARoot) error {
+	// Generate and sign an intermediate cert using the root CA.
+	intermediatePEM, err := c.generateIntermediate(ctx, provider)
+	if err != nil {
+		return fmt.Errorf("error generating new intermediate cert: %v", err)
+	}
+	if err := c.checkIntermediateKeyNotRoot(intermediatePEM, newActiveRoot); err != nil {
+		return err
+	}
+
+	if err := setLeafSigningCert(newActiveRoot, intermediatePEM); err != nil {
+		return err
+	}
+	c.emitEvent(CAEventIntermediateRenewed, c.configuredProviderName(), newActiveRoot.ID)
+
+	c.logger.Info("generated new intermediate certificate for primary datacenter")
+	return nil
+}
+
+// intermediatePollWait is how long generateIntermediate first waits before
+// polling for an intermediate signed asynchronously again, doubling every
+// time up to maxIntermediatePollWait. It gives up after
+// intermediatePollTimeout.
+var (
+	intermediatePollWait    = 1 * time.Second
+	maxIntermediatePollWait = 30 * time.Second
+	intermediatePollTimeout = 10 * time.Minute
+)
+
+// generateIntermediate returns a new intermediate generated by provider. For
+// providers implementing ca.AsyncIntermediateGenerator, it submits the
+// intermediate and polls for it until it is signed, ctx is done or
+// intermediatePollTimeout passed.
+func (c *CAManager) generateIntermediate(ctx context.Context, provider ca.Provider) (string, error) {
+	generator, ok := provider.(ca.AsyncIntermediateGenerator)
+	if !ok {
+		return provider.GenerateIntermediate()
+	}
+
+	handle, err := generator.SubmitIntermediate()
+	if err != nil {
+		return "", fmt.Errorf("error submitting intermediate cert: %w", err)
+	}
+	c.logger.Info("submitted intermediate certificate for signing", "handle", handle)
+
+	ctx, cancel := context.WithTimeout(ctx, intermediatePollTimeout)
+	defer cancel()
+
+	wait := intermediatePollWait
+	for {
+		cert, done, err := generator.PollIntermediate(handle)
+		if err != nil {
+			return "", fmt.Errorf("error polling for intermediate cert %q: %w", handle, err)
+		}
+		if done {
+			return cert, nil
+		}
+
+		c.logger.Debug("intermediate certificate not signed yet", "handle", handle, "retry_in", wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", fmt.Errorf("gave up waiting for intermediate cert %q: %w", handle, ctx.Err())
+		case <-timer.C:
+		}
+		if wait *= 2; wait > maxIntermediatePollWait {
+			wait = maxIntermediatePollWait
+		}
+	}
+}
+
+// intermediateSignRetryWait is about how long a secondary first waits to
+// retry the request to sign its intermediate when the primary is rate limiting
+// them, doubling for each of up to intermediateSignRetries retries. The waits
+// are jittered so that the many secondaries rate limited at once don't all
+// retry at once again.
+var (
+	intermediateSignRetryWait = 1 * time.Second
+	intermediateSignRetries   = 4
+)
+
+// leaderContext returns the context of the current leadership term, which is
+// canceled when leadership is lost, or a background context when the CA
+// manager wasn't started as a leader.
+func (c *CAManager) leaderContext() context.Context {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	if c.leaderCtx == nil {
+		return context.Background()
+	}
+	return c.leaderCtx
+}
+
+// forwardSignIntermediate forwards the intermediate CSR to the primary to be
+// signed, retrying with a jittered backoff while the primary is rate limiting.
+// It stops retrying when ctx is canceled, such as when leadership is lost.
+func (c *CAManager) forwardSignIntermediate(ctx context.Context, csr string) (string, error) {
+	wait := intermediateSignRetryWait
+	for attempt := 0; ; attempt++ {
+		var intermediatePEM string
+		err := c.delegate.forwardDC("ConnectCA.SignIntermediate", c.serverConf.PrimaryDatacenter, c.delegate.generateCASignRequest(csr), &intermediatePEM)
+		// The error crossed the RPC boundary so only its message is left.
+		if err == nil || err.Error() != ErrRateLimited.Error() || attempt >= intermediateSignRetries {
+			return intermediatePEM, err
+		}
+
+		jittered := wait/2 + lib.RandomStagger(wait)
+		c.logger.Warn("primary datacenter is rate limiting intermediate signing, retrying",
+			"retry_in", jittered,
+		)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(jittered):
+		}
+		wait *= 2
+	}
+}
+
+// secondaryRequestNewSigningCert creates a Certificate Signing Request, sends
+// the request to the primary, and stores the received certificate in the
+// provider.
+// Should only be called while the state lock is held by setting the state to non-ready.
+func (c *CAManager) secondaryRequestNewSigningCert(provider ca.Provider, newActiveRoot *structs.CARoot) error {
+	csr, err := provider.GenerateIntermediateCSR()
+	if err != nil {
+		return err
+	}
+
+	intermediatePEM, err := c.forwardSignIntermediate(c.leaderContext(), csr)
+	if err != nil {
+		// this is a failure in the primary and shouldn't be capable of erroring out our establishing leadership
+		c.logger.Warn("Primary datacenter refused to sign our intermediate CA certificate", "error", err)
+		return nil
+	}
+
+	if err := checkInputSize("intermediate certificate from the primary datacenter", len(intermediatePEM), c.serverConf.ConnectCAMaxChainSize); err != nil {
+		return err
+	}
+	// Providers don't all check the intermediate themselves, and installing
+	// one that doesn't chain to the root would break all local signing.
+	if err := verifyIntermediateChainsToRoot(intermediatePEM, newActiveRoot); err != nil {
+		c.logger.Error("refusing the intermediate certificate signed by the primary datacenter",
+			"root_id", newActiveRoot.ID,
+			"error", err,
+		)
+		return err
+	}
+	if err := c.checkIntermediateKeyNotRoot(intermediatePEM, newActiveRoot); err != nil {
+		c.logger.Error("refusing the intermediate certificate signed by the primary datacenter",
+			"root_id", newActiveRoot.ID,
+			"error", err,
+		)
+		return err
+	}
+	if err := provider.SetIntermediate(intermediatePEM, newActiveRoot.RootCert); err != nil {
+		return fmt.Errorf("Failed to set the intermediate certificate with the CA provider: %v", err)
+	}
+
+	if err := setLeafSigningCert(newActiveRoot, intermediatePEM); err != nil {
+		return err
+	}
+	c.emitEvent(CAEventIntermediateRenewed, c.configuredProviderName(), newActiveRoot.ID)
+
+	c.logger.Info("received new intermediate certificate from primary datacenter")
+	return nil
+}
+
+// verifyIntermediateChainsToRoot returns an error wrapping
+// ErrIntermediateNotSignedByRoot if the first certificate of intermediatePEM,
+// an intermediate signed by the primary datacenter, isn't a CA chaining to the
+// root cert of root, possibly through the rest of intermediatePEM and the
+// intermediates of root. Like for verifyChainsToRoot, validity periods aren't
+// checked.
+func verifyIntermediateChainsToRoot(intermediatePEM string, root *structs.CARoot) error {
+	intermediate, err := connect.ParseCert(intermediatePEM)
+	if err != nil {
+		return fmt.Errorf("error parsing intermediate certificate from the primary datacenter: %w", err)
+	}
+	if !intermediate.IsCA {
+		return fmt.Errorf("%w: the certificate is not a CA", ErrIntermediateNotSignedByRoot)
+	}
+
+	chain := ca.EnsureTrailingNewline(intermediatePEM)
+	for _, p := range root.IntermediateCerts {
+		chain += ca.EnsureTrailingNewline(p)
+	}
+	if err := verifyChainsToRoot(chain, root.RootCert); err != nil {
+		return fmt.Errorf("%w: intermediate %q from root %s: %v",
+			ErrIntermediateNotSignedByRoot, intermediate.Subject.CommonName, root.ID, err)
+	}
+	return nil
+}
+
+// checkIntermediateKeyNotRoot returns an error wrapping
+// ErrIntermediateHasRootKey when the first certificate of intermediatePEM has
+// the public key of the root cert of root, such as the root re-issued by a
+// misconfigured external CA, unless AllowSingleTier is set in the CA
+// configuration. The root cert itself, which providers signing leaf
+// certificates with their root return as their intermediate, is accepted.
+func (c *CAManager) checkIntermediateKeyNotRoot(intermediatePEM string, root *structs.CARoot) error {
+	intermediate, err := connect.ParseCert(intermediatePEM)
+	if err != nil {
+		return fmt.Errorf("error parsing intermediate certificate: %w", err)
+	}
+	rootCert, err := connect.ParseCert(root.RootCert)
+	if err != nil {
+		return fmt.Errorf("error parsing root certificate: %w", err)
+	}
+	if bytes.Equal(intermediate.Raw, rootCert.Raw) ||
+		!bytes.Equal(intermediate.RawSubjectPublicKeyInfo, rootCert.RawSubjectPublicKeyInfo) {
+		return nil
+	}
+
+	_, config, err := c.delegate.State().CAConfig(nil)
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		commonCfg, err := config.GetCommonConfig()
+		if err != nil {
+			return err
+		}
+		if commonCfg.AllowSingleTier {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: intermediate %q has the same public key as root %s, "+
+		"which defeats the purpose of a separate signing key; set AllowSingleTier in the CA configuration if this is intended",
+		ErrIntermediateHasRootKey, intermediate.Subject.CommonName, root.ID)
+}
+
+// checkInputSize returns an error wrapping ErrInputTooLarge when an input of
+// size bytes is larger than max, so that it can be rejected before being
+// parsed. A max of zero disables the check.
+func checkInputSize(what string, size, max int) error {
+	if max > 0 && size > max {
+		return fmt.Errorf("%w: %s is %d bytes, the limit is %d", ErrInputTooLarge, what, size, max)
+	}
+	return nil
+}
+
+// setLeafSigningCert updates the CARoot by appending the pem to the list of
+// intermediate certificates, and setting the SigningKeyID to the encoded
+// SubjectKeyId of the certificate.
+func setLeafSigningCert(caRoot *structs.CARoot, pem string) error {
+	cert, err := connect.ParseCert(pem)
+	if err != nil {
+		return fmt.Errorf("error parsing leaf signing cert: %w", err)
+	}
+
+	caRoot.IntermediateCerts = append(caRoot.IntermediateCerts, pem)
+	caRoot.SigningKeyID = connect.EncodeSigningKeyID(cert.SubjectKeyId)
+	return nil
+}
+
+// supersedeIntermediate records in root that the intermediate with the signing
+// key ID prevKeyID was replaced at now by the one signing leaf certificates.
+func supersedeIntermediate(root *structs.CARoot, prevKeyID string, now time.Time) {
+	if prevKeyID == "" || prevKeyID == root.SigningKeyID {
+		return
+	}
+	if root.IntermediatesSupersededAt == nil {
+		root.IntermediatesSupersededAt = make(map[string]time.Time)
+	}
+	root.IntermediatesSupersededAt[prevKeyID] = now
+}
+
+// pruneSupersededIntermediates removes from the IntermediateCerts of root the
+// intermediates that were replaced at least grace before now, and returns
+// whether it removed any. A grace of zero keeps them all. Only intermediates
+// recorded by supersedeIntermediate are removed, never cross-signed certs.
+func pruneSupersededIntermediates(root *structs.CARoot, now time.Time, grace time.Duration) bool {
+	if grace <= 0 || len(root.IntermediatesSupersededAt) == 0 {
+		return false
+	}
+
+	var kept []string
+	for _, p := range root.IntermediateCerts {
+		if cert, err := connect.ParseCert(p); err == nil {
+			keyID := connect.EncodeSigningKeyID(cert.SubjectKeyId)
+			at, ok := root.IntermediatesSupersededAt[keyID]
+			if ok && keyID != root.SigningKeyID && !now.Before(at.Add(grace)) {
+				continue
+			}
+		}
+		kept = append(kept, p)
+	}
+	for keyID, at := range root.IntermediatesSupersededAt {
+		if !now.Before(at.Add(grace)) {
+			delete(root.IntermediatesSupersededAt, keyID)
+		}
+	}
+	if len(kept) == len(root.IntermediateCerts) {
+		return false
+	}
+	root.IntermediateCerts = kept
+	return true
+}
+
+// runRenewIntermediate periodically attempts to renew the intermediate cert.
+func (c *CAManager) runRenewIntermediate(ctx context.Context) error {
+	isPrimary := c.serverConf.Datacenter == c.serverConf.PrimaryDatacenter
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.intermediateRenewalWait(isPrimary)):
+			retryLoopBackoffAbortOnSuccess(ctx, func() error {
+				return c.RenewIntermediate(ctx, isPrimary)
+			}, c.logRenewIntermediateError)
+		}
+	}
+}
+
+// intermediateRenewalWait returns how long to wait before checking whether the
+// intermediate cert needs to be renewed, which is at most
+// IntermediateCertRenewInterval. It is computed from the validity of the
+// installed intermediate rather than the configured IntermediateCertTTL, since
+// the CA which signed it may have issued it for less.
+func (c *CAManager) intermediateRenewalWait(isPrimary bool) time.Duration {
+	wait := structs.IntermediateCertRenewInterval
+
+	provider, _ := c.getCAProvider()
+	if provider == nil || (isPrimary && !primaryUsesIntermediate(provider)) {
+		return wait
+	}
+	intermediatePEM, err := provider.ActiveIntermediate()
+	if err != nil || intermediatePEM == "" {
+		return wait
+	}
+	intermediateCert, err := connect.ParseCert(intermediatePEM)
+	if err != nil {
+		return wait
+	}
+
+	// An intermediate already past half its lifetime was just renewed or
+	// failed to, and is checked again after the usual interval rather than
+	// right away.
+	renewAt := intermediateCert.NotBefore.Add(halfTime(intermediateCert.NotBefore, intermediateCert.NotAfter))
+	if _, config, err := c.delegate.State().CAConfig(nil); err == nil && config != nil {
+		if commonCfg, err := config.GetCommonConfig(); err == nil && commonCfg.MinIntermediateRemaining > 0 {
+			if at := intermediateCert.NotAfter.Add(-commonCfg.MinIntermediateRemaining); at.Before(renewAt) {
+				renewAt = at
+			}
+		}
+	}
+	if untilRenewal := renewAt.Sub(c.timeNow()); untilRenewal > 0 && untilRenewal < wait {
+		wait = untilRenewal
+	}
+	return wait
+}
+
+// logRenewIntermediateError logs a failed renewal of the intermediate cert.
+// Failures are only warned about until the intermediate is close to expiring,
+// when they need attention.
+func (c *CAManager) logRenewIntermediateError(err error) {
+	logFn := c.logger.Warn
+	if errors.Is(err, ErrIntermediateRenewalStalled) {
+		logFn = c.logger.Error
+	}
+	logFn("error renewing intermediate certs",
+		"routine", intermediateCertRenewWatchRoutineName,
+		"error", err,
+	)
+}
+
+// RenewIntermediate checks the intermediate cert for
+// expiration. If more than half the time a cert is valid has passed,
+// it will try to renew it.
+func (c *CAManager) RenewIntermediate(ctx context.Context, isPrimary bool) error {
+	// Grab the 'lock' right away so the provider/config can't be changed out while we check
+	// the intermediate.
+	if _, err := c.setState(caStateRenewIntermediate, true); err != nil {
+		return err
+	}
+	defer c.setState(caStateInitialized, false)
+
+	provider, _ := c.getCAProvider()
+	if provider == nil {
+		// this happens when leadership is being revoked and this go routine will be stopped
+		return nil
+	}
+	// If this isn't the primary, make sure the CA has been initialized.
+	if !isPrimary && !c.secondaryHasProviderRoots() {
+		return fmt.Errorf("secondary CA is not yet configured.")
+	}
+
+	state := c.delegate.State()
+	_, root, err := state.CARootActive(nil)
+	if err != nil {
+		return err
+	}
+	activeRoot := root.Clone()
+
+	// If this is the primary, check if this is a provider that uses an intermediate cert. If
+	// it isn't, we don't need to check for a renewal.
+	if isPrimary && !primaryUsesIntermediate(provider) {
+		return nil
+	}
+
+	intermediatePEM, err := activeIntermediate(provider)
+	if err != nil {
+		return err
+	}
+
+	intermediateCert, err := connect.ParseCert(intermediatePEM)
+	if err != nil {
+		return fmt.Errorf("error parsing active intermediate cert: %v", err)
+	}
+
+	_, config, err := state.CAConfig(nil)
+	if err != nil {
+		return err
+	}
+	commonCfg, err := config.GetCommonConfig()
+	if err != nil {
+		return err
+	}
+
+	if !belowMinIntermediateRemaining(intermediateCert, commonCfg, c.timeNow()) &&
+		lessThanHalfTimePassed(c.timeNow(), intermediateCert.NotBefore, intermediateCert.NotAfter) {
+		if !pruneSupersededIntermediates(activeRoot, c.timeNow(), c.intermediateGracePeriod(commonCfg.IntermediateGracePeriod)) {
+			return nil
+		}
+		c.logger.Info("dropped intermediate certificates replaced for longer than the grace period",
+			"root_id", activeRoot.ID,
+		)
+		if err := c.persistNewRootAndConfig(provider, activeRoot, nil); err != nil {
+			return err
+		}
+		c.setCAProvider(provider, activeRoot)
+		return nil
+	}
+
+	// Enough time has passed, go ahead with getting a new intermediate.
+	prevSigningKeyID := activeRoot.SigningKeyID
+	renewalFunc := func(provider ca.Provider, newActiveRoot *structs.CARoot) error {
+		return c.primaryRenewIntermediate(ctx, provider, newActiveRoot)
+	}
+	if !isPrimary {
+		renewalFunc = c.secondaryRequestNewSigningCert
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- renewalFunc(provider, activeRoot)
+	}()
+
+	// Wait for the renewal func to return or for the context to be canceled.
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errCh:
+		if err != nil {
+			return c.intermediateRenewalFailed(intermediateCert, err)
+		}
+	}
+	now := c.timeNow()
+	supersedeIntermediate(activeRoot, prevSigningKeyID, now)
+	pruneSupersededIntermediates(activeRoot, now, c.intermediateGracePeriod(commonCfg.IntermediateGracePeriod))
+
+	if err := c.persistNewRootAndConfig(provider, activeRoot, nil); err != nil {
+		return err
+	}
+
+	c.setCAProvider(provider, activeRoot)
+	return nil
+}
+
+// intermediateRenewalFailed returns the error of a failed renewal of cert. Once
+// less than a quarter of the lifetime of cert is left, the error wraps
+// ErrIntermediateRenewalStalled and is counted, since leaf certificates can't
+// be signed anymore when cert expires.
+func (c *CAManager) intermediateRenewalFailed(cert *x509.Certificate, err error) error {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	remaining := cert.NotAfter.Sub(c.timeNow())
+	if remaining > lifetime/4 {
+		return err
+	}
+
+	metrics.IncrCounter(metricsKeyCAIntermediateRenewalStalled, 1)
+	if remaining <= 0 {
+		return fmt.Errorf("%w: the intermediate expired at %s: %v", ErrIntermediateRenewalStalled, cert.NotAfter, err)
+	}
+	return fmt.Errorf("%w: the intermediate expires in %s: %v", ErrIntermediateRenewalStalled, remaining.Round(time.Second), err)
+}
+
+// secondaryCARootWatch maintains a blocking query to the primary datacenter's
+// ConnectCA.SigningInfo endpoint to monitor when it needs to request a new
+// signed intermediate certificate. The roots are only fetched when the signing
+// info changes. Primaries which don't support ConnectCA.SigningInfo yet are
+// watched through ConnectCA.Roots instead.
+func (c *CAManager) secondaryCARootWatch(ctx context.Context) error {
+	args := structs.DCSpecificRequest{
+		Datacenter: c.serverConf.PrimaryDatacenter,
+		QueryOptions: structs.QueryOptions{
+			// the maximum time the primary roots watch query can block before returning
+			MaxQueryTime: c.serverConf.MaxQueryTime,
+		},
+	}
+
+	c.logger.Debug("starting Connect CA root replication from primary datacenter", "primary", c.serverConf.PrimaryDatacenter)
+
+	useSigningInfo := true
+	var lastActiveRootID string
+	retryLoopBackoff(ctx, func() error {
+		var index uint64
+		rootsArgs := args
+		if useSigningInfo {
+			var info structs.CASigningInfo
+			err := c.delegate.forwardDC("ConnectCA.SigningInfo", c.serverConf.PrimaryDatacenter, &args, &info)
+			switch {
+			case err != nil && strings.Contains(err.Error(), "rpc: can't find method"):
+				c.logger.Debug("primary datacenter doesn't support ConnectCA.SigningInfo, watching its roots instead")
+				useSigningInfo = false
+			case err != nil:
+				return fmt.Errorf("Error retrieving the primary datacenter's signing info: %v", err)
+			default:
+				if err := c.secondaryDebounceRotation(ctx, lastActiveRootID, info.ActiveRootID); err != nil {
+					return err
+				}
+				index = info.QueryMeta.Index
+				// The signing info already waited for a change, get the
+				// roots as they are now.
+				rootsArgs.QueryOptions = structs.QueryOptions{}
+			}
+		}
+
+		var roots structs.IndexedCARoots
+		if err := c.delegate.forwardDC("ConnectCA.Roots", c.serverConf.PrimaryDatacenter, &rootsArgs, &roots); err != nil {
+			return fmt.Errorf("Error retrieving the primary datacenter's roots: %v", err)
+		}
+		if !useSigningInfo {
+			index = roots.QueryMeta.Index
+		}
+
+		// Return if the context has been canceled while waiting on the RPC.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		// Attempt to update the roots using the returned data.
+		if err := c.secondaryUpdateRoots(roots); err != nil {
+			return err
+		}
+		lastActiveRootID = roots.ActiveRootID
+		args.QueryOptions.MinQueryIndex = nextIndexVal(args.QueryOptions.MinQueryIndex, index)
+		return nil
+	}, func(err error) {
+		c.logger.Error("CA root replication failed, will retry",
+			"routine", secondaryCARootWatchRoutineName,
+			"error", err,
+		)
+	})
+
+	return nil
+}
+
+// secondaryDebounceRotation waits for ConnectCASecondaryRotationDebounce when
+// the active root of the primary changed from lastActiveRootID to
+// activeRootID, so that the roots are fetched once a rotation done in
+// several steps settled.
+func (c *CAManager) secondaryDebounceRotation(ctx context.Context, lastActiveRootID, activeRootID string) error {
+	debounce := c.serverConf.ConnectCASecondaryRotationDebounce
+	if debounce <= 0 || lastActiveRootID == "" || lastActiveRootID == activeRootID {
+		return nil
+	}
+
+	c.logger.Info("primary datacenter rotated its root, waiting before renewing the intermediate",
+		"previous_root_id", lastActiveRootID,
+		"root_id", activeRootID,
+		"wait", debounce,
+	)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(debounce):
+		return nil
+	}
+}
+
+// secondaryUpdateRoots updates the cached roots from the primary and regenerates the intermediate
+// certificate if necessary.
+func (c *CAManager) secondaryUpdateRoots(roots structs.IndexedCARoots) error {
+	// Update the state first to claim the 'lock'.
+	if _, err := c.setState(caStateReconfig, true); err != nil {
+		return err
+	}
+	defer c.setState(caStateInitialized, false)
+
+	// Update the cached primary roots now that the lock is held.
+	c.secondarySetPrimaryRoots(roots)
+
+	provider, _ := c.getCAProvider()
+	if provider == nil {
+		// this happens when leadership is being revoked and this go routine will be stopped
+		return nil
+	}
+
+	// Run the secondary CA init routine to see if we need to request a new
+	// intermediate.
+	if c.secondaryHasProviderRoots() {
+		if err := c.secondaryInitializeIntermediateCA(provider, nil); err != nil {
+			return fmt.Errorf("Failed to initialize the secondary CA: %v", err)
+		}
+		return nil
+	}
+
+	// Attempt to initialize now that we have updated roots. This is an optimization
+	// so that we don't have to wait for the Initialize retry backoff if we were
+	// waiting on roots from the primary to be able to complete initialization.
+	if err := c.delegate.ServersSupportMultiDCConnectCA(); err != nil {
+		return fmt.Errorf("failed to initialize while updating primary roots: %w", err)
+	}
+	if err := c.secondaryInitializeProvider(provider, roots); err != nil {
+		return fmt.Errorf("Failed to initialize secondary CA provider: %v", err)
+	}
+	if err := c.secondaryInitializeIntermediateCA(provider, nil); err != nil {
+		return fmt.Errorf("Failed to initialize the secondary CA: %v", err)
+	}
+	return nil
+}
+
+// secondaryInitializeProvider configures the given provider for a secondary, non-root datacenter.
+func (c *CAManager) secondaryInitializeProvider(provider ca.Provider, roots structs.IndexedCARoots) error {
+	if roots.TrustDomain == "" {
+		return fmt.Errorf("trust domain from primary datacenter is not initialized")
+	}
+
+	clusterID := strings.Split(roots.TrustDomain, ".")[0]
+	_, conf, err := c.delegate.State().CAConfig(nil)
+	if err != nil {
+		return err
+	}
+
+	providerState, err := c.resolveProviderState(conf.State, conf.StateRefs)
+	if err != nil {
+		return err
+	}
+	pCfg := ca.ProviderConfig{
+		ClusterID:  clusterID,
+		Datacenter: c.serverConf.Datacenter,
+		IsPrimary:  false,
+		RawConfig:  conf.Config,
+		State:      providerState,
+	}
+	if err := provider.Configure(pCfg); err != nil {
+		return fmt.Errorf("error configuring provider: %v", err)
+	}
+	c.emitEvent(CAEventProviderConfigured, conf.Provider, "")
+	return nil
+}
+
+// secondaryHasProviderRoots returns true after providerRoot has been set. This
+// method is used to detect when the secondary has received the roots from the
+// primary DC.
+func (c *CAManager) secondaryHasProviderRoots() bool {
+	// TODO: this could potentially also use primaryRoots instead of providerRoot
+	c.providerLock.Lock()
+	defer c.providerLock.Unlock()
+	return c.providerRoot != nil
+}
+
+type connectSignRateLimiter struct {
+	// csrRateLimiter limits the rate of signing new certs if configured. Lazily
+	// initialized from current config to support dynamic changes.
+	// csrRateLimiterMu must be held while dereferencing the pointer or storing a
+	// new one, but methods can be called on the limiter object outside of the
+	// locked section. This is done only in the getCSRRateLimiterWithLimit method.
+	csrRateLimiter   *rate.Limiter
+	csrRateLimiterMu sync.RWMutex
+
+	// csrConcurrencyLimiter is a dynamically resizable semaphore used to limit
+	// Sign RPC concurrency if configured. The zero value is usable as soon as
+	// SetSize is called which we do dynamically in the RPC handler to avoid
+	// having to hook elaborate synchronization mechanisms through the CA config
+	// endpoint and config reload etc.
+	csrConcurrencyLimiter semaphore.Dynamic
+}
+
+// getCSRRateLimiterWithLimit returns a rate.Limiter with the desired limit set.
+// It uses the shared server-wide limiter unless the limit has been changed in
+// config or the limiter has not been setup yet in which case it just-in-time
+// configures the new limiter. We assume that limit changes are relatively rare
+// and that all callers (there is currently only one) use the same config value
+// as the limit. There might be some flapping if there are multiple concurrent
+// requests in flight at the time the config changes where A sees the new value
+// and updates, B sees the old but then gets this lock second and changes back.
+// Eventually though and very soon (once all current RPCs are complete) we are
+// guaranteed to have the correct limit set by the next RPC that comes in so I
+// assume this is fine. If we observe strange behavior because of it, we could
+// add hysteresis that prevents changes too soon after a previous change but
+// that seems unnecessary for now.
+func (l *connectSignRateLimiter) getCSRRateLimiterWithLimit(limit rate.Limit) *rate.Limiter {
+	l.csrRateLimiterMu.RLock()
+	lim := l.csrRateLimiter
+	l.csrRateLimiterMu.RUnlock()
+
+	// If there is a current limiter with the same limit, return it. This should
+	// be the common case.
+	if lim != nil && lim.Limit() == limit {
+		return lim
+	}
+
+	// Need to change limiter, get write lock
+	l.csrRateLimiterMu.Lock()
+	defer l.csrRateLimiterMu.Unlock()
+	// No limiter yet, or limit changed in CA config, reconfigure a new limiter.
+	// We use burst of 1 for a hard limit. Note that either bursting or waiting is
+	// necessary to get expected behavior in fact of random arrival times, but we
+	// don't need both and we use Wait with a small delay to smooth noise. See
+	// https://github.com/banks/sim-rate-limit-backoff/blob/master/README.md.
+	l.csrRateLimiter = rate.NewLimiter(limit, 1)
+	return l.csrRateLimiter
+}
+
+// SignCertificate signs the CSR and returns the leaf followed by the
+// intermediates needed to chain it to the active root.
+func (c *CAManager) SignCertificate(csr *x509.CertificateRequest, spiffeID connect.CertURI) (*structs.IssuedCert, error) {
+	return c.SignCertificateWithChainOrder(csr, spiffeID, structs.CAChainOrderLeafFirst)
+}
+
+// SignCertificateWithChainOrder is like SignCertificate but returns the chain
+// in the given order.
+func (c *CAManager) SignCertificateWithChainOrder(csr *x509.CertificateRequest, spiffeID connect.CertURI, order structs.CAChainOrder) (*structs.IssuedCert, error) {
+	return c.SignCertificateWithContext(context.Background(), csr, spiffeID, order, nil)
+}
+
+// secondaryIssuingChain returns the issuing chain of the leaf certificates
+// signed with caRoot in a secondary datacenter: the local intermediate
+// followed by the intermediates of the primary datacenter, from the one that
+// signed the local intermediate up to the root. The intermediates of the
+// primary come from its most recently seen roots, which also reflect renewals
+// of the intermediate of the primary, as long as its active root is still
+// caRoot, and from caRoot otherwise.
+func (c *CAManager) secondaryIssuingChain(caRoot *structs.CARoot) ([]string, error) {
+	local := c.getLeafSigningCertFromRoot(caRoot)
+	if local == "" {
+		return nil, fmt.Errorf("active root %s has no leaf signing certificate", caRoot.ID)
+	}
+	local = ca.EnsureTrailingNewline(local)
+
+	primaryRoot := caRoot
+	if root, err := c.secondaryGetActivePrimaryCARoot(); err == nil && root.ID == caRoot.ID {
+		primaryRoot = root
+	}
+
+	chain := []string{local}
+	seen := map[string]bool{local: true}
+	for i := len(primaryRoot.IntermediateCerts) - 1; i >= 0; i-- {
+		p := ca.EnsureTrailingNewline(primaryRoot.IntermediateCerts[i])
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		chain = append(chain, p)
+	}
+	return chain, nil
+}
+
+// SignIntermediate signs the intermediate CSR of a secondary datacenter,
+// waiting for a slot first when IntermediateSignMaxConcurrent is set so that
+// many secondaries renewing at once don't overwhelm the primary.
+func (c *CAManager) SignIntermediate(csr *x509.CertificateRequest) (string, error) {
+	provider, _ := c.getCAProvider()
+	if provider == nil {
+		return "", fmt.Errorf("internal error: CA provider is nil")
+	}
+
+	_, config, err := c.delegate.State().CAConfig(nil)
+	if err != nil {
+		return "", err
+	}
+	if config == nil {
+		return "", fmt.Errorf("CA configuration not found")
+	}
+	commonCfg, err := config.GetCommonConfig()
+	if err != nil {
+		return "", err
+	}
+
+	if commonCfg.IntermediateSignMaxConcurrent > 0 {
+		c.intermediateSignLimiter.SetSize(int64(commonCfg.IntermediateSignMaxConcurrent))
+		ctx, cancel := context.WithTimeout(context.Background(), intermediateSignLimitWait)
+		defer cancel()
+		if err := c.intermediateSignLimiter.Acquire(ctx); err != nil {
+			c.logger.Warn("too many concurrent intermediate signing requests, rejecting one",
+				"limit", commonCfg.IntermediateSignMaxConcurrent,
+			)
+			return "", ErrRateLimited
+		}
+		defer c.intermediateSignLimiter.Release()
+	}
+
+	return provider.SignIntermediate(context.Background(), csr)
+}
+
+// signTimeoutError is returned when the provider did not sign a certificate
+// before the deadline of the request. Its message is the one of
+// ErrSignTimeout so that clients, which can only compare error strings over
+// net/rpc, can tell it apart from rate limiting and retry it.
+type signTimeoutError struct {
+	err error
+}
+
+func (e signTimeoutError) Error() string {
+	return ErrSignTimeout.Error()
+}
+
+func (e signTimeoutError) Unwrap() error {
+	return e.err
+}
+
+func (e signTimeoutError) Is(target error) bool {
+	return target == ErrSignTimeout
+}
+
+// SignCertificateWithContext is like SignCertificateWithChainOrder but gives
+// up waiting for the provider once ctx is done, returning an error that
+// matches both ErrSignTimeout and the context error. The CSR is only signed
+// when the provider accepts the attestation of its key, if there is one.
+func (c *CAManager) SignCertificateWithContext(ctx context.Context, csr *x509.CertificateRequest, spiffeID connect.CertURI, order structs.CAChainOrder, attestation []byte) (*structs.IssuedCert, error) {
+	return c.signCertificate(ctx, csr, spiffeID, order, attestation, leafSignOptions{})
+}
+
+// SignAutoConfigCertificate signs the leaf certificate of an agent that
+// authenticated with auto-config. Auto-config requests can't carry an
+// attestation, and the agent proved its identity with its intro token
+// instead, so the certificate is signed even when the CA configuration sets
+// RequireAttestation. Only agent identities are exempt.
+func (c *CAManager) SignAutoConfigCertificate(csr *x509.CertificateRequest, agentID *connect.SpiffeIDAgent) (*structs.IssuedCert, error) {
+	return c.signCertificate(context.Background(), csr, agentID, structs.CAChainOrderLeafFirst, nil, leafSignOptions{attestationExempt: true})
+}
+
+// leafSignOptions are the variations of signCertificate for the different
+// kinds of leaf certificates.
+type leafSignOptions struct {
+	// attestationExempt has RequireAttestation not apply, though an
+	// attestation that is sent is still verified.
+	attestationExempt bool
+
+	// bootstrap signs a bootstrap certificate, as described on
+	// SignBootstrapCertificate.
+	bootstrap bool
+}
+
+// signCertificate implements SignCertificateWithContext and the other ways
+// of signing leaf certificates, as chosen by opts.
+func (c *CAManager) signCertificate(ctx context.Context, csr *x509.CertificateRequest, spiffeID connect.CertURI, order structs.CAChainOrder, attestation []byte, opts leafSignOptions) (*structs.IssuedCert, error) {
+	provider, caRoot, config, err := c.checkCSR(csr, spiffeID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := provider.(ca.ParamsSigner); opts.bootstrap && !ok {
+		return nil, ErrBootstrapSigningNotSupported
+	}
+
+	commonCfg, err := config.GetCommonConfig()
+	if err != nil {
+		return nil, err
+	}
+	if !opts.attestationExempt || len(attestation) > 0 {
+		if err := checkAttestation(provider, commonCfg, csr, attestation); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkProviderSignOptions(provider, providerSignOptions(ctx)); err != nil {
+		return nil, err
+	}
+	// Each identity is limited before the shared limits, so that a
+	// misbehaving client can't use them up.
+	identity := spiffeID.URI().String()
+	if commonCfg.CSRMaxPerSecondPerIdentity > 0 &&
+		!c.identityLimiter.allow(identity, rate.Limit(commonCfg.CSRMaxPerSecondPerIdentity), commonCfg.CSRBurstPerIdentity, c.timeNow()) {
+		return nil, identityRateLimitedError{identity: identity}
+	}
+	if opts.bootstrap {
+		if commonCfg.BootstrapCSRMaxPerSecond > 0 {
+			lim := c.caBootstrapLimiter.getCSRRateLimiterWithLimit(rate.Limit(commonCfg.BootstrapCSRMaxPerSecond))
+			// Wait up to the small threshold we allow for a token.
+			ctx, cancel := context.WithTimeout(context.Background(), csrLimitWait)
+			defer cancel()
+			if lim.Wait(ctx) != nil {
+				return nil, ErrRateLimited
+			}
+		}
+	} else if commonCfg.CSRMaxPerSecond > 0 {
+		lim := c.caLeafLimiter.getCSRRateLimiterWithLimit(rate.Limit(commonCfg.CSRMaxPerSecond))
+		// Wait up to the small threshold we allow for a token.
+		ctx, cancel := context.WithTimeout(context.Background(), csrLimitWait)
+		defer cancel()
+		if lim.Wait(ctx) != nil {
+			return nil, ErrRateLimited
+		}
+	} else if commonCfg.CSRMaxConcurrent > 0 {
+		c.caLeafLimiter.csrConcurrencyLimiter.SetSize(int64(commonCfg.CSRMaxConcurrent))
+		ctx, cancel := context.WithTimeout(context.Background(), csrLimitWait)
+		defer cancel()
+		if err := c.caLeafLimiter.csrConcurrencyLimiter.Acquire(ctx); err != nil {
+			return nil, ErrRateLimited
+		}
+		defer c.caLeafLimiter.csrConcurrencyLimiter.Release()
+	}
+
+	connect.HackSANExtensionForCSR(csr)
+
+	var entMeta structs.EnterpriseMeta
+	serviceID, isService := spiffeID.(*connect.SpiffeIDService)
+	agentID, isAgent := spiffeID.(*connect.SpiffeIDAgent)
+	if isService {
+		entMeta.Merge(serviceID.GetEnterpriseMeta())
+	} else {
+		entMeta.Merge(agentID.GetEnterpriseMeta())
+	}
+
+	// Record where the certificate was issued, for providers able to add it.
+	location := connect.IssuerLocation{
+		Datacenter: c.serverConf.Datacenter,
+		Partition:  entMeta.PartitionOrDefault(),
+	}
+	locationExt, err := location.Extension()
+	if err != nil {
+		return nil, err
+	}
+	params := ca.LeafSignParams{Extensions: []pkix.Extension{locationExt}}
+	if opts.bootstrap {
+		// Bootstrap certificates are only for client authentication, for
+		// the short BootstrapCertTTL.
+		params.MaxTTL = commonCfg.BootstrapTTL()
+		params.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	} else if isService {
+		err = applyCertTemplate(&params, commonCfg, "service", serviceID.Service)
+		if err == nil {
+			err = c.applyServiceLeafTTL(&params, commonCfg, structs.NewServiceName(serviceID.Service, &entMeta))
+		}
+	} else {
+		err = applyCertTemplate(&params, commonCfg, "agent", agentID.Agent)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Have renewals overlap with the previous leaf of the identity, for
+	// providers able to backdate them, so that clients with a clock behind
+	// the one of the provider don't get a leaf they can't use yet.
+	var prevNotAfter time.Time
+	if overlap := commonCfg.LeafRenewalOverlap; overlap > 0 && !opts.bootstrap {
+		if notAfter, ok := c.leaves.identityNotAfter(identity); ok && notAfter.After(c.timeNow()) {
+			prevNotAfter = notAfter
+			params.LatestNotBefore = notAfter.Add(-overlap)
+		}
+	}
+
+	// All seems to be in order, actually sign it. As a last resort the root
+	// signs it when the intermediate expired, which is then left out of the
+	// chain. The root can't restrict bootstrap certificates, so they never
+	// fall back to it.
+	var rootSigner ca.RootLeafSigner
+	if !opts.bootstrap {
+		rootSigner = c.rootSigningFallback(provider, caRoot, commonCfg)
+	}
+	var signerKeyID []byte
+	if rootSigner == nil {
+		if err := c.checkIntermediateRemaining(caRoot, commonCfg); err != nil {
+			return nil, err
+		}
+		// Have the leaf point at the selected intermediate, so that verifiers
+		// don't build the path through another one with the same key.
+		signerKeyID = leafSignerKeyID(caRoot)
+	} else {
+		signerKeyID = rootSignerKeyID(caRoot)
+	}
+	params.AuthorityKeyID = signerKeyID
+	var pem, providerPEM string
+	var issuingChain []string
+	if rootSigner != nil {
+		c.logger.Error("the intermediate expired, signing the leaf certificate with the root",
+			"spiffe_id", spiffeID.URI().String(),
+		)
+		pem, err = rootSigner.SignLeafWithRoot(ctx, csr, params)
+		providerPEM = pem
+	} else {
+		pem, err = c.signWithContext(ctx, provider, csr, params)
+		providerPEM = pem
+		if err == nil {
+			// Append any intermediates needed by this root.
+			for _, p := range caRoot.IntermediateCerts {
+				pem = pem + ca.EnsureTrailingNewline(p)
 			}
-
-			// Add the cross signed cert to the new CA's intermediates (to be attached
-			// to leaf certs).
-			newActiveRoot.IntermediateCerts = []string{xcCert}
+		}
+		if err == nil && commonCfg.IncludeIssuingChain && c.serverConf.PrimaryDatacenter != c.serverConf.Datacenter {
+			issuingChain, err = c.secondaryIssuingChain(caRoot)
 		}
 	}
-
-	// TODO: https://github.com/hashicorp/consul/issues/12386
-	intermediate, err := newProvider.GenerateIntermediate()
+	if errors.Is(err, ca.ErrRateLimited) {
+		return nil, ErrRateLimited
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if intermediate != newRootPEM {
-		if err := setLeafSigningCert(newActiveRoot, intermediate); err != nil {
-			return err
-		}
+	if err := checkInputSize("certificate chain from the CA provider", len(pem), c.serverConf.ConnectCAMaxChainSize); err != nil {
+		return nil, err
 	}
 
-	// Update the roots and CA config in the state store at the same time
-	idx, roots, err := state.CARoots(nil)
+	cert, err := connect.ParseCert(pem)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	var newRoots structs.CARoots
-	for _, r := range roots {
-		newRoot := *r
-		if newRoot.Active {
-			newRoot.Active = false
-			newRoot.RotatedOutAt = c.timeNow()
-		}
-		newRoots = append(newRoots, &newRoot)
+	if err := c.checkLeafNotCA(cert, identity); err != nil {
+		return nil, err
+	}
+	if err := c.checkLeafSigner(cert, providerPEM, signerKeyID, identity); err != nil {
+		return nil, err
 	}
-	newRoots = append(newRoots, newActiveRoot)
 
-	args.Op = structs.CAOpSetRootsAndConfig
-	args.Index = idx
-	args.Config.ModifyIndex = config.ModifyIndex
-	args.Roots = newRoots
-	resp, err := c.delegate.ApplyCARequest(args)
-	if err != nil {
-		return err
+	// Providers that have the CSR signed as is by an external CA can't add
+	// identities to it, so make sure none of the additional ones were dropped.
+	for _, uri := range csr.URIs {
+		if uri.String() != spiffeID.URI().String() && !containsURI(cert.URIs, uri) {
+			return nil, fmt.Errorf("CA provider did not include SPIFFE ID %s in the certificate", uri)
+		}
 	}
-	if respOk, ok := resp.(bool); ok && !respOk {
-		return fmt.Errorf("could not atomically update roots and config")
+	if opts.bootstrap {
+		// Never hand out a bootstrap certificate that grants more than asked for.
+		if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+			return nil, fmt.Errorf("CA provider did not restrict the bootstrap certificate to client authentication")
+		}
+		if ttl := params.MaxTTL; cert.NotAfter.Sub(cert.NotBefore) > ttl {
+			return nil, fmt.Errorf("CA provider did not cap the TTL of the bootstrap certificate to %s", ttl)
+		}
 	}
 
-	// If the config has been committed, update the local provider instance
-	// and call teardown on the old provider
-	c.setCAProvider(newProvider, newActiveRoot)
-
-	if err := oldProvider.Cleanup(args.Config.Provider != config.Provider, args.Config.Config); err != nil {
-		c.logger.Warn("failed to clean up old provider", "provider", config.Provider, "error", err)
+	serial := connect.EncodeSerialNumber(cert.SerialNumber)
+	if c.serverConf.ConnectCARejectReusedSerialNumbers {
+		if prevRootID, ok := c.leaves.claim(serial, caRoot.ID, cert.NotAfter); !ok {
+			c.logger.Error("CA provider reused the serial number of a valid leaf certificate",
+				"serial_number", serial,
+				"root_id", caRoot.ID,
+				"previous_root_id", prevRootID,
+			)
+			return nil, fmt.Errorf("%w: serial number %s was already issued under root %s",
+				ErrSerialNumberReused, serial, prevRootID)
+		}
 	}
 
-	c.logger.Info("CA rotated to new root under provider", "provider", args.Config.Provider)
-
-	return nil
-}
-
-// primaryRenewIntermediate regenerates the intermediate cert in the primary datacenter.
-// This is only run for CAs that require an intermediary in the primary DC, such as Vault.
-// It should only be called while the state lock is held by setting the state to non-ready.
-func (c *CAManager) primaryRenewIntermediate(provider ca.Provider, newActiveRoot *structs.CARoot) error {
-	// Generate and sign an intermediate cert using the root CA.
-	intermediatePEM, err := provider.GenerateIntermediate()
-	if err != nil {
-		return fmt.Errorf("error generating new intermediate cert: %v", err)
+	if !params.LatestNotBefore.IsZero() && cert.NotBefore.After(params.LatestNotBefore) {
+		c.logger.Warn("leaf certificate doesn't overlap with the previous one of the identity by LeafRenewalOverlap",
+			"spiffe_id", identity,
+			"not_before", cert.NotBefore,
+			"previous_not_after", prevNotAfter,
+		)
 	}
 
-	if err := setLeafSigningCert(newActiveRoot, intermediatePEM); err != nil {
-		return err
+	if order == structs.CAChainOrderRootFirst {
+		if pem, err = reverseCertChain(pem); err != nil {
+			return nil, err
+		}
 	}
 
-	c.logger.Info("generated new intermediate certificate for primary datacenter")
-	return nil
-}
-
-// secondaryRequestNewSigningCert creates a Certificate Signing Request, sends
-// the request to the primary, and stores the received certificate in the
-// provider.
-// Should only be called while the state lock is held by setting the state to non-ready.
-func (c *CAManager) secondaryRequestNewSigningCert(provider ca.Provider, newActiveRoot *structs.CARoot) error {
-	csr, err := provider.GenerateIntermediateCSR()
+	// Only bump the leaf index once the certificate passed every check, so
+	// that rejected ones don't go through raft.
+	modIdx, err := c.delegate.ApplyCALeafRequest()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var intermediatePEM string
-	if err := c.delegate.forwardDC("ConnectCA.SignIntermediate", c.serverConf.PrimaryDatacenter, c.delegate.generateCASignRequest(csr), &intermediatePEM); err != nil {
-		// this is a failure in the primary and shouldn't be capable of erroring out our establishing leadership
-		c.logger.Warn("Primary datacenter refused to sign our intermediate CA certificate", "error", err)
-		return nil
+	// Set the response
+	reply := structs.IssuedCert{
+		SerialNumber:     serial,
+		Fingerprint:      connect.CalculateCertFingerprintSHA256(cert.Raw),
+		CertPEM:          pem,
+		ValidAfter:       cert.NotBefore,
+		ValidBefore:      cert.NotAfter,
+		IssuerDatacenter: location.Datacenter,
+		IssuerPartition:  location.Partition,
+		EnterpriseMeta:   entMeta,
+		RaftIndex: structs.RaftIndex{
+			ModifyIndex: modIdx,
+			CreateIndex: modIdx,
+		},
+	}
+	reply.IntermediateCerts = issuingChain
+	reply.URIs, reply.DNSNames, reply.IPAddresses = certSANs(cert)
+	if isService {
+		reply.Service = serviceID.Service
+		reply.ServiceURI = cert.URIs[0].String()
+	} else if isAgent {
+		reply.Agent = agentID.Agent
+		reply.AgentURI = cert.URIs[0].String()
 	}
 
-	if err := provider.SetIntermediate(intermediatePEM, newActiveRoot.RootCert); err != nil {
-		return fmt.Errorf("Failed to set the intermediate certificate with the CA provider: %v", err)
+	if c.postSignHook != nil {
+		if err := c.postSignHook.PostSign(&reply, spiffeID); err != nil {
+			return nil, fmt.Errorf("post-sign hook failed: %w", err)
+		}
 	}
 
-	if err := setLeafSigningCert(newActiveRoot, intermediatePEM); err != nil {
-		return err
+	c.leaves.add(reply.SerialNumber, caRoot.ID, cert.NotAfter)
+	c.leaves.signed(identity, c.timeNow())
+	c.audit.record(c.logger, commonCfg.AuditSink, newCAAuditRecord(&reply, identity, caRoot.ID, c.timeNow()))
+	c.recordSeenIdentity(identity, caRoot.ID, commonCfg.AuditSink != nil)
+	if commonCfg.LeafRenewalOverlap > 0 && !opts.bootstrap {
+		c.leaves.addIdentity(identity, cert.NotAfter)
 	}
 
-	c.logger.Info("received new intermediate certificate from primary datacenter")
-	return nil
+	return &reply, nil
 }
 
-// setLeafSigningCert updates the CARoot by appending the pem to the list of
-// intermediate certificates, and setting the SigningKeyID to the encoded
-// SubjectKeyId of the certificate.
-func setLeafSigningCert(caRoot *structs.CARoot, pem string) error {
-	cert, err := connect.ParseCert(pem)
-	if err != nil {
-		return fmt.Errorf("error parsing leaf signing cert: %w", err)
-	}
-
-	caRoot.IntermediateCerts = append(caRoot.IntermediateCerts, pem)
-	caRoot.SigningKeyID = connect.EncodeSigningKeyID(cert.SubjectKeyId)
-	return nil
+// SignBootstrapCertificate signs a short-lived certificate for an agent joining
+// the cluster. It is valid for the BootstrapCertTTL of the CA configuration
+// and only for client authentication, and is rate limited by
+// BootstrapCSRMaxPerSecond rather than the limits shared by the other leaf
+// certificates, though the limit of the agent identity still applies. Only
+// providers implementing ca.ParamsSigner can restrict the certificate so,
+// others return ErrBootstrapSigningNotSupported. Otherwise it is signed like
+// with SignCertificateWithContext: the CSR is only signed when the provider
+// accepts the attestation of its key, and the certificate is only handed out
+// when signed by the one selected to sign leaves.
+func (c *CAManager) SignBootstrapCertificate(ctx context.Context, csr *x509.CertificateRequest, agentID *connect.SpiffeIDAgent, attestation []byte) (*structs.IssuedCert, error) {
+	return c.signCertificate(ctx, csr, agentID, structs.CAChainOrderLeafFirst, attestation, leafSignOptions{bootstrap: true})
 }
 
-// runRenewIntermediate periodically attempts to renew the intermediate cert.
-func (c *CAManager) runRenewIntermediate(ctx context.Context) error {
-	isPrimary := c.serverConf.Datacenter == c.serverConf.PrimaryDatacenter
+// checkLeafNotCA returns an error wrapping ErrLeafIsCA if the leaf
+// certificate the provider signed for identity could be used to sign other
+// certificates, unless ConnectCARejectCALeaves is disabled. Providers are
+// expected to ignore what a CSR asks for, so this only catches provider bugs.
+func (c *CAManager) checkLeafNotCA(cert *x509.Certificate, identity string) error {
+	if !c.serverConf.ConnectCARejectCALeaves {
+		return nil
+	}
+	var reason string
+	switch {
+	case cert.IsCA:
+		reason = "it is a CA certificate"
+	case cert.KeyUsage&x509.KeyUsageCertSign != 0:
+		reason = "its key usage includes certificate signing"
+	default:
+		return nil
+	}
+	c.logger.Error("CA provider signed a leaf certificate that can sign certificates",
+		"spiffe_id", identity,
+		"serial_number", connect.EncodeSerialNumber(cert.SerialNumber),
+		"reason", reason,
+	)
+	return fmt.Errorf("%w: %s", ErrLeafIsCA, reason)
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case <-time.After(structs.IntermediateCertRenewInterval):
-			retryLoopBackoffAbortOnSuccess(ctx, func() error {
-				return c.RenewIntermediate(ctx, isPrimary)
-			}, func(err error) {
-				c.logger.Error("error renewing intermediate certs",
-					"routine", intermediateCertRenewWatchRoutineName,
-					"error", err,
-				)
-			})
+// leafSignerKeyID returns the subject key ID of the certificate selected to
+// sign the leaf certificates of caRoot: the intermediate, or the root, with
+// its SigningKeyID, the most recent one when several are. It returns nil when
+// none of them has it.
+func leafSignerKeyID(caRoot *structs.CARoot) []byte {
+	if caRoot.SigningKeyID == "" {
+		return nil
+	}
+	pems := append([]string{caRoot.RootCert}, caRoot.IntermediateCerts...)
+	for i := len(pems) - 1; i >= 0; i-- {
+		cert, err := connect.ParseCert(pems[i])
+		if err != nil || len(cert.SubjectKeyId) == 0 {
+			continue
+		}
+		if connect.EncodeSigningKeyID(cert.SubjectKeyId) == caRoot.SigningKeyID {
+			return cert.SubjectKeyId
 		}
 	}
+	return nil
 }
 
-// RenewIntermediate checks the intermediate cert for
-// expiration. If more than half the time a cert is valid has passed,
-// it will try to renew it.
-func (c *CAManager) RenewIntermediate(ctx context.Context, isPrimary bool) error {
-	// Grab the 'lock' right away so the provider/config can't be changed out while we check
-	// the intermediate.
-	if _, err := c.setState(caStateRenewIntermediate, true); err != nil {
-		return err
+// rootSignerKeyID returns the subject key ID of the root of caRoot, which
+// signs leaf certificates when the intermediate expired, or nil if it can't
+// be told.
+func rootSignerKeyID(caRoot *structs.CARoot) []byte {
+	cert, err := connect.ParseCert(caRoot.RootCert)
+	if err != nil || len(cert.SubjectKeyId) == 0 {
+		return nil
 	}
-	defer c.setState(caStateInitialized, false)
+	return cert.SubjectKeyId
+}
 
-	provider, _ := c.getCAProvider()
-	if provider == nil {
-		// this happens when leadership is being revoked and this go routine will be stopped
+// checkLeafSigner returns an error wrapping ErrLeafSignerMismatch if the
+// leaf certificate the provider signed for identity wasn't signed by
+// signerKeyID, the subject key ID of the certificate selected to sign it.
+// providerPEM is the chain the provider returned: when it also contains the
+// certificate that signed the leaf, such as the sub-intermediate of Vault's
+// DelegatedLeafSigning, that certificate must be the one signed by
+// signerKeyID instead. A nil signerKeyID skips the check.
+func (c *CAManager) checkLeafSigner(cert *x509.Certificate, providerPEM string, signerKeyID []byte, identity string) error {
+	if signerKeyID == nil {
 		return nil
 	}
-	// If this isn't the primary, make sure the CA has been initialized.
-	if !isPrimary && !c.secondaryHasProviderRoots() {
-		return fmt.Errorf("secondary CA is not yet configured.")
-	}
-
-	state := c.delegate.State()
-	_, root, err := state.CARootActive(nil)
+	authorityKeyID, issuerKeyID, err := connect.LeafAuthorityKeyIDs(providerPEM)
 	if err != nil {
 		return err
 	}
-	activeRoot := root.Clone()
-
-	// If this is the primary, check if this is a provider that uses an intermediate cert. If
-	// it isn't, we don't need to check for a renewal.
-	if isPrimary && !primaryUsesIntermediate(provider) {
+	actual := authorityKeyID
+	if issuerKeyID != "" {
+		actual = issuerKeyID
+	}
+	expected := connect.EncodeSigningKeyID(signerKeyID)
+	if actual == expected {
 		return nil
 	}
+	c.logger.Error("CA provider signed a leaf certificate with an unexpected certificate",
+		"spiffe_id", identity,
+		"serial_number", connect.EncodeSerialNumber(cert.SerialNumber),
+		"signing_key_id", expected,
+		"authority_key_id", actual,
+	)
+	return fmt.Errorf("%w: its authority key ID is %q, expected %q", ErrLeafSignerMismatch, actual, expected)
+}
 
-	activeIntermediate, err := provider.ActiveIntermediate()
-	if err != nil {
-		return err
+// applyCertTemplate sets the fields of params from the template conf selects
+// for the identity of the given type and name, if any.
+func applyCertTemplate(params *ca.LeafSignParams, conf *structs.CommonCAProviderConfig, identityType, name string) error {
+	templateName := conf.CertTemplateFor(identityType, name)
+	if templateName == "" {
+		return nil
 	}
-
-	if activeIntermediate == "" {
-		return fmt.Errorf("datacenter doesn't have an active intermediate.")
+	tmpl, ok := conf.CertTemplates[templateName]
+	if !ok {
+		return fmt.Errorf("unknown certificate template %q", templateName)
 	}
 
-	intermediateCert, err := connect.ParseCert(activeIntermediate)
-	if err != nil {
-		return fmt.Errorf("error parsing active intermediate cert: %v", err)
+	params.TTL = tmpl.LeafCertTTL
+	params.KeyUsage = tmpl.KeyUsageBits()
+	for _, usage := range tmpl.ExtKeyUsage {
+		params.ExtKeyUsage = append(params.ExtKeyUsage, structs.CertTemplateExtKeyUsages[usage])
 	}
-
-	if lessThanHalfTimePassed(c.timeNow(), intermediateCert.NotBefore, intermediateCert.NotAfter) {
-		return nil
+	for _, raw := range tmpl.PolicyOIDs {
+		oid, err := structs.ParseOID(raw)
+		if err != nil {
+			return fmt.Errorf("certificate template %q: %v", templateName, err)
+		}
+		params.PolicyIdentifiers = append(params.PolicyIdentifiers, oid)
 	}
+	return nil
+}
 
-	// Enough time has passed, go ahead with getting a new intermediate.
-	renewalFunc := c.primaryRenewIntermediate
-	if !isPrimary {
-		renewalFunc = c.secondaryRequestNewSigningCert
+// signWithContext has the provider sign the CSR, giving up once ctx is done.
+// The params are applied by providers implementing ca.ParamsSigner, and by
+// ca.TemplateSigner for templates, which only providers implementing it can
+// sign. They are ignored by the others and when the CSR has provider sign
+// options.
+// Sign and SignWithOptions are given ctx, but the other ways of signing
+// aren't and a provider may not return as soon as ctx is done, so the call
+// keeps running in the background when ctx is done first. It only ever writes
+// to its own buffered channel and everything that records the certificate
+// happens after signWithContext returns, so an abandoned call can't change
+// any state.
+func (c *CAManager) signWithContext(ctx context.Context, provider ca.Provider, csr *x509.CertificateRequest, params ca.LeafSignParams) (string, error) {
+	type signResult struct {
+		pem string
+		err error
+	}
+	// Templates built by SignPublicKeyWithContext have no raw CSR, which only
+	// providers that build the certificate themselves can sign.
+	sign := func(csr *x509.CertificateRequest) (string, error) {
+		return provider.Sign(ctx, csr)
+	}
+	if csr.Raw == nil {
+		signer, ok := provider.(ca.TemplateSigner)
+		if !ok {
+			return "", ErrPublicKeySigningNotSupported
+		}
+		sign = func(csr *x509.CertificateRequest) (string, error) {
+			return signer.SignTemplate(csr, params)
+		}
+	} else if options := providerSignOptions(ctx); len(options) > 0 {
+		// checkProviderSignOptions made sure the provider takes them.
+		signer := provider.(ca.OptionsSigner)
+		sign = func(csr *x509.CertificateRequest) (string, error) {
+			return signer.SignWithOptions(ctx, csr, options)
+		}
+	} else if signer, ok := provider.(ca.ParamsSigner); ok {
+		sign = func(csr *x509.CertificateRequest) (string, error) {
+			return signer.SignWithParams(csr, params)
+		}
 	}
-	errCh := make(chan error, 1)
+
+	resultCh := make(chan signResult, 1)
 	go func() {
-		errCh <- renewalFunc(provider, activeRoot)
+		pem, err := sign(csr)
+		resultCh <- signResult{pem: pem, err: err}
 	}()
 
-	// Wait for the renewal func to return or for the context to be canceled.
 	select {
+	case res := <-resultCh:
+		return res.pem, res.err
 	case <-ctx.Done():
-		return ctx.Err()
-	case err := <-errCh:
-		if err != nil {
-			return err
-		}
+		c.logger.Warn("CA provider did not sign the certificate in time", "error", ctx.Err())
+		return "", signTimeoutError{err: ctx.Err()}
 	}
+}
 
-	if err := c.persistNewRootAndConfig(provider, activeRoot, nil); err != nil {
-		return err
+type providerSignOptionsKey struct{}
+
+// WithProviderSignOptions returns a copy of ctx carrying options specific to
+// the CA provider, which SignCertificateWithContext passes through to it. The
+// provider must implement ca.OptionsSigner and accept every option.
+func WithProviderSignOptions(ctx context.Context, options map[string]string) context.Context {
+	if len(options) == 0 {
+		return ctx
 	}
+	return context.WithValue(ctx, providerSignOptionsKey{}, options)
+}
 
-	c.setCAProvider(provider, activeRoot)
-	return nil
+// providerSignOptions returns the options set by WithProviderSignOptions.
+func providerSignOptions(ctx context.Context) map[string]string {
+	options, _ := ctx.Value(providerSignOptionsKey{}).(map[string]string)
+	return options
 }
 
-// secondaryCARootWatch maintains a blocking query to the primary datacenter's
-// ConnectCA.Roots endpoint to monitor when it needs to request a new signed
-// intermediate certificate.
-func (c *CAManager) secondaryCARootWatch(ctx context.Context) error {
-	args := structs.DCSpecificRequest{
-		Datacenter: c.serverConf.PrimaryDatacenter,
-		QueryOptions: structs.QueryOptions{
-			// the maximum time the primary roots watch query can block before returning
-			MaxQueryTime: c.serverConf.MaxQueryTime,
-		},
+// checkProviderSignOptions returns an error wrapping ErrUnknownSignOption if
+// the provider doesn't accept every one of options.
+func checkProviderSignOptions(provider ca.Provider, options map[string]string) error {
+	if len(options) == 0 {
+		return nil
 	}
-
-	c.logger.Debug("starting Connect CA root replication from primary datacenter", "primary", c.serverConf.PrimaryDatacenter)
-
-	retryLoopBackoff(ctx, func() error {
-		var roots structs.IndexedCARoots
-		if err := c.delegate.forwardDC("ConnectCA.Roots", c.serverConf.PrimaryDatacenter, &args, &roots); err != nil {
-			return fmt.Errorf("Error retrieving the primary datacenter's roots: %v", err)
-		}
-
-		// Return if the context has been canceled while waiting on the RPC.
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+	allowed := make(map[string]struct{})
+	if signer, ok := provider.(ca.OptionsSigner); ok {
+		for _, key := range signer.SignOptions() {
+			allowed[key] = struct{}{}
 		}
-
-		// Attempt to update the roots using the returned data.
-		if err := c.secondaryUpdateRoots(roots); err != nil {
-			return err
+	}
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := allowed[key]; !ok {
+			return fmt.Errorf("%w %q", ErrUnknownSignOption, key)
 		}
-		args.QueryOptions.MinQueryIndex = nextIndexVal(args.QueryOptions.MinQueryIndex, roots.QueryMeta.Index)
-		return nil
-	}, func(err error) {
-		c.logger.Error("CA root replication failed, will retry",
-			"routine", secondaryCARootWatchRoutineName,
-			"error", err,
-		)
-	})
-
+	}
 	return nil
 }
 
-// secondaryUpdateRoots updates the cached roots from the primary and regenerates the intermediate
-// certificate if necessary.
-func (c *CAManager) secondaryUpdateRoots(roots structs.IndexedCARoots) error {
-	// Update the state first to claim the 'lock'.
-	if _, err := c.setState(caStateReconfig, true); err != nil {
-		return err
+// SignPublicKeyWithContext is like SignCertificateWithContext but signs a leaf
+// certificate for a public key instead of a CSR, for clients that can't build
+// one. The certificate is synthesized from the key and spiffeID, so the
+// provider must implement ca.TemplateSigner. Attestations are bound to a CSR,
+// so public keys are refused when the CA configuration sets
+// RequireAttestation.
+func (c *CAManager) SignPublicKeyWithContext(ctx context.Context, pub crypto.PublicKey, spiffeID connect.CertURI, order structs.CAChainOrder) (*structs.IssuedCert, error) {
+	algo, err := checkLeafPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	if provider, _ := c.getCAProvider(); provider != nil {
+		if _, ok := provider.(ca.TemplateSigner); !ok {
+			return nil, ErrPublicKeySigningNotSupported
+		}
+	}
+	_, config, err := c.delegate.State().CAConfig(nil)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		commonCfg, err := config.GetCommonConfig()
+		if err != nil {
+			return nil, err
+		}
+		if commonCfg.RequireAttestation {
+			return nil, ErrPublicKeyAttestationRequired
+		}
 	}
-	defer c.setState(caStateInitialized, false)
-
-	// Update the cached primary roots now that the lock is held.
-	c.secondarySetPrimaryRoots(roots)
 
-	provider, _ := c.getCAProvider()
-	if provider == nil {
-		// this happens when leadership is being revoked and this go routine will be stopped
-		return nil
+	template := &x509.CertificateRequest{
+		PublicKey:          pub,
+		PublicKeyAlgorithm: algo,
+		URIs:               []*url.URL{spiffeID.URI()},
 	}
+	return c.SignCertificateWithContext(ctx, template, spiffeID, order, nil)
+}
 
-	// Run the secondary CA init routine to see if we need to request a new
-	// intermediate.
-	if c.secondaryHasProviderRoots() {
-		if err := c.secondaryInitializeIntermediateCA(provider, nil); err != nil {
-			return fmt.Errorf("Failed to initialize the secondary CA: %v", err)
+// checkLeafPublicKey returns the algorithm of a public key sent to be signed
+// without a CSR, or an error if it doesn't meet the same policy as the keys
+// of the CA: an EC key on a NIST curve, an RSA key of 2048 or 4096 bits or an
+// Ed25519 key.
+func checkLeafPublicKey(pub crypto.PublicKey) (x509.PublicKeyAlgorithm, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P224(), elliptic.P256(), elliptic.P384(), elliptic.P521():
+			return x509.ECDSA, nil
 		}
-		return nil
+		return 0, fmt.Errorf("unsupported EC curve %s, must be P-224, P-256, P-384 or P-521", k.Curve.Params().Name)
+	case *rsa.PublicKey:
+		if bits := k.N.BitLen(); bits != 2048 && bits != 4096 {
+			return 0, fmt.Errorf("unsupported RSA key length %d, must be 2048 or 4096 bits", bits)
+		}
+		return x509.RSA, nil
+	case ed25519.PublicKey:
+		return x509.Ed25519, nil
+	default:
+		return 0, fmt.Errorf("unsupported public key type %T, must be an EC, RSA or Ed25519 key", pub)
 	}
+}
 
-	// Attempt to initialize now that we have updated roots. This is an optimization
-	// so that we don't have to wait for the Initialize retry backoff if we were
-	// waiting on roots from the primary to be able to complete initialization.
-	if err := c.delegate.ServersSupportMultiDCConnectCA(); err != nil {
-		return fmt.Errorf("failed to initialize while updating primary roots: %w", err)
-	}
-	if err := c.secondaryInitializeProvider(provider, roots); err != nil {
-		return fmt.Errorf("Failed to initialize secondary CA provider: %v", err)
+// SignSSH signs an SSH certificate with the CA provider, when it also acts as
+// an SSH certificate authority. See ca.SSHSigner.
+func (c *CAManager) SignSSH(certType, publicKey string, principals []string, ttl time.Duration) (string, error) {
+	provider, _ := c.getCAProvider()
+	if provider == nil {
+		return "", fmt.Errorf("internal error: CA provider is nil")
 	}
-	if err := c.secondaryInitializeIntermediateCA(provider, nil); err != nil {
-		return fmt.Errorf("Failed to initialize the secondary CA: %v", err)
+	signer, ok := provider.(ca.SSHSigner)
+	if !ok {
+		return "", ca.ErrSSHNotEnabled
 	}
-	return nil
+	return signer.SignSSH(certType, publicKey, principals, ttl)
 }
 
-// secondaryInitializeProvider configures the given provider for a secondary, non-root datacenter.
-func (c *CAManager) secondaryInitializeProvider(provider ca.Provider, roots structs.IndexedCARoots) error {
-	if roots.TrustDomain == "" {
-		return fmt.Errorf("trust domain from primary datacenter is not initialized")
+// DryRunSign runs the checks SignCertificate makes on the CSR, including the
+// ones made by the provider, without signing it or counting it against the
+// signing rate limits. It returns the error signing the CSR would fail with.
+func (c *CAManager) DryRunSign(csr *x509.CertificateRequest, spiffeID connect.CertURI, attestation []byte, options map[string]string) error {
+	provider, _, config, err := c.checkCSR(csr, spiffeID)
+	if err != nil {
+		return err
 	}
-
-	clusterID := strings.Split(roots.TrustDomain, ".")[0]
-	_, conf, err := c.delegate.State().CAConfig(nil)
+	commonCfg, err := config.GetCommonConfig()
 	if err != nil {
 		return err
 	}
-
-	pCfg := ca.ProviderConfig{
-		ClusterID:  clusterID,
-		Datacenter: c.serverConf.Datacenter,
-		IsPrimary:  false,
-		RawConfig:  conf.Config,
-		State:      conf.State,
+	if err := checkAttestation(provider, commonCfg, csr, attestation); err != nil {
+		return err
 	}
-	if err := provider.Configure(pCfg); err != nil {
-		return fmt.Errorf("error configuring provider: %v", err)
+	if err := checkProviderSignOptions(provider, options); err != nil {
+		return err
+	}
+	if validator, ok := provider.(ca.CSRValidator); ok {
+		return validator.ValidateCSR(csr)
 	}
 	return nil
 }
 
-// secondaryHasProviderRoots returns true after providerRoot has been set. This
-// method is used to detect when the secondary has received the roots from the
-// primary DC.
-func (c *CAManager) secondaryHasProviderRoots() bool {
-	// TODO: this could potentially also use primaryRoots instead of providerRoot
-	c.providerLock.Lock()
-	defer c.providerLock.Unlock()
-	return c.providerRoot != nil
+// replaceCSRURI replaces the original URI SAN of the CSR with updated. The
+// URIs list is recreated rather than modified in place.
+func replaceCSRURI(csr *x509.CertificateRequest, original, updated *url.URL) {
+	uris := make([]*url.URL, len(csr.URIs))
+	for i, uri := range csr.URIs {
+		if original.String() == uri.String() {
+			uris[i] = updated
+		} else {
+			uris[i] = uri
+		}
+	}
+	csr.URIs = uris
 }
 
-type connectSignRateLimiter struct {
-	// csrRateLimiter limits the rate of signing new certs if configured. Lazily
-	// initialized from current config to support dynamic changes.
-	// csrRateLimiterMu must be held while dereferencing the pointer or storing a
-	// new one, but methods can be called on the limiter object outside of the
-	// locked section. This is done only in the getCSRRateLimiterWithLimit method.
-	csrRateLimiter   *rate.Limiter
-	csrRateLimiterMu sync.RWMutex
-
-	// csrConcurrencyLimiter is a dynamically resizable semaphore used to limit
-	// Sign RPC concurrency if configured. The zero value is usable as soon as
-	// SetSize is called which we do dynamically in the RPC handler to avoid
-	// having to hook elaborate synchronization mechanisms through the CA config
-	// endpoint and config reload etc.
-	csrConcurrencyLimiter semaphore.Dynamic
+// inPreviousTrustDomain returns whether host is the PreviousTrustDomain of
+// the CA configuration, which is still accepted during a trust domain
+// migration.
+func inPreviousTrustDomain(config *structs.CAConfiguration, host string) bool {
+	commonCfg, err := config.GetCommonConfig()
+	if err != nil || commonCfg.PreviousTrustDomain == "" {
+		return false
+	}
+	return strings.EqualFold(commonCfg.PreviousTrustDomain, host)
 }
 
-// getCSRRateLimiterWithLimit returns a rate.Limiter with the desired limit set.
-// It uses the shared server-wide limiter unless the limit has been changed in
-// config or the limiter has not been setup yet in which case it just-in-time
-// configures the new limiter. We assume that limit changes are relatively rare
-// and that all callers (there is currently only one) use the same config value
-// as the limit. There might be some flapping if there are multiple concurrent
-// requests in flight at the time the config changes where A sees the new value
-// and updates, B sees the old but then gets this lock second and changes back.
-// Eventually though and very soon (once all current RPCs are complete) we are
-// guaranteed to have the correct limit set by the next RPC that comes in so I
-// assume this is fine. If we observe strange behavior because of it, we could
-// add hysteresis that prevents changes too soon after a previous change but
-// that seems unnecessary for now.
-func (l *connectSignRateLimiter) getCSRRateLimiterWithLimit(limit rate.Limit) *rate.Limiter {
-	l.csrRateLimiterMu.RLock()
-	lim := l.csrRateLimiter
-	l.csrRateLimiterMu.RUnlock()
+// inFederatedTrustDomain returns whether host is one of the
+// FederatedTrustDomains of the CA configuration, whose service identities
+// leaf certificates may carry in addition to their own.
+func inFederatedTrustDomain(config *structs.CAConfiguration, host string) bool {
+	commonCfg, err := config.GetCommonConfig()
+	if err != nil {
+		return false
+	}
+	for _, td := range commonCfg.FederatedTrustDomains {
+		if strings.EqualFold(td, host) {
+			return true
+		}
+	}
+	return false
+}
 
-	// If there is a current limiter with the same limit, return it. This should
-	// be the common case.
-	if lim != nil && lim.Limit() == limit {
-		return lim
+// certSANs returns the subject alternative names of cert, as reported in
+// structs.IssuedCert.
+func certSANs(cert *x509.Certificate) (uris, dnsNames, ipAddresses []string) {
+	for _, uri := range cert.URIs {
+		uris = append(uris, uri.String())
 	}
+	for _, ip := range cert.IPAddresses {
+		ipAddresses = append(ipAddresses, ip.String())
+	}
+	return uris, cert.DNSNames, ipAddresses
+}
 
-	// Need to change limiter, get write lock
-	l.csrRateLimiterMu.Lock()
-	defer l.csrRateLimiterMu.Unlock()
-	// No limiter yet, or limit changed in CA config, reconfigure a new limiter.
-	// We use burst of 1 for a hard limit. Note that either bursting or waiting is
-	// necessary to get expected behavior in fact of random arrival times, but we
-	// don't need both and we use Wait with a small delay to smooth noise. See
-	// https://github.com/banks/sim-rate-limit-backoff/blob/master/README.md.
-	l.csrRateLimiter = rate.NewLimiter(limit, 1)
-	return l.csrRateLimiter
+// checkAttestation verifies the attestation of the key of the CSR with the
+// provider when there is one, and requires one when the CA configuration
+// sets RequireAttestation.
+func checkAttestation(provider ca.Provider, commonCfg *structs.CommonCAProviderConfig, csr *x509.CertificateRequest, attestation []byte) error {
+	if len(attestation) == 0 {
+		if commonCfg.RequireAttestation {
+			return fmt.Errorf("the CA configuration requires an attestation of the CSR key")
+		}
+		return nil
+	}
+	verifier, ok := provider.(ca.AttestationVerifier)
+	if !ok {
+		return fmt.Errorf("the CA provider does not support key attestations")
+	}
+	if err := verifier.VerifyAttestation(csr, attestation); err != nil {
+		return fmt.Errorf("key attestation rejected: %w", err)
+	}
+	return nil
 }
 
-func (c *CAManager) SignCertificate(csr *x509.CertificateRequest, spiffeID connect.CertURI) (*structs.IssuedCert, error) {
-	provider, caRoot := c.getCAProvider()
-	if provider == nil {
-		return nil, fmt.Errorf("CA is uninitialized and unable to sign certificates yet: provider is nil")
-	} else if caRoot == nil {
-		return nil, fmt.Errorf("CA is uninitialized and unable to sign certificates yet: no root certificate")
+// checkCSR verifies that the CA can sign the CSR for spiffeID and returns the
+// provider, root and configuration to sign it with. Agent IDs from a
+// different trust domain are moved to ours in both spiffeID and the CSR.
+func (c *CAManager) checkCSR(csr *x509.CertificateRequest, spiffeID connect.CertURI) (ca.Provider, *structs.CARoot, *structs.CAConfiguration, error) {
+	// The provider may only be partially set up while the CA is
+	// initializing, so don't sign with it until it's done.
+	c.stateLock.Lock()
+	current := c.state
+	c.stateLock.Unlock()
+	if current == caStateInitializing {
+		return nil, nil, nil, fmt.Errorf("%w: CA state is %s", ErrCANotReady, current)
 	}
 
-	// Verify that the CSR entity is in the cluster's trust domain
 	state := c.delegate.State()
 	_, config, err := state.CAConfig(nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
-	signingID := connect.SpiffeIDSigningForCluster(config.ClusterID)
-	serviceID, isService := spiffeID.(*connect.SpiffeIDService)
-	agentID, isAgent := spiffeID.(*connect.SpiffeIDAgent)
-	if !isService && !isAgent {
-		return nil, fmt.Errorf("SPIFFE ID in CSR must be a service or agent ID")
+	if config != nil && config.MaintenanceMode {
+		return nil, nil, nil, ErrCAMaintenance
 	}
 
-	var entMeta structs.EnterpriseMeta
-	if isService {
-		if !signingID.CanSign(spiffeID) {
-			return nil, fmt.Errorf("SPIFFE ID in CSR from a different trust domain: %s, "+
-				"we are %s", serviceID.Host, signingID.Host())
-		}
-		entMeta.Merge(serviceID.GetEnterpriseMeta())
-	} else {
-		// isAgent - if we support more ID types then this would need to be an else if
-		// here we are just automatically fixing the trust domain. For auto-encrypt and
-		// auto-config they make certificate requests before learning about the roots
-		// so they will have a dummy trust domain in the CSR.
-		trustDomain := signingID.Host()
-		if agentID.Host != trustDomain {
-			originalURI := agentID.URI()
-
-			agentID.Host = trustDomain
-
-			// recreate the URIs list
-			uris := make([]*url.URL, len(csr.URIs))
-			for i, uri := range csr.URIs {
-				if originalURI.String() == uri.String() {
-					uris[i] = agentID.URI()
-				} else {
-					uris[i] = uri
-				}
-			}
+	provider, caRoot := c.getCAProvider()
+	if provider == nil {
+		return nil, nil, nil, fmt.Errorf("CA is uninitialized and unable to sign certificates yet: provider is nil")
+	} else if caRoot == nil {
+		return nil, nil, nil, fmt.Errorf("CA is uninitialized and unable to sign certificates yet: no root certificate")
+	}
 
-			csr.URIs = uris
-		}
-		entMeta.Merge(agentID.GetEnterpriseMeta())
+	// CSRs parsed by callers other than the RPC endpoints, such as auto-config,
+	// weren't checked before parsing.
+	if err := checkInputSize("CSR", len(csr.Raw), c.serverConf.ConnectCAMaxCSRSize); err != nil {
+		return nil, nil, nil, err
 	}
 
-	commonCfg, err := config.GetCommonConfig()
-	if err != nil {
-		return nil, err
+	// Parsing a CSR doesn't verify its signature, so check the requester holds
+	// the private key. Templates built by SignPublicKeyWithContext aren't
+	// signed.
+	if csr.Raw != nil {
+		if err := csr.CheckSignature(); err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: %v", ErrCSRSignatureInvalid, err)
+		}
 	}
-	if commonCfg.CSRMaxPerSecond > 0 {
-		lim := c.caLeafLimiter.getCSRRateLimiterWithLimit(rate.Limit(commonCfg.CSRMaxPerSecond))
-		// Wait up to the small threshold we allow for a token.
-		ctx, cancel := context.WithTimeout(context.Background(), csrLimitWait)
-		defer cancel()
-		if lim.Wait(ctx) != nil {
-			return nil, ErrRateLimited
+
+	// Verify that the CSR entity is in the cluster's trust domain
+	signingID := connect.SpiffeIDSigningForCluster(config.ClusterID)
+	trustDomain := signingID.Host()
+	switch id := spiffeID.(type) {
+	case *connect.SpiffeIDService:
+		if !signingID.CanSign(spiffeID) {
+			if !inPreviousTrustDomain(config, id.Host) {
+				return nil, nil, nil, fmt.Errorf("SPIFFE ID in CSR from a different trust domain: %s, "+
+					"we are %s", id.Host, trustDomain)
+			}
+			// Services still in the trust domain we are migrating away from
+			// get certificates in the new one.
+			originalURI := id.URI()
+			id.Host = trustDomain
+			replaceCSRURI(csr, originalURI, id.URI())
 		}
-	} else if commonCfg.CSRMaxConcurrent > 0 {
-		c.caLeafLimiter.csrConcurrencyLimiter.SetSize(int64(commonCfg.CSRMaxConcurrent))
-		ctx, cancel := context.WithTimeout(context.Background(), csrLimitWait)
-		defer cancel()
-		if err := c.caLeafLimiter.csrConcurrencyLimiter.Acquire(ctx); err != nil {
-			return nil, ErrRateLimited
+	case *connect.SpiffeIDAgent:
+		// Here we are just automatically fixing the trust domain. For
+		// auto-encrypt and auto-config they make certificate requests before
+		// learning about the roots so they will have a dummy trust domain in the
+		// CSR.
+		if id.Host != trustDomain {
+			originalURI := id.URI()
+			id.Host = trustDomain
+			replaceCSRURI(csr, originalURI, id.URI())
 		}
-		defer c.caLeafLimiter.csrConcurrencyLimiter.Release()
+	default:
+		return nil, nil, nil, fmt.Errorf("SPIFFE ID in CSR must be a service or agent ID")
 	}
 
-	connect.HackSANExtensionForCSR(csr)
+	// Any other identity in the CSR must be a service in our trust domain as
+	// well, or in the trust domain of a federated peer, since it ends up in
+	// the certificate too.
+	for _, uri := range csr.URIs {
+		if uri.String() == spiffeID.URI().String() {
+			continue
+		}
+		id, err := connect.ParseCertURI(uri)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		other, ok := id.(*connect.SpiffeIDService)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("additional SPIFFE ID in CSR must be a service ID: %s", uri)
+		}
+		if !signingID.CanSign(other) {
+			switch {
+			case inPreviousTrustDomain(config, other.Host):
+				other.Host = trustDomain
+				replaceCSRURI(csr, uri, other.URI())
+			case inFederatedTrustDomain(config, other.Host):
+				// Identities of federated peers are signed as they are.
+			default:
+				return nil, nil, nil, fmt.Errorf("additional SPIFFE ID in CSR from a different trust domain: %s, "+
+					"we are %s and it isn't a federated trust domain", other.Host, trustDomain)
+			}
+		}
+	}
 
 	// Check if the root expired before using it to sign.
 	// TODO: we store NotBefore and NotAfter on this struct, so we could avoid
 	// parsing the cert here.
 	err = c.checkExpired(caRoot.RootCert)
 	if err != nil {
-		return nil, fmt.Errorf("root expired: %w", err)
+		return nil, nil, nil, fmt.Errorf("root expired: %w", err)
 	}
 
 	if c.isIntermediateUsedToSignLeaf() && len(caRoot.IntermediateCerts) > 0 {
 		inter := caRoot.IntermediateCerts[len(caRoot.IntermediateCerts)-1]
-		if err := c.checkExpired(inter); err != nil {
-			return nil, fmt.Errorf("intermediate expired: %w", err)
+		if err := c.checkExpired(inter); err != nil && !c.canSignWithRoot(provider, config) {
+			return nil, nil, nil, fmt.Errorf("intermediate expired: %w", err)
 		}
 	}
 
-	// All seems to be in order, actually sign it.
-	pem, err := provider.Sign(csr)
-	if err == ca.ErrRateLimited {
-		return nil, ErrRateLimited
+	if err := c.verifyProviderMatchesRoot(provider, caRoot); errors.Is(err, ErrActiveIntermediateEmpty) {
+		c.logger.Error("CA provider has no active intermediate, refusing to sign certificates", "error", err)
+		return nil, nil, nil, err
+	} else if err != nil {
+		c.logger.Error("CA provider diverged from the active root, refusing to sign certificates", "error", err)
+		select {
+		case c.reconcileCh <- struct{}{}:
+		default:
+		}
+		return nil, nil, nil, err
 	}
-	if err != nil {
-		return nil, err
+
+	return provider, caRoot, config, nil
+}
+
+// reverseCertChain returns the certificates of a PEM bundle in reverse order.
+func reverseCertChain(bundle string) (string, error) {
+	var blocks []*pem.Block
+	rest := []byte(bundle)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 {
+		return "", fmt.Errorf("no certificates found in chain")
 	}
 
-	// Append any intermediates needed by this root.
-	for _, p := range caRoot.IntermediateCerts {
-		pem = pem + ca.EnsureTrailingNewline(p)
+	var buf strings.Builder
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if err := pem.Encode(&buf, blocks[i]); err != nil {
+			return "", err
+		}
 	}
+	return buf.String(), nil
+}
 
-	modIdx, err := c.delegate.ApplyCALeafRequest()
+// activeIntermediate returns the active intermediate of the provider, or an
+// error wrapping ErrActiveIntermediateEmpty when it has none rather than
+// leaving callers to fail parsing an empty certificate.
+func activeIntermediate(provider ca.Provider) (string, error) {
+	pem, err := provider.ActiveIntermediate()
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("error getting the provider's active intermediate: %w", err)
 	}
+	if strings.TrimSpace(pem) == "" {
+		return "", fmt.Errorf("%w: check that the provider's intermediate, such as the "+
+			"intermediate PKI mount of Vault, has been populated with a signed certificate",
+			ErrActiveIntermediateEmpty)
+	}
+	return pem, nil
+}
 
-	cert, err := connect.ParseCert(pem)
-	if err != nil {
-		return nil, err
+// providerRootCheckInterval is how long a successful verifyProviderMatchesRoot
+// is trusted for the same provider and root, so that providers backed by an
+// external CA aren't asked for their intermediate on every signing request.
+var providerRootCheckInterval = time.Minute
+
+// verifyProviderMatchesRoot checks that the provider's active intermediate is
+// the leaf signing cert of root, as found by getLeafSigningCertFromRoot, so
+// that the leaves it signs chain to the active root. It returns an error
+// wrapping ErrCAProviderDiverged if they don't match.
+func (c *CAManager) verifyProviderMatchesRoot(provider ca.Provider, root *structs.CARoot) error {
+	c.providerCheckLock.Lock()
+	defer c.providerCheckLock.Unlock()
+
+	now := c.timeNow()
+	if c.providerCheckedFor == provider && c.providerCheckedRoot == root &&
+		now.Sub(c.providerCheckedAt) < providerRootCheckInterval {
+		return nil
 	}
 
-	// Set the response
-	reply := structs.IssuedCert{
-		SerialNumber:   connect.EncodeSerialNumber(cert.SerialNumber),
-		CertPEM:        pem,
-		ValidAfter:     cert.NotBefore,
-		ValidBefore:    cert.NotAfter,
-		EnterpriseMeta: entMeta,
-		RaftIndex: structs.RaftIndex{
-			ModifyIndex: modIdx,
-			CreateIndex: modIdx,
-		},
+	activePEM, err := activeIntermediate(provider)
+	if err != nil {
+		return err
 	}
-	if isService {
-		reply.Service = serviceID.Service
-		reply.ServiceURI = cert.URIs[0].String()
-	} else if isAgent {
-		reply.Agent = agentID.Agent
-		reply.AgentURI = cert.URIs[0].String()
+	active, err := connect.ParseCert(activePEM)
+	if err != nil {
+		return fmt.Errorf("error parsing the provider's active intermediate: %w", err)
+	}
+	expected, err := connect.ParseCert(c.getLeafSigningCertFromRoot(root))
+	if err != nil {
+		return fmt.Errorf("error parsing the leaf signing cert of the active root: %w", err)
+	}
+	if !bytes.Equal(active.Raw, expected.Raw) {
+		return fmt.Errorf("%w: provider signs with %q (key %s) but active root %s signs with %q (key %s)",
+			ErrCAProviderDiverged,
+			active.Subject.CommonName, connect.EncodeSigningKeyID(active.SubjectKeyId),
+			root.ID, expected.Subject.CommonName, connect.EncodeSigningKeyID(expected.SubjectKeyId))
 	}
 
-	return &reply, nil
+	c.providerCheckedFor = provider
+	c.providerCheckedRoot = root
+	c.providerCheckedAt = now
+	return nil
 }
 
 func (c *CAManager) checkExpired(pem string) error {
@@ -1515,6 +4772,64 @@ func (c *CAManager) checkExpired(pem string) error {
 	return nil
 }
 
+// checkIntermediateRemaining returns an error wrapping ErrCANotReady when the
+// intermediate signing leaf certificates with caRoot has less than the
+// MinIntermediateRemaining of commonCfg left, so that leaf certificates are
+// signed again once RenewIntermediate installed a new one.
+func (c *CAManager) checkIntermediateRemaining(caRoot *structs.CARoot, commonCfg *structs.CommonCAProviderConfig) error {
+	if commonCfg.MinIntermediateRemaining <= 0 || !c.isIntermediateUsedToSignLeaf() {
+		return nil
+	}
+	pem := c.getLeafSigningCertFromRoot(caRoot)
+	if pem == "" {
+		return nil
+	}
+	cert, err := connect.ParseCert(pem)
+	if err != nil {
+		return fmt.Errorf("error parsing leaf signing cert: %w", err)
+	}
+	now := c.timeNow()
+	if !belowMinIntermediateRemaining(cert, commonCfg, now) {
+		return nil
+	}
+	return fmt.Errorf("%w: the intermediate expires in %s, less than MinIntermediateRemaining (%s), until it is renewed",
+		ErrCANotReady, cert.NotAfter.Sub(now).Round(time.Second), commonCfg.MinIntermediateRemaining)
+}
+
+// belowMinIntermediateRemaining returns whether cert has less than the
+// MinIntermediateRemaining of commonCfg left at now, if set.
+func belowMinIntermediateRemaining(cert *x509.Certificate, commonCfg *structs.CommonCAProviderConfig, now time.Time) bool {
+	return commonCfg.MinIntermediateRemaining > 0 && cert.NotAfter.Sub(now) < commonCfg.MinIntermediateRemaining
+}
+
+// canSignWithRoot returns whether leaf certificates can be signed with the root
+// when the intermediate expired, which the configuration must allow.
+func (c *CAManager) canSignWithRoot(provider ca.Provider, config *structs.CAConfiguration) bool {
+	commonCfg, err := config.GetCommonConfig()
+	if err != nil || !commonCfg.RootSigningFallback {
+		return false
+	}
+	_, ok := provider.(ca.RootLeafSigner)
+	return ok
+}
+
+// rootSigningFallback returns the provider to sign a leaf certificate with the
+// root, when the configuration allows it and the intermediate which would
+// sign it expired. It returns nil when the intermediate is to be used.
+func (c *CAManager) rootSigningFallback(provider ca.Provider, caRoot *structs.CARoot, commonCfg *structs.CommonCAProviderConfig) ca.RootLeafSigner {
+	if !commonCfg.RootSigningFallback || !c.isIntermediateUsedToSignLeaf() || len(caRoot.IntermediateCerts) == 0 {
+		return nil
+	}
+	signer, ok := provider.(ca.RootLeafSigner)
+	if !ok {
+		return nil
+	}
+	if err := c.checkExpired(caRoot.IntermediateCerts[len(caRoot.IntermediateCerts)-1]); err == nil {
+		return nil
+	}
+	return signer
+}
+
 func primaryUsesIntermediate(provider ca.Provider) bool {
 	_, ok := provider.(ca.PrimaryUsesIntermediate)
 	return ok
@@ -0,0 +1,422 @@
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-hclog"
+	gsyslog "github.com/hashicorp/go-syslog"
+
+	"github.com/hashicorp/consul/agent/structs"
+)
+
+// caAuditBatchSize is the maximum number of records delivered to the audit
+// sink at once.
+const caAuditBatchSize = 100
+
+// caAuditHTTPTimeout is how long the http audit sink waits for a response.
+var caAuditHTTPTimeout = 10 * time.Second
+
+// caAuditRecord is the record of a signed leaf certificate delivered to the
+// audit sink.
+type caAuditRecord struct {
+	Time         time.Time
+	SerialNumber string
+	Fingerprint  string
+	SpiffeID     string
+	Service      string `json:",omitempty"`
+	Agent        string `json:",omitempty"`
+	Namespace    string `json:",omitempty"`
+	Partition    string `json:",omitempty"`
+	Datacenter   string
+	RootID       string
+	ValidAfter   time.Time
+	ValidBefore  time.Time
+}
+
+func newCAAuditRecord(issued *structs.IssuedCert, spiffeID string, rootID string, now time.Time) caAuditRecord {
+	return caAuditRecord{
+		Time:         now,
+		SerialNumber: issued.SerialNumber,
+		Fingerprint:  issued.Fingerprint,
+		SpiffeID:     spiffeID,
+		Service:      issued.Service,
+		Agent:        issued.Agent,
+		Namespace:    issued.NamespaceOrEmpty(),
+		Partition:    issued.IssuerPartition,
+		Datacenter:   issued.IssuerDatacenter,
+		RootID:       rootID,
+		ValidAfter:   issued.ValidAfter,
+		ValidBefore:  issued.ValidBefore,
+	}
+}
+
+// caAuditSink delivers audit records. It returns an error unless all of them
+// were delivered, in which case they are all delivered again later.
+type caAuditSink interface {
+	deliver(ctx context.Context, records []caAuditRecord) error
+}
+
+// newCAAuditSink returns the sink of the type picked by conf. Its destination
+// is taken from the server configuration rather than from the CA
+// configuration, so that the operators able to change the latter can't have
+// the leader write to any file or POST to any endpoint.
+func newCAAuditSink(conf *structs.CAAuditSinkConfig, serverConf *Config) (caAuditSink, error) {
+	switch conf.Type {
+	case "file":
+		if serverConf.ConnectCAAuditFilePath == "" {
+			return nil, fmt.Errorf("the file audit sink requires connect.ca_audit_file_path to be set on the servers")
+		}
+		return &fileAuditSink{path: serverConf.ConnectCAAuditFilePath}, nil
+	case "syslog":
+		facility, tag := serverConf.ConnectCAAuditSyslogFacility, serverConf.ConnectCAAuditSyslogTag
+		if facility == "" {
+			facility = "LOCAL0"
+		}
+		if tag == "" {
+			tag = "consul-ca"
+		}
+		logger, err := gsyslog.NewLogger(gsyslog.LOG_INFO, facility, tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		return &syslogAuditSink{logger: logger}, nil
+	case "http":
+		if serverConf.ConnectCAAuditURL == "" {
+			return nil, fmt.Errorf("the http audit sink requires connect.ca_audit_url to be set on the servers")
+		}
+		u, err := url.Parse(serverConf.ConnectCAAuditURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid connect.ca_audit_url: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("connect.ca_audit_url must be an http or https URL")
+		}
+		return &httpAuditSink{url: serverConf.ConnectCAAuditURL, client: &http.Client{Timeout: caAuditHTTPTimeout}}, nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink type %q", conf.Type)
+	}
+}
+
+// fileAuditSink appends the records to a file, one JSON object per line.
+type fileAuditSink struct {
+	path string
+}
+
+func (s *fileAuditSink) deliver(_ context.Context, records []caAuditRecord) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syslogAuditSink sends every record as a syslog message holding its JSON
+// encoding.
+type syslogAuditSink struct {
+	logger gsyslog.Syslogger
+}
+
+func (s *syslogAuditSink) Close() error {
+	return s.logger.Close()
+}
+
+func (s *syslogAuditSink) deliver(_ context.Context, records []caAuditRecord) error {
+	for _, r := range records {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if err := s.logger.WriteLevel(gsyslog.LOG_INFO, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// httpAuditSink POSTs the records to an HTTP endpoint as a JSON array.
+type httpAuditSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpAuditSink) deliver(ctx context.Context, records []caAuditRecord) error {
+	b, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit sink responded with status %s", resp.Status)
+	}
+	return nil
+}
+
+// caAuditor buffers the records of the signed leaf certificates until
+// runAuditDelivery delivers them to the configured sink. Records are only
+// dropped from the buffer once delivered, or when it is full.
+type caAuditor struct {
+	// serverConf holds the destinations of the sinks.
+	serverConf *Config
+
+	lock    sync.Mutex
+	conf    *structs.CAAuditSinkConfig
+	sink    caAuditSink
+	pending []caAuditRecord
+
+	// notifyCh wakes up runAuditDelivery when records are added.
+	notifyCh chan struct{}
+}
+
+func newCAAuditor(serverConf *Config) *caAuditor {
+	return &caAuditor{serverConf: serverConf, notifyCh: make(chan struct{}, 1)}
+}
+
+// record buffers r for delivery to the sink configured by conf, replacing the
+// sink when conf changed. It never blocks on the delivery.
+func (a *caAuditor) record(logger hclog.Logger, conf *structs.CAAuditSinkConfig, r caAuditRecord) {
+	if conf == nil {
+		return
+	}
+
+	a.lock.Lock()
+	if !reflect.DeepEqual(conf, a.conf) {
+		sink, err := newCAAuditSink(conf, a.serverConf)
+		if err != nil {
+			a.lock.Unlock()
+			logger.Error("failed to set up the CA audit sink, dropping the record of the certificate",
+				"serial_number", r.SerialNumber,
+				"error", err,
+			)
+			metrics.IncrCounter(metricsKeyCAAuditDropped, 1)
+			return
+		}
+		// Records still pending go to the new sink. A delivery still in
+		// progress to the old one fails once it is closed, and is retried.
+		if closer, ok := a.sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				logger.Warn("failed to close the previous CA audit sink", "error", err)
+			}
+		}
+		a.conf, a.sink = conf, sink
+	}
+	if len(a.pending) >= conf.Buffer() {
+		a.lock.Unlock()
+		logger.Warn("CA audit buffer is full, dropping the record of the certificate",
+			"serial_number", r.SerialNumber,
+			"buffer_size", conf.Buffer(),
+		)
+		metrics.IncrCounter(metricsKeyCAAuditDropped, 1)
+		return
+	}
+	a.pending = append(a.pending, r)
+	a.lock.Unlock()
+
+	select {
+	case a.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// deliverPending delivers the pending records in batches until none are left,
+// and returns the error of the first failed delivery.
+func (a *caAuditor) deliverPending(ctx context.Context) error {
+	for {
+		a.lock.Lock()
+		sink := a.sink
+		n := len(a.pending)
+		if n > caAuditBatchSize {
+			n = caAuditBatchSize
+		}
+		batch := make([]caAuditRecord, n)
+		copy(batch, a.pending)
+		a.lock.Unlock()
+
+		if n == 0 {
+			return nil
+		}
+		if err := sink.deliver(ctx, batch); err != nil {
+			return err
+		}
+
+		a.lock.Lock()
+		a.pending = a.pending[n:]
+		a.lock.Unlock()
+	}
+}
+
+// runAuditDelivery delivers the records of the signed leaf certificates to
+// the audit sink, retrying failed deliveries with a backoff.
+func (c *CAManager) runAuditDelivery(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.audit.notifyCh:
+			retryLoopBackoffAbortOnSuccess(ctx, func() error {
+				return c.audit.deliverPending(ctx)
+			}, func(err error) {
+				c.logger.Warn("failed to deliver the records of signed certificates to the CA audit sink, retrying",
+					"routine", caAuditDeliveryRoutineName,
+					"error", err,
+				)
+			})
+		}
+	}
+}
+
+// seenIdentityRefreshInterval is how long the LastSeen time of a recorded
+// SPIFFE identity is left as is before signing a certificate for it moves it
+// forward, to limit raft writes.
+var seenIdentityRefreshInterval = 24 * time.Hour
+
+// seenIdentityRetention is how long a SPIFFE identity stays recorded after a
+// certificate was last signed for it. A workload coming back after that is
+// reported as new again.
+var seenIdentityRetention = 90 * 24 * time.Hour
+
+// seenIdentityPruneInterval is how often the leader prunes the SPIFFE
+// identities not seen for seenIdentityRetention.
+var seenIdentityPruneInterval = time.Hour
+
+// recordSeenIdentity records the SPIFFE identity of a signed leaf certificate
+// in the state store, so that it survives restarts. Identities are recorded
+// whether or not the audit sink is configured, so that enabling it doesn't
+// report every existing workload as new. The first time a certificate is
+// signed for an identity, it is counted by the new_identity metric and
+// reported with a CAEventNewIdentity when report is set, for example to alert
+// on a workload appearing in the mesh. Failing to record it doesn't fail the
+// signing.
+func (c *CAManager) recordSeenIdentity(identity, rootID string, report bool) {
+	_, seen, err := c.delegate.State().CASeenIdentity(nil, identity)
+	if err != nil {
+		c.logger.Warn("failed to look up the identity of a signed certificate", "spiffe_id", identity, "error", err)
+		return
+	}
+	now := c.timeNow()
+	if seen != nil && now.Sub(seen.LastSeen) < seenIdentityRefreshInterval {
+		return
+	}
+
+	resp, err := c.delegate.ApplyCARequest(&structs.CARequest{
+		Op:           structs.CAOpRecordSeenIdentity,
+		SeenIdentity: &structs.CASeenIdentity{ID: identity, FirstSeen: now, LastSeen: now},
+	})
+	if err != nil {
+		c.logger.Warn("failed to record the identity of a signed certificate", "spiffe_id", identity, "error", err)
+		return
+	}
+	// Concurrent signings for a new identity race to record it, only the
+	// one which did reports it.
+	if recorded, ok := resp.(bool); !ok || !recorded || !report {
+		return
+	}
+
+	c.logger.Info("signed the first leaf certificate of an identity", "spiffe_id", identity)
+	metrics.IncrCounter(metricsKeyCANewIdentity, 1)
+	if c.eventObserver != nil {
+		c.eventObserver.OnEvent(CAEvent{
+			Type:     CAEventNewIdentity,
+			Time:     now,
+			Provider: c.configuredProviderName(),
+			RootID:   rootID,
+			Identity: identity,
+		})
+	}
+}
+
+// runSeenIdentityPruning periodically prunes the SPIFFE identities no
+// certificate was signed for within seenIdentityRetention, so that the
+// records of workloads that went away don't pile up.
+func (c *CAManager) runSeenIdentityPruning(ctx context.Context) error {
+	ticker := time.NewTicker(seenIdentityPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := c.pruneSeenIdentities(); err != nil {
+				c.logger.Warn("failed to prune the identities of signed certificates",
+					"routine", caSeenIdentityPruningRoutineName,
+					"error", err,
+				)
+			}
+		}
+	}
+}
+
+// pruneSeenIdentities removes the SPIFFE identities no certificate was signed
+// for within seenIdentityRetention.
+func (c *CAManager) pruneSeenIdentities() error {
+	_, identities, err := c.delegate.State().CASeenIdentities(nil)
+	if err != nil {
+		return err
+	}
+	before := c.timeNow().Add(-seenIdentityRetention)
+	stale := false
+	for _, identity := range identities {
+		lastSeen := identity.LastSeen
+		if lastSeen.IsZero() {
+			lastSeen = identity.FirstSeen
+		}
+		if lastSeen.Before(before) {
+			stale = true
+			break
+		}
+	}
+	// Don't write to raft when there's nothing to prune.
+	if !stale {
+		return nil
+	}
+
+	resp, err := c.delegate.ApplyCARequest(&structs.CARequest{
+		Op:         structs.CAOpPruneSeenIdentities,
+		SeenBefore: before,
+	})
+	if err != nil {
+		return err
+	}
+	if pruned, ok := resp.(int); ok && pruned > 0 {
+		c.logger.Info("pruned the identities of signed certificates not seen recently", "count", pruned)
+	}
+	return nil
+}
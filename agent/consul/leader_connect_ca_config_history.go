@@ -0,0 +1,155 @@
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/consul/agent/structs"
+)
+
+// caConfigSecretKeys are the names of the CA configuration keys whose values
+// are redacted from the configuration history, along with those containing
+// one of caConfigSecretSubstrings, compared in lower case and without
+// underscores. They cover the keys of every provider, including nested ones
+// such as the parameters of the Vault auth method.
+var (
+	caConfigSecretKeys       = []string{"privatekey", "jwt"}
+	caConfigSecretSubstrings = []string{"token", "secret", "password"}
+)
+
+// isCAConfigSecretKey returns whether the value of the CA configuration key
+// is a secret.
+func isCAConfigSecretKey(key string) bool {
+	key = strings.ToLower(strings.ReplaceAll(key, "_", ""))
+	for _, s := range caConfigSecretKeys {
+		if key == s {
+			return true
+		}
+	}
+	for _, s := range caConfigSecretSubstrings {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactCAConfigValue returns a copy of v with the values of the secret keys
+// of the maps it contains replaced.
+func redactCAConfigValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			if isCAConfigSecretKey(k) {
+				redacted[k] = redactedToken
+			} else {
+				redacted[k] = redactCAConfigValue(val)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, val := range v {
+			redacted[i] = redactCAConfigValue(val)
+		}
+		return redacted
+	default:
+		return v
+	}
+}
+
+// encodeCAConfigValue returns the JSON encoding of the value v of key,
+// redacted.
+func encodeCAConfigValue(key string, v interface{}) string {
+	if isCAConfigSecretKey(key) {
+		v = redactedToken
+	} else {
+		v = redactCAConfigValue(v)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return redactedToken
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// caConfigChanges returns the changes from the CA configuration prev to next,
+// with the values of secrets redacted. A changed secret is reported with both
+// values redacted.
+func caConfigChanges(prev, next *structs.CAConfiguration) []structs.CAConfigChange {
+	var changes []structs.CAConfigChange
+	if prev.Provider != next.Provider {
+		changes = append(changes, structs.CAConfigChange{
+			Key:      "Provider",
+			Previous: encodeCAConfigValue("Provider", prev.Provider),
+			New:      encodeCAConfigValue("Provider", next.Provider),
+		})
+	}
+
+	keys := make(map[string]struct{})
+	for k := range prev.Config {
+		keys[k] = struct{}{}
+	}
+	for k := range next.Config {
+		keys[k] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		prevValue, prevOK := prev.Config[k]
+		nextValue, nextOK := next.Config[k]
+		if prevOK == nextOK && reflect.DeepEqual(prevValue, nextValue) {
+			continue
+		}
+		change := structs.CAConfigChange{Key: k}
+		if prevOK {
+			change.Previous = encodeCAConfigValue(k, prevValue)
+		}
+		if nextOK {
+			change.New = encodeCAConfigValue(k, nextValue)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// recordConfigChange records in the CA configuration history the change from
+// prev to the stored configuration, if UpdateConfiguration applied one. The
+// change is already applied, so failing to record it is only logged.
+func (c *CAManager) recordConfigChange(prev *structs.CAConfiguration, accessorID string) {
+	_, next, err := c.delegate.State().CAConfig(nil)
+	if err != nil || next == nil {
+		c.logger.Warn("failed to record the change of the CA configuration", "error", err)
+		return
+	}
+	if next.ModifyIndex == prev.ModifyIndex {
+		return
+	}
+	changes := caConfigChanges(prev, next)
+	if len(changes) == 0 {
+		return
+	}
+
+	_, err = c.delegate.ApplyCARequest(&structs.CARequest{
+		Op: structs.CAOpRecordConfigChange,
+		ConfigChange: &structs.CAConfigHistoryEntry{
+			AccessorID: accessorID,
+			ChangedAt:  c.timeNow(),
+			Provider:   next.Provider,
+			Changes:    changes,
+		},
+	})
+	if err != nil {
+		c.logger.Warn("failed to record the change of the CA configuration", "error", err)
+	}
+}
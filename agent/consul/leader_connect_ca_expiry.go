@@ -0,0 +1,69 @@
+package consul
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/armon/go-metrics"
+	memdb "github.com/hashicorp/go-memdb"
+
+	"github.com/hashicorp/consul/agent/connect"
+)
+
+// caExpiryInterval is how often the leader emits the seconds until the active
+// root and the leaf signing cert expire, besides whenever the roots change.
+var caExpiryInterval = time.Minute
+
+// runCAExpiryMetrics emits the seconds until the active root and the leaf
+// signing cert expire whenever the CA roots change, and every
+// caExpiryInterval so that the gauges keep counting down in between.
+func (c *CAManager) runCAExpiryMetrics(ctx context.Context) error {
+	for {
+		ws := memdb.NewWatchSet()
+		ws.Add(c.delegate.State().AbandonCh())
+		c.emitCAExpiryMetrics(ws)
+
+		watchCtx, cancel := context.WithTimeout(ctx, caExpiryInterval)
+		_ = ws.WatchCtx(watchCtx)
+		cancel()
+
+		if ctx.Err() != nil {
+			// Don't let a follower report the expiry of the roots it had as a
+			// leader.
+			metrics.SetGauge(metricsKeyCARootExpiry, float32(math.NaN()))
+			metrics.SetGauge(metricsKeyCAIntermediateExpiry, float32(math.NaN()))
+			return nil
+		}
+	}
+}
+
+// emitCAExpiryMetrics emits the seconds until the active root and the leaf
+// signing cert expire, adding the active root to ws. A gauge is set to NaN
+// when its cert is missing, so that the value of a previous root doesn't
+// linger after a rotation.
+func (c *CAManager) emitCAExpiryMetrics(ws memdb.WatchSet) {
+	rootExpiry, signingExpiry := math.NaN(), math.NaN()
+
+	_, root, err := c.delegate.State().CARootActive(ws)
+	switch {
+	case err != nil:
+		c.logger.Warn("failed to get the active root for the CA expiry metrics", "error", err)
+	case root != nil:
+		now := c.timeNow()
+		rootExpiry = root.NotAfter.Sub(now).Seconds()
+
+		// A secondary has no signing cert until its intermediate is signed.
+		if signingPEM := c.getLeafSigningCertFromRoot(root); signingPEM != "" {
+			cert, err := connect.ParseCert(signingPEM)
+			if err != nil {
+				c.logger.Warn("failed to parse the leaf signing cert for the CA expiry metrics", "error", err)
+			} else {
+				signingExpiry = cert.NotAfter.Sub(now).Seconds()
+			}
+		}
+	}
+
+	metrics.SetGauge(metricsKeyCARootExpiry, float32(rootExpiry))
+	metrics.SetGauge(metricsKeyCAIntermediateExpiry, float32(signingExpiry))
+}
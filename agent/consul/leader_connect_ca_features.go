@@ -0,0 +1,70 @@
+package consul
+
+import (
+	"time"
+
+	"github.com/hashicorp/go-version"
+)
+
+// caFeature is a CA feature that servers older than minVersion don't know
+// about, and which would confuse them or have them disagree with the servers
+// that do. It is only used once every server of the datacenter supports it,
+// so that a cluster keeps behaving consistently while it is being upgraded.
+type caFeature struct {
+	name       string
+	minVersion *version.Version
+}
+
+var (
+	// caFeatureMultiRootBundles publishes the AdditionalTrustAnchors of the
+	// CA configuration along with the stored roots. Older servers serve the
+	// stored roots only, so clients would get different bundles depending on
+	// the server answering them.
+	caFeatureMultiRootBundles = caFeature{
+		name:       "multi-root bundles",
+		minVersion: version.Must(version.NewVersion("1.12.0")),
+	}
+
+	// caFeatureStagedIntermediateRotation drops the intermediates replaced by
+	// a renewal once the IntermediateGracePeriod of the CA configuration has
+	// passed. Older servers don't keep track of when intermediates were
+	// replaced, so a leader change would restart their grace period.
+	caFeatureStagedIntermediateRotation = caFeature{
+		name:       "staged intermediate rotation",
+		minVersion: version.Must(version.NewVersion("1.12.0")),
+	}
+)
+
+// caFeatureEnabled returns whether every server of the datacenter supports f,
+// logging when f becomes gated because some don't, and when it no longer is.
+func (c *CAManager) caFeatureEnabled(f caFeature) bool {
+	enabled := c.delegate.ServersMeetMinimumVersion(f.minVersion)
+
+	c.gatedFeaturesLock.Lock()
+	defer c.gatedFeaturesLock.Unlock()
+	if c.gatedFeatures == nil {
+		c.gatedFeatures = make(map[string]bool)
+	}
+	switch {
+	case !enabled && !c.gatedFeatures[f.name]:
+		c.gatedFeatures[f.name] = true
+		c.logger.Warn("CA feature disabled until all servers are upgraded",
+			"feature", f.name,
+			"min_version", f.minVersion.String(),
+		)
+	case enabled && c.gatedFeatures[f.name]:
+		delete(c.gatedFeatures, f.name)
+		c.logger.Info("CA feature enabled now that all servers support it", "feature", f.name)
+	}
+	return enabled
+}
+
+// intermediateGracePeriod returns how long replaced intermediates are kept,
+// which is until the root is rotated, as older servers do, while staged
+// intermediate rotation is gated.
+func (c *CAManager) intermediateGracePeriod(grace time.Duration) time.Duration {
+	if grace > 0 && !c.caFeatureEnabled(caFeatureStagedIntermediateRotation) {
+		return 0
+	}
+	return grace
+}
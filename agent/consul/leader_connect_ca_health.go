@@ -0,0 +1,100 @@
+package consul
+
+import (
+	"time"
+
+	"github.com/hashicorp/consul/agent/connect"
+)
+
+// CAHealth is a snapshot of the health of the Connect CA as seen by one
+// server. The root and signing cert are read from the state store, so they
+// are known on every server, while the rest is only known by the leader.
+type CAHealth struct {
+	// State is the state of the CAManager, such as INITIALIZED.
+	State string
+
+	// Provider is the name of the CA provider, or empty when this server
+	// doesn't run the CA.
+	Provider string
+
+	// ProviderHealthy is whether the provider signs with the active root. It
+	// is false when this server doesn't run the CA.
+	ProviderHealthy bool
+
+	// KeyLocation is where the provider holds the keys of the CA, such as
+	// consul-state, or empty when this server doesn't run the CA.
+	KeyLocation string
+
+	// RootID is the ID of the active root, or empty if there is none.
+	RootID string
+
+	// RootNotAfter is the expiry of the active root.
+	RootNotAfter time.Time
+
+	// SigningCertNotAfter is the expiry of the cert signing leaf
+	// certificates, the root or an intermediate.
+	SigningCertNotAfter time.Time
+
+	// LeavesActive and LeavesExpiringSoon count the unexpired leaf
+	// certificates signed while this server is the leader, as reported by the
+	// connect.ca.leaves metrics.
+	LeavesActive       int
+	LeavesExpiringSoon int
+
+	// IdentitiesDormant counts the identities this server signed leaf
+	// certificates for as the leader, but none within the dormant identity
+	// window, as reported by the connect.ca.identities.dormant metric.
+	IdentitiesDormant int
+
+	// ProviderUsageReported is whether the provider reported its usage, in
+	// which case ProviderIssued is the number of certificates it issued in its
+	// billing period and ProviderQuota its quota for the period, zero if it
+	// has none. Only providers implementing ca.UsageReporter report usage.
+	ProviderUsageReported bool
+	ProviderIssued        int64
+	ProviderQuota         int64
+}
+
+// ConnectCAHealth returns the health of the Connect CA as seen by this server.
+func (s *Server) ConnectCAHealth() (CAHealth, error) {
+	return s.caManager.Health()
+}
+
+// Health returns the health of the CA. It only reads local state, apart from
+// the provider being checked against the active root at most every
+// providerRootCheckInterval, so it is cheap enough to call on every scrape.
+func (c *CAManager) Health() (CAHealth, error) {
+	c.stateLock.Lock()
+	health := CAHealth{State: string(c.state)}
+	c.stateLock.Unlock()
+
+	_, root, err := c.delegate.State().CARootActive(nil)
+	if err != nil {
+		return CAHealth{}, err
+	}
+	if root != nil {
+		health.RootID = root.ID
+		health.RootNotAfter = root.NotAfter
+		if signingCert, err := connect.ParseCert(c.getLeafSigningCertFromRoot(root)); err == nil {
+			health.SigningCertNotAfter = signingCert.NotAfter
+		}
+	}
+
+	provider, providerRoot := c.getCAProvider()
+	if provider != nil && providerRoot != nil {
+		_, config, err := c.delegate.State().CAConfig(nil)
+		if err != nil {
+			return CAHealth{}, err
+		}
+		if config != nil {
+			health.Provider = config.Provider
+		}
+		health.ProviderHealthy = c.verifyProviderMatchesRoot(provider, providerRoot) == nil
+		health.KeyLocation = keyStorageLocation(provider)
+		now := c.timeNow()
+		health.LeavesActive, health.LeavesExpiringSoon = c.leaves.prune(now, c.serverConf.ConnectLeafExpiringSoonHorizon)
+		health.IdentitiesDormant = c.leaves.dormant(now, c.serverConf.ConnectDormantIdentityWindow)
+		health.ProviderIssued, health.ProviderQuota, health.ProviderUsageReported = c.usage.get()
+	}
+	return health, nil
+}
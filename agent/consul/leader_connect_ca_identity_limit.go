@@ -0,0 +1,89 @@
+package consul
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// identityLimiterPruneInterval is how often the limiters of identities that
+// stopped asking for leaf certificates are forgotten.
+const identityLimiterPruneInterval = time.Minute
+
+// identitySignLimiter limits the rate of signing the leaf certificates of each
+// service or agent identity, as configured with CSRMaxPerSecondPerIdentity and
+// CSRBurstPerIdentity. The zero value is ready to use.
+type identitySignLimiter struct {
+	lock      sync.Mutex
+	limiters  map[string]*identityLimiter
+	lastPrune time.Time
+}
+
+type identityLimiter struct {
+	*rate.Limiter
+	lastUsed time.Time
+}
+
+// allow reports whether a leaf certificate of identity can be signed at now.
+// The limiter of an identity is replaced when limit or burst changed in the CA
+// configuration.
+func (l *identitySignLimiter) allow(identity string, limit rate.Limit, burst int, now time.Time) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.prune(now, limit, burst)
+
+	lim, ok := l.limiters[identity]
+	if !ok || lim.Limit() != limit || lim.Burst() != burst {
+		if l.limiters == nil {
+			l.limiters = make(map[string]*identityLimiter)
+		}
+		lim = &identityLimiter{Limiter: rate.NewLimiter(limit, burst)}
+		l.limiters[identity] = lim
+	}
+	lim.lastUsed = now
+	return lim.AllowN(now, 1)
+}
+
+// prune forgets the limiters of the identities idle for long enough that their
+// limiter filled up again, so that forgetting them changes nothing. It only
+// looks at them once per identityLimiterPruneInterval.
+func (l *identitySignLimiter) prune(now time.Time, limit rate.Limit, burst int) {
+	if now.Sub(l.lastPrune) < identityLimiterPruneInterval {
+		return
+	}
+	l.lastPrune = now
+
+	refill := time.Duration(float64(burst) / float64(limit) * float64(time.Second))
+	for identity, lim := range l.limiters {
+		if now.Sub(lim.lastUsed) > refill {
+			delete(l.limiters, identity)
+		}
+	}
+}
+
+// reset forgets the limiters of all identities.
+func (l *identitySignLimiter) reset() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.limiters = nil
+	l.lastPrune = time.Time{}
+}
+
+// identityRateLimitedError is returned when the leaf certificates of an
+// identity are requested faster than CSRMaxPerSecondPerIdentity allows. Its
+// message is the one of ErrRateLimited so that clients, which can only compare
+// error strings over net/rpc, back off and retry, while the server can tell it
+// from the other limits.
+type identityRateLimitedError struct {
+	identity string
+}
+
+func (e identityRateLimitedError) Error() string {
+	return ErrRateLimited.Error()
+}
+
+func (e identityRateLimitedError) Is(target error) bool {
+	return target == ErrRateLimited
+}
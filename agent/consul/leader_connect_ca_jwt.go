@@ -0,0 +1,118 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/hashicorp/consul/acl"
+	"github.com/hashicorp/consul/agent/structs"
+	"github.com/hashicorp/consul/internal/go-sso/oidcauth"
+)
+
+// jwtServiceClaim is the key ServiceClaim is mapped to in the claims
+// extracted from the JWTs of ConnectCA.SignWithJWT requests.
+const jwtServiceClaim = "service"
+
+// jwtSigningAuth holds the authenticator validating the JWTs of
+// ConnectCA.SignWithJWT requests, along with the configuration it was built
+// from, so that JWKS keys are only fetched again when the configuration
+// changes.
+type jwtSigningAuth struct {
+	lock   sync.Mutex
+	config *structs.CAJWTSigningConfig
+	auth   *oidcauth.Authenticator
+}
+
+// authenticator returns an authenticator for config, reusing the previous one
+// when config didn't change.
+func (a *jwtSigningAuth) authenticator(config *structs.CAJWTSigningConfig, logger hclog.Logger) (*oidcauth.Authenticator, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.auth != nil && reflect.DeepEqual(a.config, config) {
+		return a.auth, nil
+	}
+
+	auth, err := oidcauth.New(&oidcauth.Config{
+		Type:                 oidcauth.TypeJWT,
+		JWTSupportedAlgs:     config.JWTSupportedAlgs,
+		BoundAudiences:       config.BoundAudiences,
+		ClaimMappings:        map[string]string{config.ServiceClaim: jwtServiceClaim},
+		OIDCDiscoveryURL:     config.OIDCDiscoveryURL,
+		OIDCDiscoveryCACert:  config.OIDCDiscoveryCACert,
+		JWKSURL:              config.JWKSURL,
+		JWKSCACert:           config.JWKSCACert,
+		JWTValidationPubKeys: config.JWTValidationPubKeys,
+		BoundIssuer:          config.BoundIssuer,
+		ExpirationLeeway:     config.ExpirationLeeway,
+		NotBeforeLeeway:      config.NotBeforeLeeway,
+		ClockSkewLeeway:      config.ClockSkewLeeway,
+	}, logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWTSigning configuration: %w", err)
+	}
+	if a.auth != nil {
+		a.auth.Stop()
+	}
+	a.config, a.auth = config, auth
+	return auth, nil
+}
+
+// stop stops the authenticator, for when this server stops being the leader.
+func (a *jwtSigningAuth) stop() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.auth != nil {
+		a.auth.Stop()
+	}
+	a.config, a.auth = nil, nil
+}
+
+// AuthorizeJWT validates token as configured by the JWTSigning field of the
+// CA configuration and returns the name of the service it grants the identity
+// of. Errors about the token wrap acl.ErrPermissionDenied.
+func (c *CAManager) AuthorizeJWT(ctx context.Context, token string) (string, error) {
+	_, config, err := c.delegate.State().CAConfig(nil)
+	if err != nil {
+		return "", err
+	}
+	commonCfg, err := config.GetCommonConfig()
+	if err != nil {
+		return "", err
+	}
+	jwtCfg := commonCfg.JWTSigning
+	if jwtCfg == nil {
+		return "", fmt.Errorf("signing with a JWT is not enabled in the CA configuration")
+	}
+
+	auth, err := c.jwtAuth.authenticator(jwtCfg, c.logger)
+	if err != nil {
+		return "", err
+	}
+	claims, err := auth.ClaimsFromJWT(ctx, token)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid JWT: %v", acl.ErrPermissionDenied, err)
+	}
+
+	service := claims.Values[jwtServiceClaim]
+	if service == "" {
+		return "", fmt.Errorf("%w: JWT has no %q claim", acl.ErrPermissionDenied, jwtCfg.ServiceClaim)
+	}
+	if len(jwtCfg.AllowedServices) > 0 && !stringSliceContains(jwtCfg.AllowedServices, service) {
+		return "", fmt.Errorf("%w: service %q is not allowed to sign with a JWT", acl.ErrPermissionDenied, service)
+	}
+	return service, nil
+}
+
+func stringSliceContains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package consul
+
+import (
+	"sync"
+	"time"
+
+	memdb "github.com/hashicorp/go-memdb"
+
+	"github.com/hashicorp/consul/agent/connect/ca"
+	"github.com/hashicorp/consul/agent/structs"
+)
+
+// serviceLeafTTLCache caches the LeafCertTTL that service-defaults config
+// entries set for their service, so that signing a leaf certificate doesn't
+// go through all of them. It is refreshed once any config entry changed.
+type serviceLeafTTLCache struct {
+	lock sync.Mutex
+	ttls map[structs.ServiceName]time.Duration
+
+	// ws fires when the config entries the cache was built from changed, or
+	// the state store was replaced. It is nil until the cache is built.
+	ws memdb.WatchSet
+}
+
+// watchSetFired returns whether any channel of ws fired, without blocking.
+func watchSetFired(ws memdb.WatchSet) bool {
+	for ch := range ws {
+		select {
+		case <-ch:
+			return true
+		default:
+		}
+	}
+	return false
+}
+
+// serviceLeafCertTTL returns the LeafCertTTL the service-defaults config
+// entry of sn sets, or zero if it doesn't set one.
+func (c *CAManager) serviceLeafCertTTL(sn structs.ServiceName) (time.Duration, error) {
+	cache := &c.serviceLeafTTLs
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if cache.ws == nil || watchSetFired(cache.ws) {
+		store := c.delegate.State()
+		ws := memdb.NewWatchSet()
+		ws.Add(store.AbandonCh())
+		_, entries, err := store.ConfigEntriesByKind(ws, structs.ServiceDefaults, structs.WildcardEnterpriseMetaInPartition(structs.WildcardSpecifier))
+		if err != nil {
+			return 0, err
+		}
+		ttls := make(map[structs.ServiceName]time.Duration)
+		for _, entry := range entries {
+			svc, ok := entry.(*structs.ServiceConfigEntry)
+			if !ok || svc.LeafCertTTL == 0 {
+				continue
+			}
+			ttls[structs.NewServiceName(svc.Name, &svc.EnterpriseMeta)] = svc.LeafCertTTL
+		}
+		cache.ttls, cache.ws = ttls, ws
+	}
+	return cache.ttls[sn], nil
+}
+
+// applyServiceLeafTTL sets the TTL of params to the LeafCertTTL of the
+// service-defaults config entry of sn, bounded by the MaxServiceLeafCertTTL
+// of conf, unless a certificate template already set it.
+func (c *CAManager) applyServiceLeafTTL(params *ca.LeafSignParams, conf *structs.CommonCAProviderConfig, sn structs.ServiceName) error {
+	if params.TTL != 0 {
+		return nil
+	}
+	ttl, err := c.serviceLeafCertTTL(sn)
+	if err != nil {
+		return err
+	}
+	if bound := conf.ServiceLeafTTLBound(); ttl > bound {
+		c.logger.Debug("service-defaults LeafCertTTL exceeds MaxServiceLeafCertTTL, using the maximum",
+			"service", sn.String(),
+			"leaf_cert_ttl", ttl,
+			"max", bound,
+		)
+		ttl = bound
+	}
+	params.TTL = ttl
+	return nil
+}
@@ -0,0 +1,211 @@
+package consul
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+
+	"github.com/hashicorp/consul/agent/structs"
+)
+
+// leafInventoryInterval is how often the leader prunes expired leaves from the
+// inventory and emits the leaf inventory metrics.
+var leafInventoryInterval = time.Minute
+
+// leafInventory indexes the leaf certificates signed by the leader by serial
+// number until they expire. It only knows about the leaves signed since this
+// server became the leader, so the counts grow back to the cluster wide values
+// over one leaf lifetime after a leader change.
+type leafInventory struct {
+	lock   sync.Mutex
+	leaves map[string]leafRecord
+
+	// identities holds when the latest leaf of each identity, by SPIFFE ID,
+	// expires.
+	identities map[string]time.Time
+
+	// lastSigned holds when a leaf was last signed for each identity, by
+	// SPIFFE ID. Unlike the other maps it isn't pruned when the leaves
+	// expire, since identities that stopped renewing are what it is for.
+	lastSigned map[string]time.Time
+}
+
+// leafRecord is what the leafInventory knows about a leaf certificate.
+type leafRecord struct {
+	// rootID is the ID of the root the leaf was signed under.
+	rootID   string
+	notAfter time.Time
+}
+
+func newLeafInventory() *leafInventory {
+	return &leafInventory{
+		leaves:     make(map[string]leafRecord),
+		identities: make(map[string]time.Time),
+		lastSigned: make(map[string]time.Time),
+	}
+}
+
+// add records a leaf certificate signed under the root with the given ID that
+// is valid until notAfter.
+func (i *leafInventory) add(serial, rootID string, notAfter time.Time) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.leaves[serial] = leafRecord{rootID: rootID, notAfter: notAfter}
+}
+
+// claim is like add but only records the leaf if no other leaf with the same
+// serial number is known. Otherwise it returns false along with the ID of
+// the root the other leaf was signed under.
+func (i *leafInventory) claim(serial, rootID string, notAfter time.Time) (string, bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if existing, ok := i.leaves[serial]; ok {
+		return existing.rootID, false
+	}
+	i.leaves[serial] = leafRecord{rootID: rootID, notAfter: notAfter}
+	return "", true
+}
+
+// addIdentity records a leaf certificate for the identity that is valid
+// until notAfter.
+func (i *leafInventory) addIdentity(identity string, notAfter time.Time) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if notAfter.After(i.identities[identity]) {
+		i.identities[identity] = notAfter
+	}
+}
+
+// identityNotAfter returns when the latest leaf certificate known for the
+// identity expires, if there is one.
+func (i *leafInventory) identityNotAfter(identity string) (time.Time, bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	notAfter, ok := i.identities[identity]
+	return notAfter, ok
+}
+
+// signed records that a leaf certificate was signed for the identity at
+// signedAt.
+func (i *leafInventory) signed(identity string, signedAt time.Time) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if signedAt.After(i.lastSigned[identity]) {
+		i.lastSigned[identity] = signedAt
+	}
+}
+
+// lastSignedAt returns when a leaf certificate was last signed for each
+// identity.
+func (i *leafInventory) lastSignedAt() map[string]time.Time {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	out := make(map[string]time.Time, len(i.lastSigned))
+	for identity, signedAt := range i.lastSigned {
+		out[identity] = signedAt
+	}
+	return out
+}
+
+// dormant returns how many identities had no leaf certificate signed within
+// window before now.
+func (i *leafInventory) dormant(now time.Time, window time.Duration) int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	cutoff := now.Add(-window)
+	n := 0
+	for _, signedAt := range i.lastSigned {
+		if signedAt.Before(cutoff) {
+			n++
+		}
+	}
+	return n
+}
+
+// prune removes the leaves that expired at now and returns how many are left,
+// along with how many of them expire within horizon.
+func (i *leafInventory) prune(now time.Time, horizon time.Duration) (active, expiringSoon int) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	soon := now.Add(horizon)
+	for serial, leaf := range i.leaves {
+		if !now.Before(leaf.notAfter) {
+			delete(i.leaves, serial)
+			continue
+		}
+		if leaf.notAfter.Before(soon) {
+			expiringSoon++
+		}
+	}
+	for identity, notAfter := range i.identities {
+		if !now.Before(notAfter) {
+			delete(i.identities, identity)
+		}
+	}
+	return len(i.leaves), expiringSoon
+}
+
+// reset forgets every leaf, for when this server stops being the leader.
+func (i *leafInventory) reset() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.leaves = make(map[string]leafRecord)
+	i.identities = make(map[string]time.Time)
+	i.lastSigned = make(map[string]time.Time)
+}
+
+// IdentityActivity returns when a leaf certificate was last signed for each
+// identity since this server became the leader, least recently signed first.
+func (c *CAManager) IdentityActivity() []structs.CAIdentityActivity {
+	cutoff := c.timeNow().Add(-c.serverConf.ConnectDormantIdentityWindow)
+	lastSigned := c.leaves.lastSignedAt()
+	out := make([]structs.CAIdentityActivity, 0, len(lastSigned))
+	for identity, signedAt := range lastSigned {
+		out = append(out, structs.CAIdentityActivity{
+			SpiffeID:     identity,
+			LastSignedAt: signedAt,
+			Dormant:      signedAt.Before(cutoff),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].LastSignedAt.Equal(out[j].LastSignedAt) {
+			return out[i].LastSignedAt.Before(out[j].LastSignedAt)
+		}
+		return out[i].SpiffeID < out[j].SpiffeID
+	})
+	return out
+}
+
+// runLeafInventoryMetrics periodically prunes the leaf inventory and emits the
+// number of active leaves, of leaves expiring soon and of dormant identities.
+func (c *CAManager) runLeafInventoryMetrics(ctx context.Context) error {
+	ticker := time.NewTicker(leafInventoryInterval)
+	defer ticker.Stop()
+
+	c.emitLeafInventoryMetrics()
+	for {
+		select {
+		case <-ctx.Done():
+			// Don't let a follower report the counts it had as a leader.
+			metrics.SetGauge(metricsKeyCALeavesActive, float32(math.NaN()))
+			metrics.SetGauge(metricsKeyCALeavesExpiringSoon, float32(math.NaN()))
+			metrics.SetGauge(metricsKeyCAIdentitiesDormant, float32(math.NaN()))
+			return nil
+		case <-ticker.C:
+			c.emitLeafInventoryMetrics()
+		}
+	}
+}
+
+func (c *CAManager) emitLeafInventoryMetrics() {
+	now := c.timeNow()
+	active, expiringSoon := c.leaves.prune(now, c.serverConf.ConnectLeafExpiringSoonHorizon)
+	metrics.SetGauge(metricsKeyCALeavesActive, float32(active))
+	metrics.SetGauge(metricsKeyCALeavesExpiringSoon, float32(expiringSoon))
+	metrics.SetGauge(metricsKeyCAIdentitiesDormant, float32(c.leaves.dormant(now, c.serverConf.ConnectDormantIdentityWindow)))
+}
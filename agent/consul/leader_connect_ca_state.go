@@ -0,0 +1,152 @@
+package consul
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/consul/agent/connect/ca"
+	"github.com/hashicorp/consul/agent/structs"
+)
+
+// defaultProviderStateSizeThreshold is the size in bytes above which a CA
+// provider state value is offered to the ProviderStateStore instead of being
+// stored in raft.
+const defaultProviderStateSizeThreshold = 4096
+
+// ProviderStateStore persists CA provider state values outside of raft, so
+// that providers which need to keep large blobs such as wrapped keys or cached
+// chains don't bloat the raft log and snapshots. Values are keyed by the
+// provider name and the ID of the root they were produced for, and raft only
+// holds a reference to them in CAConfiguration.StateRefs. It is set with
+// Deps.CAProviderStateStore, all values are kept in raft by default.
+type ProviderStateStore interface {
+	// Put stores the value of key in the state of the named provider for the
+	// given root. When the value was stored outside of raft it returns the
+	// reference to persist in raft instead and true. Returning false keeps the
+	// value in raft.
+	Put(provider, rootID, key, value string) (ref string, external bool, err error)
+
+	// Get returns the value that was stored under a reference returned by Put.
+	Get(ref string) (string, error)
+}
+
+// raftProviderStateStore is the default ProviderStateStore. It keeps every
+// value in raft, which is how provider state has always been persisted.
+type raftProviderStateStore struct{}
+
+func (raftProviderStateStore) Put(_, _, _, _ string) (string, bool, error) {
+	return "", false, nil
+}
+
+func (raftProviderStateStore) Get(ref string) (string, error) {
+	return "", fmt.Errorf("provider state %q is not stored outside of raft", ref)
+}
+
+// externalizeProviderState splits the state returned by a provider into the
+// values to persist in raft and the references to the values kept by the
+// state store. Values above the size threshold are offered to the state
+// store, and only replaced by a reference when it keeps them.
+func (c *CAManager) externalizeProviderState(provider, rootID string, state map[string]string) (map[string]string, map[string]string, error) {
+	var stored, refs map[string]string
+	for k, v := range state {
+		if len(v) <= c.providerStateSizeThreshold {
+			continue
+		}
+		ref, external, err := c.providerStateStore.Put(provider, rootID, k, v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error storing provider state %q: %w", k, err)
+		}
+		if !external {
+			continue
+		}
+		if stored == nil {
+			stored = copyProviderState(state)
+			refs = make(map[string]string)
+		}
+		delete(stored, k)
+		refs[k] = ref
+	}
+	if stored == nil {
+		return state, nil, nil
+	}
+	return stored, refs, nil
+}
+
+// resolveProviderState returns the provider state to configure a provider
+// with for the state persisted in raft, adding the values the references
+// point to in the state store.
+func (c *CAManager) resolveProviderState(state, refs map[string]string) (map[string]string, error) {
+	if len(refs) == 0 {
+		return state, nil
+	}
+	resolved := copyProviderState(state)
+	for k, ref := range refs {
+		value, err := c.providerStateStore.Get(ref)
+		if err != nil {
+			return nil, fmt.Errorf("error loading provider state %q: %w", k, err)
+		}
+		resolved[k] = value
+	}
+	return resolved, nil
+}
+
+// providerVersion returns the version of provider, see ca.VersionedProvider.
+func providerVersion(provider ca.Provider) int {
+	if versioned, ok := provider.(ca.VersionedProvider); ok {
+		return versioned.ProviderVersion()
+	}
+	return 0
+}
+
+// checkProviderVersion returns an error wrapping ErrProviderVersionTooOld if
+// the CA configuration and provider state were last written by a newer
+// version of provider than this one, which must not be configured with them.
+func (c *CAManager) checkProviderVersion(provider ca.Provider, conf *structs.CAConfiguration) error {
+	version := providerVersion(provider)
+	if conf.ProviderVersion <= version {
+		return nil
+	}
+	c.logger.Error("refusing to configure the CA provider with the state of a newer version of it, "+
+		"upgrade this server to the version of Consul that wrote it",
+		"provider", conf.Provider,
+		"state_version", conf.ProviderVersion,
+		"provider_version", version,
+	)
+	return fmt.Errorf("%w: the state of the %s provider has version %d but this server only supports up to version %d",
+		ErrProviderVersionTooOld, conf.Provider, conf.ProviderVersion, version)
+}
+
+// verifyProviderStates returns an error wrapping ErrProviderStateCorrupt if a
+// built-in CA provider state is missing its checksum or doesn't match it, so
+// that no provider is configured with damaged state. Only the states of the
+// built-in provider have a checksum: the State of the CA configuration used
+// by the other providers, and the values it references in a
+// ProviderStateStore, aren't verified.
+func (c *CAManager) verifyProviderStates() error {
+	_, states, err := c.delegate.State().CAProviderStates()
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		if state.ChecksumValid() {
+			continue
+		}
+		reason := "does not match its checksum"
+		if state.Checksum == "" {
+			reason = "has no checksum"
+		}
+		c.logger.Error("CA provider state "+reason+", refusing to initialize the CA with it",
+			"id", state.ID,
+			"modify_index", state.ModifyIndex,
+		)
+		return fmt.Errorf("%w: state %q %s", ErrProviderStateCorrupt, state.ID, reason)
+	}
+	return nil
+}
+
+func copyProviderState(state map[string]string) map[string]string {
+	out := make(map[string]string, len(state))
+	for k, v := range state {
+		out[k] = v
+	}
+	return out
+}
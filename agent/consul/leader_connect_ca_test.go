@@ -3,21 +3,32 @@ package consul
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/armon/go-metrics"
 	msgpackrpc "github.com/hashicorp/consul-net-rpc/net-rpc-msgpackrpc"
 	"github.com/hashicorp/consul-net-rpc/net/rpc"
+	"github.com/hashicorp/go-version"
 	vaultapi "github.com/hashicorp/vault/api"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -152,6 +163,13 @@ type mockCAServerDelegate struct {
 	primaryRoot           *structs.CARoot
 	secondaryIntermediate string
 	callbackCh            chan string
+
+	// oldestServer is the version of the oldest server of the datacenter, or
+	// nil for all of them to support every CA feature.
+	oldestServer *version.Version
+
+	// leafRequests counts the calls to ApplyCALeafRequest.
+	leafRequests int
 }
 
 func NewMockCAServerDelegate(t *testing.T, config *Config) *mockCAServerDelegate {
@@ -184,7 +202,12 @@ func (m *mockCAServerDelegate) ServersSupportMultiDCConnectCA() error {
 	return nil
 }
 
+func (m *mockCAServerDelegate) ServersMeetMinimumVersion(minVersion *version.Version) bool {
+	return m.oldestServer == nil || !m.oldestServer.LessThan(minVersion)
+}
+
 func (m *mockCAServerDelegate) ApplyCALeafRequest() (uint64, error) {
+	m.leafRequests++
 	return 3, nil
 }
 
@@ -196,7 +219,11 @@ func (m *mockCAServerDelegate) ApplyCARequest(req *structs.CARequest) (interface
 		return nil, err
 	}
 
-	m.callbackCh <- fmt.Sprintf("raftApply/ConnectCA")
+	// The identities of signed certificates are recorded on every signing,
+	// which tests don't coordinate on.
+	if req.Op != structs.CAOpRecordSeenIdentity && req.Op != structs.CAOpPruneSeenIdentities {
+		m.callbackCh <- fmt.Sprintf("raftApply/ConnectCA")
+	}
 
 	result := fsm.ApplyConnectCAOperationFromRequest(m.store, req, idx+1)
 	if err, ok := result.(error); ok && err != nil {
@@ -237,6 +264,18 @@ type mockCAProvider struct {
 	callbackCh      chan string
 	rootPEM         string
 	intermediatePem string
+	signingKey      crypto.Signer
+	// serial is the serial number of the leaves Sign issues, random when
+	// nil.
+	serial *big.Int
+	// leafIsCA and leafKeyUsage are set on the leaves Sign issues, as if the
+	// provider misbehaved.
+	leafIsCA     bool
+	leafKeyUsage x509.KeyUsage
+	// leafExtKeyUsage and leafTTL, when set, are the extended key usages
+	// and validity of the leaves Sign issues.
+	leafExtKeyUsage []x509.ExtKeyUsage
+	leafTTL         time.Duration
 }
 
 func (m *mockCAProvider) Configure(cfg ca.ProviderConfig) error { return nil }
@@ -258,12 +297,85 @@ func (m *mockCAProvider) ActiveIntermediate() (string, error) {
 	}
 	return m.intermediatePem, nil
 }
-func (m *mockCAProvider) GenerateIntermediate() (string, error)                     { return "", nil }
-func (m *mockCAProvider) Sign(*x509.CertificateRequest) (string, error)             { return "", nil }
-func (m *mockCAProvider) SignIntermediate(*x509.CertificateRequest) (string, error) { return "", nil }
-func (m *mockCAProvider) CrossSignCA(*x509.Certificate) (string, error)             { return "", nil }
-func (m *mockCAProvider) SupportsCrossSigning() (bool, error)                       { return false, nil }
-func (m *mockCAProvider) Cleanup(_ bool, _ map[string]interface{}) error            { return nil }
+func (m *mockCAProvider) VerifySigningKey(context.Context) error {
+	activePEM, err := m.ActiveIntermediate()
+	if err != nil {
+		return err
+	}
+	active, err := connect.ParseCert(activePEM)
+	if err != nil {
+		return err
+	}
+	activeKeyID, err := connect.KeyId(active.PublicKey)
+	if err != nil {
+		return err
+	}
+	signingKeyID, err := connect.KeyId(m.signingKey.Public())
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(activeKeyID, signingKeyID) {
+		return fmt.Errorf("active intermediate is for a different private key")
+	}
+	return nil
+}
+func (m *mockCAProvider) GenerateIntermediate() (string, error) { return "", nil }
+func (m *mockCAProvider) SignIntermediate(context.Context, *x509.CertificateRequest) (string, error) {
+	return "", nil
+}
+func (m *mockCAProvider) CrossSignCA(context.Context, *x509.Certificate) (string, error) {
+	return "", nil
+}
+func (m *mockCAProvider) SupportsCrossSigning() (bool, error)            { return false, nil }
+func (m *mockCAProvider) Cleanup(_ bool, _ map[string]interface{}) error { return nil }
+func (m *mockCAProvider) KeyStorageLocation() (ca.KeyLocation, error) {
+	return ca.KeyLocationConsulState, nil
+}
+
+// Sign issues a leaf certificate for the CSR from the active intermediate using
+// signingKey, which tests set to the key of that intermediate.
+func (m *mockCAProvider) Sign(_ context.Context, csr *x509.CertificateRequest) (string, error) {
+	parentPEM, _ := m.ActiveIntermediate()
+	parent, err := connect.ParseCert(parentPEM)
+	if err != nil {
+		return "", err
+	}
+	serial := m.serial
+	if serial == nil {
+		if serial, err = rand.Int(rand.Reader, big.NewInt(math.MaxInt64)); err != nil {
+			return "", err
+		}
+	}
+	ttl := m.leafTTL
+	if ttl == 0 {
+		ttl = time.Hour
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		URIs:         csr.URIs,
+		NotBefore:    now,
+		NotAfter:     now.Add(ttl),
+		KeyUsage:     m.leafKeyUsage,
+		ExtKeyUsage:  m.leafExtKeyUsage,
+	}
+	if m.leafIsCA {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	}
+	bs, err := x509.CreateCertificate(rand.Reader, template, parent, csr.PublicKey, m.signingKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: bs})), nil
+}
+
+func testParseSigner(t *testing.T, keyPEM string) crypto.Signer {
+	t.Helper()
+	signer, err := connect.ParseSigner(keyPEM)
+	require.NoError(t, err)
+	return signer
+}
 
 func waitForCh(t *testing.T, ch chan string, expected string) {
 	t.Helper()
@@ -296,6 +408,15 @@ func testCAConfig() *structs.CAConfiguration {
 	}
 }
 
+// allowSingleTierCA sets AllowSingleTier in the stored CA configuration, for
+// tests whose fixtures generate the intermediate with the root key.
+func allowSingleTierCA(t *testing.T, delegate *mockCAServerDelegate) {
+	t.Helper()
+	caConf := testCAConfig()
+	caConf.Config["AllowSingleTier"] = true
+	require.NoError(t, delegate.store.CASetConfig(1, caConf))
+}
+
 // initTestManager initializes a CAManager with a mockCAServerDelegate, consuming
 // the ops that come through the channels and returning when initialization has finished.
 func initTestManager(t *testing.T, manager *CAManager, delegate *mockCAServerDelegate) {
@@ -331,6 +452,7 @@ func TestCAManager_Initialize(t *testing.T) {
 	manager.providerShim = &mockCAProvider{
 		callbackCh: delegate.callbackCh,
 		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
 	}
 
 	// Call Initialize and then confirm the RPCs and provider calls
@@ -362,207 +484,3816 @@ func TestCAManager_Initialize(t *testing.T) {
 	require.Equal(t, caStateInitialized, manager.state)
 }
 
-func TestCAManager_UpdateConfigWhileRenewIntermediate(t *testing.T) {
+// rateLimitedSignDelegate is a mockCAServerDelegate whose primary always
+// refuses to sign intermediates because it is rate limiting.
+type rateLimitedSignDelegate struct {
+	*mockCAServerDelegate
+	attempts int32
+}
 
-	// No parallel execution because we change globals
-	patchIntermediateCertRenewInterval(t)
+func (d *rateLimitedSignDelegate) forwardDC(method, dc string, args interface{}, reply interface{}) error {
+	if method == "ConnectCA.SignIntermediate" {
+		atomic.AddInt32(&d.attempts, 1)
+		return errors.New(ErrRateLimited.Error())
+	}
+	return d.mockCAServerDelegate.forwardDC(method, dc, args, reply)
+}
+
+func TestCAManager_ForwardSignIntermediate_StopsOnLeadershipLoss(t *testing.T) {
+	origWait, origRetries := intermediateSignRetryWait, intermediateSignRetries
+	intermediateSignRetryWait, intermediateSignRetries = time.Minute, 4
+	t.Cleanup(func() {
+		intermediateSignRetryWait, intermediateSignRetries = origWait, origRetries
+	})
+
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := &rateLimitedSignDelegate{mockCAServerDelegate: NewMockCAServerDelegate(t, conf)}
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := manager.forwardSignIntermediate(ctx, "csr")
+		errCh <- err
+	}()
+
+	retry.Run(t, func(r *retry.R) {
+		require.EqualValues(r, 1, atomic.LoadInt32(&delegate.attempts))
+	})
+	cancel()
+
+	select {
+	case err := <-errCh:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(CATestTimeout):
+		t.Fatal("forwardSignIntermediate kept backing off after the context was canceled")
+	}
+	require.EqualValues(t, 1, atomic.LoadInt32(&delegate.attempts))
+}
 
+func TestCAManager_SignCertificate_Initializing(t *testing.T) {
 	conf := DefaultConfig()
 	conf.ConnectEnabled = true
 	conf.PrimaryDatacenter = "dc1"
 	conf.Datacenter = "dc2"
 	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.primaryRoot = connect.TestCA(t, nil)
 	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
 	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+
 	manager.providerShim = &mockCAProvider{
 		callbackCh: delegate.callbackCh,
 		rootPEM:    delegate.primaryRoot.RootCert,
-	}
-	initTestManager(t, manager, delegate)
-
-	// Simulate Wait half the TTL for the cert to need renewing.
-	manager.timeNow = func() time.Time {
-		return time.Now().Add(500 * time.Millisecond)
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
 	}
 
-	// Call RenewIntermediate and then confirm the RPCs and provider calls
-	// happen in the expected order.
 	errCh := make(chan error)
 	go func() {
-		errCh <- manager.RenewIntermediate(context.TODO(), false)
+		errCh <- manager.Initialize()
 	}()
 
+	// The provider has its intermediate but the new roots aren't committed
+	// yet.
+	waitForCh(t, delegate.callbackCh, "forwardDC/ConnectCA.Roots")
 	waitForCh(t, delegate.callbackCh, "provider/GenerateIntermediateCSR")
+	waitForCh(t, delegate.callbackCh, "forwardDC/ConnectCA.SignIntermediate")
+	waitForCh(t, delegate.callbackCh, "provider/SetIntermediate")
 
-	// Call UpdateConfiguration while RenewIntermediate is still in-flight to
-	// make sure we get an error about the state being occupied.
+	spiffeID := connect.TestSpiffeIDService(t, "web")
+	csrPEM, _ := connect.TestCSR(t, spiffeID)
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+	_, err = manager.SignCertificate(csr, spiffeID)
+	require.ErrorIs(t, err, ErrCANotReady)
+	require.Contains(t, err.Error(), "CA state is INITIALIZING")
+
+	waitForCh(t, delegate.callbackCh, "raftApply/ConnectCA")
+	waitForEmptyCh(t, delegate.callbackCh)
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(CATestTimeout):
+		t.Fatal("never got result from errCh")
+	}
+
+	// Once initialized, the retried request succeeds.
+	_, err = manager.SignCertificate(csr, spiffeID)
+	require.NoError(t, err)
+}
+
+func TestCAManager_StateMetrics(t *testing.T) {
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	cfg := metrics.DefaultConfig("consul.test")
+	cfg.EnableHostname = false
+	cfg.EnableRuntimeMetrics = false
+	metrics.NewGlobal(cfg, sink)
+	t.Cleanup(func() {
+		metrics.NewGlobal(cfg, &metrics.BlackholeSink{})
+	})
+
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+	}
+
+	// The test may straddle two of the sink's intervals, so look at the
+	// latest values across them.
+	latest := func() (map[string]metrics.GaugeValue, map[string]metrics.SampledValue) {
+		gauges := make(map[string]metrics.GaugeValue)
+		counters := make(map[string]metrics.SampledValue)
+		for _, interval := range sink.Data() {
+			for k, v := range interval.Gauges {
+				gauges[k] = v
+			}
+			for k, v := range interval.Counters {
+				counters[k] = v
+			}
+		}
+		return gauges, counters
+	}
+	requireState := func(t *testing.T, expected caState) {
+		t.Helper()
+		gauges, _ := latest()
+		for _, s := range caStates {
+			var value float32
+			if s == expected {
+				value = 1
+			}
+			gauge, ok := gauges["consul.test.connect.ca.state;state="+string(s)]
+			require.True(t, ok, "no gauge for state %s", s)
+			require.Equal(t, value, gauge.Value, "gauge for state %s", s)
+		}
+	}
+	requireState(t, caStateUninitialized)
+
+	errCh := make(chan error)
 	go func() {
-		require.EqualValues(t, caStateRenewIntermediate, manager.state)
-		require.Error(t, errors.New("already in state"), manager.UpdateConfiguration(&structs.CARequest{}))
+		errCh <- manager.Initialize()
 	}()
 
+	waitForCh(t, delegate.callbackCh, "forwardDC/ConnectCA.Roots")
+	requireState(t, caStateInitializing)
+	waitForCh(t, delegate.callbackCh, "provider/GenerateIntermediateCSR")
 	waitForCh(t, delegate.callbackCh, "forwardDC/ConnectCA.SignIntermediate")
 	waitForCh(t, delegate.callbackCh, "provider/SetIntermediate")
 	waitForCh(t, delegate.callbackCh, "raftApply/ConnectCA")
 	waitForEmptyCh(t, delegate.callbackCh)
 
-	// Make sure the RenewIntermediate call returned successfully.
 	select {
 	case err := <-errCh:
 		require.NoError(t, err)
 	case <-time.After(CATestTimeout):
 		t.Fatal("never got result from errCh")
 	}
+	requireState(t, caStateInitialized)
+
+	// The time spent initializing is counted once the state is left.
+	_, counters := latest()
+	initializing, ok := counters["consul.test.connect.ca.state.seconds;state=INITIALIZING"]
+	require.True(t, ok)
+	require.Equal(t, 1, initializing.Count)
+	require.Greater(t, initializing.Sum, float64(0))
+	require.NotContains(t, counters, "consul.test.connect.ca.state.seconds;state=UNINITIALIZED")
+
+	// The time spent in the current state is reported while in it.
+	requireStateSeconds := func(t *testing.T, state caState, expected float32) {
+		t.Helper()
+		gauges, _ := latest()
+		gauge, ok := gauges["consul.test.connect.ca.state.current_seconds;state="+string(state)]
+		require.True(t, ok, "no gauge for state %s", state)
+		require.Equal(t, expected, gauge.Value, "gauge for state %s", state)
+	}
+	requireStateSeconds(t, caStateInitializing, 0)
+	requireStateSeconds(t, caStateInitialized, 0)
+	since := manager.stateSince
+	manager.timeNow = func() time.Time { return since.Add(30 * time.Second) }
+	manager.emitCAStateDurationMetric()
+	requireStateSeconds(t, caStateInitialized, 30)
+}
 
-	require.EqualValues(t, caStateInitialized, manager.state)
+func TestCAManager_Initialize_IntermediateTooLarge(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	// The bundle isn't PEM past the limit, so it can't be parsed anyway.
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert + strings.Repeat("A", conf.ConnectCAMaxChainSize)
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- manager.Initialize()
+	}()
+
+	waitForCh(t, delegate.callbackCh, "forwardDC/ConnectCA.Roots")
+	waitForCh(t, delegate.callbackCh, "provider/GenerateIntermediateCSR")
+	waitForCh(t, delegate.callbackCh, "forwardDC/ConnectCA.SignIntermediate")
+
+	// The bundle is rejected before it reaches the provider.
+	select {
+	case err := <-errCh:
+		require.ErrorIs(t, err, ErrInputTooLarge)
+	case <-time.After(CATestTimeout):
+		t.Fatal("never got result from errCh")
+	}
+	waitForEmptyCh(t, delegate.callbackCh)
 }
 
-func TestCAManager_SignCertificate_WithExpiredCert(t *testing.T) {
-	if testing.Short() {
-		t.Skip("too slow for testing.Short")
+func TestCAManager_Initialize_IntermediateNotSignedByRoot(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	// The primary advertises its root but returns an unrelated CA.
+	delegate.secondaryIntermediate = connect.TestCA(t, nil).RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
 	}
 
-	args := []struct {
-		testName              string
-		notBeforeRoot         time.Time
-		notAfterRoot          time.Time
-		notBeforeIntermediate time.Time
-		notAfterIntermediate  time.Time
-		isError               bool
-		errorMsg              string
-	}{
-		{"intermediate valid", time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 2), time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 2), false, ""},
-		{"intermediate expired", time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 2), time.Now().AddDate(-2, 0, 0), time.Now().AddDate(0, 0, -1), true, "intermediate expired: certificate expired, expiration date"},
-		{"root expired", time.Now().AddDate(-2, 0, 0), time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 2), true, "root expired: certificate expired, expiration date"},
-		// a cert that is not yet valid is ok, assume it will be valid soon enough
-		{"intermediate in the future", time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 2), time.Now().AddDate(0, 0, 1), time.Now().AddDate(0, 0, 2), false, ""},
-		{"root in the future", time.Now().AddDate(0, 0, 1), time.Now().AddDate(0, 0, 2), time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 2), false, ""},
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- manager.Initialize()
+	}()
+
+	waitForCh(t, delegate.callbackCh, "forwardDC/ConnectCA.Roots")
+	waitForCh(t, delegate.callbackCh, "provider/GenerateIntermediateCSR")
+	waitForCh(t, delegate.callbackCh, "forwardDC/ConnectCA.SignIntermediate")
+
+	// The intermediate is refused before it reaches the provider.
+	select {
+	case err := <-errCh:
+		require.ErrorIs(t, err, ErrIntermediateNotSignedByRoot)
+		require.Contains(t, err.Error(), delegate.primaryRoot.ID)
+	case <-time.After(CATestTimeout):
+		t.Fatal("never got result from errCh")
+	}
+	waitForEmptyCh(t, delegate.callbackCh)
+	require.NotEqual(t, caStateInitialized, manager.state)
+}
+
+func TestCAManager_Initialize_IntermediateHasRootKey(t *testing.T) {
+	run := func(t *testing.T, allowSingleTier bool) error {
+		conf := DefaultConfig()
+		conf.ConnectEnabled = true
+		conf.PrimaryDatacenter = "dc1"
+		conf.Datacenter = "dc2"
+		delegate := NewMockCAServerDelegate(t, conf)
+		caConf := testCAConfig()
+		caConf.Config["AllowSingleTier"] = allowSingleTier
+		require.NoError(t, delegate.store.CASetConfig(2, caConf))
+		delegate.primaryRoot = connect.TestCA(t, nil)
+
+		// The primary returns its root re-issued as an intermediate, with the
+		// same key.
+		rootCert, err := connect.ParseCert(delegate.primaryRoot.RootCert)
+		require.NoError(t, err)
+		rootKey := testParseSigner(t, delegate.primaryRoot.SigningKey)
+		intermediate, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber:          big.NewInt(2),
+			Subject:               pkix.Name{CommonName: "intermediate"},
+			URIs:                  rootCert.URIs,
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		}, rootCert, rootKey.Public(), rootKey)
+		require.NoError(t, err)
+		delegate.secondaryIntermediate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: intermediate}))
+
+		manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+		manager.providerShim = &mockCAProvider{
+			callbackCh: delegate.callbackCh,
+			rootPEM:    delegate.primaryRoot.RootCert,
+			signingKey: rootKey,
+		}
+		go func() {
+			for range delegate.callbackCh {
+			}
+		}()
+		t.Cleanup(func() { close(delegate.callbackCh) })
+		return manager.Initialize()
+	}
+
+	t.Run("refused", func(t *testing.T) {
+		err := run(t, false)
+		require.ErrorIs(t, err, ErrIntermediateHasRootKey)
+		require.Contains(t, err.Error(), `intermediate "intermediate" has the same public key as root`)
+	})
+
+	t.Run("single tier", func(t *testing.T) {
+		require.NoError(t, run(t, true))
+	})
+}
+
+func TestCAManager_Initialize_ProviderStateCorrupt(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc1"
+	delegate := NewMockCAServerDelegate(t, conf)
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+	}
+
+	_, err := delegate.store.CASetProviderState(2, &structs.CAConsulProviderState{
+		ID:         "consul-state",
+		PrivateKey: "private key",
+		RootCert:   "root cert",
+	})
+	require.NoError(t, err)
+	_, stored, err := delegate.store.CAProviderState("consul-state")
+	require.NoError(t, err)
+
+	// Restore a snapshot in which the state was truncated.
+	corrupt := *stored
+	corrupt.PrivateKey = "priv"
+	restore := delegate.store.Restore()
+	require.NoError(t, restore.CAProviderState(&corrupt))
+	require.NoError(t, restore.Commit())
+
+	err = manager.Initialize()
+	require.True(t, errors.Is(err, ErrProviderStateCorrupt), "unexpected error: %v", err)
+	require.Contains(t, err.Error(), `state "consul-state" does not match its checksum`)
+	require.Equal(t, caStateUninitialized, manager.state)
+	provider, _ := manager.getCAProvider()
+	require.Nil(t, provider)
+}
+
+// versionedCAProvider is a mockCAProvider for the primary datacenter
+// declaring a provider version.
+type versionedCAProvider struct {
+	mockCAProvider
+	version int
+}
+
+func (m *versionedCAProvider) ProviderVersion() int                  { return m.version }
+func (m *versionedCAProvider) GenerateIntermediate() (string, error) { return m.intermediatePem, nil }
+
+func TestCAManager_Initialize_ProviderVersionTooOld(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc1"
+	delegate := NewMockCAServerDelegate(t, conf)
+	go func() {
+		for range delegate.callbackCh {
+		}
+	}()
+	t.Cleanup(func() { close(delegate.callbackCh) })
+
+	// The state was written by a newer version of the provider.
+	caConf := testCAConfig()
+	caConf.ProviderVersion = 2
+	require.NoError(t, delegate.store.CASetConfig(1, caConf))
+
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	provider := &versionedCAProvider{
+		mockCAProvider: mockCAProvider{
+			callbackCh:      delegate.callbackCh,
+			rootPEM:         delegate.primaryRoot.RootCert,
+			intermediatePem: delegate.primaryRoot.RootCert,
+			signingKey:      testParseSigner(t, delegate.primaryRoot.SigningKey),
+		},
+		version: 1,
+	}
+	manager.providerShim = provider
+
+	err := manager.Initialize()
+	require.True(t, errors.Is(err, ErrProviderVersionTooOld), "unexpected error: %v", err)
+	require.Contains(t, err.Error(), "the state of the mock provider has version 2 but this server only supports up to version 1")
+	require.Equal(t, caStateUninitialized, manager.state)
+	p, _ := manager.getCAProvider()
+	require.Nil(t, p)
+
+	// Once upgraded the provider is configured, and a newer version records
+	// that it now owns the state.
+	provider.version = 3
+	require.NoError(t, manager.Initialize())
+	_, stored, err := delegate.store.CAConfig(nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, stored.ProviderVersion)
+}
+
+// recordingCAEventObserver records the CA events it is notified of.
+type recordingCAEventObserver struct {
+	lock   sync.Mutex
+	events []CAEvent
+}
+
+func (o *recordingCAEventObserver) OnEvent(event CAEvent) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.events = append(o.events, event)
+}
+
+// types returns the types of the recorded events and forgets them.
+func (o *recordingCAEventObserver) types() []CAEventType {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	var types []CAEventType
+	for _, e := range o.events {
+		types = append(types, e.Type)
 	}
+	o.events = nil
+	return types
+}
+
+func TestCAManager_Initialize_EventObserver(t *testing.T) {
+	t.Run("primary", func(t *testing.T) {
+		conf := DefaultConfig()
+		conf.ConnectEnabled = true
+		conf.PrimaryDatacenter = "dc1"
+		conf.Datacenter = "dc1"
+		delegate := NewMockCAServerDelegate(t, conf)
+		go func() {
+			for range delegate.callbackCh {
+			}
+		}()
+		t.Cleanup(func() { close(delegate.callbackCh) })
+
+		newManager := func(observer CAEventObserver) *CAManager {
+			manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+			manager.providerShim = &versionedCAProvider{mockCAProvider: mockCAProvider{
+				callbackCh:      delegate.callbackCh,
+				rootPEM:         delegate.primaryRoot.RootCert,
+				intermediatePem: delegate.primaryRoot.RootCert,
+				signingKey:      testParseSigner(t, delegate.primaryRoot.SigningKey),
+			}}
+			manager.eventObserver = observer
+			return manager
+		}
 
-	caPrivKey, err := rsa.GenerateKey(rand.Reader, 4096)
-	require.NoError(t, err, "failed to generate key")
+		observer := &recordingCAEventObserver{}
+		require.NoError(t, newManager(observer).Initialize())
+		events := observer.events
+		require.Equal(t, []CAEventType{CAEventProviderConfigured, CAEventRootGenerated}, observer.types())
+		_, root, err := delegate.store.CARootActive(nil)
+		require.NoError(t, err)
+		require.Equal(t, "mock", events[1].Provider)
+		require.Equal(t, root.ID, events[1].RootID)
+		require.False(t, events[1].Time.IsZero())
+
+		// A new leader initializing the CA with the stored root doesn't
+		// generate one.
+		require.NoError(t, newManager(observer).Initialize())
+		require.Equal(t, []CAEventType{CAEventProviderConfigured}, observer.types())
+	})
+
+	t.Run("secondary", func(t *testing.T) {
+		conf := DefaultConfig()
+		conf.ConnectEnabled = true
+		conf.PrimaryDatacenter = "dc1"
+		conf.Datacenter = "dc2"
+		delegate := NewMockCAServerDelegate(t, conf)
+		delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+		manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+		manager.providerShim = &mockCAProvider{
+			callbackCh: delegate.callbackCh,
+			rootPEM:    delegate.primaryRoot.RootCert,
+			signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+		}
+		observer := &recordingCAEventObserver{}
+		manager.eventObserver = observer
+
+		initTestManager(t, manager, delegate)
+		require.Equal(t, []CAEventType{CAEventProviderConfigured, CAEventIntermediateRenewed}, observer.types())
+	})
+}
+
+func TestCAManager_Initialize_SecondaryWithoutPrimaryDatacenter(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = ""
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- manager.Initialize()
+	}()
+
+	// Initialize gives up before forwarding anything to the primary.
+	select {
+	case err := <-errCh:
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "primary_datacenter is not set")
+		require.Contains(t, err.Error(), `"dc2"`)
+	case op := <-delegate.callbackCh:
+		t.Fatalf("got unexpected op %q", op)
+	case <-time.After(CATestTimeout):
+		t.Fatal("never got result from errCh")
+	}
+	require.Equal(t, caStateUninitialized, manager.state)
+}
+
+func TestCAManager_Initialize_FailsSelfCheck(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+
+	// The provider loaded a key that doesn't belong to the active
+	// intermediate, so nothing it signs chains to the root.
+	otherKey, _, err := connect.GeneratePrivateKey()
+	require.NoError(t, err)
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: otherKey,
+	}
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- manager.Initialize()
+	}()
+
+	waitForCh(t, delegate.callbackCh, "forwardDC/ConnectCA.Roots")
+	waitForCh(t, delegate.callbackCh, "provider/GenerateIntermediateCSR")
+	waitForCh(t, delegate.callbackCh, "forwardDC/ConnectCA.SignIntermediate")
+	waitForCh(t, delegate.callbackCh, "provider/SetIntermediate")
+	waitForCh(t, delegate.callbackCh, "raftApply/ConnectCA")
+
+	select {
+	case err := <-errCh:
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "CA self-check failed")
+	case <-time.After(CATestTimeout):
+		t.Fatal("never got result from errCh")
+	}
+
+	require.Equal(t, caStateUninitialized, manager.state)
+	_, err = manager.SignCertificate(nil, &connect.SpiffeIDAgent{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "CA is uninitialized")
+}
+
+// countingSignCAProvider is a mockCAProvider which counts the leaves it signs.
+type countingSignCAProvider struct {
+	mockCAProvider
+	signed int32
+}
+
+func (p *countingSignCAProvider) Sign(ctx context.Context, csr *x509.CertificateRequest) (string, error) {
+	atomic.AddInt32(&p.signed, 1)
+	return p.mockCAProvider.Sign(ctx, csr)
+}
+
+func TestCAManager_Initialize_SelfCheckDoesNotSign(t *testing.T) {
+	for _, warmup := range []bool{false, true} {
+		t.Run(fmt.Sprintf("warmup=%t", warmup), func(t *testing.T) {
+			conf := DefaultConfig()
+			conf.ConnectEnabled = true
+			conf.PrimaryDatacenter = "dc1"
+			conf.Datacenter = "dc2"
+			conf.ConnectCAWarmup = warmup
+			delegate := NewMockCAServerDelegate(t, conf)
+			delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+			manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+			provider := &countingSignCAProvider{mockCAProvider: mockCAProvider{
+				callbackCh: delegate.callbackCh,
+				rootPEM:    delegate.primaryRoot.RootCert,
+				signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+			}}
+			manager.providerShim = provider
+			initTestManager(t, manager, delegate)
+
+			// The provider was checked without issuing a leaf that would be
+			// recorded like any other.
+			require.Equal(t, caStateInitialized, manager.state)
+			require.Equal(t, int32(0), atomic.LoadInt32(&provider.signed))
+		})
+	}
+}
+
+func TestCAManager_Initialize_WarmupTimeout(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	conf.ConnectCAWarmup = true
+	conf.ConnectCAWarmupTimeout = 50 * time.Millisecond
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+
+	// The provider hangs when signing, as when its backing CA is unreachable.
+	provider := &slowSignCAProvider{
+		mockCAProvider: &mockCAProvider{
+			callbackCh: delegate.callbackCh,
+			rootPEM:    delegate.primaryRoot.RootCert,
+			signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+		},
+	}
+	release := make(chan struct{})
+	defer close(release)
+	provider.release.Store(release)
+	manager.providerShim = provider
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- manager.Initialize()
+	}()
+
+	waitForCh(t, delegate.callbackCh, "forwardDC/ConnectCA.Roots")
+	waitForCh(t, delegate.callbackCh, "provider/GenerateIntermediateCSR")
+	waitForCh(t, delegate.callbackCh, "forwardDC/ConnectCA.SignIntermediate")
+	waitForCh(t, delegate.callbackCh, "provider/SetIntermediate")
+	waitForCh(t, delegate.callbackCh, "raftApply/ConnectCA")
+
+	select {
+	case err := <-errCh:
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Contains(t, err.Error(), "CA self-check failed: warmup did not complete")
+	case <-time.After(CATestTimeout):
+		t.Fatal("never got result from errCh")
+	}
+
+	// The CA isn't advertised as ready.
+	require.Equal(t, caStateUninitialized, manager.state)
+	_, err := manager.SignCertificate(nil, &connect.SpiffeIDAgent{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "CA is uninitialized")
+}
+
+func TestCAManager_Initialize_Warmup(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	conf.ConnectCAWarmup = true
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+	}
+	initTestManager(t, manager, delegate)
+	require.Equal(t, caStateInitialized, manager.state)
+}
+
+// warmingCAProvider is a mockCAProvider which does a setup before signing the
+// first leaf, either when warmed or when signing.
+type warmingCAProvider struct {
+	mockCAProvider
+	warmCalls int32
+	setups    int32
+	ready     int32
+}
+
+func (p *warmingCAProvider) setup() {
+	if atomic.CompareAndSwapInt32(&p.ready, 0, 1) {
+		atomic.AddInt32(&p.setups, 1)
+	}
+}
+
+func (p *warmingCAProvider) Warm(ctx context.Context) error {
+	atomic.AddInt32(&p.warmCalls, 1)
+	p.setup()
+	return nil
+}
+
+func (p *warmingCAProvider) Sign(ctx context.Context, csr *x509.CertificateRequest) (string, error) {
+	p.setup()
+	return p.mockCAProvider.Sign(ctx, csr)
+}
+
+func TestCAManager_Initialize_WarmsProvider(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	provider := &warmingCAProvider{mockCAProvider: mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+	}}
+	manager.providerShim = provider
+	// Generate the CSR up front as the test root is only valid for a second.
+	spiffeID := connect.TestSpiffeIDService(t, "web")
+	csrPEM, _ := connect.TestCSR(t, spiffeID)
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+	initTestManager(t, manager, delegate)
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&provider.warmCalls))
+	require.Equal(t, int32(1), atomic.LoadInt32(&provider.setups))
+
+	// The first leaf is signed without another setup.
+	_, err = manager.SignCertificate(csr, spiffeID)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&provider.setups))
+}
+
+// failingRootCAProvider is a mockCAProvider that always fails to generate a root.
+type failingRootCAProvider struct {
+	mockCAProvider
+}
+
+func (p *failingRootCAProvider) GenerateRoot() (ca.RootResult, error) {
+	return ca.RootResult{}, fmt.Errorf("provider unreachable")
+}
+
+func TestCAManager_Initialize_Timeout(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc1"
+	delegate := NewMockCAServerDelegate(t, conf)
+	caConf := testCAConfig()
+	caConf.Config["InitializationTimeout"] = "300ms"
+	require.NoError(t, delegate.store.CASetConfig(2, caConf))
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &failingRootCAProvider{mockCAProvider: mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+	}}
+
+	// Initialize makes a single attempt, leader establishment doesn't wait
+	// for the retries.
+	err := manager.Initialize()
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrCAInitializationFailed)
+	require.Contains(t, err.Error(), "provider unreachable")
+
+	start := time.Now()
+	err = manager.retryInitialize(context.Background(), start.Add(300*time.Millisecond), 300*time.Millisecond)
+	require.Less(t, time.Since(start), 2*time.Second)
+	require.ErrorIs(t, err, ErrCAInitializationFailed)
+	require.Contains(t, err.Error(), "within the InitializationTimeout of 300ms")
+	require.Contains(t, err.Error(), "provider unreachable")
+	require.Equal(t, caStateUninitialized, manager.state)
+
+	// The retries stop as soon as leadership is lost.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start = time.Now()
+	err = manager.retryInitialize(ctx, start.Add(time.Hour), time.Hour)
+	require.Less(t, time.Since(start), 2*time.Second)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// The background initialization gives up after the timeout, counted from
+	// the first attempt.
+	start = time.Now()
+	require.NoError(t, manager.backgroundCAInitialization(context.Background(), start))
+	require.Less(t, time.Since(start), 2*time.Second)
+	require.Equal(t, caStateUninitialized, manager.state)
+}
+
+// asyncIntermediateCAProvider is a mockCAProvider for the primary datacenter
+// whose intermediate is signed asynchronously, after pending polls.
+type asyncIntermediateCAProvider struct {
+	mockCAProvider
+	pending   int
+	submitted []string
+	polls     int
+}
+
+func (p *asyncIntermediateCAProvider) GenerateIntermediate() (string, error) {
+	return "", fmt.Errorf("GenerateIntermediate must not be called")
+}
+
+func (p *asyncIntermediateCAProvider) SubmitIntermediate() (string, error) {
+	handle := fmt.Sprintf("order-%d", len(p.submitted)+1)
+	p.submitted = append(p.submitted, handle)
+	return handle, nil
+}
+
+func (p *asyncIntermediateCAProvider) PollIntermediate(handle string) (string, bool, error) {
+	if handle != p.submitted[len(p.submitted)-1] {
+		return "", false, fmt.Errorf("unknown handle %q", handle)
+	}
+	p.polls++
+	if p.polls <= p.pending {
+		return "", false, nil
+	}
+	return p.rootPEM, true, nil
+}
+
+func TestCAManager_Initialize_AsyncIntermediate(t *testing.T) {
+	origWait := intermediatePollWait
+	intermediatePollWait = 10 * time.Millisecond
+	t.Cleanup(func() { intermediatePollWait = origWait })
+
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc1"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.primaryRoot = connect.TestCA(t, nil)
+	go func() {
+		for range delegate.callbackCh {
+		}
+	}()
+	t.Cleanup(func() { close(delegate.callbackCh) })
+
+	newProvider := func(pending int) *asyncIntermediateCAProvider {
+		return &asyncIntermediateCAProvider{
+			mockCAProvider: mockCAProvider{
+				callbackCh: delegate.callbackCh,
+				rootPEM:    delegate.primaryRoot.RootCert,
+				signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+			},
+			pending: pending,
+		}
+	}
+
+	t.Run("signed after polling", func(t *testing.T) {
+		provider := newProvider(2)
+		manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+		manager.providerShim = provider
+		require.NoError(t, manager.Initialize())
+
+		require.Equal(t, []string{"order-1"}, provider.submitted)
+		require.Equal(t, 3, provider.polls)
+		_, root := manager.getCAProvider()
+		require.NotNil(t, root)
+		require.Equal(t, delegate.primaryRoot.RootCert, root.RootCert)
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		provider := newProvider(math.MaxInt32)
+		manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := manager.generateIntermediate(ctx, provider)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Contains(t, err.Error(), `intermediate cert "order-1"`)
+		require.Greater(t, provider.polls, 1)
+	})
+}
+
+// largeStateCAProvider is a mockCAProvider for the primary datacenter whose
+// state includes a large blob.
+type largeStateCAProvider struct {
+	mockCAProvider
+	state           map[string]string
+	configuredState map[string]string
+}
+
+func (p *largeStateCAProvider) Configure(cfg ca.ProviderConfig) error {
+	p.configuredState = cfg.State
+	return nil
+}
+func (p *largeStateCAProvider) State() (map[string]string, error) { return p.state, nil }
+func (p *largeStateCAProvider) GenerateIntermediate() (string, error) {
+	return p.rootPEM, nil
+}
+
+// mapProviderStateStore is a ProviderStateStore that keeps values in memory.
+type mapProviderStateStore map[string]string
+
+func (m mapProviderStateStore) Put(provider, rootID, key, value string) (string, bool, error) {
+	ref := provider + "/" + rootID + "/" + key
+	m[ref] = value
+	return ref, true, nil
+}
+
+func (m mapProviderStateStore) Get(ref string) (string, error) {
+	value, ok := m[ref]
+	if !ok {
+		return "", fmt.Errorf("no value for %q", ref)
+	}
+	return value, nil
+}
+
+func TestCAManager_Initialize_ExternalProviderState(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc1"
+	delegate := NewMockCAServerDelegate(t, conf)
+	go func() {
+		for range delegate.callbackCh {
+		}
+	}()
+	t.Cleanup(func() { close(delegate.callbackCh) })
+
+	blob := strings.Repeat("x", 2*defaultProviderStateSizeThreshold)
+	store := mapProviderStateStore{}
+	newManager := func() (*CAManager, *largeStateCAProvider) {
+		provider := &largeStateCAProvider{
+			mockCAProvider: mockCAProvider{
+				callbackCh: delegate.callbackCh,
+				rootPEM:    delegate.primaryRoot.RootCert,
+				signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+			},
+			state: map[string]string{"blob": blob, "small": "value"},
+		}
+		manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+		manager.providerShim = provider
+		manager.providerStateStore = store
+		return manager, provider
+	}
+
+	manager, _ := newManager()
+	require.NoError(t, manager.Initialize())
+
+	// Only the large value is kept outside of raft.
+	_, config, err := delegate.store.CAConfig(nil)
+	require.NoError(t, err)
+	ref := "mock/" + delegate.primaryRoot.ID + "/blob"
+	require.Equal(t, map[string]string{"small": "value"}, config.State)
+	require.Equal(t, map[string]string{"blob": ref}, config.StateRefs)
+	require.Equal(t, blob, store[ref])
+
+	// A new leader configures its provider with the original value.
+	manager, provider := newManager()
+	require.NoError(t, manager.Initialize())
+	require.Equal(t, map[string]string{"blob": blob, "small": "value"}, provider.configuredState)
+}
+
+// externalRootCAProvider is a mockCAProvider for the primary datacenter that
+// acts as an issuing CA under an external root.
+type externalRootCAProvider struct {
+	mockCAProvider
+	externalRootPEM string
+}
+
+func (p *externalRootCAProvider) GenerateRoot() (ca.RootResult, error) {
+	return ca.RootResult{PEM: p.rootPEM, ExternalRootCert: p.externalRootPEM}, nil
+}
+func (p *externalRootCAProvider) GenerateIntermediate() (string, error) { return p.rootPEM, nil }
+func (p *externalRootCAProvider) PrimaryUsesIntermediate()              {}
+
+func TestCAManager_Initialize_ExternalRoot(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc1"
+	delegate := NewMockCAServerDelegate(t, conf)
+	go func() {
+		for range delegate.callbackCh {
+		}
+	}()
+	t.Cleanup(func() { close(delegate.callbackCh) })
+
+	// The primary CA is an issuing CA signed by an external root.
+	externalRoot := connect.TestCA(t, nil)
+	externalCert, err := connect.ParseCert(externalRoot.RootCert)
+	require.NoError(t, err)
+	issuingKey, _, err := connect.GeneratePrivateKey()
+	require.NoError(t, err)
+	issuing, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "issuing"},
+		URIs:                  externalCert.URIs,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+	}, externalCert, issuingKey.Public(), testParseSigner(t, externalRoot.SigningKey))
+	require.NoError(t, err)
+	issuingPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issuing}))
+
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &externalRootCAProvider{
+		mockCAProvider: mockCAProvider{
+			callbackCh: delegate.callbackCh,
+			rootPEM:    issuingPEM,
+			signingKey: issuingKey,
+		},
+		externalRootPEM: externalRoot.RootCert,
+	}
+	require.NoError(t, manager.Initialize())
+
+	// The external root is published as the trust anchor and the issuing CA
+	// signs the leaves.
+	_, root, err := delegate.store.CARootActive(nil)
+	require.NoError(t, err)
+	require.Equal(t, externalRoot.RootCert, root.RootCert)
+	require.Equal(t, connect.CalculateCertFingerprint(externalCert.Raw), root.ID)
+	require.Equal(t, []string{issuingPEM}, root.IntermediateCerts)
+	require.Equal(t, connect.EncodeSigningKeyID([]byte{1, 2, 3, 4}), root.SigningKeyID)
+}
+
+func TestCAManager_Refresh(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc1"
+	delegate := NewMockCAServerDelegate(t, conf)
+	go func() {
+		for range delegate.callbackCh {
+		}
+	}()
+	t.Cleanup(func() { close(delegate.callbackCh) })
+
+	provider := &largeStateCAProvider{
+		mockCAProvider: mockCAProvider{
+			callbackCh: delegate.callbackCh,
+			rootPEM:    delegate.primaryRoot.RootCert,
+			signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+		},
+		state: map[string]string{"key": "before"},
+	}
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = provider
+	require.NoError(t, manager.Initialize())
+	_, root := manager.getCAProvider()
+
+	// Change the provider state underneath the manager.
+	idx, config, err := delegate.store.CAConfig(nil)
+	require.NoError(t, err)
+	updated := *config
+	updated.State = map[string]string{"key": "after"}
+	require.NoError(t, delegate.store.CASetConfig(idx+1, &updated))
+
+	require.NoError(t, manager.Refresh())
+	require.Equal(t, map[string]string{"key": "after"}, provider.configuredState)
+	require.Equal(t, caStateInitialized, manager.state)
+
+	// The active root was not rotated.
+	_, refreshedRoot := manager.getCAProvider()
+	require.Equal(t, root.ID, refreshedRoot.ID)
+	_, activeRoot, err := delegate.store.CARootActive(nil)
+	require.NoError(t, err)
+	require.Equal(t, root.ID, activeRoot.ID)
+
+	// Refreshing again is a no-op.
+	require.NoError(t, manager.Refresh())
+	require.Equal(t, map[string]string{"key": "after"}, provider.configuredState)
+}
+
+func TestCAManager_UpdateProviderCredentials_Invalid(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	_, s1 := testServer(t)
+	defer s1.Shutdown()
+	testrpc.WaitForActiveCARoot(t, s1.RPC, "dc1", nil)
+
+	err := s1.caManager.UpdateProviderCredentials(map[string]interface{}{"Token": "secret"})
+	require.EqualError(t, err, "the consul CA provider has no credentials that can be updated")
+
+	// The CA is left initialized.
+	require.Equal(t, caStateInitialized, s1.caManager.state)
+}
+
+func TestCAManager_IntermediateRenewalWait(t *testing.T) {
+	caPrivKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	now := time.Now().Truncate(time.Second)
+	rootPEM := generateCertPEM(t, caPrivKey, now.Add(-time.Hour), now.AddDate(1, 0, 0))
+
+	tests := map[string]struct {
+		notAfter time.Time
+		elapsed  time.Duration
+		expected time.Duration
+	}{
+		// The configured IntermediateCertTTL is 2160h, but the intermediate
+		// was issued for less.
+		"shorter than requested": {
+			notAfter: now.Add(30 * time.Minute),
+			expected: 15 * time.Minute,
+		},
+		"shorter than requested and partly elapsed": {
+			notAfter: now.Add(30 * time.Minute),
+			elapsed:  10 * time.Minute,
+			expected: 5 * time.Minute,
+		},
+		"past half its lifetime": {
+			notAfter: now.Add(30 * time.Minute),
+			elapsed:  20 * time.Minute,
+			expected: structs.IntermediateCertRenewInterval,
+		},
+		"as requested": {
+			notAfter: now.Add(2160 * time.Hour),
+			expected: structs.IntermediateCertRenewInterval,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			intermediatePEM := generateCertPEM(t, caPrivKey, now, tc.notAfter)
+
+			conf := DefaultConfig()
+			conf.ConnectEnabled = true
+			conf.PrimaryDatacenter = "dc1"
+			conf.Datacenter = "dc2"
+			delegate := NewMockCAServerDelegate(t, conf)
+			delegate.primaryRoot.RootCert = rootPEM
+			delegate.secondaryIntermediate = intermediatePEM
+			allowSingleTierCA(t, delegate)
+			manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+			manager.providerShim = &mockCAProvider{
+				callbackCh:      delegate.callbackCh,
+				rootPEM:         rootPEM,
+				intermediatePem: intermediatePEM,
+				signingKey:      caPrivKey,
+			}
+			initTestManager(t, manager, delegate)
+
+			manager.timeNow = func() time.Time { return now.Add(tc.elapsed) }
+			require.Equal(t, tc.expected, manager.intermediateRenewalWait(false))
+		})
+	}
+}
+
+func TestCAManager_UpdateConfigWhileRenewIntermediate(t *testing.T) {
+
+	// No parallel execution because we change globals
+	patchIntermediateCertRenewInterval(t)
+
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+	}
+	initTestManager(t, manager, delegate)
+
+	// Simulate Wait half the TTL for the cert to need renewing.
+	manager.timeNow = func() time.Time {
+		return time.Now().Add(500 * time.Millisecond)
+	}
+
+	// Call RenewIntermediate and then confirm the RPCs and provider calls
+	// happen in the expected order.
+	errCh := make(chan error)
+	go func() {
+		errCh <- manager.RenewIntermediate(context.TODO(), false)
+	}()
+
+	waitForCh(t, delegate.callbackCh, "provider/GenerateIntermediateCSR")
+
+	// Call UpdateConfiguration while RenewIntermediate is still in-flight to
+	// make sure we get an error about the state being occupied.
+	go func() {
+		require.EqualValues(t, caStateRenewIntermediate, manager.state)
+		require.Error(t, errors.New("already in state"), manager.UpdateConfiguration(&structs.CARequest{}))
+	}()
+
+	waitForCh(t, delegate.callbackCh, "forwardDC/ConnectCA.SignIntermediate")
+	waitForCh(t, delegate.callbackCh, "provider/SetIntermediate")
+	waitForCh(t, delegate.callbackCh, "raftApply/ConnectCA")
+	waitForEmptyCh(t, delegate.callbackCh)
+
+	// Make sure the RenewIntermediate call returned successfully.
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(CATestTimeout):
+		t.Fatal("never got result from errCh")
+	}
+
+	require.EqualValues(t, caStateInitialized, manager.state)
+}
+
+func TestCAManager_SignCertificate_ProviderDiverged(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.primaryRoot = connect.TestCA(t, nil)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	provider := &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+	}
+	manager.providerShim = provider
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	csrPEM, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "web"))
+	initTestManager(t, manager, delegate)
+
+	sign := func() error {
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		_, err = manager.SignCertificate(csr, connect.TestSpiffeIDService(t, "web"))
+		return err
+	}
+	require.NoError(t, sign())
+	require.Len(t, manager.reconcileCh, 0)
+
+	// The provider now signs with an intermediate from a different root.
+	provider.intermediatePem = generateCertPEM(t, otherKey, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	provider.signingKey = otherKey
+	// Expire the previous successful check.
+	manager.providerCheckedAt = time.Time{}
+
+	err = sign()
+	require.ErrorIs(t, err, ErrCAProviderDiverged)
+	require.Len(t, manager.reconcileCh, 1)
+}
+
+func TestCAManager_Initialize_RepairsLeafSigningCert(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherCert := generateCertPEM(t, otherKey, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+
+	tests := map[string]func(root *structs.CARoot){
+		"no intermediates": func(root *structs.CARoot) {
+			root.IntermediateCerts = nil
+		},
+		"mismatched signing cert": func(root *structs.CARoot) {
+			root.IntermediateCerts = []string{otherCert}
+		},
+		"mismatched signing key id": func(root *structs.CARoot) {
+			root.IntermediateCerts = []string{root.RootCert}
+			root.SigningKeyID = "00:11:22"
+		},
+	}
+	for name, breakRoot := range tests {
+		t.Run(name, func(t *testing.T) {
+			conf := DefaultConfig()
+			conf.ConnectEnabled = true
+			conf.PrimaryDatacenter = "dc1"
+			conf.Datacenter = "dc2"
+			delegate := NewMockCAServerDelegate(t, conf)
+			delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+			manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+			manager.providerShim = &mockCAProvider{
+				callbackCh: delegate.callbackCh,
+				rootPEM:    delegate.primaryRoot.RootCert,
+				signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+			}
+			csrPEM, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "web"))
+
+			// Store the active root of the primary as if a partial restore
+			// lost its leaf signing cert.
+			rootCert, err := connect.ParseCert(delegate.primaryRoot.RootCert)
+			require.NoError(t, err)
+			signingKeyID := connect.EncodeSigningKeyID(rootCert.SubjectKeyId)
+			root := *delegate.primaryRoot
+			root.SigningKeyID = signingKeyID
+			breakRoot(&root)
+			ok, err := delegate.store.CARootSetCAS(2, 0, []*structs.CARoot{&root})
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			initTestManager(t, manager, delegate)
+
+			_, activeRoot, err := delegate.store.CARootActive(nil)
+			require.NoError(t, err)
+			require.Equal(t, delegate.primaryRoot.RootCert, manager.getLeafSigningCertFromRoot(activeRoot))
+			require.Equal(t, signingKeyID, activeRoot.SigningKeyID)
+
+			csr, err := connect.ParseCSR(csrPEM)
+			require.NoError(t, err)
+			_, err = manager.SignCertificate(csr, connect.TestSpiffeIDService(t, "web"))
+			require.NoError(t, err)
+		})
+	}
+}
+
+// slowSignCAProvider is a mockCAProvider whose Sign and VerifySigningKey block
+// until release is closed, once release is set.
+type slowSignCAProvider struct {
+	*mockCAProvider
+	release atomic.Value
+}
+
+func (p *slowSignCAProvider) VerifySigningKey(ctx context.Context) error {
+	if release, ok := p.release.Load().(chan struct{}); ok {
+		<-release
+	}
+	return p.mockCAProvider.VerifySigningKey(ctx)
+}
+
+func (p *slowSignCAProvider) Sign(ctx context.Context, csr *x509.CertificateRequest) (string, error) {
+	if release, ok := p.release.Load().(chan struct{}); ok {
+		<-release
+	}
+	return p.mockCAProvider.Sign(ctx, csr)
+}
+
+func TestCAManager_SignCertificate_ProviderTimeout(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.primaryRoot = connect.TestCA(t, nil)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	provider := &slowSignCAProvider{
+		mockCAProvider: &mockCAProvider{
+			callbackCh: delegate.callbackCh,
+			rootPEM:    delegate.primaryRoot.RootCert,
+			signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+		},
+	}
+	manager.providerShim = provider
+	csrPEM, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "web"))
+	initTestManager(t, manager, delegate)
+	release := make(chan struct{})
+	provider.release.Store(release)
+
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = manager.SignCertificateWithContext(ctx, csr, connect.TestSpiffeIDService(t, "web"), structs.CAChainOrderLeafFirst, nil)
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorIs(t, err, ErrSignTimeout)
+	require.NotErrorIs(t, err, ErrRateLimited)
+	require.Equal(t, ErrSignTimeout.Error(), err.Error())
+
+	// The abandoned call must not record a certificate once it completes.
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	active, _ := manager.leaves.prune(time.Now(), time.Hour)
+	require.Equal(t, 0, active)
+}
+
+// contextSignCAProvider is a mockCAProvider whose Sign waits for its context
+// to be done once stuck is set, like a provider stuck on a remote CA, and
+// then reports the error of the context on signErr.
+type contextSignCAProvider struct {
+	*mockCAProvider
+	stuck   int32
+	signErr chan error
+}
+
+func (p *contextSignCAProvider) Sign(ctx context.Context, csr *x509.CertificateRequest) (string, error) {
+	if atomic.LoadInt32(&p.stuck) == 0 {
+		return p.mockCAProvider.Sign(ctx, csr)
+	}
+	<-ctx.Done()
+	p.signErr <- ctx.Err()
+	return "", ctx.Err()
+}
+
+func TestCAManager_SignCertificate_ProviderContext(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.primaryRoot = connect.TestCA(t, nil)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	provider := &contextSignCAProvider{
+		mockCAProvider: &mockCAProvider{
+			callbackCh: delegate.callbackCh,
+			rootPEM:    delegate.primaryRoot.RootCert,
+			signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+		},
+		signErr: make(chan error, 1),
+	}
+	manager.providerShim = provider
+	csrPEM, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "web"))
+	initTestManager(t, manager, delegate)
+	atomic.StoreInt32(&provider.stuck, 1)
+
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+
+	// Cancel the request while the provider is signing.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err = manager.SignCertificateWithContext(ctx, csr, connect.TestSpiffeIDService(t, "web"), structs.CAChainOrderLeafFirst, nil)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// The provider was given the context of the request, so it stopped
+	// signing as well.
+	select {
+	case err := <-provider.signErr:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("the provider didn't see the context of the request canceled")
+	}
+}
+
+// optionsCAProvider is a mockCAProvider accepting a "Tag" sign option, which
+// records the options it was last asked to sign with.
+type optionsCAProvider struct {
+	*mockCAProvider
+	options map[string]string
+}
+
+func (p *optionsCAProvider) SignOptions() []string {
+	return []string{"Tag"}
+}
+
+func (p *optionsCAProvider) SignWithOptions(ctx context.Context, csr *x509.CertificateRequest, options map[string]string) (string, error) {
+	p.options = options
+	return p.mockCAProvider.Sign(ctx, csr)
+}
+
+func TestCAManager_SignCertificate_ProviderSignOptions(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	mock := &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+	}
+	provider := &optionsCAProvider{mockCAProvider: mock}
+	manager.providerShim = provider
+	initTestManager(t, manager, delegate)
+
+	sign := func(options map[string]string) error {
+		csrPEM, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "web"))
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		ctx := WithProviderSignOptions(context.Background(), options)
+		_, err = manager.SignCertificateWithContext(ctx, csr, connect.TestSpiffeIDService(t, "web"), structs.CAChainOrderLeafFirst, nil)
+		return err
+	}
+
+	require.NoError(t, sign(map[string]string{"Tag": "team=payments"}))
+	require.Equal(t, map[string]string{"Tag": "team=payments"}, provider.options)
+
+	err := sign(map[string]string{"Tag": "team=payments", "Label": "blue"})
+	require.ErrorIs(t, err, ErrUnknownSignOption)
+	require.Contains(t, err.Error(), `"Label"`)
+
+	// Providers without sign options, like the built-in one, refuse them all.
+	manager.setCAProvider(mock, manager.providerRoot)
+	require.ErrorIs(t, sign(map[string]string{"Tag": "team=payments"}), ErrUnknownSignOption)
+	require.NoError(t, sign(nil))
+}
+
+func TestCAManager_RotationReason(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+
+	_, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+	})
+	defer s1.Shutdown()
+	testrpc.WaitForActiveCARoot(t, s1.RPC, "dc1", nil)
+
+	requireReason := func(t *testing.T, expected structs.CARotationReason) {
+		t.Helper()
+		_, root, err := s1.fsm.State().CARootActive(nil)
+		require.NoError(t, err)
+		require.Equal(t, expected, root.RotationReason)
+
+		_, history, err := s1.fsm.State().CARootHistory(nil)
+		require.NoError(t, err)
+		for _, entry := range history {
+			if entry.ID == root.ID {
+				require.Equal(t, expected, entry.RotationReason)
+				return
+			}
+		}
+		t.Fatalf("active root %s is missing from the history", root.ID)
+	}
+
+	// The first root didn't replace anything.
+	requireReason(t, "")
+
+	require.NoError(t, s1.caManager.EmergencyRotateRoot(context.Background()))
+	requireReason(t, structs.CARotationReasonEmergency)
+
+	_, conf, err := s1.fsm.State().CAConfig(nil)
+	require.NoError(t, err)
+	_, newKey, err := connect.GeneratePrivateKey()
+	require.NoError(t, err)
+	newConf := *conf
+	newConf.Config = map[string]interface{}{
+		"PrivateKey":          newKey,
+		"RootCert":            "",
+		"IntermediateCertTTL": 288 * time.Hour,
+	}
+	require.NoError(t, s1.caManager.UpdateConfiguration(&structs.CARequest{Config: &newConf}))
+	requireReason(t, structs.CARotationReasonConfigChange)
+
+	newConf.Config = map[string]interface{}{
+		"PrivateKeyType":      "rsa",
+		"PrivateKeyBits":      2048,
+		"IntermediateCertTTL": 288 * time.Hour,
+	}
+	require.NoError(t, s1.caManager.UpdateConfiguration(&structs.CARequest{Config: &newConf}))
+	requireReason(t, structs.CARotationReasonKeyTypeChange)
+}
+
+func TestCAManager_ProviderDeps_DeterministicLeaf(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+
+	_, conf1 := testServerConfig(t)
+	now := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	deps := newDefaultDeps(t, conf1)
+	deps.CAProviderDeps = ca.ProviderDeps{
+		Clock:        func() time.Time { return now },
+		SerialNumber: func() (uint64, error) { return 42, nil },
+	}
+
+	s1, err := NewServer(conf1, deps)
+	require.NoError(t, err)
+	defer s1.Shutdown()
+	testrpc.WaitForActiveCARoot(t, s1.RPC, "dc1", nil)
+
+	_, conf, err := s1.fsm.State().CAConfig(nil)
+	require.NoError(t, err)
+	newConf := *conf
+	newConf.Config = map[string]interface{}{
+		"LeafCertTTL":         "72h",
+		"IntermediateCertTTL": "288h",
+		"PrivateKeyType":      "rsa",
+		"PrivateKeyBits":      2048,
+	}
+	require.NoError(t, s1.caManager.UpdateConfiguration(&structs.CARequest{Config: &newConf}))
+
+	csrPEM, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "web"))
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+	cert, err := s1.caManager.SignCertificate(csr, connect.TestSpiffeIDService(t, "web"))
+	require.NoError(t, err)
+
+	leaf, err := connect.ParseCert(cert.CertPEM)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), leaf.SerialNumber.Int64())
+	require.Equal(t, now.Add(-time.Minute), leaf.NotBefore)
+	require.Equal(t, now.Add(-time.Minute).Add(72*time.Hour), leaf.NotAfter)
+}
+
+func TestCAManager_SignCertificate_RenewalOverlap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+
+	_, conf1 := testServerConfig(t)
+
+	// The clock of the provider runs ahead of the one of the manager, as if
+	// it were skewed.
+	var lock sync.Mutex
+	now := time.Now()
+	deps := newDefaultDeps(t, conf1)
+	deps.CAProviderDeps = ca.ProviderDeps{
+		Clock: func() time.Time {
+			lock.Lock()
+			defer lock.Unlock()
+			return now
+		},
+	}
+	setClock := func(t time.Time) {
+		lock.Lock()
+		defer lock.Unlock()
+		now = t
+	}
+
+	s1, err := NewServer(conf1, deps)
+	require.NoError(t, err)
+	defer s1.Shutdown()
+	testrpc.WaitForActiveCARoot(t, s1.RPC, "dc1", nil)
+
+	_, conf, err := s1.fsm.State().CAConfig(nil)
+	require.NoError(t, err)
+	newConf := *conf
+	newConf.Config = map[string]interface{}{
+		"LeafCertTTL":         "1h",
+		"IntermediateCertTTL": "288h",
+		"PrivateKeyType":      "rsa",
+		"PrivateKeyBits":      2048,
+		"LeafRenewalOverlap":  "10m",
+	}
+	require.NoError(t, s1.caManager.UpdateConfiguration(&structs.CARequest{Config: &newConf}))
+
+	sign := func(t *testing.T, service string) *x509.Certificate {
+		t.Helper()
+		spiffeID := connect.TestSpiffeIDService(t, service)
+		csrPEM, _ := connect.TestCSR(t, spiffeID)
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		cert, err := s1.caManager.SignCertificate(csr, spiffeID)
+		require.NoError(t, err)
+		leaf, err := connect.ParseCert(cert.CertPEM)
+		require.NoError(t, err)
+		return leaf
+	}
+
+	first := sign(t, "web")
+
+	// Back to back renewals right as the previous leaf expires for the
+	// provider still overlap by LeafRenewalOverlap.
+	prev := first
+	for i := 0; i < 3; i++ {
+		setClock(prev.NotAfter.Add(time.Minute))
+		renewed := sign(t, "web")
+		require.Equal(t, prev.NotAfter.Add(-10*time.Minute), renewed.NotBefore)
+		require.True(t, renewed.NotAfter.After(prev.NotAfter))
+		prev = renewed
+	}
+
+	// Other identities don't have a previous leaf to overlap with.
+	setClock(prev.NotAfter.Add(time.Minute))
+	other := sign(t, "db")
+	require.Equal(t, prev.NotAfter, other.NotBefore)
+}
+
+func TestCAManager_LeafInventoryMetrics(t *testing.T) {
+	// No parallel execution because we change the global metrics sink.
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	cfg := metrics.DefaultConfig("consul.test")
+	cfg.EnableHostname = false
+	cfg.EnableRuntimeMetrics = false
+	metrics.NewGlobal(cfg, sink)
+	t.Cleanup(func() {
+		metrics.NewGlobal(cfg, &metrics.BlackholeSink{})
+	})
+
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	conf.ConnectLeafExpiringSoonHorizon = 30 * time.Minute
+	delegate := NewMockCAServerDelegate(t, conf)
+	// The default root of the mock expires after a second, which can be before
+	// the leaves are signed.
+	delegate.primaryRoot = connect.TestCA(t, nil)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+	}
+	var csrs []*x509.CertificateRequest
+	for i := 0; i < 3; i++ {
+		csrPEM, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "web"))
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		csrs = append(csrs, csr)
+	}
+	initTestManager(t, manager, delegate)
+
+	// The mock provider signs leaves for an hour.
+	for _, csr := range csrs {
+		_, err := manager.SignCertificate(csr, connect.TestSpiffeIDService(t, "web"))
+		require.NoError(t, err)
+	}
+
+	requireGauges := func(t *testing.T, active, expiringSoon float32) {
+		t.Helper()
+		manager.emitLeafInventoryMetrics()
+		intervals := sink.Data()
+		require.NotEmpty(t, intervals)
+		gauges := intervals[len(intervals)-1].Gauges
+		require.Equal(t, active, gauges["consul.test.connect.ca.leaves.active"].Value)
+		require.Equal(t, expiringSoon, gauges["consul.test.connect.ca.leaves.expiring_soon"].Value)
+	}
+
+	now := time.Now()
+	requireGauges(t, 3, 0)
+
+	manager.timeNow = func() time.Time { return now.Add(45 * time.Minute) }
+	requireGauges(t, 3, 3)
+
+	// Expired leaves are pruned from the inventory.
+	manager.timeNow = func() time.Time { return now.Add(2 * time.Hour) }
+	requireGauges(t, 0, 0)
+	require.Empty(t, manager.leaves.leaves)
+}
+
+type usageCAProvider struct {
+	*mockCAProvider
+	issued, quota int64
+}
+
+func (m *usageCAProvider) Usage() (int64, int64, error) {
+	return m.issued, m.quota, nil
+}
+
+func TestCAManager_ProviderUsageMetrics(t *testing.T) {
+	// No parallel execution because we change the global metrics sink.
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	cfg := metrics.DefaultConfig("consul.test")
+	cfg.EnableHostname = false
+	cfg.EnableRuntimeMetrics = false
+	metrics.NewGlobal(cfg, sink)
+	t.Cleanup(func() {
+		metrics.NewGlobal(cfg, &metrics.BlackholeSink{})
+	})
+
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.primaryRoot = connect.TestCA(t, nil)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	provider := &usageCAProvider{
+		mockCAProvider: &mockCAProvider{
+			callbackCh: delegate.callbackCh,
+			rootPEM:    delegate.primaryRoot.RootCert,
+			signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+		},
+		issued: 42,
+		quota:  1000,
+	}
+	manager.providerShim = provider
+	initTestManager(t, manager, delegate)
+	_, providerRoot := manager.getCAProvider()
+
+	gauges := func() map[string]metrics.GaugeValue {
+		manager.emitProviderUsageMetrics()
+		intervals := sink.Data()
+		require.NotEmpty(t, intervals)
+		return intervals[len(intervals)-1].Gauges
+	}
+
+	// Providers not reporting their usage get no usage metrics.
+	manager.setCAProvider(provider.mockCAProvider, providerRoot)
+	require.NotContains(t, gauges(), "consul.test.connect.ca.provider.issued")
+	health, err := manager.Health()
+	require.NoError(t, err)
+	require.False(t, health.ProviderUsageReported)
+
+	// The usage reported by the provider, like the PCA CloudWatch metrics,
+	// is emitted along with what its quota has left.
+	manager.setCAProvider(provider, providerRoot)
+	g := gauges()
+	require.Equal(t, float32(42), g["consul.test.connect.ca.provider.issued"].Value)
+	require.Equal(t, float32(958), g["consul.test.connect.ca.provider.quota_remaining"].Value)
+
+	health, err = manager.Health()
+	require.NoError(t, err)
+	require.True(t, health.ProviderUsageReported)
+	require.Equal(t, int64(42), health.ProviderIssued)
+	require.Equal(t, int64(1000), health.ProviderQuota)
+}
+
+func TestCAManager_CAExpiryMetrics(t *testing.T) {
+	// No parallel execution because we change the global metrics sink.
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	cfg := metrics.DefaultConfig("consul.test")
+	cfg.EnableHostname = false
+	cfg.EnableRuntimeMetrics = false
+	metrics.NewGlobal(cfg, sink)
+	t.Cleanup(func() {
+		metrics.NewGlobal(cfg, &metrics.BlackholeSink{})
+	})
+
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.primaryRoot = connect.TestCA(t, nil)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+	}
+	initTestManager(t, manager, delegate)
+
+	now := time.Now()
+	manager.timeNow = func() time.Time { return now }
+
+	gauges := func(t require.TestingT) (root, intermediate float32) {
+		intervals := sink.Data()
+		require.NotEmpty(t, intervals)
+		g := intervals[len(intervals)-1].Gauges
+		return g["consul.test.connect.ca.root.expiry"].Value, g["consul.test.connect.ca.intermediate.expiry"].Value
+	}
+	intermediate, err := connect.ParseCert(delegate.secondaryIntermediate)
+	require.NoError(t, err)
+	_, activeRoot, err := delegate.State().CARootActive(nil)
+	require.NoError(t, err)
+
+	manager.emitCAExpiryMetrics(nil)
+	rootExpiry, intermediateExpiry := gauges(t)
+	require.InEpsilon(t, activeRoot.NotAfter.Sub(now).Seconds(), rootExpiry, 1e-6)
+	require.InEpsilon(t, intermediate.NotAfter.Sub(now).Seconds(), intermediateExpiry, 1e-6)
+
+	// The gauges count down as time passes.
+	manager.timeNow = func() time.Time { return now.Add(time.Hour) }
+	manager.emitCAExpiryMetrics(nil)
+	laterRootExpiry, laterIntermediateExpiry := gauges(t)
+	require.Less(t, laterRootExpiry, rootExpiry)
+	require.Less(t, laterIntermediateExpiry, intermediateExpiry)
+	// The gauges are float32, which only keep ten years to about a minute.
+	require.InDelta(t, intermediateExpiry-3600, laterIntermediateExpiry, 64)
+
+	// The routine updates the gauges when the root rotates, without leaving
+	// the expiry of the previous root behind.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, manager.runCAExpiryMetrics(ctx))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	newRoot := connect.TestCAWithTTL(t, nil, 48*time.Hour)
+	newRoot.IntermediateCerts = []string{newRoot.RootCert}
+	oldRoot := activeRoot.Clone()
+	oldRoot.Active = false
+	idx, _, err := delegate.State().CARoots(nil)
+	require.NoError(t, err)
+	ok, err := delegate.State().CARootSetCAS(idx+1, idx, structs.CARoots{oldRoot, newRoot})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	want := float32(newRoot.NotAfter.Sub(now.Add(time.Hour)).Seconds())
+	retry.Run(t, func(r *retry.R) {
+		rootExpiry, intermediateExpiry := gauges(r)
+		require.InDelta(r, want, rootExpiry, 1)
+		require.InDelta(r, want, intermediateExpiry, 1)
+	})
+
+	// Followers report NaN rather than what they saw as the leader.
+	cancel()
+	<-done
+	rootExpiry, intermediateExpiry = gauges(t)
+	require.True(t, math.IsNaN(float64(rootExpiry)))
+	require.True(t, math.IsNaN(float64(intermediateExpiry)))
+}
+
+type recordingPostSignHook struct {
+	err    error
+	issued []*structs.IssuedCert
+	ids    []connect.CertURI
+}
+
+func (h *recordingPostSignHook) PostSign(issued *structs.IssuedCert, id connect.CertURI) error {
+	h.issued = append(h.issued, issued)
+	h.ids = append(h.ids, id)
+	return h.err
+}
+
+func TestCAManager_SignCertificate_PostSignHook(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+	}
+	hook := &recordingPostSignHook{}
+	manager.postSignHook = hook
+	// Generate the CSRs up front as the test root is only valid for a second.
+	spiffeID := connect.TestSpiffeIDService(t, "web")
+	var csrs []*x509.CertificateRequest
+	for i := 0; i < 2; i++ {
+		csrPEM, _ := connect.TestCSR(t, spiffeID)
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		csrs = append(csrs, csr)
+	}
+	initTestManager(t, manager, delegate)
+
+	cert, err := manager.SignCertificate(csrs[0], spiffeID)
+	require.NoError(t, err)
+	require.Len(t, hook.issued, 1)
+	require.Equal(t, cert, hook.issued[0])
+	require.Equal(t, spiffeID.URI().String(), hook.ids[0].URI().String())
+	require.Len(t, manager.leaves.leaves, 1)
+
+	// An error of the hook fails the signing.
+	hook.err = errors.New("inventory unavailable")
+	_, err = manager.SignCertificate(csrs[1], spiffeID)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "inventory unavailable")
+	require.Len(t, hook.issued, 2)
+	require.Len(t, manager.leaves.leaves, 1)
+}
+
+func TestCAManager_SetMaintenanceMode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+
+	_, s1 := testServer(t)
+	codec := rpcClient(t, s1)
+	testrpc.WaitForActiveCARoot(t, s1.RPC, "dc1", nil)
+	retry.Run(t, func(r *retry.R) {
+		provider, root := s1.caManager.getCAProvider()
+		require.NotNil(r, provider)
+		require.NotNil(r, root)
+	})
+
+	sign := func(t *testing.T) error {
+		t.Helper()
+		spiffeID := connect.TestSpiffeIDService(t, "web")
+		csr, _ := connect.TestCSR(t, spiffeID)
+		args := &structs.CASignRequest{Datacenter: "dc1", CSR: csr}
+		var reply structs.IssuedCert
+		return msgpackrpc.CallWithCodec(codec, "ConnectCA.Sign", args, &reply)
+	}
+	roots := func(t *testing.T) structs.IndexedCARoots {
+		t.Helper()
+		var reply structs.IndexedCARoots
+		args := &structs.DCSpecificRequest{Datacenter: "dc1"}
+		require.NoError(t, msgpackrpc.CallWithCodec(codec, "ConnectCA.Roots", args, &reply))
+		return reply
+	}
+
+	setMaintenanceMode := func(t *testing.T, enabled bool) {
+		t.Helper()
+		args := &structs.CASetMaintenanceModeRequest{Datacenter: "dc1", Enabled: enabled}
+		var reply interface{}
+		require.NoError(t, msgpackrpc.CallWithCodec(codec, "ConnectCA.SetMaintenanceMode", args, &reply))
+	}
+
+	require.NoError(t, sign(t))
+	before := roots(t)
+
+	// Signing is refused while the roots are still served.
+	setMaintenanceMode(t, true)
+	err := sign(t)
+	require.Error(t, err)
+	require.Equal(t, ErrCAMaintenance.Error(), err.Error())
+	require.Equal(t, before.ActiveRootID, roots(t).ActiveRootID)
+	require.Len(t, roots(t).Roots, len(before.Roots))
+
+	// The mode is persisted in raft, and kept by configuration updates.
+	_, config, err := s1.fsm.State().CAConfig(nil)
+	require.NoError(t, err)
+	require.True(t, config.MaintenanceMode)
+	newConfig := &structs.CAConfiguration{
+		Provider: config.Provider,
+		Config:   config.Config,
+	}
+	require.NoError(t, s1.caManager.UpdateConfiguration(&structs.CARequest{Config: newConfig}))
+	_, config, err = s1.fsm.State().CAConfig(nil)
+	require.NoError(t, err)
+	require.True(t, config.MaintenanceMode)
+	err = sign(t)
+	require.Error(t, err)
+	require.Equal(t, ErrCAMaintenance.Error(), err.Error())
+
+	setMaintenanceMode(t, false)
+	require.NoError(t, sign(t))
+	_, config, err = s1.fsm.State().CAConfig(nil)
+	require.NoError(t, err)
+	require.False(t, config.MaintenanceMode)
+}
+
+func TestCAManager_SignCertificate_AuditSink(t *testing.T) {
+	var (
+		lock      sync.Mutex
+		requests  int
+		delivered = make(map[string]int)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		requests++
+		// The first delivery fails and is retried.
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var records []caAuditRecord
+		if err := json.NewDecoder(r.Body).Decode(&records); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, record := range records {
+			delivered[record.SerialNumber]++
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	conf.ConnectCAAuditURL = srv.URL
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.primaryRoot = connect.TestCA(t, nil)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	caConf := testCAConfig()
+	caConf.Config["AuditSink"] = map[string]interface{}{
+		"Type": "http",
+	}
+	require.NoError(t, delegate.store.CASetConfig(1, caConf))
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+	}
+	initTestManager(t, manager, delegate)
+	go func() {
+		for range delegate.callbackCh {
+		}
+	}()
+	t.Cleanup(func() { close(delegate.callbackCh) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go manager.runAuditDelivery(ctx)
+
+	spiffeID := connect.TestSpiffeIDService(t, "web")
+	var serials []string
+	for i := 0; i < 3; i++ {
+		csrPEM, _ := connect.TestCSR(t, spiffeID)
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		cert, err := manager.SignCertificate(csr, spiffeID)
+		require.NoError(t, err)
+		serials = append(serials, cert.SerialNumber)
+	}
+
+	retry.Run(t, func(r *retry.R) {
+		lock.Lock()
+		defer lock.Unlock()
+		require.Len(r, delivered, len(serials))
+		for _, serial := range serials {
+			require.GreaterOrEqual(r, delivered[serial], 1, "serial %s", serial)
+		}
+	})
+	lock.Lock()
+	defer lock.Unlock()
+	require.Greater(t, requests, 1)
+}
+
+func TestCAAuditor_SinkDestination(t *testing.T) {
+	conf := DefaultConfig()
+	auditor := newCAAuditor(conf)
+	logger := testutil.Logger(t)
+
+	// The CA configuration can't pick the destination, without one in the
+	// server configuration the records are dropped.
+	auditor.record(logger, &structs.CAAuditSinkConfig{Type: "file"}, caAuditRecord{SerialNumber: "01"})
+	auditor.record(logger, &structs.CAAuditSinkConfig{Type: "http"}, caAuditRecord{SerialNumber: "02"})
+	require.Nil(t, auditor.sink)
+	require.Empty(t, auditor.pending)
+
+	conf.ConnectCAAuditURL = "file:///etc/passwd"
+	auditor.record(logger, &structs.CAAuditSinkConfig{Type: "http"}, caAuditRecord{SerialNumber: "03"})
+	require.Nil(t, auditor.sink)
+
+	path := filepath.Join(testutil.TempDir(t, "ca-audit"), "audit.log")
+	conf.ConnectCAAuditFilePath = path
+	auditor.record(logger, &structs.CAAuditSinkConfig{Type: "file"}, caAuditRecord{SerialNumber: "04"})
+	require.Equal(t, &fileAuditSink{path: path}, auditor.sink)
+	require.NoError(t, auditor.deliverPending(context.Background()))
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(b), `"SerialNumber":"04"`)
+
+	// The previous sink is closed when it is replaced.
+	closer := &closingAuditSink{}
+	auditor.sink = closer
+	auditor.record(logger, &structs.CAAuditSinkConfig{Type: "file", BufferSize: 10}, caAuditRecord{SerialNumber: "05"})
+	require.True(t, closer.closed)
+}
+
+// closingAuditSink is a caAuditSink recording whether it was closed.
+type closingAuditSink struct {
+	closed bool
+}
+
+func (s *closingAuditSink) deliver(context.Context, []caAuditRecord) error { return nil }
+
+func (s *closingAuditSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestCAManager_SignCertificate_NewIdentity(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	conf.ConnectCAAuditFilePath = filepath.Join(testutil.TempDir(t, "ca-audit"), "audit.log")
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.primaryRoot = connect.TestCA(t, nil)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	caConf := testCAConfig()
+	caConf.Config["AuditSink"] = map[string]interface{}{
+		"Type": "file",
+	}
+	require.NoError(t, delegate.store.CASetConfig(1, caConf))
+
+	// newManager returns a manager using the state store of delegate, as
+	// after a restart, along with the observer of its events.
+	newManager := func(t *testing.T) (*CAManager, *recordingCAEventObserver) {
+		manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+		manager.providerShim = &mockCAProvider{
+			callbackCh: delegate.callbackCh,
+			rootPEM:    delegate.primaryRoot.RootCert,
+			signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+		}
+		observer := &recordingCAEventObserver{}
+		manager.eventObserver = observer
+		return manager, observer
+	}
+	sign := func(t *testing.T, manager *CAManager, service string) {
+		spiffeID := connect.TestSpiffeIDService(t, service)
+		csrPEM, _ := connect.TestCSR(t, spiffeID)
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		_, err = manager.SignCertificate(csr, spiffeID)
+		require.NoError(t, err)
+	}
+	identities := func(o *recordingCAEventObserver) []string {
+		o.lock.Lock()
+		defer o.lock.Unlock()
+		var ids []string
+		for _, e := range o.events {
+			require.Equal(t, CAEventNewIdentity, e.Type)
+			ids = append(ids, e.Identity)
+		}
+		o.events = nil
+		return ids
+	}
+	webID := connect.TestSpiffeIDService(t, "web").URI().String()
+	apiID := connect.TestSpiffeIDService(t, "api").URI().String()
+
+	manager, observer := newManager(t)
+	initTestManager(t, manager, delegate)
+	go func() {
+		for range delegate.callbackCh {
+		}
+	}()
+	t.Cleanup(func() { close(delegate.callbackCh) })
+	observer.events = nil
+
+	sign(t, manager, "web")
+	require.Equal(t, []string{webID}, identities(observer))
+
+	// Signing again for the same identity doesn't report it.
+	sign(t, manager, "web")
+	require.Empty(t, identities(observer))
+
+	sign(t, manager, "api")
+	require.Equal(t, []string{apiID}, identities(observer))
+
+	// Nor after a restart.
+	manager, observer = newManager(t)
+	require.NoError(t, manager.Initialize())
+	observer.events = nil
+	sign(t, manager, "web")
+	sign(t, manager, "api")
+	require.Empty(t, identities(observer))
+
+	_, seen, err := delegate.store.CASeenIdentity(nil, webID)
+	require.NoError(t, err)
+	require.NotNil(t, seen)
+
+	// Identities not seen for long are pruned, and reported again when they
+	// come back.
+	now := time.Now()
+	manager.timeNow = func() time.Time { return now.Add(seenIdentityRetention / 2) }
+	sign(t, manager, "web")
+	manager.timeNow = func() time.Time { return now.Add(seenIdentityRetention * 3 / 2) }
+	require.NoError(t, manager.pruneSeenIdentities())
+	_, seen, err = delegate.store.CASeenIdentity(nil, webID)
+	require.NoError(t, err)
+	require.NotNil(t, seen)
+	_, seen, err = delegate.store.CASeenIdentity(nil, apiID)
+	require.NoError(t, err)
+	require.Nil(t, seen)
+	manager.timeNow = time.Now
+	sign(t, manager, "api")
+	require.Equal(t, []string{apiID}, identities(observer))
+}
+
+func TestCAManager_SignCertificate_NewIdentityWithoutAuditSink(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	conf.ConnectCAAuditFilePath = filepath.Join(testutil.TempDir(t, "ca-audit"), "audit.log")
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.primaryRoot = connect.TestCA(t, nil)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+	}
+	observer := &recordingCAEventObserver{}
+	manager.eventObserver = observer
+	initTestManager(t, manager, delegate)
+	go func() {
+		for range delegate.callbackCh {
+		}
+	}()
+	t.Cleanup(func() { close(delegate.callbackCh) })
+	sign := func(t *testing.T, service string) {
+		spiffeID := connect.TestSpiffeIDService(t, service)
+		csrPEM, _ := connect.TestCSR(t, spiffeID)
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		_, err = manager.SignCertificate(csr, spiffeID)
+		require.NoError(t, err)
+	}
+	newIdentities := func() []string {
+		observer.lock.Lock()
+		defer observer.lock.Unlock()
+		var ids []string
+		for _, e := range observer.events {
+			if e.Type == CAEventNewIdentity {
+				ids = append(ids, e.Identity)
+			}
+		}
+		observer.events = nil
+		return ids
+	}
+
+	// Identities are recorded without an audit sink, but not reported.
+	sign(t, "web")
+	require.Empty(t, newIdentities())
+	webID := connect.TestSpiffeIDService(t, "web").URI().String()
+	_, seen, err := delegate.store.CASeenIdentity(nil, webID)
+	require.NoError(t, err)
+	require.NotNil(t, seen)
+
+	// So enabling the audit sink only reports the identities that weren't
+	// seen before.
+	caConf := testCAConfig()
+	caConf.Config["AuditSink"] = map[string]interface{}{
+		"Type": "file",
+	}
+	_, current, err := delegate.store.CAConfig(nil)
+	require.NoError(t, err)
+	caConf.ClusterID = current.ClusterID
+	require.NoError(t, delegate.store.CASetConfig(100, caConf))
+	sign(t, "web")
+	require.Empty(t, newIdentities())
+	sign(t, "api")
+	require.Equal(t, []string{connect.TestSpiffeIDService(t, "api").URI().String()}, newIdentities())
+}
+
+// emptyIntermediateCAProvider is a mockCAProvider whose ActiveIntermediate
+// returns an empty string once empty is set, like a Vault provider whose
+// intermediate mount was not populated.
+type emptyIntermediateCAProvider struct {
+	mockCAProvider
+	empty bool
+}
+
+func (p *emptyIntermediateCAProvider) ActiveIntermediate() (string, error) {
+	if p.empty {
+		return "", nil
+	}
+	return p.mockCAProvider.ActiveIntermediate()
+}
+
+func TestCAManager_EmptyActiveIntermediate(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	provider := &emptyIntermediateCAProvider{mockCAProvider: mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+	}}
+	manager.providerShim = provider
+	// Generate the CSR up front as the test root is only valid for a second.
+	spiffeID := connect.TestSpiffeIDService(t, "web")
+	csrPEM, _ := connect.TestCSR(t, spiffeID)
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+	initTestManager(t, manager, delegate)
+
+	// Signing is refused once the provider loses its intermediate.
+	provider.empty = true
+	// Expire the previous successful check.
+	manager.providerCheckedAt = time.Time{}
+	_, err = manager.SignCertificate(csr, spiffeID)
+	require.ErrorIs(t, err, ErrActiveIntermediateEmpty)
+	require.Contains(t, err.Error(), "intermediate PKI mount")
+
+	// So is initializing with it.
+	manager = NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = provider
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- manager.Initialize()
+	}()
+	for done := false; !done; {
+		select {
+		case <-delegate.callbackCh:
+		case err = <-errCh:
+			done = true
+		case <-time.After(CATestTimeout):
+			t.Fatal("failed waiting for initialization")
+		}
+	}
+	require.ErrorIs(t, err, ErrActiveIntermediateEmpty)
+}
+
+func TestCAManager_SignCertificate_TamperedCSRSignature(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+	}
+	// Generate the CSR up front as the test root is only valid for a second.
+	spiffeID := connect.TestSpiffeIDService(t, "web")
+	csrPEM, _ := connect.TestCSR(t, spiffeID)
+	block, _ := pem.Decode([]byte(csrPEM))
+	require.NotNil(t, block)
+	// The signature is at the end of the CSR, flipping its last byte still
+	// parses.
+	block.Bytes[len(block.Bytes)-1] ^= 0xff
+	csr, err := connect.ParseCSR(string(pem.EncodeToMemory(block)))
+	require.NoError(t, err)
+	initTestManager(t, manager, delegate)
+
+	_, err = manager.SignCertificate(csr, spiffeID)
+	require.ErrorIs(t, err, ErrCSRSignatureInvalid)
+	require.Empty(t, manager.leaves.leaves)
+}
+
+func TestCAManager_SignCertificate_RejectReusedSerialNumbers(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	conf.ConnectCARejectReusedSerialNumbers = true
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    delegate.primaryRoot.RootCert,
+		signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+		serial:     big.NewInt(42),
+	}
+	// Generate the CSRs up front as the test root is only valid for a second.
+	spiffeID := connect.TestSpiffeIDService(t, "web")
+	var csrs []*x509.CertificateRequest
+	for i := 0; i < 2; i++ {
+		csrPEM, _ := connect.TestCSR(t, spiffeID)
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		csrs = append(csrs, csr)
+	}
+	initTestManager(t, manager, delegate)
+
+	cert, err := manager.SignCertificate(csrs[0], spiffeID)
+	require.NoError(t, err)
+
+	// A provider for another root which issues the same serial number.
+	newRoot := connect.TestCA(t, nil)
+	newRoot.IntermediateCerts = []string{newRoot.RootCert}
+	manager.setCAProvider(&mockCAProvider{
+		callbackCh: delegate.callbackCh,
+		rootPEM:    newRoot.RootCert,
+		signingKey: testParseSigner(t, newRoot.SigningKey),
+		serial:     big.NewInt(42),
+	}, newRoot)
+
+	_, err = manager.SignCertificate(csrs[1], spiffeID)
+	require.ErrorIs(t, err, ErrSerialNumberReused)
+	require.Contains(t, err.Error(), delegate.primaryRoot.ID)
+
+	// The first leaf is still the one known for the serial number.
+	require.Len(t, manager.leaves.leaves, 1)
+	require.Equal(t, delegate.primaryRoot.ID, manager.leaves.leaves[cert.SerialNumber].rootID)
+}
+
+func TestCAManager_SignCertificate_RejectCALeaves(t *testing.T) {
+	cases := map[string]struct {
+		isCA     bool
+		keyUsage x509.KeyUsage
+		disabled bool
+		expErr   string
+	}{
+		"CA certificate": {
+			isCA:   true,
+			expErr: "it is a CA certificate",
+		},
+		"cert signing key usage": {
+			keyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			expErr:   "its key usage includes certificate signing",
+		},
+		"leaf certificate": {
+			keyUsage: x509.KeyUsageDigitalSignature,
+		},
+		"check disabled": {
+			isCA:     true,
+			disabled: true,
+		},
+	}
+	for name, tc := range cases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			conf := DefaultConfig()
+			conf.ConnectEnabled = true
+			conf.PrimaryDatacenter = "dc1"
+			conf.Datacenter = "dc2"
+			conf.ConnectCARejectCALeaves = !tc.disabled
+			delegate := NewMockCAServerDelegate(t, conf)
+			delegate.primaryRoot = connect.TestCA(t, nil)
+			delegate.secondaryIntermediate = delegate.primaryRoot.RootCert
+			manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+			manager.providerShim = &mockCAProvider{
+				callbackCh:   delegate.callbackCh,
+				rootPEM:      delegate.primaryRoot.RootCert,
+				signingKey:   testParseSigner(t, delegate.primaryRoot.SigningKey),
+				leafIsCA:     tc.isCA,
+				leafKeyUsage: tc.keyUsage,
+			}
+			initTestManager(t, manager, delegate)
+
+			spiffeID := connect.TestSpiffeIDService(t, "web")
+			csrPEM, _ := connect.TestCSR(t, spiffeID)
+			csr, err := connect.ParseCSR(csrPEM)
+			require.NoError(t, err)
+
+			cert, err := manager.SignCertificate(csr, spiffeID)
+			if tc.expErr == "" {
+				require.NoError(t, err)
+				require.NotNil(t, cert)
+				require.Equal(t, 1, delegate.leafRequests)
+				return
+			}
+			require.ErrorIs(t, err, ErrLeafIsCA)
+			require.Contains(t, err.Error(), tc.expErr)
+			require.Nil(t, cert)
+			// The rejected leaf isn't tracked as issued, nor bumps the leaf
+			// index.
+			require.Empty(t, manager.leaves.leaves)
+			require.Zero(t, delegate.leafRequests)
+		})
+	}
+}
+
+func TestCAManager_SignCertificate_ChainOrder(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	// The default root of the mock expires after a second, which can be before
+	// the chain is verified.
+	delegate.primaryRoot = connect.TestCA(t, nil)
+
+	// Sign leaves with an intermediate so that the chain has two certs.
+	rootCert, err := connect.ParseCert(delegate.primaryRoot.RootCert)
+	require.NoError(t, err)
+	intermediateKey, _, err := connect.GeneratePrivateKey()
+	require.NoError(t, err)
+	intermediate, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "intermediate"},
+		URIs:                  rootCert.URIs,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}, rootCert, intermediateKey.Public(), testParseSigner(t, delegate.primaryRoot.SigningKey))
+	require.NoError(t, err)
+	delegate.secondaryIntermediate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: intermediate}))
+
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	manager.providerShim = &mockCAProvider{
+		callbackCh:      delegate.callbackCh,
+		rootPEM:         delegate.primaryRoot.RootCert,
+		intermediatePem: delegate.secondaryIntermediate,
+		signingKey:      intermediateKey,
+	}
+	initTestManager(t, manager, delegate)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCert)
+	verify := func(t *testing.T, leaf *x509.Certificate, intermediates []*x509.Certificate) {
+		pool := x509.NewCertPool()
+		for _, c := range intermediates {
+			pool.AddCert(c)
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: pool,
+			// The mock provider doesn't set any key usage on leaves.
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		require.NoError(t, err)
+	}
+	sign := func(t *testing.T, order structs.CAChainOrder) []*x509.Certificate {
+		csrPEM, _ := connect.TestCSR(t, connect.TestSpiffeIDService(t, "web"))
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		reply, err := manager.SignCertificateWithChainOrder(csr, connect.TestSpiffeIDService(t, "web"), order)
+		require.NoError(t, err)
+
+		var certs []*x509.Certificate
+		for rest := []byte(reply.CertPEM); ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			require.NoError(t, err)
+			certs = append(certs, cert)
+		}
+		require.Len(t, certs, 2)
+		return certs
+	}
+
+	t.Run("leaf first", func(t *testing.T) {
+		certs := sign(t, structs.CAChainOrderLeafFirst)
+		require.Equal(t, intermediate, certs[1].Raw)
+		verify(t, certs[0], certs[1:])
+	})
+
+	t.Run("root first", func(t *testing.T) {
+		certs := sign(t, structs.CAChainOrderRootFirst)
+		require.Equal(t, intermediate, certs[0].Raw)
+		verify(t, certs[len(certs)-1], certs[:len(certs)-1])
+	})
+}
+
+func TestCAManager_SignCertificate_WithExpiredCert(t *testing.T) {
+	args := []struct {
+		testName              string
+		notBeforeRoot         time.Time
+		notAfterRoot          time.Time
+		notBeforeIntermediate time.Time
+		notAfterIntermediate  time.Time
+		isError               bool
+		errorMsg              string
+	}{
+		{"intermediate valid", time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 2), time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 2), false, ""},
+		{"intermediate expired", time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 2), time.Now().AddDate(-2, 0, 0), time.Now().AddDate(0, 0, -1), true, "intermediate expired: certificate expired, expiration date"},
+		{"root expired", time.Now().AddDate(-2, 0, 0), time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 2), true, "root expired: certificate expired, expiration date"},
+		// a cert that is not yet valid is ok, assume it will be valid soon enough
+		{"intermediate in the future", time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 2), time.Now().AddDate(0, 0, 1), time.Now().AddDate(0, 0, 2), false, ""},
+		{"root in the future", time.Now().AddDate(0, 0, 1), time.Now().AddDate(0, 0, 2), time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 2), false, ""},
+	}
+
+	// The expiry checks don't depend on the key, so short runs use a smaller
+	// one than the RSA 4096 key of the full runs. Ed25519 keys are cheap and
+	// cover the verification of Ed25519 signatures.
+	keys := []struct {
+		keyType string
+		keyBits int
+	}{
+		{"rsa", 4096},
+		{"ed25519", 256},
+	}
+	if testing.Short() {
+		keys[0].keyType, keys[0].keyBits = "ec", 256
+	}
+
+	for _, key := range keys {
+		caPrivKey, _, err := ca.TestFastKeys()(key.keyType, key.keyBits)
+		require.NoError(t, err, "failed to generate key")
+
+		for _, arg := range args {
+			t.Run(fmt.Sprintf("%s-%d/%s", key.keyType, key.keyBits, arg.testName), func(t *testing.T) {
+				// No parallel execution because we change globals
+				// Set the interval and drift buffer low for renewing the cert.
+				origInterval := structs.IntermediateCertRenewInterval
+				origDriftBuffer := ca.CertificateTimeDriftBuffer
+				defer func() {
+					structs.IntermediateCertRenewInterval = origInterval
+					ca.CertificateTimeDriftBuffer = origDriftBuffer
+				}()
+				structs.IntermediateCertRenewInterval = time.Millisecond
+				ca.CertificateTimeDriftBuffer = 0
+
+				conf := DefaultConfig()
+				conf.ConnectEnabled = true
+				conf.PrimaryDatacenter = "dc1"
+				conf.Datacenter = "dc2"
+
+				rootPEM := generateCertPEM(t, caPrivKey, arg.notBeforeRoot, arg.notAfterRoot)
+				intermediatePEM := generateCertPEM(t, caPrivKey, arg.notBeforeIntermediate, arg.notAfterIntermediate)
+
+				delegate := NewMockCAServerDelegate(t, conf)
+				delegate.primaryRoot.RootCert = rootPEM
+				delegate.secondaryIntermediate = intermediatePEM
+				allowSingleTierCA(t, delegate)
+				manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+
+				manager.providerShim = &mockCAProvider{
+					callbackCh:      delegate.callbackCh,
+					rootPEM:         rootPEM,
+					intermediatePem: intermediatePEM,
+					signingKey:      caPrivKey,
+				}
+				initTestManager(t, manager, delegate)
+
+				// Simulate Wait half the TTL for the cert to need renewing.
+				manager.timeNow = func() time.Time {
+					return time.Now().UTC().Add(500 * time.Millisecond)
+				}
+
+				// Call RenewIntermediate and then confirm the RPCs and provider calls
+				// happen in the expected order.
+
+				csrPEM, _ := connect.TestCSR(t, &connect.SpiffeIDAgent{Agent: "foo"})
+				csr, err := connect.ParseCSR(csrPEM)
+				require.NoError(t, err)
+
+				_, err = manager.SignCertificate(csr, &connect.SpiffeIDAgent{Agent: "foo"})
+				if arg.isError {
+					require.Error(t, err)
+					require.Contains(t, err.Error(), arg.errorMsg)
+				} else {
+					require.NoError(t, err)
+				}
+			})
+		}
+	}
+}
+
+func generateCertPEM(t *testing.T, caPrivKey crypto.Signer, notBefore time.Time, notAfter time.Time) string {
+	t.Helper()
+	ca := &x509.Certificate{
+		SerialNumber: big.NewInt(2019),
+		Subject: pkix.Name{
+			Organization:  []string{"Company, INC."},
+			Country:       []string{"US"},
+			Province:      []string{""},
+			Locality:      []string{"San Francisco"},
+			StreetAddress: []string{"Golden Gate Bridge"},
+			PostalCode:    []string{"94016"},
+		},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		URIs:                  []*url.URL{connect.SpiffeIDAgent{Host: "foo"}.URI()},
+	}
+
+	caBytes, err := x509.CreateCertificate(rand.Reader, ca, ca, caPrivKey.Public(), caPrivKey)
+	require.NoError(t, err, "failed to create cert")
+
+	caPEM := new(bytes.Buffer)
+	err = pem.Encode(caPEM, &pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: caBytes,
+	})
+	require.NoError(t, err, "failed to encode")
+	return caPEM.String()
+}
+
+// renewalOutageCAProvider is a mockCAProvider that can't renew its
+// intermediate once down, as when the backing CA is unreachable, but can sign
+// leaf certificates with the root.
+type renewalOutageCAProvider struct {
+	*mockCAProvider
+	down       bool
+	rootSigned int
+	rootParams ca.LeafSignParams
+}
+
+func (m *renewalOutageCAProvider) GenerateIntermediateCSR() (string, error) {
+	if m.down {
+		return "", errors.New("provider is down")
+	}
+	return m.mockCAProvider.GenerateIntermediateCSR()
+}
+
+func (m *renewalOutageCAProvider) SignLeafWithRoot(_ context.Context, csr *x509.CertificateRequest, params ca.LeafSignParams) (string, error) {
+	m.rootSigned++
+	m.rootParams = params
+	root, err := connect.ParseCert(m.rootPEM)
+	if err != nil {
+		return "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(m.rootSigned)),
+		URIs:         csr.URIs,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	bs, err := x509.CreateCertificate(rand.Reader, template, root, csr.PublicKey, m.signingKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: bs})), nil
+}
+
+func TestCAManager_RenewIntermediate_Outage(t *testing.T) {
+	// No parallel execution because we change the global metrics sink.
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	cfg := metrics.DefaultConfig("consul.test")
+	cfg.EnableHostname = false
+	cfg.EnableRuntimeMetrics = false
+	metrics.NewGlobal(cfg, sink)
+	t.Cleanup(func() {
+		metrics.NewGlobal(cfg, &metrics.BlackholeSink{})
+	})
+
+	caPrivKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	now := time.Now()
+	rootPEM := generateCertPEM(t, caPrivKey, now.Add(-time.Hour), now.AddDate(1, 0, 0))
+	intermediatePEM := generateCertPEM(t, caPrivKey, now, now.AddDate(0, 0, 40))
+
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.primaryRoot.RootCert = rootPEM
+	delegate.secondaryIntermediate = intermediatePEM
+	allowSingleTierCA(t, delegate)
+
+	var logBuf bytes.Buffer
+	manager := NewCAManager(delegate, nil, testutil.LoggerWithOutput(t, &logBuf), conf)
+	provider := &renewalOutageCAProvider{mockCAProvider: &mockCAProvider{
+		callbackCh:      delegate.callbackCh,
+		rootPEM:         rootPEM,
+		intermediatePem: intermediatePEM,
+		signingKey:      caPrivKey,
+	}}
+	manager.providerShim = provider
+	initTestManager(t, manager, delegate)
+	provider.down = true
+
+	stalledCount := func() int {
+		intervals := sink.Data()
+		require.NotEmpty(t, intervals)
+		counter, ok := intervals[len(intervals)-1].Counters["consul.test.connect.ca.intermediate_renewal_stalled"]
+		if !ok {
+			return 0
+		}
+		return counter.Count
+	}
+	renew := func(day int) error {
+		manager.timeNow = func() time.Time { return now.AddDate(0, 0, day) }
+		err := manager.RenewIntermediate(context.Background(), false)
+		require.Error(t, err)
+		manager.logRenewIntermediateError(err)
+		return err
+	}
+
+	// Failing to renew is only warned about while the intermediate has plenty
+	// of time left.
+	err = renew(25)
+	require.NotErrorIs(t, err, ErrIntermediateRenewalStalled)
+	require.Equal(t, 0, stalledCount())
+	require.Contains(t, logBuf.String(), "[WARN]")
+	require.NotContains(t, logBuf.String(), "[ERROR]")
+
+	// The renewal stalls in the last quarter of the intermediate's lifetime,
+	// before it expires.
+	for i, day := range []int{32, 39} {
+		err = renew(day)
+		require.ErrorIs(t, err, ErrIntermediateRenewalStalled)
+		require.Contains(t, err.Error(), "provider is down")
+		require.Equal(t, i+1, stalledCount())
+	}
+	require.Contains(t, logBuf.String(), "[ERROR]")
+
+	// Once the intermediate expired leaf certificates can't be signed, unless
+	// the root signing fallback is enabled.
+	manager.timeNow = func() time.Time { return now.AddDate(0, 0, 41) }
+	spiffeID := connect.TestSpiffeIDService(t, "web")
+	csrPEM, _ := connect.TestCSR(t, spiffeID)
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+
+	_, err = manager.SignCertificate(csr, spiffeID)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "intermediate expired")
+	require.Equal(t, 0, provider.rootSigned)
+
+	caConf := testCAConfig()
+	caConf.Config["RootSigningFallback"] = true
+	require.NoError(t, delegate.store.CASetConfig(10, caConf))
+
+	cert, err := manager.SignCertificate(csr, spiffeID)
+	require.NoError(t, err)
+	require.Equal(t, 1, provider.rootSigned)
+	// The root is given the same params as the intermediate, expecting the
+	// leaf to point at the root.
+	root, err := connect.ParseCert(rootPEM)
+	require.NoError(t, err)
+	require.Equal(t, root.SubjectKeyId, provider.rootParams.AuthorityKeyID)
+	require.Len(t, provider.rootParams.Extensions, 1)
+	// The expired intermediate is left out of the chain.
+	require.Equal(t, 1, strings.Count(cert.CertPEM, "BEGIN CERTIFICATE"))
+}
+
+func TestCAManager_RenewIntermediate_GracePeriod(t *testing.T) {
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	now := time.Now()
+	rootPEM := generateCertPEM(t, rootKey, now.Add(-time.Hour), now.AddDate(1, 0, 0))
+	oldIntermediatePEM := generateCertPEM(t, rootKey, now, now.AddDate(0, 0, 40))
+
+	// The renewed intermediate has its own key, signed by the root.
+	rootCert, err := connect.ParseCert(rootPEM)
+	require.NoError(t, err)
+	newKey, _, err := connect.GeneratePrivateKey()
+	require.NoError(t, err)
+	bs, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(2020),
+		Subject:               pkix.Name{CommonName: "renewed intermediate"},
+		URIs:                  rootCert.URIs,
+		NotBefore:             now.AddDate(0, 0, 25),
+		NotAfter:              now.AddDate(0, 0, 65),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}, rootCert, newKey.Public(), rootKey)
+	require.NoError(t, err)
+	newIntermediatePEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: bs}))
+
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.primaryRoot.RootCert = rootPEM
+	delegate.secondaryIntermediate = oldIntermediatePEM
+	caConf := testCAConfig()
+	caConf.Config["IntermediateGracePeriod"] = "1h"
+	// The fixtures sign the intermediates with the root key.
+	caConf.Config["AllowSingleTier"] = true
+	require.NoError(t, delegate.store.CASetConfig(1, caConf))
+
+	var logBuf bytes.Buffer
+	manager := NewCAManager(delegate, nil, testutil.LoggerWithOutput(t, &logBuf), conf)
+	provider := &mockCAProvider{
+		callbackCh:      delegate.callbackCh,
+		rootPEM:         rootPEM,
+		intermediatePem: oldIntermediatePEM,
+		signingKey:      rootKey,
+	}
+	manager.providerShim = provider
+	initTestManager(t, manager, delegate)
+	go func() {
+		for range delegate.callbackCh {
+		}
+	}()
+	t.Cleanup(func() { close(delegate.callbackCh) })
+
+	intermediates := func(t *testing.T) []string {
+		t.Helper()
+		_, root, err := delegate.store.CARootActive(nil)
+		require.NoError(t, err)
+		return root.IntermediateCerts
+	}
+	require.Equal(t, []string{oldIntermediatePEM}, intermediates(t))
+
+	// Past half of its lifetime the intermediate is renewed, and the previous
+	// one is still published during the grace period.
+	delegate.secondaryIntermediate = newIntermediatePEM
+	manager.timeNow = func() time.Time { return now.AddDate(0, 0, 25) }
+	require.NoError(t, manager.RenewIntermediate(context.Background(), false))
+	provider.intermediatePem = newIntermediatePEM
+	require.Equal(t, []string{oldIntermediatePEM, newIntermediatePEM}, intermediates(t))
+
+	manager.timeNow = func() time.Time { return now.AddDate(0, 0, 25).Add(30 * time.Minute) }
+	require.NoError(t, manager.RenewIntermediate(context.Background(), false))
+	require.Equal(t, []string{oldIntermediatePEM, newIntermediatePEM}, intermediates(t))
+
+	// While some servers are too old to know about the grace period, the
+	// previous intermediate is kept as they would.
+	delegate.oldestServer = version.Must(version.NewVersion("1.11.0"))
+	manager.timeNow = func() time.Time { return now.AddDate(0, 0, 25).Add(time.Hour) }
+	require.NoError(t, manager.RenewIntermediate(context.Background(), false))
+	require.Equal(t, []string{oldIntermediatePEM, newIntermediatePEM}, intermediates(t))
+	require.Contains(t, logBuf.String(), "CA feature disabled until all servers are upgraded: feature=\"staged intermediate rotation\" min_version=1.12.0")
+
+	// It is dropped once the grace period elapsed and every server supports
+	// it.
+	delegate.oldestServer = nil
+	require.NoError(t, manager.RenewIntermediate(context.Background(), false))
+	require.Equal(t, []string{newIntermediatePEM}, intermediates(t))
+	require.Contains(t, logBuf.String(), "CA feature enabled now that all servers support it")
+
+	_, root, err := delegate.store.CARootActive(nil)
+	require.NoError(t, err)
+	require.Empty(t, root.IntermediatesSupersededAt)
+	newCert, err := connect.ParseCert(newIntermediatePEM)
+	require.NoError(t, err)
+	require.Equal(t, connect.EncodeSigningKeyID(newCert.SubjectKeyId), root.SigningKeyID)
+}
+
+func TestCAManager_SignCertificate_MinIntermediateRemaining(t *testing.T) {
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	now := time.Now()
+	rootPEM := generateCertPEM(t, rootKey, now.Add(-time.Hour), now.AddDate(1, 0, 0))
+	oldIntermediatePEM := generateCertPEM(t, rootKey, now, now.AddDate(0, 0, 40))
+	newIntermediatePEM := generateCertPEM(t, rootKey, now.AddDate(0, 0, 15), now.AddDate(0, 0, 55))
+
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.primaryRoot.RootCert = rootPEM
+	delegate.secondaryIntermediate = oldIntermediatePEM
+	caConf := testCAConfig()
+	caConf.Config["MinIntermediateRemaining"] = "720h"
+	// The fixtures sign the intermediates with the root key.
+	caConf.Config["AllowSingleTier"] = true
+	require.NoError(t, delegate.store.CASetConfig(1, caConf))
+
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	provider := &mockCAProvider{
+		callbackCh:      delegate.callbackCh,
+		rootPEM:         rootPEM,
+		intermediatePem: oldIntermediatePEM,
+		signingKey:      rootKey,
+	}
+	manager.providerShim = provider
+	initTestManager(t, manager, delegate)
+	go func() {
+		for range delegate.callbackCh {
+		}
+	}()
+	t.Cleanup(func() { close(delegate.callbackCh) })
+
+	sign := func(t *testing.T) error {
+		t.Helper()
+		csrPEM, _ := connect.TestCSR(t, &connect.SpiffeIDAgent{Agent: "foo"})
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		_, err = manager.SignCertificate(csr, &connect.SpiffeIDAgent{Agent: "foo"})
+		return err
+	}
+
+	manager.timeNow = func() time.Time { return now.AddDate(0, 0, 1) }
+	require.NoError(t, sign(t))
+
+	// The renewal is checked for when the threshold is reached.
+	manager.timeNow = func() time.Time { return now.AddDate(0, 0, 10).Add(-30 * time.Minute) }
+	// Certificates only have a precision of a second.
+	require.InDelta(t, float64(30*time.Minute), float64(manager.intermediateRenewalWait(false)), float64(time.Second))
+
+	// With 25 days left the intermediate is below the threshold, so signing
+	// is deferred even though less than half its lifetime passed.
+	manager.timeNow = func() time.Time { return now.AddDate(0, 0, 15) }
+	err = sign(t)
+	require.True(t, errors.Is(err, ErrCANotReady), "unexpected error: %v", err)
+	require.Contains(t, err.Error(), "less than MinIntermediateRemaining (720h0m0s)")
+
+	// The renewal doesn't wait for half the lifetime either, and signing
+	// resumes with the new intermediate.
+	delegate.secondaryIntermediate = newIntermediatePEM
+	require.NoError(t, manager.RenewIntermediate(context.Background(), false))
+	provider.intermediatePem = newIntermediatePEM
+	_, root, err := delegate.store.CARootActive(nil)
+	require.NoError(t, err)
+	require.Equal(t, newIntermediatePEM, root.IntermediateCerts[len(root.IntermediateCerts)-1])
+	require.NoError(t, sign(t))
+}
+
+func TestCAManager_SignCertificate_LeafSignerKeyID(t *testing.T) {
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	now := time.Now()
+	rootPEM := generateCertPEM(t, rootKey, now.Add(-time.Hour), now.AddDate(1, 0, 0))
+
+	// Two intermediates are eligible to sign leaves: they share the key and
+	// only differ by their subject key ID, as when one is cross-signed.
+	issue := func(serial int64, subjectKeyID []byte) string {
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: "Test Intermediate"},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.AddDate(0, 1, 0),
+			IsCA:                  true,
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			SubjectKeyId:          subjectKeyID,
+			URIs:                  []*url.URL{connect.SpiffeIDAgent{Host: "foo"}.URI()},
+		}
+		bs, err := x509.CreateCertificate(rand.Reader, template, template, rootKey.Public(), rootKey)
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: bs}))
+	}
+	otherPEM := issue(2, []byte("other-intermediate"))
+	selectedPEM := issue(3, []byte("selected-intermediate"))
+
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc2"
+	delegate := NewMockCAServerDelegate(t, conf)
+	delegate.primaryRoot.RootCert = rootPEM
+	delegate.secondaryIntermediate = selectedPEM
+	// The fixtures sign the intermediates with the root key.
+	allowSingleTierCA(t, delegate)
+
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	provider := &mockCAProvider{
+		callbackCh:      delegate.callbackCh,
+		rootPEM:         rootPEM,
+		intermediatePem: selectedPEM,
+		signingKey:      rootKey,
+	}
+	manager.providerShim = provider
+	initTestManager(t, manager, delegate)
+	go func() {
+		for range delegate.callbackCh {
+		}
+	}()
+	t.Cleanup(func() { close(delegate.callbackCh) })
+
+	// Select the second of the intermediates of the active root.
+	_, caRoot := manager.getCAProvider()
+	caRoot = caRoot.Clone()
+	caRoot.IntermediateCerts = []string{otherPEM, selectedPEM}
+	caRoot.SigningKeyID = connect.EncodeSigningKeyID([]byte("selected-intermediate"))
+	manager.setCAProvider(provider, caRoot)
+
+	sign := func(t *testing.T) (*structs.IssuedCert, error) {
+		t.Helper()
+		csrPEM, _ := connect.TestCSR(t, &connect.SpiffeIDAgent{Agent: "foo"})
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		return manager.SignCertificate(csr, &connect.SpiffeIDAgent{Agent: "foo"})
+	}
+
+	issued, err := sign(t)
+	require.NoError(t, err)
+	leaf, err := connect.ParseCert(issued.CertPEM)
+	require.NoError(t, err)
+	require.Equal(t, []byte("selected-intermediate"), leaf.AuthorityKeyId)
+
+	// A leaf signed by the other intermediate is refused, without bumping
+	// the leaf index.
+	leafRequests := delegate.leafRequests
+	provider.intermediatePem = otherPEM
+	_, err = sign(t)
+	require.True(t, errors.Is(err, ErrLeafSignerMismatch), "unexpected error: %v", err)
+	require.Equal(t, leafRequests, delegate.leafRequests)
+
+	t.Run("sub-intermediate", func(t *testing.T) {
+		// Like Vault's DelegatedLeafSigning, the leaf is signed by a
+		// sub-intermediate the provider returns with it, which must be signed
+		// by the selected intermediate.
+		subProvider := &subIntermediateCAProvider{mockCAProvider: provider}
+		manager.setCAProvider(subProvider, caRoot)
+
+		provider.intermediatePem = selectedPEM
+		issued, err := sign(t)
+		require.NoError(t, err)
+		leaf, err := connect.ParseCert(issued.CertPEM)
+		require.NoError(t, err)
+		require.Equal(t, []byte("sub-intermediate"), leaf.AuthorityKeyId)
+
+		provider.intermediatePem = otherPEM
+		_, err = sign(t)
+		require.True(t, errors.Is(err, ErrLeafSignerMismatch), "unexpected error: %v", err)
+	})
+
+	t.Run("bootstrap", func(t *testing.T) {
+		manager.setCAProvider(&paramsCAProvider{mockCAProvider: provider}, caRoot)
+		agentID := &connect.SpiffeIDAgent{Agent: "foo"}
+		signBootstrap := func(t *testing.T) (*structs.IssuedCert, error) {
+			t.Helper()
+			csrPEM, _ := connect.TestCSR(t, agentID)
+			csr, err := connect.ParseCSR(csrPEM)
+			require.NoError(t, err)
+			return manager.SignBootstrapCertificate(context.Background(), csr, agentID, nil)
+		}
+
+		provider.intermediatePem = selectedPEM
+		issued, err := signBootstrap(t)
+		require.NoError(t, err)
+		leaf, err := connect.ParseCert(issued.CertPEM)
+		require.NoError(t, err)
+		require.Equal(t, []byte("selected-intermediate"), leaf.AuthorityKeyId)
+
+		provider.intermediatePem = otherPEM
+		_, err = signBootstrap(t)
+		require.True(t, errors.Is(err, ErrLeafSignerMismatch), "unexpected error: %v", err)
+	})
+}
+
+// paramsCAProvider is a mockCAProvider implementing ca.ParamsSigner, which
+// only applies the extended key usages and the maximum TTL of the params.
+type paramsCAProvider struct {
+	*mockCAProvider
+}
+
+func (p *paramsCAProvider) SignWithParams(csr *x509.CertificateRequest, params ca.LeafSignParams) (string, error) {
+	m := *p.mockCAProvider
+	m.leafExtKeyUsage = params.ExtKeyUsage
+	m.leafTTL = params.MaxTTL
+	return m.Sign(context.Background(), csr)
+}
+
+// subIntermediateCAProvider is a mockCAProvider that signs leaves with a new
+// sub-intermediate of its active intermediate, and returns the leaf followed
+// by the sub-intermediate.
+type subIntermediateCAProvider struct {
+	*mockCAProvider
+}
+
+func (p *subIntermediateCAProvider) Sign(ctx context.Context, csr *x509.CertificateRequest) (string, error) {
+	parentPEM, _ := p.ActiveIntermediate()
+	parent, err := connect.ParseCert(parentPEM)
+	if err != nil {
+		return "", err
+	}
+	subKey, _, err := connect.GeneratePrivateKey()
+	if err != nil {
+		return "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(100),
+		Subject:               pkix.Name{CommonName: "Test Sub-Intermediate"},
+		NotBefore:             parent.NotBefore,
+		NotAfter:              parent.NotAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		SubjectKeyId:          []byte("sub-intermediate"),
+	}
+	bs, err := x509.CreateCertificate(rand.Reader, template, parent, subKey.Public(), p.signingKey)
+	if err != nil {
+		return "", err
+	}
+	subPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: bs}))
+
+	sub := &mockCAProvider{intermediatePem: subPEM, signingKey: subKey}
+	leafPEM, err := sub.Sign(ctx, csr)
+	if err != nil {
+		return "", err
+	}
+	return leafPEM + subPEM, nil
+}
+
+func TestCADelegateWithState_GenerateCASignRequest(t *testing.T) {
+	s := Server{config: &Config{PrimaryDatacenter: "east"}, tokens: new(token.Store)}
+	d := &caDelegateWithState{Server: &s}
+	req := d.generateCASignRequest("A")
+	require.Equal(t, "east", req.RequestDatacenter())
+}
+
+func TestCAManager_Initialize_Logging(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+	_, conf1 := testServerConfig(t)
+
+	// Setup dummy logger to catch output
+	var buf bytes.Buffer
+	logger := testutil.LoggerWithOutput(t, &buf)
+
+	deps := newDefaultDeps(t, conf1)
+	deps.Logger = logger
+
+	s1, err := NewServer(conf1, deps)
+	require.NoError(t, err)
+	defer s1.Shutdown()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	// Wait til CA root is setup
+	retry.Run(t, func(r *retry.R) {
+		var out structs.IndexedCARoots
+		r.Check(s1.RPC("ConnectCA.Roots", structs.DCSpecificRequest{
+			Datacenter: conf1.Datacenter,
+		}, &out))
+	})
+
+	require.Contains(t, buf.String(), "consul CA provider configured")
+}
+
+func TestCAManager_UpdateConfiguration_KeyDowngrade(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+	_, conf1 := testServerConfig(t)
+	conf1.CAConfig.Config["PrivateKeyType"] = "ec"
+	conf1.CAConfig.Config["PrivateKeyBits"] = 384
+
+	var buf bytes.Buffer
+	deps := newDefaultDeps(t, conf1)
+	deps.Logger = testutil.LoggerWithOutput(t, &buf)
+
+	s1, err := NewServer(conf1, deps)
+	require.NoError(t, err)
+	defer s1.Shutdown()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	rotate := func(keyType string, keyBits int, acknowledge bool) {
+		t.Helper()
+		_, before, err := s1.fsm.State().CARootActive(nil)
+		require.NoError(t, err)
+		require.NoError(t, s1.caManager.UpdateConfiguration(&structs.CARequest{
+			Config: &structs.CAConfiguration{
+				Provider: "consul",
+				Config: map[string]interface{}{
+					"LeafCertTTL":             "72h",
+					"PrivateKeyType":          keyType,
+					"PrivateKeyBits":          keyBits,
+					"AcknowledgeKeyDowngrade": acknowledge,
+				},
+			},
+		}))
+		_, after, err := s1.fsm.State().CARootActive(nil)
+		require.NoError(t, err)
+		require.NotEqual(t, before.ID, after.ID)
+		require.Equal(t, keyBits, after.PrivateKeyBits)
+	}
+	const warning = "new CA root has a weaker key than the previous one; set AcknowledgeKeyDowngrade"
+
+	// An acknowledged downgrade, from a P-384 curve to RSA 4096, is only logged.
+	rotate("rsa", 4096, true)
+	require.NotContains(t, buf.String(), warning)
+	require.Contains(t, buf.String(), "as acknowledged in the CA configuration")
+
+	// Going from RSA 4096 to 2048 without acknowledging it is warned about.
+	rotate("rsa", 2048, false)
+	require.Contains(t, buf.String(), warning)
+	require.Contains(t, buf.String(), "previous_key=rsa-4096 new_key=rsa-2048")
+
+	// Moving to a key of the same strength isn't a downgrade.
+	mark := buf.Len()
+	rotate("ec", 224, false)
+	require.NotContains(t, buf.String()[mark:], warning)
+}
+
+func TestCAManager_UpgradeKeyStrength(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+	_, s1 := testServerWithConfig(t, func(c *Config) {
+		c.CAConfig.Config["PrivateKeyType"] = "ec"
+		c.CAConfig.Config["PrivateKeyBits"] = 256
+	})
+	defer s1.Shutdown()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	_, oldRoot, err := s1.fsm.State().CARootActive(nil)
+	require.NoError(t, err)
+	require.Equal(t, "ec", oldRoot.PrivateKeyType)
+	require.Equal(t, 256, oldRoot.PrivateKeyBits)
+
+	// Keys that aren't stronger, or that the configuration doesn't allow, are
+	// refused without rotating.
+	err = s1.caManager.UpgradeKeyStrength(structs.CAKeySpec{PrivateKeyType: "ec", PrivateKeyBits: 224})
+	require.ErrorIs(t, err, ErrKeyNotStronger)
+	err = s1.caManager.UpgradeKeyStrength(structs.CAKeySpec{PrivateKeyType: "rsa", PrivateKeyBits: 2048})
+	require.ErrorIs(t, err, ErrKeyNotStronger)
+	err = s1.caManager.UpgradeKeyStrength(structs.CAKeySpec{PrivateKeyType: "ec", PrivateKeyBits: 512})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is not compatible with the CA configuration")
+	_, root, err := s1.fsm.State().CARootActive(nil)
+	require.NoError(t, err)
+	require.Equal(t, oldRoot.ID, root.ID)
+
+	require.NoError(t, s1.caManager.UpgradeKeyStrength(structs.CAKeySpec{PrivateKeyType: "ec", PrivateKeyBits: 384}))
+
+	_, roots, err := s1.fsm.State().CARoots(nil)
+	require.NoError(t, err)
+	require.Len(t, roots, 2)
+	newRoot := roots.Active()
+	require.NotNil(t, newRoot)
+	require.NotEqual(t, oldRoot.ID, newRoot.ID)
+	require.Equal(t, "ec", newRoot.PrivateKeyType)
+	require.Equal(t, 384, newRoot.PrivateKeyBits)
+	newCert, err := connect.ParseCert(newRoot.RootCert)
+	require.NoError(t, err)
+	keyType, keyBits, err := connect.KeyInfoFromCert(newCert)
+	require.NoError(t, err)
+	require.Equal(t, "ec", keyType)
+	require.Equal(t, 384, keyBits)
+
+	// The previous root is still published, and cross-signs the new one so
+	// that leaf certificates from either chain to both.
+	for _, r := range roots {
+		if r.ID == oldRoot.ID {
+			require.False(t, r.Active)
+		}
+	}
+	require.Len(t, newRoot.IntermediateCerts, 1)
+	crossCert, err := connect.ParseCert(newRoot.IntermediateCerts[0])
+	require.NoError(t, err)
+	oldCert, err := connect.ParseCert(oldRoot.RootCert)
+	require.NoError(t, err)
+	require.NoError(t, crossCert.CheckSignatureFrom(oldCert))
+
+	// The configuration records the new key.
+	_, config, err := s1.fsm.State().CAConfig(nil)
+	require.NoError(t, err)
+	commonCfg, err := config.GetCommonConfig()
+	require.NoError(t, err)
+	require.Equal(t, "ec", commonCfg.PrivateKeyType)
+	require.Equal(t, 384, commonCfg.PrivateKeyBits)
+}
+
+func TestCAManager_SignCertificate_CertTemplates(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+	_, s1 := testServerWithConfig(t, func(c *Config) {
+		c.CAConfig.Config["LeafCertTTL"] = "72h"
+		c.CAConfig.Config["CertTemplates"] = map[string]interface{}{
+			"gateway": map[string]interface{}{
+				"LeafCertTTL": "96h",
+				"PolicyOIDs":  []string{"1.3.6.1.4.1.99999.1"},
+			},
+			"default": map[string]interface{}{
+				"ExtKeyUsage": []string{"client_auth", "server_auth"},
+			},
+			"signer": map[string]interface{}{
+				"KeyUsage": []string{"digital_signature", "key_encipherment", "content_commitment"},
+			},
+		}
+		c.CAConfig.Config["CertTemplateRules"] = []map[string]interface{}{
+			{"IdentityType": "service", "Pattern": "*-gateway", "Template": "gateway"},
+			{"IdentityType": "service", "Pattern": "signer", "Template": "signer"},
+		}
+		c.CAConfig.Config["DefaultCertTemplate"] = "default"
+	})
+	defer s1.Shutdown()
+	testrpc.WaitForActiveCARoot(t, s1.RPC, "dc1", nil)
+	retry.Run(t, func(r *retry.R) {
+		if _, root := s1.caManager.getCAProvider(); root == nil {
+			r.Fatal("CA provider not set yet")
+		}
+	})
+
+	sign := func(t *testing.T, service string) *x509.Certificate {
+		t.Helper()
+		spiffeID := connect.TestSpiffeIDService(t, service)
+		csrPEM, _ := connect.TestCSR(t, spiffeID)
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		issued, err := s1.caManager.SignCertificate(csr, spiffeID)
+		require.NoError(t, err)
+		cert, err := connect.ParseCert(issued.CertPEM)
+		require.NoError(t, err)
+		return cert
+	}
+
+	gateway := sign(t, "ingress-gateway")
+	require.Equal(t, 96*time.Hour, gateway.NotAfter.Sub(gateway.NotBefore))
+	require.Len(t, gateway.PolicyIdentifiers, 1)
+	require.Equal(t, "1.3.6.1.4.1.99999.1", gateway.PolicyIdentifiers[0].String())
+
+	web := sign(t, "web")
+	require.Equal(t, 72*time.Hour, web.NotAfter.Sub(web.NotBefore))
+	require.Empty(t, web.PolicyIdentifiers)
+	require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}, web.ExtKeyUsage)
+	require.Equal(t, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment|
+		x509.KeyUsageDataEncipherment|x509.KeyUsageKeyAgreement, web.KeyUsage)
+
+	// The configured key usages replace the default ones, and keep those mTLS
+	// requires.
+	signer := sign(t, "signer")
+	require.Equal(t, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment|x509.KeyUsageContentCommitment, signer.KeyUsage)
+	require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}, signer.ExtKeyUsage)
+}
+
+func TestCAManager_SignCertificate_ServiceLeafCertTTL(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+	_, s1 := testServerWithConfig(t, func(c *Config) {
+		c.CAConfig.Config["LeafCertTTL"] = "72h"
+		c.CAConfig.Config["MaxServiceLeafCertTTL"] = "96h"
+	})
+	defer s1.Shutdown()
+	testrpc.WaitForActiveCARoot(t, s1.RPC, "dc1", nil)
+	retry.Run(t, func(r *retry.R) {
+		if _, root := s1.caManager.getCAProvider(); root == nil {
+			r.Fatal("CA provider not set yet")
+		}
+	})
+
+	sign := func(t *testing.T, service string) time.Duration {
+		t.Helper()
+		spiffeID := connect.TestSpiffeIDService(t, service)
+		csrPEM, _ := connect.TestCSR(t, spiffeID)
+		csr, err := connect.ParseCSR(csrPEM)
+		require.NoError(t, err)
+		issued, err := s1.caManager.SignCertificate(csr, spiffeID)
+		require.NoError(t, err)
+		return issued.ValidBefore.Sub(issued.ValidAfter)
+	}
+	setTTL := func(t *testing.T, idx uint64, service string, ttl time.Duration) {
+		t.Helper()
+		require.NoError(t, s1.fsm.State().EnsureConfigEntry(idx, &structs.ServiceConfigEntry{
+			Kind:        structs.ServiceDefaults,
+			Name:        service,
+			LeafCertTTL: ttl,
+		}))
+	}
+
+	require.Equal(t, 72*time.Hour, sign(t, "api"))
+
+	setTTL(t, 100, "api", 24*time.Hour)
+	require.Equal(t, 24*time.Hour, sign(t, "api"))
+	require.Equal(t, 72*time.Hour, sign(t, "web"))
+
+	// A TTL above MaxServiceLeafCertTTL is bounded by it.
+	setTTL(t, 101, "api", 200*time.Hour)
+	require.Equal(t, 96*time.Hour, sign(t, "api"))
+	require.Equal(t, 72*time.Hour, sign(t, "web"))
+}
+
+func TestCAManager_SignPublicKey_LeafParams(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+	_, s1 := testServerWithConfig(t, func(c *Config) {
+		c.CAConfig.Config["LeafCertTTL"] = "72h"
+		c.CAConfig.Config["MaxServiceLeafCertTTL"] = "96h"
+		c.CAConfig.Config["CertTemplates"] = map[string]interface{}{
+			"gateway": map[string]interface{}{
+				"LeafCertTTL": "96h",
+				"PolicyOIDs":  []string{"1.3.6.1.4.1.99999.1"},
+			},
+		}
+		c.CAConfig.Config["CertTemplateRules"] = []map[string]interface{}{
+			{"IdentityType": "service", "Pattern": "*-gateway", "Template": "gateway"},
+		}
+	})
+	defer s1.Shutdown()
+	testrpc.WaitForActiveCARoot(t, s1.RPC, "dc1", nil)
+	retry.Run(t, func(r *retry.R) {
+		if _, root := s1.caManager.getCAProvider(); root == nil {
+			r.Fatal("CA provider not set yet")
+		}
+	})
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	sign := func(t *testing.T, service string) *x509.Certificate {
+		t.Helper()
+		issued, err := s1.caManager.SignPublicKeyWithContext(context.Background(), &key.PublicKey,
+			connect.TestSpiffeIDService(t, service), structs.CAChainOrderLeafFirst)
+		require.NoError(t, err)
+		cert, err := connect.ParseCert(issued.CertPEM)
+		require.NoError(t, err)
+		return cert
+	}
+	hasLocation := func(cert *x509.Certificate) bool {
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(connect.OIDExtensionIssuerLocation) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Certificates signed for a public key get the same parameters as those
+	// signed for a CSR.
+	require.NoError(t, s1.fsm.State().EnsureConfigEntry(100, &structs.ServiceConfigEntry{
+		Kind:        structs.ServiceDefaults,
+		Name:        "api",
+		LeafCertTTL: 24 * time.Hour,
+	}))
+	api := sign(t, "api")
+	require.Equal(t, 24*time.Hour, api.NotAfter.Sub(api.NotBefore))
+	require.True(t, hasLocation(api))
+
+	gateway := sign(t, "ingress-gateway")
+	require.Equal(t, 96*time.Hour, gateway.NotAfter.Sub(gateway.NotBefore))
+	require.Len(t, gateway.PolicyIdentifiers, 1)
+	require.Equal(t, "1.3.6.1.4.1.99999.1", gateway.PolicyIdentifiers[0].String())
+	require.True(t, hasLocation(gateway))
+}
+
+func TestCAManager_SignCertificate_IdentityRateLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+	caConfig := func(leafCertTTL string) map[string]interface{} {
+		return map[string]interface{}{
+			"LeafCertTTL":         leafCertTTL,
+			"IntermediateCertTTL": "8760h",
+			// Only the limit per identity applies, and doesn't refill during
+			// the test.
+			"CSRMaxPerSecond":            0,
+			"CSRMaxPerSecondPerIdentity": 0.0001,
+			"CSRBurstPerIdentity":        3,
+		}
+	}
+	_, s1 := testServerWithConfig(t, func(c *Config) {
+		c.CAConfig.Config = caConfig("72h")
+	})
+	defer s1.Shutdown()
+	testrpc.WaitForActiveCARoot(t, s1.RPC, "dc1", nil)
+	retry.Run(t, func(r *retry.R) {
+		if _, root := s1.caManager.getCAProvider(); root == nil {
+			r.Fatal("CA provider not set yet")
+		}
+	})
 
-	for _, arg := range args {
-		t.Run(arg.testName, func(t *testing.T) {
-			// No parallel execution because we change globals
-			// Set the interval and drift buffer low for renewing the cert.
-			origInterval := structs.IntermediateCertRenewInterval
-			origDriftBuffer := ca.CertificateTimeDriftBuffer
-			defer func() {
-				structs.IntermediateCertRenewInterval = origInterval
-				ca.CertificateTimeDriftBuffer = origDriftBuffer
+	sign := func(service string) error {
+		spiffeID := connect.TestSpiffeIDService(t, service)
+		csrPEM, _ := connect.TestCSR(t, spiffeID)
+		csr, err := connect.ParseCSR(csrPEM)
+		if err != nil {
+			return err
+		}
+		_, err = s1.caManager.SignCertificate(csr, spiffeID)
+		return err
+	}
+	signConcurrently := func(service string, n int) (signed int, errs []error) {
+		var wg sync.WaitGroup
+		var lock sync.Mutex
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := sign(service)
+				lock.Lock()
+				defer lock.Unlock()
+				if err == nil {
+					signed++
+				} else {
+					errs = append(errs, err)
+				}
 			}()
-			structs.IntermediateCertRenewInterval = time.Millisecond
-			ca.CertificateTimeDriftBuffer = 0
+		}
+		wg.Wait()
+		return signed, errs
+	}
 
-			conf := DefaultConfig()
-			conf.ConnectEnabled = true
-			conf.PrimaryDatacenter = "dc1"
-			conf.Datacenter = "dc2"
+	// Only the burst of the identity is signed, the other requests are
+	// rejected with a rate limit error clients retry on.
+	signed, errs := signConcurrently("web", 10)
+	require.Equal(t, 3, signed)
+	require.Len(t, errs, 7)
+	for _, err := range errs {
+		require.True(t, errors.Is(err, ErrRateLimited), err)
+		require.Equal(t, ErrRateLimited.Error(), err.Error())
+		var limitErr identityRateLimitedError
+		require.True(t, errors.As(err, &limitErr), err)
+		require.Equal(t, connect.TestSpiffeIDService(t, "web").URI().String(), limitErr.identity)
+	}
 
-			rootPEM := generateCertPEM(t, caPrivKey, arg.notBeforeRoot, arg.notAfterRoot)
-			intermediatePEM := generateCertPEM(t, caPrivKey, arg.notBeforeIntermediate, arg.notAfterIntermediate)
+	// Other identities aren't held back by the limit of web.
+	require.NoError(t, sign("api"))
 
-			delegate := NewMockCAServerDelegate(t, conf)
-			delegate.primaryRoot.RootCert = rootPEM
-			delegate.secondaryIntermediate = intermediatePEM
-			manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	// Reconfiguring the CA resets the limits.
+	require.NoError(t, s1.caManager.UpdateConfiguration(&structs.CARequest{
+		Config: &structs.CAConfiguration{
+			Provider: "consul",
+			Config:   caConfig("96h"),
+		},
+	}))
+	signed, errs = signConcurrently("web", 4)
+	require.Equal(t, 3, signed)
+	require.Len(t, errs, 1)
+}
 
-			manager.providerShim = &mockCAProvider{
-				callbackCh:      delegate.callbackCh,
-				rootPEM:         rootPEM,
-				intermediatePem: intermediatePEM,
-			}
-			initTestManager(t, manager, delegate)
+func TestIdentitySignLimiter(t *testing.T) {
+	var l identitySignLimiter
+	now := time.Now()
+
+	// A burst of 2 refilling at a token per second.
+	require.True(t, l.allow("web", 1, 2, now))
+	require.True(t, l.allow("web", 1, 2, now))
+	require.False(t, l.allow("web", 1, 2, now))
+	require.True(t, l.allow("api", 1, 2, now))
+	require.True(t, l.allow("web", 1, 2, now.Add(time.Second)))
+	require.False(t, l.allow("web", 1, 2, now.Add(time.Second)))
+
+	// A change of the limits replaces the limiter of the identity.
+	require.True(t, l.allow("web", 1, 3, now.Add(time.Second)))
+
+	// Identities idle until their limiter filled up again are forgotten.
+	later := now.Add(identityLimiterPruneInterval + time.Hour)
+	require.True(t, l.allow("db", 1, 3, later))
+	require.Len(t, l.limiters, 1)
+	require.Contains(t, l.limiters, "db")
+
+	l.reset()
+	require.Empty(t, l.limiters)
+}
 
-			// Simulate Wait half the TTL for the cert to need renewing.
-			manager.timeNow = func() time.Time {
-				return time.Now().UTC().Add(500 * time.Millisecond)
-			}
+func TestCAManager_UpdateConfiguration_Unchanged(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	_, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+	})
+	defer func() {
+		s1.Shutdown()
+		s1.leaderRoutineManager.Wait()
+	}()
 
-			// Call RenewIntermediate and then confirm the RPCs and provider calls
-			// happen in the expected order.
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
 
-			_, err := manager.SignCertificate(&x509.CertificateRequest{}, &connect.SpiffeIDAgent{})
-			if arg.isError {
-				require.Error(t, err)
-				require.Contains(t, err.Error(), arg.errorMsg)
-			} else {
-				require.NoError(t, err)
-			}
-		})
+	update := func(leafCertTTL string) {
+		t.Helper()
+		require.NoError(t, s1.caManager.UpdateConfiguration(&structs.CARequest{
+			Config: &structs.CAConfiguration{
+				Provider: "consul",
+				Config: map[string]interface{}{
+					"LeafCertTTL":         leafCertTTL,
+					"IntermediateCertTTL": "8760h",
+				},
+			},
+		}))
 	}
-}
 
-func generateCertPEM(t *testing.T, caPrivKey *rsa.PrivateKey, notBefore time.Time, notAfter time.Time) string {
-	t.Helper()
-	ca := &x509.Certificate{
-		SerialNumber: big.NewInt(2019),
-		Subject: pkix.Name{
-			Organization:  []string{"Company, INC."},
-			Country:       []string{"US"},
-			Province:      []string{""},
-			Locality:      []string{"San Francisco"},
-			StreetAddress: []string{"Golden Gate Bridge"},
-			PostalCode:    []string{"94016"},
-		},
-		NotBefore:             notBefore,
-		NotAfter:              notAfter,
-		IsCA:                  true,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
-		BasicConstraintsValid: true,
-		URIs:                  []*url.URL{connect.SpiffeIDAgent{Host: "foo"}.URI()},
+	update("96h")
+	_, origConfig, err := s1.fsm.State().CAConfig(nil)
+	require.NoError(t, err)
+	_, origRoot, err := s1.fsm.State().CARootActive(nil)
+	require.NoError(t, err)
+
+	// Applying the same configuration again, verbatim or spelled differently,
+	// leaves the CA untouched. Only the configuration as written is stored.
+	for _, ttl := range []string{"96h", "96h0m0s", "5760m"} {
+		update(ttl)
+
+		_, config, err := s1.fsm.State().CAConfig(nil)
+		require.NoError(t, err)
+		if ttl == "96h" {
+			require.Equal(t, origConfig.ModifyIndex, config.ModifyIndex)
+		}
+		require.Equal(t, ttl, config.Config["LeafCertTTL"])
+		require.Equal(t, origConfig.State, config.State)
+
+		_, root, err := s1.fsm.State().CARootActive(nil)
+		require.NoError(t, err)
+		require.Equal(t, origRoot.ID, root.ID)
+		require.Equal(t, origRoot.ModifyIndex, root.ModifyIndex)
 	}
 
-	caBytes, err := x509.CreateCertificate(rand.Reader, ca, ca, &caPrivKey.PublicKey, caPrivKey)
-	require.NoError(t, err, "failed to create cert")
+	// An actual change is still applied.
+	update("48h")
+	_, config, err := s1.fsm.State().CAConfig(nil)
+	require.NoError(t, err)
+	require.Equal(t, "48h", config.Config["LeafCertTTL"])
+}
 
-	caPEM := new(bytes.Buffer)
-	err = pem.Encode(caPEM, &pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: caBytes,
-	})
-	require.NoError(t, err, "failed to encode")
-	return caPEM.String()
+// rootSigningCAProvider is a mockCAProvider for the primary datacenter which
+// signs leaf certificates with its root.
+type rootSigningCAProvider struct {
+	mockCAProvider
 }
 
-func TestCADelegateWithState_GenerateCASignRequest(t *testing.T) {
-	s := Server{config: &Config{PrimaryDatacenter: "east"}, tokens: new(token.Store)}
-	d := &caDelegateWithState{Server: &s}
-	req := d.generateCASignRequest("A")
-	require.Equal(t, "east", req.RequestDatacenter())
+func (p *rootSigningCAProvider) GenerateIntermediate() (string, error) {
+	return p.rootPEM, nil
 }
 
-func TestCAManager_Initialize_Logging(t *testing.T) {
-	if testing.Short() {
-		t.Skip("too slow for testing.Short")
+func TestCAManager_UpdateConfiguration_ProviderSwapWithoutCrossSigning(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc1"
+
+	newRoot := connect.TestCA(t, nil)
+	swapConfig := func(force bool) *structs.CARequest {
+		return &structs.CARequest{
+			Config: &structs.CAConfiguration{
+				Provider: "consul",
+				Config: map[string]interface{}{
+					"PrivateKey":          newRoot.SigningKey,
+					"RootCert":            newRoot.RootCert,
+					"LeafCertTTL":         "72h",
+					"IntermediateCertTTL": "2160h",
+				},
+				ForceWithoutCrossSigning: force,
+			},
+		}
 	}
 
-	t.Parallel()
-	_, conf1 := testServerConfig(t)
+	// newManager returns a manager initialized with the mock provider, which
+	// can't cross-sign, and the given CA configuration.
+	newManager := func(t *testing.T, caConf *structs.CAConfiguration) (*CAManager, *mockCAServerDelegate) {
+		delegate := NewMockCAServerDelegate(t, conf)
+		delegate.primaryRoot = connect.TestCA(t, nil)
+		go func() {
+			for range delegate.callbackCh {
+			}
+		}()
+		t.Cleanup(func() { close(delegate.callbackCh) })
+		require.NoError(t, delegate.store.CASetConfig(2, caConf))
+
+		manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+		manager.providerShim = &rootSigningCAProvider{mockCAProvider{
+			callbackCh: delegate.callbackCh,
+			rootPEM:    delegate.primaryRoot.RootCert,
+			signingKey: testParseSigner(t, delegate.primaryRoot.SigningKey),
+		}}
+		require.NoError(t, manager.Initialize())
+		return manager, delegate
+	}
 
-	// Setup dummy logger to catch output
-	var buf bytes.Buffer
-	logger := testutil.LoggerWithOutput(t, &buf)
+	activeRootID := func(t *testing.T, delegate *mockCAServerDelegate) string {
+		_, root, err := delegate.store.CARootActive(nil)
+		require.NoError(t, err)
+		return root.ID
+	}
 
-	deps := newDefaultDeps(t, conf1)
-	deps.Logger = logger
+	t.Run("refused without force", func(t *testing.T) {
+		manager, delegate := newManager(t, testCAConfig())
 
-	s1, err := NewServer(conf1, deps)
-	require.NoError(t, err)
-	defer s1.Shutdown()
-	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+		err := manager.UpdateConfiguration(swapConfig(false))
+		require.ErrorIs(t, err, ErrCrossSigningUnsupported)
+		require.Contains(t, err.Error(), "won't be trusted by proxies")
+		require.Contains(t, err.Error(), "ForceWithoutCrossSigning")
+		require.Equal(t, delegate.primaryRoot.ID, activeRootID(t, delegate))
 
-	// Wait til CA root is setup
-	retry.Run(t, func(r *retry.R) {
-		var out structs.IndexedCARoots
-		r.Check(s1.RPC("ConnectCA.Roots", structs.DCSpecificRequest{
-			Datacenter: conf1.Datacenter,
-		}, &out))
+		require.NoError(t, manager.UpdateConfiguration(swapConfig(true)))
+		require.Equal(t, newRoot.ID, activeRootID(t, delegate))
 	})
 
-	require.Contains(t, buf.String(), "consul CA provider configured")
+	t.Run("new root already a trust anchor", func(t *testing.T) {
+		caConf := testCAConfig()
+		caConf.Config["AdditionalTrustAnchors"] = []string{newRoot.RootCert}
+		manager, delegate := newManager(t, caConf)
+
+		require.NoError(t, manager.UpdateConfiguration(swapConfig(false)))
+		require.Equal(t, newRoot.ID, activeRootID(t, delegate))
+	})
 }
 
 func TestCAManager_UpdateConfiguration_Vault_Primary(t *testing.T) {
@@ -620,6 +4351,167 @@ func TestCAManager_UpdateConfiguration_Vault_Primary(t *testing.T) {
 	require.Equal(t, connect.HexString(cert.SubjectKeyId), newRoot.SigningKeyID)
 }
 
+func TestCAManager_SignCertificate_Vault_DelegatedLeafSigning(t *testing.T) {
+	ca.SkipIfVaultNotPresent(t)
+	vault := ca.NewTestVaultServer(t)
+
+	_, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+		c.CAConfig = &structs.CAConfiguration{
+			Provider: "vault",
+			Config: map[string]interface{}{
+				"Address":              vault.Addr,
+				"Token":                vault.RootToken,
+				"RootPKIPath":          "pki-root/",
+				"IntermediatePKIPath":  "pki-intermediate/",
+				"DelegatedLeafSigning": true,
+			},
+		}
+	})
+	defer func() {
+		s1.Shutdown()
+		s1.leaderRoutineManager.Wait()
+	}()
+
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	_, root, err := s1.fsm.State().CARootActive(nil)
+	require.NoError(t, err)
+
+	spiffeID := connect.TestSpiffeIDService(t, "web")
+	csrPEM, _ := connect.TestCSR(t, spiffeID)
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+
+	issued, err := s1.caManager.SignCertificate(csr, spiffeID)
+	require.NoError(t, err)
+
+	// The leaf is signed by the sub-intermediate, which is signed by the
+	// intermediate of the active root.
+	authorityKeyID, issuerKeyID, err := connect.LeafAuthorityKeyIDs(issued.CertPEM)
+	require.NoError(t, err)
+	require.NotEqual(t, root.SigningKeyID, authorityKeyID)
+	require.Equal(t, root.SigningKeyID, issuerKeyID)
+
+	leaf, intermediates, err := connect.ParseLeafCerts(issued.CertPEM)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM([]byte(root.RootCert)))
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	require.NoError(t, err)
+}
+
+func TestCAManager_UpdateProviderCredentials_Vault(t *testing.T) {
+	ca.SkipIfVaultNotPresent(t)
+	vault := ca.NewTestVaultServer(t)
+
+	createToken := func(t *testing.T) string {
+		secret, err := vault.Client().Auth().Token().Create(&vaultapi.TokenCreateRequest{})
+		require.NoError(t, err)
+		return secret.Auth.ClientToken
+	}
+	oldToken := createToken(t)
+
+	_, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+		c.CAConfig = &structs.CAConfiguration{
+			Provider: "vault",
+			Config: map[string]interface{}{
+				"Address":             vault.Addr,
+				"Token":               oldToken,
+				"RootPKIPath":         "pki-root/",
+				"IntermediatePKIPath": "pki-intermediate/",
+			},
+		}
+	})
+	defer func() {
+		s1.Shutdown()
+		s1.leaderRoutineManager.Wait()
+	}()
+
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+	codec := rpcClient(t, s1)
+	defer codec.Close()
+
+	_, origRoot, err := s1.fsm.State().CARootActive(nil)
+	require.NoError(t, err)
+
+	// A token Vault doesn't know about is refused and the provider is kept.
+	err = s1.caManager.UpdateProviderCredentials(map[string]interface{}{"Token": "not-a-token"})
+	require.Error(t, err)
+
+	// Rotate the token and revoke the old one.
+	newToken := createToken(t)
+	require.NoError(t, s1.caManager.UpdateProviderCredentials(map[string]interface{}{"Token": newToken}))
+	require.NoError(t, vault.Client().Auth().Token().RevokeTree(oldToken))
+
+	_, conf, err := s1.fsm.State().CAConfig(nil)
+	require.NoError(t, err)
+	require.Equal(t, newToken, conf.Config["Token"])
+
+	// Signing continues under the same root.
+	_, root, err := s1.fsm.State().CARootActive(nil)
+	require.NoError(t, err)
+	require.Equal(t, origRoot.ID, root.ID)
+	leafPEM := getLeafCert(t, codec, root.ExternalTrustDomain, "dc1")
+	verifyLeafCert(t, root, leafPEM)
+}
+
+func TestCAManager_UpdateConfiguration_Vault_TTLLimits(t *testing.T) {
+	ca.SkipIfVaultNotPresent(t)
+	vault := ca.NewTestVaultServer(t)
+
+	// The intermediate PKI mount caps the TTL of leaf certificates.
+	err := vault.Client().Sys().Mount("pki-intermediate/", &vaultapi.MountInput{
+		Type: "pki",
+		Config: vaultapi.MountConfigInput{
+			MaxLeaseTTL: "2h",
+		},
+	})
+	require.NoError(t, err)
+
+	_, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+		c.CAConfig = &structs.CAConfiguration{
+			Provider: "vault",
+			Config: map[string]interface{}{
+				"Address":             vault.Addr,
+				"Token":               vault.RootToken,
+				"RootPKIPath":         "pki-root/",
+				"IntermediatePKIPath": "pki-intermediate/",
+				"LeafCertTTL":         "1h",
+			},
+		}
+	})
+	defer func() {
+		s1.Shutdown()
+		s1.leaderRoutineManager.Wait()
+	}()
+
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	_, conf, err := s1.fsm.State().CAConfig(nil)
+	require.NoError(t, err)
+	newConf := *conf
+	newConf.Config = map[string]interface{}{}
+	for k, v := range conf.Config {
+		newConf.Config[k] = v
+	}
+	newConf.Config["LeafCertTTL"] = "3h"
+
+	err = s1.caManager.UpdateConfiguration(&structs.CARequest{Config: &newConf})
+	require.EqualError(t, err, "LeafCertTTL 3h0m0s exceeds the maximum of 2h0m0s supported by the vault CA provider")
+
+	// The configuration was left as is.
+	_, conf, err = s1.fsm.State().CAConfig(nil)
+	require.NoError(t, err)
+	require.Equal(t, "1h", conf.Config["LeafCertTTL"])
+}
+
 func TestCAManager_Initialize_Vault_WithIntermediateAsPrimaryCA(t *testing.T) {
 	if testing.Short() {
 		t.Skip("too slow for testing.Short")
@@ -785,7 +4677,9 @@ func TestCAManager_Initialize_Vault_WithExternalTrustedCA(t *testing.T) {
 	runStep(t, "renew leaf signing CA in primary", func(t *testing.T) {
 		previous := serverDC1.caManager.getLeafSigningCertFromRoot(roots.Active())
 
-		renewLeafSigningCert(t, serverDC1.caManager, serverDC1.caManager.primaryRenewIntermediate)
+		renewLeafSigningCert(t, serverDC1.caManager, func(provider ca.Provider, root *structs.CARoot) error {
+			return serverDC1.caManager.primaryRenewIntermediate(context.Background(), provider, root)
+		})
 
 		codec := rpcClient(t, serverDC1)
 		roots = structs.IndexedCARoots{}
@@ -984,3 +4878,91 @@ func setupPrimaryCA(t *testing.T, client *vaultapi.Client, path string, rootPEM
 	require.NoError(t, err, "failed to set signed intermediate")
 	return ca.EnsureTrailingNewline(buf.String())
 }
+
+func TestCAManager_checkKeyIDCollision(t *testing.T) {
+	ca1 := connect.TestCA(t, nil)
+	ca2 := connect.TestCA(t, nil)
+	manager := &CAManager{logger: testutil.Logger(t)}
+
+	require.NoError(t, manager.checkKeyIDCollision(ca2, structs.CARoots{ca1}))
+
+	// The same root being renewed isn't a collision.
+	renewed := ca1.Clone()
+	require.NoError(t, manager.checkKeyIDCollision(renewed, structs.CARoots{ca1}))
+
+	// A leaf signing cert reusing the key of another root is.
+	reused := ca2.Clone()
+	reused.SigningKeyID = ca1.SigningKeyID
+	err := manager.checkKeyIDCollision(reused, structs.CARoots{ca1})
+	require.True(t, errors.Is(err, ErrSigningKeyIDCollision))
+}
+
+// concurrencyCAProvider is a mockCAProvider tracking how many intermediates
+// it signs concurrently.
+type concurrencyCAProvider struct {
+	mockCAProvider
+	active int32
+	max    int32
+	signed int32
+}
+
+func (m *concurrencyCAProvider) SignIntermediate(context.Context, *x509.CertificateRequest) (string, error) {
+	active := atomic.AddInt32(&m.active, 1)
+	defer atomic.AddInt32(&m.active, -1)
+	for {
+		max := atomic.LoadInt32(&m.max)
+		if active <= max || atomic.CompareAndSwapInt32(&m.max, max, active) {
+			break
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	atomic.AddInt32(&m.signed, 1)
+	return m.intermediatePem, nil
+}
+
+func TestCAManager_SignIntermediate_MaxConcurrent(t *testing.T) {
+	conf := DefaultConfig()
+	conf.ConnectEnabled = true
+	conf.PrimaryDatacenter = "dc1"
+	conf.Datacenter = "dc1"
+	delegate := NewMockCAServerDelegate(t, conf)
+	caConf := testCAConfig()
+	caConf.Config["IntermediateSignMaxConcurrent"] = 3
+	require.NoError(t, delegate.store.CASetConfig(1, caConf))
+
+	manager := NewCAManager(delegate, nil, testutil.Logger(t), conf)
+	provider := &concurrencyCAProvider{mockCAProvider: mockCAProvider{
+		callbackCh:      delegate.callbackCh,
+		rootPEM:         delegate.primaryRoot.RootCert,
+		intermediatePem: "intermediate",
+	}}
+	manager.setCAProvider(provider, delegate.primaryRoot)
+
+	csrPEM, _ := connect.TestCSR(t, &connect.SpiffeIDSigning{ClusterID: connect.TestClusterID, Domain: "consul"})
+	csr, err := connect.ParseCSR(csrPEM)
+	require.NoError(t, err)
+
+	// Simulate many secondaries forwarding their requests at once.
+	const secondaries = 20
+	var wg sync.WaitGroup
+	errCh := make(chan error, secondaries)
+	for i := 0; i < secondaries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pem, err := manager.SignIntermediate(csr)
+			if err == nil && pem != "intermediate" {
+				err = fmt.Errorf("unexpected intermediate %q", pem)
+			}
+			errCh <- err
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(secondaries), atomic.LoadInt32(&provider.signed))
+	require.Equal(t, int32(3), atomic.LoadInt32(&provider.max))
+}
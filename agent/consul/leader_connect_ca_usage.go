@@ -0,0 +1,97 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+
+	"github.com/hashicorp/consul/agent/connect/ca"
+)
+
+// providerUsageInterval is how often the leader asks a provider implementing
+// ca.UsageReporter for its usage. It is longer than the leaf inventory
+// interval as the provider usually has to query its cloud API.
+var providerUsageInterval = 5 * time.Minute
+
+// providerUsage is the usage last reported by the CA provider.
+type providerUsage struct {
+	lock     sync.Mutex
+	reported bool
+	issued   int64
+	quota    int64
+}
+
+func (u *providerUsage) set(issued, quota int64) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.reported, u.issued, u.quota = true, issued, quota
+}
+
+func (u *providerUsage) get() (issued, quota int64, reported bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return u.issued, u.quota, u.reported
+}
+
+func (u *providerUsage) reset() {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.reported, u.issued, u.quota = false, 0, 0
+}
+
+// providerUsageOf returns the usage reported by provider, or an error wrapping
+// ca.ErrUsageNotSupported when it doesn't implement ca.UsageReporter.
+func providerUsageOf(provider ca.Provider) (issued, quota int64, err error) {
+	reporter, ok := provider.(ca.UsageReporter)
+	if !ok {
+		return 0, 0, ca.ErrUsageNotSupported
+	}
+	return reporter.Usage()
+}
+
+// runProviderUsageMetrics periodically emits the number of certificates the
+// CA provider issued in its billing period and how many its quota has left,
+// for providers reporting their usage.
+func (c *CAManager) runProviderUsageMetrics(ctx context.Context) error {
+	ticker := time.NewTicker(providerUsageInterval)
+	defer ticker.Stop()
+
+	c.emitProviderUsageMetrics()
+	for {
+		select {
+		case <-ctx.Done():
+			// Don't let a follower report the usage it saw as a leader.
+			c.usage.reset()
+			metrics.SetGauge(metricsKeyCAProviderIssued, float32(math.NaN()))
+			metrics.SetGauge(metricsKeyCAProviderQuotaRemaining, float32(math.NaN()))
+			return nil
+		case <-ticker.C:
+			c.emitProviderUsageMetrics()
+		}
+	}
+}
+
+func (c *CAManager) emitProviderUsageMetrics() {
+	provider, _ := c.getCAProvider()
+	if provider == nil {
+		return
+	}
+	issued, quota, err := providerUsageOf(provider)
+	if errors.Is(err, ca.ErrUsageNotSupported) {
+		return
+	}
+	if err != nil {
+		c.logger.Warn("failed to get the usage of the CA provider", "error", err)
+		return
+	}
+
+	c.usage.set(issued, quota)
+	metrics.SetGauge(metricsKeyCAProviderIssued, float32(issued))
+	if quota > 0 {
+		metrics.SetGauge(metricsKeyCAProviderQuotaRemaining, float32(quota-issued))
+	}
+}
@@ -95,7 +95,7 @@ func TestConnectCA_ConfigurationSet_ChangeKeyConfig_Primary(t *testing.T) {
 					leafCsr, err := connect.ParseCSR(raw)
 					require.NoError(t, err)
 
-					leafPEM, err := provider.Sign(leafCsr)
+					leafPEM, err := provider.Sign(context.Background(), leafCsr)
 					require.NoError(t, err)
 
 					// Check that the leaf signed by the new cert can be verified using the
@@ -157,7 +157,7 @@ func TestConnectCA_ConfigurationSet_ChangeKeyConfig_Primary(t *testing.T) {
 					leafCsr, err := connect.ParseCSR(raw)
 					require.NoError(t, err)
 
-					leafPEM, err := newProvider.Sign(leafCsr)
+					leafPEM, err := newProvider.Sign(context.Background(), leafCsr)
 					require.NoError(t, err)
 
 					// Check that the leaf signed by the new cert can be verified using the
@@ -290,7 +290,7 @@ func TestCAManager_Initialize_Secondary(t *testing.T) {
 			leafCsr, err := connect.ParseCSR(raw)
 			require.NoError(t, err)
 
-			leafPEM, err := secondaryProvider.Sign(leafCsr)
+			leafPEM, err := secondaryProvider.Sign(context.Background(), leafCsr)
 			require.NoError(t, err)
 
 			// Check that the leaf signed by the new cert can be verified using the
@@ -330,6 +330,12 @@ func TestCAManager_RenewIntermediate_Vault_Primary(t *testing.T) {
 	// no parallel execution because we change globals
 	patchIntermediateCertRenewInterval(t)
 
+	// Leaves expire CertificateTimeDriftBuffer before the intermediate, which
+	// doesn't live that long here.
+	origDriftBuffer := ca.CertificateTimeDriftBuffer
+	t.Cleanup(func() { ca.CertificateTimeDriftBuffer = origDriftBuffer })
+	ca.CertificateTimeDriftBuffer = 0
+
 	testVault := ca.NewTestVaultServer(t)
 
 	_, s1 := testServerWithConfig(t, func(c *Config) {
@@ -406,6 +412,90 @@ func TestCAManager_RenewIntermediate_Vault_Primary(t *testing.T) {
 	verifyLeafCert(t, activeRoot, cert.CertPEM)
 }
 
+func TestCAManager_SignCertificate_Secondary_IssuingChain(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+
+	_, s1 := testServerWithConfig(t, func(c *Config) {
+		c.Datacenter = "dc1"
+		c.PrimaryDatacenter = "dc1"
+	})
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	_, s2 := testServerWithConfig(t, func(c *Config) {
+		c.Datacenter = "dc2"
+		c.PrimaryDatacenter = "dc1"
+		c.CAConfig.Config["IncludeIssuingChain"] = true
+	})
+	joinWAN(t, s2, s1)
+	testrpc.WaitForActiveCARoot(t, s2.RPC, "dc2", nil)
+	retry.Run(t, func(r *retry.R) {
+		provider, root := getCAProviderWithLock(s2)
+		require.NotNil(r, provider)
+		require.NotNil(r, root)
+	})
+
+	_, primaryRoot := getCAProviderWithLock(s1)
+	spiffeService := &connect.SpiffeIDService{
+		Host:       connect.TestClusterID + ".consul",
+		Namespace:  "default",
+		Datacenter: "dc2",
+		Service:    "web",
+	}
+	csr, _ := connect.TestCSR(t, spiffeService)
+
+	req := structs.CASignRequest{Datacenter: "dc2", CSR: csr}
+	cert := structs.IssuedCert{}
+	codec := rpcClient(t, s2)
+	require.NoError(t, msgpackrpc.CallWithCodec(codec, "ConnectCA.Sign", &req, &cert))
+	require.NotEmpty(t, cert.IntermediateCerts)
+
+	// The leaf verifies against the root of the primary with the returned
+	// chain alone.
+	leaf, err := connect.ParseCert(cert.CertPEM)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM([]byte(primaryRoot.RootCert)))
+	intermediates := x509.NewCertPool()
+	for _, p := range cert.IntermediateCerts {
+		require.True(t, intermediates.AppendCertsFromPEM([]byte(p)))
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	require.NoError(t, err)
+
+	// The chain starts with the intermediate of the secondary.
+	secondaryProvider, _ := getCAProviderWithLock(s2)
+	intermediatePEM, err := secondaryProvider.ActiveIntermediate()
+	require.NoError(t, err)
+	require.Equal(t, ca.EnsureTrailingNewline(intermediatePEM), cert.IntermediateCerts[0])
+
+	// Without the option the chain isn't returned.
+	_, s3 := testServerWithConfig(t, func(c *Config) {
+		c.Datacenter = "dc3"
+		c.PrimaryDatacenter = "dc1"
+	})
+	joinWAN(t, s3, s1)
+	testrpc.WaitForActiveCARoot(t, s3.RPC, "dc3", nil)
+	retry.Run(t, func(r *retry.R) {
+		provider, root := getCAProviderWithLock(s3)
+		require.NotNil(r, provider)
+		require.NotNil(r, root)
+	})
+	spiffeService.Datacenter = "dc3"
+	csr, _ = connect.TestCSR(t, spiffeService)
+	req = structs.CASignRequest{Datacenter: "dc3", CSR: csr}
+	cert = structs.IssuedCert{}
+	require.NoError(t, msgpackrpc.CallWithCodec(rpcClient(t, s3), "ConnectCA.Sign", &req, &cert))
+	require.Empty(t, cert.IntermediateCerts)
+}
+
 func patchIntermediateCertRenewInterval(t *testing.T) {
 	origInterval := structs.IntermediateCertRenewInterval
 	origMinTTL := structs.MinLeafCertTTL
@@ -439,10 +529,11 @@ func TestCAManager_RenewIntermediate_Secondary(t *testing.T) {
 				// the ttl needs to be below so that it
 				// triggers definitely.
 				// Since certs are created so that they are
-				// valid from 1minute in the past, we need to
-				// account for that, otherwise it will be
-				// expired immediately.
-				"IntermediateCertTTL": time.Minute + (5 * time.Second),
+				// valid from 1minute in the past, and leaves
+				// expire 1minute before the intermediate, we
+				// need to account for that, otherwise it will
+				// be expired immediately.
+				"IntermediateCertTTL": 2*time.Minute + (5 * time.Second),
 			},
 		}
 	})
@@ -650,7 +741,7 @@ func TestConnectCA_ConfigurationSet_RootRotation_Secondary(t *testing.T) {
 	leafCsr, err := connect.ParseCSR(raw)
 	require.NoError(t, err)
 
-	leafPEM, err := secondaryProvider.Sign(leafCsr)
+	leafPEM, err := secondaryProvider.Sign(context.Background(), leafCsr)
 	require.NoError(t, err)
 
 	cert, err := connect.ParseCert(leafPEM)
@@ -670,6 +761,78 @@ func TestConnectCA_ConfigurationSet_RootRotation_Secondary(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestCAManager_SecondaryRootWatch_RotationDebounce(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for testing.Short")
+	}
+
+	t.Parallel()
+
+	_, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+	})
+	defer s1.Shutdown()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	const debounce = 2 * time.Second
+	_, s2 := testServerWithConfig(t, func(c *Config) {
+		c.Datacenter = "dc2"
+		c.PrimaryDatacenter = "dc1"
+		c.ConnectCASecondaryRotationDebounce = debounce
+	})
+	defer s2.Shutdown()
+
+	joinWAN(t, s2, s1)
+	testrpc.WaitForLeader(t, s2.RPC, "dc2")
+
+	_, originalRoot, err := getTestRoots(s1, "dc1")
+	require.NoError(t, err)
+	testrpc.WaitForActiveCARoot(t, s2.RPC, "dc2", originalRoot)
+
+	secondaryProvider, _ := getCAProviderWithLock(s2)
+	oldIntermediatePEM, err := secondaryProvider.ActiveIntermediate()
+	require.NoError(t, err)
+
+	// Rotate the primary's root.
+	_, newKey, err := connect.GeneratePrivateKey()
+	require.NoError(t, err)
+	var reply interface{}
+	require.NoError(t, s1.RPC("ConnectCA.ConfigurationSet", &structs.CARequest{
+		Datacenter: "dc1",
+		Config: &structs.CAConfiguration{
+			Provider: "consul",
+			Config: map[string]interface{}{
+				"PrivateKey": newKey,
+				"RootCert":   "",
+			},
+		},
+	}, &reply))
+	rotatedAt := time.Now()
+
+	_, newRoot, err := getTestRoots(s1, "dc1")
+	require.NoError(t, err)
+	require.NotEqual(t, originalRoot.ID, newRoot.ID)
+
+	// The secondary waits for the debounce before renewing its intermediate.
+	time.Sleep(debounce / 2)
+	intermediatePEM, err := secondaryProvider.ActiveIntermediate()
+	require.NoError(t, err)
+	require.Equal(t, oldIntermediatePEM, intermediatePEM)
+
+	testrpc.WaitForActiveCARoot(t, s2.RPC, "dc2", newRoot)
+	retry.Run(t, func(r *retry.R) {
+		intermediatePEM, err = secondaryProvider.ActiveIntermediate()
+		r.Check(err)
+		if intermediatePEM == oldIntermediatePEM {
+			r.Fatal("not a new intermediate")
+		}
+	})
+	require.GreaterOrEqual(t, time.Since(rotatedAt), debounce)
+
+	// The new intermediate chains to the new root of the primary.
+	require.NoError(t, verifyChainsToRoot(intermediatePEM, newRoot.RootCert))
+}
+
 func TestCAManager_Initialize_Vault_FixesSigningKeyID_Primary(t *testing.T) {
 	ca.SkipIfVaultNotPresent(t)
 
@@ -1065,7 +1228,7 @@ func TestCAManager_Initialize_SecondaryBeforePrimary(t *testing.T) {
 	leafCsr, err := connect.ParseCSR(raw)
 	require.NoError(t, err)
 
-	leafPEM, err := secondaryProvider.Sign(leafCsr)
+	leafPEM, err := secondaryProvider.Sign(context.Background(), leafCsr)
 	require.NoError(t, err)
 
 	cert, err := connect.ParseCert(leafPEM)
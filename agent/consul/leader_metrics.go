@@ -18,6 +18,20 @@ import (
 
 var metricsKeyMeshRootCAExpiry = []string{"mesh", "active-root-ca", "expiry"}
 var metricsKeyMeshActiveSigningCAExpiry = []string{"mesh", "active-signing-ca", "expiry"}
+var metricsKeyCALeavesActive = []string{"connect", "ca", "leaves", "active"}
+var metricsKeyCALeavesExpiringSoon = []string{"connect", "ca", "leaves", "expiring_soon"}
+var metricsKeyCAIdentitiesDormant = []string{"connect", "ca", "identities", "dormant"}
+var metricsKeyCAIntermediateRenewalStalled = []string{"connect", "ca", "intermediate_renewal_stalled"}
+var metricsKeyCAKeyDowngrade = []string{"connect", "ca", "key_downgrade"}
+var metricsKeyCAAuditDropped = []string{"connect", "ca", "audit", "dropped"}
+var metricsKeyCANewIdentity = []string{"connect", "ca", "new_identity"}
+var metricsKeyCAProviderIssued = []string{"connect", "ca", "provider", "issued"}
+var metricsKeyCAProviderQuotaRemaining = []string{"connect", "ca", "provider", "quota_remaining"}
+var metricsKeyCAState = []string{"connect", "ca", "state"}
+var metricsKeyCAStateSeconds = []string{"connect", "ca", "state", "seconds"}
+var metricsKeyCAStateCurrentSeconds = []string{"connect", "ca", "state", "current_seconds"}
+var metricsKeyCARootExpiry = []string{"connect", "ca", "root", "expiry"}
+var metricsKeyCAIntermediateExpiry = []string{"connect", "ca", "intermediate", "expiry"}
 
 var LeaderCertExpirationGauges = []prometheus.GaugeDefinition{
 	{
@@ -30,6 +44,83 @@ var LeaderCertExpirationGauges = []prometheus.GaugeDefinition{
 	},
 }
 
+var LeaderCALeafGauges = []prometheus.GaugeDefinition{
+	{
+		Name: metricsKeyCALeavesActive,
+		Help: "Number of unexpired leaf certificates signed by the leader. Updated every minute",
+	},
+	{
+		Name: metricsKeyCALeavesExpiringSoon,
+		Help: "Number of unexpired leaf certificates signed by the leader that expire within the configured horizon. Updated every minute",
+	},
+	{
+		Name: metricsKeyCAIdentitiesDormant,
+		Help: "Number of identities the leader signed leaf certificates for, but none within the configured window. Updated every minute",
+	},
+}
+
+var LeaderCAProviderGauges = []prometheus.GaugeDefinition{
+	{
+		Name: metricsKeyCAProviderIssued,
+		Help: "Number of certificates the CA provider issued in its current billing period, for providers reporting it. Updated every 5 minutes",
+	},
+	{
+		Name: metricsKeyCAProviderQuotaRemaining,
+		Help: "Number of certificates the CA provider can still issue in its current billing period, for providers with a quota. Updated every 5 minutes",
+	},
+}
+
+var LeaderCAExpiryGauges = []prometheus.GaugeDefinition{
+	{
+		Name: metricsKeyCARootExpiry,
+		Help: "Seconds until the active root certificate expires. Updated every minute and whenever the roots change",
+	},
+	{
+		Name: metricsKeyCAIntermediateExpiry,
+		Help: "Seconds until the certificate signing leaf certificates expires, which is the active intermediate or the root when it signs leaves. Updated every minute and whenever the roots change",
+	},
+}
+
+// CAStateGauges and CAStateCounters are emitted by every server, as each one
+// runs a CAManager, even though only the leader's leaves the UNINITIALIZED
+// state.
+var CAStateGauges = []prometheus.GaugeDefinition{
+	{
+		Name: metricsKeyCAState,
+		Help: "Set to 1 for the current state of the CA manager, and to 0 for the other states.",
+	},
+	{
+		Name: metricsKeyCAStateCurrentSeconds,
+		Help: "Seconds the CA manager has spent in its current state, and 0 for the other states. Updated every 10 seconds and whenever the state changes.",
+	},
+}
+
+var CAStateCounters = []prometheus.CounterDefinition{
+	{
+		Name: metricsKeyCAStateSeconds,
+		Help: "Increments by the number of seconds the CA manager spent in a transient state, such as RENEWING, when it leaves it.",
+	},
+}
+
+var LeaderCACounters = []prometheus.CounterDefinition{
+	{
+		Name: metricsKeyCAIntermediateRenewalStalled,
+		Help: "Increments when renewing the intermediate fails with less than a quarter of its lifetime left.",
+	},
+	{
+		Name: metricsKeyCAKeyDowngrade,
+		Help: "Increments when a rotated root or renewed intermediate has a weaker key than the one it replaces, unless acknowledged in the CA configuration.",
+	},
+	{
+		Name: metricsKeyCAAuditDropped,
+		Help: "Increments when the record of a signed leaf certificate is dropped instead of being delivered to the CA audit sink.",
+	},
+	{
+		Name: metricsKeyCANewIdentity,
+		Help: "Increments when the first leaf certificate of a SPIFFE identity is signed, while the CA audit sink is configured.",
+	},
+}
+
 func rootCAExpiryMonitor(s *Server) CertExpirationMonitor {
 	return CertExpirationMonitor{
 		Key:    metricsKeyMeshRootCAExpiry,
@@ -149,4 +240,13 @@ func initLeaderMetrics() {
 	for _, g := range LeaderCertExpirationGauges {
 		metrics.SetGaugeWithLabels(g.Name, float32(math.NaN()), g.ConstLabels)
 	}
+	for _, g := range LeaderCALeafGauges {
+		metrics.SetGaugeWithLabels(g.Name, float32(math.NaN()), g.ConstLabels)
+	}
+	for _, g := range LeaderCAProviderGauges {
+		metrics.SetGaugeWithLabels(g.Name, float32(math.NaN()), g.ConstLabels)
+	}
+	for _, g := range LeaderCAExpiryGauges {
+		metrics.SetGaugeWithLabels(g.Name, float32(math.NaN()), g.ConstLabels)
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"github.com/hashicorp/go-hclog"
 	"google.golang.org/grpc"
 
+	"github.com/hashicorp/consul/agent/connect/ca"
 	"github.com/hashicorp/consul/agent/pool"
 	"github.com/hashicorp/consul/agent/router"
 	"github.com/hashicorp/consul/agent/token"
@@ -18,6 +19,18 @@ type Deps struct {
 	ConnPool        *pool.ConnPool
 	GRPCConnPool    GRPCClientConner
 	LeaderForwarder LeaderForwarder
+	// CAProviderDeps are the optional dependencies of the Connect CA
+	// providers, such as the HTTP client to reach Vault with.
+	CAProviderDeps ca.ProviderDeps
+	// CAPostSignHook is called with every leaf certificate signed by the
+	// Connect CA, if set.
+	CAPostSignHook CAPostSignHook
+	// CAEventObserver is notified of the milestones of the Connect CA
+	// lifecycle, if set.
+	CAEventObserver CAEventObserver
+	// CAProviderStateStore persists the large Connect CA provider state
+	// values outside of raft, if set.
+	CAProviderStateStore ProviderStateStore
 	EnterpriseDeps
 }
 
@@ -561,6 +561,13 @@ func canRetry(info structs.RPCInfo, err error, start time.Time, config *Config)
 		return true
 	}
 
+	// Sign requests made while the CA isn't ready are refused before changing
+	// anything, so they are safe to retry as well. The error crossed the RPC
+	// boundary so only its message is left.
+	if err != nil && strings.Contains(err.Error(), ErrCANotReady.Error()) {
+		return true
+	}
+
 	// If we are chunking and it doesn't seem to have completed, try again.
 	if err != nil && strings.Contains(err.Error(), ErrChunkingResubmit.Error()) {
 		return true
@@ -1298,6 +1298,11 @@ func TestCanRetry(t *testing.T) {
 			err:      fmt.Errorf("some wrapping: %w", structs.ErrNoLeader),
 			expected: true,
 		},
+		{
+			name:     "CA not ready error",
+			err:      errors.New(fmt.Errorf("%w: CA state is INITIALIZING", ErrCANotReady).Error()),
+			expected: true,
+		},
 		{
 			name:     "EOF on read request",
 			req:      isReadRequest{},
@@ -42,12 +42,14 @@ import (
 	"github.com/hashicorp/consul/agent/metadata"
 	"github.com/hashicorp/consul/agent/pool"
 	"github.com/hashicorp/consul/agent/router"
+	"github.com/hashicorp/consul/agent/rpc/connectca"
 	"github.com/hashicorp/consul/agent/rpc/subscribe"
 	"github.com/hashicorp/consul/agent/structs"
 	"github.com/hashicorp/consul/agent/token"
 	"github.com/hashicorp/consul/lib"
 	"github.com/hashicorp/consul/lib/routine"
 	"github.com/hashicorp/consul/logging"
+	"github.com/hashicorp/consul/proto/pbconnectca"
 	"github.com/hashicorp/consul/proto/pbsubscribe"
 	"github.com/hashicorp/consul/tlsutil"
 	"github.com/hashicorp/consul/types"
@@ -116,6 +118,12 @@ const (
 	secondaryCARootWatchRoutineName       = "secondary CA roots watch"
 	intermediateCertRenewWatchRoutineName = "intermediate cert renew watch"
 	backgroundCAInitializationRoutineName = "CA initialization"
+	caProviderReconcileRoutineName        = "CA provider reconcile"
+	caLeafInventoryRoutineName            = "CA leaf inventory metric"
+	caProviderUsageRoutineName            = "CA provider usage metric"
+	caAuditDeliveryRoutineName            = "CA audit delivery"
+	caSeenIdentityPruningRoutineName      = "CA seen identity pruning"
+	caExpiryMetricRoutineName             = "CA expiry metric"
 	virtualIPCheckRoutineName             = "virtual IP version check"
 )
 
@@ -482,6 +490,13 @@ func NewServer(config *Config, flat Deps) (*Server, error) {
 	}
 
 	s.caManager = NewCAManager(&caDelegateWithState{Server: s}, s.leaderRoutineManager, s.logger.ResetNamed("connect.ca"), s.config)
+	s.caManager.providerDeps = flat.CAProviderDeps
+	s.caManager.postSignHook = flat.CAPostSignHook
+	s.caManager.eventObserver = flat.CAEventObserver
+	if flat.CAProviderStateStore != nil {
+		s.caManager.providerStateStore = flat.CAProviderStateStore
+	}
+	go s.caManager.runStateMetrics(&lib.StopChannelContext{StopCh: s.shutdownCh})
 	if s.config.ConnectEnabled && (s.config.AutoEncryptAllowTLS || s.config.AutoConfigAuthzEnabled) {
 		go s.connectCARootsMonitor(&lib.StopChannelContext{StopCh: s.shutdownCh})
 	}
@@ -652,6 +667,9 @@ func newGRPCHandlerFromConfig(deps Deps, config *Config, s *Server) connHandler
 				&subscribeBackend{srv: s, connPool: deps.GRPCConnPool},
 				deps.Logger.Named("grpc-api.subscription")))
 		}
+		pbconnectca.RegisterConnectCAServiceServer(srv, connectca.NewServer(
+			&connectCABackend{srv: s, connPool: deps.GRPCConnPool},
+			deps.Logger.Named("grpc-api.connect-ca")))
 		s.registerEnterpriseGRPCServices(deps, srv)
 	}
 
@@ -1,7 +1,10 @@
 package consul
 
 import (
+	"bytes"
+	"crypto/x509"
 	"fmt"
+	"strings"
 
 	"github.com/hashicorp/go-memdb"
 
@@ -31,8 +34,18 @@ func (s *Server) getCARoots(ws memdb.WatchSet, state *state.Store) (*structs.Ind
 	}
 
 	indexedRoots.TrustDomain = signingID.Host()
+	commonCfg, err := config.GetCommonConfig()
+	if err == nil {
+		indexedRoots.PreviousTrustDomain = strings.ToLower(commonCfg.PreviousTrustDomain)
+	}
+
+	if config.ForceRenewBefore != nil {
+		forceRenewBefore := *config.ForceRenewBefore
+		indexedRoots.ForceRenewBefore = &forceRenewBefore
+	}
 
 	indexedRoots.Index, indexedRoots.Roots = index, roots
+	indexedRoots.SpiffeSequence = roots.BundleSequence()
 	if indexedRoots.Roots == nil {
 		indexedRoots.Roots = make(structs.CARoots, 0)
 	}
@@ -70,7 +83,141 @@ func (s *Server) getCARoots(ws memdb.WatchSet, state *state.Store) (*structs.Ind
 		if r.Active {
 			indexedRoots.ActiveRootID = r.ID
 		}
+		applyRootsChainValidation(indexedRoots.Roots[i], s.config.ConnectCARootsChainValidation)
+	}
+
+	// Additional trust anchors come from the configuration rather than the
+	// stored roots, so they can't be selected as the active root.
+	if commonCfg != nil && len(commonCfg.AdditionalTrustAnchors) > 0 &&
+		s.caManager.caFeatureEnabled(caFeatureMultiRootBundles) {
+		stored := indexedRoots.Roots
+		for _, anchorPEM := range commonCfg.AdditionalTrustAnchors {
+			// The configuration was refused if it had colliding anchors, but
+			// one may start colliding after a rotation.
+			if commonCfg.FederationCollisionPolicy == structs.FederationCollisionReject &&
+				trustAnchorCollides(config, anchorPEM, stored) {
+				continue
+			}
+			anchor, err := newTrustAnchor(anchorPEM)
+			if err != nil {
+				return nil, fmt.Errorf("invalid additional trust anchor: %w", err)
+			}
+			if !containsRootID(indexedRoots.Roots, anchor.ID) {
+				indexedRoots.Roots = append(indexedRoots.Roots, anchor)
+			}
+		}
 	}
 
 	return indexedRoots, nil
 }
+
+// newTrustAnchor returns the structs.CARoot published for an additional trust
+// anchor of the CA configuration.
+func newTrustAnchor(pemValue string) (*structs.CARoot, error) {
+	anchor, err := newCARoot(ca.EnsureTrailingNewline(pemValue), "", "")
+	if err != nil {
+		return nil, err
+	}
+	anchor.Name = "Additional Trust Anchor"
+	anchor.SigningKeyID = ""
+	anchor.Active = false
+	anchor.TrustAnchorOnly = true
+	return anchor, nil
+}
+
+// containsRootID returns whether roots has a root with the given ID.
+func containsRootID(roots structs.CARoots, id string) bool {
+	for _, r := range roots {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// RootsChainValidation is how the roots served to clients are checked for
+// IntermediateCerts that don't chain up to their root cert. Older clients fail
+// to load a bundle with such a chain, which can happen transiently during a
+// rotation.
+type RootsChainValidation string
+
+const (
+	// RootsChainValidationOff serves the roots as they are stored.
+	RootsChainValidationOff RootsChainValidation = "off"
+
+	// RootsChainValidationFlag serves the roots as they are stored, with the
+	// ChainError of inconsistent roots set.
+	RootsChainValidationFlag RootsChainValidation = "flag"
+
+	// RootsChainValidationOmit omits the intermediates that don't chain up
+	// to their root cert, and sets the ChainError of the roots they were
+	// omitted from. The roots themselves are always served.
+	RootsChainValidationOmit RootsChainValidation = "omit"
+)
+
+// applyRootsChainValidation checks the chain of root, a copy served to
+// clients, according to mode.
+func applyRootsChainValidation(root *structs.CARoot, mode RootsChainValidation) {
+	if mode == RootsChainValidationOff || mode == "" || len(root.IntermediateCerts) == 0 {
+		return
+	}
+	bad, err := inconsistentIntermediates(root)
+	if err == nil {
+		return
+	}
+	root.ChainError = err.Error()
+	if mode != RootsChainValidationOmit {
+		return
+	}
+	var kept []string
+	for i, p := range root.IntermediateCerts {
+		if !bad[i] {
+			kept = append(kept, p)
+		}
+	}
+	root.IntermediateCerts = kept
+}
+
+// inconsistentIntermediates returns which IntermediateCerts of root, by index,
+// don't chain up to its root cert through its other intermediates, along with
+// an error describing the first of them. Cross-signed copies of the root,
+// which carry its key but were signed by a previous root, are consistent.
+func inconsistentIntermediates(root *structs.CARoot) (map[int]bool, error) {
+	rootCert, err := connect.ParseCert(root.RootCert)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing root cert: %w", err)
+	}
+
+	bad := make(map[int]bool)
+	var firstErr error
+	for i := range root.IntermediateCerts {
+		err := intermediateChainsToRootCert(root, i, rootCert)
+		if err == nil {
+			continue
+		}
+		bad[i] = true
+		if firstErr == nil {
+			firstErr = fmt.Errorf("intermediate %d of %d: %w", i+1, len(root.IntermediateCerts), err)
+		}
+	}
+	return bad, firstErr
+}
+
+// intermediateChainsToRootCert returns an error unless the intermediate i of
+// root chains up to rootCert.
+func intermediateChainsToRootCert(root *structs.CARoot, i int, rootCert *x509.Certificate) error {
+	cert, err := connect.ParseCert(root.IntermediateCerts[i])
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(cert.RawSubjectPublicKeyInfo, rootCert.RawSubjectPublicKeyInfo) {
+		return nil
+	}
+	chain := ca.EnsureTrailingNewline(root.IntermediateCerts[i])
+	for j, p := range root.IntermediateCerts {
+		if j != i {
+			chain += ca.EnsureTrailingNewline(p)
+		}
+	}
+	return verifyChainsToRoot(chain, root.RootCert)
+}
@@ -2,9 +2,11 @@ package state
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/go-memdb"
-	"github.com/pkg/errors"
 
 	"github.com/hashicorp/consul/agent/structs"
 )
@@ -13,7 +15,10 @@ const (
 	tableConnectCABuiltin       = "connect-ca-builtin"
 	tableConnectCABuiltinSerial = "connect-ca-builtin-serial"
 	tableConnectCAConfig        = "connect-ca-config"
+	tableConnectCAConfigHistory = "connect-ca-config-history"
 	tableConnectCARoots         = "connect-ca-roots"
+	tableConnectCARootHistory   = "connect-ca-root-history"
+	tableConnectCASeenIdentity  = "connect-ca-seen-identities"
 	tableConnectCALeafCerts     = "connect-ca-leaf-certs"
 )
 
@@ -74,6 +79,60 @@ func caRootTableSchema() *memdb.TableSchema {
 	}
 }
 
+// caRootHistoryTableSchema returns a new table schema used for storing the
+// history of CA roots for Connect, including when each root was active.
+func caRootHistoryTableSchema() *memdb.TableSchema {
+	return &memdb.TableSchema{
+		Name: tableConnectCARootHistory,
+		Indexes: map[string]*memdb.IndexSchema{
+			"id": {
+				Name:         "id",
+				AllowMissing: false,
+				Unique:       true,
+				Indexer: &memdb.StringFieldIndex{
+					Field: "ID",
+				},
+			},
+		},
+	}
+}
+
+// caConfigHistoryTableSchema returns a new table schema used for storing the
+// history of the changes to the CA configuration.
+func caConfigHistoryTableSchema() *memdb.TableSchema {
+	return &memdb.TableSchema{
+		Name: tableConnectCAConfigHistory,
+		Indexes: map[string]*memdb.IndexSchema{
+			"id": {
+				Name:         "id",
+				AllowMissing: false,
+				Unique:       true,
+				Indexer: &memdb.UintFieldIndex{
+					Field: "ID",
+				},
+			},
+		},
+	}
+}
+
+// caSeenIdentityTableSchema returns a new table schema used for storing the
+// SPIFFE identities leaf certificates were signed for.
+func caSeenIdentityTableSchema() *memdb.TableSchema {
+	return &memdb.TableSchema{
+		Name: tableConnectCASeenIdentity,
+		Indexes: map[string]*memdb.IndexSchema{
+			"id": {
+				Name:         "id",
+				AllowMissing: false,
+				Unique:       true,
+				Indexer: &memdb.StringFieldIndex{
+					Field: "ID",
+				},
+			},
+		},
+	}
+}
+
 // CAConfig is used to pull the CA config from the snapshot.
 func (s *Snapshot) CAConfig() (*structs.CAConfiguration, error) {
 	c, err := s.tx.First(tableConnectCAConfig, "id")
@@ -159,7 +218,7 @@ func (s *Store) CACheckAndSetConfig(idx, cidx uint64, config *structs.CAConfigur
 	// return early here.
 	e, ok := existing.(*structs.CAConfiguration)
 	if (ok && e.ModifyIndex != cidx) || (!ok && cidx != 0) {
-		return false, errors.Errorf("ModifyIndex did not match existing")
+		return false, ErrCAConfigModifyIndexMismatch
 	}
 
 	if err := s.caSetConfigTxn(idx, tx, config); err != nil {
@@ -176,12 +235,24 @@ func (s *Store) caSetConfigTxn(idx uint64, tx WriteTxn, config *structs.CAConfig
 	if err != nil {
 		return fmt.Errorf("failed CA config lookup: %s", err)
 	}
-	// Set the indexes, prevent the cluster ID from changing.
+	var prevConfig *structs.CAConfiguration
 	if prev != nil {
-		existing := prev.(*structs.CAConfiguration)
-		config.CreateIndex = existing.CreateIndex
+		prevConfig = prev.(*structs.CAConfiguration)
+	}
+
+	// The additional trust anchors are published along with the roots, so the
+	// SPIFFE bundle changes with them even though the roots don't.
+	if !sameTrustAnchors(prevConfig, config) {
+		if err := caRootsBumpBundleSequenceTxn(tx); err != nil {
+			return err
+		}
+	}
+
+	// Set the indexes, prevent the cluster ID from changing.
+	if prevConfig != nil {
+		config.CreateIndex = prevConfig.CreateIndex
 		if config.ClusterID == "" {
-			config.ClusterID = existing.ClusterID
+			config.ClusterID = prevConfig.ClusterID
 		}
 	} else {
 		config.CreateIndex = idx
@@ -194,6 +265,57 @@ func (s *Store) caSetConfigTxn(idx uint64, tx WriteTxn, config *structs.CAConfig
 	return nil
 }
 
+// sameTrustAnchors returns whether the CA configurations a and b have the same
+// set of additional trust anchors, in any order.
+func sameTrustAnchors(a, b *structs.CAConfiguration) bool {
+	anchors := func(c *structs.CAConfiguration) []string {
+		if c == nil {
+			return nil
+		}
+		commonCfg, err := c.GetCommonConfig()
+		if err != nil {
+			return nil
+		}
+		var out []string
+		for _, anchor := range commonCfg.AdditionalTrustAnchors {
+			out = append(out, strings.TrimSpace(anchor))
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	aAnchors, bAnchors := anchors(a), anchors(b)
+	if len(aAnchors) != len(bAnchors) {
+		return false
+	}
+	for i := range aAnchors {
+		if aAnchors[i] != bAnchors[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// caRootsBumpBundleSequenceTxn stamps the stored roots with the next SPIFFE
+// bundle sequence number without otherwise changing them, so that the index
+// used by CARootSetCAS stays the same.
+func caRootsBumpBundleSequenceTxn(tx WriteTxn) error {
+	_, current, err := caRootsTxn(tx, nil)
+	if err != nil {
+		return err
+	}
+	seq := current.BundleSequence() + 1
+	for _, r := range current {
+		// The stored roots must never be modified in place.
+		updated := r.Clone()
+		updated.BundleSequence = seq
+		if err := tx.Insert(tableConnectCARoots, updated); err != nil {
+			return fmt.Errorf("failed updating CA root: %s", err)
+		}
+	}
+	return nil
+}
+
 // CARoots is used to pull all the CA roots for the snapshot.
 func (s *Snapshot) CARoots() (structs.CARoots, error) {
 	ixns, err := s.tx.Get(tableConnectCARoots, "id")
@@ -281,6 +403,15 @@ func (s *Store) CARootSetCAS(idx, cidx uint64, rs []*structs.CARoot) (bool, erro
 		return false, nil
 	}
 
+	// The roots are stamped with the next SPIFFE bundle sequence number. It is
+	// derived from the stored roots so that every server computes the same one
+	// and it is carried through snapshots.
+	_, current, err := caRootsTxn(tx, nil)
+	if err != nil {
+		return false, err
+	}
+	seq := current.BundleSequence() + 1
+
 	// Go through and find any existing matching CAs so we can preserve and
 	// update their Create/ModifyIndex values.
 	for _, r := range rs {
@@ -299,10 +430,15 @@ func (s *Store) CARootSetCAS(idx, cidx uint64, rs []*structs.CARoot) (bool, erro
 			r.CreateIndex = idx
 		}
 		r.ModifyIndex = idx
+		r.BundleSequence = seq
+	}
+
+	if err := caRootHistoryUpdateTxn(tx, idx, rs); err != nil {
+		return false, err
 	}
 
 	// Delete all
-	_, err := tx.DeleteAll(tableConnectCARoots, "id")
+	_, err = tx.DeleteAll(tableConnectCARoots, "id")
 	if err != nil {
 		return false, err
 	}
@@ -323,6 +459,365 @@ func (s *Store) CARootSetCAS(idx, cidx uint64, rs []*structs.CARoot) (bool, erro
 	return err == nil, err
 }
 
+// caRootHistoryUpdateTxn records the given set of roots in the root history.
+// Entries for roots that are no longer active are closed using the time the
+// leader recorded for the rotation, so that every server derives the same
+// windows.
+func caRootHistoryUpdateTxn(tx WriteTxn, idx uint64, rs []*structs.CARoot) error {
+	newActive := structs.CARoots(rs).Active()
+
+	// The same root may appear twice when an intermediate is renewed: once as
+	// the rotated out copy and once as the active one. The active copy wins.
+	rotatedOutAt := make(map[string]time.Time)
+	for _, r := range rs {
+		if !r.Active && !r.RotatedOutAt.IsZero() && r.ID != newActive.ID {
+			rotatedOutAt[r.ID] = r.RotatedOutAt
+		}
+	}
+
+	// Close the window of the previously active root, even if it is no longer
+	// in the set of roots.
+	iter, err := tx.Get(tableConnectCARootHistory, "id")
+	if err != nil {
+		return fmt.Errorf("failed CA root history lookup: %s", err)
+	}
+	var closed []*structs.CARootHistoryEntry
+	for v := iter.Next(); v != nil; v = iter.Next() {
+		entry := v.(*structs.CARootHistoryEntry)
+		if !entry.Active || entry.ID == newActive.ID {
+			continue
+		}
+		updated := *entry
+		updated.Active = false
+		updated.ActiveUntil = rotatedOutAt[entry.ID]
+		if updated.ActiveUntil.IsZero() {
+			updated.ActiveUntil = newActive.ActivatedAt
+		}
+		updated.ModifyIndex = idx
+		closed = append(closed, &updated)
+	}
+	for _, entry := range closed {
+		if err := tx.Insert(tableConnectCARootHistory, entry); err != nil {
+			return fmt.Errorf("failed updating CA root history: %s", err)
+		}
+	}
+
+	existing, err := tx.First(tableConnectCARootHistory, "id", newActive.ID)
+	if err != nil {
+		return fmt.Errorf("failed CA root history lookup: %s", err)
+	}
+	entry := &structs.CARootHistoryEntry{
+		ID:                  newActive.ID,
+		Name:                newActive.Name,
+		SerialNumber:        newActive.SerialNumber,
+		SigningKeyID:        newActive.SigningKeyID,
+		ExternalTrustDomain: newActive.ExternalTrustDomain,
+		NotBefore:           newActive.NotBefore,
+		NotAfter:            newActive.NotAfter,
+		RootCert:            newActive.RootCert,
+		Active:              true,
+		ActiveFrom:          newActive.ActivatedAt,
+		RotationReason:      newActive.RotationReason,
+		RaftIndex:           structs.RaftIndex{CreateIndex: idx, ModifyIndex: idx},
+	}
+	if existing != nil {
+		prev := existing.(*structs.CARootHistoryEntry)
+		entry.CreateIndex = prev.CreateIndex
+		// Keep the original window start if the root is stored again without
+		// having been rotated out, for example to renew its intermediate.
+		if prev.Active && !prev.ActiveFrom.IsZero() {
+			entry.ActiveFrom = prev.ActiveFrom
+		}
+	}
+	if err := tx.Insert(tableConnectCARootHistory, entry); err != nil {
+		return fmt.Errorf("failed updating CA root history: %s", err)
+	}
+
+	if err := indexUpdateMaxTxn(tx, idx, tableConnectCARootHistory); err != nil {
+		return fmt.Errorf("failed updating index: %s", err)
+	}
+	return nil
+}
+
+// CARootHistory is used to pull the CA root history for the snapshot.
+func (s *Snapshot) CARootHistory() ([]*structs.CARootHistoryEntry, error) {
+	iter, err := s.tx.Get(tableConnectCARootHistory, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*structs.CARootHistoryEntry
+	for v := iter.Next(); v != nil; v = iter.Next() {
+		ret = append(ret, v.(*structs.CARootHistoryEntry))
+	}
+
+	return ret, nil
+}
+
+// CARootHistoryEntry is used when restoring from a snapshot.
+func (s *Restore) CARootHistoryEntry(entry *structs.CARootHistoryEntry) error {
+	if err := s.tx.Insert(tableConnectCARootHistory, entry); err != nil {
+		return fmt.Errorf("failed restoring CA root history: %s", err)
+	}
+	if err := indexUpdateMaxTxn(s.tx, entry.ModifyIndex, tableConnectCARootHistory); err != nil {
+		return fmt.Errorf("failed updating index: %s", err)
+	}
+
+	return nil
+}
+
+// CARootHistory returns every CA root that has been stored, including roots
+// that have since been pruned, ordered by when they were first stored.
+func (s *Store) CARootHistory(ws memdb.WatchSet) (uint64, []*structs.CARootHistoryEntry, error) {
+	tx := s.db.Txn(false)
+	defer tx.Abort()
+
+	idx := maxIndexTxn(tx, tableConnectCARootHistory)
+
+	iter, err := tx.Get(tableConnectCARootHistory, "id")
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed CA root history lookup: %s", err)
+	}
+	ws.Add(iter.WatchCh())
+
+	var results []*structs.CARootHistoryEntry
+	for v := iter.Next(); v != nil; v = iter.Next() {
+		results = append(results, v.(*structs.CARootHistoryEntry))
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].CreateIndex < results[j].CreateIndex
+	})
+	return idx, results, nil
+}
+
+// CAConfigHistory is used to pull the CA configuration history for the
+// snapshot.
+func (s *Snapshot) CAConfigHistory() ([]*structs.CAConfigHistoryEntry, error) {
+	iter, err := s.tx.Get(tableConnectCAConfigHistory, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*structs.CAConfigHistoryEntry
+	for v := iter.Next(); v != nil; v = iter.Next() {
+		ret = append(ret, v.(*structs.CAConfigHistoryEntry))
+	}
+
+	return ret, nil
+}
+
+// CAConfigHistoryEntry is used when restoring from a snapshot.
+func (s *Restore) CAConfigHistoryEntry(entry *structs.CAConfigHistoryEntry) error {
+	if err := s.tx.Insert(tableConnectCAConfigHistory, entry); err != nil {
+		return fmt.Errorf("failed restoring CA config history: %s", err)
+	}
+	if err := indexUpdateMaxTxn(s.tx, entry.ModifyIndex, tableConnectCAConfigHistory); err != nil {
+		return fmt.Errorf("failed updating index: %s", err)
+	}
+
+	return nil
+}
+
+// CAConfigHistory returns the history of the changes to the CA
+// configuration, oldest first.
+func (s *Store) CAConfigHistory(ws memdb.WatchSet) (uint64, []*structs.CAConfigHistoryEntry, error) {
+	tx := s.db.Txn(false)
+	defer tx.Abort()
+
+	idx := maxIndexTxn(tx, tableConnectCAConfigHistory)
+
+	iter, err := tx.Get(tableConnectCAConfigHistory, "id")
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed CA config history lookup: %s", err)
+	}
+	ws.Add(iter.WatchCh())
+
+	var results []*structs.CAConfigHistoryEntry
+	for v := iter.Next(); v != nil; v = iter.Next() {
+		results = append(results, v.(*structs.CAConfigHistoryEntry))
+	}
+	return idx, results, nil
+}
+
+// CARecordConfigChange appends entry to the CA configuration history, and
+// prunes the oldest entries beyond structs.CAConfigHistoryMaxEntries.
+func (s *Store) CARecordConfigChange(idx uint64, entry *structs.CAConfigHistoryEntry) error {
+	tx := s.db.WriteTxn(idx)
+	defer tx.Abort()
+
+	recorded := *entry
+	recorded.ID = idx
+	recorded.CreateIndex = idx
+	recorded.ModifyIndex = idx
+	if err := tx.Insert(tableConnectCAConfigHistory, &recorded); err != nil {
+		return fmt.Errorf("failed recording CA config change: %s", err)
+	}
+
+	iter, err := tx.Get(tableConnectCAConfigHistory, "id")
+	if err != nil {
+		return fmt.Errorf("failed CA config history lookup: %s", err)
+	}
+	var entries []interface{}
+	for v := iter.Next(); v != nil; v = iter.Next() {
+		entries = append(entries, v)
+	}
+	if excess := len(entries) - structs.CAConfigHistoryMaxEntries; excess > 0 {
+		// Entries are ordered by ID, so the oldest come first.
+		for _, v := range entries[:excess] {
+			if err := tx.Delete(tableConnectCAConfigHistory, v); err != nil {
+				return fmt.Errorf("failed pruning CA config history: %s", err)
+			}
+		}
+	}
+
+	if err := indexUpdateMaxTxn(tx, idx, tableConnectCAConfigHistory); err != nil {
+		return fmt.Errorf("failed updating index: %s", err)
+	}
+	return tx.Commit()
+}
+
+// CASeenIdentities is used to pull the seen identities for the snapshot.
+func (s *Snapshot) CASeenIdentities() ([]*structs.CASeenIdentity, error) {
+	iter, err := s.tx.Get(tableConnectCASeenIdentity, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*structs.CASeenIdentity
+	for v := iter.Next(); v != nil; v = iter.Next() {
+		ret = append(ret, v.(*structs.CASeenIdentity))
+	}
+
+	return ret, nil
+}
+
+// CASeenIdentity is used when restoring from a snapshot.
+func (s *Restore) CASeenIdentity(identity *structs.CASeenIdentity) error {
+	if err := s.tx.Insert(tableConnectCASeenIdentity, identity); err != nil {
+		return fmt.Errorf("failed restoring CA seen identity: %s", err)
+	}
+	if err := indexUpdateMaxTxn(s.tx, identity.ModifyIndex, tableConnectCASeenIdentity); err != nil {
+		return fmt.Errorf("failed updating index: %s", err)
+	}
+
+	return nil
+}
+
+// CASeenIdentity returns the record of the SPIFFE identity id, or nil if no
+// leaf certificate was recorded for it.
+func (s *Store) CASeenIdentity(ws memdb.WatchSet, id string) (uint64, *structs.CASeenIdentity, error) {
+	tx := s.db.Txn(false)
+	defer tx.Abort()
+
+	idx := maxIndexTxn(tx, tableConnectCASeenIdentity)
+
+	watchCh, existing, err := tx.FirstWatch(tableConnectCASeenIdentity, "id", id)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed CA seen identity lookup: %s", err)
+	}
+	ws.Add(watchCh)
+
+	if existing == nil {
+		return idx, nil, nil
+	}
+	return idx, existing.(*structs.CASeenIdentity), nil
+}
+
+// CASeenIdentities returns the records of every SPIFFE identity a leaf
+// certificate was signed for.
+func (s *Store) CASeenIdentities(ws memdb.WatchSet) (uint64, []*structs.CASeenIdentity, error) {
+	tx := s.db.Txn(false)
+	defer tx.Abort()
+
+	idx := maxIndexTxn(tx, tableConnectCASeenIdentity)
+
+	iter, err := tx.Get(tableConnectCASeenIdentity, "id")
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed CA seen identity lookup: %s", err)
+	}
+	ws.Add(iter.WatchCh())
+
+	var ret []*structs.CASeenIdentity
+	for v := iter.Next(); v != nil; v = iter.Next() {
+		ret = append(ret, v.(*structs.CASeenIdentity))
+	}
+	return idx, ret, nil
+}
+
+// CARecordSeenIdentity records the SPIFFE identity of a signed leaf
+// certificate. It returns false if the identity was already recorded, in
+// which case only the LastSeen time of the existing record is moved forward.
+func (s *Store) CARecordSeenIdentity(idx uint64, identity *structs.CASeenIdentity) (bool, error) {
+	tx := s.db.WriteTxn(idx)
+	defer tx.Abort()
+
+	existing, err := tx.First(tableConnectCASeenIdentity, "id", identity.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed CA seen identity lookup: %s", err)
+	}
+
+	var entry structs.CASeenIdentity
+	if existing != nil {
+		entry = *existing.(*structs.CASeenIdentity)
+		if !identity.LastSeen.After(entry.LastSeen) {
+			return false, nil
+		}
+		entry.LastSeen = identity.LastSeen
+	} else {
+		entry = *identity
+		entry.CreateIndex = idx
+		if entry.LastSeen.IsZero() {
+			entry.LastSeen = entry.FirstSeen
+		}
+	}
+	entry.ModifyIndex = idx
+	if err := tx.Insert(tableConnectCASeenIdentity, &entry); err != nil {
+		return false, fmt.Errorf("failed recording CA seen identity: %s", err)
+	}
+	if err := indexUpdateMaxTxn(tx, idx, tableConnectCASeenIdentity); err != nil {
+		return false, fmt.Errorf("failed updating index: %s", err)
+	}
+
+	err = tx.Commit()
+	return err == nil && existing == nil, err
+}
+
+// CAPruneSeenIdentities removes the records of the SPIFFE identities last
+// seen before the given time, and returns how many were removed.
+func (s *Store) CAPruneSeenIdentities(idx uint64, before time.Time) (int, error) {
+	tx := s.db.WriteTxn(idx)
+	defer tx.Abort()
+
+	iter, err := tx.Get(tableConnectCASeenIdentity, "id")
+	if err != nil {
+		return 0, fmt.Errorf("failed CA seen identity lookup: %s", err)
+	}
+	var stale []interface{}
+	for v := iter.Next(); v != nil; v = iter.Next() {
+		identity := v.(*structs.CASeenIdentity)
+		lastSeen := identity.LastSeen
+		if lastSeen.IsZero() {
+			lastSeen = identity.FirstSeen
+		}
+		if lastSeen.Before(before) {
+			stale = append(stale, v)
+		}
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+	for _, v := range stale {
+		if err := tx.Delete(tableConnectCASeenIdentity, v); err != nil {
+			return 0, fmt.Errorf("failed pruning CA seen identity: %s", err)
+		}
+	}
+	if err := indexUpdateMaxTxn(tx, idx, tableConnectCASeenIdentity); err != nil {
+		return 0, fmt.Errorf("failed updating index: %s", err)
+	}
+
+	return len(stale), tx.Commit()
+}
+
 // CAProviderState is used to pull the built-in provider states from the snapshot.
 func (s *Snapshot) CAProviderState() ([]*structs.CAConsulProviderState, error) {
 	ixns, err := s.tx.Get(tableConnectCABuiltin, "id")
@@ -340,6 +835,11 @@ func (s *Snapshot) CAProviderState() ([]*structs.CAConsulProviderState, error) {
 
 // CAProviderState is used when restoring from a snapshot.
 func (s *Restore) CAProviderState(state *structs.CAConsulProviderState) error {
+	// Snapshots taken before checksums were introduced are the only way to
+	// get a state without one, so legacy states are given theirs here.
+	if state.Checksum == "" {
+		state.Checksum = state.ComputeChecksum()
+	}
 	if err := s.tx.Insert(tableConnectCABuiltin, state); err != nil {
 		return fmt.Errorf("failed restoring built-in CA state: %s", err)
 	}
@@ -372,6 +872,24 @@ func (s *Store) CAProviderState(id string) (uint64, *structs.CAConsulProviderSta
 	return idx, state, nil
 }
 
+// CAProviderStates returns all the built-in CA provider states.
+func (s *Store) CAProviderStates() (uint64, []*structs.CAConsulProviderState, error) {
+	tx := s.db.Txn(false)
+	defer tx.Abort()
+
+	idx := maxIndexTxn(tx, tableConnectCABuiltin)
+	iter, err := tx.Get(tableConnectCABuiltin, "id")
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed built-in CA state lookup: %s", err)
+	}
+
+	var states []*structs.CAConsulProviderState
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		states = append(states, raw.(*structs.CAConsulProviderState))
+	}
+	return idx, states, nil
+}
+
 // CASetProviderState is used to set the current built-in CA provider state.
 func (s *Store) CASetProviderState(idx uint64, state *structs.CAConsulProviderState) (bool, error) {
 	tx := s.db.WriteTxn(idx)
@@ -390,6 +908,7 @@ func (s *Store) CASetProviderState(idx uint64, state *structs.CAConsulProviderSt
 		state.CreateIndex = idx
 	}
 	state.ModifyIndex = idx
+	state.Checksum = state.ComputeChecksum()
 
 	if err := tx.Insert(tableConnectCABuiltin, state); err != nil {
 		return false, fmt.Errorf("failed updating built-in CA state: %s", err)
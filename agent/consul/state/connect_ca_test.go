@@ -3,6 +3,7 @@ package state
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/consul/sdk/testutil"
 
@@ -209,6 +210,7 @@ func TestStore_CARootSetList(t *testing.T) {
 		CreateIndex: 1,
 		ModifyIndex: 1,
 	}
+	expected.BundleSequence = 1
 	ws = memdb.NewWatchSet()
 	_, roots, err := s.CARoots(ws)
 	assert.Nil(t, err)
@@ -217,6 +219,201 @@ func TestStore_CARootSetList(t *testing.T) {
 	assertDeepEqual(t, expected, *actual)
 }
 
+func TestStore_CARootHistory(t *testing.T) {
+	s := testStateStore(t)
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	ca1 := connect.TestCA(t, nil)
+	ca1.ActivatedAt = start
+	ok, err := s.CARootSetCAS(1, 0, []*structs.CARoot{ca1})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ws := memdb.NewWatchSet()
+	idx, history, err := s.CARootHistory(ws)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), idx)
+	require.Len(t, history, 1)
+	require.Equal(t, ca1.ID, history[0].ID)
+	require.True(t, history[0].Active)
+	require.Equal(t, start, history[0].ActiveFrom)
+	require.True(t, history[0].ActiveUntil.IsZero())
+
+	// Renewing the intermediate stores the active root twice, and must not
+	// change its window.
+	renewed := *ca1
+	renewed.ActivatedAt = start
+	rotatedOut := *ca1
+	rotatedOut.Active = false
+	rotatedOut.RotatedOutAt = start.Add(time.Hour)
+	ok, err = s.CARootSetCAS(2, 1, []*structs.CARoot{&rotatedOut, &renewed})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, watchFired(ws))
+
+	_, history, err = s.CARootHistory(nil)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.True(t, history[0].Active)
+	require.Equal(t, start, history[0].ActiveFrom)
+	require.True(t, history[0].ActiveUntil.IsZero())
+
+	// Rotate to a new root.
+	rotation := start.Add(24 * time.Hour)
+	old := *ca1
+	old.Active = false
+	old.RotatedOutAt = rotation
+	ca2 := connect.TestCA(t, nil)
+	ca2.ActivatedAt = rotation
+	ok, err = s.CARootSetCAS(3, 2, []*structs.CARoot{&old, ca2})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Replace the roots entirely, pruning the old roots without recording when
+	// the previous one was rotated out.
+	replacement := start.Add(48 * time.Hour)
+	ca3 := connect.TestCA(t, nil)
+	ca3.ActivatedAt = replacement
+	ok, err = s.CARootSetCAS(4, 3, []*structs.CARoot{ca3})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	idx, history, err = s.CARootHistory(nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), idx)
+	require.Len(t, history, 3)
+
+	require.Equal(t, ca1.ID, history[0].ID)
+	require.False(t, history[0].Active)
+	require.Equal(t, start, history[0].ActiveFrom)
+	require.Equal(t, rotation, history[0].ActiveUntil)
+	require.Equal(t, structs.RaftIndex{CreateIndex: 1, ModifyIndex: 3}, history[0].RaftIndex)
+
+	require.Equal(t, ca2.ID, history[1].ID)
+	require.False(t, history[1].Active)
+	require.Equal(t, rotation, history[1].ActiveFrom)
+	require.Equal(t, replacement, history[1].ActiveUntil)
+
+	require.Equal(t, ca3.ID, history[2].ID)
+	require.True(t, history[2].Active)
+	require.Equal(t, replacement, history[2].ActiveFrom)
+	require.True(t, history[2].ActiveUntil.IsZero())
+	require.Equal(t, ca3.RootCert, history[2].RootCert)
+}
+
+func TestStore_CAConfigHistory(t *testing.T) {
+	s := testStateStore(t)
+
+	ws := memdb.NewWatchSet()
+	idx, history, err := s.CAConfigHistory(ws)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), idx)
+	require.Empty(t, history)
+
+	require.NoError(t, s.CARecordConfigChange(1, &structs.CAConfigHistoryEntry{
+		AccessorID: "accessor",
+		Provider:   "consul",
+		Changes:    []structs.CAConfigChange{{Key: "LeafCertTTL", Previous: `"72h"`, New: `"24h"`}},
+	}))
+	require.True(t, watchFired(ws))
+
+	idx, history, err = s.CAConfigHistory(nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), idx)
+	require.Len(t, history, 1)
+	require.Equal(t, uint64(1), history[0].ID)
+	require.Equal(t, "accessor", history[0].AccessorID)
+
+	// The oldest entries are pruned beyond the limit.
+	for i := 2; i <= structs.CAConfigHistoryMaxEntries+5; i++ {
+		require.NoError(t, s.CARecordConfigChange(uint64(i), &structs.CAConfigHistoryEntry{Provider: "consul"}))
+	}
+	idx, history, err = s.CAConfigHistory(nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(structs.CAConfigHistoryMaxEntries+5), idx)
+	require.Len(t, history, structs.CAConfigHistoryMaxEntries)
+	require.Equal(t, uint64(6), history[0].ID)
+	require.Equal(t, uint64(structs.CAConfigHistoryMaxEntries+5), history[len(history)-1].ID)
+}
+
+func TestStore_CARecordSeenIdentity(t *testing.T) {
+	s := testStateStore(t)
+
+	const id = "spiffe://11111111-2222-3333-4444-555555555555.consul/ns/default/dc/dc1/svc/web"
+	firstSeen := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	ws := memdb.NewWatchSet()
+	idx, seen, err := s.CASeenIdentity(ws, id)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), idx)
+	require.Nil(t, seen)
+
+	ok, err := s.CARecordSeenIdentity(1, &structs.CASeenIdentity{ID: id, FirstSeen: firstSeen})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, watchFired(ws))
+
+	idx, seen, err = s.CASeenIdentity(nil, id)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), idx)
+	require.Equal(t, firstSeen, seen.FirstSeen)
+	require.Equal(t, uint64(1), seen.CreateIndex)
+
+	// Recording the identity again keeps the first record.
+	ok, err = s.CARecordSeenIdentity(2, &structs.CASeenIdentity{ID: id, FirstSeen: firstSeen.Add(time.Hour)})
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	idx, seen, err = s.CASeenIdentity(nil, id)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), idx)
+	require.Equal(t, firstSeen, seen.FirstSeen)
+	require.Equal(t, firstSeen, seen.LastSeen)
+
+	// Only the time it was last seen moves forward.
+	lastSeen := firstSeen.Add(48 * time.Hour)
+	ok, err = s.CARecordSeenIdentity(3, &structs.CASeenIdentity{ID: id, FirstSeen: lastSeen, LastSeen: lastSeen})
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	idx, seen, err = s.CASeenIdentity(nil, id)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), idx)
+	require.Equal(t, firstSeen, seen.FirstSeen)
+	require.Equal(t, lastSeen, seen.LastSeen)
+	require.Equal(t, uint64(1), seen.CreateIndex)
+}
+
+func TestStore_CAPruneSeenIdentities(t *testing.T) {
+	s := testStateStore(t)
+
+	const (
+		webID = "spiffe://11111111-2222-3333-4444-555555555555.consul/ns/default/dc/dc1/svc/web"
+		apiID = "spiffe://11111111-2222-3333-4444-555555555555.consul/ns/default/dc/dc1/svc/api"
+	)
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := s.CARecordSeenIdentity(1, &structs.CASeenIdentity{ID: webID, FirstSeen: now.Add(-48 * time.Hour)})
+	require.NoError(t, err)
+	_, err = s.CARecordSeenIdentity(2, &structs.CASeenIdentity{ID: apiID, FirstSeen: now.Add(-48 * time.Hour), LastSeen: now})
+	require.NoError(t, err)
+
+	// Nothing was last seen that long ago.
+	pruned, err := s.CAPruneSeenIdentities(3, now.Add(-72*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 0, pruned)
+
+	pruned, err = s.CAPruneSeenIdentities(4, now.Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, pruned)
+
+	idx, identities, err := s.CASeenIdentities(nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), idx)
+	require.Len(t, identities, 1)
+	require.Equal(t, apiID, identities[0].ID)
+}
+
 func TestStore_CARootSet_emptyID(t *testing.T) {
 	s := testStateStore(t)
 
@@ -379,6 +576,89 @@ func TestStore_CARoot_Snapshot_Restore(t *testing.T) {
 	}()
 }
 
+func TestStore_CARootSetCAS_BundleSequence(t *testing.T) {
+	s := testStateStore(t)
+
+	ca1 := connect.TestCA(t, nil)
+	ok, err := s.CARootSetCAS(1, 0, []*structs.CARoot{ca1})
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, roots, err := s.CARoots(nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), roots.BundleSequence())
+
+	// Rotating increments the sequence number.
+	ca1 = ca1.Clone()
+	ca1.Active = false
+	ca2 := connect.TestCA(t, nil)
+	ok, err = s.CARootSetCAS(2, 1, []*structs.CARoot{ca1, ca2})
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, roots, err = s.CARoots(nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), roots.BundleSequence())
+
+	// It survives a snapshot, as taken when a new leader starts from one, and
+	// keeps increasing from there.
+	snap := s.Snapshot()
+	defer snap.Close()
+	dump, err := snap.CARoots()
+	require.NoError(t, err)
+
+	s2 := testStateStore(t)
+	restore := s2.Restore()
+	for _, r := range dump {
+		require.NoError(t, restore.CARoot(r))
+	}
+	require.NoError(t, restore.Commit())
+
+	idx, roots, err := s2.CARoots(nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), roots.BundleSequence())
+
+	ok, err = s2.CARootSetCAS(3, idx, []*structs.CARoot{ca2.Clone()})
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, roots, err = s2.CARoots(nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), roots.BundleSequence())
+}
+
+func TestStore_CASetConfig_TrustAnchorsBundleSequence(t *testing.T) {
+	s := testStateStore(t)
+
+	ok, err := s.CARootSetCAS(1, 0, []*structs.CARoot{connect.TestCA(t, nil)})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	anchor1, anchor2 := connect.TestCA(t, nil).RootCert, connect.TestCA(t, nil).RootCert
+	setAnchors := func(idx uint64, anchors ...string) uint64 {
+		t.Helper()
+		require.NoError(t, s.CASetConfig(idx, &structs.CAConfiguration{
+			Provider: "consul",
+			Config: map[string]interface{}{
+				"AdditionalTrustAnchors": anchors,
+			},
+		}))
+		rootsIdx, roots, err := s.CARoots(nil)
+		require.NoError(t, err)
+		// The roots are left untouched for CARootSetCAS.
+		require.Equal(t, uint64(1), rootsIdx)
+		return roots.BundleSequence()
+	}
+
+	require.Equal(t, uint64(1), setAnchors(2))
+	require.Equal(t, uint64(2), setAnchors(3, anchor1))
+	require.Equal(t, uint64(3), setAnchors(4, anchor1, anchor2))
+
+	// Neither reordering the anchors nor reformatting them changes the bundle.
+	require.Equal(t, uint64(3), setAnchors(5, anchor2, anchor1))
+	require.Equal(t, uint64(3), setAnchors(6, anchor1+"\n", anchor2))
+
+	require.Equal(t, uint64(4), setAnchors(7, anchor2))
+	require.Equal(t, uint64(5), setAnchors(8))
+}
+
 func TestStore_CABuiltinProvider(t *testing.T) {
 	s := testStateStore(t)
 
@@ -397,6 +677,17 @@ func TestStore_CABuiltinProvider(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, idx, uint64(0))
 		assert.Equal(t, expected, state)
+
+		// The checksum is set when writing the state.
+		assert.NotEmpty(t, state.Checksum)
+		assert.True(t, state.ChecksumValid())
+		state.PrivateKey = "a truncated key"
+		assert.False(t, state.ChecksumValid())
+
+		// A state without a checksum was damaged.
+		state.PrivateKey = "a"
+		state.Checksum = ""
+		assert.False(t, state.ChecksumValid())
 	}
 
 	{
@@ -490,4 +781,20 @@ func TestStore_CABuiltinProvider_Snapshot_Restore(t *testing.T) {
 		assert.Equal(t, idx, uint64(99))
 		assert.Equal(t, state, res)
 	}
+
+	// States from snapshots taken before checksums were introduced are given
+	// one when restored.
+	s3 := testStateStore(t)
+	restore = s3.Restore()
+	assert.NoError(t, restore.CAProviderState(&structs.CAConsulProviderState{
+		ID:         "legacy",
+		PrivateKey: "e",
+		RootCert:   "f",
+		RaftIndex:  structs.RaftIndex{CreateIndex: 5, ModifyIndex: 5},
+	}))
+	restore.Commit()
+	_, res, err := s3.CAProviderState("legacy")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, res.Checksum)
+	assert.True(t, res.ChecksumValid())
 }
@@ -18,6 +18,9 @@ func newDBSchema() *memdb.DBSchema {
 		caBuiltinProviderTableSchema,
 		caConfigTableSchema,
 		caRootTableSchema,
+		caRootHistoryTableSchema,
+		caConfigHistoryTableSchema,
+		caSeenIdentityTableSchema,
 		checksTableSchema,
 		configTableSchema,
 		coordinatesTableSchema,
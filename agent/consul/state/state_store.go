@@ -81,6 +81,11 @@ var (
 	// ErrMissingIntentionID is returned when an Intention set is called
 	// with an Intention with an empty ID.
 	ErrMissingIntentionID = errors.New("Missing Intention ID")
+
+	// ErrCAConfigModifyIndexMismatch is returned when a check-and-set of the
+	// CA configuration is called with a ModifyIndex that is no longer the
+	// current one.
+	ErrCAConfigModifyIndexMismatch = errors.New("ModifyIndex did not match existing")
 )
 
 var (
@@ -0,0 +1,95 @@
+package connectca
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/mapstructure"
+	"google.golang.org/grpc"
+
+	"github.com/hashicorp/consul/agent/structs"
+	"github.com/hashicorp/consul/proto"
+	"github.com/hashicorp/consul/proto/pbconnect"
+	"github.com/hashicorp/consul/proto/pbconnectca"
+)
+
+// Server implements a ConnectCAServiceServer which serves the trusted CA roots
+// and signs leaf certificates. It is the gRPC counterpart of the ConnectCA
+// msgpack-RPC endpoint and shares its implementation through the Backend.
+type Server struct {
+	Backend Backend
+	Logger  hclog.Logger
+}
+
+func NewServer(backend Backend, logger hclog.Logger) *Server {
+	return &Server{Backend: backend, Logger: logger}
+}
+
+var _ pbconnectca.ConnectCAServiceServer = (*Server)(nil)
+
+type Backend interface {
+	Forward(info structs.RPCInfo, f func(*grpc.ClientConn) error) (handled bool, err error)
+	CARoots() (*structs.IndexedCARoots, error)
+	SignCertificate(ctx context.Context, token string, csr string, attestation []byte) (*structs.IssuedCert, error)
+}
+
+func (s *Server) Roots(ctx context.Context, req *pbconnectca.RootsRequest) (*pbconnect.CARoots, error) {
+	var resp *pbconnect.CARoots
+	handled, err := s.Backend.Forward(req, func(conn *grpc.ClientConn) error {
+		s.Logger.Trace("forwarding Roots request", "datacenter", req.Datacenter)
+		var err error
+		resp, err = pbconnectca.NewConnectCAServiceClient(conn).Roots(ctx, req)
+		return err
+	})
+	if handled || err != nil {
+		return resp, err
+	}
+
+	roots, err := s.Backend.CARoots()
+	if err != nil {
+		return nil, err
+	}
+
+	var out pbconnect.CARoots
+	if err := translateToProtobuf(roots, &out); err != nil {
+		return nil, fmt.Errorf("Failed to encode CA Roots: %w", err)
+	}
+	return &out, nil
+}
+
+func (s *Server) Sign(ctx context.Context, req *pbconnectca.SignRequest) (*pbconnect.IssuedCert, error) {
+	var resp *pbconnect.IssuedCert
+	handled, err := s.Backend.Forward(req, func(conn *grpc.ClientConn) error {
+		s.Logger.Trace("forwarding Sign request", "datacenter", req.Datacenter)
+		var err error
+		resp, err = pbconnectca.NewConnectCAServiceClient(conn).Sign(ctx, req)
+		return err
+	})
+	if handled || err != nil {
+		return resp, err
+	}
+
+	cert, err := s.Backend.SignCertificate(ctx, req.Token, req.CSR, req.Attestation)
+	if err != nil {
+		return nil, err
+	}
+
+	var out pbconnect.IssuedCert
+	if err := translateToProtobuf(cert, &out); err != nil {
+		return nil, fmt.Errorf("Failed to encode issued certificate: %w", err)
+	}
+	return &out, nil
+}
+
+func translateToProtobuf(in interface{}, out interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: proto.HookTimeToPBTimestamp,
+		Result:     out,
+	})
+	if err != nil {
+		return err
+	}
+
+	return decoder.Decode(in)
+}
@@ -220,7 +220,11 @@ func getPrometheusDefs(cfg lib.TelemetryConfig, isServer bool) ([]prometheus.Gau
 	if isServer {
 		gauges = append(gauges,
 			consul.AutopilotGauges,
-			consul.LeaderCertExpirationGauges)
+			consul.LeaderCertExpirationGauges,
+			consul.LeaderCALeafGauges,
+			consul.LeaderCAProviderGauges,
+			consul.LeaderCAExpiryGauges,
+			consul.CAStateGauges)
 	}
 
 	// Flatten definitions
@@ -265,6 +269,9 @@ func getPrometheusDefs(cfg lib.TelemetryConfig, isServer bool) ([]prometheus.Gau
 		local.StateCounters,
 		raftCounters,
 	}
+	if isServer {
+		counters = append(counters, consul.LeaderCACounters, consul.CAStateCounters)
+	}
 	// Flatten definitions
 	// NOTE(kit): Do we actually want to create a set here so we can ensure definition names are unique?
 	var counterDefs []prometheus.CounterDefinition
@@ -1,6 +1,7 @@
 package structs
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -94,6 +95,10 @@ type ServiceConfigEntry struct {
 	ExternalSNI      string                 `json:",omitempty" alias:"external_sni"`
 	UpstreamConfig   *UpstreamConfiguration `json:",omitempty" alias:"upstream_config"`
 
+	// LeafCertTTL replaces the LeafCertTTL of the CA configuration for the
+	// leaf certificates of the service, up to its MaxServiceLeafCertTTL.
+	LeafCertTTL time.Duration `json:",omitempty" alias:"leaf_cert_ttl"`
+
 	Meta           map[string]string `json:",omitempty"`
 	EnterpriseMeta `hcl:",squash" mapstructure:",squash"`
 	RaftIndex
@@ -165,6 +170,10 @@ func (e *ServiceConfigEntry) Validate() error {
 
 	validationErr := validateConfigEntryMeta(e.Meta)
 
+	if e.LeafCertTTL != 0 && (e.LeafCertTTL < MinLeafCertTTL || e.LeafCertTTL > MaxLeafCertTTL) {
+		validationErr = multierror.Append(validationErr, fmt.Errorf("LeafCertTTL must be between %s and %s", MinLeafCertTTL, MaxLeafCertTTL))
+	}
+
 	if e.UpstreamConfig != nil {
 		for _, override := range e.UpstreamConfig.Overrides {
 			err := override.ValidateWithName()
@@ -183,6 +192,42 @@ func (e *ServiceConfigEntry) Validate() error {
 	return validationErr
 }
 
+func (e *ServiceConfigEntry) MarshalJSON() ([]byte, error) {
+	type Alias ServiceConfigEntry
+	exported := &struct {
+		LeafCertTTL string `json:",omitempty"`
+		*Alias
+	}{
+		LeafCertTTL: e.LeafCertTTL.String(),
+		Alias:       (*Alias)(e),
+	}
+	if e.LeafCertTTL == 0 {
+		exported.LeafCertTTL = ""
+	}
+
+	return json.Marshal(exported)
+}
+
+func (e *ServiceConfigEntry) UnmarshalJSON(data []byte) error {
+	type Alias ServiceConfigEntry
+	aux := &struct {
+		LeafCertTTL string
+		*Alias
+	}{
+		Alias: (*Alias)(e),
+	}
+	if err := lib.UnmarshalJSON(data, &aux); err != nil {
+		return err
+	}
+	var err error
+	if aux.LeafCertTTL != "" {
+		if e.LeafCertTTL, err = time.ParseDuration(aux.LeafCertTTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (e *ServiceConfigEntry) CanRead(authz acl.Authorizer) bool {
 	var authzContext acl.AuthorizerContext
 	e.FillAuthzContext(&authzContext)
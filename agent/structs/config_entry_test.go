@@ -301,6 +301,7 @@ func TestDecodeConfigEntry(t *testing.T) {
 				}
 				protocol = "http"
 				external_sni = "abc-123"
+				leaf_cert_ttl = "12h"
 				mesh_gateway {
 					mode = "remote"
 				}
@@ -342,6 +343,7 @@ func TestDecodeConfigEntry(t *testing.T) {
 				}
 				Protocol = "http"
 				ExternalSNI = "abc-123"
+				LeafCertTTL = "12h"
 				MeshGateway {
 					Mode = "remote"
 				}
@@ -383,6 +385,7 @@ func TestDecodeConfigEntry(t *testing.T) {
 				},
 				Protocol:    "http",
 				ExternalSNI: "abc-123",
+				LeafCertTTL: 12 * time.Hour,
 				MeshGateway: MeshGatewayConfig{
 					Mode: MeshGatewayModeRemote,
 				},
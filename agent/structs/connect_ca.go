@@ -1,8 +1,18 @@
 package structs
 
 import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
 	"fmt"
+	"path"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mitchellh/mapstructure"
@@ -47,6 +57,23 @@ type IndexedCARoots struct {
 	// seamless rotation between trust domains thanks to cross-signing.
 	TrustDomain string
 
+	// PreviousTrustDomain is the trust domain the cluster is migrating away
+	// from, if any. Roots holds the roots of both trust domains until it is
+	// retired.
+	PreviousTrustDomain string `json:",omitempty"`
+
+	// SpiffeSequence is the sequence number of the SPIFFE trust bundle made of
+	// Roots. It increases every time the roots change, including across leader
+	// changes, so that clients can tell whether to refresh their bundle.
+	SpiffeSequence uint64
+
+	// ForceRenewBefore, when set, asks clients to renew the leaf certificates
+	// they were issued before it without waiting for their usual renewal
+	// time. Clients are expected to spread these renewals with jitter. It is
+	// set when a CA configuration with ForceRenewOnLeafTTLDecrease decreases
+	// LeafCertTTL.
+	ForceRenewBefore *time.Time `json:",omitempty"`
+
 	// Roots is a list of root CA certs to trust.
 	Roots []*CARoot
 
@@ -55,6 +82,41 @@ type IndexedCARoots struct {
 	QueryMeta `json:"-"`
 }
 
+// IndexedCARootsMinimal holds the subset of IndexedCARoots that clients need
+// to trust the active root, for clients which can't afford to receive every
+// root along with its metadata, such as agents on metered links.
+type IndexedCARootsMinimal struct {
+	// ActiveRootID is the ID of the active CA root.
+	ActiveRootID string
+
+	// TrustDomain is the identification root for this Consul cluster. See
+	// IndexedCARoots.TrustDomain.
+	TrustDomain string
+
+	// ActiveRootCert is the PEM-encoded certificate of the active CA root.
+	ActiveRootCert string
+
+	// QueryMeta contains the meta sent via a header. We ignore for JSON
+	// so this whole structure can be returned.
+	QueryMeta `json:"-"`
+}
+
+// CASigningInfo identifies the signing material of the CA, for clients to
+// cheaply check whether it changed before fetching the roots.
+type CASigningInfo struct {
+	// ActiveRootID is the ID of the active CA root.
+	ActiveRootID string
+
+	// SigningKeyID is the SigningKeyID of the active CA root, the ID of the
+	// key which signs leaf certificates. It changes when the root rotates
+	// and when the intermediate is renewed.
+	SigningKeyID string
+
+	// QueryMeta contains the meta sent via a header. We ignore for JSON
+	// so this whole structure can be returned.
+	QueryMeta `json:"-"`
+}
+
 func (r IndexedCARoots) Active() *CARoot {
 	for _, root := range r.Roots {
 		if root.ID == r.ActiveRootID {
@@ -137,8 +199,12 @@ type CARoot struct {
 	// active root.
 	RotatedOutAt time.Time `json:"-"`
 
+	// ActivatedAt is the time at which this CA became the active root. It is
+	// zero for roots that became active before this was recorded.
+	ActivatedAt time.Time `json:"-"`
+
 	// PrivateKeyType is the type of the private key used to sign certificates. It
-	// may be "rsa" or "ec". This is provided as a convenience to avoid parsing
+	// may be "rsa", "ec" or "ed25519". This is provided as a convenience to avoid parsing
 	// the public key to from the certificate to infer the type.
 	PrivateKeyType string
 
@@ -147,9 +213,62 @@ type CARoot struct {
 	// certificate to infer the type.
 	PrivateKeyBits int
 
+	// RotationReason is why this root replaced the previous active root. It is
+	// empty for the first root of a cluster and for roots that became active
+	// before this was recorded.
+	RotationReason CARotationReason `json:",omitempty"`
+
+	// TrustAnchorOnly is true for the AdditionalTrustAnchors of the CA
+	// configuration. They are published with the roots so that certificates
+	// they issued are trusted, but they are not stored roots and never sign
+	// certificates for the cluster.
+	TrustAnchorOnly bool `json:",omitempty"`
+
+	// ChainError is set in the roots served to clients when some of the
+	// IntermediateCerts don't chain up to RootCert, to why they don't. It is
+	// never stored.
+	ChainError string `json:",omitempty"`
+
+	// IntermediatesSupersededAt records when the leaf signing intermediates
+	// of IntermediateCerts were replaced by a renewal, by signing key ID, so
+	// that they can be dropped after the IntermediateGracePeriod of the CA
+	// configuration.
+	IntermediatesSupersededAt map[string]time.Time `json:"-"`
+
+	// BundleSequence is the SPIFFE bundle sequence number of the set of roots
+	// this root was last stored with. The state store increments it on every
+	// change of the roots.
+	BundleSequence uint64 `json:"-"`
+
 	RaftIndex
 }
 
+// CARotationReason is why the active CA root was replaced.
+type CARotationReason string
+
+const (
+	// CARotationReasonConfigChange is used when a CA configuration update
+	// made the provider generate a new root.
+	CARotationReasonConfigChange CARotationReason = "config-change"
+
+	// CARotationReasonKeyTypeChange is used when a CA configuration update
+	// changed the type or size of the root key.
+	CARotationReasonKeyTypeChange CARotationReason = "key-type-change"
+
+	// CARotationReasonEmergency is used by emergency root rotations, which
+	// drop the previous roots straight away.
+	CARotationReasonEmergency CARotationReason = "emergency"
+
+	// CARotationReasonImport is used when a CA configuration update provided
+	// an existing root certificate to use.
+	CARotationReasonImport CARotationReason = "import"
+
+	// CARotationReasonRecovery is used when the leader found the provider
+	// had a different root than the active one when initializing the CA, and
+	// replaced the active root with it.
+	CARotationReasonRecovery CARotationReason = "recovery"
+)
+
 func (c *CARoot) Clone() *CARoot {
 	if c == nil {
 		return nil
@@ -157,6 +276,12 @@ func (c *CARoot) Clone() *CARoot {
 
 	newCopy := *c
 	newCopy.IntermediateCerts = CloneStringSlice(c.IntermediateCerts)
+	if c.IntermediatesSupersededAt != nil {
+		newCopy.IntermediatesSupersededAt = make(map[string]time.Time, len(c.IntermediatesSupersededAt))
+		for keyID, at := range c.IntermediatesSupersededAt {
+			newCopy.IntermediatesSupersededAt[keyID] = at
+		}
+	}
 	return &newCopy
 }
 
@@ -177,6 +302,128 @@ func (c CARoots) Active() *CARoot {
 	return nil
 }
 
+// BundleSequence returns the SPIFFE bundle sequence number of the roots, the
+// highest BundleSequence among them.
+func (c CARoots) BundleSequence() uint64 {
+	var seq uint64
+	for _, r := range c {
+		if r.BundleSequence > seq {
+			seq = r.BundleSequence
+		}
+	}
+	return seq
+}
+
+// IndexedCARootHistory is the list of every CA root that has been stored,
+// including roots that were rotated out and have since been pruned.
+type IndexedCARootHistory struct {
+	Roots []*CARootHistoryEntry
+
+	// QueryMeta contains the meta sent via a header. We ignore for JSON
+	// so this whole structure can be returned.
+	QueryMeta `json:"-"`
+}
+
+// CARootHistoryEntry records a CA root along with the window during which it
+// was the active root. Entries outlive the roots they describe so that the root
+// that was active when a certificate was issued can be found later.
+type CARootHistoryEntry struct {
+	// ID, Name, SerialNumber, SigningKeyID, ExternalTrustDomain, NotBefore,
+	// NotAfter and RootCert are copied from the CARoot. The SigningKeyID is the
+	// one from when the root was last stored, since renewing an intermediate
+	// changes it.
+	ID                  string
+	Name                string
+	SerialNumber        uint64
+	SigningKeyID        string
+	ExternalTrustDomain string
+	NotBefore           time.Time
+	NotAfter            time.Time
+	RootCert            string
+
+	// Active is true while this is the current active CA root.
+	Active bool
+
+	// ActiveFrom is the time at which this root became the active root. It is
+	// zero if that is unknown, which is the case for roots that became active
+	// before history was recorded.
+	ActiveFrom time.Time
+
+	// ActiveUntil is the time at which this root stopped being the active root.
+	// It is zero while the root is still active, or if the root that replaced
+	// it was stored before history was recorded.
+	ActiveUntil time.Time
+
+	// RotationReason is why this root replaced the previous active root, see
+	// CARoot.RotationReason.
+	RotationReason CARotationReason `json:",omitempty"`
+
+	RaftIndex
+}
+
+// CAConfigHistoryMaxEntries is how many entries the CA configuration history
+// keeps. Older entries are pruned as new ones are recorded.
+const CAConfigHistoryMaxEntries = 100
+
+// IndexedCAConfigHistory is the history of the changes to the CA
+// configuration, oldest first.
+type IndexedCAConfigHistory struct {
+	Entries []*CAConfigHistoryEntry
+
+	// QueryMeta contains the meta sent via a header. We ignore for JSON
+	// so this whole structure can be returned.
+	QueryMeta `json:"-"`
+}
+
+// CAConfigHistoryEntry records a change to the CA configuration applied by
+// CAManager.UpdateConfiguration.
+type CAConfigHistoryEntry struct {
+	// ID is the raft index the entry was recorded at.
+	ID uint64
+
+	// AccessorID is the accessor ID of the ACL token the change was
+	// requested with, if any.
+	AccessorID string `json:",omitempty"`
+
+	// ChangedAt is when the change was applied.
+	ChangedAt time.Time
+
+	// Provider is the CA provider of the new configuration.
+	Provider string
+
+	// Changes are the provider and configuration keys that changed, with
+	// the values of secrets redacted.
+	Changes []CAConfigChange
+
+	RaftIndex
+}
+
+// CAConfigChange is a change to the CA configuration. Previous and New are
+// the JSON encoding of the values, empty when the key was added or removed.
+type CAConfigChange struct {
+	Key      string
+	Previous string `json:",omitempty"`
+	New      string `json:",omitempty"`
+}
+
+// CASeenIdentity records a SPIFFE identity the CA signed a leaf certificate
+// for, so that the first certificate of an identity can be told apart from
+// later ones across restarts.
+type CASeenIdentity struct {
+	// ID is the SPIFFE ID of the identity.
+	ID string
+
+	// FirstSeen is when the first certificate of the identity was signed.
+	FirstSeen time.Time
+
+	// LastSeen is about when the last certificate of the identity was signed.
+	// It's only refreshed once in a while to limit raft writes, and identities
+	// not seen for long are pruned.
+	LastSeen time.Time
+
+	RaftIndex
+}
+
 // CASignRequest is the request for signing a service certificate.
 type CASignRequest struct {
 	// Datacenter is the target for this request.
@@ -185,22 +432,340 @@ type CASignRequest struct {
 	// CSR is the PEM-encoded CSR.
 	CSR string
 
+	// AdditionalSpiffeIDs are the URIs of further service identities to
+	// include in the certificate besides the ones in the CSR. Each of them must
+	// be in the cluster's trust domain and the token must be allowed to act as
+	// all of them.
+	AdditionalSpiffeIDs []string `json:",omitempty"`
+
+	// ChainOrder is the order of the certificates in the returned CertPEM.
+	// It defaults to CAChainOrderLeafFirst.
+	ChainOrder CAChainOrder `json:",omitempty"`
+
+	// Attestation is a statement that the private key of the CSR is held by
+	// trusted hardware, such as a TPM, in the format the CA provider verifies.
+	// The CSR is only signed when the provider accepts it. It is required
+	// when the CA configuration sets RequireAttestation.
+	Attestation []byte `json:",omitempty"`
+
+	// ProviderSignOptions are options specific to the CA provider, passed
+	// through to it as is. Each provider only accepts the options it knows
+	// of, and the built-in provider accepts none.
+	ProviderSignOptions map[string]string `json:",omitempty"`
+
 	// WriteRequest is a common struct containing ACL tokens and other
 	// write-related common elements for requests.
 	WriteRequest
 }
 
+// CAChainOrder is the order of the certificates in a PEM bundle issued by the
+// CA.
+type CAChainOrder string
+
+const (
+	// CAChainOrderLeafFirst puts the leaf first, followed by the certificate
+	// that signed it and so on towards the root. This is the order TLS expects.
+	CAChainOrderLeafFirst CAChainOrder = "leaf-first"
+
+	// CAChainOrderRootFirst is the reverse of CAChainOrderLeafFirst, with the
+	// certificate closest to the root first and the leaf last.
+	CAChainOrderRootFirst CAChainOrder = "root-first"
+)
+
+// Validate returns an error if the order is not empty or a known order.
+func (o CAChainOrder) Validate() error {
+	switch o {
+	case "", CAChainOrderLeafFirst, CAChainOrderRootFirst:
+		return nil
+	default:
+		return fmt.Errorf("invalid chain order %q, must be %q or %q",
+			o, CAChainOrderLeafFirst, CAChainOrderRootFirst)
+	}
+}
+
 // RequestDatacenter returns the datacenter for a given request.
 func (q *CASignRequest) RequestDatacenter() string {
 	return q.Datacenter
 }
 
+// CASignPublicKeyRequest is a request for the CA to sign a leaf certificate
+// for a public key, for clients that can't build a CSR. The private key still
+// never leaves the client.
+type CASignPublicKeyRequest struct {
+	// Datacenter is the target for this request.
+	Datacenter string
+
+	// PublicKey is the PEM-encoded PKIX public key to sign. It must be an EC
+	// key on one of the NIST curves or an RSA key of at least 2048 bits.
+	PublicKey string
+
+	// SpiffeID is the service or agent SPIFFE ID to sign the key for.
+	SpiffeID string
+
+	// ChainOrder is the order of the certificates in the returned CertPEM. It
+	// defaults to CAChainOrderLeafFirst.
+	ChainOrder CAChainOrder `json:",omitempty"`
+
+	// WriteRequest is a common struct containing ACL tokens and other
+	// write-related common elements for requests.
+	WriteRequest
+}
+
+// RequestDatacenter returns the datacenter for a given request.
+func (q *CASignPublicKeyRequest) RequestDatacenter() string {
+	return q.Datacenter
+}
+
+// CASignBootstrapRequest is a request for the CA to sign a short-lived
+// bootstrap certificate for an agent joining the cluster.
+type CASignBootstrapRequest struct {
+	// Datacenter is the target for this request.
+	Datacenter string
+
+	// CSR is the PEM-encoded CSR. Its only URI must be the agent SPIFFE ID
+	// of the joining agent.
+	CSR string
+
+	// Attestation is the attestation of the key of the CSR, as for
+	// CASignRequest.
+	Attestation []byte `json:",omitempty"`
+
+	// WriteRequest is a common struct containing ACL tokens and other
+	// write-related common elements for requests.
+	WriteRequest
+}
+
+// RequestDatacenter returns the datacenter for a given request.
+func (q *CASignBootstrapRequest) RequestDatacenter() string {
+	return q.Datacenter
+}
+
+// CASignWithJWTRequest is a request for the CA to sign a leaf certificate
+// for a workload authenticating with a JWT rather than an ACL token.
+type CASignWithJWTRequest struct {
+	// Datacenter is the target for this request.
+	Datacenter string
+
+	// JWT is the token of the workload, validated as configured by the
+	// JWTSigning field of the CA configuration.
+	JWT string
+
+	// CSR is the PEM-encoded CSR. Its only URI must be the SPIFFE ID of the
+	// service the JWT grants the identity of.
+	CSR string
+
+	// ChainOrder is the order of the certificates in the returned chain.
+	ChainOrder CAChainOrder
+
+	// Attestation is the attestation of the key of the CSR, as for
+	// CASignRequest.
+	Attestation []byte `json:",omitempty"`
+
+	// WriteRequest is a common struct containing ACL tokens and other
+	// write-related common elements for requests.
+	WriteRequest
+}
+
+// RequestDatacenter returns the datacenter for a given request.
+func (q *CASignWithJWTRequest) RequestDatacenter() string {
+	return q.Datacenter
+}
+
+// CAKeySpec is the type and length of a CA private key.
+type CAKeySpec struct {
+	// PrivateKeyType is either "ec", "rsa" or "ed25519".
+	PrivateKeyType string
+
+	// PrivateKeyBits is the length of the key, as for the PrivateKeyBits
+	// field of the CA configuration.
+	PrivateKeyBits int
+}
+
+func (k CAKeySpec) String() string {
+	return fmt.Sprintf("%s-%d", k.PrivateKeyType, k.PrivateKeyBits)
+}
+
+// CAUpgradeKeyStrengthRequest is a request to rotate the CA root to a stronger
+// key.
+type CAUpgradeKeyStrengthRequest struct {
+	// Datacenter is the target for this request.
+	Datacenter string
+
+	// Key is the key the new root is generated with.
+	Key CAKeySpec
+
+	// WriteRequest is a common struct containing ACL tokens and other
+	// write-related common elements for requests.
+	WriteRequest
+}
+
+// RequestDatacenter returns the datacenter for a given request.
+func (q *CAUpgradeKeyStrengthRequest) RequestDatacenter() string {
+	return q.Datacenter
+}
+
+// CAUpdateProviderCredentialsRequest is a request to replace the credentials
+// the CA provider uses to reach its backing CA.
+type CAUpdateProviderCredentialsRequest struct {
+	// Datacenter is the target for this request.
+	Datacenter string
+
+	// Credentials are the credential fields of the provider configuration to
+	// replace, such as the Vault Token.
+	Credentials map[string]interface{}
+
+	// WriteRequest is a common struct containing ACL tokens and other
+	// write-related common elements for requests.
+	WriteRequest
+}
+
+// RequestDatacenter returns the datacenter for a given request.
+func (q *CAUpdateProviderCredentialsRequest) RequestDatacenter() string {
+	return q.Datacenter
+}
+
+// CASetMaintenanceModeRequest is a request to enable or disable CA maintenance
+// mode.
+type CASetMaintenanceModeRequest struct {
+	// Datacenter is the target for this request.
+	Datacenter string
+
+	// Enabled is whether maintenance mode is enabled.
+	Enabled bool
+
+	// WriteRequest is a common struct containing ACL tokens and other
+	// write-related common elements for requests.
+	WriteRequest
+}
+
+// RequestDatacenter returns the datacenter for a given request.
+func (q *CASetMaintenanceModeRequest) RequestDatacenter() string {
+	return q.Datacenter
+}
+
+// CAPruneRootsResponse is the result of a ConnectCA.PruneRoots request.
+type CAPruneRootsResponse struct {
+	// PrunedRootIDs are the IDs of the roots that were removed.
+	PrunedRootIDs []string
+}
+
+// CAIdentityActivityResponse is the result of a ConnectCA.IdentityActivity
+// request.
+type CAIdentityActivityResponse struct {
+	// Identities holds the identities the leader signed leaf certificates
+	// for since it became the leader, least recently signed first.
+	Identities []CAIdentityActivity
+}
+
+// CAIdentityActivity is when a leaf certificate was last signed for an
+// identity.
+type CAIdentityActivity struct {
+	// SpiffeID is the SPIFFE ID of the identity.
+	SpiffeID string
+
+	// LastSignedAt is when a leaf certificate was last signed for it.
+	LastSignedAt time.Time
+
+	// Dormant is true when LastSignedAt is older than the dormant identity
+	// window of the server.
+	Dormant bool
+}
+
+// CARootGenerationApprovalResponse is the result of a
+// ConnectCA.ApproveRootGeneration request.
+type CARootGenerationApprovalResponse struct {
+	// Approvals is the number of distinct approvals recorded so far.
+	Approvals int
+
+	// Quorum is the number of approvals required to generate the root.
+	Quorum int
+}
+
+// CADryRunSignResponse is the result of a ConnectCA.DryRunSign request.
+type CADryRunSignResponse struct {
+	// Accepted is true when the CSR passed every check made before signing.
+	Accepted bool
+
+	// Reason is the error signing the CSR would have failed with when it
+	// wasn't accepted.
+	Reason string
+}
+
+const (
+	// SSHCertTypeHost is the type of SSH certificates that authenticate hosts.
+	SSHCertTypeHost = "host"
+
+	// SSHCertTypeUser is the type of SSH certificates that authenticate users.
+	SSHCertTypeUser = "user"
+)
+
+// SSHSignRequest is the request for signing an SSH certificate.
+type SSHSignRequest struct {
+	// Datacenter is the target for this request.
+	Datacenter string
+
+	// CertType is the type of the certificate, either SSHCertTypeHost or
+	// SSHCertTypeUser.
+	CertType string
+
+	// PublicKey is the SSH public key to sign, in authorized_keys format.
+	PublicKey string
+
+	// Principals are the host names or user names the certificate is valid
+	// for.
+	Principals []string
+
+	// TTL is how long the certificate is valid for. The CA picks a default
+	// when it is zero.
+	TTL time.Duration
+
+	// WriteRequest is a common struct containing ACL tokens and other
+	// write-related common elements for requests.
+	WriteRequest
+}
+
+// RequestDatacenter returns the datacenter for a given request.
+func (q *SSHSignRequest) RequestDatacenter() string {
+	return q.Datacenter
+}
+
+// Validate returns an error if the request is missing the public key or
+// principals, or asks for an unknown certificate type.
+func (q *SSHSignRequest) Validate() error {
+	switch q.CertType {
+	case SSHCertTypeHost, SSHCertTypeUser:
+	default:
+		return fmt.Errorf("invalid SSH certificate type %q, must be %q or %q",
+			q.CertType, SSHCertTypeHost, SSHCertTypeUser)
+	}
+	if q.PublicKey == "" {
+		return fmt.Errorf("an SSH public key is required")
+	}
+	if len(q.Principals) == 0 {
+		return fmt.Errorf("at least one principal is required")
+	}
+	if q.TTL < 0 {
+		return fmt.Errorf("TTL cannot be negative")
+	}
+	return nil
+}
+
+// SSHSignResponse is the result of a ConnectCA.SignSSH request.
+type SSHSignResponse struct {
+	// Certificate is the signed SSH certificate in authorized_keys format.
+	Certificate string
+}
+
 // IssuedCert is a certificate that has been issued by a Connect CA.
 type IssuedCert struct {
 	// SerialNumber is the unique serial number for this certificate.
 	// This is encoded in standard hex separated by :.
 	SerialNumber string
 
+	// Fingerprint is the SHA-256 hash of the DER encoding of the leaf
+	// certificate, encoded in hex separated by : like SerialNumber.
+	Fingerprint string `json:",omitempty"`
+
 	// CertPEM is a PEM encoded bundle of a leaf certificate, optionally followed
 	// by one or more intermediate certificates that will form a chain of trust
 	// back to a root CA.
@@ -211,6 +776,12 @@ type IssuedCert struct {
 	// PrivateKeyPEM is the PEM encoded private key associated with CertPEM.
 	PrivateKeyPEM string `json:",omitempty"`
 
+	// IntermediateCerts is the chain of PEM encoded CA certificates that
+	// issued the certificate, starting with the one that signed it and up to
+	// but excluding the root. It is only set by secondary datacenters whose CA
+	// configuration has IncludeIssuingChain set.
+	IntermediateCerts []string `json:",omitempty"`
+
 	// Service is the name of the service for which the cert was issued.
 	// ServiceURI is the cert URI value.
 	Service    string `json:",omitempty"`
@@ -221,11 +792,25 @@ type IssuedCert struct {
 	Agent    string `json:",omitempty"`
 	AgentURI string `json:",omitempty"`
 
+	// URIs, DNSNames and IPAddresses are the subject alternative names the
+	// certificate was signed with. URIs starts with ServiceURI or AgentURI,
+	// followed by the additional SPIFFE IDs of the certificate.
+	URIs        []string `json:",omitempty"`
+	DNSNames    []string `json:",omitempty"`
+	IPAddresses []string `json:",omitempty"`
+
 	// ValidAfter and ValidBefore are the validity periods for the
 	// certificate.
 	ValidAfter  time.Time
 	ValidBefore time.Time
 
+	// IssuerDatacenter is the datacenter of the server that issued the
+	// certificate and IssuerPartition the admin partition of the identity it
+	// was issued for. Providers able to do so also record them in the
+	// certificate, see connect.IssuerLocation.
+	IssuerDatacenter string `json:",omitempty"`
+	IssuerPartition  string `json:",omitempty"`
+
 	// EnterpriseMeta is the Consul Enterprise specific metadata
 	EnterpriseMeta
 
@@ -242,6 +827,9 @@ const (
 	CAOpDeleteProviderState           CAOp = "delete-provider-state"
 	CAOpSetRootsAndConfig             CAOp = "set-roots-config"
 	CAOpIncrementProviderSerialNumber CAOp = "increment-provider-serial"
+	CAOpRecordSeenIdentity            CAOp = "record-seen-identity"
+	CAOpPruneSeenIdentities           CAOp = "prune-seen-identities"
+	CAOpRecordConfigChange            CAOp = "record-config-change"
 )
 
 // CARequest is used to modify connect CA data. This is used by the
@@ -267,6 +855,16 @@ type CARequest struct {
 	// ProviderState is the state for the builtin CA provider.
 	ProviderState *CAConsulProviderState
 
+	// SeenIdentity is the identity recorded by CAOpRecordSeenIdentity.
+	SeenIdentity *CASeenIdentity
+
+	// SeenBefore is used by CAOpPruneSeenIdentities to remove the identities
+	// last seen before it.
+	SeenBefore time.Time
+
+	// ConfigChange is the entry recorded by CAOpRecordConfigChange.
+	ConfigChange *CAConfigHistoryEntry
+
 	// WriteRequest is a common struct containing ACL tokens and other
 	// write-related common elements for requests.
 	WriteRequest
@@ -310,6 +908,12 @@ type CAConfiguration struct {
 	// identifiers anyway so this is simpler.
 	State map[string]string
 
+	// StateRefs holds the provider state values that were stored outside of
+	// raft by a ProviderStateStore, keyed like State and mapped to the
+	// reference returned by the store. Those keys are absent from State. It
+	// can't be set through the API.
+	StateRefs map[string]string `json:",omitempty"`
+
 	// ForceWithoutCrossSigning indicates that the CA reconfiguration should go
 	// ahead even if the current CA is unable to cross sign certificates. This
 	// risks temporary connection failures during the rollout as new leafs will be
@@ -318,9 +922,74 @@ type CAConfiguration struct {
 	// reconfigured or mirated away from.
 	ForceWithoutCrossSigning bool
 
+	// RootGenerationApprovals are the distinct operator approvals recorded
+	// with ConnectCA.ApproveRootGeneration to generate the initial root when
+	// RootGenerationQuorum is set. They can't be set through the API.
+	RootGenerationApprovals []CARootGenerationApproval
+
+	// MaintenanceMode is whether the leader refuses to sign leaf certificates
+	// while the backend of the CA provider is undergoing maintenance. It can't
+	// be set through the API, only with ConnectCA.SetMaintenanceMode.
+	MaintenanceMode bool `json:",omitempty"`
+
+	// ForceRenewBefore is the time the last configuration with
+	// ForceRenewOnLeafTTLDecrease set decreased LeafCertTTL. It is published
+	// with the roots so that clients renew older leaf certificates early. It
+	// can't be set through the API.
+	ForceRenewBefore *time.Time `json:",omitempty"`
+
+	// ProviderVersion is the version of the CA provider that last wrote the
+	// configuration and its State, see ca.VersionedProvider. Servers refuse
+	// to configure an older version of the provider with them. It can't be
+	// set through the API.
+	ProviderVersion int `json:",omitempty"`
+
 	RaftIndex
 }
 
+// CARootGenerationApproval is an operator approval to generate the initial
+// CA root. See CommonCAProviderConfig.RootGenerationQuorum.
+type CARootGenerationApproval struct {
+	// Approver identifies the operator who made the approval, see
+	// RootGenerationApprover.
+	Approver string
+
+	// AccessorID is the accessor ID of the ACL token the approval was made
+	// with. It is only recorded for auditing.
+	AccessorID string
+
+	// ApprovedAt is the time the approval was recorded.
+	ApprovedAt time.Time
+}
+
+// RootGenerationApprover returns the key that identifies the operator
+// holding the given ACL identity when approving the generation of the
+// initial root: the accessor ID of the token. Operators sharing the same
+// policies or roles are different approvers as long as they hold different
+// tokens. Each token is a principal though, so an operator allowed to create
+// tokens with acl:write, or to log in with an auth method several times, can
+// approve more than once. The anonymous token and identities that aren't
+// tokens don't identify an approver.
+func RootGenerationApprover(identity ACLIdentity) string {
+	token, ok := identity.(*ACLToken)
+	if !ok || token == nil || token.AccessorID == "" || token.AccessorID == ACLTokenAnonymousID {
+		return ""
+	}
+	return token.AccessorID
+}
+
+// HasRootGenerationApproval returns whether an approval to generate the
+// initial root was recorded for the given approver, see
+// RootGenerationApprover.
+func (c *CAConfiguration) HasRootGenerationApproval(approver string) bool {
+	for _, a := range c.RootGenerationApprovals {
+		if a.Approver == approver {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *CAConfiguration) UnmarshalJSON(data []byte) (err error) {
 	type Alias CAConfiguration
 
@@ -350,6 +1019,9 @@ func (c *CAConfiguration) GetCommonConfig() (*CommonCAProviderConfig, error) {
 
 	// Set Defaults
 	config.CSRMaxPerSecond = 50 // See doc comment for rationale here.
+	config.BootstrapCSRMaxPerSecond = 5
+	config.CSRMaxPerSecondPerIdentity = 10
+	config.CSRBurstPerIdentity = 50
 
 	decodeConf := &mapstructure.DecoderConfig{
 		DecodeHook:       ParseDurationFunc(),
@@ -400,24 +1072,656 @@ type CommonCAProviderConfig struct {
 	// is used. This is ignored if CSRMaxPerSecond is non-zero.
 	CSRMaxConcurrent int
 
+	// CSRMaxPerSecondPerIdentity is a rate limit on signing the leaf
+	// certificates of a single service or agent identity, applied before
+	// CSRMaxPerSecond and CSRMaxConcurrent so that a misbehaving sidecar
+	// can't use up the capacity of the others. Requests over the limit are
+	// rejected right away with a "rate limited" backpressure response. 0
+	// disables the rate limit. Defaults to 10, a fifth of the default
+	// CSRMaxPerSecond, so that the instances of a service rotating their
+	// certificates together are only slowed down a little.
+	CSRMaxPerSecondPerIdentity float32
+
+	// CSRBurstPerIdentity is how many leaf certificates of an identity can be
+	// signed at once before CSRMaxPerSecondPerIdentity applies, such as when
+	// the instances of a service start together. Defaults to 50.
+	CSRBurstPerIdentity int
+
+	// IntermediateSignMaxConcurrent is a limit on how many intermediate
+	// signing requests from secondary datacenters the primary processes in
+	// parallel, separate from the limits on leaf signing. Further requests
+	// queue for a slot, and are rejected with a "rate limited" response if
+	// none frees up in time, upon which the secondaries retry with a
+	// jittered backoff. It is only used in the primary datacenter. Setting to
+	// 0 disables the limit.
+	IntermediateSignMaxConcurrent int
+
 	// PrivateKeyType specifies which type of key the CA should generate. It only
 	// applies when the provider is generating its own key and is ignored if the
 	// provider already has a key or an external key is provided. Supported values
-	// are "ec" or "rsa". "ec" is the default and will generate a NIST P-256
-	// Elliptic key.
+	// are "ec", "rsa" or "ed25519". "ec" is the default and will generate a NIST
+	// P-256 Elliptic key.
 	PrivateKeyType string
 
 	// PrivateKeyBits specifies the number of bits the CA's private key should
 	// use. For RSA, supported values are 2048 and 4096. For EC, supported values
 	// are 224, 256, 384 and 521 and correspond to the NIST P-* curve of the same
-	// name. As with PrivateKeyType this is only relevant whan the provier is
+	// name. Ed25519 keys are always 256 bits. As with PrivateKeyType this is only relevant whan the provier is
 	// generating new CA keys (root or intermediate).
 	PrivateKeyBits int
+
+	// IntermediateCertSubject specifies distinguished name fields to embed in
+	// the subject of the CSR generated for an intermediate CA certificate. Some
+	// external CAs will only sign intermediates whose subject matches a
+	// registered policy. When nil the providers build their default subject.
+	IntermediateCertSubject *CertSubject
+
+	// IntermediateCSRSignatureAlgorithm specifies the signature algorithm of
+	// the CSR generated for an intermediate CA certificate, for external CAs
+	// that only accept CSRs signed with a given algorithm. It must be usable
+	// with PrivateKeyType. When empty the default algorithm for the key type is
+	// used.
+	IntermediateCSRSignatureAlgorithm string
+
+	// RequireAttestation refuses to sign leaf certificates unless the request
+	// comes with an attestation that the key is held by trusted hardware,
+	// which the provider verifies. Only providers able to verify attestations
+	// can sign leaf certificates when it is set.
+	RequireAttestation bool
+
+	// RootSigningFallback has leaf certificates signed with the root when the
+	// intermediate expired because it could not be renewed, for providers
+	// able to do so. It is a last resort to keep issuing certificates during
+	// a long outage of the provider.
+	RootSigningFallback bool
+
+	// TrustDomain sets the trust domain of the cluster, in the form
+	// "<cluster id>.consul", in place of the one generated when the CA was
+	// bootstrapped. Changing it migrates the cluster to the new trust domain,
+	// which requires PreviousTrustDomain to be set to the current one and a
+	// new root to be generated under the new trust domain.
+	TrustDomain string
+
+	// PreviousTrustDomain is the trust domain the cluster is migrating away
+	// from. While it is set, the roots of the previous trust domain are still
+	// published so that leaf certificates issued under it keep validating,
+	// and CSRs for identities in it are accepted and signed under the current
+	// trust domain. Removing it retires the previous trust domain.
+	PreviousTrustDomain string
+
+	// FederatedTrustDomains are the trust domains of federated peers. Leaf
+	// certificates may carry the service SPIFFE IDs of these trust domains as
+	// additional identities, such as while a service migrates between
+	// meshes. Their primary identity is always in the trust domain of the
+	// cluster.
+	FederatedTrustDomains []string
+
+	// MaxActiveRoots is the maximum number of roots, including the active
+	// one, the primary datacenter keeps at once. Root rotations which would
+	// exceed it are refused until roots no longer needed are removed with
+	// ConnectCA.PruneRoots. Zero means no limit.
+	MaxActiveRoots int
+
+	// RootGenerationQuorum is the number of distinct operators who must
+	// approve, with ConnectCA.ApproveRootGeneration, the generation of the
+	// initial root in the primary datacenter before it happens. Until then
+	// the CA stays uninitialized and no certificate is signed. Zero
+	// generates the root without approvals.
+	RootGenerationQuorum int
+
+	// InitializationTimeout bounds how long the leader retries initializing
+	// the CA before giving up with an error, rather than retrying in the
+	// background until it succeeds. Zero retries forever.
+	InitializationTimeout time.Duration
+
+	// BootstrapCertTTL is the TTL of the certificates signed with
+	// ConnectCA.SignBootstrap for agents joining the cluster. It defaults to
+	// DefaultBootstrapCertTTL and can't exceed MaxBootstrapCertTTL.
+	BootstrapCertTTL time.Duration
+
+	// BootstrapCSRMaxPerSecond is a rate limit on signing bootstrap
+	// certificates, separate from CSRMaxPerSecond so that a wave of joining
+	// agents doesn't hold back service certificates and the other way round.
+	// 0 disables the rate limit. Defaults to 5.
+	BootstrapCSRMaxPerSecond float32
+
+	// AdditionalTrustAnchors are PEM-encoded CA certificates, managed outside
+	// of Consul, to publish along with the roots so that certificates they
+	// issued are trusted, for example by a partner mesh. They are only used
+	// to verify certificates and never become the active root.
+	AdditionalTrustAnchors []string
+
+	// FederationCollisionPolicy is what to do with an AdditionalTrustAnchors
+	// certificate whose SPIFFE ID is in the trust domain of the cluster but
+	// whose key none of the roots has, such as the root of a federated
+	// cluster set up with the same cluster ID. FederationCollisionReject
+	// refuses the configuration and doesn't publish such anchors, and
+	// FederationCollisionMergeVerifyOnly publishes them to verify
+	// certificates only, refusing any rotation that would make one the
+	// active root. When empty, they are published like other anchors.
+	FederationCollisionPolicy string
+
+	// ForceRenewOnLeafTTLDecrease asks clients to renew their leaf
+	// certificates early when a configuration change decreases LeafCertTTL,
+	// so that certificates issued with the previous TTL are replaced soon
+	// rather than when they would have been renewed.
+	ForceRenewOnLeafTTLDecrease bool
+
+	// IntermediateGracePeriod is how long an intermediate replaced by a
+	// renewal stays in the IntermediateCerts of the active root, and so in
+	// the chain of the leaf certificates signed since, before it is dropped.
+	// Providers sign with the new intermediate as soon as it is issued, as
+	// they replace their key when renewing. Zero keeps replaced intermediates
+	// until the root is rotated.
+	IntermediateGracePeriod time.Duration
+
+	// MinIntermediateRemaining is how long the intermediate signing leaf
+	// certificates must still be valid for leaf certificates to be signed.
+	// Once less is left, signing requests fail with a retryable error and the
+	// intermediate is renewed, even before half its lifetime passed, so that
+	// no leaf certificate outlives its issuer by much. Zero disables the
+	// check.
+	MinIntermediateRemaining time.Duration
+
+	// LeafRenewalOverlap is how long a renewed leaf certificate is guaranteed
+	// to overlap with the previous one of the same identity, by having the
+	// CA provider start its validity early enough. It helps clients whose
+	// clock is behind the one of the provider, which would otherwise get a
+	// leaf that isn't valid yet for them. Only the leaves signed since the
+	// current leader was elected are known, and only providers implementing
+	// ca.ParamsSigner can backdate leaves. Zero disables it.
+	LeafRenewalOverlap time.Duration
+
+	// JWTSigning enables ConnectCA.SignWithJWT, which signs leaf certificates
+	// for workloads authenticating with a JWT instead of an ACL token.
+	JWTSigning *CAJWTSigningConfig
+
+	// AuditSink, when set, has the leader stream a record of every leaf
+	// certificate it signs to an external sink, such as the feed of a SIEM.
+	AuditSink *CAAuditSinkConfig
+
+	// AcknowledgeKeyDowngrade acknowledges that a rotation of the root or a
+	// renewal of the intermediate produces a weaker key than the one it
+	// replaces, for example fewer RSA bits or a smaller curve, so that it is
+	// logged rather than warned about and counted.
+	AcknowledgeKeyDowngrade bool
+
+	// AllowSingleTier accepts intermediates that are signed for the key of
+	// the root, for external CAs that issue leaf certificates with their root
+	// key. Such intermediates are refused otherwise, as the root key would
+	// then be used to sign every leaf certificate.
+	AllowSingleTier bool
+
+	// IncludeIssuingChain has secondary datacenters return the issuing chain
+	// of the leaf certificates they sign, their intermediate followed by the
+	// intermediates of the primary datacenter, in the IntermediateCerts of the
+	// IssuedCert. Clients can then verify the leaf certificates against the
+	// root without fetching the roots of both datacenters.
+	IncludeIssuingChain bool
+
+	// CertTemplates are named sets of fields applied to the leaf
+	// certificates of the identities CertTemplateRules select them for.
+	// Only providers able to sign with parameters chosen by Consul, like the
+	// built-in one, apply them.
+	CertTemplates map[string]CACertTemplate
+
+	// CertTemplateRules select the template of the leaf certificate of an
+	// identity. The first matching rule applies.
+	CertTemplateRules []CACertTemplateRule
+
+	// DefaultCertTemplate is the template of identities no rule matches. When
+	// empty, their leaf certificates are signed as configured above.
+	DefaultCertTemplate string
+
+	// MaxServiceLeafCertTTL bounds the LeafCertTTL that service-defaults
+	// config entries set for the leaf certificates of their service. When
+	// zero, it is LeafCertTTL, so that they can only shorten it.
+	MaxServiceLeafCertTTL time.Duration
+}
+
+// CACertTemplate is a set of fields of a leaf certificate. Unset fields keep
+// their default.
+type CACertTemplate struct {
+	// LeafCertTTL replaces the LeafCertTTL of the CA configuration.
+	LeafCertTTL time.Duration
+
+	// ExtKeyUsage replaces the extended key usages of the certificate, which
+	// are otherwise client_auth and server_auth. See CertTemplateExtKeyUsages
+	// for the supported values.
+	ExtKeyUsage []string
+
+	// PolicyOIDs are the certificate policies of the certificate, in dotted
+	// decimal form.
+	PolicyOIDs []string
+
+	// KeyUsage replaces the key usages of the certificate, for workloads
+	// using it beyond mTLS. It must include CertTemplateMTLSKeyUsages. See
+	// CertTemplateKeyUsages for the supported values.
+	KeyUsage []string
+}
+
+// CertTemplateExtKeyUsages are the supported values of
+// CACertTemplate.ExtKeyUsage.
+var CertTemplateExtKeyUsages = map[string]x509.ExtKeyUsage{
+	"client_auth":      x509.ExtKeyUsageClientAuth,
+	"server_auth":      x509.ExtKeyUsageServerAuth,
+	"code_signing":     x509.ExtKeyUsageCodeSigning,
+	"email_protection": x509.ExtKeyUsageEmailProtection,
+}
+
+// CertTemplateKeyUsages are the supported values of CACertTemplate.KeyUsage.
+// Leaf certificates can't be given the usages of a CA.
+var CertTemplateKeyUsages = map[string]x509.KeyUsage{
+	"digital_signature":  x509.KeyUsageDigitalSignature,
+	"content_commitment": x509.KeyUsageContentCommitment,
+	"key_encipherment":   x509.KeyUsageKeyEncipherment,
+	"data_encipherment":  x509.KeyUsageDataEncipherment,
+	"key_agreement":      x509.KeyUsageKeyAgreement,
+}
+
+// CertTemplateMTLSKeyUsages are the key usages that mTLS requires, which
+// every CACertTemplate.KeyUsage must include.
+var CertTemplateMTLSKeyUsages = []string{"digital_signature", "key_encipherment"}
+
+// KeyUsageBits returns the key usages of the template as x509.KeyUsage bits,
+// or zero if it doesn't set any.
+func (t CACertTemplate) KeyUsageBits() x509.KeyUsage {
+	var bits x509.KeyUsage
+	for _, usage := range t.KeyUsage {
+		bits |= CertTemplateKeyUsages[usage]
+	}
+	return bits
+}
+
+// CACertTemplateRule selects the template of the leaf certificates of the
+// identities it matches.
+type CACertTemplateRule struct {
+	// IdentityType is the type of SPIFFE ID the rule matches, "service" or
+	// "agent".
+	IdentityType string
+
+	// Pattern is matched against the name of the service or agent with
+	// path.Match, for example "*-gateway". An empty pattern matches every
+	// identity of IdentityType.
+	Pattern string
+
+	// Template is the name of the template to apply.
+	Template string
+}
+
+// Matches returns whether the rule matches the identity of the given type and
+// name.
+func (r CACertTemplateRule) Matches(identityType, name string) bool {
+	if r.IdentityType != identityType {
+		return false
+	}
+	if r.Pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(r.Pattern, name)
+	return ok
+}
+
+// CertTemplateFor returns the name of the template of the leaf certificates
+// of the identity of the given type and name, or an empty string if it has
+// none.
+func (c CommonCAProviderConfig) CertTemplateFor(identityType, name string) string {
+	for _, rule := range c.CertTemplateRules {
+		if rule.Matches(identityType, name) {
+			return rule.Template
+		}
+	}
+	return c.DefaultCertTemplate
+}
+
+// validateCertTemplates returns an error if a template or rule is invalid or
+// refers to a template that doesn't exist.
+func (c CommonCAProviderConfig) validateCertTemplates() error {
+	for name, tmpl := range c.CertTemplates {
+		if tmpl.LeafCertTTL != 0 {
+			if tmpl.LeafCertTTL < MinLeafCertTTL || tmpl.LeafCertTTL > MaxLeafCertTTL {
+				return fmt.Errorf("CertTemplates[%q]: LeafCertTTL must be between %s and %s", name, MinLeafCertTTL, MaxLeafCertTTL)
+			}
+			if c.IntermediateCertTTL < 3*tmpl.LeafCertTTL {
+				return fmt.Errorf("CertTemplates[%q]: IntermediateCertTTL must be greater or equal than 3 * LeafCertTTL (>=%s)", name, 3*tmpl.LeafCertTTL)
+			}
+		}
+		for _, usage := range tmpl.ExtKeyUsage {
+			if _, ok := CertTemplateExtKeyUsages[usage]; !ok {
+				return fmt.Errorf("CertTemplates[%q]: unsupported ExtKeyUsage %q", name, usage)
+			}
+		}
+		for _, raw := range tmpl.PolicyOIDs {
+			if _, err := ParseOID(raw); err != nil {
+				return fmt.Errorf("CertTemplates[%q]: invalid PolicyOIDs entry %q: %v", name, raw, err)
+			}
+		}
+		for _, usage := range tmpl.KeyUsage {
+			if _, ok := CertTemplateKeyUsages[usage]; !ok {
+				return fmt.Errorf("CertTemplates[%q]: unsupported KeyUsage %q", name, usage)
+			}
+		}
+		if len(tmpl.KeyUsage) > 0 {
+			for _, usage := range CertTemplateMTLSKeyUsages {
+				if tmpl.KeyUsageBits()&CertTemplateKeyUsages[usage] == 0 {
+					return fmt.Errorf("CertTemplates[%q]: KeyUsage must include %s, which mTLS requires",
+						name, strings.Join(CertTemplateMTLSKeyUsages, " and "))
+				}
+			}
+		}
+	}
+	for i, rule := range c.CertTemplateRules {
+		if rule.IdentityType != "service" && rule.IdentityType != "agent" {
+			return fmt.Errorf("CertTemplateRules[%d]: IdentityType must be either 'service' or 'agent'", i)
+		}
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return fmt.Errorf("CertTemplateRules[%d]: invalid Pattern %q: %v", i, rule.Pattern, err)
+		}
+		if _, ok := c.CertTemplates[rule.Template]; !ok {
+			return fmt.Errorf("CertTemplateRules[%d]: unknown template %q", i, rule.Template)
+		}
+	}
+	if c.DefaultCertTemplate != "" {
+		if _, ok := c.CertTemplates[c.DefaultCertTemplate]; !ok {
+			return fmt.Errorf("DefaultCertTemplate: unknown template %q", c.DefaultCertTemplate)
+		}
+	}
+	return nil
+}
+
+// CAJWTSigningConfig configures how the JWTs of ConnectCA.SignWithJWT
+// requests are validated and which service identity they grant. The
+// validation settings are those of the "jwt" ACL auth method. Exactly one of
+// JWKSURL, JWTValidationPubKeys and OIDCDiscoveryURL must be set.
+type CAJWTSigningConfig struct {
+	JWKSURL              string
+	JWKSCACert           string
+	JWTValidationPubKeys []string
+	OIDCDiscoveryURL     string
+	OIDCDiscoveryCACert  string
+	BoundIssuer          string
+	BoundAudiences       []string
+	JWTSupportedAlgs     []string
+	ExpirationLeeway     time.Duration
+	NotBeforeLeeway      time.Duration
+	ClockSkewLeeway      time.Duration
+
+	// ServiceClaim is the name of the claim, or JSON pointer to it, holding
+	// the name of the service the JWT grants the identity of.
+	ServiceClaim string
+
+	// AllowedServices, when not empty, lists the only services certificates
+	// can be signed for with a JWT.
+	AllowedServices []string
+}
+
+// Validate returns an error if the configuration can't be used to validate
+// JWTs.
+func (c *CAJWTSigningConfig) Validate() error {
+	sources := 0
+	for _, set := range []bool{c.JWKSURL != "", len(c.JWTValidationPubKeys) > 0, c.OIDCDiscoveryURL != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("exactly one of JWKSURL, JWTValidationPubKeys and OIDCDiscoveryURL must be set")
+	}
+	if c.ServiceClaim == "" {
+		return fmt.Errorf("ServiceClaim must be set")
+	}
+	return nil
+}
+
+// CAAuditSinkTypes are the supported types of CAAuditSinkConfig.
+var CAAuditSinkTypes = []string{"file", "syslog", "http"}
+
+// DefaultCAAuditBufferSize is the BufferSize of a CAAuditSinkConfig which
+// doesn't set it.
+const DefaultCAAuditBufferSize = 1024
+
+// CAAuditSinkConfig configures the delivery of the records of the leaf
+// certificates signed by the leader. Records are buffered in memory and
+// delivered at least once, failed deliveries being retried in the background
+// without blocking signing. The destination of the sink, such as the file or
+// the endpoint, is part of the configuration of the servers, not of this one.
+type CAAuditSinkConfig struct {
+	// Type is the type of the sink, one of CAAuditSinkTypes.
+	Type string
+
+	// BufferSize is how many records are kept while they can't be delivered.
+	// Records of certificates signed while it is full are dropped and
+	// counted. Defaults to DefaultCAAuditBufferSize.
+	BufferSize int
+}
+
+func (c *CAAuditSinkConfig) Validate() error {
+	switch c.Type {
+	case "file", "syslog", "http":
+	default:
+		return fmt.Errorf("Type must be one of %s", strings.Join(CAAuditSinkTypes, ", "))
+	}
+	if c.BufferSize < 0 {
+		return fmt.Errorf("BufferSize must not be negative")
+	}
+	return nil
+}
+
+// Buffer returns BufferSize, or DefaultCAAuditBufferSize when it isn't set.
+func (c *CAAuditSinkConfig) Buffer() int {
+	if c.BufferSize == 0 {
+		return DefaultCAAuditBufferSize
+	}
+	return c.BufferSize
+}
+
+// BootstrapTTL returns BootstrapCertTTL, or DefaultBootstrapCertTTL when it
+// isn't set.
+func (c CommonCAProviderConfig) BootstrapTTL() time.Duration {
+	if c.BootstrapCertTTL == 0 {
+		return DefaultBootstrapCertTTL
+	}
+	return c.BootstrapCertTTL
+}
+
+// ServiceLeafTTLBound returns MaxServiceLeafCertTTL, or LeafCertTTL when it
+// isn't set.
+func (c CommonCAProviderConfig) ServiceLeafTTLBound() time.Duration {
+	if c.MaxServiceLeafCertTTL == 0 {
+		return c.LeafCertTTL
+	}
+	return c.MaxServiceLeafCertTTL
+}
+
+// TrustDomainClusterID returns the cluster ID of TrustDomain, or an empty
+// string if it isn't set.
+func (c CommonCAProviderConfig) TrustDomainClusterID() string {
+	return strings.TrimSuffix(strings.ToLower(c.TrustDomain), ".consul")
+}
+
+// csrSignatureAlgorithm describes a supported value of
+// IntermediateCSRSignatureAlgorithm.
+type csrSignatureAlgorithm struct {
+	algorithm x509.SignatureAlgorithm
+	keyType   string
+	hashBits  int
+}
+
+var csrSignatureAlgorithms = map[string]csrSignatureAlgorithm{
+	"SHA256WithRSA":   {x509.SHA256WithRSA, "rsa", 256},
+	"SHA384WithRSA":   {x509.SHA384WithRSA, "rsa", 384},
+	"SHA512WithRSA":   {x509.SHA512WithRSA, "rsa", 512},
+	"ECDSAWithSHA256": {x509.ECDSAWithSHA256, "ec", 256},
+	"ECDSAWithSHA384": {x509.ECDSAWithSHA384, "ec", 384},
+	"ECDSAWithSHA512": {x509.ECDSAWithSHA512, "ec", 512},
+	"PureEd25519":     {x509.PureEd25519, "ed25519", 0},
+}
+
+// IntermediateCSRSigAlgo returns the signature algorithm to sign intermediate
+// CSRs with, or x509.UnknownSignatureAlgorithm to use the default for the key.
+func (c CommonCAProviderConfig) IntermediateCSRSigAlgo() x509.SignatureAlgorithm {
+	return csrSignatureAlgorithms[c.IntermediateCSRSignatureAlgorithm].algorithm
+}
+
+// IntermediateCSRSignatureBits returns the size in bits of the hash used to
+// sign intermediate CSRs, or 0 to use the default for the key.
+func (c CommonCAProviderConfig) IntermediateCSRSignatureBits() int {
+	return csrSignatureAlgorithms[c.IntermediateCSRSignatureAlgorithm].hashBits
+}
+
+// validateTrustAnchor checks that anchor is a single PEM-encoded CA
+// certificate.
+func validateTrustAnchor(anchor string) error {
+	block, rest := pem.Decode([]byte(anchor))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("must be a PEM-encoded certificate")
+	}
+	if strings.TrimSpace(string(rest)) != "" {
+		return fmt.Errorf("must be a single certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("error parsing certificate: %v", err)
+	}
+	if !cert.IsCA {
+		return fmt.Errorf("certificate %q is not a CA", cert.Subject.CommonName)
+	}
+	return nil
+}
+
+// validSpiffeTrustDomain returns whether td is a trust domain name as the
+// SPIFFE ID specification allows, made of lowercase letters, digits, dots,
+// dashes and underscores.
+func validSpiffeTrustDomain(td string) bool {
+	if td == "" || len(td) > 255 {
+		return false
+	}
+	for _, r := range td {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '.' && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// validTrustDomain returns whether td is a trust domain Consul can sign
+// certificates for, a lowercase DNS label followed by ".consul". Trust domains
+// are compared as is in SPIFFE IDs, so mixed case ones are refused rather than
+// normalized.
+func validTrustDomain(td string) bool {
+	clusterID := strings.TrimSuffix(td, ".consul")
+	if clusterID == td || clusterID == "" || len(clusterID) > 63 {
+		return false
+	}
+	for _, r := range clusterID {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// CertSubject holds the distinguished name fields that may be set on the
+// subject of a CA certificate signing request.
+type CertSubject struct {
+	Country            []string
+	Organization       []string
+	OrganizationalUnit []string
+	Locality           []string
+	Province           []string
+	StreetAddress      []string
+	PostalCode         []string
+}
+
+// maxCertSubjectFieldLength is the upper bound for the DN attributes we
+// support, taken from the X.520 ub-organization-name and related bounds.
+const maxCertSubjectFieldLength = 64
+
+// Validate checks that every field of the subject can be encoded as an ASN.1
+// PrintableString and fits within the X.520 upper bounds.
+func (s *CertSubject) Validate() error {
+	if s == nil {
+		return nil
+	}
+
+	for _, c := range s.Country {
+		if len(c) != 2 || strings.ToUpper(c) != c || !isPrintableString(c) {
+			return fmt.Errorf("intermediate cert subject country %q must be a two letter ISO 3166 code", c)
+		}
+	}
+
+	fields := []struct {
+		name   string
+		values []string
+	}{
+		{"organization", s.Organization},
+		{"organizational unit", s.OrganizationalUnit},
+		{"locality", s.Locality},
+		{"province", s.Province},
+		{"street address", s.StreetAddress},
+		{"postal code", s.PostalCode},
+	}
+	for _, f := range fields {
+		for _, v := range f.values {
+			if v == "" {
+				return fmt.Errorf("intermediate cert subject %s must not be empty", f.name)
+			}
+			if len(v) > maxCertSubjectFieldLength {
+				return fmt.Errorf("intermediate cert subject %s %q must be at most %d characters",
+					f.name, v, maxCertSubjectFieldLength)
+			}
+			if !isPrintableString(v) {
+				return fmt.Errorf("intermediate cert subject %s %q contains characters that are not "+
+					"allowed in a PrintableString", f.name, v)
+			}
+		}
+	}
+	return nil
+}
+
+// ToPKIXName returns the subject as a pkix.Name. A nil subject results in an
+// empty name.
+func (s *CertSubject) ToPKIXName() pkix.Name {
+	if s == nil {
+		return pkix.Name{}
+	}
+	return pkix.Name{
+		Country:            s.Country,
+		Organization:       s.Organization,
+		OrganizationalUnit: s.OrganizationalUnit,
+		Locality:           s.Locality,
+		Province:           s.Province,
+		StreetAddress:      s.StreetAddress,
+		PostalCode:         s.PostalCode,
+	}
+}
+
+// isPrintableString reports whether s only contains characters from the ASN.1
+// PrintableString character set.
+func isPrintableString(s string) bool {
+	for _, r := range s {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case strings.ContainsRune(" '()+,-./:=?", r):
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 var MinLeafCertTTL = time.Hour
 var MaxLeafCertTTL = 365 * 24 * time.Hour
 
+// DefaultBootstrapCertTTL and MaxBootstrapCertTTL are the default and maximum
+// TTL of bootstrap certificates. The minimum leaves some time to use them
+// since leaf certificates are backdated by a minute.
+var (
+	DefaultBootstrapCertTTL = 5 * time.Minute
+	MinBootstrapCertTTL     = 2 * time.Minute
+	MaxBootstrapCertTTL     = 15 * time.Minute
+)
+
 // intermediateCertRenewInterval is the interval at which the expiration
 // of the intermediate cert is checked and renewed if necessary.
 var IntermediateCertRenewInterval = time.Hour
@@ -477,8 +1781,134 @@ func (c CommonCAProviderConfig) Validate() error {
 		if c.PrivateKeyBits != 2048 && c.PrivateKeyBits != 4096 {
 			return fmt.Errorf("RSA key length must be 2048 or 4096 bits")
 		}
+	case "ed25519":
+		// The key length is fixed, 0 is accepted for configurations that
+		// don't set it.
+		if c.PrivateKeyBits != 0 && c.PrivateKeyBits != 256 {
+			return fmt.Errorf("Ed25519 key length must be 256 bits")
+		}
+	default:
+		return fmt.Errorf("private key type must be one of 'ec', 'rsa' or 'ed25519'")
+	}
+
+	if err := c.IntermediateCertSubject.Validate(); err != nil {
+		return err
+	}
+
+	if c.MaxActiveRoots < 0 || c.MaxActiveRoots == 1 {
+		return fmt.Errorf("MaxActiveRoots must be 0 or at least 2 to allow root rotations")
+	}
+
+	if c.InitializationTimeout < 0 {
+		return fmt.Errorf("InitializationTimeout must not be negative")
+	}
+
+	if c.IntermediateGracePeriod < 0 {
+		return fmt.Errorf("IntermediateGracePeriod must not be negative")
+	}
+
+	if c.IntermediateSignMaxConcurrent < 0 {
+		return fmt.Errorf("IntermediateSignMaxConcurrent must not be negative")
+	}
+
+	if c.MinIntermediateRemaining < 0 {
+		return fmt.Errorf("MinIntermediateRemaining must not be negative")
+	}
+	if c.MinIntermediateRemaining > 0 && c.MinIntermediateRemaining >= c.IntermediateCertTTL {
+		return fmt.Errorf("MinIntermediateRemaining must be less than IntermediateCertTTL (<%s)", c.IntermediateCertTTL)
+	}
+
+	if c.LeafRenewalOverlap < 0 {
+		return fmt.Errorf("LeafRenewalOverlap must not be negative")
+	}
+
+	if err := c.validateCertTemplates(); err != nil {
+		return err
+	}
+	if c.MaxServiceLeafCertTTL != 0 {
+		if c.MaxServiceLeafCertTTL < c.LeafCertTTL || c.MaxServiceLeafCertTTL > MaxLeafCertTTL {
+			return fmt.Errorf("MaxServiceLeafCertTTL must be between LeafCertTTL (%s) and %s", c.LeafCertTTL, MaxLeafCertTTL)
+		}
+		if c.IntermediateCertTTL < 3*c.MaxServiceLeafCertTTL {
+			return fmt.Errorf("IntermediateCertTTL must be greater or equal than 3 * MaxServiceLeafCertTTL (>=%s)", 3*c.MaxServiceLeafCertTTL)
+		}
+	}
+
+	if c.JWTSigning != nil {
+		if err := c.JWTSigning.Validate(); err != nil {
+			return fmt.Errorf("JWTSigning: %v", err)
+		}
+	}
+
+	if c.AuditSink != nil {
+		if err := c.AuditSink.Validate(); err != nil {
+			return fmt.Errorf("AuditSink: %v", err)
+		}
+	}
+
+	if c.BootstrapCertTTL != 0 && (c.BootstrapCertTTL < MinBootstrapCertTTL || c.BootstrapCertTTL > MaxBootstrapCertTTL) {
+		return fmt.Errorf("BootstrapCertTTL must be between %s and %s", MinBootstrapCertTTL, MaxBootstrapCertTTL)
+	}
+
+	if c.BootstrapCSRMaxPerSecond < 0 {
+		return fmt.Errorf("BootstrapCSRMaxPerSecond must not be negative")
+	}
+
+	if c.CSRMaxPerSecondPerIdentity < 0 {
+		return fmt.Errorf("CSRMaxPerSecondPerIdentity must not be negative")
+	}
+	if c.CSRMaxPerSecondPerIdentity > 0 && c.CSRBurstPerIdentity < 1 {
+		return fmt.Errorf("CSRBurstPerIdentity must be at least 1 when CSRMaxPerSecondPerIdentity is set")
+	}
+
+	for i, anchor := range c.AdditionalTrustAnchors {
+		if err := validateTrustAnchor(anchor); err != nil {
+			return fmt.Errorf("AdditionalTrustAnchors[%d]: %v", i, err)
+		}
+	}
+
+	switch c.FederationCollisionPolicy {
+	case "", FederationCollisionReject, FederationCollisionMergeVerifyOnly:
 	default:
-		return fmt.Errorf("private key type must be either 'ec' or 'rsa'")
+		return fmt.Errorf("FederationCollisionPolicy must be %q or %q",
+			FederationCollisionReject, FederationCollisionMergeVerifyOnly)
+	}
+
+	if c.RootGenerationQuorum < 0 {
+		return fmt.Errorf("RootGenerationQuorum must not be negative")
+	}
+
+	for _, td := range []string{c.TrustDomain, c.PreviousTrustDomain} {
+		if td != "" && !validTrustDomain(td) {
+			return fmt.Errorf("trust domain %q must be of the form \"<cluster id>.consul\"", td)
+		}
+	}
+	if c.PreviousTrustDomain != "" {
+		if c.TrustDomain == "" {
+			return fmt.Errorf("PreviousTrustDomain requires TrustDomain to be set")
+		}
+		if strings.EqualFold(c.TrustDomain, c.PreviousTrustDomain) {
+			return fmt.Errorf("PreviousTrustDomain must be different from TrustDomain")
+		}
+	}
+	for i, td := range c.FederatedTrustDomains {
+		if !validSpiffeTrustDomain(td) {
+			return fmt.Errorf("FederatedTrustDomains[%d]: %q is not a valid SPIFFE trust domain", i, td)
+		}
+		if strings.EqualFold(td, c.TrustDomain) || strings.EqualFold(td, c.PreviousTrustDomain) {
+			return fmt.Errorf("FederatedTrustDomains[%d]: %q is a trust domain of the cluster", i, td)
+		}
+	}
+
+	if name := c.IntermediateCSRSignatureAlgorithm; name != "" {
+		algo, ok := csrSignatureAlgorithms[name]
+		if !ok {
+			return fmt.Errorf("intermediate CSR signature algorithm %q is not supported", name)
+		}
+		if algo.keyType != c.PrivateKeyType {
+			return fmt.Errorf("intermediate CSR signature algorithm %s cannot be used with private key type %q",
+				name, c.PrivateKeyType)
+		}
 	}
 
 	return nil
@@ -495,12 +1925,140 @@ type ConsulCAProviderConfig struct {
 	// cross sign. We don't document this config field publicly or make any
 	// attempt to parse it from snake case unlike other fields here.
 	DisableCrossSigning bool
+
+	// CSRExtensionPolicy controls how the built-in provider handles extensions
+	// requested in a leaf certificate CSR. See the CSRExtensionPolicy constants
+	// for the supported values. An empty value is the same as
+	// CSRExtensionPolicyIgnore.
+	CSRExtensionPolicy string
+
+	// CSRExtensionAllowlist is the list of extension OIDs, in dotted decimal
+	// form, which are copied from the CSR into the leaf certificate when
+	// CSRExtensionPolicy is CSRExtensionPolicyPassthroughAllowlisted.
+	CSRExtensionAllowlist []string
+
+	// TPMAttestationRoots is a PEM bundle of the CA certificates trusted to
+	// sign the attestation keys of TPMs. Leaf CSRs sent with a TPM
+	// attestation are only signed when it is set and the attestation key
+	// chains to one of them.
+	TPMAttestationRoots string
+
+	// CRLSignerEnabled makes the provider sign CRLs and OCSP responses with a
+	// dedicated certificate minted under the active signing cert, rather than
+	// with the key that signs leaf certificates.
+	CRLSignerEnabled bool
+
+	// CRLSignerCertTTL is the validity of the CRL signer certificate. A new
+	// one is minted once it expired. Zero uses LeafCertTTL.
+	CRLSignerCertTTL time.Duration
+}
+
+const (
+	// CSRExtensionPolicyIgnore signs leaf certificates with the SANs from the
+	// CSR and drops any other requested extension. This is the default.
+	CSRExtensionPolicyIgnore = "ignore"
+
+	// CSRExtensionPolicyReject refuses to sign a CSR which requests any
+	// extension other than a subject alternative name made up of URIs.
+	CSRExtensionPolicyReject = "reject"
+
+	// CSRExtensionPolicyPassthroughAllowlisted behaves like
+	// CSRExtensionPolicyIgnore but also copies the requested extensions listed
+	// in CSRExtensionAllowlist into the leaf certificate.
+	CSRExtensionPolicyPassthroughAllowlisted = "passthrough-allowlisted"
+)
+
+const (
+	// FederationCollisionReject refuses a CA configuration with an additional
+	// trust anchor colliding with the trust domain of the cluster.
+	FederationCollisionReject = "reject"
+
+	// FederationCollisionMergeVerifyOnly publishes the colliding anchors to
+	// verify certificates, but never lets one become the active root.
+	FederationCollisionMergeVerifyOnly = "merge-verify-only"
+)
+
+// reservedCSRExtensionOIDs are the extensions the built-in provider always
+// sets itself on leaf certificates. Allowing a CSR to override them would let
+// it request a certificate with different constraints, such as a CA
+// certificate, so they can't be allowlisted.
+var reservedCSRExtensionOIDs = map[string]string{
+	"2.5.29.14": "subject key identifier",
+	"2.5.29.15": "key usage",
+	"2.5.29.17": "subject alternative name",
+	"2.5.29.19": "basic constraints",
+	"2.5.29.30": "name constraints",
+	"2.5.29.35": "authority key identifier",
+	"2.5.29.37": "extended key usage",
 }
 
 func (c *ConsulCAProviderConfig) Validate() error {
+	if c.CRLSignerCertTTL < 0 {
+		return fmt.Errorf("CRLSignerCertTTL must not be negative")
+	}
+	if c.CRLSignerCertTTL != 0 && !c.CRLSignerEnabled {
+		return fmt.Errorf("CRLSignerCertTTL requires CRLSignerEnabled to be true")
+	}
+
+	if c.TPMAttestationRoots != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(c.TPMAttestationRoots)) {
+		return fmt.Errorf("TPMAttestationRoots must contain at least one PEM-encoded certificate")
+	}
+
+	switch c.CSRExtensionPolicy {
+	case "", CSRExtensionPolicyIgnore, CSRExtensionPolicyReject:
+		if len(c.CSRExtensionAllowlist) > 0 {
+			return fmt.Errorf("CSRExtensionAllowlist requires CSRExtensionPolicy to be %q", CSRExtensionPolicyPassthroughAllowlisted)
+		}
+	case CSRExtensionPolicyPassthroughAllowlisted:
+		for _, raw := range c.CSRExtensionAllowlist {
+			oid, err := ParseOID(raw)
+			if err != nil {
+				return fmt.Errorf("invalid CSRExtensionAllowlist entry %q: %v", raw, err)
+			}
+			if name, ok := reservedCSRExtensionOIDs[oid.String()]; ok {
+				return fmt.Errorf("invalid CSRExtensionAllowlist entry %q: the %s extension is always set by Consul", raw, name)
+			}
+		}
+	default:
+		return fmt.Errorf("CSRExtensionPolicy must be one of %q, %q or %q",
+			CSRExtensionPolicyIgnore, CSRExtensionPolicyReject, CSRExtensionPolicyPassthroughAllowlisted)
+	}
 	return nil
 }
 
+// CSRExtensionAllowlistOIDs returns the parsed CSRExtensionAllowlist. Entries
+// that are not valid OIDs are skipped, they are rejected by Validate.
+func (c *ConsulCAProviderConfig) CSRExtensionAllowlistOIDs() []asn1.ObjectIdentifier {
+	var oids []asn1.ObjectIdentifier
+	for _, raw := range c.CSRExtensionAllowlist {
+		if oid, err := ParseOID(raw); err == nil {
+			oids = append(oids, oid)
+		}
+	}
+	return oids
+}
+
+// ParseOID parses an ASN.1 object identifier in dotted decimal form, such as
+// "1.3.6.1.4.1.11129.2.4.2".
+func ParseOID(raw string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("an OID must have at least two components")
+	}
+	oid := make(asn1.ObjectIdentifier, 0, len(parts))
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || strconv.Itoa(n) != part {
+			return nil, fmt.Errorf("%q is not a valid OID component", part)
+		}
+		oid = append(oid, n)
+	}
+	if oid[0] > 2 {
+		return nil, fmt.Errorf("the first OID component must be 0, 1 or 2")
+	}
+	return oid, nil
+}
+
 // CAConsulProviderState is used to track the built-in Consul CA provider's state.
 type CAConsulProviderState struct {
 	ID               string
@@ -508,9 +2066,44 @@ type CAConsulProviderState struct {
 	RootCert         string
 	IntermediateCert string
 
+	// CRLSignerKey and CRLSignerCert are the PEM-encoded key and certificate
+	// used to sign CRLs and OCSP responses when CRLSignerEnabled is set. They
+	// are minted on first use and replaced once the cert expired or was not
+	// issued by the active signing cert.
+	CRLSignerKey  string
+	CRLSignerCert string
+
+	// Checksum is the SHA-256 checksum of the fields above, set by the state
+	// store whenever the state is written, so that a state that was damaged
+	// since, for example by restoring a truncated snapshot, can be detected.
+	// States written before checksums were introduced are given one when
+	// their snapshot is restored.
+	Checksum string `json:",omitempty"`
+
 	RaftIndex
 }
 
+// ComputeChecksum returns the checksum of the state, for the Checksum field.
+func (s *CAConsulProviderState) ComputeChecksum() string {
+	h := sha256.New()
+	for _, field := range []string{s.ID, s.PrivateKey, s.RootCert, s.IntermediateCert, s.CRLSignerKey, s.CRLSignerCert} {
+		// Prefix every field with its length so that moving bytes from one
+		// field to the next changes the checksum.
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(field)))
+		h.Write(size[:])
+		h.Write([]byte(field))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ChecksumValid returns whether the state has a Checksum and matches it. The
+// state store gives one to every state it writes or restores, so a state
+// without one was damaged.
+func (s *CAConsulProviderState) ChecksumValid() bool {
+	return s.Checksum != "" && s.Checksum == s.ComputeChecksum()
+}
+
 type VaultCAProviderConfig struct {
 	CommonCAProviderConfig `mapstructure:",squash"`
 
@@ -528,6 +2121,27 @@ type VaultCAProviderConfig struct {
 	TLSSkipVerify bool
 
 	AuthMethod *VaultAuthMethod `alias:"auth_method"`
+
+	// DelegatedLeafSigning makes Consul sign leaf certificates locally with a
+	// sub-intermediate CA that Vault signs once, instead of asking Vault to sign
+	// every leaf certificate.
+	DelegatedLeafSigning bool `alias:"delegated_leaf_signing"`
+
+	// SSHPKIPath is the path to a Vault SSH secrets engine used to sign SSH
+	// certificates. Signing SSH certificates is disabled when it is empty.
+	SSHPKIPath string `alias:"ssh_pki_path"`
+
+	// SSHAllowedDomains are the domains host SSH certificates can be signed
+	// for, along with their subdomains.
+	SSHAllowedDomains []string `alias:"ssh_allowed_domains"`
+
+	// SSHAllowUserCertificates allows signing user SSH certificates, for the
+	// SSHAllowedUsers only. Only host certificates are signed otherwise.
+	SSHAllowUserCertificates bool `alias:"ssh_allow_user_certificates"`
+
+	// SSHAllowedUsers are the users user SSH certificates can be signed for
+	// when SSHAllowUserCertificates is set. It can't be empty then.
+	SSHAllowedUsers []string `alias:"ssh_allowed_users"`
 }
 
 type VaultAuthMethod struct {
@@ -541,6 +2155,29 @@ type AWSCAProviderConfig struct {
 
 	ExistingARN  string
 	DeleteOnExit bool
+
+	// Region is the AWS region of the PCA. When empty, it is the region the
+	// AWS SDK is configured with.
+	Region string
+
+	// AssumeRoleARN is the ARN of an IAM role to assume to manage the PCA,
+	// for example one of another account. AssumeRoleExternalID and
+	// AssumeRoleSessionName optionally set the external ID and session name
+	// of the assumed role.
+	AssumeRoleARN         string
+	AssumeRoleExternalID  string
+	AssumeRoleSessionName string
+
+	// MonthlyIssuanceQuota is the number of certificates the PCA may issue in
+	// a calendar month, as agreed with AWS, reported along with the number
+	// issued so far. Zero means there is no quota.
+	MonthlyIssuanceQuota int64
+
+	// AllowedTemplateARNs are the certificate templates leaf signing requests
+	// may pick with the TemplateArn sign option. Requests picking any other
+	// template are refused. Templates issuing CA certificates are never
+	// allowed.
+	AllowedTemplateARNs []string
 }
 
 // CALeafOp is the operation for a request related to leaf certificates.
@@ -1,6 +1,8 @@
 package structs
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -24,9 +26,12 @@ func TestCAConfiguration_GetCommonConfig(t *testing.T) {
 				},
 			},
 			want: &CommonCAProviderConfig{
-				LeafCertTTL:         72 * time.Hour,
-				IntermediateCertTTL: 4320 * time.Hour,
-				CSRMaxPerSecond:     50,
+				LeafCertTTL:                72 * time.Hour,
+				IntermediateCertTTL:        4320 * time.Hour,
+				CSRMaxPerSecond:            50,
+				BootstrapCSRMaxPerSecond:   5,
+				CSRMaxPerSecondPerIdentity: 10,
+				CSRBurstPerIdentity:        50,
 			},
 		},
 		{
@@ -44,9 +49,12 @@ func TestCAConfiguration_GetCommonConfig(t *testing.T) {
 				},
 			},
 			want: &CommonCAProviderConfig{
-				LeafCertTTL:         72 * time.Hour,
-				IntermediateCertTTL: 4320 * time.Hour,
-				CSRMaxPerSecond:     50, // The default value
+				LeafCertTTL:                72 * time.Hour,
+				IntermediateCertTTL:        4320 * time.Hour,
+				CSRMaxPerSecond:            50, // The default value
+				BootstrapCSRMaxPerSecond:   5,  // The default value
+				CSRMaxPerSecondPerIdentity: 10, // The default value
+				CSRBurstPerIdentity:        50, // The default value
 			},
 		},
 	}
@@ -103,7 +111,19 @@ func TestCAProviderConfig_Validate(t *testing.T) {
 				RootCertTTL:         5 * time.Hour,
 			},
 			wantErr: true,
-			wantMsg: "private key type must be either 'ec' or 'rsa'",
+			wantMsg: "private key type must be one of 'ec', 'rsa' or 'ed25519'",
+		},
+		{
+			name: "ed25519 key with RSA key length",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ed25519",
+				PrivateKeyBits:      2048,
+			},
+			wantErr: true,
+			wantMsg: "Ed25519 key length must be 256 bits",
 		},
 		{
 			name: "good intermediate/leaf cert TTL/key type, missing bits",
@@ -127,6 +147,17 @@ func TestCAProviderConfig_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "good ed25519 key type",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ed25519",
+				PrivateKeyBits:      256,
+			},
+			wantErr: false,
+		},
 		{
 			name: "good root cert/ intermediate TTLs",
 			cfg: &CommonCAProviderConfig{
@@ -151,6 +182,535 @@ func TestCAProviderConfig_Validate(t *testing.T) {
 			wantErr: true,
 			wantMsg: "root cert TTL is set and is not greater than intermediate cert ttl. root cert ttl: 3h0m0s, intermediate cert ttl: 4h0m0s",
 		},
+		{
+			name: "good intermediate cert subject",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				IntermediateCertSubject: &CertSubject{
+					Country:            []string{"US"},
+					Organization:       []string{"Example, Inc."},
+					OrganizationalUnit: []string{"Platform"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "bad intermediate cert subject country",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				IntermediateCertSubject: &CertSubject{
+					Country: []string{"USA"},
+				},
+			},
+			wantErr: true,
+			wantMsg: `intermediate cert subject country "USA" must be a two letter ISO 3166 code`,
+		},
+		{
+			name: "bad intermediate cert subject charset",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				IntermediateCertSubject: &CertSubject{
+					Organization: []string{"Example & Co"},
+				},
+			},
+			wantErr: true,
+			wantMsg: `intermediate cert subject organization "Example & Co" contains characters that are not allowed in a PrintableString`,
+		},
+		{
+			name: "bad intermediate cert subject length",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				IntermediateCertSubject: &CertSubject{
+					OrganizationalUnit: []string{strings.Repeat("a", 65)},
+				},
+			},
+			wantErr: true,
+			wantMsg: fmt.Sprintf(`intermediate cert subject organizational unit %q must be at most 64 characters`, strings.Repeat("a", 65)),
+		},
+		{
+			name: "good intermediate CSR signature algorithm",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:                       1 * time.Hour,
+				IntermediateCertTTL:               4 * time.Hour,
+				RootCertTTL:                       5 * time.Hour,
+				PrivateKeyType:                    "rsa",
+				PrivateKeyBits:                    2048,
+				IntermediateCSRSignatureAlgorithm: "SHA256WithRSA",
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown intermediate CSR signature algorithm",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:                       1 * time.Hour,
+				IntermediateCertTTL:               4 * time.Hour,
+				RootCertTTL:                       5 * time.Hour,
+				PrivateKeyType:                    "ec",
+				PrivateKeyBits:                    256,
+				IntermediateCSRSignatureAlgorithm: "SHA1WithRSA",
+			},
+			wantErr: true,
+			wantMsg: `intermediate CSR signature algorithm "SHA1WithRSA" is not supported`,
+		},
+		{
+			name: "intermediate CSR signature algorithm for another key type",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:                       1 * time.Hour,
+				IntermediateCertTTL:               4 * time.Hour,
+				RootCertTTL:                       5 * time.Hour,
+				PrivateKeyType:                    "ec",
+				PrivateKeyBits:                    256,
+				IntermediateCSRSignatureAlgorithm: "SHA256WithRSA",
+			},
+			wantErr: true,
+			wantMsg: `intermediate CSR signature algorithm SHA256WithRSA cannot be used with private key type "ec"`,
+		},
+		{
+			name: "trust domain migration",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				TrustDomain:         "22222222-3333-4444-5555-666666666666.consul",
+				PreviousTrustDomain: "11111111-2222-3333-4444-555555555555.consul",
+			},
+			wantErr: false,
+		},
+		{
+			name: "trust domain not under consul",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				TrustDomain:         "example.com",
+			},
+			wantErr: true,
+			wantMsg: `trust domain "example.com" must be of the form "<cluster id>.consul"`,
+		},
+		{
+			name: "trust domain with uppercase letters",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				TrustDomain:         "22222222-3333-4444-5555-66666666666A.consul",
+			},
+			wantErr: true,
+			wantMsg: `trust domain "22222222-3333-4444-5555-66666666666A.consul" must be of the form "<cluster id>.consul"`,
+		},
+		{
+			name: "previous trust domain with uppercase suffix",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				TrustDomain:         "22222222-3333-4444-5555-666666666666.consul",
+				PreviousTrustDomain: "11111111-2222-3333-4444-555555555555.CONSUL",
+			},
+			wantErr: true,
+			wantMsg: `trust domain "11111111-2222-3333-4444-555555555555.CONSUL" must be of the form "<cluster id>.consul"`,
+		},
+		{
+			name: "previous trust domain without trust domain",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				PreviousTrustDomain: "11111111-2222-3333-4444-555555555555.consul",
+			},
+			wantErr: true,
+			wantMsg: `PreviousTrustDomain requires TrustDomain to be set`,
+		},
+		{
+			name: "federated trust domains",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:           1 * time.Hour,
+				IntermediateCertTTL:   4 * time.Hour,
+				RootCertTTL:           5 * time.Hour,
+				PrivateKeyType:        "ec",
+				PrivateKeyBits:        256,
+				FederatedTrustDomains: []string{"partner.example.com", "33333333-4444-5555-6666-777777777777.consul"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "federated trust domain not valid",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:           1 * time.Hour,
+				IntermediateCertTTL:   4 * time.Hour,
+				RootCertTTL:           5 * time.Hour,
+				PrivateKeyType:        "ec",
+				PrivateKeyBits:        256,
+				FederatedTrustDomains: []string{"spiffe://partner.example.com"},
+			},
+			wantErr: true,
+			wantMsg: `FederatedTrustDomains[0]: "spiffe://partner.example.com" is not a valid SPIFFE trust domain`,
+		},
+		{
+			name: "federated trust domain of the cluster",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:           1 * time.Hour,
+				IntermediateCertTTL:   4 * time.Hour,
+				RootCertTTL:           5 * time.Hour,
+				PrivateKeyType:        "ec",
+				PrivateKeyBits:        256,
+				TrustDomain:           "22222222-3333-4444-5555-666666666666.consul",
+				FederatedTrustDomains: []string{"22222222-3333-4444-5555-666666666666.consul"},
+			},
+			wantErr: true,
+			wantMsg: `FederatedTrustDomains[0]: "22222222-3333-4444-5555-666666666666.consul" is a trust domain of the cluster`,
+		},
+		{
+			name: "max active roots of one",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				MaxActiveRoots:      1,
+			},
+			wantErr: true,
+			wantMsg: "MaxActiveRoots must be 0 or at least 2 to allow root rotations",
+		},
+		{
+			name: "negative root generation quorum",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:          1 * time.Hour,
+				IntermediateCertTTL:  4 * time.Hour,
+				RootCertTTL:          5 * time.Hour,
+				PrivateKeyType:       "ec",
+				PrivateKeyBits:       256,
+				RootGenerationQuorum: -1,
+			},
+			wantErr: true,
+			wantMsg: "RootGenerationQuorum must not be negative",
+		},
+		{
+			name: "negative initialization timeout",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:           1 * time.Hour,
+				IntermediateCertTTL:   4 * time.Hour,
+				RootCertTTL:           5 * time.Hour,
+				PrivateKeyType:        "ec",
+				PrivateKeyBits:        256,
+				InitializationTimeout: -time.Second,
+			},
+			wantErr: true,
+			wantMsg: "InitializationTimeout must not be negative",
+		},
+		{
+			name: "negative intermediate grace period",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:             1 * time.Hour,
+				IntermediateCertTTL:     4 * time.Hour,
+				RootCertTTL:             5 * time.Hour,
+				PrivateKeyType:          "ec",
+				PrivateKeyBits:          256,
+				IntermediateGracePeriod: -time.Second,
+			},
+			wantErr: true,
+			wantMsg: "IntermediateGracePeriod must not be negative",
+		},
+		{
+			name: "negative intermediate sign max concurrent",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:                   1 * time.Hour,
+				IntermediateCertTTL:           4 * time.Hour,
+				RootCertTTL:                   5 * time.Hour,
+				PrivateKeyType:                "ec",
+				PrivateKeyBits:                256,
+				IntermediateSignMaxConcurrent: -1,
+			},
+			wantErr: true,
+			wantMsg: "IntermediateSignMaxConcurrent must not be negative",
+		},
+		{
+			name: "unknown federation collision policy",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:               1 * time.Hour,
+				IntermediateCertTTL:       4 * time.Hour,
+				RootCertTTL:               5 * time.Hour,
+				PrivateKeyType:            "ec",
+				PrivateKeyBits:            256,
+				FederationCollisionPolicy: "merge",
+			},
+			wantErr: true,
+			wantMsg: `FederationCollisionPolicy must be "reject" or "merge-verify-only"`,
+		},
+		{
+			name: "min intermediate remaining not less than intermediate TTL",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:              1 * time.Hour,
+				IntermediateCertTTL:      4 * time.Hour,
+				RootCertTTL:              5 * time.Hour,
+				PrivateKeyType:           "ec",
+				PrivateKeyBits:           256,
+				MinIntermediateRemaining: 4 * time.Hour,
+			},
+			wantErr: true,
+			wantMsg: "MinIntermediateRemaining must be less than IntermediateCertTTL (<4h0m0s)",
+		},
+		{
+			name: "negative leaf renewal overlap",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				LeafRenewalOverlap:  -time.Minute,
+			},
+			wantErr: true,
+			wantMsg: "LeafRenewalOverlap must not be negative",
+		},
+		{
+			name: "JWT signing without service claim",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				JWTSigning:          &CAJWTSigningConfig{JWKSURL: "https://issuer.internal/jwks"},
+			},
+			wantErr: true,
+			wantMsg: "JWTSigning: ServiceClaim must be set",
+		},
+		{
+			name: "cert template key usage without what mTLS requires",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				CertTemplates: map[string]CACertTemplate{
+					"encrypt": {KeyUsage: []string{"digital_signature", "data_encipherment"}},
+				},
+			},
+			wantErr: true,
+			wantMsg: `CertTemplates["encrypt"]: KeyUsage must include digital_signature and key_encipherment, which mTLS requires`,
+		},
+		{
+			name: "audit sink of unknown type",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				AuditSink:           &CAAuditSinkConfig{Type: "kafka"},
+			},
+			wantErr: true,
+			wantMsg: "AuditSink: Type must be one of file, syslog, http",
+		},
+		{
+			name: "audit sink with a negative buffer size",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				AuditSink:           &CAAuditSinkConfig{Type: "http", BufferSize: -1},
+			},
+			wantErr: true,
+			wantMsg: "AuditSink: BufferSize must not be negative",
+		},
+		{
+			name: "JWT signing with two key sources",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				JWTSigning: &CAJWTSigningConfig{
+					JWKSURL:          "https://issuer.internal/jwks",
+					OIDCDiscoveryURL: "https://issuer.internal",
+					ServiceClaim:     "service",
+				},
+			},
+			wantErr: true,
+			wantMsg: "JWTSigning: exactly one of JWKSURL, JWTValidationPubKeys and OIDCDiscoveryURL must be set",
+		},
+		{
+			name: "cert template rule with unknown template",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				CertTemplates:       map[string]CACertTemplate{"gateway": {}},
+				CertTemplateRules: []CACertTemplateRule{
+					{IdentityType: "service", Pattern: "*-gateway", Template: "gateways"},
+				},
+			},
+			wantErr: true,
+			wantMsg: `CertTemplateRules[0]: unknown template "gateways"`,
+		},
+		{
+			name: "cert template TTL too long for intermediate",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				CertTemplates: map[string]CACertTemplate{
+					"gateway": {LeafCertTTL: 2 * time.Hour},
+				},
+			},
+			wantErr: true,
+			wantMsg: `CertTemplates["gateway"]: IntermediateCertTTL must be greater or equal than 3 * LeafCertTTL (>=6h0m0s)`,
+		},
+		{
+			name: "max service leaf cert TTL below leaf cert TTL",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:           2 * time.Hour,
+				IntermediateCertTTL:   8 * time.Hour,
+				RootCertTTL:           10 * time.Hour,
+				PrivateKeyType:        "ec",
+				PrivateKeyBits:        256,
+				MaxServiceLeafCertTTL: 1 * time.Hour,
+			},
+			wantErr: true,
+			wantMsg: "MaxServiceLeafCertTTL must be between LeafCertTTL (2h0m0s) and 8760h0m0s",
+		},
+		{
+			name: "max service leaf cert TTL above a third of intermediate cert TTL",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:           1 * time.Hour,
+				IntermediateCertTTL:   4 * time.Hour,
+				RootCertTTL:           5 * time.Hour,
+				PrivateKeyType:        "ec",
+				PrivateKeyBits:        256,
+				MaxServiceLeafCertTTL: 2 * time.Hour,
+			},
+			wantErr: true,
+			wantMsg: "IntermediateCertTTL must be greater or equal than 3 * MaxServiceLeafCertTTL (>=6h0m0s)",
+		},
+		{
+			name: "cert template with unsupported ext key usage",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				CertTemplates: map[string]CACertTemplate{
+					"gateway": {ExtKeyUsage: []string{"ocsp_signing"}},
+				},
+			},
+			wantErr: true,
+			wantMsg: `CertTemplates["gateway"]: unsupported ExtKeyUsage "ocsp_signing"`,
+		},
+		{
+			name: "unknown default cert template",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				DefaultCertTemplate: "default",
+			},
+			wantErr: true,
+			wantMsg: `DefaultCertTemplate: unknown template "default"`,
+		},
+		{
+			name: "bootstrap cert TTL too long",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:         1 * time.Hour,
+				IntermediateCertTTL: 4 * time.Hour,
+				RootCertTTL:         5 * time.Hour,
+				PrivateKeyType:      "ec",
+				PrivateKeyBits:      256,
+				BootstrapCertTTL:    time.Hour,
+			},
+			wantErr: true,
+			wantMsg: "BootstrapCertTTL must be between 2m0s and 15m0s",
+		},
+		{
+			name: "negative bootstrap CSR rate",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:              1 * time.Hour,
+				IntermediateCertTTL:      4 * time.Hour,
+				RootCertTTL:              5 * time.Hour,
+				PrivateKeyType:           "ec",
+				PrivateKeyBits:           256,
+				BootstrapCSRMaxPerSecond: -1,
+			},
+			wantErr: true,
+			wantMsg: "BootstrapCSRMaxPerSecond must not be negative",
+		},
+		{
+			name: "negative CSR rate per identity",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:                1 * time.Hour,
+				IntermediateCertTTL:        4 * time.Hour,
+				RootCertTTL:                5 * time.Hour,
+				PrivateKeyType:             "ec",
+				PrivateKeyBits:             256,
+				CSRMaxPerSecondPerIdentity: -1,
+			},
+			wantErr: true,
+			wantMsg: "CSRMaxPerSecondPerIdentity must not be negative",
+		},
+		{
+			name: "CSR rate per identity without burst",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:                1 * time.Hour,
+				IntermediateCertTTL:        4 * time.Hour,
+				RootCertTTL:                5 * time.Hour,
+				PrivateKeyType:             "ec",
+				PrivateKeyBits:             256,
+				CSRMaxPerSecondPerIdentity: 1,
+			},
+			wantErr: true,
+			wantMsg: "CSRBurstPerIdentity must be at least 1 when CSRMaxPerSecondPerIdentity is set",
+		},
+		{
+			name: "additional trust anchor not PEM",
+			cfg: &CommonCAProviderConfig{
+				LeafCertTTL:            1 * time.Hour,
+				IntermediateCertTTL:    4 * time.Hour,
+				RootCertTTL:            5 * time.Hour,
+				PrivateKeyType:         "ec",
+				PrivateKeyBits:         256,
+				AdditionalTrustAnchors: []string{"not a certificate"},
+			},
+			wantErr: true,
+			wantMsg: "AdditionalTrustAnchors[0]: must be a PEM-encoded certificate",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -163,3 +723,100 @@ func TestCAProviderConfig_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestConsulCAProviderConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *ConsulCAProviderConfig
+		wantMsg string
+	}{
+		{
+			name: "defaults",
+			cfg:  &ConsulCAProviderConfig{},
+		},
+		{
+			name: "reject",
+			cfg:  &ConsulCAProviderConfig{CSRExtensionPolicy: CSRExtensionPolicyReject},
+		},
+		{
+			name: "passthrough-allowlisted",
+			cfg: &ConsulCAProviderConfig{
+				CSRExtensionPolicy:    CSRExtensionPolicyPassthroughAllowlisted,
+				CSRExtensionAllowlist: []string{"1.3.6.1.4.1.11129.2.4.2"},
+			},
+		},
+		{
+			name:    "unknown policy",
+			cfg:     &ConsulCAProviderConfig{CSRExtensionPolicy: "drop"},
+			wantMsg: `CSRExtensionPolicy must be one of "ignore", "reject" or "passthrough-allowlisted"`,
+		},
+		{
+			name: "allowlist without passthrough",
+			cfg: &ConsulCAProviderConfig{
+				CSRExtensionPolicy:    CSRExtensionPolicyReject,
+				CSRExtensionAllowlist: []string{"1.2.3"},
+			},
+			wantMsg: `CSRExtensionAllowlist requires CSRExtensionPolicy to be "passthrough-allowlisted"`,
+		},
+		{
+			name: "invalid OID",
+			cfg: &ConsulCAProviderConfig{
+				CSRExtensionPolicy:    CSRExtensionPolicyPassthroughAllowlisted,
+				CSRExtensionAllowlist: []string{"1.2.x"},
+			},
+			wantMsg: `invalid CSRExtensionAllowlist entry "1.2.x": "x" is not a valid OID component`,
+		},
+		{
+			name: "reserved OID",
+			cfg: &ConsulCAProviderConfig{
+				CSRExtensionPolicy:    CSRExtensionPolicyPassthroughAllowlisted,
+				CSRExtensionAllowlist: []string{"2.5.29.19"},
+			},
+			wantMsg: `invalid CSRExtensionAllowlist entry "2.5.29.19": the basic constraints extension is always set by Consul`,
+		},
+		{
+			name: "CRL signer",
+			cfg: &ConsulCAProviderConfig{
+				CRLSignerEnabled: true,
+				CRLSignerCertTTL: 24 * time.Hour,
+			},
+		},
+		{
+			name:    "CRL signer TTL without CRL signer",
+			cfg:     &ConsulCAProviderConfig{CRLSignerCertTTL: 24 * time.Hour},
+			wantMsg: `CRLSignerCertTTL requires CRLSignerEnabled to be true`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantMsg == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.wantMsg)
+		})
+	}
+}
+
+func TestRootGenerationApprover(t *testing.T) {
+	token := &ACLToken{
+		AccessorID: "a",
+		Policies:   []ACLTokenPolicyLink{{ID: "p1"}},
+	}
+	approver := RootGenerationApprover(token)
+	require.Equal(t, "a", approver)
+
+	// Another token with the same permissions is another approver.
+	other := &ACLToken{
+		AccessorID: "b",
+		Policies:   []ACLTokenPolicyLink{{ID: "p1"}},
+	}
+	require.NotEqual(t, approver, RootGenerationApprover(other))
+
+	// The anonymous token and identities that aren't tokens don't identify
+	// an approver.
+	require.Empty(t, RootGenerationApprover(&ACLToken{AccessorID: ACLTokenAnonymousID}))
+	require.Empty(t, RootGenerationApprover(NewAgentRecoveryTokenIdentity("node1", "secret")))
+	require.Empty(t, RootGenerationApprover(nil))
+}
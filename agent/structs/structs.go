@@ -73,6 +73,9 @@ const (
 	ServiceVirtualIPRequestType                 = 32
 	FreeVirtualIPRequestType                    = 33
 	KindServiceNamesType                        = 34
+	ConnectCARootHistoryType                    = 35 // FSM snapshots only.
+	ConnectCASeenIdentityType                   = 36 // FSM snapshots only.
+	ConnectCAConfigHistoryType                  = 37 // FSM snapshots only.
 )
 
 // if a new request type is added above it must be
@@ -116,6 +119,9 @@ var requestTypeStrings = map[MessageType]string{
 	ServiceVirtualIPRequestType:     "ServiceVirtualIP",
 	FreeVirtualIPRequestType:        "FreeVirtualIP",
 	KindServiceNamesType:            "KindServiceName",
+	ConnectCARootHistoryType:        "ConnectCARootHistory",   // FSM snapshots only.
+	ConnectCASeenIdentityType:       "ConnectCASeenIdentity",  // FSM snapshots only.
+	ConnectCAConfigHistoryType:      "ConnectCAConfigHistory", // FSM snapshots only.
 }
 
 const (
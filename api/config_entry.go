@@ -221,11 +221,51 @@ type ServiceConfigEntry struct {
 	ExternalSNI      string                  `json:",omitempty" alias:"external_sni"`
 	UpstreamConfig   *UpstreamConfiguration  `json:",omitempty" alias:"upstream_config"`
 
+	// LeafCertTTL replaces the LeafCertTTL of the CA configuration for the
+	// leaf certificates of the service.
+	LeafCertTTL time.Duration `json:",omitempty" alias:"leaf_cert_ttl"`
+
 	Meta        map[string]string `json:",omitempty"`
 	CreateIndex uint64
 	ModifyIndex uint64
 }
 
+func (s *ServiceConfigEntry) MarshalJSON() ([]byte, error) {
+	type Alias ServiceConfigEntry
+	exported := &struct {
+		LeafCertTTL string `json:",omitempty"`
+		*Alias
+	}{
+		LeafCertTTL: s.LeafCertTTL.String(),
+		Alias:       (*Alias)(s),
+	}
+	if s.LeafCertTTL == 0 {
+		exported.LeafCertTTL = ""
+	}
+
+	return json.Marshal(exported)
+}
+
+func (s *ServiceConfigEntry) UnmarshalJSON(data []byte) error {
+	type Alias ServiceConfigEntry
+	aux := &struct {
+		LeafCertTTL string
+		*Alias
+	}{
+		Alias: (*Alias)(s),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	var err error
+	if aux.LeafCertTTL != "" {
+		if s.LeafCertTTL, err = time.ParseDuration(aux.LeafCertTTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *ServiceConfigEntry) GetKind() string            { return s.Kind }
 func (s *ServiceConfigEntry) GetName() string            { return s.Name }
 func (s *ServiceConfigEntry) GetPartition() string       { return s.Partition }
@@ -430,6 +430,7 @@ func TestDecodeConfigEntry(t *testing.T) {
 				},
 				"Protocol": "http",
 				"ExternalSNI": "abc-123",
+				"LeafCertTTL": "12h",
 				"MeshGateway": {
 					"Mode": "remote"
 				},
@@ -481,6 +482,7 @@ func TestDecodeConfigEntry(t *testing.T) {
 				},
 				Protocol:    "http",
 				ExternalSNI: "abc-123",
+				LeafCertTTL: 12 * time.Hour,
 				MeshGateway: MeshGatewayConfig{
 					Mode: MeshGatewayModeRemote,
 				},
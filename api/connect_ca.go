@@ -79,7 +79,16 @@ func ParseConsulCAConfig(raw map[string]interface{}) (*ConsulCAProviderConfig, e
 type CARootList struct {
 	ActiveRootID string
 	TrustDomain  string
-	Roots        []*CARoot
+
+	// SpiffeSequence is the sequence number of the SPIFFE trust bundle made of
+	// Roots. It increases every time the roots change.
+	SpiffeSequence uint64
+
+	// ForceRenewBefore, when set, asks clients to renew the leaf certificates
+	// they were issued before it early, spreading the renewals with jitter.
+	ForceRenewBefore *time.Time `json:",omitempty"`
+
+	Roots []*CARoot
 }
 
 // CARoot represents a root CA certificate that is trusted.
@@ -100,6 +109,16 @@ type CARoot struct {
 	// cannot be active.
 	Active bool
 
+	// TrustAnchorOnly is true for the additional trust anchors of the CA
+	// configuration, which are only trusted to verify certificates and never
+	// sign certificates for the cluster.
+	TrustAnchorOnly bool `json:",omitempty"`
+
+	// ChainError is set when some of the intermediates of this root don't
+	// chain up to the root certificate, which can happen transiently during
+	// a rotation, to why they don't.
+	ChainError string `json:",omitempty"`
+
 	CreateIndex uint64
 	ModifyIndex uint64
 }
@@ -110,22 +129,45 @@ type LeafCert struct {
 	// This is encoded in standard hex separated by :.
 	SerialNumber string
 
+	// Fingerprint is the SHA-256 hash of the DER encoding of the leaf
+	// certificate, encoded in hex separated by : like SerialNumber.
+	Fingerprint string `json:",omitempty"`
+
 	// CertPEM and PrivateKeyPEM are the PEM-encoded certificate and private
 	// key for that cert, respectively. This should not be stored in the
 	// state store, but is present in the sign API response.
 	CertPEM       string `json:",omitempty"`
 	PrivateKeyPEM string `json:",omitempty"`
 
+	// IntermediateCerts is the chain of PEM-encoded CA certificates that
+	// issued the certificate, up to but excluding the root. It is only set
+	// by secondary datacenters with IncludeIssuingChain in their CA
+	// configuration.
+	IntermediateCerts []string `json:",omitempty"`
+
 	// Service is the name of the service for which the cert was issued.
 	// ServiceURI is the cert URI value.
 	Service    string
 	ServiceURI string
 
+	// URIs, DNSNames and IPAddresses are the subject alternative names the
+	// certificate was signed with. URIs starts with ServiceURI, followed by
+	// the additional SPIFFE IDs of the certificate.
+	URIs        []string `json:",omitempty"`
+	DNSNames    []string `json:",omitempty"`
+	IPAddresses []string `json:",omitempty"`
+
 	// ValidAfter and ValidBefore are the validity periods for the
 	// certificate.
 	ValidAfter  time.Time
 	ValidBefore time.Time
 
+	// IssuerDatacenter is the datacenter of the server that issued the
+	// certificate and IssuerPartition the admin partition of the service it
+	// was issued for.
+	IssuerDatacenter string `json:",omitempty"`
+	IssuerPartition  string `json:",omitempty"`
+
 	CreateIndex uint64
 	ModifyIndex uint64
 }